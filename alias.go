@@ -0,0 +1,60 @@
+package toml
+
+import (
+	"maps"
+	"sync"
+)
+
+// aliasTable maps current key paths to the legacy paths Get falls back to.
+type aliasTable struct {
+	legacy map[string][]string // canonical current path -> legacy segments
+
+	mu   sync.Mutex
+	used map[string]string // requested path -> legacy path it was found at
+}
+
+// WithAliases makes Get and GetPath fall back to legacy key paths when a
+// key is absent. aliases maps each current path to the path it used to
+// have, such as "db.host" to "database.hostname". An alias for a table
+// applies to the keys below it, so "db" to "database" also finds
+// database.port for db.port; the longest matching alias wins. Each call
+// replaces the previous aliases. It returns d.
+func (d *Document) WithAliases(aliases map[string]string) *Document {
+	t := &aliasTable{legacy: make(map[string][]string, len(aliases)), used: make(map[string]string)}
+	for cur, old := range aliases {
+		t.legacy[JoinPath(parseDottedPath(cur)...)] = parseDottedPath(old)
+	}
+	d.aliases = t
+	return d
+}
+
+// UsedAliases returns the lookups that were answered through an alias
+// since WithAliases was called, mapping each requested path to the legacy
+// path where the key was found. Paths are quoted as Path.String does.
+func (d *Document) UsedAliases() map[string]string {
+	if d.aliases == nil {
+		return nil
+	}
+	d.aliases.mu.Lock()
+	defer d.aliases.mu.Unlock()
+	return maps.Clone(d.aliases.used)
+}
+
+func (t *aliasTable) get(d *Document, segs []string) *KeyValue {
+	for i := len(segs); i > 0; i-- {
+		old, ok := t.legacy[JoinPath(segs[:i]...)]
+		if !ok {
+			continue
+		}
+		legacy := append(append([]string(nil), old...), segs[i:]...)
+		kv := d.lookupKey(legacy)
+		if kv == nil {
+			return nil
+		}
+		t.mu.Lock()
+		t.used[JoinPath(segs...)] = JoinPath(legacy...)
+		t.mu.Unlock()
+		return kv
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package toml
+
+import (
+	"runtime"
+	"sync"
+	"weak"
+)
+
+// Annotations let tools attach their own data to nodes, such as analysis
+// results carried between passes. They are never serialized and do not
+// affect validation. Annotations are not safe for concurrent use on the
+// same node.
+
+// nodeAnnotations is the side table of node annotations. Few nodes carry
+// any, so the nodes themselves have no field for them. Entries are keyed
+// by weak pointers, so that they do not keep a node alive, and removed
+// once the node is collected.
+var nodeAnnotations = struct {
+	sync.Mutex
+	m map[weak.Pointer[baseNode]]map[string]any
+}{m: make(map[weak.Pointer[baseNode]]map[string]any)}
+
+// SetAnnotation stores val under key on the node. A nil val removes the
+// annotation.
+func (b *baseNode) SetAnnotation(key string, val any) {
+	w := weak.Make(b)
+	nodeAnnotations.Lock()
+	defer nodeAnnotations.Unlock()
+	m, ok := nodeAnnotations.m[w]
+	if !ok {
+		if val == nil {
+			return
+		}
+		runtime.AddCleanup(b, dropAnnotations, w)
+	}
+	nodeAnnotations.m[w] = setAnnotation(m, key, val)
+}
+
+// Annotation returns the value stored under key on the node and whether it
+// was present.
+func (b *baseNode) Annotation(key string) (any, bool) {
+	nodeAnnotations.Lock()
+	defer nodeAnnotations.Unlock()
+	v, ok := nodeAnnotations.m[weak.Make(b)][key]
+	return v, ok
+}
+
+func dropAnnotations(w weak.Pointer[baseNode]) {
+	nodeAnnotations.Lock()
+	defer nodeAnnotations.Unlock()
+	delete(nodeAnnotations.m, w)
+}
+
+// SetAnnotation stores val under key on the document. A nil val removes the
+// annotation.
+func (d *Document) SetAnnotation(key string, val any) {
+	d.annotations = setAnnotation(d.annotations, key, val)
+}
+
+// Annotation returns the value stored under key on the document and whether
+// it was present.
+func (d *Document) Annotation(key string) (any, bool) {
+	v, ok := d.annotations[key]
+	return v, ok
+}
+
+// Annotated is implemented by every node type in this package, including
+// Document, so annotations can be used through a Node value:
+//
+//	if a, ok := n.(toml.Annotated); ok {
+//		a.SetAnnotation("deprecated", true)
+//	}
+type Annotated interface {
+	SetAnnotation(key string, val any)
+	Annotation(key string) (any, bool)
+}
+
+func setAnnotation(m map[string]any, key string, val any) map[string]any {
+	if val == nil {
+		delete(m, key)
+		if len(m) == 0 {
+			return nil
+		}
+		return m
+	}
+	if m == nil {
+		m = make(map[string]any)
+	}
+	m[key] = val
+	return m
+}
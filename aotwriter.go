@@ -0,0 +1,77 @@
+package toml
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// AOTWriter streams the entries of an array of tables, such as the
+// [[package]] entries of a lock file, to an io.Writer one at a time,
+// without building a Document that holds them all. Each entry is written
+// as its header followed by its key-values, formatted exactly as String
+// formats them, with a blank line between entries.
+type AOTWriter struct {
+	w      io.Writer
+	header string
+	n      int
+	err    error
+}
+
+// NewAOTWriter returns an AOTWriter writing [[rawKey]] entries to w. The
+// rawKey is validated as for NewArrayOfTables. Anything already written to
+// w, such as the file's other tables, should end with a newline.
+func NewAOTWriter(w io.Writer, rawKey string) (*AOTWriter, error) {
+	if _, _, err := parseRawKey(rawKey); err != nil {
+		return nil, fmt.Errorf("invalid array-of-tables key: %w", err)
+	}
+	return &AOTWriter{w: w, header: "[[" + rawKey + "]]\n"}, nil
+}
+
+// WriteEntry writes one entry holding kvs, in order. The key-values are
+// not attached to anything, so they can be built with NewKeyValue and
+// reused. It returns an error wrapping ErrNilEntry, ErrDuplicateKey, or
+// ErrKeyConflict, without writing anything, if kvs do not form a valid
+// table, and the error from w if a write fails, after which every call
+// returns that error.
+func (a *AOTWriter) WriteEntry(kvs ...*KeyValue) error {
+	if a.err != nil {
+		return a.err
+	}
+	if err := checkEntryKeys(kvs); err != nil {
+		return err
+	}
+	var b strings.Builder
+	if a.n > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString(a.header)
+	for _, kv := range kvs {
+		serializeKeyValue(&b, kv)
+		if kv.newline == "" {
+			b.WriteString("\n")
+		}
+	}
+	if _, err := io.WriteString(a.w, b.String()); err != nil {
+		a.err = err
+		return err
+	}
+	a.n++
+	return nil
+}
+
+// Len returns the number of entries written.
+func (a *AOTWriter) Len() int { return a.n }
+
+// checkEntryKeys reports a nil key-value, a key set twice, or a key set
+// both as a value and as a table of dotted keys.
+func checkEntryKeys(kvs []*KeyValue) error {
+	entries := make([]Node, len(kvs))
+	for i, kv := range kvs {
+		if kv == nil {
+			return ErrNilEntry
+		}
+		entries[i] = kv
+	}
+	return localDuplicateCheck(entries)
+}
@@ -0,0 +1,195 @@
+package toml
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// The As methods read a key-value's value as a Go type, converting where
+// the conversion is lossless. They may be called on a nil *KeyValue, as
+// returned by Get for a missing key, and then fail with ErrKeyNotFound.
+// Other failures wrap ErrTypeMismatch and name the key and both types.
+
+// AsString returns a string value unquoted, and an integer, float,
+// boolean, or datetime as written.
+func (kv *KeyValue) AsString() (string, error) {
+	if kv == nil {
+		return "", ErrKeyNotFound
+	}
+	s, ok := asString(kv.val)
+	if !ok {
+		return "", kv.mismatch("string")
+	}
+	return s, nil
+}
+
+// AsInt returns an integer value, a float with an integral value that fits
+// in an int64, or a string that holds a decimal integer.
+func (kv *KeyValue) AsInt() (int64, error) {
+	if kv == nil {
+		return 0, ErrKeyNotFound
+	}
+	switch v := kv.val.(type) {
+	case *NumberNode:
+		if i, err := v.Int(); err == nil {
+			return i, nil
+		}
+		f, err := v.Float()
+		if err == nil && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f), nil
+		}
+	case *StringNode:
+		if i, err := strconv.ParseInt(v.Value(), 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	return 0, kv.mismatch("integer")
+}
+
+// AsFloat returns a float or integer value, or a string that holds a
+// decimal number.
+func (kv *KeyValue) AsFloat() (float64, error) {
+	if kv == nil {
+		return 0, ErrKeyNotFound
+	}
+	switch v := kv.val.(type) {
+	case *NumberNode:
+		if f, err := v.Float(); err == nil {
+			return f, nil
+		}
+	case *StringNode:
+		if f, err := strconv.ParseFloat(v.Value(), 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, kv.mismatch("float")
+}
+
+// AsBool returns a boolean value, or a string that is "true" or "false".
+func (kv *KeyValue) AsBool() (bool, error) {
+	if kv == nil {
+		return false, ErrKeyNotFound
+	}
+	switch v := kv.val.(type) {
+	case *BooleanNode:
+		return v.Value(), nil
+	case *StringNode:
+		if s := v.Value(); s == "true" || s == "false" {
+			return s == "true", nil
+		}
+	}
+	return false, kv.mismatch("boolean")
+}
+
+// AsTime returns a datetime value, or a string that holds a TOML datetime.
+// Local datetimes, dates, and times are interpreted in UTC; use
+// DateTimeNode.In for another location.
+func (kv *KeyValue) AsTime() (time.Time, error) {
+	if kv == nil {
+		return time.Time{}, ErrKeyNotFound
+	}
+	text := ""
+	switch v := kv.val.(type) {
+	case *DateTimeNode:
+		text = v.text
+	case *StringNode:
+		text = v.Value()
+	}
+	if t, err := dateTimeIn(text, time.UTC); err == nil {
+		return t, nil
+	}
+	return time.Time{}, kv.mismatch("datetime")
+}
+
+// AsStringSlice returns the elements of an array converted as by AsString.
+func (kv *KeyValue) AsStringSlice() ([]string, error) {
+	if kv == nil {
+		return nil, ErrKeyNotFound
+	}
+	arr, ok := kv.val.(*ArrayNode)
+	if !ok {
+		return nil, kv.mismatch("array of strings")
+	}
+	out := make([]string, len(arr.elements))
+	for i, elem := range arr.elements {
+		s, ok := asString(elem)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s[%d] is %s, not string", ErrTypeMismatch, kv.rawKey, i, valueTypeOf(elem))
+		}
+		out[i] = s
+	}
+	return out, nil
+}
+
+func asString(val Node) (string, bool) {
+	switch v := val.(type) {
+	case *StringNode:
+		return v.Value(), true
+	case *NumberNode, *BooleanNode, *DateTimeNode:
+		return v.Text(), true
+	}
+	return "", false
+}
+
+func (kv *KeyValue) mismatch(want string) error {
+	got := valueTypeOf(kv.val)
+	if got == TypeArray || got == TypeTable {
+		return fmt.Errorf("%w: %s is %s, not %s", ErrTypeMismatch, kv.rawKey, got, want)
+	}
+	return fmt.Errorf("%w: %s is %s %s, not %s", ErrTypeMismatch, kv.rawKey, got, kv.val.Text(), want)
+}
+
+// ToMap returns the inline table's values keyed by the path of each entry
+// as written, quoted where needed so that each key is a valid argument to
+// Get: { a.b = 1, c = 2 } gives "a.b" and "c". Nested inline tables are
+// values of the map, not flattened.
+func (n *InlineTableNode) ToMap() map[string]Node {
+	out := make(map[string]Node, len(n.entries))
+	for _, kv := range n.entries {
+		out[formatKeyPath(kv.keyParts)] = kv.val
+	}
+	return out
+}
+
+// GetString returns the value at key, a dotted path resolved as by Get, as
+// KeyValue.AsString does. It fails with ErrKeyNotFound if there is no such
+// key.
+func (n *InlineTableNode) GetString(key string) (string, error) {
+	return inlineGet(n, key, (*KeyValue).AsString)
+}
+
+// GetInt returns the value at key as KeyValue.AsInt does.
+func (n *InlineTableNode) GetInt(key string) (int64, error) {
+	return inlineGet(n, key, (*KeyValue).AsInt)
+}
+
+// GetFloat returns the value at key as KeyValue.AsFloat does.
+func (n *InlineTableNode) GetFloat(key string) (float64, error) {
+	return inlineGet(n, key, (*KeyValue).AsFloat)
+}
+
+// GetBool returns the value at key as KeyValue.AsBool does.
+func (n *InlineTableNode) GetBool(key string) (bool, error) {
+	return inlineGet(n, key, (*KeyValue).AsBool)
+}
+
+// GetTime returns the value at key as KeyValue.AsTime does.
+func (n *InlineTableNode) GetTime(key string) (time.Time, error) {
+	return inlineGet(n, key, (*KeyValue).AsTime)
+}
+
+// GetStringSlice returns the value at key as KeyValue.AsStringSlice does.
+func (n *InlineTableNode) GetStringSlice(key string) ([]string, error) {
+	return inlineGet(n, key, (*KeyValue).AsStringSlice)
+}
+
+func inlineGet[T any](n *InlineTableNode, key string, as func(*KeyValue) (T, error)) (T, error) {
+	kv := n.Get(key)
+	if kv == nil {
+		var zero T
+		return zero, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	return as(kv)
+}
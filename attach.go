@@ -0,0 +1,57 @@
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EntryError reports an invalid entry in a table or array-of-tables entry
+// that is being attached to a document. It wraps ErrDuplicateKey or
+// ErrKeyConflict.
+type EntryError struct {
+	Index   int    // position of the entry in the section's Entries
+	Key     string // raw key of the entry
+	Message string
+	Err     error
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("entry %d (%s): %s", e.Index, e.Key, e.Message)
+}
+
+func (e *EntryError) Unwrap() error { return e.Err }
+
+// checkSection validates the entries of a table or array-of-tables entry
+// on their own, before it is attached to a document, so that conflicts
+// between its own keys are reported against the entry that causes them.
+func checkSection(n Node) error {
+	var parts []KeyPart
+	var entries []Node
+	switch s := n.(type) {
+	case *TableNode:
+		parts, entries = s.headerParts, s.entries
+	case *ArrayOfTables:
+		parts, entries = s.headerParts, s.entries
+	default:
+		return nil
+	}
+	v := &docValidator{state: newTableState()}
+	base := pathKey(parts)
+	for i, e := range entries {
+		kv, ok := e.(*KeyValue)
+		if !ok {
+			continue
+		}
+		err := v.checkKeyValue(base, kv)
+		var pe *ParseError
+		if errors.As(err, &pe) {
+			sentinel := ErrKeyConflict
+			if strings.HasPrefix(pe.Message, "duplicate key") {
+				sentinel = ErrDuplicateKey
+			}
+			return &EntryError{Index: i, Key: kv.rawKey, Message: pe.Message, Err: sentinel}
+		}
+	}
+	return nil
+}
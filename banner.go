@@ -0,0 +1,95 @@
+package toml
+
+import (
+	"slices"
+	"strings"
+)
+
+// EnsureHeader makes the document start with a comment banner, one
+// "# line" comment per line, such as a license or a "GENERATED FILE — DO
+// NOT EDIT" notice. The first line is the banner's marker: if a comment
+// at the top of the document matches it, the run of comment lines starting
+// there is replaced with the banner, so calling EnsureHeader again does not
+// add a second one. Otherwise the banner and a blank line are added at the
+// top, after the checksum line if there is one. It returns an error
+// wrapping ErrCommentNewline or ErrCommentControl if a line cannot be a
+// comment, and does nothing if lines is empty.
+func (d *Document) EnsureHeader(lines []string) error {
+	banner := make([]Node, 0, 2*len(lines))
+	for _, line := range lines {
+		c, err := NewComment(bannerLine(line))
+		if err != nil {
+			return err
+		}
+		banner = append(banner, c, &WhitespaceNode{leafNode: newLeaf("\n")})
+	}
+	if len(banner) == 0 {
+		return nil
+	}
+	sites := d.topTrivia()
+	for _, s := range sites {
+		if i := slices.IndexFunc(*s.list, isBannerLine(lines[0])); i >= 0 {
+			j := i
+			for j < len(*s.list) && isComment((*s.list)[j]) {
+				j = commentEnd(*s.list, j)
+			}
+			*s.list = slices.Concat((*s.list)[:i], banner, (*s.list)[j:])
+			adoptTrivia(s.owner, banner)
+			d.changed()
+			return nil
+		}
+	}
+	s, at := d.bannerSite(sites)
+	if at < len(*s.list) || len(d.nodes) > 0 {
+		banner = append(banner, &WhitespaceNode{leafNode: newLeaf("\n")})
+	}
+	*s.list = slices.Insert(*s.list, at, banner...)
+	adoptTrivia(s.owner, banner)
+	d.changed()
+	return nil
+}
+
+// triviaSite is a trivia list and the node that owns it.
+type triviaSite struct {
+	owner Node
+	list  *[]Node
+}
+
+// topTrivia returns the trivia lists that can hold a banner: the prologue
+// and the first node's leading trivia.
+func (d *Document) topTrivia() []triviaSite {
+	sites := []triviaSite{{d, &d.prologue}}
+	if len(d.nodes) > 0 {
+		if leading := leadingTriviaOf(d.nodes[0]); leading != nil {
+			sites = append(sites, triviaSite{d.nodes[0], leading})
+		}
+	}
+	return sites
+}
+
+// bannerSite returns where a new banner goes: after the checksum line,
+// wherever that is, and otherwise at the start of the prologue.
+func (d *Document) bannerSite(sites []triviaSite) (triviaSite, int) {
+	c := checksumComment(d)
+	for _, s := range sites {
+		if c != nil && len(*s.list) > 0 && (*s.list)[0] == Node(c) {
+			return s, commentEnd(*s.list, 0)
+		}
+	}
+	return sites[0], 0
+}
+
+// bannerLine returns the comment text for one line of a banner.
+func bannerLine(line string) string {
+	return strings.TrimRight("# "+line, " \t")
+}
+
+// isBannerLine returns a function reporting whether a node is the comment
+// for line.
+func isBannerLine(line string) func(Node) bool {
+	want := bannerLine(line)
+	return func(n Node) bool {
+		c, ok := n.(*CommentNode)
+		return ok && strings.TrimRight(c.text, " \t") == want
+	}
+}
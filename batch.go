@@ -0,0 +1,182 @@
+package toml
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Batch collects mutations made inside Document.WithBatch. Structural
+// validation, which Append and InsertAt otherwise run after every call, is
+// deferred until the batch ends.
+type Batch struct {
+	doc *Document
+	err error
+}
+
+// Append adds a node to the end of the document, like Document.Append.
+func (b *Batch) Append(node Node) {
+	b.record(b.doc.Append(node))
+}
+
+// InsertAt inserts a node at position i in the document, like
+// Document.InsertAt.
+func (b *Batch) InsertAt(i int, node Node) {
+	b.record(b.doc.InsertAt(i, node))
+}
+
+// AppendTo adds a key-value pair to the end of a table or array-of-tables
+// entry of the document.
+func (b *Batch) AppendTo(section Node, kv *KeyValue) {
+	switch s := section.(type) {
+	case *TableNode:
+		b.record(s.Append(kv))
+	case *ArrayOfTables:
+		b.record(s.Append(kv))
+	default:
+		b.record(fmt.Errorf("%w: %T is not a table", ErrInvalidNodeType, section))
+	}
+}
+
+// Err returns the first error recorded by the batch so far. Errors found by
+// the deferred validation are only reported by WithBatch.
+func (b *Batch) Err() error { return b.err }
+
+func (b *Batch) record(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// WithBatch calls fn to make several structural changes to the document
+// and validates the result once at the end, so building a document of n
+// entries costs O(n) instead of O(n²). Appends and inserts on the
+// document's tables made directly inside fn are deferred the same way.
+//
+// If any call in fn fails, or the final document is invalid, the document
+// is restored to its state before the batch and the error is returned:
+// its top-level nodes, prologue and epilogue, the entries and trailing
+// comments of every table, the comments of every key-value and header,
+// and the checksum line. Values changed in place, for example with
+// KeyValue.SetValue, are not restored.
+func (d *Document) WithBatch(fn func(b *Batch)) error {
+	if d.batching {
+		// Nested batches join the outer one.
+		b := &Batch{doc: d}
+		fn(b)
+		return b.err
+	}
+	snap := d.snapshotStructure()
+	d.batching = true
+	b := &Batch{doc: d}
+	func() {
+		defer func() { d.batching = false }()
+		fn(b)
+	}()
+	err := b.err
+	if err == nil {
+		err = d.Validate()
+	}
+	if err != nil {
+		snap.restore()
+	}
+	return err
+}
+
+// validateMutation validates the document after a structural change,
+// unless a batch is in progress.
+func (d *Document) validateMutation() error {
+	d.changed()
+	if d.batching {
+		return nil
+	}
+	return d.Validate()
+}
+
+// structureSnapshot records what batch mutations change: the node and
+// trivia lists of the document, of its sections, and of their key-values,
+// and the text of the checksum line, which SetChecksum rewrites in place.
+type structureSnapshot struct {
+	doc      *Document
+	lists    []savedList
+	lines    []savedLine
+	checksum *CommentNode
+	sum      string
+}
+
+// savedList is a node list as it was, and the node that owns it.
+type savedList struct {
+	owner Node
+	list  *[]Node
+	nodes []Node
+}
+
+func (d *Document) snapshotStructure() structureSnapshot {
+	s := structureSnapshot{doc: d}
+	s.save(d, &d.prologue, &d.nodes, &d.epilogue)
+	for _, n := range d.nodes {
+		s.saveTrivia(n)
+		if entries := entriesOf(n); entries != nil {
+			s.save(n, entries, bodyTriviaOf(n))
+			for _, e := range *entries {
+				s.saveTrivia(e)
+			}
+		}
+	}
+	if c := checksumComment(d); c != nil {
+		s.checksum, s.sum = c, c.text
+	}
+	return s
+}
+
+func (s *structureSnapshot) save(owner Node, lists ...*[]Node) {
+	for _, list := range lists {
+		s.lists = append(s.lists, savedList{owner, list, slices.Clone(*list)})
+	}
+}
+
+// savedLine is the line trivia of a node as it was, including whether it
+// had any.
+type savedLine struct {
+	line  *lineTrivia
+	lists *triviaLists
+}
+
+// saveTrivia saves the leading and trailing trivia of a key-value or
+// header.
+func (s *structureSnapshot) saveTrivia(n Node) {
+	l := lineTriviaOf(n)
+	if l == nil {
+		return
+	}
+	s.lines = append(s.lines, savedLine{l, l.lists})
+	if l.lists != nil {
+		s.save(n, &l.lists.leading, &l.lists.trailing)
+	}
+}
+
+// restore puts the recorded lists back, detaches nodes added since, and
+// reattaches nodes removed or moved since. Every list is detached before
+// any is restored, as a node may have moved from one to another.
+func (s structureSnapshot) restore() {
+	for _, l := range s.lists {
+		for _, n := range *l.list {
+			setNodeParent(n, nil)
+		}
+	}
+	for _, l := range s.lines {
+		for _, n := range slices.Concat(l.line.leading(), l.line.trailing()) {
+			setNodeParent(n, nil)
+		}
+		l.line.lists = l.lists
+	}
+	for _, l := range s.lists {
+		*l.list = l.nodes
+		for _, n := range l.nodes {
+			setNodeParent(n, l.owner)
+		}
+	}
+	if s.checksum != nil {
+		s.checksum.text = s.sum
+	}
+	s.doc.changed()
+}
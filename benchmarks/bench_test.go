@@ -0,0 +1,275 @@
+package benchmarks
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	burntsushi "github.com/BurntSushi/toml"
+	"github.com/maurice/toml"
+	pelletier "github.com/pelletier/go-toml/v2"
+)
+
+// corpusDir holds the real-world files that the library's own tests use.
+var corpusDir = filepath.Join("..", "testdata", "corpus")
+
+// corpusFile is one file of the corpus.
+type corpusFile struct {
+	name string
+	data []byte
+}
+
+// corpus reads the TOML files of the corpus, leaving out the golden files
+// next to them.
+func corpus(tb testing.TB) []corpusFile {
+	tb.Helper()
+	paths, err := filepath.Glob(filepath.Join(corpusDir, "*.toml"))
+	if err != nil || len(paths) == 0 {
+		tb.Fatalf("no corpus in %s: %v", corpusDir, err)
+	}
+	var files []corpusFile
+	for _, p := range paths {
+		if strings.Count(filepath.Base(p), ".") > 1 {
+			continue // a golden file
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		files = append(files, corpusFile{filepath.Base(p), data})
+	}
+	return files
+}
+
+// library is one TOML implementation under comparison.
+type library struct {
+	name      string
+	parse     func([]byte) error
+	decode    func([]byte, *config) error
+	roundTrip func([]byte) ([]byte, error)
+}
+
+var libraries = []library{
+	{
+		name: "maurice",
+		parse: func(data []byte) error {
+			_, err := toml.Parse(data)
+			return err
+		},
+		decode: func(data []byte, c *config) error {
+			doc, err := toml.Parse(data)
+			if err != nil {
+				return err
+			}
+			return decodeConfig(doc, c)
+		},
+		roundTrip: func(data []byte) ([]byte, error) {
+			doc, err := toml.Parse(data)
+			if err != nil {
+				return nil, err
+			}
+			return []byte(doc.String()), nil
+		},
+	},
+	{
+		name: "BurntSushi",
+		parse: func(data []byte) error {
+			var m map[string]any
+			_, err := burntsushi.Decode(string(data), &m)
+			return err
+		},
+		decode: func(data []byte, c *config) error {
+			_, err := burntsushi.Decode(string(data), c)
+			return err
+		},
+		roundTrip: func(data []byte) ([]byte, error) {
+			var m map[string]any
+			if _, err := burntsushi.Decode(string(data), &m); err != nil {
+				return nil, err
+			}
+			var b bytes.Buffer
+			err := burntsushi.NewEncoder(&b).Encode(m)
+			return b.Bytes(), err
+		},
+	},
+	{
+		name: "pelletier",
+		parse: func(data []byte) error {
+			var m map[string]any
+			return pelletier.Unmarshal(data, &m)
+		},
+		decode: func(data []byte, c *config) error {
+			return pelletier.Unmarshal(data, c)
+		},
+		roundTrip: func(data []byte) ([]byte, error) {
+			var m map[string]any
+			if err := pelletier.Unmarshal(data, &m); err != nil {
+				return nil, err
+			}
+			return pelletier.Marshal(m)
+		},
+	},
+}
+
+// config is the contents of service.toml in the corpus.
+type config struct {
+	Title    string  `toml:"title"`
+	Version  int64   `toml:"version"`
+	Debug    bool    `toml:"debug"`
+	Server   server  `toml:"server"`
+	Database db      `toml:"database"`
+	Routes   []route `toml:"routes"`
+}
+
+type server struct {
+	Host    string    `toml:"host"`
+	Port    int64     `toml:"port"`
+	Timeout float64   `toml:"timeout"`
+	Tags    []string  `toml:"tags"`
+	Started time.Time `toml:"started"`
+}
+
+type db struct {
+	URL  string `toml:"url"`
+	Pool struct {
+		Min int64 `toml:"min"`
+		Max int64 `toml:"max"`
+	} `toml:"pool"`
+}
+
+type route struct {
+	Path    string   `toml:"path"`
+	Methods []string `toml:"methods"`
+}
+
+// decodeConfig fills c from doc the way a program using this package
+// reads its configuration.
+func decodeConfig(doc *toml.Document, c *config) error {
+	var err error
+	c.Title = get(&err, doc.Get("title"), (*toml.KeyValue).AsString)
+	c.Version = get(&err, doc.Get("version"), (*toml.KeyValue).AsInt)
+	c.Debug = get(&err, doc.Get("debug"), (*toml.KeyValue).AsBool)
+	c.Server.Host = get(&err, doc.Get("server.host"), (*toml.KeyValue).AsString)
+	c.Server.Port = get(&err, doc.Get("server.port"), (*toml.KeyValue).AsInt)
+	c.Server.Timeout = get(&err, doc.Get("server.timeout"), (*toml.KeyValue).AsFloat)
+	c.Server.Tags = get(&err, doc.Get("server.tags"), (*toml.KeyValue).AsStringSlice)
+	c.Server.Started = get(&err, doc.Get("server.started"), (*toml.KeyValue).AsTime)
+	c.Database.URL = get(&err, doc.Get("database.url"), (*toml.KeyValue).AsString)
+	c.Database.Pool.Min = get(&err, doc.Get("database.pool.min"), (*toml.KeyValue).AsInt)
+	c.Database.Pool.Max = get(&err, doc.Get("database.pool.max"), (*toml.KeyValue).AsInt)
+	tables := doc.ArrayOfTables("routes")
+	c.Routes = make([]route, len(tables))
+	for i, t := range tables {
+		c.Routes[i].Path = get(&err, t.Get("path"), (*toml.KeyValue).AsString)
+		c.Routes[i].Methods = get(&err, t.Get("methods"), (*toml.KeyValue).AsStringSlice)
+	}
+	return err
+}
+
+// get converts kv with as, keeping the first error in *err.
+func get[T any](err *error, kv *toml.KeyValue, as func(*toml.KeyValue) (T, error)) T {
+	v, e := as(kv)
+	if *err == nil {
+		*err = e
+	}
+	return v
+}
+
+// TestDecode checks that the libraries decode service.toml alike, so that
+// BenchmarkDecode compares equal work.
+func TestDecode(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join(corpusDir, "service.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want config
+	for i, lib := range libraries {
+		var c config
+		if err := lib.decode(data, &c); err != nil {
+			t.Fatalf("%s: %v", lib.name, err)
+		}
+		c.Server.Started = c.Server.Started.UTC()
+		if i == 0 {
+			want = c
+			continue
+		}
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("%s decoded\n%+v\nwant\n%+v", lib.name, c, want)
+		}
+	}
+	if want.Database.Pool.Max != 32 || len(want.Routes) != 2 || want.Routes[1].Methods[2] != "DELETE" {
+		t.Errorf("decoded %+v", want)
+	}
+}
+
+// TestRoundTrip checks that every library accepts the corpus and that this
+// package writes it back unchanged.
+func TestRoundTrip(t *testing.T) {
+	for _, f := range corpus(t) {
+		for _, lib := range libraries {
+			out, err := lib.roundTrip(f.data)
+			if err != nil {
+				t.Errorf("%s: %s: %v", f.name, lib.name, err)
+				continue
+			}
+			if lib.name == "maurice" && !bytes.Equal(out, f.data) {
+				t.Errorf("%s: round trip changed the file:\n%s", f.name, out)
+			}
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, f := range corpus(b) {
+		for _, lib := range libraries {
+			b.Run(f.name+"/"+lib.name, func(b *testing.B) {
+				b.SetBytes(int64(len(f.data)))
+				b.ReportAllocs()
+				for b.Loop() {
+					if err := lib.parse(f.data); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data, err := os.ReadFile(filepath.Join(corpusDir, "service.toml"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, lib := range libraries {
+		b.Run("service.toml/"+lib.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for b.Loop() {
+				var c config
+				if err := lib.decode(data, &c); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRoundTrip(b *testing.B) {
+	for _, f := range corpus(b) {
+		for _, lib := range libraries {
+			b.Run(f.name+"/"+lib.name, func(b *testing.B) {
+				b.SetBytes(int64(len(f.data)))
+				b.ReportAllocs()
+				for b.Loop() {
+					if _, err := lib.roundTrip(f.data); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
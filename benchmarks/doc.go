@@ -0,0 +1,19 @@
+// Package benchmarks compares this package with github.com/BurntSushi/toml
+// and github.com/pelletier/go-toml/v2 on the TOML files of the library's
+// corpus in ../testdata/corpus. It is a separate module so that the library
+// itself does not depend on them.
+//
+//	cd benchmarks
+//	go test -run='^$' -bench=. -benchmem
+//
+// Each benchmark has a sub-benchmark per file and library, such as
+// BenchmarkParse/cargo.toml/BurntSushi, for use with benchstat:
+//
+//   - Parse reads a file: this package builds its syntax tree, the others
+//     decode to map[string]any.
+//   - Decode fills a struct from service.toml: this package parses and
+//     reads each field with Get and the As methods, the others unmarshal.
+//   - RoundTrip parses a file and writes it back. This package reproduces
+//     the input exactly; the others re-encode the decoded map, losing
+//     comments and layout.
+package benchmarks
@@ -0,0 +1,11 @@
+module github.com/maurice/toml/benchmarks
+
+go 1.24.0
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/maurice/toml v0.0.0
+	github.com/pelletier/go-toml/v2 v2.2.3
+)
+
+replace github.com/maurice/toml => ../
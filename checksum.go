@@ -0,0 +1,133 @@
+package toml
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// checksumPrefix starts the comment line that holds a document checksum.
+const checksumPrefix = "# sha256:"
+
+// Checksum returns "sha256:" followed by the hex SHA-256 digest of the
+// document text, leaving out a checksum line at the top if there is one.
+func Checksum(doc *Document) string {
+	_, rest := splitChecksum(doc.String())
+	return HashSource([]byte(rest))
+}
+
+// SetChecksum writes the document's Checksum as a "# sha256:..." comment
+// on its first line, replacing the one there or adding a new line ended
+// like the document's first line. Once a document has one, WriteTo keeps it
+// up to date.
+func SetChecksum(doc *Document) {
+	sum := Checksum(doc)
+	if c := checksumComment(doc); c != nil {
+		c.text = "# " + sum
+		doc.changed()
+		return
+	}
+	c := &CommentNode{leafNode: newLeaf("# " + sum)}
+	nl := &WhitespaceNode{leafNode: newLeaf(firstLineBreak(doc.String()))}
+	doc.prologue = append([]Node{c, nl}, doc.prologue...)
+	adoptTrivia(doc, []Node{c, nl})
+	doc.changed()
+}
+
+// VerifyChecksum checks the checksum line at the top of the document
+// against its content. It returns an error wrapping ErrNoChecksum if there
+// is no checksum line, or ErrChecksumMismatch if the document was changed
+// after the checksum was written.
+func VerifyChecksum(doc *Document) error {
+	got, _ := splitChecksum(doc.String())
+	if got == "" {
+		return ErrNoChecksum
+	}
+	if want := Checksum(doc); got != want {
+		return fmt.Errorf("%w: file has %s, content is %s", ErrChecksumMismatch, got, want)
+	}
+	return nil
+}
+
+// WriteTo writes the document's text to w. If the document has a checksum
+// line, it is updated first to match the content. It implements
+// io.WriterTo.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if checksumComment(d) != nil {
+		SetChecksum(d)
+	}
+	n, err := io.WriteString(w, d.String())
+	return int64(n), err
+}
+
+// splitChecksum splits text into the checksum on its first line, without
+// the "# ", and the text after that line. sum is "" if the first line is
+// not a checksum line.
+func splitChecksum(text string) (sum, rest string) {
+	if !strings.HasPrefix(text, checksumPrefix) {
+		return "", text
+	}
+	line, rest, _ := strings.Cut(text, "\n")
+	return strings.TrimRight(line[len("# "):], " \t\r"), rest
+}
+
+// checksumComment returns the comment node holding the checksum line, or
+// nil.
+func checksumComment(doc *Document) *CommentNode {
+	var n Node
+	switch {
+	case len(doc.prologue) > 0:
+		n = doc.prologue[0]
+	case len(doc.nodes) > 0:
+		n = doc.nodes[0]
+	default:
+		return nil
+	}
+	if l := lineTriviaOf(n); l != nil {
+		leading := l.leading()
+		if len(leading) == 0 {
+			return nil
+		}
+		n = leading[0]
+	}
+	c, ok := n.(*CommentNode)
+	if !ok || !strings.HasPrefix(c.text, checksumPrefix) {
+		return nil
+	}
+	return c
+}
+
+// lineTriviaOf returns the line trivia of a key-value or header, or nil
+// for other nodes.
+func lineTriviaOf(n Node) *lineTrivia {
+	switch v := n.(type) {
+	case *KeyValue:
+		return &v.lineTrivia
+	case *TableNode:
+		return &v.lineTrivia
+	case *ArrayOfTables:
+		return &v.lineTrivia
+	}
+	return nil
+}
+
+// leadingTriviaOf returns the leading trivia of a key-value or header for
+// editing in place, or nil for other nodes.
+func leadingTriviaOf(n Node) *[]Node {
+	if l := lineTriviaOf(n); l != nil {
+		return l.leadingList()
+	}
+	return nil
+}
+
+// bodyTriviaOf returns the trivia after the last entry of a table or
+// array-of-tables entry, or nil for other nodes.
+func bodyTriviaOf(n Node) *[]Node {
+	switch v := n.(type) {
+	case *TableNode:
+		return &v.bodyTrivia
+	case *ArrayOfTables:
+		return &v.bodyTrivia
+	}
+	return nil
+}
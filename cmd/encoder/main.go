@@ -7,6 +7,8 @@ import (
 	"os"
 	"sort"
 	"strings"
+
+	"github.com/maurice/toml"
 )
 
 func main() {
@@ -56,7 +58,7 @@ func encodeTable(b *strings.Builder, m map[string]any, path []string) {
 
 func emitScalars(b *strings.Builder, m map[string]any, keys []string) {
 	for _, k := range keys {
-		b.WriteString(quoteKey(k))
+		b.WriteString(toml.QuoteKey(k))
 		b.WriteString(" = ")
 		encodeValue(b, m[k])
 		b.WriteString("\n")
@@ -172,7 +174,7 @@ func encodeInlineTable(b *strings.Builder, val map[string]any) {
 		if i > 0 {
 			b.WriteString(", ")
 		}
-		b.WriteString(quoteKey(k))
+		b.WriteString(toml.QuoteKey(k))
 		b.WriteString(" = ")
 		encodeValue(b, val[k])
 	}
@@ -262,37 +264,13 @@ func escapeRuneDefault(b *strings.Builder, r rune) {
 	}
 }
 
-func quoteKey(k string) string {
-	if isBareKey(k) {
-		return k
-	}
-	return `"` + escapeString(k) + `"`
-}
-
-func isBareKey(s string) bool {
-	if len(s) == 0 {
-		return false
-	}
-	for _, r := range s {
-		if !isBareKeyChar(r) {
-			return false
-		}
-	}
-	return true
-}
-
-func isBareKeyChar(r rune) bool {
-	return (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') ||
-		(r >= '0' && r <= '9') || r == '-' || r == '_'
-}
-
 func encodePath(parts []string) string {
 	var b strings.Builder
 	for i, p := range parts {
 		if i > 0 {
 			b.WriteString(".")
 		}
-		b.WriteString(quoteKey(p))
+		b.WriteString(toml.QuoteKey(p))
 	}
 	return b.String()
 }
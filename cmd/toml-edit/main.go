@@ -0,0 +1,471 @@
+// Command toml-edit is a terminal editor for the values of a TOML file. It
+// shows the file's tables and key-values as a tree, edits each value with a
+// widget suited to its type, and saves the file with its comments and
+// formatting kept.
+//
+//	toml-edit config.toml
+//
+// Keys:
+//
+//	↑ ↓ j k      move; Home and End jump to the first and last row
+//	← → h l      fold and unfold a table; ← on a key-value goes to its table
+//	Enter        edit the value, or fold and unfold a table
+//	Space        toggle a boolean
+//	+ -          step a decimal integer
+//	w, Ctrl-S    save the file
+//	q, Ctrl-C    quit; with unsaved changes, press q again to quit anyway
+//
+// While a value is being edited, Enter sets it and Esc cancels. Strings are
+// edited as their text, without quotes; other values as TOML, and must
+// keep their type, except that an integer may replace a float.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/maurice/toml"
+	"github.com/maurice/toml/internal/ffi"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: toml-edit file.toml")
+		os.Exit(2)
+	}
+	e, err := open(os.Args[1])
+	if err == nil {
+		err = runTerminal(e)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "toml-edit: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// editor holds the document being edited and the state of the screen. It
+// knows nothing of the terminal: handle takes decoded keys and view
+// returns the lines to draw.
+type editor struct {
+	path     string
+	doc      *toml.Document
+	rows     []row
+	cursor   int // index in rows of the selected row, which is never hidden
+	top      int // index in the visible rows of the first one on screen
+	width    int
+	height   int
+	dirty    bool
+	quitting bool   // q was pressed with unsaved changes
+	status   string // message shown until the next key
+	field    *field // the value being edited, or nil
+}
+
+// row is one line of the tree: a table header or inline table, which can
+// be folded, or a key-value whose value can be edited.
+type row struct {
+	label  string
+	kv     *toml.KeyValue // the key-value, or the one holding an inline table
+	group  bool
+	folded bool
+	depth  int
+}
+
+// field is the text widget for a value being edited.
+type field struct {
+	kind string // as reported by ffi.TypeOf
+	text []rune
+	pos  int
+}
+
+func open(path string) (*editor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := toml.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return &editor{path: path, doc: doc, rows: buildRows(doc), width: 80, height: 24}, nil
+}
+
+// buildRows lists the headers and key-values of doc in document order,
+// descending into inline tables.
+func buildRows(doc *toml.Document) []row {
+	var rows []row
+	for _, n := range doc.Nodes() {
+		var entries []toml.Node
+		depth := 1
+		switch v := n.(type) {
+		case *toml.KeyValue:
+			entries, depth = []toml.Node{v}, 0
+		case *toml.TableNode:
+			entries = v.Entries()
+			rows = append(rows, row{label: "[" + v.RawHeader() + "]", group: true})
+		case *toml.ArrayOfTables:
+			entries = v.Entries()
+			rows = append(rows, row{label: "[[" + v.RawHeader() + "]]", group: true})
+		}
+		for _, e := range entries {
+			if kv, ok := e.(*toml.KeyValue); ok {
+				rows = appendKeyValue(rows, kv, depth)
+			}
+		}
+	}
+	return rows
+}
+
+func appendKeyValue(rows []row, kv *toml.KeyValue, depth int) []row {
+	label := joinKey(kv.KeyParts())
+	it, ok := kv.Val().(*toml.InlineTableNode)
+	if !ok {
+		return append(rows, row{label: label, kv: kv, depth: depth})
+	}
+	rows = append(rows, row{label: label, kv: kv, group: true, depth: depth})
+	for _, e := range it.Entries() {
+		rows = appendKeyValue(rows, e, depth+1)
+	}
+	return rows
+}
+
+func joinKey(parts []toml.KeyPart) string {
+	segs := make([]string, len(parts))
+	for i, p := range parts {
+		segs[i] = p.Unquoted
+	}
+	return toml.JoinPath(segs...)
+}
+
+// visible returns the indexes of the rows not inside a folded group.
+func (e *editor) visible() []int {
+	var vis []int
+	hideBelow := -1 // rows deeper than this are hidden
+	for i, r := range e.rows {
+		if hideBelow >= 0 && r.depth > hideBelow {
+			continue
+		}
+		hideBelow = -1
+		vis = append(vis, i)
+		if r.group && r.folded {
+			hideBelow = r.depth
+		}
+	}
+	return vis
+}
+
+// handle applies one key press and reports whether the editor quits.
+func (e *editor) handle(k key) bool {
+	e.status = ""
+	if e.field != nil {
+		e.editKey(k)
+		return false
+	}
+	if len(e.rows) == 0 {
+		return k.is("q") || k.name == "ctrl-c"
+	}
+	quitting := e.quitting
+	e.quitting = false
+	r := &e.rows[e.cursor]
+	switch {
+	case k.is("q") || k.name == "ctrl-c":
+		if !e.dirty || quitting {
+			return true
+		}
+		e.quitting = true
+		e.status = "unsaved changes: q again to quit without saving, w to save"
+	case k.is("w") || k.name == "ctrl-s":
+		if err := e.save(); err != nil {
+			e.status = fmt.Sprintf("not saved: %v", err)
+		}
+	case k.name == "up" || k.is("k"):
+		e.move(-1)
+	case k.name == "down" || k.is("j"):
+		e.move(1)
+	case k.name == "home":
+		e.move(-len(e.rows))
+	case k.name == "end":
+		e.move(len(e.rows))
+	case k.name == "left" || k.is("h"):
+		if r.group && !r.folded {
+			r.folded = true
+		} else {
+			e.toParent()
+		}
+	case k.name == "right" || k.is("l"):
+		r.folded = false
+	case k.name == "enter" && r.group:
+		r.folded = !r.folded
+	case k.name == "enter":
+		e.startEdit(r)
+	case k.is(" "):
+		if b, ok := r.val().(*toml.BooleanNode); ok {
+			e.set(r, toml.NewBool(!b.Value()))
+		}
+	case k.is("+"):
+		e.step(r, 1)
+	case k.is("-"):
+		e.step(r, -1)
+	}
+	return false
+}
+
+// move moves the cursor by n visible rows, stopping at either end.
+func (e *editor) move(n int) {
+	vis := e.visible()
+	i := max(0, min(len(vis)-1, indexOf(vis, e.cursor)+n))
+	e.cursor = vis[i]
+}
+
+// toParent moves the cursor to the group holding the current row.
+func (e *editor) toParent() {
+	depth := e.rows[e.cursor].depth
+	for i := e.cursor - 1; i >= 0; i-- {
+		if e.rows[i].group && e.rows[i].depth < depth {
+			e.cursor = i
+			return
+		}
+	}
+}
+
+func indexOf(vis []int, row int) int {
+	for i, v := range vis {
+		if v == row {
+			return i
+		}
+	}
+	return 0
+}
+
+// val returns the editable value of r, or nil for headers and inline
+// tables.
+func (r *row) val() toml.Node {
+	if r.kv == nil || r.group {
+		return nil
+	}
+	return r.kv.Val()
+}
+
+// startEdit toggles a boolean, or opens a field for any other value.
+func (e *editor) startEdit(r *row) {
+	switch v := r.val().(type) {
+	case nil: // a header or inline table
+	case *toml.BooleanNode:
+		e.set(r, toml.NewBool(!v.Value()))
+	case *toml.StringNode:
+		e.field = newField("string", v.Value())
+	default:
+		e.field = newField(ffi.TypeOf(v), v.Text())
+	}
+}
+
+// step adds delta to a decimal integer. Hexadecimal, octal, and binary
+// integers, and those with underscores, are edited with Enter instead, so
+// that their notation is not lost.
+func (e *editor) step(r *row, delta int64) {
+	n, ok := r.val().(*toml.NumberNode)
+	if !ok || ffi.TypeOf(n) != "integer" {
+		e.status = "+ and - step integers"
+		return
+	}
+	if strings.ContainsAny(n.Text(), "_xob") {
+		e.status = "+ and - step decimal integers; press Enter to edit"
+		return
+	}
+	v, _ := n.Int()
+	e.set(r, toml.NewInteger(v+delta))
+}
+
+func newField(kind, text string) *field {
+	f := &field{kind: kind, text: []rune(text)}
+	f.pos = len(f.text)
+	return f
+}
+
+// editKey applies a key press to the open field.
+func (e *editor) editKey(k key) {
+	f := e.field
+	switch k.name {
+	case "enter":
+		e.commit()
+	case "esc", "ctrl-c":
+		e.field = nil
+	case "left":
+		f.pos = max(0, f.pos-1)
+	case "right":
+		f.pos = min(len(f.text), f.pos+1)
+	case "home", "ctrl-a":
+		f.pos = 0
+	case "end", "ctrl-e":
+		f.pos = len(f.text)
+	case "backspace":
+		if f.pos > 0 {
+			f.text = append(f.text[:f.pos-1], f.text[f.pos:]...)
+			f.pos--
+		}
+	case "delete":
+		if f.pos < len(f.text) {
+			f.text = append(f.text[:f.pos], f.text[f.pos+1:]...)
+		}
+	case "":
+		f.text = append(f.text[:f.pos], append([]rune{k.r}, f.text[f.pos:]...)...)
+		f.pos++
+	}
+}
+
+// commit sets the value in the open field. If the text is not a value of
+// the right kind, the field stays open with the reason on the status line.
+func (e *editor) commit() {
+	r := &e.rows[e.cursor]
+	text := string(e.field.text)
+	var val toml.Node = toml.NewString(text)
+	if e.field.kind != "string" {
+		var err error
+		if val, err = checkValue(text, e.field.kind); err != nil {
+			e.status = fmt.Sprintf("not changed: %v", err)
+			return
+		}
+	}
+	if e.set(r, val) {
+		e.field = nil
+	}
+}
+
+// set replaces the value of r and reports whether it succeeded.
+func (e *editor) set(r *row, val toml.Node) bool {
+	if err := r.kv.SetValueAligned(val); err != nil {
+		e.status = fmt.Sprintf("not changed: %v", err)
+		return false
+	}
+	e.dirty = true
+	return true
+}
+
+// checkValue parses text as a TOML value and checks that it has the given
+// kind; an integer may replace a float.
+func checkValue(text, kind string) (toml.Node, error) {
+	val, err := parseValue(text)
+	if err != nil {
+		var pe *toml.ParseError
+		if errors.As(err, &pe) {
+			return nil, errors.New(pe.Message)
+		}
+		return nil, err
+	}
+	if got := ffi.TypeOf(val); got != kind && (kind != "float" || got != "integer") {
+		return nil, fmt.Errorf("%s is %s, not %s", text, got, kind)
+	}
+	return val, nil
+}
+
+// parseValue parses line as the TOML text of one value and returns it
+// unattached.
+func parseValue(line string) (toml.Node, error) {
+	doc, err := toml.Parse([]byte("v = " + line))
+	if err != nil {
+		return nil, err
+	}
+	kv := doc.Get("v")
+	if kv == nil || len(doc.Nodes()) != 1 {
+		return nil, fmt.Errorf("%s is not a single value", line)
+	}
+	val := kv.Val()
+	// Giving the throwaway key-value another value releases val.
+	if err := kv.SetValue(toml.NewBool(false)); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// view returns the lines of the screen: a title, the visible rows
+// scrolled to keep the cursor in view, a status line, and either the help
+// or the field being edited. When a value is being edited, col is the
+// column of the text cursor on the last line; otherwise it is -1.
+func (e *editor) view() (lines []string, col int) {
+	title := e.path
+	if e.dirty {
+		title += " (modified)"
+	}
+	lines = append(lines, clip(title, e.width))
+
+	vis := e.visible()
+	n := max(1, e.height-3)
+	cur := indexOf(vis, e.cursor)
+	e.top = max(min(e.top, cur), cur-n+1)
+	for _, i := range vis[e.top:min(len(vis), e.top+n)] {
+		lines = append(lines, clip(e.rowText(i), e.width))
+	}
+	for len(lines) < n+1 {
+		lines = append(lines, "")
+	}
+
+	lines = append(lines, clip(e.status, e.width))
+	if e.field == nil {
+		help := "↑↓ move  ←→ fold  Enter edit  Space toggle  +/- step  w save  q quit"
+		return append(lines, clip(help, e.width)), -1
+	}
+	prompt := fmt.Sprintf("%s (%s): ", e.rows[e.cursor].label, e.field.kind)
+	if e.field.kind == "string" {
+		prompt = e.rows[e.cursor].label + " (string, without quotes): "
+	}
+	col = utf8.RuneCountInString(prompt) + e.field.pos
+	return append(lines, clip(prompt+string(e.field.text), e.width)), col
+}
+
+// rowText is the text of row i in the tree.
+func (e *editor) rowText(i int) string {
+	r := e.rows[i]
+	mark := "  "
+	if i == e.cursor {
+		mark = "> "
+	}
+	indent := strings.Repeat("  ", r.depth)
+	switch {
+	case r.group && r.folded:
+		return mark + indent + "▸ " + r.label
+	case r.group:
+		return mark + indent + "▾ " + r.label
+	}
+	return fmt.Sprintf("%s%s  %s = %s  (%s)", mark, indent, r.label, toml.RenderValue(r.kv), ffi.TypeOf(r.kv.Val()))
+}
+
+// clip cuts s to at most width runes.
+func clip(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:max(0, width)])
+}
+
+// save writes the document to a temporary file next to the original and
+// renames it over the original, keeping its permissions.
+func (e *editor) save() error {
+	mode := os.FileMode(0o644)
+	if fi, err := os.Stat(e.path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(e.path), filepath.Base(e.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(e.doc.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), e.path); err != nil {
+		return err
+	}
+	e.dirty = false
+	e.status = "saved " + e.path
+	return nil
+}
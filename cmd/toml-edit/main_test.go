@@ -0,0 +1,176 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sample = "# service\nname = \"api\"\nport = 80 # public\n[tls]\non = true\nratio = 1.5\nopts = { v = 1 }\n"
+
+// session opens a copy of src and returns the editor and the file's path.
+func session(t *testing.T, src string) (*editor, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e, err := open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, path
+}
+
+// press sends the keys typed as input to e and reports whether it quit.
+func press(e *editor, input string) bool {
+	for _, k := range decodeKeys([]byte(input)) {
+		if e.handle(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// screen returns the editor's view as one string.
+func screen(e *editor) string {
+	lines, _ := e.view()
+	return strings.Join(lines, "\n")
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestEditor_EditAndSave(t *testing.T) {
+	e, path := session(t, sample)
+	if s := screen(e); !strings.Contains(s, ">   name = ") || !strings.Contains(s, "    port = 80  (integer)") {
+		t.Fatalf("tree:\n%s", s)
+	}
+	press(e, "\rweb") // edit name: the field starts with the old text
+	if lines, col := e.view(); !strings.HasSuffix(lines[len(lines)-1], ": apiweb") || col != len("name (string, without quotes): apiweb") {
+		t.Errorf("field line %q, cursor at %d", lines[len(lines)-1], col)
+	}
+	press(e, "\x01\x1b[3~\x1b[3~\x1b[3~\r") // Ctrl-A and three deletes
+	press(e, "j\r\x7f\x7f8080\r-")          // port: edit, then step down
+	press(e, "jj ")                         // toggle tls.on
+	press(e, "j\r\x1b[D\x1b[D\x7f2\r")      // ratio: 1.5 becomes 2.5
+	if !strings.Contains(screen(e), "(modified)") {
+		t.Errorf("title does not show the change:\n%s", screen(e))
+	}
+	press(e, "w")
+	want := "# service\nname = \"web\"\nport = 8079 # public\n[tls]\non = false\nratio = 2.5\nopts = { v = 1 }\n"
+	if got := read(t, path); got != want {
+		t.Errorf("saved file:\n%s\nwant\n%s", got, want)
+	}
+	if s := screen(e); !strings.Contains(s, "saved ") || strings.Contains(s, "(modified)") {
+		t.Errorf("screen after saving:\n%s", s)
+	}
+	if !press(e, "q") {
+		t.Error("q did not quit after saving")
+	}
+}
+
+func TestEditor_Rejections(t *testing.T) {
+	for _, tt := range []struct {
+		keys, want string
+	}{
+		{"j\r\x7f\x7f\"x\"\r", `not changed: "x" is string, not integer`},
+		{"j\r 2\r", "not changed: expected newline or end of file after value"},
+		{"jjjj\r\x7f\x7f\x7f\r", "not changed: "},
+		{"j\x1b[B+", "+ and - step integers"},
+	} {
+		e, path := session(t, sample)
+		press(e, tt.keys)
+		if s := screen(e); !strings.Contains(s, tt.want) || e.dirty {
+			t.Errorf("%q: screen\n%s\nwant %q, no change", tt.keys, s, tt.want)
+		}
+		press(e, "\x1bq") // Esc closes a field left open
+		if e.field != nil || read(t, path) != sample {
+			t.Errorf("%q: field open or file changed", tt.keys)
+		}
+	}
+
+	e, _ := session(t, "n = 0x1F\n")
+	press(e, "+")
+	if !strings.Contains(screen(e), "press Enter to edit") || e.dirty {
+		t.Errorf("stepped a hexadecimal integer:\n%s", screen(e))
+	}
+}
+
+func TestEditor_Fold(t *testing.T) {
+	e, _ := session(t, sample)
+	press(e, "jj")
+	if s := screen(e); !strings.Contains(s, "> ▾ [tls]") || !strings.Contains(s, "on = true") {
+		t.Fatalf("tree:\n%s", s)
+	}
+	press(e, "h")
+	if s := screen(e); !strings.Contains(s, "> ▸ [tls]") || strings.Contains(s, "on = true") {
+		t.Errorf("folded tree:\n%s", s)
+	}
+	press(e, "j") // nothing below the folded table
+	if s := screen(e); !strings.Contains(s, "> ▸ [tls]") {
+		t.Errorf("moved into a folded table:\n%s", s)
+	}
+	press(e, "\r\x1b[F")
+	if s := screen(e); !strings.Contains(s, ">       v = 1  (integer)") {
+		t.Errorf("unfolded tree, cursor at the end:\n%s", s)
+	}
+	press(e, "hh") // to the inline table, then fold it
+	if s := screen(e); !strings.Contains(s, ">   ▸ opts") || strings.Contains(s, "v = 1") {
+		t.Errorf("folded inline table:\n%s", s)
+	}
+	press(e, "hh\x1b[H")
+	if s := screen(e); !strings.Contains(s, ">   name = ") {
+		t.Errorf("Home:\n%s", s)
+	}
+}
+
+func TestEditor_Scroll(t *testing.T) {
+	e, _ := session(t, sample)
+	e.height = 5 // title, two rows, status, help
+	press(e, "jjj")
+	lines, _ := e.view()
+	if len(lines) != 5 || !strings.Contains(lines[1], "[tls]") || !strings.HasPrefix(lines[2], ">") {
+		t.Errorf("scrolled view:\n%s", strings.Join(lines, "\n"))
+	}
+	press(e, "\x1b[A\x1b[A\x1b[A")
+	if lines, _ := e.view(); !strings.HasPrefix(lines[1], ">   name") {
+		t.Errorf("scrolled back:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestEditor_QuitWithUnsavedChanges(t *testing.T) {
+	e, path := session(t, sample)
+	if press(e, "jjj q") {
+		t.Fatal("q quit with unsaved changes")
+	}
+	if !strings.Contains(screen(e), "unsaved changes") {
+		t.Errorf("no warning:\n%s", screen(e))
+	}
+	if press(e, "j") || press(e, "q") {
+		t.Error("q after another key quit without a second warning")
+	}
+	if !press(e, "\x03") || read(t, path) != sample {
+		t.Error("Ctrl-C did not quit without saving")
+	}
+}
+
+func TestDecodeKeys(t *testing.T) {
+	got := decodeKeys([]byte("a\x1b[A\x1bOB\x1b[3~\x1b[1;5C\r\x7fé\x13\x1b\x02\x1b[1"))
+	// Ctrl-→, Ctrl-B, and the cut-off sequence at the end are dropped.
+	want := []key{
+		{r: 'a'}, {name: "up"}, {name: "down"}, {name: "delete"},
+		{name: "enter"}, {name: "backspace"}, {r: 'é'}, {name: "ctrl-s"}, {name: "esc"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeKeys = %v, want %v", got, want)
+	}
+}
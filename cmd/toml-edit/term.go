@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+)
+
+// key is one key press: a printable rune, or a named key such as "up",
+// "enter", or "ctrl-s".
+type key struct {
+	r    rune
+	name string
+}
+
+// is reports whether k is the printable character s.
+func (k key) is(s string) bool {
+	return k.name == "" && string(k.r) == s
+}
+
+// csiKeys names the keys sent as ESC [ or ESC O and a final byte, or as
+// ESC [ n ~.
+var csiKeys = map[string]string{
+	"A": "up", "B": "down", "C": "right", "D": "left", "H": "home", "F": "end",
+	"1~": "home", "7~": "home", "4~": "end", "8~": "end", "3~": "delete",
+}
+
+// ctrlKeys names the control characters the editor uses.
+var ctrlKeys = map[byte]string{
+	'\r': "enter", '\n': "enter", 0x7f: "backspace", 0x08: "backspace",
+	0x01: "ctrl-a", 0x03: "ctrl-c", 0x05: "ctrl-e", 0x13: "ctrl-s", 0x1b: "esc",
+}
+
+// decodeKeys splits the bytes read from a terminal in raw mode into key
+// presses. Escape sequences the editor does not use, and other control
+// characters, are dropped.
+func decodeKeys(b []byte) []key {
+	var keys []key
+	for len(b) > 0 {
+		if b[0] == 0x1b && len(b) > 2 && (b[1] == '[' || b[1] == 'O') {
+			end := 2
+			for end < len(b) && (b[end] < 0x40 || b[end] > 0x7e) {
+				end++
+			}
+			if end == len(b) {
+				break // a cut-off sequence
+			}
+			if name, ok := csiKeys[string(b[2:end+1])]; ok {
+				keys = append(keys, key{name: name})
+			}
+			b = b[end+1:]
+			continue
+		}
+		if name, ok := ctrlKeys[b[0]]; ok {
+			keys = append(keys, key{name: name})
+			b = b[1:]
+			continue
+		}
+		r, size := utf8.DecodeRune(b)
+		if r >= ' ' && r != utf8.RuneError {
+			keys = append(keys, key{r: r})
+		}
+		b = b[size:]
+	}
+	return keys
+}
+
+// runTerminal runs e full screen on the terminal on stdin and stdout until
+// the user quits.
+func runTerminal(e *editor) error {
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return errors.New("standard input is not a terminal")
+	}
+	state, err := stty("-g")
+	if err != nil {
+		return fmt.Errorf("reading terminal mode: %w", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return fmt.Errorf("setting terminal mode: %w", err)
+	}
+	defer stty(strings.TrimSpace(state))
+	fmt.Print("\x1b[?1049h") // switch to the alternate screen
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	buf := make([]byte, 256)
+	for {
+		// The size is read before each draw so that a resized window
+		// is redrawn to fit on the next key.
+		e.width, e.height = termSize()
+		draw(os.Stdout, e)
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, k := range decodeKeys(buf[:n]) {
+			if e.handle(k) {
+				return nil
+			}
+		}
+	}
+}
+
+// draw writes the editor's view to w, each line at its row of the screen,
+// and shows the text cursor only while a value is being edited.
+func draw(w io.Writer, e *editor) {
+	lines, col := e.view()
+	var b strings.Builder
+	b.WriteString("\x1b[?25l")
+	for i, line := range lines {
+		fmt.Fprintf(&b, "\x1b[%d;1H%s\x1b[K", i+1, line)
+	}
+	b.WriteString("\x1b[J")
+	if col >= 0 {
+		fmt.Fprintf(&b, "\x1b[%d;%dH\x1b[?25h", len(lines), col+1)
+	}
+	fmt.Fprint(w, b.String())
+}
+
+// stty runs stty on the terminal on stdin and returns its output.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// termSize returns the terminal's width and height, or 80 by 24 if stty
+// cannot tell.
+func termSize() (width, height int) {
+	out, err := stty("size")
+	if err == nil {
+		if _, err := fmt.Sscan(out, &height, &width); err == nil && width > 0 && height > 0 {
+			return width, height
+		}
+	}
+	return 80, 24
+}
@@ -0,0 +1,23 @@
+// Command toml-lsp is a Language Server Protocol server for TOML. It
+// speaks JSON-RPC over stdin and stdout.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/maurice/toml/lsp"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := lsp.NewServer().Serve(ctx, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "toml-lsp: %v\n", err)
+		stop()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,316 @@
+package toml
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CommentOut replaces the key-value at path, which may be indexed as for
+// Delete, with comment lines holding its text, so that "port = 8080"
+// becomes "# port = 8080" on the same line. Its indentation, the comments
+// above it, and its trailing comment are kept. A value spanning several
+// lines becomes one comment line per line. Uncomment reverses it.
+func (d *Document) CommentOut(path string) error {
+	kv := d.deleteTarget(path)
+	if kv == nil {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, path)
+	}
+	list := entriesOf(kv.parent)
+	if list == nil {
+		return fmt.Errorf("%w: cannot comment out %s inside an inline table", ErrInvalidNodeType, path)
+	}
+	i := slices.Index(*list, Node(kv))
+	nodes := commentedLines(kv)
+	*list = slices.Replace(*list, i, i+1, nodes...)
+	adoptTrivia(kv.parent, nodes)
+	kv.setParent(nil)
+	d.changed()
+	return nil
+}
+
+// entriesOf returns the node list of a document or section, or nil.
+func entriesOf(n Node) *[]Node {
+	switch v := n.(type) {
+	case *Document:
+		return &v.nodes
+	case *TableNode:
+		return &v.entries
+	case *ArrayOfTables:
+		return &v.entries
+	}
+	return nil
+}
+
+// commentedLines returns the trivia that replaces kv when it is commented
+// out.
+func commentedLines(kv *KeyValue) []Node {
+	out := slices.Clone(kv.leading())
+	n := sameLineTrivia(kv.trailing())
+	var text strings.Builder
+	text.WriteString(kv.Text())
+	serializeTrivia(&text, kv.trailing()[:n])
+	lines := strings.Split(text.String(), "\n")
+	for i, line := range lines {
+		line, cr := strings.CutSuffix(line, "\r")
+		out = append(out, &CommentNode{leafNode: newLeaf(strings.TrimRight("# "+line, " "))})
+		nl := kv.newline
+		if i < len(lines)-1 {
+			nl = "\n"
+			if cr {
+				nl = "\r\n"
+			}
+		}
+		if nl != "" {
+			out = append(out, &WhitespaceNode{leafNode: newLeaf(nl)})
+		}
+	}
+	return append(out, kv.trailing()[n:]...)
+}
+
+// sameLineTrivia returns how many of a key-value's trailing trivia nodes
+// are on its line, as opposed to trivia at the end of the document.
+func sameLineTrivia(trivia []Node) int {
+	for i, n := range trivia {
+		if n.Type() == NodeComment {
+			return i + 1
+		}
+		if strings.ContainsAny(n.Text(), "\r\n") {
+			return i
+		}
+	}
+	return len(trivia)
+}
+
+// Uncomment restores a key-value commented out by CommentOut, or written
+// by hand as one or more comment lines of the form "# key = value". path
+// is the key's full dotted path: a commented-out key belongs to the table
+// whose section it appears in. The comment lines are replaced by the
+// key-value, and the comments above them become its leading trivia. It
+// fails with ErrKeyNotFound if there is no such comment, or with a
+// validation error if restoring the key would make the document invalid,
+// for example because the key is set again elsewhere.
+func (d *Document) Uncomment(path string) error {
+	want := parseDottedPath(path)
+	if s := prologueSite(d, want); s != nil {
+		return d.uncomment(s)
+	}
+	var owner Node = d
+	var prefix []KeyPart
+	for k, n := range d.nodes {
+		var s *uncommentSite
+		switch v := n.(type) {
+		case *TableNode:
+			s = headerSite(&v.lineTrivia, owner, k, prefix, want)
+			owner, prefix = v, v.headerParts
+		case *ArrayOfTables:
+			s = headerSite(&v.lineTrivia, owner, k, prefix, want)
+			owner, prefix = v, v.headerParts
+		case *KeyValue:
+			s = keyValueSite(v, prefix, want)
+		default:
+			if k == 0 || !isTriviaNode(d.nodes[k-1]) {
+				s = looseSite(&d.nodes, k, owner, prefix, want)
+			}
+		}
+		if s == nil && n == owner {
+			s = sectionSite(owner, prefix, want)
+		}
+		if s != nil {
+			return d.uncomment(s)
+		}
+	}
+	if kv, i, j := findCommented(d.epilogue, 0, prefix, want); kv != nil {
+		return d.uncomment(&uncommentSite{kv: kv, list: &d.epilogue, i: i, j: j, target: owner, at: -1})
+	}
+	return fmt.Errorf("%w: no commented-out %s", ErrKeyNotFound, path)
+}
+
+// prologueSite looks for the key in the document's prologue. The comments
+// right above it, after the last blank line, go with the key-value to the
+// top of the document.
+func prologueSite(d *Document, want []string) *uncommentSite {
+	kv, i, j := findCommented(d.prologue, 0, nil, want)
+	if kv == nil {
+		return nil
+	}
+	lo := len(detachedTrivia(d.prologue[:i]))
+	return &uncommentSite{kv: kv, list: &d.prologue, lo: lo, i: i, j: j, target: d, at: 0}
+}
+
+// uncommentSite locates the comment lines of a commented-out key-value and
+// where to put the key-value.
+type uncommentSite struct {
+	kv     *KeyValue
+	list   *[]Node // trivia list or entries holding the comment lines
+	lo     int     // start of the trivia that becomes kv's leading trivia
+	i, j   int     // the comment lines, through the newline after the last
+	target Node    // document or section to insert kv into
+	at     int     // index in target's entries once the lines are removed, or -1 to append
+}
+
+// headerSite looks for the key in the leading trivia of a header, which
+// belongs to the section before it.
+func headerSite(l *lineTrivia, owner Node, k int, prefix []KeyPart, want []string) *uncommentSite {
+	kv, i, j := findCommented(l.leading(), 0, prefix, want)
+	if kv == nil {
+		return nil
+	}
+	at := -1
+	if _, ok := owner.(*Document); ok {
+		at = k
+	}
+	return &uncommentSite{kv: kv, list: l.leadingList(), i: i, j: j, target: owner, at: at}
+}
+
+// keyValueSite looks for the key in the leading trivia of kv.
+func keyValueSite(kv *KeyValue, prefix []KeyPart, want []string) *uncommentSite {
+	found, i, j := findCommented(kv.leading(), 0, prefix, want)
+	if found == nil {
+		return nil
+	}
+	at := slices.Index(*entriesOf(kv.parent), Node(kv))
+	return &uncommentSite{kv: found, list: kv.leadingList(), i: i, j: j, target: kv.parent, at: at}
+}
+
+// looseSite looks for the key in the run of trivia nodes starting at
+// index k of list.
+func looseSite(list *[]Node, k int, owner Node, prefix []KeyPart, want []string) *uncommentSite {
+	end := k
+	for end < len(*list) && isTriviaNode((*list)[end]) {
+		end++
+	}
+	kv, i, j := findCommented((*list)[:end], k, prefix, want)
+	if kv == nil {
+		return nil
+	}
+	s := &uncommentSite{kv: kv, list: list, lo: k, i: i, j: j, target: owner, at: -1}
+	if entriesOf(owner) == list {
+		s.at = k
+	}
+	return s
+}
+
+// sectionSite looks for the key in the entries of a table section and
+// in the trivia after them.
+func sectionSite(owner Node, prefix []KeyPart, want []string) *uncommentSite {
+	list := entriesOf(owner)
+	for k, n := range *list {
+		var s *uncommentSite
+		if kv, ok := n.(*KeyValue); ok {
+			s = keyValueSite(kv, prefix, want)
+		} else if k == 0 || !isTriviaNode((*list)[k-1]) {
+			s = looseSite(list, k, owner, prefix, want)
+		}
+		if s != nil {
+			return s
+		}
+	}
+	if body := bodyTriviaOf(owner); body != nil {
+		if kv, i, j := findCommented(*body, 0, prefix, want); kv != nil {
+			return &uncommentSite{kv: kv, list: body, i: i, j: j, target: owner, at: -1}
+		}
+	}
+	return nil
+}
+
+// findCommented returns the key-value commented out at or after index from
+// of a trivia list whose full path is want, and the index range of its
+// comment lines and final newline.
+func findCommented(list []Node, from int, prefix []KeyPart, want []string) (kv *KeyValue, i, j int) {
+	for i = from; i < len(list); i++ {
+		c, ok := list[i].(*CommentNode)
+		if !ok || !commentedKeyIs(commentBody(c.text), prefix, want) {
+			continue
+		}
+		var body strings.Builder
+		for j = i; j < len(list); j += 2 {
+			if j > i {
+				if !isNewlineNode(list[j-1]) || list[j].Type() != NodeComment {
+					break
+				}
+				body.WriteString(list[j-1].Text())
+			}
+			body.WriteString(commentBody(list[j].Text()))
+			if kv, ok := parseCommentedKeyValue(body.String()); ok {
+				return kv, i, commentEnd(list, j)
+			}
+		}
+	}
+	return nil, 0, 0
+}
+
+// commentEnd returns the index after the comment at j and its newline.
+func commentEnd(list []Node, j int) int {
+	if j+1 < len(list) && isNewlineNode(list[j+1]) {
+		return j + 2
+	}
+	return j + 1
+}
+
+func isNewlineNode(n Node) bool {
+	return n.Type() == NodeWhitespace && (n.Text() == "\n" || n.Text() == "\r\n")
+}
+
+// commentedKeyIs reports whether the comment body starts with a key whose
+// full path within the section prefix is want.
+func commentedKeyIs(body string, prefix []KeyPart, want []string) bool {
+	key, _, ok := strings.Cut(body, "=")
+	if !ok || len(want) <= len(prefix) || !matchKeyParts(prefix, want[:len(prefix)]) {
+		return false
+	}
+	return slices.Equal(parseDottedPath(strings.TrimSpace(key)), want[len(prefix):])
+}
+
+// TryParseKeyValue parses the comment's text after the "#" and one space
+// as a key-value, as in "# port = 8080", and reports whether it is exactly
+// one. A comment holding only part of a multi-line value, or prose that
+// is not TOML, is not a key-value. The result has no parent; it can be
+// attached in place of the comment to enable the setting.
+func (c *CommentNode) TryParseKeyValue() (*KeyValue, bool) {
+	return parseCommentedKeyValue(commentBody(c.text))
+}
+
+// parseCommentedKeyValue parses text as a single key-value.
+func parseCommentedKeyValue(text string) (*KeyValue, bool) {
+	doc, err := Parse([]byte(text))
+	if err != nil || len(doc.nodes) != 1 {
+		return nil, false
+	}
+	kv, ok := doc.nodes[0].(*KeyValue)
+	if !ok {
+		return nil, false
+	}
+	kv.setParent(nil)
+	return kv, true
+}
+
+func (d *Document) uncomment(s *uncommentSite) error {
+	list, target := *s.list, entriesOf(s.target)
+	oldList, oldTarget := list, *target
+	leading := list[s.lo:s.i]
+	var oldParent Node
+	if len(leading) > 0 {
+		oldParent = leading[0].Parent()
+	}
+	kv := s.kv
+	kv.setLeading(append(slices.Clone(leading), kv.leading()...))
+	if nl := list[s.j-1]; isNewlineNode(nl) {
+		kv.newline = nl.Text()
+	}
+	*s.list = slices.Concat(list[:s.lo], list[s.j:])
+	at := s.at
+	if at < 0 {
+		at = len(*target)
+	}
+	*target = slices.Insert(slices.Clone(*target), at, Node(kv))
+	adoptTrivia(kv, leading)
+	kv.setParent(s.target)
+	if err := d.validateMutation(); err != nil {
+		*s.list, *target = oldList, oldTarget
+		adoptTrivia(oldParent, leading)
+		kv.setParent(nil)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package toml
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CandidateKind classifies a completion candidate.
+type CandidateKind int
+
+// Candidate kinds.
+const (
+	CandidateKey CandidateKind = iota
+	CandidateTable
+	CandidateArrayOfTables
+	CandidateValue
+)
+
+// Candidate is a completion suggestion returned by CompletionsAt.
+type Candidate struct {
+	Label   string        // key, dotted table path, or TOML value text
+	Kind    CandidateKind // what Label completes
+	Detail  string        // the expected type, or "default"
+	Doc     string        // the schema description
+	Replace Span          // the partially typed text the candidate replaces
+}
+
+// CompletionsAt returns completion candidates from schema for a cursor at
+// byte offset in doc.String(). In a table header it suggests table paths,
+// in a key it suggests the keys of the enclosing table, after "=" it
+// suggests allowed, boolean, and default values, and on an empty line it
+// suggests keys not yet set in the enclosing table. Candidates are filtered
+// by the text already typed and returned in schema order (sorted by name).
+func CompletionsAt(doc *Document, schema *Schema, offset int) []Candidate {
+	if schema == nil {
+		return nil
+	}
+	text := doc.String()
+	offset = max(0, min(offset, len(text)))
+	spans := doc.Spans()
+	n, sp := completionContext(spans, offset)
+	switch v := n.(type) {
+	case *CommentNode:
+		return nil
+	case *TableNode:
+		return headerCandidates(schema, text, sp, 1, offset, TypeTable)
+	case *ArrayOfTables:
+		return headerCandidates(schema, text, sp, 2, offset, TypeArrayOfTables)
+	case *KeyValue:
+		table := schema.lookupSegs(containerPath(v.parent))
+		keyEnd := sp.Start + len(v.rawKey)
+		if offset <= keyEnd {
+			return keyCandidates(table.inContainer(v.parent), text, Span{sp.Start, offset}, nil)
+		}
+		if v.val != nil && offset >= spans[v.val].Start {
+			return valueCandidates(table.valueSchema(v), spans[v.val])
+		}
+		return nil
+	}
+	container := enclosingTable(doc, spans, offset)
+	table := schema.lookupSegs(containerPath(container))
+	return keyCandidates(table.inContainer(container), text, Span{offset, offset}, container)
+}
+
+// inContainer returns s, the schema of the table container, with the
+// fields of the variant that the container's discriminator selects.
+func (s *Schema) inContainer(container Node) *Schema {
+	if s == nil || s.Discriminator == "" {
+		return s
+	}
+	t := newLTable(container)
+	addLogicalEntries(t, containerEntries(container))
+	v, _, _ := s.discriminator(t)
+	return s.variant(v)
+}
+
+// valueSchema returns the schema of kv's value, given s, the schema of the
+// table holding kv. The discriminator's values are the variant names.
+func (s *Schema) valueSchema(kv *KeyValue) *Schema {
+	segs := partsToSegs(kv.keyParts)
+	vs := s.inContainer(kv.parent).lookupSegs(segs)
+	if s == nil || len(segs) != 1 || segs[0] != s.Discriminator || vs != nil && len(vs.Values) > 0 {
+		return vs
+	}
+	d := &Schema{Type: TypeString}
+	if vs != nil {
+		cp := *vs
+		d = &cp
+	}
+	for _, name := range s.variantNames() {
+		d.Values = append(d.Values, strconv.Quote(name))
+	}
+	return d
+}
+
+// completionContext returns the innermost key-value, header, or comment
+// whose span contains offset, counting the span end as inside so that a
+// cursor right after a word completes it.
+func completionContext(spans map[Node]Span, offset int) (Node, Span) {
+	var best Node
+	var bestSpan Span
+	for n, sp := range spans {
+		switch n.(type) {
+		case *KeyValue, *TableNode, *ArrayOfTables:
+		case *CommentNode:
+			if offset == sp.Start {
+				continue // before the '#'
+			}
+		default:
+			continue
+		}
+		if offset < sp.Start || offset > sp.End {
+			continue
+		}
+		if best == nil || sp.End-sp.Start < bestSpan.End-bestSpan.Start {
+			best, bestSpan = n, sp
+		}
+	}
+	return best, bestSpan
+}
+
+// enclosingTable returns the last table or array-of-tables entry whose
+// header starts before offset, or the document.
+func enclosingTable(doc *Document, spans map[Node]Span, offset int) Node {
+	var container Node = doc
+	for _, n := range doc.nodes {
+		switch n.(type) {
+		case *TableNode, *ArrayOfTables:
+			if spans[n].Start < offset {
+				container = n
+			}
+		}
+	}
+	return container
+}
+
+// containerPath returns the key path of the table that holds the entries
+// of n.
+func containerPath(n Node) []string {
+	var segs []string
+	for ; n != nil; n = n.Parent() {
+		switch v := n.(type) {
+		case *TableNode:
+			segs = append(partsToSegs(v.headerParts), segs...)
+		case *ArrayOfTables:
+			segs = append(partsToSegs(v.headerParts), segs...)
+		case *KeyValue:
+			segs = append(partsToSegs(v.keyParts), segs...)
+		}
+	}
+	return segs
+}
+
+func partsToSegs(parts []KeyPart) []string {
+	segs := make([]string, len(parts))
+	for i, p := range parts {
+		segs[i] = p.Unquoted
+	}
+	return segs
+}
+
+// keyCandidates suggests the fields of s that match the typed text in
+// replace. Dotted input descends into sub-tables, read as SplitPath does,
+// so a quoted segment may hold dots. Keys already set directly in
+// container are skipped.
+func keyCandidates(s *Schema, text string, replace Span, container Node) []Candidate {
+	typed := strings.TrimSpace(text[replace.Start:replace.End])
+	segs := SplitPath(typed)
+	if len(segs) == 0 || strings.HasSuffix(typed, ".") && !strings.HasSuffix(segs[len(segs)-1], ".") {
+		segs = append(segs, "") // nothing typed of the last segment yet
+	}
+	dir, partial := "", segs[len(segs)-1]
+	if len(segs) > 1 {
+		dir = JoinPath(segs[:len(segs)-1]...) + "."
+		s = s.lookupSegs(segs[:len(segs)-1])
+	}
+	if s == nil {
+		return nil
+	}
+	present := presentKeys(container)
+	var out []Candidate
+	for _, name := range s.fieldNames() {
+		f := s.Fields[name]
+		if !strings.HasPrefix(name, partial) || present[name] || f.Type == TypeArrayOfTables {
+			continue
+		}
+		out = append(out, Candidate{
+			Label: dir + QuoteKey(name), Kind: CandidateKey,
+			Detail: f.Type.String(), Doc: f.Description, Replace: replace,
+		})
+	}
+	return out
+}
+
+func presentKeys(container Node) map[string]bool {
+	present := make(map[string]bool)
+	for _, e := range containerEntries(container) {
+		if kv, ok := e.(*KeyValue); ok && len(kv.keyParts) == 1 {
+			present[kv.keyParts[0].Unquoted] = true
+		}
+	}
+	return present
+}
+
+// containerEntries returns the entries of a table or array-of-tables
+// entry, or the top-level nodes of a document.
+func containerEntries(container Node) []Node {
+	switch v := container.(type) {
+	case *Document:
+		return v.nodes
+	case *TableNode:
+		return v.entries
+	case *ArrayOfTables:
+		return v.entries
+	}
+	return nil
+}
+
+// headerCandidates suggests table paths of type want that start with the
+// text typed between the opening brackets and offset.
+func headerCandidates(s *Schema, text string, hdr Span, brackets, offset int, want ValueType) []Candidate {
+	start := hdr.Start + brackets
+	if offset < start || offset > hdr.End-brackets {
+		return nil // outside the brackets
+	}
+	for start < offset && (text[start] == ' ' || text[start] == '\t') {
+		start++
+	}
+	typed := text[start:offset]
+	kind := CandidateTable
+	if want == TypeArrayOfTables {
+		kind = CandidateArrayOfTables
+	}
+	var out []Candidate
+	var walk func(s *Schema, prefix string)
+	walk = func(s *Schema, prefix string) {
+		for _, name := range s.fieldNames() {
+			f := s.Fields[name]
+			path := prefix + QuoteKey(name)
+			if f.Type == want && strings.HasPrefix(path, typed) {
+				out = append(out, Candidate{
+					Label: path, Kind: kind, Detail: f.Type.String(),
+					Doc: f.Description, Replace: Span{start, offset},
+				})
+			}
+			if f.Type == TypeTable || f.Type == TypeArrayOfTables {
+				walk(f, path+".")
+			}
+		}
+	}
+	walk(s, "")
+	return out
+}
+
+// valueCandidates suggests the allowed values of s, true and false for
+// booleans, and the default.
+func valueCandidates(s *Schema, replace Span) []Candidate {
+	if s == nil {
+		return nil
+	}
+	values := s.Values
+	if len(values) == 0 && s.Type == TypeBoolean {
+		values = []string{"true", "false"}
+	}
+	var out []Candidate
+	for _, v := range values {
+		out = append(out, Candidate{Label: v, Kind: CandidateValue, Detail: s.Type.String(), Doc: s.Description, Replace: replace})
+	}
+	if s.Default != "" && !slices.Contains(values, s.Default) {
+		out = append(out, Candidate{Label: s.Default, Kind: CandidateValue, Detail: "default", Doc: s.Description, Replace: replace})
+	}
+	return out
+}
@@ -0,0 +1,246 @@
+package toml
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ConfigMapOptions configures ConfigMap and ConfigMapData.
+type ConfigMapOptions struct {
+	// Name and Namespace are the manifest's metadata. Namespace is
+	// omitted if empty.
+	Name      string
+	Namespace string
+
+	// Secret renders a Secret of type Opaque instead of a ConfigMap, with
+	// the values base64-encoded.
+	Secret bool
+
+	// JSON renders the manifest as JSON instead of YAML.
+	JSON bool
+
+	// Paths selects the tables to include, as paths accepted by Extract.
+	// Empty means the whole document.
+	Paths []string
+
+	// Files gives one entry per selected table, holding its TOML text as
+	// returned by Extract and keyed by its path and ".toml", or a single
+	// "config.toml" entry for the whole document. Otherwise there is one
+	// entry per value, keyed by its dotted path with array-of-tables
+	// entries numbered, as in "servers.0.host".
+	Files bool
+}
+
+// ConfigMapEntry is one key of a ConfigMap's data.
+type ConfigMapEntry struct {
+	Key   string
+	Value string
+}
+
+// ConfigMapData returns the data entries of a ConfigMap for doc, in
+// document order. With one entry per value, strings are unquoted,
+// integers are in decimal, and arrays are in TOML syntax. It fails with
+// ErrInvalidConfigMapKey if a key would contain characters other than
+// letters, digits, "-", "_", and ".", and with the error of Extract if a
+// selected table does not exist.
+func ConfigMapData(doc *Document, opts ConfigMapOptions) ([]ConfigMapEntry, error) {
+	docs, names := []*Document{doc}, []string{""}
+	if len(opts.Paths) > 0 {
+		docs, names = nil, nil
+		for _, p := range opts.Paths {
+			sub, err := doc.Extract(p)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, sub)
+			names = append(names, JoinPath(parseDottedPath(p)...))
+		}
+	}
+	var out []ConfigMapEntry
+	for i, d := range docs {
+		if opts.Files {
+			key := "config"
+			if names[i] != "" {
+				key = names[i]
+			}
+			out = append(out, ConfigMapEntry{Key: key + ".toml", Value: d.String()})
+			continue
+		}
+		out = configMapLeaves(out, names[i], d.logicalRoot())
+	}
+	for _, e := range out {
+		if !validConfigMapKey(e.Key) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidConfigMapKey, e.Key)
+		}
+	}
+	return out, nil
+}
+
+func configMapLeaves(out []ConfigMapEntry, path string, t *lnode) []ConfigMapEntry {
+	for _, name := range t.names {
+		n, p := t.fields[name], joinPath(path, name)
+		switch n.kind { //nolint:exhaustive
+		case TypeTable:
+			out = configMapLeaves(out, p, n)
+		case TypeArrayOfTables:
+			for i, e := range n.entries {
+				out = configMapLeaves(out, p+"."+strconv.Itoa(i), e)
+			}
+		case TypeArray:
+			out = append(out, ConfigMapEntry{Key: p, Value: n.kv.val.Text()})
+		default:
+			out = append(out, ConfigMapEntry{Key: p, Value: envValue(n.kv.val)})
+		}
+	}
+	return out
+}
+
+func validConfigMapKey(key string) bool {
+	if key == "" || len(key) > 253 {
+		return false
+	}
+	for _, r := range key {
+		if !isBareKeyChar(r) && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// ConfigMap renders a Kubernetes ConfigMap or Secret manifest holding the
+// entries of ConfigMapData, in their order, as YAML or JSON.
+func ConfigMap(doc *Document, opts ConfigMapOptions) ([]byte, error) {
+	data, err := ConfigMapData(doc, opts)
+	if err != nil {
+		return nil, err
+	}
+	kind := "ConfigMap"
+	if opts.Secret {
+		kind = "Secret"
+		for i := range data {
+			data[i].Value = base64.StdEncoding.EncodeToString([]byte(data[i].Value))
+		}
+	}
+	meta := []ConfigMapEntry{{"name", opts.Name}}
+	if opts.Namespace != "" {
+		meta = append(meta, ConfigMapEntry{"namespace", opts.Namespace})
+	}
+	top := []ConfigMapEntry{{"apiVersion", "v1"}, {"kind", kind}}
+	if opts.Secret {
+		top = append(top, ConfigMapEntry{"type", "Opaque"})
+	}
+	if opts.JSON {
+		return configMapJSON(top, meta, data), nil
+	}
+	return configMapYAML(top, meta, data), nil
+}
+
+func configMapYAML(top, meta, data []ConfigMapEntry) []byte {
+	var b bytes.Buffer
+	for _, e := range top {
+		b.WriteString(e.Key + ": " + e.Value + "\n")
+	}
+	b.WriteString("metadata:\n")
+	for _, e := range meta {
+		b.WriteString("  " + e.Key + ": " + yamlString(e.Value, "  ") + "\n")
+	}
+	if len(data) == 0 {
+		b.WriteString("data: {}\n")
+		return b.Bytes()
+	}
+	b.WriteString("data:\n")
+	for _, e := range data {
+		b.WriteString("  " + yamlKey(e.Key) + ": " + yamlString(e.Value, "    ") + "\n")
+	}
+	return b.Bytes()
+}
+
+// yamlKey returns key plain if YAML reads it back as the same string.
+func yamlKey(key string) string {
+	switch strings.ToLower(key) {
+	case "y", "n", "yes", "no", "on", "off", "true", "false", "null":
+		return strconv.Quote(key)
+	}
+	if c := key[0]; (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return key
+	}
+	return strconv.Quote(key)
+}
+
+// yamlString returns s as a literal block scalar indented by indent if it
+// spans several lines, and as a double-quoted string otherwise.
+func yamlString(s, indent string) string {
+	body, chomp := strings.CutSuffix(s, "\n")
+	if !strings.Contains(body, "\n") || strings.HasPrefix(body, " ") || strings.ContainsFunc(s, func(r rune) bool {
+		return r != '\n' && isControl(r)
+	}) {
+		return strconv.Quote(s)
+	}
+	header := "|-"
+	switch {
+	case strings.HasSuffix(body, "\n"):
+		header = "|+"
+	case chomp:
+		header = "|"
+	}
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return header + "\n" + strings.Join(lines, "\n")
+}
+
+func configMapJSON(top, meta, data []ConfigMapEntry) []byte {
+	var b bytes.Buffer
+	b.WriteString("{\n")
+	for _, e := range top {
+		b.WriteString("  " + jsonString(e.Key) + ": " + jsonString(e.Value) + ",\n")
+	}
+	b.WriteString(`  "metadata": {` + "\n")
+	writeJSONFields(&b, meta, "    ")
+	b.WriteString("  },\n  \"data\": {")
+	if len(data) > 0 {
+		b.WriteString("\n")
+		writeJSONFields(&b, data, "    ")
+		b.WriteString("  ")
+	}
+	b.WriteString("}\n}\n")
+	return b.Bytes()
+}
+
+func writeJSONFields(b *bytes.Buffer, fields []ConfigMapEntry, indent string) {
+	for i, e := range fields {
+		b.WriteString(indent + jsonString(e.Key) + ": " + jsonString(e.Value))
+		if i < len(fields)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+}
+
+// jsonString quotes s as a JSON string.
+func jsonString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteString(`\` + string(r))
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,116 @@
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Constraint is a rule about which keys a document sets or how its values
+// relate, beyond what the type of each value can express, such as a key
+// required only when another is set. It returns nil if doc satisfies it,
+// and otherwise the violations, preferably as ConstraintErrors made with
+// Document.Violation so that they carry a position; a rule reporting
+// several can join them with errors.Join. Any func(*Document) error is a
+// Constraint.
+type Constraint func(doc *Document) error
+
+// ConstraintError is a violation of a Constraint.
+type ConstraintError struct {
+	Path     string   // dotted path of the key concerned
+	Node     Node     // the key's definition, or the nearest table above it if it is missing
+	Position Position // where Node starts, or zero if there is no Node
+	Message  string
+	Err      error // ErrKeyNotFound, ErrKeyConflict, or ErrConstraint
+}
+
+// Error formats the violation as "line:column: message", leaving out the
+// position if it is unknown.
+func (e *ConstraintError) Error() string {
+	if e.Position.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Position.Line, e.Position.Column, e.Message)
+}
+
+// Unwrap returns Err.
+func (e *ConstraintError) Unwrap() error { return e.Err }
+
+// CheckConstraints evaluates the constraints against the document and
+// returns all their violations joined with errors.Join, or nil.
+func (d *Document) CheckConstraints(constraints ...Constraint) error {
+	var errs []error
+	for _, c := range constraints {
+		if err := c(d); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Violation returns a ConstraintError wrapping ErrConstraint for the key at
+// path, positioned at its definition, or at the nearest table above it if
+// it is not set. Custom constraints use it to report their violations.
+func (d *Document) Violation(path, format string, args ...any) *ConstraintError {
+	return d.violation(path, ErrConstraint, fmt.Sprintf(format, args...))
+}
+
+func (d *Document) violation(path string, err error, msg string) *ConstraintError {
+	e := &ConstraintError{Path: path, Message: msg, Err: err}
+	segs := parseDottedPath(path)
+	root := d.logicalRoot()
+	for i := len(segs); i > 0 && e.Node == nil; i-- {
+		if n := root.lookup(segs[:i]); n != nil {
+			e.Node = n.node()
+		}
+	}
+	if e.Node != nil {
+		e.Position, _ = d.Position(e.Node)
+	}
+	return e
+}
+
+// Require returns a constraint that the keys at paths, dotted paths as in
+// Has, are set.
+func Require(paths ...string) Constraint {
+	return func(doc *Document) error {
+		var errs []error
+		for _, path := range paths {
+			if !doc.Has(path) {
+				errs = append(errs, doc.violation(path, ErrKeyNotFound, "missing required key "+path))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// MutuallyExclusive returns a constraint that at most one of the keys at
+// paths is set. Each key set after the first is reported.
+func MutuallyExclusive(paths ...string) Constraint {
+	return func(doc *Document) error {
+		var set []string
+		var errs []error
+		for _, path := range paths {
+			if !doc.Has(path) {
+				continue
+			}
+			if len(set) > 0 {
+				msg := fmt.Sprintf("%s cannot be set with %s", path, strings.Join(set, ", "))
+				errs = append(errs, doc.violation(path, ErrKeyConflict, msg))
+			}
+			set = append(set, path)
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// Implies returns a constraint that if the key at path a is set, so is the
+// key at path b.
+func Implies(a, b string) Constraint {
+	return func(doc *Document) error {
+		if doc.Has(a) && !doc.Has(b) {
+			return doc.violation(a, ErrKeyNotFound, fmt.Sprintf("%s requires %s", a, b))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,52 @@
+package toml
+
+import "context"
+
+// ParseContext is like Parse but aborts with ctx.Err() once ctx is done.
+// The context is checked before each top-level key-value or table header
+// is parsed and again before each is validated.
+func ParseContext(ctx context.Context, b []byte) (*Document, error) {
+	doc := &Document{}
+	if err := parseInto(doc, b, parseRun{ctx: ctx}); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// ValidateContext is like Validate but aborts with ctx.Err() once ctx is
+// done. The context is checked before each top-level node is validated.
+func (d *Document) ValidateContext(ctx context.Context) error {
+	return validateDocument(ctx, d, d.String())
+}
+
+// WalkContext is like Walk but stops and returns ctx.Err() once ctx is
+// done. The context is checked before each node is visited.
+func (d *Document) WalkContext(ctx context.Context, visitor func(Node) bool) error {
+	var err error
+	var walk func(Node) bool
+	walk = func(n Node) bool {
+		if err = ctxErr(ctx); err != nil {
+			return false
+		}
+		if !visitor(n) {
+			return false
+		}
+		return eachChild(n, walk)
+	}
+	walk(d)
+	return err
+}
+
+// ctxErr returns ctx.Err() if ctx is done, without blocking. A nil ctx is
+// never done.
+func ctxErr(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
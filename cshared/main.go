@@ -0,0 +1,67 @@
+//go:build cgo
+
+// Command cshared builds the parser as a C shared library, so that
+// services in other languages can use this implementation through a
+// stable C ABI:
+//
+//	go build -buildmode=c-shared -o libtoml.so ./cshared
+//
+// This also writes libtoml.h. Every function takes NUL-terminated UTF-8
+// TOML source and returns a NUL-terminated UTF-8 JSON object that the
+// caller must release with toml_free:
+//
+//	char *toml_parse(char *src);    // {"values": [{"path", "type", "value", "line", "column"}], "errors": [...]}
+//	char *toml_validate(char *src); // {"valid": bool, "errors": [...]}
+//	char *toml_format(char *src);   // {"output": string, "errors": [...]}
+//	void toml_free(char *result);
+//	int toml_abi_version(void);
+//
+// toml_format puts one space on each side of every =, rewrites numbers in
+// the number-style lint rule's style, and collapses runs of blank lines,
+// keeping comments and indentation; if the source has errors, output is
+// the source unchanged.
+//
+// Each error is {"message", "hint", "line", "column"}, with 1-indexed
+// lines and character columns. toml_abi_version returns the version of
+// these JSON shapes, which changes only when a field is removed or changes
+// meaning; version 2 made toml_format a full formatter. The functions are
+// safe to call from several threads.
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/maurice/toml/internal/ffi"
+)
+
+func main() {}
+
+//export toml_parse
+func toml_parse(src *C.char) *C.char {
+	return C.CString(ffi.JSON(ffi.Parse(C.GoString(src))))
+}
+
+//export toml_validate
+func toml_validate(src *C.char) *C.char {
+	return C.CString(ffi.JSON(ffi.Validate(C.GoString(src))))
+}
+
+//export toml_format
+func toml_format(src *C.char) *C.char {
+	return C.CString(ffi.JSON(ffi.Format(C.GoString(src))))
+}
+
+//export toml_free
+func toml_free(result *C.char) {
+	C.free(unsafe.Pointer(result))
+}
+
+//export toml_abi_version
+func toml_abi_version() C.int {
+	return C.int(ffi.Version)
+}
@@ -0,0 +1,75 @@
+package toml
+
+import "slices"
+
+// TriviaMode says what happens to the comments and blank lines above a
+// deleted key-value or table header.
+type TriviaMode int
+
+const (
+	// TriviaRemove removes all of the leading trivia with the node.
+	TriviaRemove TriviaMode = iota
+
+	// TriviaKeepDetached removes the comments directly above the node, but
+	// keeps comments separated from it by a blank line, such as a section
+	// comment above a group of keys, and the blank lines themselves.
+	TriviaKeepDetached
+
+	// TriviaReattach keeps all of the leading trivia, in front of the node
+	// that followed the deleted one, or at the end of its table.
+	TriviaReattach
+)
+
+// DeleteOptions configures DeleteWithOptions and DeleteTableWithOptions.
+type DeleteOptions struct {
+	// LeadingTrivia says what happens to the comments and blank lines
+	// above the deleted node. The zero value, TriviaRemove, is what Delete
+	// and DeleteTable do. It has no effect inside inline tables.
+	LeadingTrivia TriviaMode
+}
+
+// DeleteWithOptions is Delete with control over the removed key-value's
+// leading trivia. Trivia that is kept is taken off the returned
+// key-value. Its trailing comment on the same line is always removed
+// with it.
+func (d *Document) DeleteWithOptions(path string, opts DeleteOptions) (*KeyValue, bool) {
+	kv := d.deleteTarget(path)
+	if kv == nil || !deleteWithTrivia(kv, opts.LeadingTrivia) {
+		return nil, false
+	}
+	return kv, true
+}
+
+// DeleteTableWithOptions is DeleteTable with control over the removed
+// table's leading trivia, as in DeleteWithOptions. The comments inside the
+// table are removed with its entries.
+func (d *Document) DeleteTableWithOptions(path string, opts DeleteOptions) (*TableNode, bool) {
+	segs := parseDottedPath(path)
+	for _, n := range d.nodes {
+		if t, ok := n.(*TableNode); ok && matchKeyParts(t.headerParts, segs) {
+			return t, deleteWithTrivia(t, opts.LeadingTrivia)
+		}
+	}
+	return nil, false
+}
+
+// deleteWithTrivia detaches n and keeps the part of its leading trivia
+// that mode says to keep, where n was.
+func deleteWithTrivia(n Node, mode TriviaMode) bool {
+	parent, lt := n.Parent(), leadingTriviaOf(n)
+	list := entriesOf(parent)
+	if list == nil || mode == TriviaRemove {
+		return detach(n)
+	}
+	keep := *lt
+	if mode == TriviaKeepDetached {
+		keep = detachedTrivia(*lt)
+	}
+	i := slices.Index(*list, n)
+	if !detach(n) {
+		return false
+	}
+	*lt = slices.Clone((*lt)[len(keep):])
+	keepTrivia(parent, list, i, slices.Clone(keep))
+	return true
+}
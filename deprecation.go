@@ -0,0 +1,74 @@
+package toml
+
+import "strings"
+
+// DeprecationInfo describes a key marked deprecated by a comment of the
+// form "# deprecated" or "# deprecated: use server.port".
+type DeprecationInfo struct {
+	Message     string // text after "deprecated:", if any
+	Replacement string // key named by a message of the form "use <key>", if any
+}
+
+// Deprecation returns the deprecation notice in kv's doc comment, as
+// returned by DocComment, or nil if there is none. The marker is matched
+// without regard to case at the start of any line of the comment. It may
+// be called on a nil *KeyValue.
+func (kv *KeyValue) Deprecation() *DeprecationInfo {
+	if kv == nil {
+		return nil
+	}
+	for line := range strings.SplitSeq(DocComment(kv), "\n") {
+		if info := parseDeprecation(strings.TrimSpace(line)); info != nil {
+			return info
+		}
+	}
+	return nil
+}
+
+func parseDeprecation(line string) *DeprecationInfo {
+	const marker = "deprecated"
+	if len(line) < len(marker) || !strings.EqualFold(line[:len(marker)], marker) {
+		return nil
+	}
+	rest := line[len(marker):]
+	switch {
+	case rest == "":
+		return &DeprecationInfo{}
+	case rest[0] != ':' && rest[0] != ' ' && rest[0] != '\t':
+		return nil // some other word, such as "deprecatedFoo"
+	}
+	info := &DeprecationInfo{Message: strings.TrimSpace(strings.TrimPrefix(rest, ":"))}
+	if fields := strings.Fields(info.Message); len(fields) >= 2 && strings.EqualFold(fields[0], "use") {
+		info.Replacement = strings.TrimRight(fields[1], ".,;")
+	}
+	return info
+}
+
+// DeprecatedKeys returns a lint rule named "deprecated" that reports every
+// key-value of the linted document that ref marks deprecated, found by
+// path. A nil ref uses the deprecation comments of the linted document
+// itself. Pass a reference file, such as a commented default
+// configuration, to check user files that carry no such comments.
+func DeprecatedKeys(ref *Document) LintRule {
+	return LintRule{
+		Name: "deprecated",
+		Check: func(doc *Document) []LintFinding {
+			var out []LintFinding
+			for path, kv := range doc.Leaves() {
+				marked := kv
+				if ref != nil {
+					marked = ref.Get(path)
+				}
+				info := marked.Deprecation()
+				switch {
+				case info == nil:
+				case info.Message != "":
+					out = append(out, findingAt(path, kv, "%s is deprecated: %s", path, info.Message))
+				default:
+					out = append(out, findingAt(path, kv, "%s is deprecated", path))
+				}
+			}
+			return out
+		},
+	}
+}
@@ -0,0 +1,152 @@
+package toml
+
+import "strconv"
+
+// ChangeKind classifies a Change.
+type ChangeKind int
+
+// Change kinds.
+const (
+	// ChangeAdded is a value present only in the new document.
+	ChangeAdded ChangeKind = iota
+	// ChangeRemoved is a value present only in the old document.
+	ChangeRemoved
+	// ChangeModified is a value present in both with different values.
+	ChangeModified
+)
+
+var changeKindNames = [...]string{
+	ChangeAdded:    "added",
+	ChangeRemoved:  "removed",
+	ChangeModified: "modified",
+}
+
+// String returns the kind's name.
+func (k ChangeKind) String() string {
+	if k >= 0 && int(k) < len(changeKindNames) {
+		return changeKindNames[k]
+	}
+	return "unknown"
+}
+
+// Change is one value that differs between two documents.
+type Change struct {
+	Kind ChangeKind
+
+	// Path is the value's location in the form accepted by Get, with [i]
+	// selecting array-of-tables entries, as in "servers[1].port".
+	Path string
+
+	// Old and New are the key-values holding the value in each document,
+	// nil for an added or removed value respectively. For a value inside
+	// an inline table they are the inline table's entry.
+	Old, New *KeyValue
+}
+
+// String returns the change as "path: kind".
+func (c Change) String() string {
+	return c.Path + ": " + c.Kind.String()
+}
+
+// Diff returns the values that differ between from and to, comparing the
+// documents as a decoder would see them: formatting, comments, the order
+// of keys, and whether a table is written as a header, dotted keys, or an
+// inline table make no difference, and values are compared as by
+// ValuesEqual. Arrays of tables are compared entry by entry, and equal an
+// array of inline tables with the same entries. Tables are compared by
+// their contents, so an empty table that appears or goes away is not a
+// change. Changes are in the order the keys appear, those of from first.
+func Diff(from, to *Document) []Change {
+	var changes []Change
+	diffTables("", from.logicalRoot(), to.logicalRoot(), &changes)
+	return changes
+}
+
+func diffTables(path string, a, b *lnode, out *[]Change) {
+	for _, name := range a.names {
+		p := joinPath(path, QuoteKey(name))
+		if cb := b.child(name); cb != nil {
+			diffNodes(p, a.child(name), cb, out)
+		} else {
+			diffLeaves(p, a.child(name), ChangeRemoved, out)
+		}
+	}
+	for _, name := range b.names {
+		if a.child(name) == nil {
+			diffLeaves(joinPath(path, QuoteKey(name)), b.child(name), ChangeAdded, out)
+		}
+	}
+}
+
+func diffNodes(path string, a, b *lnode, out *[]Change) {
+	ea, okA := tableEntries(a)
+	eb, okB := tableEntries(b)
+	switch {
+	case a.kind == TypeTable && b.kind == TypeTable:
+		diffTables(path, a, b, out)
+	case isLogicalValue(a) && isLogicalValue(b):
+		if !ValuesEqual(a.kv.val, b.kv.val) {
+			*out = append(*out, Change{Kind: ChangeModified, Path: path, Old: a.kv, New: b.kv})
+		}
+	case okA && okB:
+		for i := range max(len(ea), len(eb)) {
+			p := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(ea):
+				diffLeaves(p, eb[i], ChangeAdded, out)
+			case i >= len(eb):
+				diffLeaves(p, ea[i], ChangeRemoved, out)
+			default:
+				diffTables(p, ea[i], eb[i], out)
+			}
+		}
+	default:
+		diffLeaves(path, a, ChangeRemoved, out)
+		diffLeaves(path, b, ChangeAdded, out)
+	}
+}
+
+// tableEntries returns the entries of an array of tables, or of an array
+// of inline tables, which a decoder sees the same way.
+func tableEntries(n *lnode) ([]*lnode, bool) {
+	if n.kind == TypeArrayOfTables {
+		return n.entries, true
+	}
+	if n.kind != TypeArray {
+		return nil, false
+	}
+	arr, ok := n.kv.val.(*ArrayNode)
+	if !ok || !isArrayOfInlineTables(arr) {
+		return nil, false
+	}
+	entries := make([]*lnode, len(arr.elements))
+	for i, elem := range arr.elements {
+		entries[i] = newLTable()
+		addLogicalEntries(entries[i], inlineEntries(elem.(*InlineTableNode)))
+	}
+	return entries, true
+}
+
+// diffLeaves records every value under n as added or removed.
+func diffLeaves(path string, n *lnode, kind ChangeKind, out *[]Change) {
+	switch n.kind { //nolint:exhaustive
+	case TypeTable:
+		for _, name := range n.names {
+			diffLeaves(joinPath(path, QuoteKey(name)), n.child(name), kind, out)
+		}
+	case TypeArrayOfTables:
+		for i, e := range n.entries {
+			diffLeaves(path+"["+strconv.Itoa(i)+"]", e, kind, out)
+		}
+	default:
+		c := Change{Kind: kind, Path: path, Old: n.kv}
+		if kind == ChangeAdded {
+			c.Old, c.New = nil, n.kv
+		}
+		*out = append(*out, c)
+	}
+}
+
+func isLogicalValue(n *lnode) bool {
+	return n.kind != TypeTable && n.kind != TypeArrayOfTables
+}
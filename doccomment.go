@@ -0,0 +1,53 @@
+package toml
+
+import "strings"
+
+// DocComment returns the documentation attached to kv: the block of
+// comment lines directly above it and its same-line trailing comment, one
+// line each, with the leading "#" and a single following space removed.
+// A blank line ends the block, so a comment separated from the key by a
+// blank line is not part of its documentation.
+func DocComment(kv *KeyValue) string {
+	return docComment(kv.leading(), kv.trailing())
+}
+
+// SectionDocComment is DocComment for a table or array-of-tables header.
+// It returns "" for any other node.
+func SectionDocComment(n Node) string {
+	switch v := n.(type) {
+	case *TableNode:
+		return docComment(v.leading(), v.trailing())
+	case *ArrayOfTables:
+		return docComment(v.leading(), v.trailing())
+	}
+	return ""
+}
+
+func docComment(leading, trailing []Node) string {
+	var lines []string
+	afterNewline := true // leading trivia starts at the beginning of a line
+	for _, n := range leading {
+		switch {
+		case n.Type() == NodeComment:
+			lines = append(lines, commentBody(n.Text()))
+			afterNewline = false
+		case strings.HasSuffix(n.Text(), "\n"):
+			if afterNewline {
+				lines = nil // a blank line ends the block
+			}
+			afterNewline = true
+		}
+	}
+	for _, n := range trailing {
+		if n.Type() == NodeComment {
+			lines = append(lines, commentBody(n.Text()))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func commentBody(c string) string {
+	c = strings.TrimPrefix(c, "#")
+	c = strings.TrimPrefix(c, " ")
+	return strings.TrimRight(c, " \t\r")
+}
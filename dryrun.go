@@ -0,0 +1,58 @@
+package toml
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// CanSet reports whether setting the value at path, as
+// Resolve("").Set(path, val) does, would succeed. It returns the error Set
+// would return, without changing the document or val.
+func (d *Document) CanSet(path string, val Node) error {
+	segs := parseDottedPath(path)
+	if len(segs) == 0 {
+		return ErrEmptyKey
+	}
+	if err := validateValueType(val); err != nil {
+		return err
+	}
+	root := d.Resolve("")
+	cur, _, rest, err := root.setTarget(segs)
+	if err != nil {
+		return err
+	}
+	if c := cur.child(rest[0]); c != nil && len(rest) == 1 && c.kv.val == val {
+		return nil // setting a value to itself
+	}
+	return checkAttachable(val)
+}
+
+// CanDelete reports whether Delete(path) would remove a key-value. It
+// returns an error wrapping ErrKeyNotFound if it would not.
+func (d *Document) CanDelete(path string) error {
+	if d.deleteTarget(path) == nil {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, path)
+	}
+	return nil
+}
+
+// CanAppend reports whether Append(node) would succeed. It returns the
+// error Append would return, without changing the document or node.
+// Unlike Append inside WithBatch, it always validates the result.
+func (d *Document) CanAppend(node Node) error {
+	if err := validateDocumentNode(node); err != nil {
+		return err
+	}
+	if err := checkAttachable(node); err != nil {
+		return err
+	}
+	if err := checkSection(node); err != nil {
+		return err
+	}
+	if isTriviaNode(node) {
+		return nil
+	}
+	tmp := &Document{nodes: append(slices.Clip(d.nodes), node)}
+	return validateDocument(context.Background(), tmp, tmp.String())
+}
@@ -0,0 +1,304 @@
+package toml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EnvOptions configures ToEnv and FromEnv. The zero value gives the
+// defaults described on each field.
+type EnvOptions struct {
+	// Separator joins the prefix and the key segments of a name. Empty
+	// means "_". Keys that contain the separator cannot be read back
+	// unambiguously, so documents with keys such as max_conns should use
+	// "__".
+	Separator string
+
+	// ListSeparator joins the elements of an array of scalars into one
+	// value. Empty means ",".
+	ListSeparator string
+
+	// IndexArrays writes each array element as its own variable, named by
+	// the array's name and the element's index, instead of joining them.
+	// FromEnv reads arrays back only from indexed names.
+	IndexArrays bool
+}
+
+func (o *EnvOptions) setDefaults() {
+	if o.Separator == "" {
+		o.Separator = "_"
+	}
+	if o.ListSeparator == "" {
+		o.ListSeparator = ","
+	}
+}
+
+// ToEnv returns the document's values as environment variable
+// assignments, NAME=value, in document order. A name is the prefix, if
+// any, followed by the value's key segments, each upper-cased with every
+// character other than A-Z and 0-9 replaced by "_", all joined by
+// Separator: server.port with prefix "APP" is APP_SERVER_PORT.
+//
+// Strings are written unquoted, integers in decimal, floats without
+// underscores, and booleans and datetimes as written. Tables,
+// including inline tables, contribute their values under their name, and
+// the entries of arrays of tables under their name and index, as in
+// APP_SERVERS_0_HOST. Arrays of scalars are joined with ListSeparator,
+// or indexed like arrays of tables with IndexArrays; arrays holding
+// arrays or tables are always indexed. It fails with ErrDuplicateKey if
+// two values map to the same name.
+func (d *Document) ToEnv(prefix string, opts EnvOptions) ([]string, error) {
+	opts.setDefaults()
+	e := &envWriter{opts: opts, seen: make(map[string]string)}
+	var segs []string
+	if prefix != "" {
+		segs = []string{prefix}
+	}
+	if err := e.table(segs, nil, d.logicalRoot()); err != nil {
+		return nil, err
+	}
+	return e.out, nil
+}
+
+// envWriter collects the assignments of ToEnv.
+type envWriter struct {
+	opts EnvOptions
+	out  []string
+	seen map[string]string // name to the path that produced it
+}
+
+func (e *envWriter) table(name, path []string, t *lnode) error {
+	for _, key := range t.names {
+		n := t.fields[key]
+		childName := append(append([]string(nil), name...), envSegment(key))
+		childPath := append(append([]string(nil), path...), key)
+		var err error
+		switch n.kind { //nolint:exhaustive
+		case TypeTable:
+			err = e.table(childName, childPath, n)
+		case TypeArrayOfTables:
+			for i, entry := range n.entries {
+				idx := strconv.Itoa(i)
+				if err = e.table(append(childName, idx), append(childPath, idx), entry); err != nil {
+					break
+				}
+			}
+		default:
+			err = e.value(childName, childPath, n.kv.val)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *envWriter) value(name, path []string, val Node) error {
+	switch v := val.(type) {
+	case *InlineTableNode:
+		t := newLTable()
+		addLogicalEntries(t, inlineEntries(v))
+		return e.table(name, path, t)
+	case *ArrayNode:
+		if !e.opts.IndexArrays && scalarArray(v) {
+			parts := make([]string, len(v.elements))
+			for i, elem := range v.elements {
+				parts[i] = envValue(elem)
+			}
+			return e.add(name, path, strings.Join(parts, e.opts.ListSeparator))
+		}
+		for i, elem := range v.elements {
+			idx := strconv.Itoa(i)
+			if err := e.value(append(name, idx), append(path, idx), elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return e.add(name, path, envValue(val))
+}
+
+func (e *envWriter) add(name, path []string, value string) error {
+	key := strings.Join(name, e.opts.Separator)
+	p := JoinPath(path...)
+	if prev, ok := e.seen[key]; ok {
+		return fmt.Errorf("%w: %s and %s are both %s", ErrDuplicateKey, prev, p, key)
+	}
+	e.seen[key] = p
+	e.out = append(e.out, key+"="+value)
+	return nil
+}
+
+// envSegment returns a key segment as it appears in a variable name.
+func envSegment(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+func scalarArray(a *ArrayNode) bool {
+	for _, elem := range a.elements {
+		switch elem.(type) {
+		case *ArrayNode, *InlineTableNode:
+			return false
+		}
+	}
+	return true
+}
+
+// envValue returns a scalar as it is written in a variable.
+func envValue(val Node) string {
+	switch v := val.(type) {
+	case *StringNode:
+		return v.Value()
+	case *NumberNode:
+		if i, err := v.Int(); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+		return strings.ReplaceAll(v.text, "_", "")
+	}
+	return val.Text()
+}
+
+// FromEnv builds a document from environment variable assignments, such
+// as those of os.Environ, reversing ToEnv. Only names that start with the
+// prefix and Separator are used, or every name if prefix is empty. The
+// rest of each name is split at Separator into lower-cased key segments;
+// segments of digits index arrays, so APP_SERVERS_0_HOST and
+// APP_SERVERS_1_HOST make an array of tables. A value that is a valid
+// TOML integer, float, boolean, or datetime is read as one, and any
+// other value as a string. Joined arrays are not split, so write them
+// with IndexArrays to read them back.
+//
+// Keys appear in the order of their first variable, grouped under table
+// headers. It fails with ErrDuplicateKey if a name is both a value and
+// the start of a longer name.
+func FromEnv(env []string, prefix string, opts EnvOptions) (*Document, error) {
+	opts.setDefaults()
+	root := &envTree{}
+	for _, kv := range env {
+		full, value, ok := strings.Cut(kv, "=")
+		name, found := strings.CutPrefix(full, prefix+opts.Separator)
+		if prefix == "" {
+			name, found = full, true
+		}
+		if !ok || !found || name == "" {
+			continue
+		}
+		segs := strings.Split(strings.ToLower(name), opts.Separator)
+		if err := root.set(segs, envLiteral(value)); err != nil {
+			return nil, fmt.Errorf("%w: %s", err, full)
+		}
+	}
+	var b strings.Builder
+	root.writeFlat(&b, nil)
+	return reparse(b.String()).Unflatten(0), nil
+}
+
+// envTree is the tree of names read by FromEnv.
+type envTree struct {
+	value  string // TOML text of a value, empty for a table
+	names  []string
+	fields map[string]*envTree
+}
+
+func (t *envTree) set(segs []string, value string) error {
+	for _, s := range segs {
+		if t.value != "" {
+			return ErrDuplicateKey
+		}
+		c := t.fields[s]
+		if c == nil {
+			if t.fields == nil {
+				t.fields = make(map[string]*envTree)
+			}
+			c = &envTree{}
+			t.fields[s] = c
+			t.names = append(t.names, s)
+		}
+		t = c
+	}
+	if t.value != "" || len(t.names) > 0 {
+		return ErrDuplicateKey
+	}
+	t.value = value
+	return nil
+}
+
+// isArray reports whether the children of t are named 0 to n-1.
+func (t *envTree) isArray() bool {
+	for i := range t.names {
+		if t.fields[strconv.Itoa(i)] == nil {
+			return false
+		}
+	}
+	return len(t.names) > 0
+}
+
+// writeFlat writes the tree as top-level dotted keys, for Unflatten to
+// group under headers.
+func (t *envTree) writeFlat(b *strings.Builder, path []string) {
+	for _, name := range t.names {
+		c := t.fields[name]
+		p := append(append([]string(nil), path...), name)
+		if c.value == "" && !c.isArray() {
+			c.writeFlat(b, p)
+			continue
+		}
+		b.WriteString(JoinPath(p...) + " = ")
+		c.writeValue(b)
+		b.WriteString("\n")
+	}
+}
+
+// writeValue writes t as a TOML value.
+func (t *envTree) writeValue(b *strings.Builder) {
+	open, closing := "{ ", " }"
+	if t.isArray() {
+		open, closing = "[", "]"
+	}
+	switch {
+	case t.value != "":
+		b.WriteString(t.value)
+		return
+	case len(t.names) == 0:
+		b.WriteString("{}")
+		return
+	}
+	b.WriteString(open)
+	for i := range t.names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		name := t.names[i]
+		if t.isArray() {
+			name = strconv.Itoa(i)
+		} else {
+			b.WriteString(QuoteKey(name) + " = ")
+		}
+		t.fields[name].writeValue(b)
+	}
+	b.WriteString(closing)
+}
+
+// envLiteral returns the TOML text for a variable's value: the value
+// itself if it is an integer, float, boolean, or datetime, and otherwise
+// a string.
+func envLiteral(value string) string {
+	if value != "" && !strings.ContainsAny(value, "\r\n#") {
+		if kv, ok := parseCommentedKeyValue("v = " + value); ok {
+			switch kv.val.(type) {
+			case *NumberNode, *BooleanNode, *DateTimeNode:
+				return value
+			}
+		}
+	}
+	return NewString(value).Text()
+}
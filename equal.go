@@ -0,0 +1,117 @@
+package toml
+
+import "math"
+
+// SetValueIfChanged replaces the value like SetValue, unless val holds the
+// same TOML value as the current one, in which case the original text is
+// kept and val is not attached. It reports whether the value was replaced.
+// For example, setting NewInteger(16) on "x = 0x10" keeps "0x10".
+func (kv *KeyValue) SetValueIfChanged(val Node) (bool, error) {
+	if err := validateValueType(val); err != nil {
+		return false, err
+	}
+	if kv.val != nil && ValuesEqual(kv.val, val) {
+		return false, nil
+	}
+	if err := kv.SetValue(val); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ValuesEqual reports whether a and b hold the same TOML value, however
+// they are written: 0x10 equals 16, 'a' equals "a", 1.50 equals 1.5, and
+// inline tables are equal if they define the same keys with equal values,
+// in any order. Values of different TOML types are never equal, so 1 does
+// not equal 1.0. Two nan values are equal. Extension nodes are equal if
+// their text is.
+func ValuesEqual(a, b Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if valueTypeOf(a) != valueTypeOf(b) {
+		return false
+	}
+	switch x := a.(type) {
+	case *StringNode:
+		return x.Value() == b.(*StringNode).Value()
+	case *NumberNode:
+		return numbersEqual(x, b.(*NumberNode))
+	case *BooleanNode:
+		return x.Value() == b.(*BooleanNode).Value()
+	case *DateTimeNode:
+		return dateTimesEqual(x, b.(*DateTimeNode))
+	case *ArrayNode:
+		y := b.(*ArrayNode)
+		if len(x.elements) != len(y.elements) {
+			return false
+		}
+		for i := range x.elements {
+			if !ValuesEqual(x.elements[i], y.elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *InlineTableNode:
+		return inlineTablesEqual(x, b.(*InlineTableNode))
+	}
+	return a.Text() == b.Text()
+}
+
+func numbersEqual(a, b *NumberNode) bool {
+	da, errA := a.Decimal()
+	db, errB := b.Decimal()
+	if errA == nil && errB == nil {
+		return da.Rat().Cmp(db.Rat()) == 0
+	}
+	fa, errA := a.Float()
+	fb, errB := b.Float()
+	if errA != nil || errB != nil {
+		return a.text == b.text
+	}
+	return fa == fb || (math.IsNaN(fa) && math.IsNaN(fb))
+}
+
+func dateTimesEqual(a, b *DateTimeNode) bool {
+	fa, errA := parseDateTimeFields(a.text)
+	fb, errB := parseDateTimeFields(b.text)
+	if errA != nil || errB != nil {
+		return a.text == b.text
+	}
+	if a.Kind() != b.Kind() || (fa.offset == nil) != (fb.offset == nil) || (fa.offset != nil && *fa.offset != *fb.offset) {
+		return false
+	}
+	return fa.year == fb.year && fa.month == fb.month && fa.day == fb.day &&
+		fa.hour == fb.hour && fa.minute == fb.minute && fa.second == fb.second && fa.nanos == fb.nanos
+}
+
+func inlineTablesEqual(a, b *InlineTableNode) bool {
+	la, lb := inlineLeaves(a, "", nil), inlineLeaves(b, "", nil)
+	if len(la) != len(lb) {
+		return false
+	}
+	for path, va := range la {
+		vb, ok := lb[path]
+		if !ok || !ValuesEqual(va, vb) {
+			return false
+		}
+	}
+	return true
+}
+
+// inlineLeaves maps the path key of every non-table value in an inline
+// table, so that a.b = 1 and a = { b = 1 } compare equal.
+func inlineLeaves(it *InlineTableNode, prefix string, out map[string]Node) map[string]Node {
+	if out == nil {
+		out = make(map[string]Node)
+	}
+	for _, kv := range it.entries {
+		path := prefix + pathKey(kv.keyParts)
+		if sub, ok := kv.val.(*InlineTableNode); ok && len(sub.entries) > 0 {
+			inlineLeaves(sub, path, out)
+			continue
+		}
+		out[path] = kv.val
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package toml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrorRenderOptions controls how ParseError.Render formats an error.
+type ErrorRenderOptions struct {
+	// ContextLines is the number of source lines shown before and after
+	// the line in error.
+	ContextLines int
+	// Color adds ANSI escape sequences for terminals.
+	Color bool
+	// Compact renders the error on a single line, for logs.
+	Compact bool
+	// NoSource omits the source excerpt.
+	NoSource bool
+}
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[1;31m"
+	ansiBlue  = "\x1b[34m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// Render formats the error according to o. Error() is Render with the
+// zero options.
+func (e *ParseError) Render(o ErrorRenderOptions) string {
+	paint := func(code, s string) string {
+		if !o.Color {
+			return s
+		}
+		return code + s + ansiReset
+	}
+	lines := strings.Split(e.Source, "\n")
+	inRange := e.Line >= 1 && e.Line <= len(lines)
+
+	var buf strings.Builder
+	buf.WriteString(paint(ansiRed, "parse error"))
+	switch {
+	case inRange:
+		fmt.Fprintf(&buf, " at line %d, column %d: ", e.Line, e.Column)
+	case e.Line >= 1:
+		fmt.Fprintf(&buf, " at line %d: ", e.Line)
+	case e.Token != "":
+		// A node built in code and not yet in a document has no line.
+		fmt.Fprintf(&buf, " at %s: ", e.Token)
+	default:
+		buf.WriteString(": ")
+	}
+	buf.WriteString(paint(ansiBold, e.Summary()))
+	if o.Compact {
+		if e.Hint != "" {
+			buf.WriteString(" (hint: " + e.Hint + ")")
+		}
+		return buf.String()
+	}
+	if !inRange {
+		return buf.String()
+	}
+	buf.WriteByte('\n')
+	if !o.NoSource {
+		e.renderExcerpt(&buf, lines, o.ContextLines, paint)
+	}
+	if e.Hint != "" {
+		fmt.Fprintf(&buf, "    = %s %s\n", paint(ansiCyan, "hint:"), e.Hint)
+	}
+	return buf.String()
+}
+
+// renderExcerpt writes the source lines around the error with a caret
+// under the error column.
+func (e *ParseError) renderExcerpt(buf *strings.Builder, lines []string, around int, paint func(code, s string) string) {
+	first := max(1, e.Line-around)
+	last := min(len(lines), e.Line+around)
+	width := len(strconv.Itoa(last))
+	for n := first; n <= last; n++ {
+		line := strings.TrimSuffix(lines[n-1], "\r")
+		fmt.Fprintf(buf, "  %s %s\n", paint(ansiBlue, fmt.Sprintf("%*d |", width, n)), line)
+		if n == e.Line {
+			fmt.Fprintf(buf, "  %s %s%s\n", paint(ansiBlue, strings.Repeat(" ", width)+" |"),
+				caretPadding(line, e.Column), paint(ansiRed, "^"))
+		}
+	}
+}
+
+// caretPadding returns the whitespace that places a caret under the byte
+// column col of line. Each rune takes one cell, and tabs are copied so
+// they expand the same way as in the line above.
+func caretPadding(line string, col int) string {
+	prefix := line[:max(0, min(col-1, len(line)))]
+	var b strings.Builder
+	for len(prefix) > 0 {
+		r, size := utf8.DecodeRuneInString(prefix)
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+		prefix = prefix[size:]
+	}
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package toml_test
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/maurice/toml"
@@ -175,6 +176,19 @@ func ExampleNumberNode_Int() {
 	// 1000
 }
 
+func ExampleNumberNode_Decimal() {
+	doc, _ := toml.Parse([]byte("rate = 0.10\n"))
+	d, err := doc.Get("rate").Val().(*toml.NumberNode).Decimal()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(d.Coefficient, d.Exponent)
+	fmt.Println(d)
+	// Output:
+	// 10 -2
+	// 0.10
+}
+
 func ExampleNewKeyValue() {
 	kv, err := toml.NewKeyValue("name", toml.NewString("Alice"))
 	if err != nil {
@@ -219,3 +233,37 @@ func ExampleNewString() {
 	// "hello world"
 	// hello world
 }
+
+// placeholder stands for a value filled in by a template engine.
+type placeholder struct {
+	name   string
+	parent toml.Node
+}
+
+var nodePlaceholder = toml.RegisterNodeType("Placeholder")
+
+func (p *placeholder) Type() toml.NodeType       { return nodePlaceholder }
+func (p *placeholder) Parent() toml.Node         { return p.parent }
+func (p *placeholder) SetParent(n toml.Node)     { p.parent = n }
+func (p *placeholder) Children() []toml.Node     { return nil }
+func (p *placeholder) Text() string              { return "{{ " + p.name + " }}" }
+func (p *placeholder) ValueType() toml.ValueType { return toml.TypeAny }
+func (p *placeholder) Validate() error {
+	if p.name == "" {
+		return errors.New("empty placeholder")
+	}
+	return nil
+}
+
+func ExampleExtension() {
+	doc, _ := toml.Parse([]byte("[db]\nhost = \"localhost\"\n"))
+	doc.Get("db.host").SetValue(&placeholder{name: "DB_HOST"})
+	fmt.Print(doc.String())
+	fmt.Println(doc.Get("db.host").Val().Type())
+	fmt.Println(doc.Validate() == nil)
+	// Output:
+	// [db]
+	// host = {{ DB_HOST }}
+	// Placeholder
+	// true
+}
@@ -0,0 +1,48 @@
+//go:build js && wasm
+
+// Command wasm exposes the parser to JavaScript, for embedding a TOML
+// validator that uses this exact implementation in a web page. Build it
+// with
+//
+//	GOOS=js GOARCH=wasm go build -o toml.wasm ./examples/wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// and load it as index.html does. It sets three global functions, each
+// taking TOML source text and returning the same objects as the C shared
+// library in cshared:
+//
+//	tomlParse(src)    {values: [{path, type, value, line, column}], errors}
+//	tomlValidate(src) {valid, errors}
+//	tomlFormat(src)   {output, errors}
+//
+// Each error is {message, hint, line, column}. tomlFormat is the
+// formatter of the language server: one space on each side of every =,
+// numbers in the style of the number-style lint rule, and runs of blank
+// lines collapsed, with comments and indentation kept.
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/maurice/toml/internal/ffi"
+)
+
+func main() {
+	export("tomlParse", func(src string) any { return ffi.Parse(src) })
+	export("tomlValidate", func(src string) any { return ffi.Validate(src) })
+	export("tomlFormat", func(src string) any { return ffi.Format(src) })
+	select {}
+}
+
+// export sets a global function that calls fn with its first argument and
+// returns the result as a JavaScript object.
+func export(name string, fn func(src string) any) {
+	parseJSON := js.Global().Get("JSON").Get("parse")
+	js.Global().Set(name, js.FuncOf(func(_ js.Value, args []js.Value) any {
+		src := ""
+		if len(args) > 0 && args[0].Type() == js.TypeString {
+			src = args[0].String()
+		}
+		return parseJSON.Invoke(ffi.JSON(fn(src)))
+	}))
+}
@@ -0,0 +1,89 @@
+package toml
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Extension is implemented by value nodes defined outside this package,
+// such as a placeholder for a template engine. An extension node can be
+// used anywhere a value is accepted: as the value of a key-value, as an
+// array element, or inside an inline table. Its Text is what String and
+// Walk see.
+type Extension interface {
+	Node
+
+	// SetParent records the node's parent. It is called with nil when the
+	// node is removed from the tree.
+	SetParent(Node)
+
+	// ValueType reports the TOML type the node stands for, or TypeAny if
+	// it is not known until the document is rendered.
+	ValueType() ValueType
+
+	// Validate reports whether the node is well-formed. Document.Validate
+	// returns its error as a ParseError at the key that holds the node.
+	Validate() error
+}
+
+var nodeTypes = struct {
+	sync.Mutex
+	names []string
+}{names: []string{
+	NodeDocument:      "Document",
+	NodeKeyValue:      "KeyValue",
+	NodeTable:         "Table",
+	NodeArrayOfTables: "ArrayOfTables",
+	NodeArray:         "Array",
+	NodeInlineTable:   "InlineTable",
+	NodeIdentifier:    "Identifier",
+	NodeString:        "String",
+	NodeNumber:        "Number",
+	NodeBoolean:       "Boolean",
+	NodeDateTime:      "DateTime",
+	NodePunctuation:   "Punctuation",
+	NodeComment:       "Comment",
+	NodeWhitespace:    "Whitespace",
+}}
+
+// RegisterNodeType allocates a NodeType for an Extension implementation.
+// Each call returns a new value, so it is normally called once per type
+// from a package-level variable declaration.
+func RegisterNodeType(name string) NodeType {
+	nodeTypes.Lock()
+	defer nodeTypes.Unlock()
+	nodeTypes.names = append(nodeTypes.names, name)
+	return NodeType(len(nodeTypes.names) - 1)
+}
+
+// String returns the node type's name.
+func (t NodeType) String() string {
+	nodeTypes.Lock()
+	defer nodeTypes.Unlock()
+	if t < 0 || int(t) >= len(nodeTypes.names) {
+		return fmt.Sprintf("NodeType(%d)", int(t))
+	}
+	return nodeTypes.names[t]
+}
+
+// checkExtensions returns the first error reported by an extension node in
+// the value tree rooted at val.
+func checkExtensions(val Node) error {
+	switch v := val.(type) {
+	case Extension:
+		return v.Validate()
+	case *ArrayNode:
+		for _, elem := range v.elements {
+			if err := checkExtensions(elem); err != nil {
+				return err
+			}
+		}
+	case *InlineTableNode:
+		for _, kv := range v.entries {
+			if err := checkExtensions(kv.val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
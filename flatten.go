@@ -0,0 +1,295 @@
+package toml
+
+import "strings"
+
+// Flatten returns an equivalent document that has no table headers: every
+// value is a top-level key-value with its full dotted key, as in
+// server.tls.cert = "a.pem". Inline tables are flattened the same way.
+// Comments above keys and at the end of their lines move with them, and
+// comments above a header, or after it, go before its first key. Arrays of
+// tables become arrays of inline tables, which lose the comments between
+// their entries, and a table with no keys becomes {}. The document is not
+// changed. New lines end like the document's first line.
+func (d *Document) Flatten() *Document {
+	f := &flattener{root: d.logicalRoot(), arrays: make(map[string]bool), nl: firstLineBreak(d.String())}
+	serializeTrivia(&f.b, d.prologue)
+	for _, n := range d.nodes {
+		switch v := n.(type) {
+		case *KeyValue:
+			f.keyValue(nil, v, v.leading(), v.trailing(), v.newline)
+		case *TableNode:
+			f.table(v)
+		case *ArrayOfTables:
+			f.arrayOfTables(v)
+		default:
+			serializeNode(&f.b, n)
+		}
+	}
+	if len(d.epilogue) > 0 {
+		endLineWith(&f.b, f.nl)
+		serializeTrivia(&f.b, d.epilogue)
+	}
+	return reparse(f.b.String())
+}
+
+// flattener collects the text of a flattened document.
+type flattener struct {
+	root   *lnode
+	arrays map[string]bool // arrays of tables already written
+	nl     string          // line break for new lines
+	b      strings.Builder
+}
+
+// keyValue writes kv, in the section at prefix, with the given trivia in
+// place of its own. Inline tables are written one key per line, the first
+// taking the leading trivia and the last the trailing trivia.
+func (f *flattener) keyValue(prefix []KeyPart, kv *KeyValue, leading, trailing []Node, newline string) {
+	parts, raw := rebaseParts(kv.keyParts, 0, prefix)
+	if it, ok := kv.val.(*InlineTableNode); ok && len(it.entries) > 0 {
+		for i, e := range it.entries {
+			var lead, trail []Node
+			nl := f.nl
+			if i == 0 {
+				lead = leading
+			}
+			if i == len(it.entries)-1 {
+				trail, nl = trailing, newline
+			}
+			f.keyValue(parts, e, lead, trail, nl)
+		}
+		return
+	}
+	c := *kv
+	c.keyParts, c.rawKey = parts, raw
+	c.lineTrivia, c.newline = newLineTrivia(leading, trailing), newline
+	endLineWith(&f.b, f.nl)
+	serializeKeyValue(&f.b, &c)
+}
+
+func (f *flattener) table(t *TableNode) {
+	segs := partsToSegs(t.headerParts)
+	if f.inArray(segs) {
+		return
+	}
+	f.headerTrivia(t.leading(), t.trailing())
+	if n := f.root.lookup(segs); n != nil && len(n.names) == 0 {
+		_, raw := rebaseParts(t.headerParts, 0, nil)
+		f.b.WriteString(raw + " = {}" + f.nl)
+	}
+	for _, e := range t.entries {
+		if kv, ok := e.(*KeyValue); ok {
+			f.keyValue(t.headerParts, kv, kv.leading(), kv.trailing(), kv.newline)
+		} else {
+			serializeNode(&f.b, e)
+		}
+	}
+	serializeTrivia(&f.b, t.bodyTrivia)
+}
+
+// arrayOfTables writes the whole array of tables, with all its entries,
+// when its first entry is reached.
+func (f *flattener) arrayOfTables(a *ArrayOfTables) {
+	segs := partsToSegs(a.headerParts)
+	if f.inArray(segs) {
+		return
+	}
+	f.arrays[JoinPath(segs...)] = true
+	f.headerTrivia(a.leading(), a.trailing())
+	_, raw := rebaseParts(a.headerParts, 0, nil)
+	f.b.WriteString(raw + " = [" + f.nl)
+	for _, e := range f.root.lookup(segs).entries {
+		f.b.WriteString("  ")
+		writeInlineTable(&f.b, e)
+		f.b.WriteString("," + f.nl)
+	}
+	f.b.WriteString("]" + f.nl)
+}
+
+// inArray reports whether segs is or lies within an array of tables that
+// has been written.
+func (f *flattener) inArray(segs []string) bool {
+	for i := range segs {
+		if f.arrays[JoinPath(segs[:i+1]...)] {
+			return true
+		}
+	}
+	return false
+}
+
+// headerTrivia writes the comments above and after a header, the latter
+// on a line of its own.
+func (f *flattener) headerTrivia(leading, trailing []Node) {
+	endLineWith(&f.b, f.nl)
+	serializeTrivia(&f.b, leading)
+	for _, n := range trailing {
+		if n.Type() == NodeComment {
+			f.b.WriteString(n.Text() + f.nl)
+		}
+	}
+}
+
+// writeInlineTable writes the logical table t as an inline table.
+func writeInlineTable(b *strings.Builder, t *lnode) {
+	if len(t.names) == 0 {
+		b.WriteString("{}")
+		return
+	}
+	b.WriteString("{ ")
+	for i, name := range t.names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(QuoteKey(name) + " = ")
+		switch n := t.fields[name]; n.kind { //nolint:exhaustive
+		case TypeTable:
+			writeInlineTable(b, n)
+		case TypeArrayOfTables:
+			b.WriteString("[")
+			for j, e := range n.entries {
+				if j > 0 {
+					b.WriteString(", ")
+				}
+				writeInlineTable(b, e)
+			}
+			b.WriteString("]")
+		default:
+			b.WriteString(n.kv.val.Text())
+		}
+	}
+	b.WriteString(" }")
+}
+
+// Unflatten returns an equivalent document that groups dotted keys under
+// table headers, the reverse of Flatten: a.b.c = 1 becomes c = 1 under
+// [a.b]. Headers have at most maxDepth keys, so with a maxDepth of 1 the
+// same key becomes b.c = 1 under [a]; a maxDepth below 1 means no limit.
+// Arrays of inline tables become arrays of tables where the depth allows.
+// Keys without a dot stay at the top of the document, and tables appear in
+// the order their first key does. Comments move with their keys. The
+// document is not changed. New lines end like the document's first line.
+func (d *Document) Unflatten(maxDepth int) *Document {
+	u := &unflattener{maxDepth: maxDepth, nl: firstLineBreak(d.String()), sections: make(map[string]*unflatSection)}
+	flat := d.Flatten()
+	serializeTrivia(&u.root.body, flat.prologue)
+	for _, n := range flat.nodes {
+		if kv, ok := n.(*KeyValue); ok {
+			u.keyValue(kv)
+		} else {
+			serializeNode(&u.root.body, n)
+		}
+	}
+	out := u.root.body.String()
+	for _, key := range u.order {
+		if out != "" {
+			out = strings.TrimRight(out, "\r\n") + u.nl + u.nl
+		}
+		out += u.sections[key].header + u.sections[key].body.String()
+	}
+	if len(flat.epilogue) > 0 {
+		var b strings.Builder
+		b.WriteString(out)
+		endLineWith(&b, u.nl)
+		serializeTrivia(&b, flat.epilogue)
+		out = b.String()
+	}
+	return reparse(out)
+}
+
+// unflattener collects the text of an unflattened document: the keys that
+// stay at the top, and one section per table or array of tables.
+type unflattener struct {
+	maxDepth int
+	nl       string // line break for new lines
+	root     unflatSection
+	order    []string
+	sections map[string]*unflatSection
+}
+
+type unflatSection struct {
+	header string // "[table]" and a line break, or empty for the root and arrays of tables
+	body   strings.Builder
+}
+
+// writeTrivia writes the comments above a key, without the blank lines
+// that would start a section.
+func (s *unflatSection) writeTrivia(trivia []Node) {
+	if s.body.Len() == 0 {
+		for len(trivia) > 0 && isNewlineNode(trivia[0]) {
+			trivia = trivia[1:]
+		}
+	}
+	serializeTrivia(&s.body, trivia)
+}
+
+func (u *unflattener) keyValue(kv *KeyValue) {
+	depth := len(kv.keyParts) - 1
+	if u.maxDepth > 0 {
+		depth = min(depth, u.maxDepth)
+	}
+	if arr, ok := kv.val.(*ArrayNode); ok && isArrayOfInlineTables(arr) && (u.maxDepth < 1 || len(kv.keyParts) <= u.maxDepth) {
+		u.arrayOfTables(kv, arr)
+		return
+	}
+	s := &u.root
+	if depth > 0 {
+		_, header := rebaseParts(kv.keyParts[:depth], 0, nil)
+		s = u.section(JoinPath(partsToSegs(kv.keyParts[:depth])...), "["+header+"]"+u.nl)
+	}
+	c := *kv
+	c.keyParts, c.rawKey = rebaseParts(kv.keyParts, depth, nil)
+	c.lineTrivia = newLineTrivia(nil, kv.trailing())
+	endLineWith(&s.body, u.nl)
+	s.writeTrivia(kv.leading())
+	serializeKeyValue(&s.body, &c)
+}
+
+// section returns the section with the given key, creating it if it is
+// new.
+func (u *unflattener) section(key, header string) *unflatSection {
+	s, ok := u.sections[key]
+	if !ok {
+		s = &unflatSection{header: header}
+		u.sections[key] = s
+		u.order = append(u.order, key)
+	}
+	return s
+}
+
+// arrayOfTables writes an array of inline tables as an array of tables,
+// one header per element.
+func (u *unflattener) arrayOfTables(kv *KeyValue, arr *ArrayNode) {
+	_, header := rebaseParts(kv.keyParts, 0, nil)
+	s := u.section("[["+JoinPath(partsToSegs(kv.keyParts)...)+"]]", "")
+	s.writeTrivia(kv.leading())
+	for i, elem := range arr.elements {
+		if i > 0 {
+			s.body.WriteString(u.nl)
+		}
+		s.body.WriteString("[[" + header + "]]" + u.nl)
+		for _, e := range elem.(*InlineTableNode).entries {
+			s.body.WriteString(e.Text() + u.nl)
+		}
+	}
+}
+
+func isArrayOfInlineTables(arr *ArrayNode) bool {
+	if len(arr.elements) == 0 {
+		return false
+	}
+	for _, e := range arr.elements {
+		if _, ok := e.(*InlineTableNode); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// reparse parses the text of a derived document, accepting templates so
+// that a document parsed with them can be flattened.
+func reparse(text string) *Document {
+	doc, err := ParseWithOptions([]byte(text), ParseOptions{Templates: true})
+	if err != nil {
+		return &Document{} // unreachable: the text is rebuilt from a valid document
+	}
+	return doc
+}
@@ -0,0 +1,136 @@
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// DocsOptions configures GenerateDocs.
+type DocsOptions struct {
+	// Title, if set, is written as a level 1 heading at the top.
+	Title string
+
+	// HeadingLevel is the Markdown heading level of each table's section,
+	// from 1 to 6. Zero means 2.
+	HeadingLevel int
+}
+
+// GenerateDocs renders a Markdown reference of the keys in doc, typically
+// an annotated example configuration. Keys are grouped by table in the
+// order the tables first appear, top-level keys first; each table's doc
+// comment introduces its section. Every key is listed once per table with
+// its type, its value in doc as the default, and its doc comment as the
+// description. Keys of an array of tables are merged across its entries.
+func GenerateDocs(doc *Document, opts DocsOptions) []byte {
+	level := opts.HeadingLevel
+	if level < 1 || level > 6 {
+		level = 2
+	}
+	g := docsGen{index: make(map[string]*docsGroup)}
+	root := g.group("", "Top-level keys", "")
+	for _, n := range doc.nodes {
+		switch v := n.(type) {
+		case *KeyValue:
+			root.add(v)
+		case *TableNode:
+			g.group("["+formatKeyPath(v.headerParts)+"]", "", SectionDocComment(v)).addAll(v.entries)
+		case *ArrayOfTables:
+			g.group("[["+formatKeyPath(v.headerParts)+"]]", "", SectionDocComment(v)).addAll(v.entries)
+		}
+	}
+	var b bytes.Buffer
+	if opts.Title != "" {
+		fmt.Fprintf(&b, "# %s\n\n", opts.Title)
+	}
+	for _, grp := range g.groups {
+		if grp == root && len(grp.rows) == 0 {
+			continue
+		}
+		grp.write(&b, strings.Repeat("#", level))
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+}
+
+type docsGen struct {
+	groups []*docsGroup
+	index  map[string]*docsGroup // by header
+}
+
+type docsGroup struct {
+	title string // heading text
+	doc   string
+	rows  [][4]string // key, type, default, description
+	seen  map[string]bool
+}
+
+// group returns the group for header, creating it with the given title, or
+// the header as code if title is "", on first use.
+func (g *docsGen) group(header, title, doc string) *docsGroup {
+	if grp, ok := g.index[header]; ok {
+		if grp.doc == "" {
+			grp.doc = doc
+		}
+		return grp
+	}
+	if title == "" {
+		title = mdCode(header)
+	}
+	grp := &docsGroup{title: title, doc: doc, seen: make(map[string]bool)}
+	g.index[header] = grp
+	g.groups = append(g.groups, grp)
+	return grp
+}
+
+func (grp *docsGroup) addAll(entries []Node) {
+	for kv := range keyValuesSeq(entries) {
+		grp.add(kv)
+	}
+}
+
+func (grp *docsGroup) add(kv *KeyValue) {
+	key := formatKeyPath(kv.keyParts)
+	if grp.seen[key] {
+		return
+	}
+	grp.seen[key] = true
+	val := kv.val.Text()
+	if i := strings.IndexAny(val, "\r\n"); i >= 0 {
+		val = strings.TrimSpace(val[:i]) + " …"
+	}
+	desc := strings.ReplaceAll(DocComment(kv), "\n", " ")
+	grp.rows = append(grp.rows, [4]string{mdCode(key), valueTypeOf(kv.val).String(), mdCode(val), mdCell(desc)})
+}
+
+func (grp *docsGroup) write(b *bytes.Buffer, heading string) {
+	fmt.Fprintf(b, "%s %s\n\n", heading, grp.title)
+	if grp.doc != "" {
+		b.WriteString(grp.doc + "\n\n")
+	}
+	if len(grp.rows) == 0 {
+		return
+	}
+	b.WriteString("| Key | Type | Default | Description |\n| --- | --- | --- | --- |\n")
+	for _, r := range grp.rows {
+		fmt.Fprintf(b, "| %s | %s | %s | %s |\n", r[0], r[1], r[2], r[3])
+	}
+	b.WriteString("\n")
+}
+
+// mdCode formats s as an inline code span in a table cell, using a longer
+// fence if s contains backticks.
+func mdCode(s string) string {
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + mdCell(s) + fence
+}
+
+// mdCell escapes the pipes that would end a table cell.
+func mdCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,96 @@
+package toml
+
+import "strings"
+
+// placeholders are the values GenerateExample writes for keys without a
+// default, by type.
+var placeholders = [...]string{
+	TypeAny:      `""`,
+	TypeString:   `""`,
+	TypeInteger:  "0",
+	TypeFloat:    "0.0",
+	TypeBoolean:  "false",
+	TypeDateTime: "1979-05-27T07:32:00Z",
+	TypeArray:    "[]",
+	TypeTable:    "{}",
+}
+
+// GenerateExample returns an example document for schema, a table schema
+// such as the root of a document schema. Each field becomes a key-value
+// set to its default, or to a placeholder of its type if it has none or
+// the default is not a valid TOML value, with its description and allowed
+// values as comments above it. Tables and arrays of tables with fields
+// become [table] and [[array]] sections with one entry. Within a table,
+// plain keys come first, then tables, then arrays of tables, each sorted
+// by name, so the output is deterministic.
+func GenerateExample(schema *Schema) *Document {
+	var b strings.Builder
+	if schema != nil {
+		writeExampleFields(&b, schema, nil)
+	}
+	doc, err := Parse([]byte(b.String()))
+	if err != nil {
+		return &Document{} // unreachable: every value was checked
+	}
+	return doc
+}
+
+func writeExampleFields(b *strings.Builder, s *Schema, path []string) {
+	var tables, arrays []string
+	for _, name := range s.fieldNames() {
+		f := s.Fields[name]
+		switch {
+		case f == nil:
+		case f.Type == TypeArrayOfTables:
+			arrays = append(arrays, name)
+		case f.Type == TypeTable && len(f.Fields) > 0:
+			tables = append(tables, name)
+		default:
+			writeExampleComment(b, f)
+			b.WriteString(QuoteKey(name) + " = " + exampleValue(f) + "\n")
+		}
+	}
+	for _, name := range tables {
+		writeExampleSection(b, s.Fields[name], append(path, name), "[", "]")
+	}
+	for _, name := range arrays {
+		writeExampleSection(b, s.Fields[name], append(path, name), "[[", "]]")
+	}
+}
+
+func writeExampleSection(b *strings.Builder, s *Schema, path []string, open, closer string) {
+	if b.Len() > 0 {
+		b.WriteString("\n")
+	}
+	writeExampleComment(b, s)
+	b.WriteString(open + Path(path).String() + closer + "\n")
+	writeExampleFields(b, s, path[:len(path):len(path)])
+}
+
+func writeExampleComment(b *strings.Builder, s *Schema) {
+	if s.Description != "" {
+		for line := range strings.SplitSeq(s.Description, "\n") {
+			b.WriteString(strings.TrimRight("# "+line, " ") + "\n")
+		}
+	}
+	if len(s.Values) > 0 {
+		b.WriteString("# One of: " + strings.Join(s.Values, ", ") + "\n")
+	}
+}
+
+// exampleValue returns the default of s if it is a single valid value of
+// the schema's type, or a placeholder.
+func exampleValue(s *Schema) string {
+	if s.Default != "" && !strings.ContainsAny(s.Default, "\r\n") {
+		doc, err := Parse([]byte("v = " + s.Default + "\n"))
+		if err == nil {
+			if kv := doc.Get("v"); kv != nil && (s.Type == TypeAny || valueTypeOf(kv.val) == s.Type) {
+				return s.Default
+			}
+		}
+	}
+	if int(s.Type) < len(placeholders) && placeholders[s.Type] != "" {
+		return placeholders[s.Type]
+	}
+	return `""`
+}
@@ -0,0 +1,86 @@
+package toml
+
+import (
+	"slices"
+	"strings"
+)
+
+// errorHints maps message prefixes to a short explanation of the rule that
+// was broken. The first matching prefix wins.
+var errorHints = []struct{ prefix, hint string }{
+	{"duplicate key", "a key can be defined only once per table"},
+	{"duplicate table", "a [table] header can appear only once; use [[name]] for an array of tables"},
+	{"cannot reopen table", "a table created by dotted keys cannot be reopened with a [header]"},
+	{"cannot add to explicitly defined table", "keys of a [table] must be written inside its section"},
+	{"cannot extend inline table", "inline tables are complete as written; add keys inside the { }"},
+	{"cannot extend static array", "an array written as [ ... ] cannot be extended with [[ ]] headers"},
+	{"expected '='", "a key must be followed by '=' and a value"},
+	{"expected value", `strings must be quoted, e.g. key = "value"`},
+	{"expected newline or end of file after value", "each key-value pair must be on its own line"},
+	{"leading zeros not allowed", "decimal integers cannot start with 0; use 0o for octal"},
+}
+
+// hintFor returns the hint for an error message, or "".
+func hintFor(msg string) string {
+	for _, h := range errorHints {
+		if strings.HasPrefix(msg, h.prefix) {
+			return h.hint
+		}
+	}
+	return ""
+}
+
+// maxSuggestions caps the number of "did you mean" suggestions.
+const maxSuggestions = 3
+
+// suggestKeys returns up to maxSuggestions candidates that are close to
+// target by edit distance, nearest first. Candidates equal to target and
+// candidates more than a third of target's length away are skipped.
+func suggestKeys(target string, candidates map[string]bool) []string {
+	limit := max(1, len(target)/3)
+	type match struct {
+		key  string
+		dist int
+	}
+	var matches []match
+	for c := range candidates {
+		if c == target {
+			continue
+		}
+		if d := levenshtein(target, c); d <= limit {
+			matches = append(matches, match{c, d})
+		}
+	}
+	slices.SortFunc(matches, func(a, b match) int {
+		if a.dist != b.dist {
+			return a.dist - b.dist
+		}
+		return strings.Compare(a.key, b.key)
+	})
+	var out []string
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		out = append(out, matches[i].key)
+	}
+	return out
+}
+
+// levenshtein returns the edit distance between a and b in bytes.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,102 @@
+package toml
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MediaType is the media type of TOML documents.
+const MediaType = "application/toml"
+
+// Handler returns an http.Handler that serves doc as application/toml,
+// for exposing a service's effective configuration on an admin endpoint.
+// It answers GET and HEAD requests, honors conditional requests with an
+// ETag derived from the content, and replies 406 Not Acceptable if the
+// request's Accept header rules out TOML. The document is serialized on
+// each request, so it must not be changed while the handler may run.
+func Handler(doc *Document) http.Handler {
+	return LiveHandler(func() *Document { return doc })
+}
+
+// LiveHandler is Handler for a document that is replaced over time, such
+// as the latest one delivered by Watch: get is called on each request,
+// and must be safe to call concurrently. If it returns nil the reply is
+// 404 Not Found.
+func LiveHandler(get func() *Document) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if !acceptsTOML(r.Header.Values("Accept")) {
+			http.Error(w, "only "+MediaType+" is available", http.StatusNotAcceptable)
+			return
+		}
+		doc := get()
+		if doc == nil {
+			http.NotFound(w, r)
+			return
+		}
+		body := []byte(doc.String())
+		sum := sha256.Sum256(body)
+		w.Header().Set("Content-Type", MediaType+"; charset=utf-8")
+		w.Header().Set("Etag", `"`+hex.EncodeToString(sum[:16])+`"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+	})
+}
+
+// acceptsTOML reports whether Accept header values allow application/toml.
+// No Accept header allows anything.
+func acceptsTOML(accept []string) bool {
+	if len(accept) == 0 {
+		return true
+	}
+	for _, v := range accept {
+		for r := range strings.SplitSeq(v, ",") {
+			mt, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+			if err != nil {
+				continue
+			}
+			if q, ok := params["q"]; ok {
+				if f, err := strconv.ParseFloat(q, 64); err != nil || f <= 0 {
+					continue
+				}
+			}
+			if mt == MediaType || mt == "application/*" || mt == "*/*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseRequest parses the body of r as TOML with opts. It fails with
+// ErrUnsupportedMediaType unless the request's Content-Type is
+// application/toml, with no charset or utf-8. The whole body is read;
+// limit its size with http.MaxBytesReader first if it is untrusted.
+func ParseRequest(r *http.Request, opts ParseOptions) (*Document, error) {
+	mt, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mt != MediaType {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedMediaType, r.Header.Get("Content-Type"))
+	}
+	if cs, ok := params["charset"]; ok && !strings.EqualFold(cs, "utf-8") {
+		return nil, fmt.Errorf("%w: charset %s", ErrUnsupportedMediaType, cs)
+	}
+	if opts.Context == nil {
+		opts.Context = r.Context()
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return ParseWithOptions(b, opts)
+}
@@ -0,0 +1,111 @@
+package toml
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// ID returns an opaque identifier for the node that stays the same across
+// reparses as long as the node keeps its logical position: key-values and
+// tables are identified by their key path, array-of-tables entries by path
+// and occurrence, values by their slot in the enclosing key-value or
+// array, and comments and whitespace by their text and occurrence within
+// their parent. Editing a value does not change its ID or its key-value's.
+// Nodes that are not attached to a parent have an empty ID.
+func (b *baseNode) ID() string {
+	if b.parent == nil {
+		return ""
+	}
+	self := findSelf(b)
+	if self == nil {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write([]byte(idDescriptor(self)))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+func (b *baseNode) base() *baseNode { return b }
+
+// findSelf returns the Node whose embedded baseNode is b, by scanning b's
+// parent.
+func findSelf(b *baseNode) Node {
+	var self Node
+	eachChild(b.parent, func(c Node) bool {
+		if cb, ok := c.(interface{ base() *baseNode }); ok && cb.base() == b {
+			self = c
+			return false
+		}
+		return true
+	})
+	return self
+}
+
+// idDescriptor describes the logical position of n in its document.
+func idDescriptor(n Node) string {
+	parent := n.Parent()
+	if parent == nil {
+		return ""
+	}
+	prefix := idDescriptor(parent)
+	switch v := n.(type) {
+	case *TableNode:
+		return "t:" + formatKeyPath(v.headerParts)
+	case *ArrayOfTables:
+		return "a:" + formatKeyPath(v.headerParts) + "#" + strconv.Itoa(aotOccurrence(v))
+	case *KeyValue:
+		return prefix + "/k:" + formatKeyPath(v.keyParts)
+	}
+	switch p := parent.(type) {
+	case *KeyValue:
+		if p.val == n {
+			return prefix + "/="
+		}
+	case *ArrayNode:
+		for i, e := range p.elements {
+			if e == n {
+				return prefix + "/[" + strconv.Itoa(i) + "]"
+			}
+		}
+	}
+	return prefix + "/~" + strconv.Itoa(int(n.Type())) + ":" + n.Text() + "#" + strconv.Itoa(textOccurrence(parent, n))
+}
+
+// aotOccurrence returns how many array-of-tables entries with the same
+// header precede a in its document.
+func aotOccurrence(a *ArrayOfTables) int {
+	doc, ok := a.parent.(*Document)
+	if !ok {
+		return 0
+	}
+	path := formatKeyPath(a.headerParts)
+	count := 0
+	for _, n := range doc.nodes {
+		if n == Node(a) {
+			break
+		}
+		if o, ok := n.(*ArrayOfTables); ok && formatKeyPath(o.headerParts) == path {
+			count++
+		}
+	}
+	return count
+}
+
+// textOccurrence returns how many earlier children of parent have the same
+// type and text as n.
+func textOccurrence(parent, n Node) int {
+	count := 0
+	eachChild(parent, func(c Node) bool {
+		if c == n {
+			return false
+		}
+		if c.Type() == n.Type() && c.Text() == n.Text() {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// ID returns the document's identifier, which is always empty.
+func (d *Document) ID() string { return "" }
@@ -0,0 +1,207 @@
+package toml
+
+import (
+	"context"
+	"strings"
+)
+
+// Index is a snapshot of a document's logical structure: every table and
+// key path it defines and the type of value there, however the path was
+// written (table header, dotted key, or inline table). Paths under an
+// array of tables combine all of its entries.
+//
+// An Index does not follow later changes to the document; call
+// Document.Index again after mutating it.
+type Index struct {
+	entries  map[string]*indexEntry
+	children map[string][]string // direct child names in document order
+	valid    bool                // the document validated, so each path is defined once
+}
+
+// indexEntry describes one path.
+type indexEntry struct {
+	kind   ValueType
+	origin pathOrigin
+	kv     *KeyValue // the key-value whose key is the path, if any
+}
+
+// pathOrigin records how a path was defined.
+type pathOrigin int
+
+const (
+	originImplicit pathOrigin = iota // parent of a header, e.g. a in [a.b]
+	originHeader                     // [a] or [[a]]
+	originDotted                     // a in a.b = 1
+	originInline                     // inside or equal to an inline table
+	originValue                      // key = value
+)
+
+// Index returns the structural index of the document. It uses the same
+// rules as Validate; for an invalid document it covers the top-level nodes
+// before the first error. The index is built on first use and kept until
+// the document changes.
+func (d *Document) Index() *Index {
+	if x := d.derived.index.Load(); x != nil {
+		return x
+	}
+	x := &Index{entries: make(map[string]*indexEntry), children: make(map[string][]string)}
+	v := &docValidator{state: newTableState(), ctx: context.Background(), index: x}
+	x.valid = v.validate(d) == nil
+	d.derived.index.Store(x)
+	return x
+}
+
+// KindOf returns the type of the value at path. Tables, including implicit
+// tables and inline tables, are TypeTable.
+func (x *Index) KindOf(path string) (ValueType, bool) {
+	e, ok := x.entries[indexKey(path)]
+	if !ok {
+		return TypeAny, false
+	}
+	return e.kind, true
+}
+
+// IsTable reports whether path is a table, however it was defined.
+func (x *Index) IsTable(path string) bool {
+	kind, ok := x.KindOf(path)
+	return ok && kind == TypeTable
+}
+
+// ChildrenOf returns the names of the direct children of the table or
+// array of tables at path, unquoted and in the order they first appear.
+// The empty path names the root table.
+func (x *Index) ChildrenOf(path string) []string {
+	return append([]string(nil), x.children[indexKey(path)]...)
+}
+
+// keyValue returns the key-value whose key is the path segs, as Get finds
+// it. It reports false if the index cannot tell: for an invalid document,
+// which may define a path twice, and for paths under an array of tables,
+// whose entries the index combines.
+func (x *Index) keyValue(segs []string) (*KeyValue, bool) {
+	if !x.valid || len(segs) == 0 {
+		return nil, false
+	}
+	var b strings.Builder
+	for i, seg := range segs {
+		if i > 0 {
+			if e := x.entries[b.String()]; e != nil && e.kind == TypeArrayOfTables {
+				return nil, false
+			}
+		}
+		writePathKey(&b, seg)
+	}
+	e := x.entries[b.String()]
+	if e == nil {
+		return nil, true
+	}
+	if e.kind == TypeArrayOfTables {
+		return nil, false
+	}
+	return e.kv, true
+}
+
+// indexKey converts a dotted path to the validator's path key.
+func indexKey(path string) string {
+	return pathKey(segsToParts(parseDottedPath(path)))
+}
+
+func segsToParts(segs []string) []KeyPart {
+	parts := make([]KeyPart, len(segs))
+	for i, s := range segs {
+		parts[i] = KeyPart{Unquoted: s}
+	}
+	return parts
+}
+
+func (x *Index) addTopLevel(n Node) {
+	switch v := n.(type) {
+	case *KeyValue:
+		x.addKeyValue(nil, v)
+	case *TableNode:
+		x.addSection(v.headerParts, TypeTable, v.entries)
+	case *ArrayOfTables:
+		x.addSection(v.headerParts, TypeArrayOfTables, v.entries)
+	}
+}
+
+func (x *Index) addSection(parts []KeyPart, kind ValueType, entries []Node) {
+	for i := 1; i < len(parts); i++ {
+		x.add(parts[:i], TypeTable, originImplicit)
+	}
+	x.add(parts, kind, originHeader)
+	for _, e := range entries {
+		if kv, ok := e.(*KeyValue); ok {
+			x.addKeyValue(parts, kv)
+		}
+	}
+}
+
+func (x *Index) addKeyValue(base []KeyPart, kv *KeyValue) {
+	full := append(append([]KeyPart(nil), base...), kv.keyParts...)
+	origin := originDotted
+	if e := x.entries[pathKey(base)]; e != nil && e.origin == originInline {
+		origin = originInline
+	}
+	for i := len(base) + 1; i < len(full); i++ {
+		x.add(full[:i], TypeTable, origin)
+	}
+	var e *indexEntry
+	switch val := kv.val.(type) {
+	case *InlineTableNode:
+		e = x.add(full, TypeTable, originInline)
+		for _, entry := range val.entries {
+			x.addKeyValue(full, entry)
+		}
+	default:
+		if origin != originInline {
+			origin = originValue
+		}
+		e = x.add(full, valueTypeOf(val), origin)
+	}
+	if e.kv == nil {
+		e.kv = kv
+	}
+}
+
+// add records a path and returns its entry. Implicit tables never replace
+// an existing entry.
+func (x *Index) add(parts []KeyPart, kind ValueType, origin pathOrigin) *indexEntry {
+	key := pathKey(parts)
+	if e, ok := x.entries[key]; ok {
+		if origin != originImplicit {
+			e.kind, e.origin = kind, origin
+		}
+		return e
+	}
+	e := &indexEntry{kind: kind, origin: origin}
+	x.entries[key] = e
+	parent := pathKey(parts[:len(parts)-1])
+	x.children[parent] = append(x.children[parent], parts[len(parts)-1].Unquoted)
+	return e
+}
+
+// valueTypeOf returns the type of a value node. Inline tables are
+// TypeTable.
+func valueTypeOf(n Node) ValueType {
+	switch v := n.(type) {
+	case *StringNode:
+		return TypeString
+	case *NumberNode:
+		if _, err := v.Int(); err == nil {
+			return TypeInteger
+		}
+		return TypeFloat
+	case *BooleanNode:
+		return TypeBoolean
+	case *DateTimeNode:
+		return TypeDateTime
+	case *ArrayNode:
+		return TypeArray
+	case *InlineTableNode:
+		return TypeTable
+	case Extension:
+		return v.ValueType()
+	}
+	return TypeAny
+}
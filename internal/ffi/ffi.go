@@ -0,0 +1,145 @@
+// Package ffi implements the operations that the WebAssembly example and
+// the C shared library expose to other languages, with results shaped for
+// JSON, so that every binding behaves the same. The language server
+// formats documents with Format too.
+package ffi
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/maurice/toml"
+)
+
+// Version is the version of the JSON results. It changes only when a
+// field is removed or changes meaning. In version 2, the output of Format
+// is fully formatted rather than only having its numbers rewritten; the
+// result is still {"output", "errors"}.
+const Version = 2
+
+// Diagnostic is an error in the input. Line and Column are 1-indexed, with
+// columns counted in characters, or 0 if unknown.
+type Diagnostic struct {
+	Message string `json:"message"`
+	Hint    string `json:"hint"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+}
+
+// Value is one key-value of a document.
+type Value struct {
+	Path   string `json:"path"`  // dotted path, as accepted by Get
+	Type   string `json:"type"`  // "string", "integer", "float", "boolean", "datetime", or "array"
+	Value  string `json:"value"` // short display of the value, as RenderValue gives
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// ParseResult is the result of Parse.
+type ParseResult struct {
+	Values []Value      `json:"values"`
+	Errors []Diagnostic `json:"errors"`
+}
+
+// ValidateResult is the result of Validate.
+type ValidateResult struct {
+	Valid  bool         `json:"valid"`
+	Errors []Diagnostic `json:"errors"`
+}
+
+// FormatResult is the result of Format. Output is the input unchanged if
+// it has errors.
+type FormatResult struct {
+	Output string       `json:"output"`
+	Errors []Diagnostic `json:"errors"`
+}
+
+// Parse lists every leaf key-value of src with its path, type, and
+// position.
+func Parse(src string) ParseResult {
+	doc, err := toml.Parse([]byte(src))
+	if err != nil {
+		return ParseResult{Values: []Value{}, Errors: diagnostics(err)}
+	}
+	spans, text := doc.Spans(), doc.String()
+	values := []Value{}
+	for path, kv := range doc.Leaves() {
+		pos := toml.PositionAt(text, spans[kv].Start)
+		values = append(values, Value{
+			Path: path, Type: TypeOf(kv.Val()), Value: toml.RenderValue(kv),
+			Line: pos.Line, Column: pos.Rune,
+		})
+	}
+	return ParseResult{Values: values, Errors: []Diagnostic{}}
+}
+
+// Validate reports whether src is valid TOML, and why not.
+func Validate(src string) ValidateResult {
+	_, err := toml.Parse([]byte(src))
+	return ValidateResult{Valid: err == nil, Errors: diagnostics(err)}
+}
+
+// Format formats src: one space on each side of the = of every
+// key-value, numbers in the style of the number-style lint rule, and each
+// run of blank lines collapsed to one. Comments, indentation and the order
+// of entries are kept.
+func Format(src string) FormatResult {
+	doc, err := toml.Parse([]byte(src))
+	if err != nil {
+		return FormatResult{Output: src, Errors: diagnostics(err)}
+	}
+	doc.Walk(func(n toml.Node) bool {
+		if kv, ok := n.(*toml.KeyValue); ok {
+			_ = kv.SetPreEq(" ")
+			_ = kv.SetPostEq(" ")
+		}
+		return true
+	})
+	if _, err := toml.ApplyFixes(doc.Lint(toml.NumberStyle(toml.NumberStyleOptions{}))); err != nil {
+		return FormatResult{Output: src, Errors: diagnostics(err)}
+	}
+	out := doc.StringWithOptions(toml.SerializeOptions{CollapseBlankLines: true})
+	return FormatResult{Output: out, Errors: []Diagnostic{}}
+}
+
+// JSON returns the JSON encoding of a result.
+func JSON(result any) string {
+	b, err := json.Marshal(result)
+	if err != nil {
+		b, _ = json.Marshal(map[string]any{"errors": []Diagnostic{{Message: err.Error()}}})
+	}
+	return string(b)
+}
+
+// diagnostics converts err, which may be nil, to diagnostics.
+func diagnostics(err error) []Diagnostic {
+	if err == nil {
+		return []Diagnostic{}
+	}
+	var pe *toml.ParseError
+	if !errors.As(err, &pe) {
+		return []Diagnostic{{Message: err.Error()}}
+	}
+	pos := pe.Position()
+	return []Diagnostic{{Message: pe.Summary(), Hint: pe.Hint, Line: pos.Line, Column: pos.Rune}}
+}
+
+// TypeOf names the type of a leaf value, as in Value.Type.
+func TypeOf(n toml.Node) string {
+	switch v := n.(type) {
+	case *toml.StringNode:
+		return "string"
+	case *toml.NumberNode:
+		if _, err := v.Int(); err == nil {
+			return "integer"
+		}
+		return "float"
+	case *toml.BooleanNode:
+		return "boolean"
+	case *toml.DateTimeNode:
+		return "datetime"
+	case *toml.ArrayNode:
+		return "array"
+	}
+	return "value"
+}
@@ -0,0 +1,40 @@
+package ffi
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	got := JSON(Parse("a = 1\n[s]\nb = [1, 2]\n"))
+	want := `{"values":[{"path":"a","type":"integer","value":"1","line":1,"column":1},` +
+		`{"path":"s.b","type":"array","value":"[1, 2]","line":3,"column":1}],"errors":[]}`
+	if got != want {
+		t.Errorf("Parse:\ngot  %s\nwant %s", got, want)
+	}
+
+	got = JSON(Parse("a = \n"))
+	want = `{"values":[],"errors":[{"message":"expected value, found end of line",` +
+		`"hint":"strings must be quoted, e.g. key = \"value\"","line":1,"column":5}]}`
+	if got != want {
+		t.Errorf("Parse error:\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if got, want := JSON(Validate("a = 1\n")), `{"valid":true,"errors":[]}`; got != want {
+		t.Errorf("Validate valid: got %s, want %s", got, want)
+	}
+	res := Validate("a = 1\na = 2\n")
+	if res.Valid || len(res.Errors) != 1 || res.Errors[0].Line != 2 {
+		t.Errorf("Validate duplicate: got %+v", res)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	got := Format("n=+1000000 # c\n\n\n[t]\nk  =  1\n")
+	if got.Output != "n = 1_000_000 # c\n\n[t]\nk = 1\n" || len(got.Errors) != 0 {
+		t.Errorf("Format: got %+v", got)
+	}
+	got = Format("n = \n")
+	if got.Output != "n = \n" || len(got.Errors) != 1 {
+		t.Errorf("Format invalid: got %+v", got)
+	}
+}
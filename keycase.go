@@ -0,0 +1,225 @@
+package toml
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// KeyCase is a naming convention for keys.
+type KeyCase int
+
+const (
+	SnakeCase KeyCase = iota // max_conns
+	KebabCase                // max-conns
+	CamelCase                // maxConns
+)
+
+var keyCaseNames = [...]string{SnakeCase: "snake_case", KebabCase: "kebab-case", CamelCase: "camelCase"}
+
+// String returns the convention's name, such as "snake_case".
+func (c KeyCase) String() string {
+	if c < 0 || int(c) >= len(keyCaseNames) {
+		return fmt.Sprintf("KeyCase(%d)", int(c))
+	}
+	return keyCaseNames[c]
+}
+
+// Convert returns name written in the convention. Words are separated at
+// underscores, hyphens, and spaces, and where the case changes, so that
+// "HTTPServer", "http_server", and "http-server" all convert to the same
+// name. A name with no words, such as "_", is returned unchanged.
+func (c KeyCase) Convert(name string) string {
+	words := splitWords(name)
+	if len(words) == 0 {
+		return name
+	}
+	for i, w := range words {
+		w = strings.ToLower(w)
+		if c == CamelCase && i > 0 {
+			r := []rune(w)
+			r[0] = unicode.ToUpper(r[0])
+			w = string(r)
+		}
+		words[i] = w
+	}
+	switch c { //nolint:exhaustive
+	case KebabCase:
+		return strings.Join(words, "-")
+	case CamelCase:
+		return strings.Join(words, "")
+	}
+	return strings.Join(words, "_")
+}
+
+// splitWords splits a key name into words at separators and case changes.
+// An upper-case run followed by a lower-case letter ends before its last
+// letter, as in "HTTP" "Server".
+func splitWords(name string) []string {
+	var words []string
+	r := []rune(name)
+	start := 0
+	for i := range r {
+		switch {
+		case r[i] == '_' || r[i] == '-' || r[i] == ' ':
+			if i > start {
+				words = append(words, string(r[start:i]))
+			}
+			start = i + 1
+		case i > start && unicode.IsUpper(r[i]) &&
+			(!unicode.IsUpper(r[i-1]) || i+1 < len(r) && unicode.IsLower(r[i+1])):
+			words = append(words, string(r[start:i]))
+			start = i
+		}
+	}
+	if start < len(r) {
+		words = append(words, string(r[start:]))
+	}
+	return words
+}
+
+// KeyStyle returns a lint rule named "key-case" that reports every part of
+// a key or header not written in the convention c. Keys inside arrays are
+// not checked. Each finding's Fix renames the key with RenameKey, which
+// changes all its spellings; use NormalizeKeyCase to rename every key at
+// once with a check for collisions.
+func KeyStyle(c KeyCase) LintRule {
+	return LintRule{
+		Name: "key-case",
+		Check: func(doc *Document) []LintFinding {
+			var out []LintFinding
+			doc.WalkWithSkip(func(n Node) WalkAction {
+				prefix, parts, ok := keyOf(n)
+				if !ok {
+					if _, isArray := n.(*ArrayNode); isArray {
+						return WalkSkipChildren
+					}
+					return WalkContinue
+				}
+				for i, p := range parts {
+					if want := c.Convert(p.Unquoted); want != p.Unquoted {
+						path := JoinPath(slices.Concat(prefix, partsToSegs(parts[:i+1]))...)
+						out = append(out, LintFinding{
+							Path:    path,
+							Node:    n,
+							Message: fmt.Sprintf("%s is not %s: use %s", QuoteKey(p.Unquoted), c, QuoteKey(want)),
+							Fix:     func() error { return fixKeyCase(doc, n, i, c) },
+						})
+					}
+				}
+				return WalkContinue
+			})
+			return out
+		},
+	}
+}
+
+// keyOf returns the key of a key-value or header and the path of the
+// table it is in, or false for other nodes.
+func keyOf(n Node) (prefix []string, parts []KeyPart, ok bool) {
+	switch v := n.(type) {
+	case *TableNode:
+		return nil, v.headerParts, true
+	case *ArrayOfTables:
+		return nil, v.headerParts, true
+	case *KeyValue:
+		switch p := v.Parent().(type) {
+		case *TableNode, *ArrayOfTables:
+			return partsToSegs(sectionParts(p)), v.keyParts, true
+		case *InlineTableNode:
+			if prefix, parts, ok := keyOf(p.Parent()); ok {
+				return slices.Concat(prefix, partsToSegs(parts)), v.keyParts, true
+			}
+			return nil, nil, false
+		}
+		return nil, v.keyParts, true
+	}
+	return nil, nil, false
+}
+
+// fixKeyCase renames part i of n's key to the convention c, unless an
+// earlier fix has already.
+func fixKeyCase(doc *Document, n Node, i int, c KeyCase) error {
+	prefix, parts, ok := keyOf(n)
+	if !ok || i >= len(parts) {
+		return nil
+	}
+	want := c.Convert(parts[i].Unquoted)
+	if want == parts[i].Unquoted {
+		return nil
+	}
+	return doc.RenameKey(JoinPath(slices.Concat(prefix, partsToSegs(parts[:i+1]))...), want)
+}
+
+// NormalizeKeyCase renames every key of the document that is not written
+// in the convention c, as the fixes of KeyStyle do, and returns a map
+// from the old path to the new path of every key whose path changed, for
+// updating the code that refers to them. Keys inside arrays are left
+// alone. If two keys of a table would end up with the same name, nothing
+// is renamed and the returned error wraps ErrDuplicateKey and names them.
+func (d *Document) NormalizeKeyCase(c KeyCase) (map[string]string, error) {
+	p := keyCasePlan{c: c, renames: make(map[string]string)}
+	if err := p.table(d.logicalRoot(), nil, nil); err != nil {
+		return nil, err
+	}
+	var r renamer
+	// Rename the deepest keys first, so that the old paths of the rest
+	// still resolve.
+	for i := len(p.order) - 1; i >= 0; i-- {
+		old := p.order[i]
+		r.apply(d, old, c.Convert(old[len(old)-1]))
+	}
+	if err := d.validateMutation(); err != nil {
+		r.revert()
+		return nil, err
+	}
+	return p.renames, nil
+}
+
+// keyCasePlan collects the renames NormalizeKeyCase makes.
+type keyCasePlan struct {
+	c       KeyCase
+	renames map[string]string // old path to new path
+	order   [][]string        // old paths, parents before children
+}
+
+// table plans the renames of the keys of t, whose path was old and will be
+// renamed to path.
+func (p *keyCasePlan) table(t *lnode, old, path []string) error {
+	taken := make(map[string]string, len(t.names))
+	for _, name := range t.names {
+		want := p.c.Convert(name)
+		if other, ok := taken[want]; ok {
+			return fmt.Errorf("%w: %s and %s would both be %s", ErrDuplicateKey,
+				JoinPath(append(old, other)...), JoinPath(append(old, name)...), JoinPath(append(path, want)...))
+		}
+		taken[want] = name
+	}
+	for _, name := range t.names {
+		childOld := append(old[:len(old):len(old)], name)
+		childPath := append(path[:len(path):len(path)], p.c.Convert(name))
+		if key := JoinPath(childOld...); !slices.Equal(childOld, childPath) {
+			if _, ok := p.renames[key]; !ok {
+				p.renames[key] = JoinPath(childPath...)
+				if name != childPath[len(childPath)-1] {
+					p.order = append(p.order, childOld)
+				}
+			}
+		}
+		child := t.fields[name]
+		switch child.kind { //nolint:exhaustive
+		case TypeTable:
+			if err := p.table(child, childOld, childPath); err != nil {
+				return err
+			}
+		case TypeArrayOfTables:
+			for _, e := range child.entries {
+				if err := p.table(e, childOld, childPath); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
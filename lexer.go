@@ -30,6 +30,7 @@ const (
 	TokFloat
 	TokBoolean
 	TokDateTime
+	TokTemplate
 )
 
 // Token is a lexer token with position.
@@ -49,6 +50,7 @@ type lexer struct {
 	line      int
 	col       int
 	valueMode bool // when true, dot is part of numeric tokens (value context)
+	templates bool // when true, {{ ... }} is scanned as a TokTemplate
 }
 
 func newLexer(src string) *lexer {
@@ -119,6 +121,8 @@ func (l *lexer) Next() Token {
 	case ch == ']':
 		l.advance()
 		return l.makeToken(TokRBracket, sPos, sLine, sCol)
+	case ch == '{' && l.templates && l.peekNext() == '{':
+		return l.scanTemplate()
 	case ch == '{':
 		l.advance()
 		return l.makeToken(TokLBrace, sPos, sLine, sCol)
@@ -167,6 +171,24 @@ func (l *lexer) scanComment() Token {
 	return l.makeToken(TokComment, sPos, sLine, sCol)
 }
 
+// scanTemplate scans a {{ ... }} template action through the closing
+// braces, or returns an error token for the rest of the line if it is not
+// closed.
+func (l *lexer) scanTemplate() Token {
+	sPos, sLine, sCol := l.pos, l.line, l.col
+	end := strings.Index(l.src[l.pos:], "}}")
+	if end < 0 {
+		for !l.atEnd() && l.peek() != '\n' && l.peek() != '\r' {
+			l.advance()
+		}
+		return l.errToken(sPos, sLine, sCol)
+	}
+	for range end + 2 {
+		l.advance()
+	}
+	return l.makeToken(TokTemplate, sPos, sLine, sCol)
+}
+
 func (l *lexer) scanBasicStringStart() Token {
 	sPos, sLine, sCol := l.pos, l.line, l.col
 	l.advance() // first "
@@ -0,0 +1,94 @@
+package toml
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// LintRule is a named check that reports findings about a document that
+// is valid TOML but may still be wrong, such as use of a deprecated key.
+type LintRule struct {
+	Name  string
+	Check func(doc *Document) []LintFinding
+}
+
+// LintFinding is a problem reported by a LintRule.
+type LintFinding struct {
+	Rule    string // name of the rule that reported it, set by Lint
+	Path    string // dotted path of the key-value concerned, if any
+	Node    Node   // node the finding is about
+	Line    int    // 1-indexed position of Node in the document's text, or 0
+	Column  int    // byte column
+	Message string
+
+	// Fix, if non-nil, changes the document so that the rule no longer
+	// reports the finding. See ApplyFixes.
+	Fix func() error
+}
+
+// String formats the finding as "line:column: rule: message", leaving out
+// the position if it is unknown.
+func (f LintFinding) String() string {
+	if f.Line == 0 {
+		return fmt.Sprintf("%s: %s", f.Rule, f.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", f.Line, f.Column, f.Rule, f.Message)
+}
+
+// Lint runs rules over the document and returns their findings ordered by
+// position, findings without one last.
+func (d *Document) Lint(rules ...LintRule) []LintFinding {
+	var out []LintFinding
+	for _, r := range rules {
+		for _, f := range r.Check(d) {
+			f.Rule = r.Name
+			out = append(out, f)
+		}
+	}
+	d.positionFindings(out)
+	slices.SortStableFunc(out, func(a, b LintFinding) int {
+		if (a.Line == 0) != (b.Line == 0) {
+			return cmp.Compare(b.Line, a.Line)
+		}
+		return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+	return out
+}
+
+// ApplyFixes applies the Fix of every finding that has one, in order, and
+// returns the number applied. It stops at the first fix that fails and
+// returns its error. Run Lint again afterwards for what is left.
+func ApplyFixes(findings []LintFinding) (int, error) {
+	n := 0
+	for _, f := range findings {
+		if f.Fix == nil {
+			continue
+		}
+		if err := f.Fix(); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// positionFindings sets the position of each finding about a node of the
+// document from its current text, so that nodes added or moved since the
+// parse are placed where they now are.
+func (d *Document) positionFindings(findings []LintFinding) {
+	pos := nodePositions{doc: d}
+	for i, f := range findings {
+		if f.Node == nil {
+			continue
+		}
+		if p, _, ok := pos.find(f.Node); ok {
+			findings[i].Line, findings[i].Column = p.Line, p.Column
+		}
+	}
+}
+
+// findingAt returns a finding about kv at path.
+func findingAt(path string, kv *KeyValue, format string, args ...any) LintFinding {
+	return LintFinding{Path: path, Node: kv, Line: int(kv.line), Column: int(kv.col), Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,189 @@
+package toml
+
+// lnode is one value of the logical document: the merged view of tables
+// however they were written, with arrays of tables as lists of entries.
+// Building it mirrors how a decoder assigns values.
+type lnode struct {
+	kind    ValueType
+	kv      *KeyValue // defining key-value of a value or inline table
+	defs    []Node    // CST nodes that define or extend a table
+	names   []string  // child names in document order
+	fields  map[string]*lnode
+	entries []*lnode // entries of an array of tables
+}
+
+func newLTable(defs ...Node) *lnode {
+	return &lnode{kind: TypeTable, fields: make(map[string]*lnode), defs: defs}
+}
+
+func (n *lnode) child(name string) *lnode { return n.fields[name] }
+
+func (n *lnode) setChild(name string, c *lnode) {
+	if _, ok := n.fields[name]; !ok {
+		n.names = append(n.names, name)
+	}
+	n.fields[name] = c
+}
+
+// descend returns the table to continue a path through: the node itself
+// for tables, the last entry for arrays of tables, and nil otherwise.
+func (n *lnode) descend() *lnode {
+	switch n.kind { //nolint:exhaustive
+	case TypeTable:
+		return n
+	case TypeArrayOfTables:
+		if len(n.entries) > 0 {
+			return n.entries[len(n.entries)-1]
+		}
+	}
+	return nil
+}
+
+// logicalRoot returns the logical view of the document, built on first use
+// and kept until the document changes. LogicalTable.Set updates the view
+// it was resolved from after changing the document, so a cached view is
+// never written to.
+func (d *Document) logicalRoot() *lnode {
+	if root := d.derived.root.Load(); root != nil {
+		return root
+	}
+	root := d.buildLogicalRoot()
+	d.derived.root.Store(root)
+	return root
+}
+
+// buildLogicalRoot builds the logical view of the document.
+func (d *Document) buildLogicalRoot() *lnode {
+	root := newLTable(d)
+	for _, n := range d.nodes {
+		switch v := n.(type) {
+		case *KeyValue:
+			addLogicalKeyValue(root, v)
+		case *TableNode:
+			t := logicalTable(root, v.headerParts, v)
+			t.addDef(v)
+			addLogicalEntries(t, v.entries)
+		case *ArrayOfTables:
+			parts := v.headerParts
+			parent := logicalTable(root, parts[:len(parts)-1], v)
+			name := parts[len(parts)-1].Unquoted
+			aot := parent.child(name)
+			if aot == nil || aot.kind != TypeArrayOfTables {
+				aot = &lnode{kind: TypeArrayOfTables}
+				parent.setChild(name, aot)
+			}
+			aot.defs = append(aot.defs, v)
+			entry := newLTable(v)
+			aot.entries = append(aot.entries, entry)
+			addLogicalEntries(entry, v.entries)
+		}
+	}
+	return root
+}
+
+// logicalTable walks parts from t, creating implicit tables as needed and
+// continuing into the last entry of arrays of tables. def is recorded on
+// the tables it creates, and on every table it passes through if it is a
+// dotted key.
+func logicalTable(t *lnode, parts []KeyPart, def Node) *lnode {
+	_, dotted := def.(*KeyValue)
+	for _, p := range parts {
+		c := t.child(p.Unquoted)
+		if c == nil || c.descend() == nil {
+			c = newLTable(def)
+			t.setChild(p.Unquoted, c)
+		} else if dotted {
+			c.addDef(def)
+		}
+		t = c.descend()
+	}
+	return t
+}
+
+// addDef records a defining node once.
+func (n *lnode) addDef(def Node) {
+	if len(n.defs) == 0 || n.defs[len(n.defs)-1] != def {
+		n.defs = append(n.defs, def)
+	}
+}
+
+func addLogicalEntries(t *lnode, entries []Node) {
+	for _, e := range entries {
+		if kv, ok := e.(*KeyValue); ok {
+			addLogicalKeyValue(t, kv)
+		}
+	}
+}
+
+func addLogicalKeyValue(t *lnode, kv *KeyValue) {
+	parts := kv.keyParts
+	t = logicalTable(t, parts[:len(parts)-1], kv)
+	setLogicalValue(t, parts[len(parts)-1].Unquoted, kv)
+}
+
+// setLogicalValue records kv's value as the child name of t.
+func setLogicalValue(t *lnode, name string, kv *KeyValue) {
+	if it, ok := kv.val.(*InlineTableNode); ok {
+		c := newLTable(kv)
+		c.kv = kv
+		t.setChild(name, c)
+		for _, e := range it.entries {
+			addLogicalKeyValue(c, e)
+		}
+		return
+	}
+	t.setChild(name, &lnode{kind: valueTypeOf(kv.val), kv: kv})
+}
+
+// node returns the CST node that defines n: its key-value, or else the
+// first header or dotted key that opened it.
+func (n *lnode) node() Node {
+	switch {
+	case n.kv != nil:
+		return n.kv
+	case len(n.defs) > 0:
+		return n.defs[0]
+	}
+	return nil
+}
+
+// lookup resolves segs from n. Intermediate arrays of tables resolve to
+// their last entry.
+func (n *lnode) lookup(segs []string) *lnode {
+	for i, s := range segs {
+		if i > 0 {
+			n = n.descend()
+			if n == nil {
+				return nil
+			}
+		}
+		n = n.child(s)
+		if n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// Has reports whether path names a value or table in the document,
+// including tables defined only through dotted keys or as parents of a
+// header. Paths through an array of tables resolve into its last entry, as
+// a decoder would when reading the following lines.
+func (d *Document) Has(path string) bool {
+	_, ok := d.KindAt(path)
+	return ok
+}
+
+// KindAt returns the type of the value at path, resolved as in Has.
+// Tables, including inline tables, are TypeTable.
+func (d *Document) KindAt(path string) (ValueType, bool) {
+	segs := parseDottedPath(path)
+	if len(segs) == 0 {
+		return TypeAny, false
+	}
+	n := d.logicalRoot().lookup(segs)
+	if n == nil {
+		return TypeAny, false
+	}
+	return n.kind, true
+}
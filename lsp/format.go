@@ -0,0 +1,21 @@
+package lsp
+
+import "github.com/maurice/toml/internal/ffi"
+
+// formatting returns the edit that formats a document with ffi.Format, the
+// formatter the WebAssembly and C bindings share. There are no edits if
+// the document is formatted already or does not parse.
+func (s *Server) formatting(p DocumentFormattingParams) []TextEdit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []TextEdit{}
+	f := s.current(p.TextDocument.URI)
+	if f == nil {
+		return out
+	}
+	res := ffi.Format(f.text)
+	if len(res.Errors) > 0 || res.Output == f.text {
+		return out
+	}
+	return append(out, TextEdit{Range: f.index.rangeOf(0, len(f.text)), NewText: res.Output})
+}
@@ -0,0 +1,118 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maurice/toml"
+)
+
+func (s *Server) hover(p TextDocumentPositionParams) *Hover {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.current(p.TextDocument.URI)
+	if f == nil {
+		return nil
+	}
+	off := f.index.offset(p.Position)
+	spans := f.doc.Spans()
+	n, sp := innermost(spans, off)
+	if n == nil {
+		return nil
+	}
+	var b strings.Builder
+	switch v := n.(type) {
+	case *toml.KeyValue:
+		fmt.Fprintf(&b, "`%s`: %s", keyPath(v), valueType(v.Val()))
+		writeDoc(&b, toml.DocComment(v))
+	case *toml.TableNode:
+		fmt.Fprintf(&b, "`[%s]`: table", joinKey(v.HeaderParts()))
+		writeDoc(&b, toml.SectionDocComment(v))
+	case *toml.ArrayOfTables:
+		fmt.Fprintf(&b, "`[[%s]]`: array of tables", joinKey(v.HeaderParts()))
+		writeDoc(&b, toml.SectionDocComment(v))
+	}
+	r := f.index.rangeOf(sp.Start, sp.End)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: b.String()}, Range: &r}
+}
+
+// innermost returns the smallest key-value or header span containing off.
+func innermost(spans map[toml.Node]toml.Span, off int) (toml.Node, toml.Span) {
+	var best toml.Node
+	var bestSpan toml.Span
+	for n, sp := range spans {
+		switch n.(type) {
+		case *toml.KeyValue, *toml.TableNode, *toml.ArrayOfTables:
+		default:
+			continue
+		}
+		if !sp.Contains(off) {
+			continue
+		}
+		if best == nil || sp.End-sp.Start < bestSpan.End-bestSpan.Start {
+			best, bestSpan = n, sp
+		}
+	}
+	return best, bestSpan
+}
+
+func writeDoc(b *strings.Builder, doc string) {
+	if doc != "" {
+		b.WriteString("\n\n")
+		b.WriteString(doc)
+	}
+}
+
+// keyPath returns the full dotted path of a key-value, including the
+// enclosing table header and any inline tables.
+func keyPath(kv *toml.KeyValue) string {
+	parts := kv.KeyParts()
+	for n := kv.Parent(); n != nil; n = n.Parent() {
+		switch v := n.(type) {
+		case *toml.KeyValue:
+			parts = append(v.KeyParts(), parts...)
+		case *toml.TableNode:
+			parts = append(v.HeaderParts(), parts...)
+		case *toml.ArrayOfTables:
+			parts = append(v.HeaderParts(), parts...)
+		}
+	}
+	return joinKey(parts)
+}
+
+func joinKey(parts []toml.KeyPart) string {
+	segs := make([]string, len(parts))
+	for i, p := range parts {
+		segs[i] = toml.QuoteKey(p.Unquoted)
+	}
+	return strings.Join(segs, ".")
+}
+
+// valueType names the TOML type of a value node.
+func valueType(n toml.Node) string {
+	switch v := n.(type) {
+	case *toml.StringNode:
+		return "string"
+	case *toml.NumberNode:
+		if _, err := v.Int(); err == nil {
+			return "integer"
+		}
+		return "float"
+	case *toml.BooleanNode:
+		return "boolean"
+	case *toml.DateTimeNode:
+		return dateTimeKinds[v.Kind()]
+	case *toml.ArrayNode:
+		return "array"
+	case *toml.InlineTableNode:
+		return "inline table"
+	}
+	return "value"
+}
+
+var dateTimeKinds = map[toml.DateTimeKind]string{
+	toml.OffsetDateTime: "offset date-time",
+	toml.LocalDateTime:  "local date-time",
+	toml.LocalDate:      "local date",
+	toml.LocalTime:      "local time",
+}
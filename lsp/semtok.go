@@ -0,0 +1,52 @@
+package lsp
+
+import (
+	"strings"
+
+	"github.com/maurice/toml"
+)
+
+// tokenTypes is the semantic token legend, indexed by toml.TokenClass.
+var tokenTypes = []string{
+	toml.TokenKey:         "property",
+	toml.TokenTableHeader: "namespace",
+	toml.TokenString:      "string",
+	toml.TokenEscape:      "regexp",
+	toml.TokenNumber:      "number",
+	toml.TokenBoolean:     "keyword",
+	toml.TokenDateTime:    "datetime",
+	toml.TokenComment:     "comment",
+	toml.TokenPunctuation: "operator",
+}
+
+func (s *Server) semanticTokens(p SemanticTokensParams) SemanticTokens {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := SemanticTokens{Data: []int{}}
+	f := s.current(p.TextDocument.URI)
+	if f == nil {
+		return out
+	}
+	var line, char int
+	for _, tok := range toml.SemanticTokens(f.doc) {
+		// Clients expect single-line tokens, so multi-line strings are
+		// split at line breaks.
+		for start := tok.Span.Start; start < tok.Span.End; {
+			end := min(f.index.lineEnd(start), tok.Span.End)
+			if end > start {
+				pos := f.index.position(start)
+				if pos.Line != line {
+					char = 0
+				}
+				length := f.index.position(end).Character - pos.Character
+				out.Data = append(out.Data, pos.Line-line, pos.Character-char, length, int(tok.Class), 0)
+				line, char = pos.Line, pos.Character
+			}
+			start = end + 1
+			if strings.HasPrefix(f.text[end:], "\r\n") {
+				start++
+			}
+		}
+	}
+	return out
+}
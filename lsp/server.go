@@ -0,0 +1,264 @@
+// Package lsp implements a Language Server Protocol server for TOML files
+// on top of the format-preserving CST in github.com/maurice/toml.
+//
+// The server supports full and incremental document sync, diagnostics for
+// parse and validation errors, hover with the key path, value type and
+// documentation comments, document symbols for tables and keys, folding
+// ranges for sections, semantic tokens, and document formatting. Edits
+// reparse only the sections they touch.
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/maurice/toml"
+)
+
+// file is the server's view of an open document.
+type file struct {
+	version int
+	text    string
+	index   *textIndex
+	doc     *toml.Document // text parsed, or nil if it does not parse
+}
+
+// Server is a TOML language server. Create one with NewServer and run it
+// with Serve.
+type Server struct {
+	mu       sync.Mutex
+	files    map[string]*file
+	shutdown bool
+}
+
+// NewServer returns a server with no open documents.
+func NewServer() *Server {
+	return &Server{files: make(map[string]*file)}
+}
+
+// Serve reads requests from r and writes responses and notifications to w
+// until the client sends exit, r is exhausted, or ctx is done. Requests are
+// handled in order.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	c := newConn(r, w)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		body, err := c.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := c.write(response{JSONRPC: "2.0", ID: json.RawMessage("null"),
+				Error: &responseError{Code: codeParseError, Message: err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(c, &req); err != nil {
+			return err
+		}
+	}
+}
+
+// handle dispatches one message and writes its response, if any.
+func (s *Server) handle(c *conn, req *request) error {
+	result, rerr := s.dispatch(c, req)
+	if req.ID == nil {
+		return nil
+	}
+	resp := response{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rerr}
+	return c.write(resp)
+}
+
+func (s *Server) dispatch(c *conn, req *request) (any, *responseError) {
+	s.mu.Lock()
+	down := s.shutdown
+	s.mu.Unlock()
+	if down {
+		if req.ID == nil {
+			return nil, nil // notifications after shutdown are dropped
+		}
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shut down: " + req.Method}
+	}
+	switch req.Method {
+	case "initialize":
+		return initializeResult(), nil
+	case "shutdown":
+		s.mu.Lock()
+		s.shutdown = true
+		s.mu.Unlock()
+		return nil, nil
+	case "textDocument/didOpen":
+		var p DidOpenTextDocumentParams
+		return decodeThen(req, &p, func() (any, *responseError) {
+			s.open(c, p)
+			return nil, nil
+		})
+	case "textDocument/didChange":
+		var p DidChangeTextDocumentParams
+		return decodeThen(req, &p, func() (any, *responseError) {
+			s.change(c, p)
+			return nil, nil
+		})
+	case "textDocument/didClose":
+		var p DidCloseTextDocumentParams
+		return decodeThen(req, &p, func() (any, *responseError) {
+			s.close(c, p)
+			return nil, nil
+		})
+	case "textDocument/hover":
+		var p TextDocumentPositionParams
+		return decodeThen(req, &p, func() (any, *responseError) { return s.hover(p), nil })
+	case "textDocument/documentSymbol":
+		var p DocumentSymbolParams
+		return decodeThen(req, &p, func() (any, *responseError) { return s.symbols(p), nil })
+	case "textDocument/foldingRange":
+		var p FoldingRangeParams
+		return decodeThen(req, &p, func() (any, *responseError) { return s.folding(p), nil })
+	case "textDocument/semanticTokens/full":
+		var p SemanticTokensParams
+		return decodeThen(req, &p, func() (any, *responseError) { return s.semanticTokens(p), nil })
+	case "textDocument/formatting":
+		var p DocumentFormattingParams
+		return decodeThen(req, &p, func() (any, *responseError) { return s.formatting(p), nil })
+	}
+	if req.ID == nil {
+		return nil, nil // unknown notifications are ignored
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+func decodeThen(req *request, params any, fn func() (any, *responseError)) (any, *responseError) {
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return fn()
+}
+
+func initializeResult() any {
+	return map[string]any{
+		"capabilities": map[string]any{
+			"textDocumentSync": map[string]any{
+				"openClose": true,
+				"change":    2, // incremental
+			},
+			"hoverProvider":              true,
+			"documentSymbolProvider":     true,
+			"foldingRangeProvider":       true,
+			"documentFormattingProvider": true,
+			"semanticTokensProvider": map[string]any{
+				"legend": map[string]any{"tokenTypes": tokenTypes, "tokenModifiers": []string{}},
+				"full":   true,
+			},
+		},
+		"serverInfo": map[string]any{"name": "toml-lsp"},
+	}
+}
+
+func (s *Server) open(c *conn, p DidOpenTextDocumentParams) {
+	s.mu.Lock()
+	f := &file{version: p.TextDocument.Version}
+	s.files[p.TextDocument.URI] = f
+	diags := f.update(p.TextDocument.Text)
+	s.mu.Unlock()
+	s.publish(c, p.TextDocument.URI, f.version, diags)
+}
+
+func (s *Server) change(c *conn, p DidChangeTextDocumentParams) {
+	s.mu.Lock()
+	f, ok := s.files[p.TextDocument.URI]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	text := f.text
+	for _, ch := range p.ContentChanges {
+		text = applyChange(text, ch)
+	}
+	f.version = p.TextDocument.Version
+	diags := f.update(text)
+	s.mu.Unlock()
+	s.publish(c, p.TextDocument.URI, f.version, diags)
+}
+
+func (s *Server) close(c *conn, p DidCloseTextDocumentParams) {
+	s.mu.Lock()
+	delete(s.files, p.TextDocument.URI)
+	s.mu.Unlock()
+	s.publish(c, p.TextDocument.URI, 0, nil)
+}
+
+// publish sends diagnostics for uri. Write errors surface on the next
+// response, so they are ignored here.
+func (s *Server) publish(c *conn, uri string, version int, diags []Diagnostic) {
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	_ = c.write(notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  PublishDiagnosticsParams{URI: uri, Version: version, Diagnostics: diags},
+	})
+}
+
+// update replaces the file's text, reparses it, and returns the resulting
+// diagnostics. A document that parsed before is reparsed in place, only
+// around the edit. While the text does not parse the file has no document,
+// so hover, symbols and the other features return nothing rather than
+// ranges into text that is gone.
+func (f *file) update(text string) []Diagnostic {
+	f.text = text
+	f.index = newTextIndex(text)
+	var err error
+	if f.doc != nil {
+		err = f.doc.Reparse([]byte(text))
+	} else {
+		f.doc, err = toml.Parse([]byte(text))
+	}
+	if err != nil {
+		f.doc = nil
+		return []Diagnostic{f.diagnostic(err)}
+	}
+	return nil
+}
+
+func (f *file) diagnostic(err error) Diagnostic {
+	d := Diagnostic{Severity: SeverityError, Source: "toml", Message: err.Error()}
+	var pe *toml.ParseError
+	if errors.As(err, &pe) {
+		d.Message = pe.Summary()
+		if pe.Hint != "" {
+			d.Message += "\nhint: " + pe.Hint
+		}
+		if pe.Token != "" && !strings.ContainsAny(pe.Token, "\r\n") {
+			d.Range = f.index.rangeOf(pe.Span.Start, pe.Span.End)
+			return d
+		}
+		start := f.index.offset(Position{Line: pe.Line - 1})
+		start = min(start+pe.Column-1, f.index.lineEnd(start))
+		d.Range = f.index.rangeOf(start, f.index.lineEnd(start))
+	}
+	return d
+}
+
+// current returns the file for uri if it has a parsed document.
+func (s *Server) current(uri string) *file {
+	f, ok := s.files[uri]
+	if !ok || f.doc == nil {
+		return nil
+	}
+	return f
+}
@@ -0,0 +1,295 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// session runs the server over the given messages and returns the decoded
+// output messages.
+func session(t *testing.T, msgs ...any) []map[string]any {
+	t.Helper()
+	var in bytes.Buffer
+	for _, m := range msgs {
+		body, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	var out bytes.Buffer
+	if err := NewServer().Serve(context.Background(), &in, &out); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	c := newConn(&out, nil)
+	var got []map[string]any
+	for {
+		body, err := c.read()
+		if err != nil {
+			break
+		}
+		var m map[string]any
+		if err := json.Unmarshal(body, &m); err != nil {
+			t.Fatalf("unmarshal %s: %v", body, err)
+		}
+		got = append(got, m)
+	}
+	return got
+}
+
+func req(id int, method string, params any) map[string]any {
+	return map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+}
+
+func note(method string, params any) map[string]any {
+	return map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+}
+
+func toJSON(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(b)
+}
+
+const uri = "file:///config.toml"
+
+func open(text string) map[string]any {
+	return note("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "toml", "version": 1, "text": text},
+	})
+}
+
+func TestServer_Initialize(t *testing.T) {
+	got := session(t, req(1, "initialize", map[string]any{}), req(2, "shutdown", nil), note("exit", nil))
+	if len(got) != 2 {
+		t.Fatalf("expected 2 responses, got %d", len(got))
+	}
+	caps := toJSON(t, got[0]["result"])
+	if !strings.Contains(caps, `"hoverProvider":true`) || !strings.Contains(caps, `"change":2`) {
+		t.Fatalf("unexpected capabilities: %s", caps)
+	}
+}
+
+func TestServer_DiagnosticsAndIncrementalChange(t *testing.T) {
+	got := session(t,
+		open("a = 1\nb = \n"),
+		note("textDocument/didChange", map[string]any{
+			"textDocument": map[string]any{"uri": uri, "version": 2},
+			"contentChanges": []any{map[string]any{
+				"range": Range{Start: Position{Line: 1, Character: 4}, End: Position{Line: 1, Character: 4}},
+				"text":  "2",
+			}},
+		}),
+	)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(got))
+	}
+	first := toJSON(t, got[0]["params"])
+	if !strings.Contains(first, `"severity":1`) || !strings.Contains(first, `"line":1`) {
+		t.Fatalf("expected an error diagnostic on line 1, got %s", first)
+	}
+	if second := toJSON(t, got[1]["params"]); !strings.Contains(second, `"diagnostics":[]`) {
+		t.Fatalf("expected diagnostics to clear after the fix, got %s", second)
+	}
+}
+
+func TestServer_Hover(t *testing.T) {
+	text := "[server]\n# Host to bind.\n# Defaults to all.\nhost = \"h\" # required\nport = 80\n"
+	got := session(t, open(text), req(1, "textDocument/hover", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     Position{Line: 3, Character: 1},
+	}))
+	var hover Hover
+	if err := json.Unmarshal([]byte(toJSON(t, got[1]["result"])), &hover); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := "`server.host`: string\n\nHost to bind.\nDefaults to all.\nrequired"
+	if hover.Contents.Value != want {
+		t.Fatalf("unexpected hover:\n%s", hover.Contents.Value)
+	}
+	if hover.Range == nil || *hover.Range != (Range{Start: Position{3, 0}, End: Position{3, 10}}) {
+		t.Fatalf("unexpected hover range %v", hover.Range)
+	}
+}
+
+func TestServer_DocumentSymbols(t *testing.T) {
+	text := "title = \"x\"\n[server]\nhost = \"h\"\nlimits = { cpu = 2 }\n[[peer]]\nname = \"a\"\n[[peer]]\n"
+	got := session(t, open(text), req(1, "textDocument/documentSymbol", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+	}))
+	var syms []DocumentSymbol
+	if err := json.Unmarshal([]byte(toJSON(t, got[1]["result"])), &syms); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	var names []string
+	for _, s := range syms {
+		names = append(names, fmt.Sprintf("%s(%d)", s.Name, len(s.Children)))
+	}
+	if strings.Join(names, " ") != "title(0) server(2) peer(1) peer(0)" {
+		t.Fatalf("unexpected symbols: %v", names)
+	}
+	server := syms[1]
+	if server.Range != (Range{Start: Position{1, 0}, End: Position{3, 20}}) {
+		t.Fatalf("unexpected table range %v", server.Range)
+	}
+	if server.Children[1].Kind != SymbolObject || server.Children[1].Children[0].Name != "cpu" {
+		t.Fatalf("expected inline table to nest its keys")
+	}
+	if syms[3].Detail != "array of tables #1" {
+		t.Fatalf("unexpected detail %q", syms[3].Detail)
+	}
+}
+
+func TestTextIndex_UTF16(t *testing.T) {
+	text := "a = \"😀é\"\nb = 1"
+	x := newTextIndex(text)
+	// 😀 is two UTF-16 units and four bytes; é is one unit and two bytes.
+	off := strings.Index(text, "\"\n")
+	if p := x.position(off); p != (Position{0, 8}) {
+		t.Fatalf("unexpected position %v", p)
+	}
+	if got := x.offset(Position{0, 8}); got != off {
+		t.Fatalf("unexpected offset %d, want %d", got, off)
+	}
+	if got := x.offset(Position{0, 99}); got != strings.Index(text, "\n") {
+		t.Fatalf("expected clamping to line end, got %d", got)
+	}
+	if got := applyChange(text, TextDocumentContentChangeEvent{
+		Range: &Range{Start: Position{1, 4}, End: Position{1, 5}}, Text: "2",
+	}); got != "a = \"😀é\"\nb = 2" {
+		t.Fatalf("unexpected text after change: %q", got)
+	}
+}
+
+func TestServer_FoldingRanges(t *testing.T) {
+	text := "[a]\nx = 1\ny = [\n  1,\n]\n[b]\n"
+	got := session(t, open(text), req(1, "textDocument/foldingRange", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+	}))
+	var ranges []FoldingRange
+	if err := json.Unmarshal([]byte(toJSON(t, got[1]["result"])), &ranges); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if fmt.Sprint(ranges) != "[{0 4} {2 4}]" {
+		t.Fatalf("unexpected folding ranges %v", ranges)
+	}
+}
+
+func TestServer_SemanticTokens(t *testing.T) {
+	text := "[t]\nk = \"é\\n\" # c\ns = \"\"\"\nab\"\"\"\n"
+	got := session(t, open(text), req(1, "textDocument/semanticTokens/full", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+	}))
+	var toks SemanticTokens
+	if err := json.Unmarshal([]byte(toJSON(t, got[1]["result"])), &toks); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := []int{
+		0, 0, 1, 8, 0, // [
+		0, 1, 1, 1, 0, // t
+		0, 1, 1, 8, 0, // ]
+		1, 0, 1, 0, 0, // k
+		0, 2, 1, 8, 0, // =
+		0, 2, 2, 2, 0, // "é
+		0, 2, 2, 3, 0, // \n
+		0, 2, 1, 2, 0, // "
+		0, 2, 3, 7, 0, // # c
+		1, 0, 1, 0, 0, // s
+		0, 2, 1, 8, 0, // =
+		0, 2, 3, 2, 0, // """
+		1, 0, 5, 2, 0, // ab"""
+	}
+	if fmt.Sprint(toks.Data) != fmt.Sprint(want) {
+		t.Fatalf("unexpected tokens\n got %v\nwant %v", toks.Data, want)
+	}
+}
+
+func change(version int, r Range, text string) map[string]any {
+	return note("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": version},
+		"contentChanges": []any{map[string]any{"range": r, "text": text}},
+	})
+}
+
+func TestServer_IncrementalReparse(t *testing.T) {
+	text := "[a]\nx = 1\n\n[b]\ny = 2\n"
+	symbols := req(1, "textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	got := session(t, open(text),
+		change(2, Range{Start: Position{1, 4}, End: Position{1, 5}}, "10"),
+		change(3, Range{Start: Position{4, 0}, End: Position{4, 0}}, "z = 3\n"),
+		symbols,
+	)
+	var syms []DocumentSymbol
+	if err := json.Unmarshal([]byte(toJSON(t, got[3]["result"])), &syms); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(syms) != 2 || len(syms[1].Children) != 2 || syms[1].Children[0].Name != "z" {
+		t.Fatalf("unexpected symbols after edits: %s", toJSON(t, syms))
+	}
+	if syms[1].Range.End != (Position{5, 5}) {
+		t.Fatalf("unexpected range %v", syms[1].Range)
+	}
+}
+
+func TestServer_StaleResultsCleared(t *testing.T) {
+	params := map[string]any{"textDocument": map[string]any{"uri": uri}, "position": Position{Line: 0, Character: 0}}
+	got := session(t, open("a = 1\n"),
+		change(2, Range{Start: Position{0, 4}, End: Position{0, 5}}, ""),
+		req(1, "textDocument/hover", params),
+		req(2, "textDocument/documentSymbol", params),
+		change(3, Range{Start: Position{0, 4}, End: Position{0, 4}}, "2"),
+		req(3, "textDocument/hover", params),
+	)
+	if got[2]["result"] != nil {
+		t.Fatalf("expected no hover while the text does not parse, got %s", toJSON(t, got[2]["result"]))
+	}
+	if s := toJSON(t, got[3]["result"]); s != "[]" {
+		t.Fatalf("expected no symbols while the text does not parse, got %s", s)
+	}
+	if s := toJSON(t, got[5]["result"]); !strings.Contains(s, "integer") {
+		t.Fatalf("expected hover once the text parses again, got %s", s)
+	}
+}
+
+func TestServer_Formatting(t *testing.T) {
+	text := "a=0xff\n\n\n\n[t]  # c\n  b   =  +1\n"
+	params := map[string]any{"textDocument": map[string]any{"uri": uri}, "options": map[string]any{"tabSize": 2}}
+	got := session(t, open(text), req(1, "textDocument/formatting", params))
+	var edits []TextEdit
+	if err := json.Unmarshal([]byte(toJSON(t, got[1]["result"])), &edits); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(edits) != 1 || edits[0].Range != (Range{End: Position{6, 0}}) {
+		t.Fatalf("expected one edit of the whole document, got %v", edits)
+	}
+	if want := "a = 0xff\n\n[t]  # c\n  b = 1\n"; edits[0].NewText != want {
+		t.Fatalf("formatted as %q, want %q", edits[0].NewText, want)
+	}
+
+	got = session(t, open(edits[0].NewText), req(1, "textDocument/formatting", params))
+	if s := toJSON(t, got[1]["result"]); s != "[]" {
+		t.Fatalf("expected no edits for a formatted document, got %s", s)
+	}
+}
+
+func TestServer_RequestsAfterShutdown(t *testing.T) {
+	got := session(t,
+		req(1, "shutdown", nil),
+		open("a = 1\n"),
+		req(2, "textDocument/hover", map[string]any{"textDocument": map[string]any{"uri": uri}}),
+		note("exit", nil),
+	)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 responses and no diagnostics, got %d", len(got))
+	}
+	if s := toJSON(t, got[1]["error"]); !strings.Contains(s, fmt.Sprint(codeInvalidRequest)) {
+		t.Fatalf("expected an invalid request error, got %s", s)
+	}
+}
@@ -0,0 +1,111 @@
+package lsp
+
+import (
+	"strconv"
+
+	"github.com/maurice/toml"
+)
+
+func (s *Server) symbols(p DocumentSymbolParams) []DocumentSymbol {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []DocumentSymbol{}
+	f := s.current(p.TextDocument.URI)
+	if f == nil {
+		return out
+	}
+	b := symbolBuilder{spans: f.doc.Spans(), idx: f.index, aots: make(map[string]int)}
+	for i := range f.doc.Len() {
+		if sym, ok := b.topLevel(f.doc.Node(i)); ok {
+			out = append(out, sym)
+		}
+	}
+	return out
+}
+
+type symbolBuilder struct {
+	spans map[toml.Node]toml.Span
+	idx   *textIndex
+	aots  map[string]int // entries seen per array-of-tables path
+}
+
+func (b *symbolBuilder) topLevel(n toml.Node) (DocumentSymbol, bool) {
+	switch v := n.(type) {
+	case *toml.KeyValue:
+		return b.keyValue(v), true
+	case *toml.TableNode:
+		name := joinKey(v.HeaderParts())
+		return b.section(v, name, "table", SymbolNamespace, v.Entries()), true
+	case *toml.ArrayOfTables:
+		name := joinKey(v.HeaderParts())
+		i := b.aots[name]
+		b.aots[name]++
+		return b.section(v, name, "array of tables #"+strconv.Itoa(i), SymbolArray, v.Entries()), true
+	}
+	return DocumentSymbol{}, false
+}
+
+// section builds the symbol for a table header whose range extends over
+// its entries.
+func (b *symbolBuilder) section(n toml.Node, name, detail string, kind SymbolKind, entries []toml.Node) DocumentSymbol {
+	hdr := b.spans[n]
+	end := hdr.End
+	var children []DocumentSymbol
+	for _, e := range entries {
+		if kv, ok := e.(*toml.KeyValue); ok {
+			children = append(children, b.keyValue(kv))
+			end = max(end, b.spans[kv].End)
+		}
+	}
+	return DocumentSymbol{
+		Name:           name,
+		Detail:         detail,
+		Kind:           kind,
+		Range:          b.idx.rangeOf(hdr.Start, end),
+		SelectionRange: b.idx.rangeOf(hdr.Start, hdr.End),
+		Children:       children,
+	}
+}
+
+func (b *symbolBuilder) keyValue(kv *toml.KeyValue) DocumentSymbol {
+	sp := b.spans[kv]
+	sym := DocumentSymbol{
+		Name:           joinKey(kv.KeyParts()),
+		Detail:         valueType(kv.Val()),
+		Kind:           SymbolProperty,
+		Range:          b.idx.rangeOf(sp.Start, sp.End),
+		SelectionRange: b.idx.rangeOf(sp.Start, sp.Start+len(kv.RawKey())),
+	}
+	switch v := kv.Val().(type) {
+	case *toml.InlineTableNode:
+		sym.Kind = SymbolObject
+		for e := range v.EntriesSeq() {
+			sym.Children = append(sym.Children, b.keyValue(e))
+		}
+	case *toml.ArrayNode:
+		sym.Kind = SymbolArray
+	}
+	return sym
+}
+
+func (s *Server) folding(p FoldingRangeParams) []FoldingRange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []FoldingRange{}
+	f := s.current(p.TextDocument.URI)
+	if f == nil {
+		return out
+	}
+	var walk func(secs []*toml.Section)
+	walk = func(secs []*toml.Section) {
+		for _, sec := range secs {
+			start, end := f.index.position(sec.Span.Start).Line, f.index.position(sec.Span.End).Line
+			if end > start {
+				out = append(out, FoldingRange{StartLine: start, EndLine: end})
+			}
+			walk(sec.Children)
+		}
+	}
+	walk(f.doc.Outline())
+	return out
+}
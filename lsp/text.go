@@ -0,0 +1,89 @@
+package lsp
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// textIndex converts between byte offsets and LSP positions, which count
+// UTF-16 code units within a line.
+type textIndex struct {
+	text   string
+	starts []int // byte offset of the start of each line
+}
+
+func newTextIndex(text string) *textIndex {
+	starts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return &textIndex{text: text, starts: starts}
+}
+
+// position converts a byte offset into a position.
+func (x *textIndex) position(off int) Position {
+	off = max(0, min(off, len(x.text)))
+	line := sort.Search(len(x.starts), func(i int) bool { return x.starts[i] > off }) - 1
+	return Position{Line: line, Character: utf16Len(x.text[x.starts[line]:off])}
+}
+
+// rangeOf converts a byte span into a range.
+func (x *textIndex) rangeOf(start, end int) Range {
+	return Range{Start: x.position(start), End: x.position(end)}
+}
+
+// offset converts a position into a byte offset. Positions past the end of
+// a line or of the document are clamped.
+func (x *textIndex) offset(p Position) int {
+	if p.Line < 0 {
+		return 0
+	}
+	if p.Line >= len(x.starts) {
+		return len(x.text)
+	}
+	off := x.starts[p.Line]
+	end := len(x.text)
+	if p.Line+1 < len(x.starts) {
+		end = x.starts[p.Line+1] - 1
+	}
+	for units := 0; off < end && units < p.Character; {
+		r, size := utf8.DecodeRuneInString(x.text[off:end])
+		units += utf16.RuneLen(r)
+		off += size
+	}
+	return off
+}
+
+// lineEnd returns the byte offset of the end of the line containing off,
+// excluding the line terminator.
+func (x *textIndex) lineEnd(off int) int {
+	if i := strings.IndexAny(x.text[off:], "\r\n"); i >= 0 {
+		return off + i
+	}
+	return len(x.text)
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// applyChange returns text with the edit applied.
+func applyChange(text string, ch TextDocumentContentChangeEvent) string {
+	if ch.Range == nil {
+		return ch.Text
+	}
+	x := newTextIndex(text)
+	start, end := x.offset(ch.Range.Start), x.offset(ch.Range.End)
+	if end < start {
+		start, end = end, start
+	}
+	return text[:start] + ch.Text + text[end:]
+}
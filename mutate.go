@@ -3,7 +3,10 @@ package toml
 import (
 	"fmt"
 	"math"
+	"slices"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // --- Validation helpers ---
@@ -45,7 +48,7 @@ func validateValueType(val Node) error {
 		return ErrNilValue
 	}
 	switch val.(type) {
-	case *StringNode, *NumberNode, *BooleanNode, *DateTimeNode, *ArrayNode, *InlineTableNode:
+	case *StringNode, *NumberNode, *BooleanNode, *DateTimeNode, *ArrayNode, *InlineTableNode, Extension:
 		return nil
 	default:
 		return fmt.Errorf("%w: %T; expected string, number, bool, datetime, array, or inline table", ErrInvalidValueType, val)
@@ -109,12 +112,12 @@ func escapeDefaultRune(b *strings.Builder, r rune) {
 // NewString creates a new StringNode with the given Go string value,
 // properly escaped and quoted for TOML.
 func NewString(s string) *StringNode {
-	return &StringNode{leafNode: newLeaf(NodeString, `"`+escapeBasicString(s)+`"`)}
+	return &StringNode{leafNode: newLeaf(`"` + escapeBasicString(s) + `"`)}
 }
 
 // NewInteger creates a new NumberNode with a decimal integer representation.
 func NewInteger(v int64) *NumberNode {
-	return &NumberNode{leafNode: newLeaf(NodeNumber, fmt.Sprintf("%d", v))}
+	return &NumberNode{leafNode: newLeaf(fmt.Sprintf("%d", v))}
 }
 
 // NewFloat creates a new NumberNode with a float representation.
@@ -134,7 +137,7 @@ func NewFloat(v float64) *NumberNode {
 			text += ".0"
 		}
 	}
-	return &NumberNode{leafNode: newLeaf(NodeNumber, text)}
+	return &NumberNode{leafNode: newLeaf(text)}
 }
 
 // NewBool creates a new BooleanNode.
@@ -143,7 +146,7 @@ func NewBool(v bool) *BooleanNode {
 	if v {
 		text = "true"
 	}
-	return &BooleanNode{leafNode: newLeaf(NodeBoolean, text)}
+	return &BooleanNode{leafNode: newLeaf(text)}
 }
 
 // NewKeyValue creates a new KeyValue node with standard formatting (key = val\n).
@@ -153,12 +156,14 @@ func NewKeyValue(rawKey string, val Node) (*KeyValue, error) {
 	if err := validateValueType(val); err != nil {
 		return nil, err
 	}
+	if err := checkAttachable(val); err != nil {
+		return nil, err
+	}
 	parts, keyRaw, err := parseRawKey(rawKey)
 	if err != nil {
 		return nil, fmt.Errorf("invalid key: %w", err)
 	}
 	kv := &KeyValue{
-		baseNode: baseNode{nodeType: NodeKeyValue},
 		keyParts: parts,
 		rawKey:   keyRaw,
 		preEq:    " ",
@@ -171,6 +176,93 @@ func NewKeyValue(rawKey string, val Node) (*KeyValue, error) {
 	return kv, nil
 }
 
+// KeyValueOptions describes a key-value line for NewKeyValueFull. The
+// string fields are used verbatim; start from DefaultKeyValueOptions to get
+// the formatting NewKeyValue uses.
+type KeyValueOptions struct {
+	Key   string // raw key expression, as for NewKeyValue
+	Value Node
+
+	// LeadingTrivia holds the comment and whitespace nodes on the lines
+	// above the key. If non-empty it must end with a newline, optionally
+	// followed by indentation.
+	LeadingTrivia []Node
+
+	// TrailingComment is the text of a comment at the end of the line,
+	// without the leading "# ". It is written after CommentSpace.
+	TrailingComment string
+	CommentSpace    string
+
+	PreEq   string // whitespace between the key and =
+	PostEq  string // whitespace between = and the value
+	Newline string // "", "\n", or "\r\n"
+}
+
+// DefaultKeyValueOptions returns options that produce "key = val\n" with
+// one space before a trailing comment.
+func DefaultKeyValueOptions(key string, val Node) KeyValueOptions {
+	return KeyValueOptions{Key: key, Value: val, CommentSpace: " ", PreEq: " ", PostEq: " ", Newline: "\n"}
+}
+
+// NewKeyValueFull creates a KeyValue with its trivia and whitespace set in
+// one call. Every field is validated before anything is attached, so on
+// error neither the value nor the trivia nodes are modified.
+func NewKeyValueFull(opts KeyValueOptions) (*KeyValue, error) {
+	trailing, err := opts.validate()
+	if err != nil {
+		return nil, err
+	}
+	kv, err := NewKeyValue(opts.Key, opts.Value)
+	if err != nil {
+		return nil, err
+	}
+	kv.preEq, kv.postEq, kv.newline = opts.PreEq, opts.PostEq, opts.Newline
+	kv.lineTrivia = newLineTrivia(append([]Node(nil), opts.LeadingTrivia...), trailing)
+	adoptTrivia(kv, kv.leading())
+	adoptTrivia(kv, kv.trailing())
+	return kv, nil
+}
+
+// validate checks the options that NewKeyValue does not and returns the
+// trailing trivia nodes.
+func (o *KeyValueOptions) validate() ([]Node, error) {
+	if !isHorizWhitespace(o.PreEq) || !isHorizWhitespace(o.PostEq) || !isHorizWhitespace(o.CommentSpace) {
+		return nil, ErrInvalidWhitespace
+	}
+	if !isValidNewline(o.Newline) {
+		return nil, ErrInvalidNewline
+	}
+	if err := validateTriviaNodes(o.LeadingTrivia); err != nil {
+		return nil, err
+	}
+	lineStart := true // the key starts a fresh line
+	for _, n := range o.LeadingTrivia {
+		if err := checkAttachable(n); err != nil {
+			return nil, err
+		}
+		switch {
+		case n.Type() == NodeComment:
+			lineStart = false
+		case strings.Contains(n.Text(), "\n"):
+			lineStart = true
+		}
+	}
+	if !lineStart {
+		return nil, fmt.Errorf("%w: leading trivia must end with a newline", ErrInvalidTrivia)
+	}
+	if o.TrailingComment == "" {
+		return nil, nil
+	}
+	c, err := NewComment("# " + o.TrailingComment)
+	if err != nil {
+		return nil, err
+	}
+	if o.CommentSpace == "" {
+		return []Node{c}, nil
+	}
+	return []Node{&WhitespaceNode{leafNode: newLeaf(o.CommentSpace)}, c}, nil
+}
+
 // NewTable creates a new TableNode.
 // The rawKey is validated as a TOML key expression (bare, quoted, or dotted)
 // and stored verbatim as the header content between [ and ].
@@ -180,7 +272,6 @@ func NewTable(rawKey string) (*TableNode, error) {
 		return nil, fmt.Errorf("invalid table key: %w", err)
 	}
 	return &TableNode{
-		baseNode:    baseNode{nodeType: NodeTable},
 		rawHeader:   rawKey,
 		headerParts: parts,
 		newline:     "\n",
@@ -196,7 +287,6 @@ func NewArrayOfTables(rawKey string) (*ArrayOfTables, error) {
 		return nil, fmt.Errorf("invalid array-of-tables key: %w", err)
 	}
 	return &ArrayOfTables{
-		baseNode:    baseNode{nodeType: NodeArrayOfTables},
 		rawHeader:   rawKey,
 		headerParts: parts,
 		newline:     "\n",
@@ -210,7 +300,7 @@ func NewDateTime(s string) (*DateTimeNode, error) {
 	if msg := validateDateTimeText(s); msg != "" {
 		return nil, fmt.Errorf("%w: %s", ErrInvalidDateTime, msg)
 	}
-	return &DateTimeNode{leafNode: newLeaf(NodeDateTime, s)}, nil
+	return &DateTimeNode{leafNode: newLeaf(s)}, nil
 }
 
 // NewArray creates a new ArrayNode with the given elements.
@@ -224,10 +314,12 @@ func NewArray(elements ...Node) (*ArrayNode, error) {
 	elems := make([]Node, len(elements))
 	copy(elems, elements)
 	a := &ArrayNode{
-		baseNode: baseNode{nodeType: NodeArray},
 		elements: elems,
 	}
-	a.text = generateArrayText(a.elements)
+	for _, elem := range elems {
+		setValueParent(elem, a)
+	}
+	a.regenerateText()
 	return a, nil
 }
 
@@ -241,63 +333,177 @@ func NewInlineTable(entries ...*KeyValue) (*InlineTableNode, error) {
 	}
 	seen := make(map[string]bool)
 	for _, kv := range entries {
-		path := keyPartsToPath(kv.keyParts)
-		if seen[path] {
-			return nil, fmt.Errorf("%w: %q in inline table", ErrDuplicateKey, path)
+		key := pathKey(kv.keyParts)
+		if seen[key] {
+			return nil, fmt.Errorf("%w: %q in inline table", ErrDuplicateKey, JoinPath(partsToSegs(kv.keyParts)...))
 		}
-		seen[path] = true
+		seen[key] = true
 		for i := 1; i < len(kv.keyParts); i++ {
-			prefix := keyPartsToPath(kv.keyParts[:i])
-			if seen[prefix] {
-				return nil, fmt.Errorf("%w: %q in inline table", ErrKeyConflict, prefix)
+			if seen[pathKey(kv.keyParts[:i])] {
+				return nil, fmt.Errorf("%w: %q in inline table", ErrKeyConflict, JoinPath(partsToSegs(kv.keyParts[:i])...))
 			}
 		}
 	}
 	kvs := make([]*KeyValue, len(entries))
 	copy(kvs, entries)
 	n := &InlineTableNode{
-		baseNode: baseNode{nodeType: NodeInlineTable},
-		entries:  kvs,
+		entries: kvs,
 	}
 	for _, kv := range kvs {
 		kv.setParent(n)
 	}
-	n.text = generateInlineTableText(n.entries)
+	n.regenerateText()
 	return n, nil
 }
 
-// generateArrayText produces the TOML text for an array from its elements.
-func generateArrayText(elements []Node) string {
+// parseValueText parses the TOML text of a single value, such as `8080`,
+// `"s3"`, or `[1, 2]`, and returns it unattached. It returns the parse
+// error, or an error wrapping ErrTypeMismatch if text is not one value.
+func parseValueText(text string) (Node, error) {
+	doc, err := Parse([]byte("v = " + text))
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.nodes) != 1 {
+		return nil, fmt.Errorf("%w: %q is not a single value", ErrTypeMismatch, text)
+	}
+	kv, ok := doc.nodes[0].(*KeyValue)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q is not a single value", ErrTypeMismatch, text)
+	}
+	val := kv.val
+	setValueParent(val, nil)
+	return val, nil
+}
+
+// regenerateText re-renders the array from its elements, reusing the
+// separators captured at parse time so the original layout survives edits.
+func (a *ArrayNode) regenerateText() {
+	items := make([]string, len(a.elements))
+	for i, elem := range a.elements {
+		items[i] = elem.Text()
+	}
+	a.text = renderContainer("[", "]", items, a.seps)
+}
+
+// regenerateText re-renders the inline table from its entries, reusing the
+// separators captured at parse time so the original layout survives edits.
+func (n *InlineTableNode) regenerateText() {
+	items := make([]string, len(n.entries))
+	for i, kv := range n.entries {
+		items[i] = kv.Text()
+	}
+	n.text = renderContainer("{", "}", items, n.seps)
+}
+
+// renderContainer joins items between open and closing delimiters. When seps
+// holds one separator per gap (len(items)+1) they are interleaved verbatim;
+// otherwise items are joined with ", ".
+func renderContainer(open, closing string, items, seps []string) string {
 	var b strings.Builder
-	b.WriteByte('[')
-	for i, elem := range elements {
-		if i > 0 {
+	b.WriteString(open)
+	exact := len(seps) == len(items)+1
+	for i, item := range items {
+		switch {
+		case exact:
+			b.WriteString(seps[i])
+		case i > 0:
 			b.WriteString(", ")
 		}
-		b.WriteString(elem.Text())
+		b.WriteString(item)
 	}
-	b.WriteByte(']')
+	if exact {
+		b.WriteString(seps[len(items)])
+	}
+	b.WriteString(closing)
 	return b.String()
 }
 
-// generateInlineTableText produces the TOML text for an inline table from its entries.
-func generateInlineTableText(entries []*KeyValue) string {
-	var b strings.Builder
-	b.WriteByte('{')
-	for i, kv := range entries {
-		if i > 0 {
-			b.WriteString(", ")
+// growSeps adds the separator for an item appended to a container with
+// len(seps)-1 items. The new separator copies the line layout of an existing
+// one (without any comments) so multi-line containers stay multi-line. A
+// comment after the old last item stays on that item's line, and an empty
+// container that spans lines gets the item on a line of its own.
+func growSeps(seps []string) []string {
+	n := len(seps) - 1
+	if n < 0 {
+		return nil
+	}
+	head, rest := splitLine(seps[n])
+	if n == 0 {
+		if rest == "" {
+			return nil
 		}
-		b.WriteString(kv.rawKey)
-		b.WriteString(kv.preEq)
-		b.WriteByte('=')
-		b.WriteString(kv.postEq)
-		if kv.val != nil {
-			b.WriteString(kv.val.Text())
+		indent := rest[strings.LastIndexByte(rest, '\n')+1:] + "  "
+		return []string{head + lineBreak(rest) + indent, rest}
+	}
+	sample := seps[0]
+	if n >= 2 {
+		sample = seps[n-1]
+	}
+	sep, last := ", ", seps[n]
+	if i := strings.LastIndexByte(sample, '\n'); i >= 0 {
+		nl := "\n"
+		if i > 0 && sample[i-1] == '\r' {
+			nl = "\r\n"
+		}
+		indent := sample[i+1:]
+		sep = "," + nl + indent
+		if rest != "" {
+			// Keep what follows the old last item on its line, such as
+			// its comment, before the new line.
+			if strings.HasPrefix(strings.TrimLeft(head, " \t"), ",") {
+				sep, last = head+nl+indent, ","+rest
+			} else {
+				sep, last = ","+head+nl+indent, rest
+			}
 		}
 	}
-	b.WriteByte('}')
-	return b.String()
+	out := make([]string, 0, n+2)
+	out = append(out, seps[:n]...)
+	return append(out, sep, last)
+}
+
+// splitLine splits s before its first line break.
+func splitLine(s string) (head, rest string) {
+	i := strings.IndexByte(s, '\n')
+	if i < 0 {
+		return s, ""
+	}
+	if i > 0 && s[i-1] == '\r' {
+		i--
+	}
+	return s[:i], s[i:]
+}
+
+// lineBreak returns the line break that s starts with.
+func lineBreak(s string) string {
+	if strings.HasPrefix(s, "\r\n") {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// firstLineBreak returns the line break that ends the first line of text,
+// or "\n" if it has none.
+func firstLineBreak(text string) string {
+	_, rest := splitLine(text)
+	return lineBreak(rest)
+}
+
+// shrinkSeps removes the separator belonging to item i of a container with
+// len(seps)-1 items. Containers that become empty revert to canonical text.
+func shrinkSeps(seps []string, i int) []string {
+	n := len(seps) - 1
+	if n <= 1 || i < 0 || i >= n {
+		return nil
+	}
+	if i == 0 {
+		i = 1 // keep the leading text after the opening delimiter
+	}
+	out := make([]string, 0, n)
+	out = append(out, seps[:i]...)
+	return append(out, seps[i+1:]...)
 }
 
 // --- Parent tracking helpers ---
@@ -315,6 +521,15 @@ func setNodeParent(n Node, parent Node) {
 		v.setParent(parent)
 	case *WhitespaceNode:
 		v.setParent(parent)
+	case *RawNode:
+		v.setParent(parent)
+	}
+}
+
+// adoptTrivia sets parent as the parent of each trivia node.
+func adoptTrivia(parent Node, nodes []Node) {
+	for _, n := range nodes {
+		setNodeParent(n, parent)
 	}
 }
 
@@ -336,6 +551,8 @@ func setValueParent(n Node, parent Node) {
 		v.setParent(parent)
 	case *DateTimeNode:
 		v.setParent(parent)
+	case Extension:
+		v.SetParent(parent)
 	}
 }
 
@@ -350,24 +567,30 @@ func findDocument(n Node) *Document {
 	return nil
 }
 
-// localDuplicateCheck checks for duplicate keys within a slice of entries.
+// localDuplicateCheck checks for duplicate keys within a slice of entries,
+// and for a key set both as a value and as a table of dotted keys.
 func localDuplicateCheck(entries []Node) error {
 	seen := make(map[string]bool)
+	tables := make(map[string]bool)
 	for _, e := range entries {
 		kv, ok := e.(*KeyValue)
 		if !ok {
 			continue
 		}
-		path := keyPartsToPath(kv.keyParts)
-		if seen[path] {
-			return fmt.Errorf("%w: %q", ErrDuplicateKey, path)
+		key := pathKey(kv.keyParts)
+		if seen[key] {
+			return fmt.Errorf("%w: %q", ErrDuplicateKey, JoinPath(partsToSegs(kv.keyParts)...))
 		}
-		seen[path] = true
+		if tables[key] {
+			return fmt.Errorf("%w: %q", ErrKeyConflict, JoinPath(partsToSegs(kv.keyParts)...))
+		}
+		seen[key] = true
 		for i := 1; i < len(kv.keyParts); i++ {
-			prefix := keyPartsToPath(kv.keyParts[:i])
+			prefix := pathKey(kv.keyParts[:i])
 			if seen[prefix] {
-				return fmt.Errorf("%w: %q", ErrKeyConflict, prefix)
+				return fmt.Errorf("%w: %q", ErrKeyConflict, JoinPath(partsToSegs(kv.keyParts[:i])...))
 			}
+			tables[prefix] = true
 		}
 	}
 	return nil
@@ -378,27 +601,79 @@ func localDuplicateCheck(entries []Node) error {
 // SetValue updates the value of a KeyValue node.
 // Returns an error if val is nil or not a valid TOML value type.
 // If the KeyValue is inside an InlineTableNode or ArrayNode, the ancestor's
-// text representation is regenerated.
+// text representation is regenerated. A trailing comment keeps the spaces
+// before it, and gains one if it had none.
 func (kv *KeyValue) SetValue(val Node) error {
 	if err := validateValueType(val); err != nil {
 		return err
 	}
+	if val != kv.val {
+		if err := checkAttachable(val); err != nil {
+			return err
+		}
+		setValueParent(kv.val, nil)
+	}
 	kv.val = val
 	kv.rawVal = val.Text()
 	setValueParent(val, kv)
+	if len(kv.trailing()) > 0 && kv.trailing()[0].Type() == NodeComment {
+		ws := &WhitespaceNode{leafNode: newLeaf(" ")}
+		ws.setParent(kv)
+		kv.setTrailing(slices.Insert(kv.trailing(), 0, Node(ws)))
+	}
 	regenerateAncestorText(kv)
 	return nil
 }
 
+// SetValueAligned is SetValue that also keeps a trailing comment at the
+// column it started at, by adding or removing spaces before it, so that
+// comments aligned across lines stay aligned. If the new value reaches
+// that column, one space is left. Whitespace containing tabs is kept as
+// is.
+func (kv *KeyValue) SetValueAligned(val Node) error {
+	col := kv.trailingCommentColumn()
+	if err := kv.SetValue(val); err != nil {
+		return err
+	}
+	if col > 0 {
+		pad := max(1, col-lastLineWidth(kv.Text()))
+		kv.trailing()[0] = &WhitespaceNode{leafNode: newLeaf(strings.Repeat(" ", pad))}
+		setNodeParent(kv.trailing()[0], kv)
+	}
+	return nil
+}
+
+// trailingCommentColumn returns the width, in runes from the start of the
+// key, of the text before a trailing comment that follows spaces, or 0.
+func (kv *KeyValue) trailingCommentColumn() int {
+	tt := kv.trailing()
+	if len(tt) < 2 || tt[1].Type() != NodeComment || strings.Trim(tt[0].Text(), " ") != "" {
+		return 0
+	}
+	return lastLineWidth(kv.Text()) + len(tt[0].Text())
+}
+
+// lastLineWidth returns the number of runes in the last line of s.
+func lastLineWidth(s string) int {
+	return utf8.RuneCountInString(s[strings.LastIndexByte(s, '\n')+1:])
+}
+
 // regenerateAncestorText walks up the parent chain and regenerates text
-// for any InlineTableNode or ArrayNode ancestors.
+// for any InlineTableNode or ArrayNode ancestors, refreshing the raw value
+// of the KeyValue nodes that hold them.
 func regenerateAncestorText(n Node) {
 	for p := n.Parent(); p != nil; p = p.Parent() {
 		switch v := p.(type) {
 		case *InlineTableNode:
-			v.text = generateInlineTableText(v.entries)
+			v.regenerateText()
 		case *ArrayNode:
-			v.text = generateArrayText(v.elements)
+			v.regenerateText()
+		case *KeyValue:
+			if v.val != nil {
+				v.rawVal = v.val.Text()
+			}
+		case *Document:
+			v.changed()
 		}
 	}
 }
@@ -406,18 +681,46 @@ func regenerateAncestorText(n Node) {
 // --- Document mutation ---
 
 // Delete removes the first KeyValue matching the dotted path from the document.
-// Returns true if a key was found and removed.
-func (d *Document) Delete(path string) bool {
-	segs := parseDottedPath(path)
+// Returns the removed key-value and true if a key was found, so it can be
+// logged or attached elsewhere, and nil and false otherwise. The path may
+// select entries of arrays of tables, as described on Get.
+func (d *Document) Delete(path string) (*KeyValue, bool) {
+	return d.DeleteWithOptions(path, DeleteOptions{})
+}
 
+// detachKeyValue detaches kv, if any, and returns it as Delete does.
+func detachKeyValue(kv *KeyValue) (*KeyValue, bool) {
+	if kv == nil || !kv.Detach() {
+		return nil, false
+	}
+	return kv, true
+}
+
+// deleteTarget returns the key-value Delete removes for path, or nil.
+func (d *Document) deleteTarget(path string) *KeyValue {
+	if strings.ContainsRune(path, '[') {
+		if steps, ok := parsePathSteps(path); ok {
+			return d.getIndexed(steps)
+		}
+	}
+	return d.deleteSegsTarget(parseDottedPath(path))
+}
+
+func (d *Document) deleteSegsTarget(segs []string) *KeyValue {
 	// Check top-level KVs.
 	if idx := findTopLevelKV(d.nodes, segs); idx >= 0 {
-		d.nodes = append(d.nodes[:idx], d.nodes[idx+1:]...)
-		return true
+		return d.nodes[idx].(*KeyValue)
 	}
 
 	// Check inside tables.
-	return d.deleteFromTables(segs)
+	for prefixLen := len(segs) - 1; prefixLen >= 1; prefixLen-- {
+		for _, n := range d.nodes {
+			if kv := findInSection(n, segs[:prefixLen], segs[prefixLen:]); kv != nil {
+				return kv
+			}
+		}
+	}
+	return nil
 }
 
 func findTopLevelKV(nodes []Node, segs []string) int {
@@ -431,46 +734,225 @@ func findTopLevelKV(nodes []Node, segs []string) int {
 	return -1
 }
 
-func (d *Document) deleteFromTables(segs []string) bool {
-	for prefixLen := len(segs) - 1; prefixLen >= 1; prefixLen-- {
-		tableSegs := segs[:prefixLen]
-		keySegs := segs[prefixLen:]
-		for _, n := range d.nodes {
-			if deleteFromTableNode(n, tableSegs, keySegs) {
-				return true
-			}
-		}
-	}
-	return false
-}
-
-func deleteFromTableNode(n Node, tableSegs, keySegs []string) bool {
+// findInSection returns the key-value at keySegs among the direct entries
+// of n, if n is the table or array-of-tables entry at tableSegs.
+func findInSection(n Node, tableSegs, keySegs []string) *KeyValue {
+	var entries []Node
 	switch t := n.(type) {
 	case *TableNode:
-		if matchKeyParts(t.headerParts, tableSegs) {
-			return deleteFromEntries(&t.entries, keySegs)
+		if !matchKeyParts(t.headerParts, tableSegs) {
+			return nil
 		}
+		entries = t.entries
 	case *ArrayOfTables:
-		if matchKeyParts(t.headerParts, tableSegs) {
-			return deleteFromEntries(&t.entries, keySegs)
+		if !matchKeyParts(t.headerParts, tableSegs) {
+			return nil
 		}
+		entries = t.entries
 	}
-	return false
+	for kv := range keyValuesSeq(entries) {
+		if matchKeyParts(kv.keyParts, keySegs) {
+			return kv
+		}
+	}
+	return nil
 }
 
 // DeleteTable removes the first TableNode matching the header path.
-// Returns true if a table was found and removed.
-func (d *Document) DeleteTable(path string) bool {
+// Returns the removed table, with its entries, and true if one was found,
+// and nil and false otherwise.
+func (d *Document) DeleteTable(path string) (*TableNode, bool) {
+	return d.DeleteTableWithOptions(path, DeleteOptions{})
+}
+
+// DeleteTree removes the table at path together with everything under it:
+// its header, the headers of its subtables and of arrays of tables below
+// it, and dotted keys in the root or in parent tables that define values
+// under it. Deleting "server" also removes [server.tls],
+// [[server.listeners]], and server.port = 80 in the root. Values inside
+// inline tables are left alone. The document is validated afterwards, and
+// if it is not valid nothing is removed. Returns the number of headers and
+// key-values removed.
+func (d *Document) DeleteTree(path string) int {
 	segs := parseDottedPath(path)
-	for i, n := range d.nodes {
-		if t, ok := n.(*TableNode); ok {
-			if matchKeyParts(t.headerParts, segs) {
-				d.nodes = append(d.nodes[:i], d.nodes[i+1:]...)
-				return true
+	if len(segs) == 0 {
+		return 0
+	}
+	snap := d.snapshotStructure()
+	removed := 0
+	d.nodes = slices.DeleteFunc(d.nodes, func(n Node) bool {
+		var under bool
+		switch v := n.(type) {
+		case *KeyValue:
+			under = isPrefix(segs, partsToSegs(v.keyParts))
+		case *TableNode:
+			under = isPrefix(segs, partsToSegs(v.headerParts))
+			if !under {
+				removed += deleteUnder(&v.entries, partsToSegs(v.headerParts), segs)
 			}
+		case *ArrayOfTables:
+			under = isPrefix(segs, partsToSegs(v.headerParts))
 		}
+		if under {
+			setNodeParent(n, nil)
+			removed++
+		}
+		return under
+	})
+	if removed == 0 {
+		return 0
 	}
-	return false
+	if err := d.validateMutation(); err != nil {
+		snap.restore()
+		return 0
+	}
+	return removed
+}
+
+// deleteUnder removes the key-values among entries of the table at prefix
+// that lie under segs, and returns how many it removed.
+func deleteUnder(entries *[]Node, prefix, segs []string) int {
+	if !isPrefix(prefix, segs) {
+		return 0
+	}
+	n := len(*entries)
+	*entries = slices.DeleteFunc(*entries, func(e Node) bool {
+		kv, ok := e.(*KeyValue)
+		if !ok || !isPrefix(segs, append(slices.Clone(prefix), partsToSegs(kv.keyParts)...)) {
+			return false
+		}
+		kv.setParent(nil)
+		return true
+	})
+	return n - len(*entries)
+}
+
+// DeleteAOTEntry removes the entry at index of the array of tables at
+// path, counting from zero in document order, or from the end if index is
+// negative. The entry's subtables go with it, as do the comments directly
+// above its header; comments separated from the header by a blank line,
+// and the blank lines between sections, are kept. Returns true if an
+// entry was removed.
+func (d *Document) DeleteAOTEntry(path string, index int) bool {
+	entries := d.ArrayOfTables(path)
+	if index < 0 {
+		index += len(entries)
+	}
+	if index < 0 || index >= len(entries) {
+		return false
+	}
+	d.deleteSection(entries[index])
+	return true
+}
+
+// DeleteAOTAll removes every entry of the array of tables at path, as
+// DeleteAOTEntry does, and returns the number removed.
+func (d *Document) DeleteAOTAll(path string) int {
+	entries := d.ArrayOfTables(path)
+	for _, a := range entries {
+		d.deleteSection(a)
+	}
+	return len(entries)
+}
+
+// deleteSection removes the top-level header n and the subtable headers
+// that follow it, keeping the part of its leading trivia that is detached
+// from it by a blank line.
+func (d *Document) deleteSection(n Node) {
+	i := slices.Index(d.nodes, n)
+	segs := partsToSegs(sectionParts(n))
+	end := i + 1
+	for end < len(d.nodes) {
+		sub := partsToSegs(sectionParts(d.nodes[end]))
+		if len(sub) <= len(segs) || !isPrefix(segs, sub) {
+			break
+		}
+		end++
+	}
+	keep := detachedTrivia(lineTriviaOf(n).leading())
+	for _, r := range d.nodes[i:end] {
+		setNodeParent(r, nil)
+	}
+	d.nodes = slices.Delete(d.nodes, i, end)
+	keepTrivia(d, &d.nodes, i, keep)
+	d.changed()
+}
+
+// sectionParts returns the header key of a table or array-of-tables entry,
+// or nil for other nodes.
+func sectionParts(n Node) []KeyPart {
+	switch v := n.(type) {
+	case *TableNode:
+		return v.headerParts
+	case *ArrayOfTables:
+		return v.headerParts
+	}
+	return nil
+}
+
+// detachedTrivia returns the leading part of trivia up to and including
+// its last blank line: the comments and spacing that do not belong to the
+// node the trivia leads.
+func detachedTrivia(trivia []Node) []Node {
+	end := 0
+	for i := range trivia {
+		if isBlankLine(trivia, i) {
+			end = i + 1
+		}
+	}
+	return slices.Clone(trivia[:end])
+}
+
+// isBlankLine reports whether trivia[i] is an empty line, rather than the
+// end of a comment's line.
+func isBlankLine(trivia []Node, i int) bool {
+	ws, ok := trivia[i].(*WhitespaceNode)
+	if !ok || !strings.HasSuffix(ws.text, "\n") {
+		return false
+	}
+	return i == 0 || !isComment(trivia[i-1])
+}
+
+func isComment(n Node) bool {
+	_, ok := n.(*CommentNode)
+	return ok
+}
+
+// keepTrivia puts trivia left by a node removed from list, the entries of
+// parent, at list[i]: in front of that node's leading trivia, or at the
+// end of a section in front of its body trivia, without doubling a blank
+// line. At the end of the document it becomes top-level trivia, and blank
+// lines alone are dropped.
+func keepTrivia(parent Node, list *[]Node, i int, trivia []Node) {
+	next := bodyTriviaOf(parent)
+	if i < len(*list) {
+		next = leadingTriviaOf((*list)[i])
+	}
+	if next != nil {
+		if (i == len(*list) && len(*next) == 0) || (len(*next) > 0 && isBlankLine(*next, 0)) {
+			trivia = trimBlankLines(trivia)
+		}
+		owner := parent
+		if i < len(*list) {
+			owner = (*list)[i]
+		}
+		adoptTrivia(owner, trivia)
+		*next = append(trivia, *next...)
+		return
+	}
+	if i == len(*list) {
+		trivia = trimBlankLines(trivia)
+	}
+	adoptTrivia(parent, trivia)
+	*list = slices.Insert(*list, i, trivia...)
+}
+
+// trimBlankLines removes the blank lines at the end of trivia.
+func trimBlankLines(trivia []Node) []Node {
+	for len(trivia) > 0 && isBlankLine(trivia, len(trivia)-1) {
+		trivia = trivia[:len(trivia)-1]
+	}
+	return trivia
 }
 
 // Append adds a node to the end of the document's top-level nodes.
@@ -479,21 +961,33 @@ func (d *Document) DeleteTable(path string) bool {
 // Returns an error if the node would create an invalid document
 // (e.g., duplicate keys, duplicate tables, or structural conflicts).
 // Comment and whitespace nodes skip structural validation.
+//
+// A table or array-of-tables entry built with entries of its own is first
+// checked on its own: conflicts between its keys are returned as an
+// *EntryError naming the offending entry. Conflicts with the rest of the
+// document are then found by full validation.
 func (d *Document) Append(node Node) error {
 	if err := validateDocumentNode(node); err != nil {
 		return err
 	}
+	if err := checkAttachable(node); err != nil {
+		return err
+	}
+	if err := checkSection(node); err != nil {
+		return err
+	}
 	// Trivia nodes don't affect TOML structure; skip validation.
 	if isTriviaNode(node) {
 		d.nodes = append(d.nodes, node)
 		setNodeParent(node, d)
+		d.changed()
 		return nil
 	}
 	// Tentatively add.
 	d.nodes = append(d.nodes, node)
 	setNodeParent(node, d)
 	// Full structural validation.
-	if err := d.Validate(); err != nil {
+	if err := d.validateMutation(); err != nil {
 		// Rollback.
 		d.nodes = d.nodes[:len(d.nodes)-1]
 		setNodeParent(node, nil)
@@ -505,11 +999,18 @@ func (d *Document) Append(node Node) error {
 // InsertAt inserts a node at position i in the document's top-level nodes.
 // If i is out of range, the node is appended.
 // Returns an error if the node would create an invalid document.
-// Comment and whitespace nodes skip structural validation.
+// Comment and whitespace nodes skip structural validation. Tables are
+// checked as described on Append.
 func (d *Document) InsertAt(i int, node Node) error {
 	if err := validateDocumentNode(node); err != nil {
 		return err
 	}
+	if err := checkAttachable(node); err != nil {
+		return err
+	}
+	if err := checkSection(node); err != nil {
+		return err
+	}
 	if i < 0 {
 		i = 0
 	}
@@ -520,13 +1021,14 @@ func (d *Document) InsertAt(i int, node Node) error {
 	if isTriviaNode(node) {
 		d.nodes = append(d.nodes[:i], append([]Node{node}, d.nodes[i:]...)...)
 		setNodeParent(node, d)
+		d.changed()
 		return nil
 	}
 	// Tentatively insert.
 	d.nodes = append(d.nodes[:i], append([]Node{node}, d.nodes[i:]...)...)
 	setNodeParent(node, d)
 	// Full structural validation.
-	if err := d.Validate(); err != nil {
+	if err := d.validateMutation(); err != nil {
 		// Rollback.
 		d.nodes = append(d.nodes[:i], d.nodes[i+1:]...)
 		setNodeParent(node, nil)
@@ -535,6 +1037,53 @@ func (d *Document) InsertAt(i int, node Node) error {
 	return nil
 }
 
+// AppendRaw parses text as TOML and appends its nodes to the end of the
+// document, before its epilogue, keeping their formatting exactly.
+// Key-values before the first header in text continue the document's last
+// table, as they would if text were pasted at the end of the file; a
+// newline is added first if the document does not end with one. Returns
+// the *ParseError if text is not valid TOML, and leaves the document
+// unchanged if appending it would make the document invalid.
+func (d *Document) AppendRaw(text string) error {
+	snip, err := Parse([]byte(text))
+	if err != nil {
+		return err
+	}
+	var section Node = d
+	if len(d.nodes) > 0 {
+		if last := d.nodes[len(d.nodes)-1]; entriesOf(last) != nil {
+			section = last
+		}
+	}
+	first := section
+	oldNodes, oldEntries := d.nodes, *entriesOf(first)
+	// Clip so that appending never writes into the arrays being kept.
+	d.nodes = slices.Clip(d.nodes)
+	entries := entriesOf(first)
+	*entries = slices.Clip(*entries)
+	nodes := slices.Concat(snip.prologue, snip.nodes, snip.epilogue)
+	if d.endsMidLine() {
+		nodes = append([]Node{&WhitespaceNode{leafNode: newLeaf("\n")}}, nodes...)
+	}
+	for _, n := range nodes {
+		switch n.(type) {
+		case *TableNode, *ArrayOfTables:
+			section, entries = d, &d.nodes
+		}
+		*entries = append(*entries, n)
+		setNodeParent(n, section)
+	}
+	if err := d.validateMutation(); err != nil {
+		d.nodes = oldNodes
+		*entriesOf(first) = oldEntries
+		for _, n := range nodes {
+			setNodeParent(n, nil)
+		}
+		return err
+	}
+	return nil
+}
+
 // isTriviaNode returns true if n is a *CommentNode or *WhitespaceNode.
 func isTriviaNode(n Node) bool {
 	switch n.(type) {
@@ -544,123 +1093,197 @@ func isTriviaNode(n Node) bool {
 	return false
 }
 
+// NormalizeDatetimes rewrites every offset datetime in the document to a
+// canonical offset: UTC ("Z") when toUTC is true, otherwise the offset of
+// time.Local at that instant. The separator, seconds and fractional-second
+// precision of each value are kept as written, and local datetimes, dates and
+// times are left untouched. Returns the number of values rewritten.
+func (d *Document) NormalizeDatetimes(toUTC bool) int {
+	loc := time.Local
+	if toUTC {
+		loc = time.UTC
+	}
+	count := 0
+	d.Walk(func(n Node) bool {
+		dt, ok := n.(*DateTimeNode)
+		if !ok {
+			return true
+		}
+		text, err := normalizeOffsetDateTime(dt.text, loc)
+		if err != nil || text == dt.text {
+			return true
+		}
+		dt.text = text
+		if kv, ok := dt.Parent().(*KeyValue); ok {
+			kv.rawVal = text
+		}
+		regenerateAncestorText(dt)
+		count++
+		return true
+	})
+	return count
+}
+
+// normalizeOffsetDateTime re-renders an offset datetime in loc, returning
+// local forms unchanged.
+func normalizeOffsetDateTime(text string, loc *time.Location) (string, error) {
+	f, err := parseDateTimeFields(text)
+	if err != nil || f.offset == nil {
+		return text, err
+	}
+	zone := time.FixedZone("", *f.offset)
+	t := time.Date(f.year, time.Month(f.month), f.day, f.hour, f.minute, f.second, f.nanos, zone).In(loc)
+
+	var b strings.Builder
+	b.WriteString(t.Format("2006-01-02"))
+	b.WriteByte(f.sep)
+	b.WriteString(t.Format("15:04"))
+	if f.hasSeconds {
+		b.WriteString(t.Format(":05"))
+	}
+	if f.fracDigits > 0 {
+		frac := fmt.Sprintf("%09d", t.Nanosecond())
+		if f.fracDigits <= len(frac) {
+			frac = frac[:f.fracDigits]
+		} else {
+			frac += strings.Repeat("0", f.fracDigits-len(frac))
+		}
+		b.WriteString("." + frac)
+	}
+	if _, offset := t.Zone(); offset == 0 {
+		b.WriteByte('Z')
+	} else {
+		b.WriteString(t.Format("-07:00"))
+	}
+	return b.String(), nil
+}
+
 // --- TableNode mutation ---
 
 // Delete removes the first KeyValue matching the key from the table.
-// Returns true if a key was found and removed.
-func (t *TableNode) Delete(key string) bool {
+// Returns the removed key-value and true if one was found.
+func (t *TableNode) Delete(key string) (*KeyValue, bool) {
 	segs := parseDottedPath(key)
 	return deleteFromEntries(&t.entries, segs)
 }
 
-// Append adds a key-value pair to the end of the table's entries.
+// Append adds a key-value pair after the table's last entry, before any
+// blank lines that end the table, so the key stays with its section.
 // Returns an error if the key-value is nil, would create duplicate keys,
 // or would create structural conflicts in the parent document.
 func (t *TableNode) Append(kv *KeyValue) error {
-	if kv == nil {
-		return ErrNilEntry
-	}
-	// Tentatively add.
-	t.entries = append(t.entries, kv)
-	kv.setParent(t)
-	// If attached to a document, run full validation.
-	doc := findDocument(t)
-	if doc != nil {
-		if err := doc.Validate(); err != nil {
-			// Rollback.
-			t.entries = t.entries[:len(t.entries)-1]
-			kv.setParent(nil)
-			return err
-		}
-	} else {
-		// Standalone table: local duplicate check only.
-		if err := localDuplicateCheck(t.entries); err != nil {
-			t.entries = t.entries[:len(t.entries)-1]
-			kv.setParent(nil)
-			return err
-		}
+	return insertEntry(t, &t.entries, appendIndex(t.entries), kv)
+}
+
+// AppendAfterKey inserts a key-value pair directly after the entry with
+// key existingKey. It fails with ErrKeyNotFound if the table has no such
+// entry, and otherwise as Append does.
+func (t *TableNode) AppendAfterKey(existingKey string, kv *KeyValue) error {
+	i, err := afterKeyIndex(t.entries, existingKey)
+	if err != nil {
+		return err
 	}
-	return nil
+	return insertEntry(t, &t.entries, i, kv)
 }
 
 // InsertAt inserts a key-value pair at position i in the table's entries.
 // If i is out of range, the key-value is appended.
 // Returns an error if it would create duplicate keys or structural conflicts.
 func (t *TableNode) InsertAt(i int, kv *KeyValue) error {
-	if kv == nil {
-		return ErrNilEntry
-	}
 	if i < 0 {
 		i = 0
 	}
 	if i >= len(t.entries) {
 		return t.Append(kv)
 	}
-	// Tentatively insert.
-	t.entries = append(t.entries[:i], append([]Node{kv}, t.entries[i:]...)...)
-	kv.setParent(t)
-	doc := findDocument(t)
-	if doc != nil {
-		if err := doc.Validate(); err != nil {
-			t.entries = append(t.entries[:i], t.entries[i+1:]...)
-			kv.setParent(nil)
-			return err
+	return insertEntry(t, &t.entries, i, kv)
+}
+
+// appendIndex returns where Append puts a new entry: before the run of
+// blank lines at the end of entries.
+func appendIndex(entries []Node) int {
+	i := len(entries)
+	for i > 0 && isBlankLine(entries, i-1) {
+		i--
+	}
+	return i
+}
+
+// afterKeyIndex returns the position after the key-value with key in
+// entries.
+func afterKeyIndex(entries []Node, key string) (int, error) {
+	segs := parseDottedPath(key)
+	for i, e := range entries {
+		if kv, ok := e.(*KeyValue); ok && matchKeyParts(kv.keyParts, segs) {
+			return i + 1, nil
 		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+}
+
+// insertEntry inserts kv at position i of entries, the entry list of
+// section, and validates the result, undoing the insert if it fails.
+func insertEntry(section Node, entries *[]Node, i int, kv *KeyValue) error {
+	if kv == nil {
+		return ErrNilEntry
+	}
+	if err := checkAttachable(kv); err != nil {
+		return err
+	}
+	*entries = slices.Insert(*entries, i, Node(kv))
+	kv.setParent(section)
+	var err error
+	if doc := findDocument(section); doc != nil {
+		err = doc.validateMutation()
 	} else {
-		if err := localDuplicateCheck(t.entries); err != nil {
-			t.entries = append(t.entries[:i], t.entries[i+1:]...)
-			kv.setParent(nil)
-			return err
-		}
+		err = localDuplicateCheck(*entries)
 	}
-	return nil
+	if err != nil {
+		*entries = slices.Delete(*entries, i, i+1)
+		kv.setParent(nil)
+	}
+	return err
 }
 
 // --- ArrayOfTables mutation ---
 
 // Delete removes the first KeyValue matching the key from the array of tables.
-// Returns true if a key was found and removed.
-func (a *ArrayOfTables) Delete(key string) bool {
+// Returns the removed key-value and true if one was found.
+func (a *ArrayOfTables) Delete(key string) (*KeyValue, bool) {
 	segs := parseDottedPath(key)
 	return deleteFromEntries(&a.entries, segs)
 }
 
-// Append adds a key-value pair to the end of the array-of-tables' entries.
+// Append adds a key-value pair after the array-of-tables entry's last
+// entry, before any blank lines that end it, as TableNode.Append does.
 // Returns an error if the key-value is nil, would create duplicate keys,
 // or would create structural conflicts in the parent document.
 func (a *ArrayOfTables) Append(kv *KeyValue) error {
-	if kv == nil {
-		return ErrNilEntry
-	}
-	a.entries = append(a.entries, kv)
-	kv.setParent(a)
-	doc := findDocument(a)
-	if doc != nil {
-		if err := doc.Validate(); err != nil {
-			a.entries = a.entries[:len(a.entries)-1]
-			kv.setParent(nil)
-			return err
-		}
-	} else {
-		if err := localDuplicateCheck(a.entries); err != nil {
-			a.entries = a.entries[:len(a.entries)-1]
-			kv.setParent(nil)
-			return err
-		}
+	return insertEntry(a, &a.entries, appendIndex(a.entries), kv)
+}
+
+// AppendAfterKey inserts a key-value pair directly after the entry with
+// key existingKey, as TableNode.AppendAfterKey does.
+func (a *ArrayOfTables) AppendAfterKey(existingKey string, kv *KeyValue) error {
+	i, err := afterKeyIndex(a.entries, existingKey)
+	if err != nil {
+		return err
 	}
-	return nil
+	return insertEntry(a, &a.entries, i, kv)
 }
 
-func deleteFromEntries(entries *[]Node, segs []string) bool {
+func deleteFromEntries(entries *[]Node, segs []string) (*KeyValue, bool) {
 	for i, e := range *entries {
 		if kv, ok := e.(*KeyValue); ok {
 			if matchKeyParts(kv.keyParts, segs) {
+				touch(kv)
+				kv.setParent(nil)
 				*entries = append((*entries)[:i], (*entries)[i+1:]...)
-				return true
+				return kv, true
 			}
 		}
 	}
-	return false
+	return nil, false
 }
 
 // --- ArrayNode mutation ---
@@ -672,8 +1295,14 @@ func (a *ArrayNode) Append(elem Node) error {
 	if err := validateValueType(elem); err != nil {
 		return err
 	}
+	if err := checkAttachable(elem); err != nil {
+		return err
+	}
 	a.elements = append(a.elements, elem)
-	a.text = generateArrayText(a.elements)
+	a.seps = growSeps(a.seps)
+	setValueParent(elem, a)
+	a.regenerateText()
+	regenerateAncestorText(a)
 	return nil
 }
 
@@ -684,8 +1313,11 @@ func (a *ArrayNode) Delete(i int) error {
 	if i < 0 || i >= len(a.elements) {
 		return fmt.Errorf("%w: index %d (array has %d elements)", ErrIndexOutOfRange, i, len(a.elements))
 	}
+	setValueParent(a.elements[i], nil)
 	a.elements = append(a.elements[:i], a.elements[i+1:]...)
-	a.text = generateArrayText(a.elements)
+	a.seps = shrinkSeps(a.seps, i)
+	a.regenerateText()
+	regenerateAncestorText(a)
 	return nil
 }
 
@@ -698,40 +1330,48 @@ func (n *InlineTableNode) Append(kv *KeyValue) error {
 	if kv == nil {
 		return ErrNilEntry
 	}
-	path := keyPartsToPath(kv.keyParts)
+	if err := checkAttachable(kv); err != nil {
+		return err
+	}
+	key := pathKey(kv.keyParts)
 	for _, existing := range n.entries {
-		if keyPartsToPath(existing.keyParts) == path {
-			return fmt.Errorf("%w: %q in inline table", ErrDuplicateKey, path)
+		if pathKey(existing.keyParts) == key {
+			return fmt.Errorf("%w: %q in inline table", ErrDuplicateKey, JoinPath(partsToSegs(kv.keyParts)...))
 		}
 	}
 	// Check dotted key conflicts.
 	for i := 1; i < len(kv.keyParts); i++ {
-		prefix := keyPartsToPath(kv.keyParts[:i])
+		prefix := pathKey(kv.keyParts[:i])
 		for _, existing := range n.entries {
-			if keyPartsToPath(existing.keyParts) == prefix {
-				return fmt.Errorf("%w: %q in inline table", ErrKeyConflict, prefix)
+			if pathKey(existing.keyParts) == prefix {
+				return fmt.Errorf("%w: %q in inline table", ErrKeyConflict, JoinPath(partsToSegs(kv.keyParts[:i])...))
 			}
 		}
 	}
 	n.entries = append(n.entries, kv)
+	n.seps = growSeps(n.seps)
 	kv.setParent(n)
-	n.text = generateInlineTableText(n.entries)
+	n.regenerateText()
+	regenerateAncestorText(n)
 	return nil
 }
 
 // Delete removes the first entry matching the key from the inline table.
-// Returns true if a key was found and removed.
+// Returns the removed key-value and true if one was found.
 // The inline table's text representation is regenerated.
-func (n *InlineTableNode) Delete(key string) bool {
+func (n *InlineTableNode) Delete(key string) (*KeyValue, bool) {
 	segs := parseDottedPath(key)
 	for i, kv := range n.entries {
 		if matchKeyParts(kv.keyParts, segs) {
+			kv.setParent(nil)
 			n.entries = append(n.entries[:i], n.entries[i+1:]...)
-			n.text = generateInlineTableText(n.entries)
-			return true
+			n.seps = shrinkSeps(n.seps, i)
+			n.regenerateText()
+			regenerateAncestorText(n)
+			return kv, true
 		}
 	}
-	return false
+	return nil, false
 }
 
 // --- Convenience constructors ---
@@ -749,7 +1389,7 @@ func NewComment(text string) (*CommentNode, error) {
 			return nil, fmt.Errorf("%w: U+%04X", ErrCommentControl, r)
 		}
 	}
-	return &CommentNode{leafNode: newLeaf(NodeComment, text)}, nil
+	return &CommentNode{leafNode: newLeaf(text)}, nil
 }
 
 // NewWhitespace creates a WhitespaceNode from the given string.
@@ -761,7 +1401,7 @@ func NewWhitespace(text string) (*WhitespaceNode, error) {
 			return nil, fmt.Errorf("%w: %q", ErrInvalidWsChar, c)
 		}
 	}
-	return &WhitespaceNode{leafNode: newLeaf(NodeWhitespace, text)}, nil
+	return &WhitespaceNode{leafNode: newLeaf(text)}, nil
 }
 
 // --- Document convenience methods ---
@@ -799,6 +1439,7 @@ func (t *TableNode) AppendComment(text string) error {
 	t.addEntry(cn)
 	ws, _ := NewWhitespace("\n")
 	t.addEntry(ws)
+	touch(t)
 	return nil
 }
 
@@ -806,6 +1447,7 @@ func (t *TableNode) AppendComment(text string) error {
 func (t *TableNode) AppendBlankLine() {
 	ws, _ := NewWhitespace("\n")
 	t.addEntry(ws)
+	touch(t)
 }
 
 // --- ArrayOfTables convenience methods ---
@@ -820,6 +1462,7 @@ func (a *ArrayOfTables) AppendComment(text string) error {
 	a.addEntry(cn)
 	ws, _ := NewWhitespace("\n")
 	a.addEntry(ws)
+	touch(a)
 	return nil
 }
 
@@ -828,4 +1471,5 @@ func (a *ArrayOfTables) AppendComment(text string) error {
 func (a *ArrayOfTables) AppendBlankLine() {
 	ws, _ := NewWhitespace("\n")
 	a.addEntry(ws)
+	touch(a)
 }
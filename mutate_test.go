@@ -1,7 +1,10 @@
 package toml
 
 import (
+	"errors"
+	"fmt"
 	"math"
+	"strings"
 	"testing"
 )
 
@@ -170,6 +173,68 @@ func TestNewTable_QuotedSegments(t *testing.T) {
 	}
 }
 
+func TestNewKeyValueFull(t *testing.T) {
+	c, _ := NewComment("# doc")
+	nl, _ := NewWhitespace("\n")
+	indent, _ := NewWhitespace("  ")
+	opts := DefaultKeyValueOptions("port", NewInteger(80))
+	opts.LeadingTrivia = []Node{c, nl, indent}
+	opts.TrailingComment = "http"
+	opts.CommentSpace = "  "
+	opts.PreEq = ""
+	opts.Newline = "\r\n"
+	kv, err := NewKeyValueFull(opts)
+	if err != nil {
+		t.Fatalf("NewKeyValueFull: %v", err)
+	}
+	d, _ := Parse([]byte("[s]\n"))
+	if err := d.Table("s").Append(kv); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.String(), "[s]\n# doc\n  port= 80  # http\r\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if c.Parent() != kv || DocComment(kv) != "doc\nhttp" {
+		t.Errorf("leading comment not adopted: parent %v, doc %q", c.Parent(), DocComment(kv))
+	}
+
+	def, err := NewKeyValueFull(DefaultKeyValueOptions("a", NewInteger(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = &Document{}
+	if err := d.Append(def); err != nil || d.String() != "a = 1\n" {
+		t.Errorf("defaults: %v %q", err, d.String())
+	}
+}
+
+func TestNewKeyValueFull_Errors(t *testing.T) {
+	c, _ := NewComment("# doc")
+	tests := []struct {
+		name string
+		edit func(*KeyValueOptions)
+		want error
+	}{
+		{"pre eq", func(o *KeyValueOptions) { o.PreEq = "\n" }, ErrInvalidWhitespace},
+		{"comment space", func(o *KeyValueOptions) { o.CommentSpace = "x" }, ErrInvalidWhitespace},
+		{"newline", func(o *KeyValueOptions) { o.Newline = "\r" }, ErrInvalidNewline},
+		{"unterminated comment", func(o *KeyValueOptions) { o.LeadingTrivia = []Node{c} }, ErrInvalidTrivia},
+		{"non-trivia", func(o *KeyValueOptions) { o.LeadingTrivia = []Node{NewInteger(1)} }, ErrInvalidTrivia},
+		{"comment newline", func(o *KeyValueOptions) { o.TrailingComment = "a\nb" }, ErrCommentNewline},
+	}
+	for _, tt := range tests {
+		val := NewInteger(1)
+		opts := DefaultKeyValueOptions("k", val)
+		tt.edit(&opts)
+		if _, err := NewKeyValueFull(opts); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+		if val.Parent() != nil {
+			t.Errorf("%s: value attached on error", tt.name)
+		}
+	}
+}
+
 // --- SetValue tests ---
 
 func TestSetValue(t *testing.T) {
@@ -207,6 +272,55 @@ func TestSetValue_ChangeType(t *testing.T) {
 	}
 }
 
+func TestSetValueIfChanged(t *testing.T) {
+	src := "i = 0x10\nf = 1.50\ns = 'a'\nd = 1979-05-27t07:32:00Z\na = [ 1, 2 ]\nt = { x.y = 1, z = \"q\" }\nn = nan\n"
+	tests := []struct {
+		key     string
+		val     func() Node
+		changed bool
+	}{
+		{"i", func() Node { return NewInteger(16) }, false},
+		{"i", func() Node { return NewInteger(17) }, true},
+		{"i", func() Node { return NewFloat(16) }, true},
+		{"f", func() Node { return NewFloat(1.5) }, false},
+		{"s", func() Node { return NewString("a") }, false},
+		{"s", func() Node { return NewString("b") }, true},
+		{"d", func() Node { v, _ := NewDateTime("1979-05-27 07:32:00z"); return v }, false},
+		{"d", func() Node { v, _ := NewDateTime("1979-05-27T08:32:00+01:00"); return v }, true},
+		{"a", func() Node { v, _ := NewArray(NewInteger(1), NewInteger(2)); return v }, false},
+		{"a", func() Node { v, _ := NewArray(NewInteger(2), NewInteger(1)); return v }, true},
+		{"t", func() Node {
+			inner, _ := NewInlineTable(mustKeyValue(t, "y", NewInteger(1)))
+			v, _ := NewInlineTable(mustKeyValue(t, "z", NewString("q")), mustKeyValue(t, "x", inner))
+			return v
+		}, false},
+		{"t", func() Node { v, _ := NewInlineTable(mustKeyValue(t, "z", NewString("q"))); return v }, true},
+		{"n", func() Node { return NewFloat(math.NaN()) }, false},
+	}
+	for _, tt := range tests {
+		d, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatalf("parse error: %v", err)
+		}
+		kv := d.Get(tt.key)
+		old := kv.RawVal()
+		val := tt.val()
+		changed, err := kv.SetValueIfChanged(val)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.key, err)
+		}
+		if changed != tt.changed {
+			t.Errorf("%s = %s: changed = %v, want %v", tt.key, val.Text(), changed, tt.changed)
+		}
+		if !changed && (kv.RawVal() != old || d.String() != src || val.Parent() != nil) {
+			t.Errorf("%s = %s: original text not kept", tt.key, val.Text())
+		}
+		if changed && kv.RawVal() != val.Text() {
+			t.Errorf("%s = %s: got %s", tt.key, val.Text(), kv.RawVal())
+		}
+	}
+}
+
 // --- Delete tests ---
 
 func TestDocument_Delete_TopLevel(t *testing.T) {
@@ -214,7 +328,7 @@ func TestDocument_Delete_TopLevel(t *testing.T) {
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	if !d.Delete("b") {
+	if _, ok := d.Delete("b"); !ok {
 		t.Fatal("expected Delete to return true")
 	}
 	got := d.String()
@@ -229,7 +343,7 @@ func TestDocument_Delete_Nonexistent(t *testing.T) {
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	if d.Delete("missing") {
+	if _, ok := d.Delete("missing"); ok {
 		t.Fatal("expected Delete to return false for nonexistent key")
 	}
 }
@@ -239,7 +353,7 @@ func TestDocument_Delete_InTable(t *testing.T) {
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	if !d.Delete("server.host") {
+	if _, ok := d.Delete("server.host"); !ok {
 		t.Fatal("expected Delete to return true")
 	}
 	got := d.String()
@@ -255,7 +369,7 @@ func TestTableNode_Delete(t *testing.T) {
 		t.Fatalf("parse error: %v", err)
 	}
 	tbl := d.Table("server")
-	if !tbl.Delete("host") {
+	if _, ok := tbl.Delete("host"); !ok {
 		t.Fatal("expected Delete to return true")
 	}
 	got := d.String()
@@ -270,7 +384,7 @@ func TestTableNode_Delete_Nonexistent(t *testing.T) {
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	if d.Table("server").Delete("missing") {
+	if _, ok := d.Table("server").Delete("missing"); ok {
 		t.Fatal("expected Delete to return false")
 	}
 }
@@ -281,7 +395,7 @@ func TestArrayOfTables_Delete(t *testing.T) {
 		t.Fatalf("parse error: %v", err)
 	}
 	aots := d.ArraysOfTables()
-	if !aots[0].Delete("name") {
+	if _, ok := aots[0].Delete("name"); !ok {
 		t.Fatal("expected Delete to return true")
 	}
 	got := d.String()
@@ -298,9 +412,13 @@ func TestDocument_DeleteTable(t *testing.T) {
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	if !d.DeleteTable("server") {
+	tbl, ok := d.DeleteTable("server")
+	if !ok {
 		t.Fatal("expected DeleteTable to return true")
 	}
+	if tbl.Parent() != nil || tbl.Text() != "[server]" || len(tbl.Entries()) != 1 {
+		t.Errorf("DeleteTable returned %q with %d entries", tbl.Text(), len(tbl.Entries()))
+	}
 	got := d.String()
 	expected := "top = 1\n[database]\nport = 5432\n"
 	if got != expected {
@@ -313,11 +431,125 @@ func TestDocument_DeleteTable_Nonexistent(t *testing.T) {
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	if d.DeleteTable("missing") {
+	if _, ok := d.DeleteTable("missing"); ok {
 		t.Fatal("expected DeleteTable to return false")
 	}
 }
 
+func TestDocument_DeleteTree(t *testing.T) {
+	src := "serverless = true\n[server]\nhost = \"h\"\n[server.tls]\ncert = \"c\"\n" +
+		"[db]\nurl = \"u\"\n[[server.listeners]]\naddr = \":80\"\n[[server.listeners]]\naddr = \":443\"\n"
+	d := mustParse(t, src)
+	if got := d.DeleteTree("server"); got != 4 {
+		t.Errorf("DeleteTree = %d, want 4", got)
+	}
+	want := "serverless = true\n[db]\nurl = \"u\"\n"
+	if got := d.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if err := d.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	if got := d.DeleteTree("server"); got != 0 {
+		t.Errorf("second DeleteTree = %d", got)
+	}
+
+	d = mustParse(t, "server.port = 80\nserver.tls.on = true\nx = 1\n")
+	if got := d.DeleteTree("server"); got != 2 || d.String() != "x = 1\n" {
+		t.Errorf("DeleteTree = %d, left %q", got, d.String())
+	}
+
+	d = mustParse(t, "[a]\nb.c = 1\nb.d = 2\ne = 3\n[a.b.f]\ng = 4\n")
+	if got := d.DeleteTree("a.b"); got != 3 {
+		t.Errorf("DeleteTree(a.b) = %d, want 3", got)
+	}
+	if got := d.String(); got != "[a]\ne = 3\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestDocument_DeleteAOTEntry(t *testing.T) {
+	src := "# products\n\n[[p]]\nname = \"a\"\n\n# second\n[[p]]\nname = \"b\"\n[p.dims]\nw = 1\n\n" +
+		"[[p]]\nname = \"c\"\n\n[x]\ny = 1\n"
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "# products\n\n# second\n[[p]]\nname = \"b\"\n[p.dims]\nw = 1\n\n[[p]]\nname = \"c\"\n\n[x]\ny = 1\n"},
+		{1, "# products\n\n[[p]]\nname = \"a\"\n\n[[p]]\nname = \"c\"\n\n[x]\ny = 1\n"},
+		{-1, "# products\n\n[[p]]\nname = \"a\"\n\n# second\n[[p]]\nname = \"b\"\n[p.dims]\nw = 1\n\n[x]\ny = 1\n"},
+	}
+	for _, tt := range tests {
+		d := mustParse(t, src)
+		if !d.DeleteAOTEntry("p", tt.index) {
+			t.Fatalf("DeleteAOTEntry(p, %d) = false", tt.index)
+		}
+		if got := d.String(); got != tt.want {
+			t.Errorf("DeleteAOTEntry(p, %d):\n%s\nwant:\n%s", tt.index, got, tt.want)
+		}
+		if err := d.Validate(); err != nil {
+			t.Errorf("Validate: %v", err)
+		}
+	}
+	d := mustParse(t, src)
+	if d.DeleteAOTEntry("p", 3) || d.DeleteAOTEntry("p", -4) || d.DeleteAOTEntry("x", 0) {
+		t.Error("DeleteAOTEntry removed an entry out of range")
+	}
+	if got := d.DeleteAOTAll("p"); got != 3 {
+		t.Errorf("DeleteAOTAll = %d, want 3", got)
+	}
+	if got, want := d.String(), "# products\n\n[x]\ny = 1\n"; got != want {
+		t.Errorf("DeleteAOTAll left %q, want %q", got, want)
+	}
+
+	d = mustParse(t, "a = 1\n\n# only\n[[p]]\nb = 2\n")
+	if d.DeleteAOTAll("p") != 1 || d.String() != "a = 1\n" {
+		t.Errorf("DeleteAOTAll left %q", d.String())
+	}
+}
+
+func TestDocument_DeleteWithOptions(t *testing.T) {
+	src := "[s]\na = 1\n\n# group\n\n# about b\nb = 2 # same line\nc = 3\n"
+	tests := []struct {
+		mode TriviaMode
+		want string
+		lead int
+	}{
+		{TriviaRemove, "[s]\na = 1\nc = 3\n", 6},
+		{TriviaKeepDetached, "[s]\na = 1\n\n# group\n\nc = 3\n", 2},
+		{TriviaReattach, "[s]\na = 1\n\n# group\n\n# about b\nc = 3\n", 0},
+	}
+	for _, tt := range tests {
+		d := mustParse(t, src)
+		kv, ok := d.DeleteWithOptions("s.b", DeleteOptions{LeadingTrivia: tt.mode})
+		if !ok {
+			t.Fatalf("mode %d: not deleted", tt.mode)
+		}
+		if got := d.String(); got != tt.want {
+			t.Errorf("mode %d:\n%s\nwant:\n%s", tt.mode, got, tt.want)
+		}
+		if len(kv.LeadingTrivia()) != tt.lead {
+			t.Errorf("mode %d: removed key-value keeps %d trivia nodes, want %d", tt.mode, len(kv.LeadingTrivia()), tt.lead)
+		}
+		for _, n := range d.Table("s").Entries() {
+			if kv, ok := n.(*KeyValue); ok && len(kv.LeadingTrivia()) > 0 && kv.LeadingTrivia()[0].Parent() != kv {
+				t.Errorf("mode %d: kept trivia not adopted", tt.mode)
+			}
+		}
+	}
+
+	d := mustParse(t, "a = 1\n\n# about t\n[t]\nx = 1\n")
+	if _, ok := d.DeleteTableWithOptions("t", DeleteOptions{LeadingTrivia: TriviaReattach}); !ok {
+		t.Fatal("table not deleted")
+	}
+	if got, want := d.String(), "a = 1\n\n# about t\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if err := d.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
 // --- Append tests ---
 
 func TestDocument_Append(t *testing.T) {
@@ -385,6 +617,52 @@ func TestTableNode_Append(t *testing.T) {
 	}
 }
 
+func TestTableNode_Append_BeforeTrailingBlankLines(t *testing.T) {
+	d := mustParse(t, "[a]\nx = 1 # one\n\n\n")
+	kv, _ := NewKeyValue("y", NewInteger(2))
+	if err := d.Table("a").Append(kv); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if got, want := d.String(), "[a]\nx = 1 # one\ny = 2\n\n\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	d = mustParse(t, "[a]\nx = 1\n[b]\n")
+	tbl := d.Table("a")
+	tbl.AppendBlankLine()
+	kv, _ = NewKeyValue("y", NewInteger(2))
+	if err := tbl.Append(kv); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if got, want := d.String(), "[a]\nx = 1\ny = 2\n\n[b]\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	dup, _ := NewKeyValue("x", NewInteger(3))
+	if err := tbl.Append(dup); err == nil || d.String() != "[a]\nx = 1\ny = 2\n\n[b]\n" {
+		t.Errorf("rejected Append changed the document: %v %q", err, d.String())
+	}
+}
+
+func TestTableNode_AppendAfterKey(t *testing.T) {
+	d := mustParse(t, "[a]\nx = 1\nz = 3\n[[b]]\np = 1\n")
+	kv, _ := NewKeyValue("y", NewInteger(2))
+	if err := d.Table("a").AppendAfterKey("x", kv); err != nil {
+		t.Fatalf("AppendAfterKey: %v", err)
+	}
+	kv, _ = NewKeyValue("q", NewInteger(2))
+	if err := d.ArrayOfTables("b")[0].AppendAfterKey("p", kv); err != nil {
+		t.Fatalf("AppendAfterKey: %v", err)
+	}
+	if got, want := d.String(), "[a]\nx = 1\ny = 2\nz = 3\n[[b]]\np = 1\nq = 2\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	kv, _ = NewKeyValue("w", NewInteger(0))
+	if err := d.Table("a").AppendAfterKey("missing", kv); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("AppendAfterKey(missing) = %v", err)
+	}
+}
+
 func TestArrayOfTables_Append(t *testing.T) {
 	d, err := Parse([]byte("[[items]]\nname = \"widget\"\n"))
 	if err != nil {
@@ -515,7 +793,7 @@ func TestDocument_Delete_QuotedKeyInTable(t *testing.T) {
 	if tbl == nil {
 		t.Fatal("expected to find table")
 	}
-	if !tbl.Delete("color") {
+	if _, ok := tbl.Delete("color"); !ok {
 		t.Fatal("expected Delete to return true")
 	}
 	got := d.String()
@@ -531,7 +809,7 @@ func TestDocument_DeleteTable_QuotedHeader(t *testing.T) {
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	if !d.DeleteTable(`dog."tater.man"`) {
+	if _, ok := d.DeleteTable(`dog."tater.man"`); !ok {
 		t.Fatal("expected DeleteTable to return true")
 	}
 	got := d.String()
@@ -669,7 +947,7 @@ func TestInlineTableNode_Delete(t *testing.T) {
 	if err != nil {
 		t.Fatalf("NewInlineTable: %v", err)
 	}
-	if !it.Delete("a") {
+	if _, ok := it.Delete("a"); !ok {
 		t.Fatal("expected Delete to return true")
 	}
 	if it.Text() != "{b = 2}" {
@@ -683,7 +961,7 @@ func TestInlineTableNode_Delete_Nonexistent(t *testing.T) {
 	if err != nil {
 		t.Fatalf("NewInlineTable: %v", err)
 	}
-	if it.Delete("missing") {
+	if _, ok := it.Delete("missing"); ok {
 		t.Fatal("expected Delete to return false")
 	}
 }
@@ -694,7 +972,7 @@ func TestInlineTableNode_Delete_All(t *testing.T) {
 	if err != nil {
 		t.Fatalf("NewInlineTable: %v", err)
 	}
-	if !it.Delete("a") {
+	if _, ok := it.Delete("a"); !ok {
 		t.Fatal("expected Delete to return true")
 	}
 	if it.Text() != "{}" {
@@ -907,7 +1185,7 @@ func TestDocument_Append_Comment(t *testing.T) {
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	cn := &CommentNode{leafNode: newLeaf(NodeComment, "# hello")}
+	cn := &CommentNode{leafNode: newLeaf("# hello")}
 	if err := d.Append(cn); err != nil {
 		t.Fatalf("Append comment: %v", err)
 	}
@@ -923,7 +1201,7 @@ func TestDocument_Append_Whitespace(t *testing.T) {
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	ws := &WhitespaceNode{leafNode: newLeaf(NodeWhitespace, "\n")}
+	ws := &WhitespaceNode{leafNode: newLeaf("\n")}
 	if err := d.Append(ws); err != nil {
 		t.Fatalf("Append whitespace: %v", err)
 	}
@@ -939,8 +1217,8 @@ func TestDocument_InsertAt_Comment(t *testing.T) {
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	cn := &CommentNode{leafNode: newLeaf(NodeComment, "# between")}
-	ws := &WhitespaceNode{leafNode: newLeaf(NodeWhitespace, "\n")}
+	cn := &CommentNode{leafNode: newLeaf("# between")}
+	ws := &WhitespaceNode{leafNode: newLeaf("\n")}
 	if err := d.InsertAt(1, ws); err != nil {
 		t.Fatalf("InsertAt whitespace: %v", err)
 	}
@@ -1006,8 +1284,8 @@ func TestSetTrailingTrivia_RejectsNilElement(t *testing.T) {
 func TestSetLeadingTrivia_AcceptsValid(t *testing.T) {
 	kv, _ := NewKeyValue("key", NewString("val"))
 	nodes := []Node{
-		&CommentNode{leafNode: newLeaf(NodeComment, "# hello")},
-		&WhitespaceNode{leafNode: newLeaf(NodeWhitespace, "\n")},
+		&CommentNode{leafNode: newLeaf("# hello")},
+		&WhitespaceNode{leafNode: newLeaf("\n")},
 	}
 	if err := kv.SetLeadingTrivia(nodes); err != nil {
 		t.Fatalf("SetLeadingTrivia: %v", err)
@@ -1158,3 +1436,1489 @@ func TestArrayOfTables_AppendBlankLine(t *testing.T) {
 		t.Fatalf("expected %q, got %q", expected, got)
 	}
 }
+
+// --- NormalizeDatetimes tests ---
+
+func TestDocument_NormalizeDatetimes_ToUTC(t *testing.T) {
+	input := "# shipped logs\n" +
+		"a = 1979-05-27T00:32:00-07:00 # pacific\n" +
+		"b = 1979-05-27 07:32:00.250+05:30\n" +
+		"c = 1979-05-27T07:32:00Z\n" +
+		"local = 1979-05-27T07:32:00\n" +
+		"day = 1979-05-27\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if n := d.NormalizeDatetimes(true); n != 2 {
+		t.Fatalf("expected 2 rewrites, got %d", n)
+	}
+	want := "# shipped logs\n" +
+		"a = 1979-05-27T07:32:00Z # pacific\n" +
+		"b = 1979-05-27 02:02:00.250Z\n" +
+		"c = 1979-05-27T07:32:00Z\n" +
+		"local = 1979-05-27T07:32:00\n" +
+		"day = 1979-05-27\n"
+	if got := d.String(); got != want {
+		t.Fatalf("unexpected result:\n%s\nwant:\n%s", got, want)
+	}
+	if got := d.Get("a").RawVal(); got != "1979-05-27T07:32:00Z" {
+		t.Fatalf("expected RawVal to be updated, got %q", got)
+	}
+}
+
+func TestDocument_NormalizeDatetimes_NoSeconds(t *testing.T) {
+	d, err := Parse([]byte("a = 2024-01-01T01:30+02:00\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	d.NormalizeDatetimes(true)
+	if got := d.String(); got != "a = 2023-12-31T23:30Z\n" {
+		t.Fatalf("unexpected result: %q", got)
+	}
+}
+
+func TestDocument_NormalizeDatetimes_PreservesContainerLayout(t *testing.T) {
+	input := "times = [\n" +
+		"  1979-05-27T00:32:00-07:00, # first\n" +
+		"  1979-05-27T07:32:00Z,\n" +
+		"]\n" +
+		"window = { from = 2024-01-01T12:00:00+01:00,  to = 2024-01-01T13:00:00+01:00 }\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if n := d.NormalizeDatetimes(true); n != 3 {
+		t.Fatalf("expected 3 rewrites, got %d", n)
+	}
+	want := "times = [\n" +
+		"  1979-05-27T07:32:00Z, # first\n" +
+		"  1979-05-27T07:32:00Z,\n" +
+		"]\n" +
+		"window = { from = 2024-01-01T11:00:00Z,  to = 2024-01-01T12:00:00Z }\n"
+	if got := d.String(); got != want {
+		t.Fatalf("unexpected result:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// --- Container layout preservation tests ---
+
+func TestArrayNode_Append_PreservesMultiLineLayout(t *testing.T) {
+	d, err := Parse([]byte("a = [\n  1, # one\n  2\n]\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	arr := d.Get("a").Val().(*ArrayNode)
+	if err := arr.Append(NewInteger(3)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if got := d.String(); got != "a = [\n  1, # one\n  2,\n  3\n]\n" {
+		t.Fatalf("unexpected result: %q", got)
+	}
+	if got := d.Get("a").RawVal(); got != "[\n  1, # one\n  2,\n  3\n]" {
+		t.Fatalf("expected RawVal to be updated, got %q", got)
+	}
+}
+
+func TestArrayNode_Append_KeepsCommentsAndEmptyLayout(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"a = [\n  1, # one\n  2 # two\n]\n", "a = [\n  1, # one\n  2, # two\n  3\n]\n"},
+		{"a = [\n  1,\n  2, # two\n]\n", "a = [\n  1,\n  2, # two\n  3,\n]\n"},
+		{"a = [\r\n  1,\r\n  2\r\n]\r\n", "a = [\r\n  1,\r\n  2,\r\n  3\r\n]\r\n"},
+		{"a = [\n]\n", "a = [\n  3\n]\n"},
+		{"a = [ # none\n  ]\n", "a = [ # none\n    3\n  ]\n"},
+		{"a = []\n", "a = [3]\n"},
+	}
+	for _, tt := range tests {
+		d, err := Parse([]byte(tt.src))
+		if err != nil {
+			t.Fatalf("parse error: %v", err)
+		}
+		if err := d.Get("a").Val().(*ArrayNode).Append(NewInteger(3)); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+		if got := d.String(); got != tt.want {
+			t.Errorf("Append(3) to %q = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestArrayNode_Delete_PreservesLayout(t *testing.T) {
+	d, err := Parse([]byte("a = [ 1,  2,  3 ]\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	arr := d.Get("a").Val().(*ArrayNode)
+	if err := arr.Delete(0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got := d.String(); got != "a = [ 2,  3 ]\n" {
+		t.Fatalf("unexpected result: %q", got)
+	}
+	if err := arr.Delete(1); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got := d.String(); got != "a = [ 2 ]\n" {
+		t.Fatalf("unexpected result: %q", got)
+	}
+}
+
+func TestInlineTableNode_Append_PreservesLayout(t *testing.T) {
+	d, err := Parse([]byte("p = { x = 1,  y = 2 }\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	it := d.Get("p").Val().(*InlineTableNode)
+	kv, _ := NewKeyValue("z", NewInteger(3))
+	if err := it.Append(kv); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if got := d.String(); got != "p = { x = 1,  y = 2, z = 3 }\n" {
+		t.Fatalf("unexpected result: %q", got)
+	}
+}
+
+func TestSetValue_InsideArrayOfInlineTables(t *testing.T) {
+	d, err := Parse([]byte("pts = [ {x = 1}, {x = 2} ]\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	arr := d.Get("pts").Val().(*ArrayNode)
+	inner := arr.Element(1).(*InlineTableNode).Get("x")
+	if err := inner.SetValue(NewInteger(20)); err != nil {
+		t.Fatalf("SetValue: %v", err)
+	}
+	if got := d.String(); got != "pts = [ {x = 1}, {x = 20} ]\n" {
+		t.Fatalf("unexpected result: %q", got)
+	}
+}
+
+// --- SortKeys tests ---
+
+func TestNaturalOrder(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"server2", "server10", true},
+		{"server10", "server2", false},
+		{"a", "b", true},
+		{"key", "key1", true},
+		{"v1.2", "v1.10", true},
+		{"x02", "x2", false},
+		{"x2", "x02", true},
+		{"same", "same", false},
+	}
+	for _, tt := range tests {
+		if got := NaturalOrder(tt.a, tt.b); got != tt.want {
+			t.Errorf("NaturalOrder(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFoldCase(t *testing.T) {
+	less := FoldCase(ByteOrder)
+	if !less("apple", "Banana") {
+		t.Errorf("expected apple < Banana")
+	}
+	if ByteOrder("apple", "Banana") {
+		t.Errorf("expected byte order to put Banana first")
+	}
+	if !less("Key", "key") || less("key", "Key") {
+		t.Errorf("expected case-only ties to fall back to byte order")
+	}
+}
+
+func TestDocument_SortKeys(t *testing.T) {
+	input := "server10 = 1\n# second\nserver2 = 2\nalpha = 3\n\n[t]\nb = 1\na.y = 2\na.x = 3 # c\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	d.SortKeys(NaturalOrder)
+	want := "alpha = 3\n# second\nserver2 = 2\nserver10 = 1\n\n[t]\na.x = 3 # c\na.y = 2\nb = 1\n"
+	if got := d.String(); got != want {
+		t.Fatalf("unexpected result:\n got %q\nwant %q", got, want)
+	}
+	if _, err := Parse([]byte(d.String())); err != nil {
+		t.Fatalf("sorted output does not parse: %v", err)
+	}
+}
+
+func TestSortKeys_KeepsLineEndings(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"[t]\nb = 1\na = 2", "[t]\na = 2\nb = 1"},
+		{"b = 1\na = 2 # end", "a = 2 # end\nb = 1"},
+		{"[t]\r\nb = 1\r\na = 2\r\n", "[t]\r\na = 2\r\nb = 1\r\n"},
+	}
+	for _, tt := range tests {
+		d, err := Parse([]byte(tt.src))
+		if err != nil {
+			t.Fatalf("parse error: %v", err)
+		}
+		d.SortKeys(ByteOrder)
+		if got := d.String(); got != tt.want {
+			t.Errorf("SortKeys(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestInlineTableNode_SortKeys(t *testing.T) {
+	d, err := Parse([]byte("p = { Y = 1,  x = 2, z = 3 }\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	d.Get("p").Val().(*InlineTableNode).SortKeys(FoldCase(ByteOrder))
+	if got := d.String(); got != "p = { x = 2,  Y = 1, z = 3 }\n" {
+		t.Fatalf("unexpected result: %q", got)
+	}
+}
+
+// --- WithBatch tests ---
+
+func mustKeyValue(t *testing.T, key string, val Node) *KeyValue {
+	t.Helper()
+	kv, err := NewKeyValue(key, val)
+	if err != nil {
+		t.Fatalf("NewKeyValue(%q): %v", key, err)
+	}
+	return kv
+}
+
+func TestDocument_WithBatch(t *testing.T) {
+	doc, err := Parse([]byte("[t]\nx = 1\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	tbl := doc.Table("t")
+	err = doc.WithBatch(func(b *Batch) {
+		for i := range 3 {
+			b.InsertAt(i, mustKeyValue(t, fmt.Sprintf("k%d", i), NewInteger(int64(i))))
+		}
+		b.AppendTo(tbl, mustKeyValue(t, "y", NewInteger(2)))
+		if err := tbl.Append(mustKeyValue(t, "z", NewInteger(3))); err != nil {
+			t.Errorf("Append inside batch: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("WithBatch: %v", err)
+	}
+	want := "k0 = 0\nk1 = 1\nk2 = 2\n[t]\nx = 1\ny = 2\nz = 3\n"
+	if got := doc.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDocument_WithBatch_RollsBackOnInvalid(t *testing.T) {
+	src := "a = 1\n[t]\nx = 1\n"
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	tbl := doc.Table("t")
+	added := mustKeyValue(t, "y", NewInteger(2))
+	err = doc.WithBatch(func(b *Batch) {
+		b.AppendTo(tbl, added)
+		b.Append(mustKeyValue(t, "b", NewInteger(2)))
+		// Duplicate keys are only detected by the final validation.
+		b.AppendTo(tbl, mustKeyValue(t, "x", NewInteger(3)))
+	})
+	var pe *ParseError
+	if !errors.As(err, &pe) || !strings.Contains(pe.Message, "duplicate key") {
+		t.Fatalf("expected duplicate key error, got %v", err)
+	}
+	if got := doc.String(); got != src {
+		t.Errorf("document not restored:\n%s", got)
+	}
+	if added.Parent() != nil {
+		t.Error("rolled-back node still has a parent")
+	}
+	// Validation applies again after the batch.
+	if err := tbl.Append(mustKeyValue(t, "x", NewInteger(3))); err == nil {
+		t.Error("expected duplicate key error after batch")
+	}
+}
+
+func TestDocument_WithBatch_CallError(t *testing.T) {
+	doc, err := Parse([]byte("a = 1\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	err = doc.WithBatch(func(b *Batch) {
+		b.Append(mustKeyValue(t, "b", NewInteger(2)))
+		b.Append(nil)
+		if !errors.Is(b.Err(), ErrNilNode) {
+			t.Errorf("Err() = %v", b.Err())
+		}
+	})
+	if !errors.Is(err, ErrNilNode) {
+		t.Fatalf("expected ErrNilNode, got %v", err)
+	}
+	if got := doc.String(); got != "a = 1\n" {
+		t.Errorf("document not restored:\n%s", got)
+	}
+}
+
+func TestDocument_WithBatch_RollsBackEachMutation(t *testing.T) {
+	src := "# sha256:00\n# banner\n\na = 1 # one\n\n[t]\n# x doc\nx = 1\n# end of t\n\n[[job]]\ny = 2\n\n# footer\n"
+	tests := []struct {
+		name string
+		edit func(d *Document, b *Batch)
+	}{
+		{"append", func(d *Document, b *Batch) { b.Append(mustKeyValue(t, "b", NewInteger(2))) }},
+		{"insert", func(d *Document, b *Batch) { b.InsertAt(0, mustKeyValue(t, "b", NewInteger(2))) }},
+		{"append to table", func(d *Document, b *Batch) { b.AppendTo(d.Table("t"), mustKeyValue(t, "z", NewInteger(3))) }},
+		{"delete key", func(d *Document, b *Batch) { d.Delete("t.x") }},
+		{"delete table", func(d *Document, b *Batch) { d.DeleteTable("t") }},
+		{"delete keeping comments", func(d *Document, b *Batch) {
+			d.DeleteWithOptions("t.x", DeleteOptions{LeadingTrivia: TriviaReattach})
+		}},
+		{"delete tree", func(d *Document, b *Batch) { d.DeleteTree("t") }},
+		{"delete array-of-tables entry", func(d *Document, b *Batch) { d.DeleteAOTEntry("job", 0) }},
+		{"append comment", func(d *Document, b *Batch) { b.record(d.AppendComment("note")) }},
+		{"append table comment", func(d *Document, b *Batch) { b.record(d.Table("t").AppendComment("note")) }},
+		{"set body trivia", func(d *Document, b *Batch) { b.record(d.Table("t").SetTrailingBodyTrivia(nil)) }},
+		{"append raw", func(d *Document, b *Batch) { b.record(d.AppendRaw("[u]\nz = 3\n")) }},
+		{"checksum", func(d *Document, b *Batch) { SetChecksum(d) }},
+		{"header", func(d *Document, b *Batch) { b.record(d.EnsureHeader([]string{"new banner"})) }},
+	}
+	errStop := errors.New("stop")
+	for _, tt := range tests {
+		d := mustParse(t, src)
+		want := dumpTree(d)
+		err := d.WithBatch(func(b *Batch) {
+			tt.edit(d, b)
+			if d.String() == src {
+				t.Errorf("%s: edit did not change the document", tt.name)
+			}
+			b.record(errStop)
+		})
+		if !errors.Is(err, errStop) {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+		if got := dumpTree(d); got != want {
+			t.Errorf("%s: document not restored:\n%s\nwant:\n%s", tt.name, got, want)
+		}
+	}
+}
+
+// --- Edit tests ---
+
+func TestDocument_Edit(t *testing.T) {
+	src := "a = 0x10\n[srv]\nport = 80\ntls = { on = true }\n[db.main]\nhost = \"h\"\n[[job]]\nenv = { a = 1, b = 2 }\n"
+	edit := func(tx *Tx) error {
+		if err := tx.Set("a", NewInteger(1)); err != nil {
+			return err
+		}
+		if err := tx.Set("srv.tls.key", NewString("k")); err != nil {
+			return err
+		}
+		if _, ok := tx.Delete("job[0].env.a"); !ok {
+			return errors.New("delete failed")
+		}
+		if kv, ok := tx.Delete("srv.port"); !ok || kv.RawKey() != "port" {
+			return errors.New("delete failed")
+		}
+		if err := tx.Set("db.name", NewString("x")); err != nil {
+			return err
+		}
+		return tx.Set("db.user", NewString("u"))
+	}
+
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if err := doc.Edit(edit); err != nil {
+		t.Fatalf("Edit: %v", err)
+	}
+	want := "a = 1\n[srv]\ntls = { on = true, key = \"k\" }\n[db]\nname = \"x\"\nuser = \"u\"\n[db.main]\nhost = \"h\"\n[[job]]\nenv = { b = 2 }\n"
+	if got := doc.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The same edits followed by a failure leave the document untouched.
+	doc, _ = Parse([]byte(src))
+	port := doc.Get("srv.port")
+	fail := errors.New("abort")
+	err = doc.Edit(func(tx *Tx) error {
+		if err := edit(tx); err != nil {
+			return err
+		}
+		return fail
+	})
+	if !errors.Is(err, fail) {
+		t.Fatalf("Edit() = %v, want %v", err, fail)
+	}
+	if got := doc.String(); got != src {
+		t.Errorf("document not restored:\n%s", got)
+	}
+	if port.Parent() != doc.Table("srv") || doc.Get("job.env.a").Parent() == nil {
+		t.Error("deleted nodes were not reattached")
+	}
+	if err := doc.Validate(); err != nil {
+		t.Errorf("restored document is invalid: %v", err)
+	}
+}
+
+func TestDocument_Edit_InvalidResult(t *testing.T) {
+	src := "[t]\nx = 1\n"
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	err = doc.Edit(func(tx *Tx) error {
+		if err := tx.SetValue(doc.Get("t.x"), NewInteger(2)); err != nil {
+			return err
+		}
+		// Ignored by fn, but a failed change still aborts the edit.
+		_ = tx.Set("t.x.y", NewInteger(3))
+		return nil
+	})
+	if !errors.Is(err, ErrKeyConflict) {
+		t.Fatalf("Edit() = %v, want ErrKeyConflict", err)
+	}
+	if got := doc.String(); got != src {
+		t.Errorf("document not restored:\n%s", got)
+	}
+}
+
+// --- LogicalTable.Set tests ---
+
+func TestLogicalTable_Set(t *testing.T) {
+	src := `name = "app"
+
+[srv]
+timeout.read = 5
+tls = { on = true }
+
+[db.primary]
+host = "h"
+
+[[job]]
+id = 1
+[[job]]
+limits.cpu = 1
+id = 2
+`
+	tests := []struct {
+		table, key string
+		val        Node
+		want       string
+	}{
+		{"srv", "port", NewInteger(80), "tls = { on = true }\nport = 80\n\n[db.primary]"},
+		{"srv", "timeout.read", NewInteger(9), "timeout.read = 9\n"},
+		{"srv.timeout", "write", NewInteger(6), "timeout.read = 5\ntimeout.write = 6\n"},
+		{"srv.tls", "ca", NewString("x"), `tls = { on = true, ca = "x" }`},
+		{"srv", "log.level", NewString("info"), "tls = { on = true }\nlog.level = \"info\"\n"},
+		{"", "debug", NewBool(true), "name = \"app\"\ndebug = true\n\n[srv]"},
+		{"db", "pool", NewInteger(4), "[db]\npool = 4\n\n[db.primary]"},
+		{"job", "name", NewString("b"), "id = 2\nname = \"b\"\n"},
+		{"job.limits", "mem", NewInteger(2), "limits.cpu = 1\nlimits.mem = 2\nid = 2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.table+"/"+tt.key, func(t *testing.T) {
+			doc, err := Parse([]byte(src))
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			lt := doc.Resolve(tt.table)
+			if err := lt.Set(tt.key, tt.val); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			out := doc.String()
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("output missing %q:\n%s", tt.want, out)
+			}
+			if _, err := Parse([]byte(out)); err != nil {
+				t.Errorf("output does not reparse: %v\n%s", err, out)
+			}
+			if kv := lt.Get(tt.key); kv == nil || kv.Val() != tt.val {
+				t.Errorf("Get(%q) after Set = %v", tt.key, kv)
+			}
+		})
+	}
+}
+
+func TestLogicalTable_Set_Conflicts(t *testing.T) {
+	doc, err := Parse([]byte("a = 1\n[t.u]\nx = 1\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	root := doc.Resolve("")
+	if err := root.Set("t", NewInteger(1)); !errors.Is(err, ErrKeyConflict) {
+		t.Errorf("Set over a table: %v", err)
+	}
+	if err := root.Set("a.b", NewInteger(1)); !errors.Is(err, ErrKeyConflict) {
+		t.Errorf("Set through a value: %v", err)
+	}
+	if err := root.Set("", NewInteger(1)); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("Set with empty key: %v", err)
+	}
+}
+
+// --- Attach validation tests ---
+
+func TestDocument_Append_PopulatedTableConflict(t *testing.T) {
+	doc, err := Parse([]byte("a = 1\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	tbl, err := NewTable("srv")
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+	for _, kv := range []*KeyValue{
+		mustKeyValue(t, "port", NewInteger(80)),
+		mustKeyValue(t, "tls.on", NewBool(true)),
+	} {
+		if err := tbl.Append(kv); err != nil {
+			t.Fatalf("Append(%s): %v", kv.RawKey(), err)
+		}
+	}
+	conflict := mustKeyValue(t, "tls", NewBool(false))
+	if err := tbl.Append(conflict); !errors.Is(err, ErrKeyConflict) {
+		t.Fatalf("standalone Append(tls) = %v", err)
+	}
+	tbl.addEntry(conflict) // as a table built some other way might hold it
+	err = doc.Append(tbl)
+	var ee *EntryError
+	if !errors.As(err, &ee) {
+		t.Fatalf("expected *EntryError, got %v", err)
+	}
+	if ee.Index != 2 || ee.Key != "tls" || !errors.Is(err, ErrKeyConflict) {
+		t.Errorf("got %+v", ee)
+	}
+	if want := `entry 2 (tls): key "srv.tls" already used as a table via dotted keys`; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if doc.String() != "a = 1\n" || tbl.Parent() != nil {
+		t.Error("failed Append changed the document")
+	}
+	if err := doc.InsertAt(0, tbl); !errors.As(err, &ee) {
+		t.Errorf("InsertAt: expected *EntryError, got %v", err)
+	}
+}
+
+// --- Ownership tests ---
+
+func TestOwnership_RejectsReuse(t *testing.T) {
+	doc, err := Parse([]byte("[a]\n[b]\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	kv := mustKeyValue(t, "x", NewInteger(1))
+	if err := doc.Table("a").Append(kv); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := doc.Table("b").Append(kv); !errors.Is(err, ErrNodeAlreadyAttached) {
+		t.Errorf("second Append: %v", err)
+	}
+	if err := doc.Append(kv); !errors.Is(err, ErrNodeAlreadyAttached) {
+		t.Errorf("Document.Append: %v", err)
+	}
+	if _, err := NewKeyValue("y", kv.Val()); !errors.Is(err, ErrNodeAlreadyAttached) {
+		t.Errorf("NewKeyValue with attached value: %v", err)
+	}
+	arr, err := NewArray()
+	if err != nil {
+		t.Fatalf("NewArray: %v", err)
+	}
+	if err := arr.Append(kv.Val()); !errors.Is(err, ErrNodeAlreadyAttached) {
+		t.Errorf("ArrayNode.Append: %v", err)
+	}
+	if err := kv.SetValue(kv.Val()); err != nil {
+		t.Errorf("SetValue with own value: %v", err)
+	}
+	if got := doc.String(); got != "[a]\nx = 1\n[b]\n" {
+		t.Errorf("document changed:\n%s", got)
+	}
+}
+
+func TestDetach_MovesNode(t *testing.T) {
+	doc, err := Parse([]byte("[a]\nx = 1\ny = { p = 1, q = 2 }\n[b]\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	kv := doc.Get("a.x")
+	if !kv.Detach() {
+		t.Fatal("Detach returned false")
+	}
+	if kv.Detach() {
+		t.Error("second Detach returned true")
+	}
+	if err := doc.Table("b").Append(kv); err != nil {
+		t.Fatalf("Append after Detach: %v", err)
+	}
+	if !doc.Get("a.y.p").Detach() {
+		t.Fatal("Detach from inline table returned false")
+	}
+	tbl := doc.Table("a")
+	if !tbl.Detach() {
+		t.Fatal("Detach table returned false")
+	}
+	if err := doc.Append(tbl); err != nil {
+		t.Fatalf("Append table after Detach: %v", err)
+	}
+	if got, want := doc.String(), "[b]\nx = 1\n[a]\ny = { q = 2 }\n"; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDelete_ClearsParent(t *testing.T) {
+	doc, err := Parse([]byte("x = 1\n[a]\ny = 2\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	x, y := doc.Get("x"), doc.Get("a.y")
+	gotX, okX := doc.Delete("x")
+	gotY, okY := doc.Delete("a.y")
+	if !okX || !okY || gotX != x || gotY != y {
+		t.Fatal("Delete did not return the removed key-values")
+	}
+	if x.Parent() != nil || y.Parent() != nil {
+		t.Error("deleted key-values keep their parent")
+	}
+	if err := doc.Table("a").Append(x); err != nil {
+		t.Errorf("re-adding a deleted key-value: %v", err)
+	}
+}
+
+// --- TableOrImplicit / AddTable tests ---
+
+func TestTableOrImplicit_AddTable(t *testing.T) {
+	src := "[a.b]\nx = 1\n[a.c]\ny = 2\n[[job]]\nid = 1\n[job.env]\nk = 1\n[[job]]\nid = 2\n[z]\n"
+	tests := []struct {
+		table, name, want string
+	}{
+		{"a", "d", "[a.c]\ny = 2\n[a.d]\n[[job]]"},
+		{"a.b", "e.f", "[a.b]\nx = 1\n[a.b.e.f]\n[a.c]"},
+		{"job", "tags", "[[job]]\nid = 2\n[job.tags]\n[z]"},
+		{"z", "w", "[z]\n[z.w]\n"},
+	}
+	for _, tt := range tests {
+		doc, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatalf("parse error: %v", err)
+		}
+		lt := doc.TableOrImplicit(tt.table)
+		if lt == nil && tt.table != "job" {
+			t.Fatalf("TableOrImplicit(%q) = nil", tt.table)
+		}
+		if lt == nil {
+			lt = doc.Resolve(tt.table)
+		}
+		tbl, err := lt.AddTable(tt.name)
+		if err != nil {
+			t.Fatalf("AddTable(%q): %v", tt.name, err)
+		}
+		if out := doc.String(); !strings.Contains(out, tt.want) {
+			t.Errorf("%s.%s: output missing %q:\n%s", tt.table, tt.name, tt.want, out)
+		}
+		if tbl.Parent() != doc {
+			t.Error("new table is not attached")
+		}
+	}
+
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if doc.Table("a") != nil {
+		t.Fatal("Table(a) found an implicit table")
+	}
+	a := doc.TableOrImplicit("a")
+	if a == nil || !a.Implicit() || fmt.Sprint(a.Keys()) != "[b c]" {
+		t.Errorf("TableOrImplicit(a) = %v", a)
+	}
+	if doc.TableOrImplicit("a.b").Implicit() {
+		t.Error("a.b is explicit")
+	}
+	if doc.TableOrImplicit("job") != nil || doc.TableOrImplicit("a.b.x") != nil {
+		t.Error("TableOrImplicit returned a non-table")
+	}
+	if _, err := a.AddTable("b"); err == nil {
+		t.Error("AddTable of an existing table succeeded")
+	}
+}
+
+// --- Extension node tests ---
+
+type testExtension struct {
+	text   string
+	parent Node
+}
+
+var nodeTestExtension = RegisterNodeType("TestExtension")
+
+func (e *testExtension) Type() NodeType       { return nodeTestExtension }
+func (e *testExtension) Parent() Node         { return e.parent }
+func (e *testExtension) SetParent(n Node)     { e.parent = n }
+func (e *testExtension) Children() []Node     { return nil }
+func (e *testExtension) Text() string         { return e.text }
+func (e *testExtension) ValueType() ValueType { return TypeInteger }
+func (e *testExtension) Validate() error {
+	if e.text == "" {
+		return errors.New("empty extension")
+	}
+	return nil
+}
+
+func TestExtensionNode(t *testing.T) {
+	ext := &testExtension{text: "${PORT}"}
+	kv, err := NewKeyValue("port", ext)
+	if err != nil {
+		t.Fatalf("NewKeyValue: %v", err)
+	}
+	if ext.Parent() != kv {
+		t.Error("extension parent not set")
+	}
+	elem := &testExtension{text: "${HOST}"}
+	arr, err := NewArray(NewString("a"), elem)
+	if err != nil {
+		t.Fatalf("NewArray: %v", err)
+	}
+	doc := &Document{}
+	if err := doc.Append(kv); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Append(mustKeyValue(t, "hosts", arr)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := doc.String(), "port = ${PORT}\nhosts = [\"a\", ${HOST}]\n"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if kind, _ := doc.Index().KindOf("port"); kind != TypeInteger {
+		t.Errorf("KindOf(port) = %v", kind)
+	}
+	var seen bool
+	doc.Walk(func(n Node) bool {
+		seen = seen || n == elem
+		return true
+	})
+	if !seen {
+		t.Error("Walk did not visit the array element")
+	}
+	if nodeTestExtension.String() != "TestExtension" || NodeComment.String() != "Comment" {
+		t.Errorf("NodeType names: %v, %v", nodeTestExtension, NodeComment)
+	}
+
+	elem.text = ""
+	if err := doc.Validate(); err == nil || !strings.Contains(err.Error(), "empty extension") {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	doc, err = Parse([]byte("x = 1\ny = 2\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if err := doc.Get("y").SetValue(&testExtension{}); err != nil {
+		t.Fatal(err)
+	}
+	err = doc.Validate()
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Line != 2 || pe.Token != "y" {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+// --- Dry-run tests ---
+
+func TestDocument_CanSet(t *testing.T) {
+	src := "a = 1\n[srv]\nport = 80\ntls.on = true\n[[job]]\nid = 1\n"
+	tests := []struct {
+		path string
+		want error
+	}{
+		{"a", nil},
+		{"b", nil},
+		{"srv.host", nil},
+		{"srv.tls.cert", nil},
+		{"job.name", nil},
+		{"new.table.key", nil},
+		{"srv", ErrKeyConflict},
+		{"srv.tls", ErrKeyConflict},
+		{"a.x", ErrKeyConflict},
+		{"srv.port.x", ErrKeyConflict},
+		{"", ErrEmptyKey},
+	}
+	for _, tt := range tests {
+		doc, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatalf("parse error: %v", err)
+		}
+		val := NewString("v")
+		err = doc.CanSet(tt.path, val)
+		if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("CanSet(%q) = %v, want %v", tt.path, err, tt.want)
+		}
+		if doc.String() != src || val.Parent() != nil {
+			t.Errorf("CanSet(%q) modified the document", tt.path)
+		}
+		if setErr := doc.Resolve("").Set(tt.path, val); (setErr == nil) != (err == nil) {
+			t.Errorf("CanSet(%q) = %v but Set returned %v", tt.path, err, setErr)
+		}
+	}
+
+	doc, _ := Parse([]byte(src))
+	attached := doc.Get("srv.port").Val()
+	if err := doc.CanSet("b", attached); !errors.Is(err, ErrNodeAlreadyAttached) {
+		t.Errorf("CanSet(attached value) = %v", err)
+	}
+	if err := doc.CanSet("srv.port", attached); err != nil {
+		t.Errorf("CanSet(same value) = %v", err)
+	}
+	if err := doc.CanSet("b", mustKeyValue(t, "x", NewInteger(1))); !errors.Is(err, ErrInvalidValueType) {
+		t.Errorf("CanSet(key-value) = %v", err)
+	}
+}
+
+func TestDocument_CanDelete_CanAppend(t *testing.T) {
+	src := "a = 1\n[srv]\nport = 80\n[[job]]\nid = 1\n"
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	for path, ok := range map[string]bool{"a": true, "srv.port": true, "job[0].id": true, "srv": false, "b": false} {
+		if err := doc.CanDelete(path); (err == nil) != ok || (!ok && !errors.Is(err, ErrKeyNotFound)) {
+			t.Errorf("CanDelete(%q) = %v", path, err)
+		}
+	}
+
+	dup, _ := NewTable("srv")
+	fresh, _ := NewTable("db")
+	comment, _ := NewComment("# c")
+	if err := doc.CanAppend(dup); err == nil {
+		t.Error("CanAppend(duplicate table) = nil")
+	}
+	kv := mustKeyValue(t, "a", NewInteger(2))
+	if err, appendErr := doc.CanAppend(kv), doc.Append(kv); err == nil || err.Error() != appendErr.Error() {
+		t.Errorf("CanAppend(duplicate key) = %v, Append = %v", err, appendErr)
+	}
+	if err := doc.CanAppend(fresh); err != nil {
+		t.Errorf("CanAppend(new table) = %v", err)
+	}
+	if err := doc.CanAppend(comment); err != nil {
+		t.Errorf("CanAppend(comment) = %v", err)
+	}
+	if err := doc.CanAppend(doc.Table("srv")); !errors.Is(err, ErrNodeAlreadyAttached) {
+		t.Errorf("CanAppend(attached) = %v", err)
+	}
+	if doc.String() != src || fresh.Parent() != nil {
+		t.Error("dry run modified the document")
+	}
+}
+
+// --- CommentOut / Uncomment tests ---
+
+func TestDocument_CommentOut(t *testing.T) {
+	src := "# Name.\nname = \"x\" # required\n\n[server]\n  port = 80\nhosts = [\n  \"a\",\n]\n\n[other]\n"
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"name", "# Name.\n# name = \"x\" # required\n\n[server]\n  port = 80\nhosts = [\n  \"a\",\n]\n\n[other]\n"},
+		{"server.port", "# Name.\nname = \"x\" # required\n\n[server]\n  # port = 80\nhosts = [\n  \"a\",\n]\n\n[other]\n"},
+		{"server.hosts", "# Name.\nname = \"x\" # required\n\n[server]\n  port = 80\n# hosts = [\n#   \"a\",\n# ]\n\n[other]\n"},
+	}
+	for _, tt := range tests {
+		d, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.CommentOut(tt.path); err != nil {
+			t.Fatalf("CommentOut(%q): %v", tt.path, err)
+		}
+		if got := d.String(); got != tt.want {
+			t.Errorf("CommentOut(%q) =\n%q\nwant\n%q", tt.path, got, tt.want)
+		}
+		if d.Get(tt.path) != nil {
+			t.Errorf("Get(%q) after CommentOut found a key", tt.path)
+		}
+		if err := d.Uncomment(tt.path); err != nil {
+			t.Fatalf("Uncomment(%q): %v", tt.path, err)
+		}
+		if got := d.String(); got != src {
+			t.Errorf("Uncomment(%q) =\n%q\nwant\n%q", tt.path, got, src)
+		}
+		if d.Get(tt.path) == nil {
+			t.Errorf("Get(%q) after Uncomment = nil", tt.path)
+		}
+		if err := d.Validate(); err != nil {
+			t.Errorf("Validate() after Uncomment(%q): %v", tt.path, err)
+		}
+	}
+}
+
+func TestDocument_Uncomment(t *testing.T) {
+	src := "# Port.\n# port = 8080\nhost = \"h\"\n\n[tls]\nkey = 1\n# cert = \"c\"\n\n[log]\n# level = 1\n"
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"port", "# Port.\nport = 8080\nhost = \"h\"\n\n[tls]\nkey = 1\n# cert = \"c\"\n\n[log]\n# level = 1\n"},
+		{"tls.cert", "# Port.\n# port = 8080\nhost = \"h\"\n\n[tls]\nkey = 1\ncert = \"c\"\n\n[log]\n# level = 1\n"},
+		{"log.level", "# Port.\n# port = 8080\nhost = \"h\"\n\n[tls]\nkey = 1\n# cert = \"c\"\n\n[log]\nlevel = 1\n"},
+	}
+	for _, tt := range tests {
+		d, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Uncomment(tt.path); err != nil {
+			t.Fatalf("Uncomment(%q): %v", tt.path, err)
+		}
+		if got := d.String(); got != tt.want {
+			t.Errorf("Uncomment(%q) =\n%q\nwant\n%q", tt.path, got, tt.want)
+		}
+		if kv := d.Get(tt.path); kv == nil {
+			t.Errorf("Get(%q) = nil", tt.path)
+		}
+	}
+	d, _ := Parse([]byte("[t]\n"))
+	_ = d.AppendComment("x = 1")
+	if err := d.Uncomment("t.x"); err != nil || d.String() != "[t]\nx = 1\n" || d.Table("t").Get("x") == nil {
+		t.Errorf("Uncomment of an appended comment = %v, doc %q", err, d.String())
+	}
+	d, _ = Parse([]byte("a = 1\n# a = 2\nb = 3\n"))
+	if err := d.Uncomment("a"); err == nil || d.String() != "a = 1\n# a = 2\nb = 3\n" {
+		t.Errorf("Uncomment of a duplicate = %v, doc %q", err, d.String())
+	}
+	if err := d.Uncomment("tls.cert"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Uncomment(missing) = %v, want ErrKeyNotFound", err)
+	}
+	if err := d.CommentOut("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("CommentOut(missing) = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestCommentNode_TryParseKeyValue(t *testing.T) {
+	tests := []struct {
+		text string
+		key  string
+		val  string
+	}{
+		{"# port = 8080", "port", "8080"},
+		{"#a.b=\"x\" # note", "a.b", `"x"`},
+		{"#   indented = true", "indented", "true"},
+		{"# hosts = [", "", ""},
+		{"# Listen port.", "", ""},
+		{"# [server]", "", ""},
+		{"# a = 1 b = 2", "", ""},
+	}
+	for _, tt := range tests {
+		c, err := NewComment(tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kv, ok := c.TryParseKeyValue()
+		if ok != (tt.key != "") {
+			t.Errorf("TryParseKeyValue(%q) ok = %v", tt.text, ok)
+			continue
+		}
+		if ok && (kv.RawKey() != tt.key || kv.Val().Text() != tt.val || kv.Parent() != nil) {
+			t.Errorf("TryParseKeyValue(%q) = %q = %q", tt.text, kv.RawKey(), kv.Val().Text())
+		}
+	}
+}
+
+// --- Trailing comment layout tests ---
+
+func TestKeyValue_SetValue_TrailingComment(t *testing.T) {
+	d, err := Parse([]byte("a = 1#one\nb = 2 # two\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Get("a").SetValue(NewInteger(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Get("b").SetValue(NewInteger(200)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.String(), "a = 100 #one\nb = 200 # two\n"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestKeyValue_SetValueAligned(t *testing.T) {
+	src := "port = 80      # HTTP\nhost = \"x\"     # name\ntab = 1\t# tab\nnone = 1\n"
+	tests := []struct {
+		key  string
+		val  Node
+		want string
+	}{
+		{"port", NewInteger(8080), "port = 8080    # HTTP\n"},
+		{"port", NewString("a very long value"), "port = \"a very long value\" # HTTP\n"},
+		{"host", NewString("héllo"), "host = \"héllo\" # name\n"},
+		{"tab", NewInteger(100), "tab = 100\t# tab\n"},
+		{"none", NewInteger(2), "none = 2\n"},
+	}
+	for _, tt := range tests {
+		d, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		kv := d.Get(tt.key)
+		if err := kv.SetValueAligned(tt.val); err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		serializeKeyValue(&b, kv)
+		if got := b.String(); got != tt.want {
+			t.Errorf("SetValueAligned(%s) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+// --- AppendRaw tests ---
+
+func TestDocument_AppendRaw(t *testing.T) {
+	d, err := Parse([]byte("a = 1\n\n[server]\nport = 80"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := "host   =  'h'  # pasted\n\n# Logging.\n[log]\nlevel = \"info\"\n"
+	if err := d.AppendRaw(raw); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.String(), "a = 1\n\n[server]\nport = 80\n"+raw; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if d.Get("server.host") == nil || d.Get("log.level") == nil {
+		t.Error("appended keys not found")
+	}
+	before := d.String()
+	if err := d.AppendRaw("[log]\nx = 1\n"); err == nil {
+		t.Error("AppendRaw of a duplicate table succeeded")
+	}
+	if err := d.AppendRaw("level = 2\n"); err == nil {
+		t.Error("AppendRaw of a duplicate key succeeded")
+	}
+	var pe *ParseError
+	if err := d.AppendRaw("x = \n"); !errors.As(err, &pe) {
+		t.Errorf("AppendRaw of invalid TOML = %v, want *ParseError", err)
+	}
+	if d.String() != before {
+		t.Errorf("failed AppendRaw changed the document: %q", d.String())
+	}
+	if err := d.AppendRaw("x = 1\n"); err != nil || d.Table("log").Get("x") == nil {
+		t.Errorf("AppendRaw after failures = %v", err)
+	}
+}
+
+// --- Extract tests ---
+
+func TestDocument_Extract(t *testing.T) {
+	d := mustParse(t, `name = "app"
+
+[server.tls]   # certificates
+cert = "a.pem"
+
+# The server.
+[server]
+host = "localhost"  # local only
+  [ server . limits ]
+  max = 10
+
+[[server.routes]]
+path = "/"
+
+[db]
+pool = { size = 4, opts = { x = 1 } }
+`)
+	got, err := d.Extract("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# The server.
+host = "localhost"  # local only
+
+[tls]   # certificates
+cert = "a.pem"
+  [ limits ]
+  max = 10
+
+[[routes]]
+path = "/"
+`
+	if got.String() != want {
+		t.Errorf("Extract(server) = %q, want %q", got.String(), want)
+	}
+
+	got, err = d.Extract("db.pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "size = 4\nopts = { x = 1 }\n"; got.String() != want {
+		t.Errorf("Extract(db.pool) = %q, want %q", got.String(), want)
+	}
+	if got, err := d.Extract("db.pool.opts"); err != nil || got.String() != "x = 1\n" {
+		t.Errorf("Extract(db.pool.opts) = %q, %v", got, err)
+	}
+
+	dotted := mustParse(t, "svc.a = 1\n[top]\nsvc.b = 2 # two\n[svc.c]\nd = 3\n")
+	if got, err := dotted.Extract("svc"); err != nil || got.String() != "a = 1\n[c]\nd = 3\n" {
+		t.Errorf("Extract of a dotted-key table = %q, %v", got, err)
+	}
+
+	for path, want := range map[string]error{
+		"missing":         ErrKeyNotFound,
+		"":                ErrKeyNotFound,
+		"name":            ErrTypeMismatch,
+		"server.routes":   ErrTypeMismatch,
+		"server.routes.x": ErrTypeMismatch,
+	} {
+		if _, err := d.Extract(path); !errors.Is(err, want) {
+			t.Errorf("Extract(%q) error = %v, want %v", path, err, want)
+		}
+	}
+}
+
+// --- Graft tests ---
+
+func TestDocument_Graft(t *testing.T) {
+	sub := mustParse(t, "# Listener.\nhost = \"h\"\n\n[tls]  # certs\ncert = \"a.pem\"\n\n[[routes]]\npath = \"/\"\n")
+	d := mustParse(t, "name = \"app\"")
+	if err := d.Graft("server", sub); err != nil {
+		t.Fatal(err)
+	}
+	want := "name = \"app\"\n[server]\n# Listener.\nhost = \"h\"\n\n[server.tls]  # certs\ncert = \"a.pem\"\n\n[[server.routes]]\npath = \"/\"\n"
+	if d.String() != want {
+		t.Errorf("Graft = %q, want %q", d.String(), want)
+	}
+	if sub.String() != "# Listener.\nhost = \"h\"\n\n[tls]  # certs\ncert = \"a.pem\"\n\n[[routes]]\npath = \"/\"\n" {
+		t.Errorf("Graft changed sub: %q", sub.String())
+	}
+	if back, err := d.Extract("server"); err != nil || back.String() != sub.String() {
+		t.Errorf("Extract after Graft = %q, %v", back, err)
+	}
+
+	d = mustParse(t, "[db]\nhost = \"x\"\n\n[log]\nlevel = 1\n")
+	if err := d.Graft("db", mustParse(t, "port = 5432\n[pool]\nsize = 4\n")); err != nil {
+		t.Fatal(err)
+	}
+	want = "[db]\nhost = \"x\"\nport = 5432\n\n[log]\nlevel = 1\n[db.pool]\nsize = 4\n"
+	if d.String() != want {
+		t.Errorf("Graft into an existing table = %q, want %q", d.String(), want)
+	}
+
+	before := d.String()
+	if err := d.Graft("db", mustParse(t, "host = \"y\"\n")); err == nil {
+		t.Error("Graft of a duplicate key succeeded")
+	}
+	if err := d.Graft("log", mustParse(t, "[x]\na = 1\n[level]\nb = 2\n")); err == nil {
+		t.Error("Graft of a table over a value succeeded")
+	}
+	if d.String() != before || d.Get("log.x.a") != nil {
+		t.Errorf("failed Graft changed the document: %q", d.String())
+	}
+	if err := d.Graft("", sub); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("Graft at an empty path = %v", err)
+	}
+}
+
+// --- Rebase tests ---
+
+func TestDocument_Rebase(t *testing.T) {
+	d := mustParse(t, "# App.\nname = \"x\"  # the name\nlog . level = 1\n\n[ server ]\nport = 80\n\n[[server . routes]]\npath = \"/\"\n")
+	if err := d.Rebase("app"); err != nil {
+		t.Fatal(err)
+	}
+	want := "# App.\napp.name = \"x\"  # the name\napp.log . level = 1\n\n[ app.server ]\nport = 80\n\n[[app.server . routes]]\npath = \"/\"\n"
+	if d.String() != want {
+		t.Errorf("Rebase = %q, want %q", d.String(), want)
+	}
+	if d.Get("app.server.port") == nil || d.Get("app.log.level") == nil {
+		t.Error("rebased keys not found")
+	}
+	if err := d.Rebase(`"my app".v1`); err != nil {
+		t.Fatal(err)
+	}
+	if d.Get(`"my app".v1.app.server.routes.path`) == nil {
+		t.Errorf("second Rebase = %q", d.String())
+	}
+	if err := d.Rebase(""); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("Rebase(\"\") = %v", err)
+	}
+}
+
+// --- Flatten / Unflatten tests ---
+
+func TestDocument_Flatten(t *testing.T) {
+	src := `# Top.
+name = "app"
+
+# Server settings.
+[server]  # main
+host = "h"  # host
+tls = { cert = "a.pem", key = "k" }
+
+[empty]
+
+[[server.routes]]
+path = "/"
+[server.routes.opts]
+x = 1
+
+[[server.routes]]
+path = "/b"
+`
+	d := mustParse(t, src)
+	flat := d.Flatten()
+	want := `# Top.
+name = "app"
+
+# Server settings.
+# main
+server.host = "h"  # host
+server.tls.cert = "a.pem"
+server.tls.key = "k"
+
+empty = {}
+
+server.routes = [
+  { path = "/", opts = { x = 1 } },
+  { path = "/b" },
+]
+`
+	if flat.String() != want {
+		t.Errorf("Flatten = %q, want %q", flat.String(), want)
+	}
+	if d.String() != src {
+		t.Error("Flatten changed the document")
+	}
+	if changes := Diff(d, flat); len(changes) != 0 {
+		t.Errorf("Flatten changed values: %v", changes)
+	}
+
+	un := flat.Unflatten(0)
+	want = `# Top.
+name = "app"
+
+empty = {}
+
+[server]
+# Server settings.
+# main
+host = "h"  # host
+
+[server.tls]
+cert = "a.pem"
+key = "k"
+
+[[server.routes]]
+path = "/"
+opts = { x = 1 }
+
+[[server.routes]]
+path = "/b"
+`
+	if un.String() != want {
+		t.Errorf("Unflatten(0) = %q, want %q", un.String(), want)
+	}
+	if changes := Diff(d, un); len(changes) != 0 {
+		t.Errorf("Unflatten changed values: %v", changes)
+	}
+
+	un = d.Unflatten(1)
+	if un.Table("server") == nil || un.Table("server.tls") != nil || un.Get("server.tls.cert") == nil ||
+		len(un.ArrayOfTables("server.routes")) != 0 {
+		t.Errorf("Unflatten(1) = %q", un.String())
+	}
+	if changes := Diff(d, un); len(changes) != 0 {
+		t.Errorf("Unflatten(1) changed values: %v", changes)
+	}
+
+	crlf := func(s string) string { return strings.ReplaceAll(s, "\n", "\r\n") }
+	d = mustParse(t, crlf(src))
+	if got := d.Flatten().String(); got != crlf(flat.String()) {
+		t.Errorf("Flatten of a CRLF document = %q", got)
+	}
+	if got := d.Unflatten(0).String(); got != crlf(want) {
+		t.Errorf("Unflatten(0) of a CRLF document = %q", got)
+	}
+}
+
+func TestAOTWriter(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("version = 3\n\n")
+	w, err := NewAOTWriter(&b, "package")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"serde", "toml"} {
+		n, _ := NewKeyValue("name", NewString(name))
+		v, _ := NewKeyValue("version", NewString(fmt.Sprintf("1.%d.0", i)))
+		c, _ := NewComment("# pinned")
+		nl, _ := NewWhitespace("\n")
+		src, err := NewKeyValueFull(KeyValueOptions{Key: "source.git", Value: NewString("url"), LeadingTrivia: []Node{c, nl}, PreEq: " ", PostEq: " "})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteEntry(n, v, src); err != nil {
+			t.Fatalf("WriteEntry: %v", err)
+		}
+	}
+	want := "version = 3\n\n[[package]]\nname = \"serde\"\nversion = \"1.0.0\"\n# pinned\nsource.git = \"url\"\n" +
+		"\n[[package]]\nname = \"toml\"\nversion = \"1.1.0\"\n# pinned\nsource.git = \"url\"\n"
+	if b.String() != want {
+		t.Fatalf("got\n%q\nwant\n%q", b.String(), want)
+	}
+	d := mustParse(t, b.String())
+	if got := len(d.ArrayOfTables("package")); got != 2 || w.Len() != 2 {
+		t.Errorf("parsed %d entries, Len() = %d", got, w.Len())
+	}
+
+	a, _ := NewKeyValue("a", NewInteger(1))
+	ab, _ := NewKeyValue("a.b", NewInteger(2))
+	for _, tt := range []struct {
+		kvs  []*KeyValue
+		want error
+	}{
+		{[]*KeyValue{a, a}, ErrDuplicateKey},
+		{[]*KeyValue{a, ab}, ErrKeyConflict},
+		{[]*KeyValue{ab, a}, ErrKeyConflict},
+		{[]*KeyValue{a, nil}, ErrNilEntry},
+	} {
+		if err := w.WriteEntry(tt.kvs...); !errors.Is(err, tt.want) {
+			t.Errorf("WriteEntry() = %v, want %v", err, tt.want)
+		}
+	}
+	if b.String() != want {
+		t.Errorf("failed WriteEntry wrote %q", strings.TrimPrefix(b.String(), want))
+	}
+	if _, err := NewAOTWriter(&b, "a..b"); err == nil {
+		t.Error("NewAOTWriter accepted an invalid key")
+	}
+}
+
+// --- RenameKey tests ---
+
+func TestDocument_RenameKey(t *testing.T) {
+	d := mustParse(t, `server.host = "a" # host
+owner = { server = 1 }
+
+[server.tls]
+cert = "x"
+
+[[server.plugin]]
+id = 1
+`)
+	if err := d.RenameKey("server", "http-server"); err != nil {
+		t.Fatalf("RenameKey: %v", err)
+	}
+	want := `http-server.host = "a" # host
+owner = { server = 1 }
+
+[http-server.tls]
+cert = "x"
+
+[[http-server.plugin]]
+id = 1
+`
+	if got := d.String(); got != want {
+		t.Errorf("after RenameKey:\n%s\nwant\n%s", got, want)
+	}
+	if err := d.RenameKey("owner.server", "my server"); err != nil {
+		t.Fatalf("RenameKey inline: %v", err)
+	}
+	if !strings.Contains(d.String(), `owner = { "my server" = 1 }`) {
+		t.Errorf("inline key not renamed:\n%s", d.String())
+	}
+	if err := d.RenameKey("nope", "x"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("RenameKey(nope) = %v, want ErrKeyNotFound", err)
+	}
+	before := d.String()
+	if err := d.RenameKey("http-server.tls", "plugin"); err == nil {
+		t.Error("RenameKey onto an existing key succeeded")
+	}
+	if got := d.String(); got != before {
+		t.Errorf("failed RenameKey changed the document:\n%s", got)
+	}
+}
+
+func TestDocument_RenameAt(t *testing.T) {
+	src := `[servers.primary] # main
+host = "a"
+owner = {  name = "ops", team.id = 1 }
+
+[servers . backup]
+host = "b"
+
+[routes]
+default = "servers.primary"
+fallback = ['servers.primary.host', "servers.backup"]
+other = "servers.primaryx"
+`
+	apply := func(edits []TextEdit) string {
+		out := src
+		for i := len(edits) - 1; i >= 0; i-- {
+			e := edits[i]
+			out = out[:e.Span.Start] + e.NewText + out[e.Span.End:]
+		}
+		return out
+	}
+
+	d := mustParse(t, src)
+	edits, err := d.RenameAtWithOptions(strings.Index(src, "primary]"), "main", RenameOptions{References: true})
+	if err != nil {
+		t.Fatalf("RenameAt header: %v", err)
+	}
+	want := strings.NewReplacer(`"servers.primary"`, `"servers.main"`, `'servers.primary.host'`, `'servers.main.host'`,
+		"[servers.primary]", "[servers.main]").Replace(src)
+	if got := d.String(); got != want {
+		t.Errorf("after RenameAt:\n%s\nwant\n%s", got, want)
+	}
+	if got := apply(edits); got != want || len(edits) != 3 {
+		t.Errorf("%d edits %v give\n%s", len(edits), edits, got)
+	}
+
+	// A key inside an inline table, with the cursor just after it.
+	d = mustParse(t, src)
+	edits, err = d.RenameAt(strings.Index(src, "team")+len("team"), "group")
+	if err != nil {
+		t.Fatalf("RenameAt inline: %v", err)
+	}
+	if got := apply(edits); got != d.String() || !strings.Contains(got, "group.id = 1 }") {
+		t.Errorf("edits %v give\n%s\nwant\n%s", edits, got, d.String())
+	}
+
+	d = mustParse(t, src)
+	edits, err = d.RenameAt(strings.Index(src, "backup"), "spare")
+	if err != nil || len(edits) != 1 || apply(edits) != strings.Replace(src, "backup]", "spare]", 1) {
+		t.Errorf("RenameAt spaced header = %v, %v", edits, err)
+	}
+
+	for _, at := range []string{`"a"`, "# main", "\n\n"} {
+		if _, err := d.RenameAt(strings.Index(src, at), "x"); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("RenameAt(%q) = %v, want ErrKeyNotFound", at, err)
+		}
+	}
+	before := d.String()
+	if _, err := d.RenameAt(strings.Index(src, "other"), "default"); err == nil || d.String() != before {
+		t.Errorf("RenameAt onto an existing key = %v, document:\n%s", err, d.String())
+	}
+}
+
+func TestParseValueText(t *testing.T) {
+	val, err := parseValueText(`[1, "a"] # note`)
+	if err != nil {
+		t.Fatalf("parseValueText: %v", err)
+	}
+	if val.Parent() != nil || val.Text() != `[1, "a"]` {
+		t.Errorf("parseValueText = %q with parent %v", val.Text(), val.Parent())
+	}
+	d := mustParse(t, "a = 1\n")
+	if err := d.Get("a").SetValue(val); err != nil || d.String() != "a = [1, \"a\"]\n" {
+		t.Errorf("SetValue(parsed) = %v, %q", err, d.String())
+	}
+	for _, bad := range []string{"", "1\nb = 2", "x"} {
+		if _, err := parseValueText(bad); err == nil {
+			t.Errorf("parseValueText(%q) succeeded", bad)
+		}
+	}
+}
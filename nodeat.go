@@ -0,0 +1,118 @@
+package toml
+
+import (
+	"slices"
+	"sort"
+)
+
+// NodeAt returns the deepest node that covers the byte offset in the text
+// produced by String, and its ancestors from its parent up to the
+// document, for editor features such as hover and context menus. A node
+// covers its span and the spans of its children: a key-value its comments,
+// key, and value, and a table its header, comments, and entries. The
+// newlines between nodes are covered by the enclosing table or the
+// document. Offsets are clamped to the text; the end of the text gives the
+// document with no ancestors.
+func (d *Document) NodeAt(offset int) (Node, []Node) {
+	return d.nodeAt(d.textLayout().spans, offset)
+}
+
+// nodeAt is NodeAt given the document's spans.
+func (d *Document) nodeAt(spans map[Node]Span, offset int) (Node, []Node) {
+	offset = max(0, min(offset, spans[d].End))
+	var ancestors []Node
+	var n Node = d
+	for {
+		c := childAt(n, spans, offset)
+		if c == nil {
+			break
+		}
+		ancestors = append(ancestors, n)
+		n = c
+	}
+	slices.Reverse(ancestors)
+	return n, ancestors
+}
+
+// NodeAtPosition is NodeAt for a 1-indexed line and byte column, as in
+// Position.Line and Position.Column.
+func (d *Document) NodeAtPosition(line, col int) (Node, []Node) {
+	l := d.textLayout()
+	return d.nodeAt(l.spans, l.offset(line, col))
+}
+
+// docLayout is where a document's nodes and lines lie in its text.
+type docLayout struct {
+	spans  map[Node]Span
+	text   string
+	starts []int // offset of each line, as from lineStarts
+}
+
+// textLayout returns d's layout, building it on first use after a change.
+func (d *Document) textLayout() *docLayout {
+	if l := d.derived.layout.Load(); l != nil {
+		return l
+	}
+	text := d.String()
+	l := &docLayout{spans: d.Spans(), text: text, starts: lineStarts(text)}
+	d.derived.layout.Store(l)
+	return l
+}
+
+// offset is lineColOffset for the layout's text.
+func (l *docLayout) offset(line, col int) int {
+	if line > len(l.starts) {
+		return len(l.text)
+	}
+	return min(l.starts[max(line, 1)-1]+max(col-1, 0), len(l.text))
+}
+
+// childAt returns the child of n whose extent contains offset, or nil.
+// The top-level nodes are searched by their start, as they follow each
+// other without gaps.
+func childAt(n Node, spans map[Node]Span, offset int) Node {
+	if d, ok := n.(*Document); ok {
+		nodes := d.Children()
+		i := sort.Search(len(nodes), func(i int) bool { return extent(nodes[i], spans).Start > offset }) - 1
+		if i >= 0 && covers(extent(nodes[i], spans), offset) {
+			return nodes[i]
+		}
+		return nil
+	}
+	var found Node
+	eachChild(n, func(c Node) bool {
+		if covers(extent(c, spans), offset) {
+			found = c
+		}
+		return found == nil
+	})
+	return found
+}
+
+// extent returns the span of n widened to its trivia and entries, which
+// lie outside the span of key-values and headers.
+func extent(n Node, spans map[Node]Span) Span {
+	ext := spans[n]
+	var lists [][]Node
+	switch v := n.(type) {
+	case *KeyValue:
+		lists = [][]Node{v.leading(), v.trailing()}
+	case *TableNode:
+		lists = [][]Node{v.leading(), v.trailing(), v.entries, v.bodyTrivia}
+	case *ArrayOfTables:
+		lists = [][]Node{v.leading(), v.trailing(), v.entries, v.bodyTrivia}
+	}
+	for _, list := range lists {
+		if len(list) > 0 {
+			ext.Start = min(ext.Start, extent(list[0], spans).Start)
+			ext.End = max(ext.End, extent(list[len(list)-1], spans).End)
+		}
+	}
+	return ext
+}
+
+// covers reports whether offset lies within sp. Unlike Span.Contains, an
+// empty span covers nothing.
+func covers(sp Span, offset int) bool {
+	return offset >= sp.Start && offset < sp.End
+}
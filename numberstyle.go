@@ -0,0 +1,135 @@
+package toml
+
+import "strings"
+
+// NumberStyleOptions configures the NumberStyle lint rule.
+type NumberStyleOptions struct {
+	// GroupDigits is the number of digits from which a decimal integer
+	// should be grouped in threes with underscores, as in 1_000_000. Zero
+	// means 6, and a negative value turns the check off.
+	GroupDigits int
+
+	// UpperHex asks for hexadecimal digits A to F instead of a to f.
+	UpperHex bool
+
+	// UpperExponent asks for floats such as 1E6 instead of 1e6.
+	UpperExponent bool
+}
+
+// NumberStyle returns a lint rule named "number-style" that reports
+// numbers which are valid TOML but written in a style other than the one
+// opts asks for: a leading "+", hexadecimal digits or a float exponent in
+// the other case, or a large decimal integer without digit grouping. Each
+// finding is about a number node and has a Fix that rewrites it in the
+// requested style, keeping its value.
+func NumberStyle(opts NumberStyleOptions) LintRule {
+	if opts.GroupDigits == 0 {
+		opts.GroupDigits = 6
+	}
+	return LintRule{
+		Name: "number-style",
+		Check: func(doc *Document) []LintFinding {
+			var out []LintFinding
+			for path, kv := range doc.Leaves() {
+				eachNumber(kv.val, func(num *NumberNode) {
+					if _, issues := opts.restyle(num.text); len(issues) > 0 {
+						f := findingAt(path, kv, "%s: %s", num.text, strings.Join(issues, ", "))
+						f.Node, f.Fix = num, func() error { return opts.fix(num) }
+						out = append(out, f)
+					}
+				})
+			}
+			return out
+		},
+	}
+}
+
+// eachNumber calls fn for every number in the value tree rooted at val.
+func eachNumber(val Node, fn func(*NumberNode)) {
+	switch v := val.(type) {
+	case *NumberNode:
+		fn(v)
+	case *ArrayNode:
+		for _, elem := range v.elements {
+			eachNumber(elem, fn)
+		}
+	case *InlineTableNode:
+		for _, kv := range v.entries {
+			eachNumber(kv.val, fn)
+		}
+	}
+}
+
+// fix rewrites num in the requested style.
+func (o NumberStyleOptions) fix(num *NumberNode) error {
+	text, _ := o.restyle(num.text)
+	num.text = text
+	regenerateAncestorText(num)
+	return nil
+}
+
+// restyle returns text written in the requested style and a description of
+// each change made.
+func (o NumberStyleOptions) restyle(text string) (string, []string) {
+	var issues []string
+	if rest, ok := strings.CutPrefix(text, "+"); ok {
+		text = rest
+		issues = append(issues, `leading "+"`)
+	}
+	restyle := o.restyleDecimal
+	switch lower := strings.ToLower(text); {
+	case isSpecialFloat(lower) || strings.HasPrefix(lower, "0o") || strings.HasPrefix(lower, "0b"):
+		return text, issues
+	case strings.HasPrefix(text, "0x"):
+		restyle = o.restyleHex
+	case strings.ContainsAny(text, ".eE"):
+		restyle = o.restyleFloat
+	}
+	text, issue := restyle(text)
+	if issue != "" {
+		issues = append(issues, issue)
+	}
+	return text, issues
+}
+
+func (o NumberStyleOptions) restyleHex(text string) (string, string) {
+	if o.UpperHex {
+		if fixed := "0x" + strings.ToUpper(text[2:]); fixed != text {
+			return fixed, "lowercase hex digits"
+		}
+	} else if fixed := strings.ToLower(text); fixed != text {
+		return fixed, "uppercase hex digits"
+	}
+	return text, ""
+}
+
+func (o NumberStyleOptions) restyleFloat(text string) (string, string) {
+	switch {
+	case o.UpperExponent && strings.Contains(text, "e"):
+		return strings.ReplaceAll(text, "e", "E"), "lowercase exponent"
+	case !o.UpperExponent && strings.Contains(text, "E"):
+		return strings.ReplaceAll(text, "E", "e"), "uppercase exponent"
+	}
+	return text, ""
+}
+
+func (o NumberStyleOptions) restyleDecimal(text string) (string, string) {
+	digits := strings.TrimPrefix(text, "-")
+	if o.GroupDigits < 0 || len(digits) < o.GroupDigits || strings.Contains(digits, "_") {
+		return text, ""
+	}
+	return text[:len(text)-len(digits)] + groupThousands(digits), "digits not grouped"
+}
+
+// groupThousands puts an underscore between every three digits, counting
+// from the right.
+func groupThousands(digits string) string {
+	var b strings.Builder
+	for i, c := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,138 @@
+package toml
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"unsafe"
+)
+
+// ParseOptions configures ParseWithOptions. The zero value parses exactly
+// like Parse.
+type ParseOptions struct {
+	// Context, if non-nil, aborts parsing with its error once it is done,
+	// as in ParseContext.
+	Context context.Context
+
+	// OnParseComplete, if non-nil, is called once per parse, after
+	// validation, whether or not parsing succeeded.
+	OnParseComplete func(ParseStats)
+
+	// OnValidate, if non-nil, is called after the structural validation
+	// pass. It is not called if the source fails to parse.
+	OnValidate func(ValidateStats)
+
+	// Logger, if non-nil, receives non-fatal warnings about a successfully
+	// parsed document at slog.LevelWarn, such as TOML 1.1 syntax that
+	// TOML 1.0 parsers reject. Warnings tied to a key-value carry "line",
+	// "column", and "key" attributes.
+	Logger *slog.Logger
+
+	// ValueValidators are called in order for every value of a document
+	// that passed structural validation, including array elements and the
+	// values inside inline tables. The first error fails the parse.
+	ValueValidators []ValueValidator
+
+	// Templates accepts template actions such as {{ .Values.port }} in
+	// files preprocessed by a template engine: as a value, as a key or
+	// part of one, and on lines of their own. They are kept as written in
+	// TemplateNode values, key parts, and trivia. Actions inside strings
+	// need no option.
+	Templates bool
+
+	// NoCopy parses b in place instead of copying it into a string first,
+	// halving peak memory for very large inputs such as memory-mapped
+	// files. The document's text, every node, and any string or error
+	// obtained from it then refer to b, so b must not be modified or
+	// unmapped while any of them is in use; doing so breaks Go's string
+	// immutability and can crash the program. Parse documents that must
+	// outlive the input without NoCopy.
+	NoCopy bool
+
+	// InternKeys stores each distinct key text once and shares it between
+	// every key and header that spells it, instead of keeping a separate
+	// string per occurrence. It saves memory for machine-generated files
+	// that repeat the same keys many times, such as thousands of [[records]]
+	// entries, at the cost of a map lookup per key part during the parse.
+	// The shared strings are copies, so with NoCopy the keys do not refer to
+	// the input.
+	InternKeys bool
+
+	// SmallDocumentLimit is the number of top-level keys up to which a
+	// document with no tables, dotted keys, or inline tables is validated
+	// by comparing its keys directly, without allocating the lookup maps
+	// that larger documents need. Short flat config files, parsed on every
+	// run of a CLI, then validate with no allocations. Zero means 64, and a
+	// negative value always uses the maps.
+	SmallDocumentLimit int
+}
+
+// ParseStats describes a completed parse.
+type ParseStats struct {
+	Bytes        int           // length of the input
+	Nodes        int           // CST nodes below the document; 0 on error
+	TopLevel     int           // top-level nodes in the document; 0 on error
+	ParseTime    time.Duration // time spent building the CST
+	ValidateTime time.Duration // time spent in structural validation
+	Err          error         // the error returned to the caller, if any
+}
+
+// ValidateStats describes a structural validation pass.
+type ValidateStats struct {
+	TopLevel int           // top-level nodes validated
+	Duration time.Duration // time spent validating
+	Err      error         // the validation error, if any
+}
+
+// ParseWithOptions reads a TOML document from bytes, like Parse, invoking
+// the hooks in opts. Hooks run synchronously on the calling goroutine.
+func ParseWithOptions(b []byte, opts ParseOptions) (*Document, error) {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	doc := &Document{}
+	if err := parseInto(doc, b, parseRun{ctx: ctx, opts: &opts}); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// source returns b as the string the document is parsed from.
+func (o *ParseOptions) source(b []byte) string {
+	if o != nil && o.NoCopy && len(b) > 0 {
+		return unsafe.String(&b[0], len(b))
+	}
+	return string(b)
+}
+
+func (o *ParseOptions) parseComplete(doc *Document, stats ParseStats, err error) {
+	if o == nil || o.OnParseComplete == nil {
+		return
+	}
+	stats.Err = err
+	if err == nil {
+		stats.TopLevel = len(doc.nodes)
+		doc.Walk(func(Node) bool {
+			stats.Nodes++
+			return true
+		})
+		stats.Nodes-- // the document itself
+	}
+	o.OnParseComplete(stats)
+}
+
+func (o *ParseOptions) validated(doc *Document, d time.Duration, err error) {
+	if o == nil || o.OnValidate == nil {
+		return
+	}
+	o.OnValidate(ValidateStats{TopLevel: len(doc.nodes), Duration: d, Err: err})
+}
+
+func (o *ParseOptions) warn(ctx context.Context, doc *Document, source string) {
+	if o == nil || o.Logger == nil {
+		return
+	}
+	w := &warner{ctx: ctx, logger: o.Logger}
+	w.warnDocument(doc, source)
+}
@@ -0,0 +1,184 @@
+package toml
+
+import (
+	"slices"
+	"strings"
+)
+
+// SectionKind classifies an outline section.
+type SectionKind int
+
+// Section kinds.
+const (
+	// SectionTable is a [table] and its entries.
+	SectionTable SectionKind = iota
+	// SectionArrayOfTables groups consecutive [[array]] entries with the
+	// same path; its children are the entries.
+	SectionArrayOfTables
+	// SectionArrayEntry is one [[array]] entry and its entries.
+	SectionArrayEntry
+	// SectionValue is a key-value whose value spans several lines.
+	SectionValue
+)
+
+// Section is a node of a document outline, for folding ranges and
+// navigation trees.
+type Section struct {
+	Kind SectionKind
+	Path string // dotted path, quoted where needed
+	Node Node   // the TableNode, first or own ArrayOfTables, or KeyValue
+
+	// Header is the span of the table header or key-value. Span covers the
+	// whole section, from the header to the end of its last entry, in the
+	// text produced by String.
+	Header Span
+	Span   Span
+
+	Children []*Section
+}
+
+// Outline returns the document's sections in order. Tables nest under the
+// closest preceding table whose path is a prefix of theirs, sub-tables of
+// an array-of-tables entry nest under that entry, and consecutive entries
+// of the same array of tables are grouped under one section.
+func (d *Document) Outline() []*Section {
+	o := outliner{spans: d.Spans()}
+	for _, n := range d.nodes {
+		switch v := n.(type) {
+		case *TableNode:
+			o.table(v)
+		case *ArrayOfTables:
+			o.arrayEntry(v)
+		default:
+			o.entry(n)
+		}
+	}
+	return o.roots
+}
+
+type outlineFrame struct {
+	sec  *Section
+	segs []string
+}
+
+type outliner struct {
+	spans map[Node]Span
+	roots []*Section
+	stack []outlineFrame
+}
+
+func (o *outliner) table(t *TableNode) {
+	segs := partsToSegs(t.headerParts)
+	o.popUntilPrefixOf(segs, false)
+	o.push(SectionTable, t, segs)
+	o.body(t.trailing(), t.entries, t.bodyTrivia)
+}
+
+func (o *outliner) arrayEntry(a *ArrayOfTables) {
+	segs := partsToSegs(a.headerParts)
+	o.popUntilPrefixOf(segs, true)
+	top := o.top()
+	if top == nil || top.sec.Kind != SectionArrayOfTables || !slices.Equal(top.segs, segs) {
+		o.push(SectionArrayOfTables, a, segs)
+	}
+	o.push(SectionArrayEntry, a, segs)
+	o.body(a.trailing(), a.entries, a.bodyTrivia)
+}
+
+// popUntilPrefixOf closes sections until the innermost open one can
+// contain a header with path segs. An open array-of-tables group with the
+// same path stays open when group is set.
+func (o *outliner) popUntilPrefixOf(segs []string, group bool) {
+	for len(o.stack) > 0 {
+		f := o.stack[len(o.stack)-1]
+		if isPrefix(f.segs, segs) && len(f.segs) < len(segs) {
+			return
+		}
+		if group && f.sec.Kind == SectionArrayOfTables && slices.Equal(f.segs, segs) {
+			return
+		}
+		o.stack = o.stack[:len(o.stack)-1]
+	}
+}
+
+func (o *outliner) top() *outlineFrame {
+	if len(o.stack) == 0 {
+		return nil
+	}
+	return &o.stack[len(o.stack)-1]
+}
+
+func (o *outliner) push(kind SectionKind, n Node, segs []string) {
+	hdr := o.spans[n]
+	sec := &Section{Kind: kind, Path: JoinPath(segs...), Node: n, Header: hdr, Span: hdr}
+	o.add(sec)
+	o.stack = append(o.stack, outlineFrame{sec: sec, segs: segs})
+}
+
+// add attaches sec to the innermost open section, or to the roots.
+func (o *outliner) add(sec *Section) {
+	if top := o.top(); top != nil {
+		top.sec.Children = append(top.sec.Children, sec)
+	} else {
+		o.roots = append(o.roots, sec)
+	}
+	o.extend(sec.Span.End)
+}
+
+// extend grows every open section to end at least at end.
+func (o *outliner) extend(end int) {
+	for _, f := range o.stack {
+		f.sec.Span.End = max(f.sec.Span.End, end)
+	}
+}
+
+// body records the header's trailing trivia, the entries below it, and
+// the trivia that closes the section.
+func (o *outliner) body(trailing, entries, closing []Node) {
+	for _, n := range trailing {
+		o.extendTrivia(n)
+	}
+	for _, e := range entries {
+		o.entry(e)
+	}
+	for _, n := range closing {
+		o.extendTrivia(n)
+	}
+}
+
+// entry records a body node: multi-line key-values become sections, and
+// key-values and comments extend the open sections.
+func (o *outliner) entry(n Node) {
+	kv, ok := n.(*KeyValue)
+	if !ok {
+		o.extendTrivia(n)
+		return
+	}
+	sp := o.spans[kv]
+	if kv.val != nil && strings.ContainsAny(kv.val.Text(), "\n") {
+		path := append(o.openPath(), partsToSegs(kv.keyParts)...)
+		key := Span{sp.Start, sp.Start + len(kv.rawKey)}
+		o.add(&Section{Kind: SectionValue, Path: JoinPath(path...), Node: kv, Header: key, Span: sp})
+	}
+	o.extend(sp.End)
+	for _, t := range kv.trailing() {
+		o.extendTrivia(t)
+	}
+}
+
+func (o *outliner) extendTrivia(n Node) {
+	if n.Type() == NodeComment {
+		o.extend(o.spans[n].End)
+	}
+}
+
+func (o *outliner) openPath() []string {
+	if top := o.top(); top != nil {
+		return append([]string(nil), top.segs...)
+	}
+	return nil
+}
+
+func isPrefix(prefix, segs []string) bool {
+	return len(prefix) <= len(segs) && slices.Equal(prefix, segs[:len(prefix)])
+}
@@ -0,0 +1,54 @@
+package toml
+
+import "slices"
+
+// checkAttachable returns ErrNodeAlreadyAttached if n already has a parent. A
+// node belongs to at most one parent; reusing it elsewhere would corrupt
+// parent links and serialization.
+func checkAttachable(n Node) error {
+	if n != nil && n.Parent() != nil {
+		return ErrNodeAlreadyAttached
+	}
+	return nil
+}
+
+// Detach removes the key-value from the document, table, array-of-tables
+// entry, or inline table that holds it, so it can be attached elsewhere.
+// It returns false if the key-value has no parent.
+func (kv *KeyValue) Detach() bool { return detach(kv) }
+
+// Detach removes the table from its document so it can be attached
+// elsewhere. It returns false if the table has no parent.
+func (t *TableNode) Detach() bool { return detach(t) }
+
+// Detach removes the array-of-tables entry from its document so it can be
+// attached elsewhere. It returns false if the entry has no parent.
+func (a *ArrayOfTables) Detach() bool { return detach(a) }
+
+func detach(n Node) bool {
+	doc := findDocument(n)
+	switch p := n.Parent().(type) {
+	case *Document:
+		p.nodes = slices.DeleteFunc(p.nodes, func(c Node) bool { return c == n })
+	case *TableNode:
+		p.entries = slices.DeleteFunc(p.entries, func(c Node) bool { return c == n })
+	case *ArrayOfTables:
+		p.entries = slices.DeleteFunc(p.entries, func(c Node) bool { return c == n })
+	case *InlineTableNode:
+		i := slices.Index(p.entries, n.(*KeyValue))
+		if i < 0 {
+			return false
+		}
+		p.entries = slices.Delete(p.entries, i, i+1)
+		p.seps = shrinkSeps(p.seps, i)
+		p.regenerateText()
+		regenerateAncestorText(p)
+	default:
+		return false
+	}
+	setNodeParent(n, nil)
+	if doc != nil {
+		doc.changed()
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package toml
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// WalkParallel visits every node of the CST, like Walk, on up to workers
+// goroutines for scanning large documents on several cores. The document
+// node is visited first on the calling goroutine; then the top-level nodes
+// are handed out one at a time to the workers, and each walks the subtree
+// of the node it took in pre-order. The visitor is called concurrently,
+// with no order between top-level subtrees, so it must be safe to call
+// from several goroutines, and it must not change the document. Returning
+// false stops the walk: workers finish the visit in progress and take no
+// more nodes. A workers value below 1 means runtime.GOMAXPROCS(0).
+// WalkParallel returns once every worker is done.
+func (d *Document) WalkParallel(workers int, visitor func(Node) bool) {
+	if !visitor(d) {
+		return
+	}
+	top := d.Children()
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(top))
+	var next atomic.Int64
+	var stop atomic.Bool
+	var walk func(Node) bool
+	walk = func(n Node) bool {
+		if stop.Load() || !visitor(n) {
+			stop.Store(true)
+			return false
+		}
+		return eachChild(n, walk)
+	}
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(top) || !walk(top[i]) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -1,6 +1,7 @@
 package toml
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -11,17 +12,56 @@ type parser struct {
 	lex    *lexer
 	cur    Token
 	source string
+	ctx    context.Context   // checked before each top-level node
+	intern map[string]string // key texts seen so far, if interning
+
+	sel     [][]string // paths whose values ParseSelect builds, or nil for all
+	section []KeyPart  // header of the section being parsed
+
+	// stop, if set, is asked at each header whether parsing can end there,
+	// given the header's offset and leading trivia. Reparse uses it to keep
+	// the unchanged sections after an edit.
+	stop func(pos int, leading []Node) bool
 }
 
 func newParser(source string) *parser {
-	p := &parser{
-		lex:    newLexer(source),
-		source: source,
-	}
-	p.cur = p.lex.Next()
+	p := &parser{lex: &lexer{}, ctx: context.Background()}
+	p.reset(source)
 	return p
 }
 
+// reset prepares p to parse source, reusing its lexer.
+func (p *parser) reset(source string) {
+	*p.lex = *newLexer(source)
+	p.source = source
+	p.cur = p.lex.Next()
+	p.intern = nil
+	p.sel, p.section = nil, nil
+	p.stop = nil
+}
+
+// seek moves p to offset in its source, which must start a line.
+func (p *parser) seek(offset int) {
+	p.lex.pos = offset
+	p.lex.line = strings.Count(p.source[:offset], "\n") + 1
+	p.lex.col = 1
+	p.cur = p.lex.Next()
+}
+
+// internKey returns the stored copy of a key text equal to s, storing s
+// first if it is new. Without interning it returns s.
+func (p *parser) internKey(s string) string {
+	if p.intern == nil {
+		return s
+	}
+	if v, ok := p.intern[s]; ok {
+		return v
+	}
+	s = strings.Clone(s)
+	p.intern[s] = s
+	return s
+}
+
 func (p *parser) advance() Token {
 	prev := p.cur
 	p.cur = p.lex.Next()
@@ -30,13 +70,10 @@ func (p *parser) advance() Token {
 
 func (p *parser) at(t TokenType) bool { return p.cur.Type == t }
 
+// parseError reports that the current token was unexpected. The message
+// is extended with a description of what was found.
 func (p *parser) parseError(msg string) error {
-	return &ParseError{
-		Message: msg,
-		Line:    p.cur.Line,
-		Column:  p.cur.Col,
-		Source:  p.source,
-	}
+	return p.tokError(msg+", found "+describeToken(p.cur), p.cur)
 }
 
 func (p *parser) tokError(msg string, tok Token) error {
@@ -45,59 +82,126 @@ func (p *parser) tokError(msg string, tok Token) error {
 		Line:    tok.Line,
 		Column:  tok.Col,
 		Source:  p.source,
+		Hint:    hintFor(msg),
+		Token:   tok.Text,
+		Span:    Span{tok.Pos, tok.Pos + len(tok.Text)},
 	}
 }
 
+// describeToken names a token for error messages.
+func describeToken(tok Token) string {
+	switch tok.Type { //nolint:exhaustive
+	case TokEOF:
+		return "end of file"
+	case TokNewline:
+		return "end of line"
+	}
+	return strconv.Quote(tok.Text)
+}
+
 // tableTarget is something that can hold child entries.
 type tableTarget interface {
 	addEntry(Node)
 }
 
-func (p *parser) parse() (*Document, error) {
-	doc := &Document{}
-	var ct tableTarget // current table receiving entries
+// parse appends the parsed top-level nodes to doc.
+func (p *parser) parse(doc *Document) error {
+	return p.parseFrom(doc, nil)
+}
 
+// parseFrom is parse continuing the section ct, the current table
+// receiving entries, or at the top level if ct is nil.
+func (p *parser) parseFrom(doc *Document, ct tableTarget) error {
 	for !p.at(TokEOF) {
+		if err := ctxErr(p.ctx); err != nil {
+			return err
+		}
 		trivia, err := p.collectLeadingTrivia()
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		if p.at(TokEOF) {
 			p.attachOrphanTrivia(doc, ct, trivia)
 			break
 		}
+		if len(doc.nodes) == 0 {
+			doc.prologue, trivia = splitBodyTrivia(trivia)
+			adoptTrivia(doc, doc.prologue)
+		}
 
 		if p.at(TokLBracket) {
+			if ct != nil {
+				var body []Node
+				body, trivia = splitBodyTrivia(trivia)
+				addBodyTrivia(ct, body)
+			}
+			if p.stop != nil && p.stop(p.cur.Pos, trivia) {
+				return nil
+			}
+			if p.sel != nil {
+				raw, err := p.skipSection(trivia)
+				if err != nil {
+					return err
+				}
+				if raw != nil {
+					doc.nodes = append(doc.nodes, raw)
+					setNodeParent(raw, doc)
+					ct, p.section = nil, nil
+					continue
+				}
+			}
 			node, err := p.parseTableOrArrayHeader(trivia)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			doc.nodes = append(doc.nodes, node)
 			setNodeParent(node, doc)
 			if t, ok := node.(tableTarget); ok {
 				ct = t
 			}
+			p.section = sectionParts(node)
 			continue
 		}
 
+		if err := p.parseEntry(doc, ct, trivia); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseEntry parses a key-value line and adds it to the current table, or
+// to doc if there is none. With ParseSelect, an unselected key-value is
+// added as a RawNode.
+func (p *parser) parseEntry(doc *Document, ct tableTarget, trivia []Node) error {
+	var n Node
+	if p.sel != nil {
+		raw, err := p.skipEntry(trivia)
+		if err != nil {
+			return err
+		}
+		n = raw
+	}
+	if n == nil {
 		kv, err := p.parseKeyVal(trivia)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if err := p.addTrailingTrivia(kv); err != nil {
-			return nil, err
-		}
-
-		if ct != nil {
-			ct.addEntry(kv)
-		} else {
-			kv.setParent(doc)
-			doc.nodes = append(doc.nodes, kv)
+			return err
 		}
+		n = kv
 	}
 
-	return doc, nil
+	if ct != nil {
+		ct.addEntry(n)
+	} else {
+		setNodeParent(n, doc)
+		doc.nodes = append(doc.nodes, n)
+	}
+	return nil
 }
 
 // addEntry methods for table types.
@@ -114,87 +218,112 @@ func (a *ArrayOfTables) addEntry(n Node) {
 	}
 }
 
+// attachOrphanTrivia places the trivia at the end of the document. In a
+// document with no nodes it is the prologue. Otherwise it is the epilogue
+// from the first blank line on, and what comes before that closes the
+// current section.
 func (p *parser) attachOrphanTrivia(doc *Document, ct tableTarget, trivia []Node) {
 	if len(trivia) == 0 {
 		return
 	}
-	if attachTriviaToLast(doc, trivia) {
-		return
-	}
-	for _, t := range trivia {
-		if ct != nil {
-			ct.addEntry(t)
-		} else {
-			doc.nodes = append(doc.nodes, t)
-		}
-	}
-}
-
-func attachTriviaToLast(doc *Document, trivia []Node) bool {
 	if len(doc.nodes) == 0 {
-		return false
+		doc.prologue = trivia
+		adoptTrivia(doc, trivia)
+		return
 	}
-	last := doc.nodes[len(doc.nodes)-1]
-	switch v := last.(type) {
-	case *TableNode:
-		if kv := lastKV(v.entries); kv != nil {
-			kv.trailingTrivia = append(kv.trailingTrivia, trivia...)
-			return true
+	if ct != nil {
+		k := 0
+		for k < len(trivia) && !isBlankLine(trivia, k) {
+			k++
 		}
-	case *ArrayOfTables:
-		if kv := lastKV(v.entries); kv != nil {
-			kv.trailingTrivia = append(kv.trailingTrivia, trivia...)
-			return true
+		addBodyTrivia(ct, trivia[:k])
+		trivia = trivia[k:]
+	}
+	doc.epilogue = trivia
+	adoptTrivia(doc, trivia)
+}
+
+// addBodyTrivia appends trivia to the body trivia of the section ct.
+func addBodyTrivia(ct tableTarget, trivia []Node) {
+	n := ct.(Node)
+	body := bodyTriviaOf(n)
+	*body = append(*body, trivia...)
+	adoptTrivia(n, trivia)
+}
+
+// splitBodyTrivia splits the trivia before a header into the part that
+// closes the previous section and the header's leading trivia. Comments
+// followed by a blank line close the section; the blank line and what
+// follows it lead the header.
+func splitBodyTrivia(trivia []Node) (body, leading []Node) {
+	k, comment := 0, false
+	for j, n := range trivia {
+		switch {
+		case isComment(n):
+			comment = true
+		case comment && isBlankLine(trivia, j):
+			k, comment = j, false
 		}
-	case *KeyValue:
-		v.trailingTrivia = append(v.trailingTrivia, trivia...)
-		return true
-	}
-	return false
-}
-
-func lastKV(entries []Node) *KeyValue {
-	if len(entries) == 0 {
-		return nil
 	}
-	kv, _ := entries[len(entries)-1].(*KeyValue)
-	return kv
+	return trivia[:k:k], trivia[k:]
 }
 
 // collectLeadingTrivia gathers whitespace, newlines, and comments.
 func (p *parser) collectLeadingTrivia() ([]Node, error) {
 	var nodes []Node
-	for p.at(TokWhitespace) || p.at(TokNewline) || p.at(TokComment) {
+	for p.at(TokWhitespace) || p.at(TokNewline) || p.at(TokComment) || p.atTemplateLine() {
 		tok := p.advance()
 		switch tok.Type { //nolint:exhaustive
 		case TokComment:
 			if msg := validateCommentText(tok.Text); msg != "" {
 				return nil, p.tokError(msg, tok)
 			}
-			nodes = append(nodes, &CommentNode{leafNode: newLeaf(NodeComment, tok.Text)})
+			nodes = append(nodes, &CommentNode{leafNode: newLeaf(tok.Text)})
+		case TokTemplate:
+			nodes = append(nodes, &TemplateNode{leafNode: newLeaf(tok.Text)})
 		default:
-			nodes = append(nodes, &WhitespaceNode{leafNode: newLeaf(NodeWhitespace, tok.Text)})
+			nodes = append(nodes, &WhitespaceNode{leafNode: newLeaf(tok.Text)})
 		}
 	}
 	return nodes, nil
 }
 
+// atTemplateLine reports whether the current token is a template action
+// that stands on its own, such as {{ if .tls }}, rather than starting a
+// key.
+func (p *parser) atTemplateLine() bool {
+	if !p.at(TokTemplate) {
+		return false
+	}
+	lex, cur := *p.lex, p.cur
+	defer func() { *p.lex, p.cur = lex, cur }()
+	p.advance()
+	if p.at(TokWhitespace) {
+		p.advance()
+	}
+	return !p.at(TokEquals) && !p.at(TokDot)
+}
+
 // addTrailingTrivia collects whitespace and comment after a value on the same line.
 // It also enforces that a newline or EOF follows.
 func (p *parser) addTrailingTrivia(kv *KeyValue) error {
+	var trailing []Node
 	if p.at(TokWhitespace) {
 		tok := p.advance()
-		kv.trailingTrivia = append(kv.trailingTrivia,
-			&WhitespaceNode{leafNode: newLeaf(NodeWhitespace, tok.Text)})
+		ws := &WhitespaceNode{leafNode: newLeaf(tok.Text)}
+		ws.setParent(kv)
+		trailing = append(trailing, ws)
 	}
 	if p.at(TokComment) {
 		tok := p.advance()
 		if msg := validateCommentText(tok.Text); msg != "" {
 			return p.tokError(msg, tok)
 		}
-		kv.trailingTrivia = append(kv.trailingTrivia,
-			&CommentNode{leafNode: newLeaf(NodeComment, tok.Text)})
+		c := &CommentNode{leafNode: newLeaf(tok.Text)}
+		c.setParent(kv)
+		trailing = append(trailing, c)
 	}
+	kv.setTrailing(trailing)
 	if p.at(TokNewline) {
 		tok := p.advance()
 		kv.newline = tok.Text
@@ -236,14 +365,16 @@ func (p *parser) parseTableHeaderBody(trivia []Node, hdrLine, hdrCol int) (*Tabl
 		return nil, err2
 	}
 
-	return &TableNode{
-		baseNode:       baseNode{nodeType: NodeTable, line: hdrLine, col: hdrCol},
-		leadingTrivia:  trivia,
-		rawHeader:      rawHeader,
-		headerParts:    parts,
-		trailingTrivia: trailing,
-		newline:        nl,
-	}, nil
+	t := &TableNode{
+		srcPos:      srcPos{int32(hdrLine), int32(hdrCol)},
+		lineTrivia:  newLineTrivia(trivia, trailing),
+		rawHeader:   rawHeader,
+		headerParts: parts,
+		newline:     nl,
+	}
+	adoptTrivia(t, trivia)
+	adoptTrivia(t, trailing)
+	return t, nil
 }
 
 func (p *parser) parseArrayOfTablesBody(trivia []Node, hdrLine, hdrCol int) (*ArrayOfTables, error) {
@@ -266,28 +397,30 @@ func (p *parser) parseArrayOfTablesBody(trivia []Node, hdrLine, hdrCol int) (*Ar
 		return nil, err2
 	}
 
-	return &ArrayOfTables{
-		baseNode:       baseNode{nodeType: NodeArrayOfTables, line: hdrLine, col: hdrCol},
-		leadingTrivia:  trivia,
-		rawHeader:      rawHeader,
-		headerParts:    parts,
-		trailingTrivia: trailing,
-		newline:        nl,
-	}, nil
+	a := &ArrayOfTables{
+		srcPos:      srcPos{int32(hdrLine), int32(hdrCol)},
+		lineTrivia:  newLineTrivia(trivia, trailing),
+		rawHeader:   rawHeader,
+		headerParts: parts,
+		newline:     nl,
+	}
+	adoptTrivia(a, trivia)
+	adoptTrivia(a, trailing)
+	return a, nil
 }
 
 func (p *parser) collectHeaderTrailing() ([]Node, string, error) {
 	var nodes []Node
 	if p.at(TokWhitespace) {
 		tok := p.advance()
-		nodes = append(nodes, &WhitespaceNode{leafNode: newLeaf(NodeWhitespace, tok.Text)})
+		nodes = append(nodes, &WhitespaceNode{leafNode: newLeaf(tok.Text)})
 	}
 	if p.at(TokComment) {
 		tok := p.advance()
 		if msg := validateCommentText(tok.Text); msg != "" {
 			return nil, "", p.tokError(msg, tok)
 		}
-		nodes = append(nodes, &CommentNode{leafNode: newLeaf(NodeComment, tok.Text)})
+		nodes = append(nodes, &CommentNode{leafNode: newLeaf(tok.Text)})
 	}
 	nl := ""
 	if p.at(TokNewline) {
@@ -319,7 +452,7 @@ func (p *parser) parseKeyInHeader() (string, []KeyPart, error) {
 		p.advance()
 	}
 
-	return raw.String(), parts, nil
+	return p.internKey(raw.String()), parts, nil
 }
 
 // parseKey parses a simple or dotted key.
@@ -358,13 +491,17 @@ func (p *parser) parseKey() ([]KeyPart, string, error) {
 		if err != nil {
 			return nil, "", err
 		}
-		part.DotBefore = dotBefore
-		part.DotAfter = dotAfter
+		part.DotBefore = p.internKey(dotBefore)
+		part.DotAfter = p.internKey(dotAfter)
 		raw.WriteString(part.Text)
 		parts = append(parts, part)
 	}
 
-	return parts, raw.String(), nil
+	for i := range parts {
+		parts[i].Text = p.internKey(parts[i].Text)
+		parts[i].Unquoted = p.internKey(parts[i].Unquoted)
+	}
+	return parts, p.internKey(raw.String()), nil
 }
 
 func (p *parser) parseSimpleKey() (KeyPart, error) {
@@ -373,16 +510,11 @@ func (p *parser) parseSimpleKey() (KeyPart, error) {
 		tok := p.advance()
 		for _, r := range tok.Text {
 			if !isBareKeyChar(r) {
-				return KeyPart{}, &ParseError{
-					Message: fmt.Sprintf("invalid character %q in bare key %q", r, tok.Text),
-					Line:    tok.Line,
-					Column:  tok.Col,
-					Source:  p.source,
-				}
+				return KeyPart{}, p.tokError(fmt.Sprintf("invalid character %q in bare key %q", r, tok.Text), tok)
 			}
 		}
 		return KeyPart{Text: tok.Text, Unquoted: tok.Text}, nil
-	case TokBoolean, TokInteger, TokFloat, TokDateTime:
+	case TokBoolean, TokInteger, TokFloat, TokDateTime, TokTemplate:
 		tok := p.advance()
 		return KeyPart{Text: tok.Text, Unquoted: tok.Text}, nil
 	case TokBasicString:
@@ -409,47 +541,56 @@ func isBareKeyChar(r rune) bool {
 
 func (p *parser) parseKeyVal(trivia []Node) (*KeyValue, error) {
 	kvLine, kvCol := p.cur.Line, p.cur.Col
-	parts, rawKey, err := p.parseKey()
+	parts, rawKey, preEq, postEq, err := p.parseKeyEq()
 	if err != nil {
 		return nil, err
 	}
 
-	preEq := ""
+	val, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	p.lex.valueMode = false // back to key context
+
+	kv := &KeyValue{
+		srcPos:     srcPos{int32(kvLine), int32(kvCol)},
+		lineTrivia: newLineTrivia(trivia, nil),
+		keyParts:   parts,
+		rawKey:     rawKey,
+		preEq:      preEq,
+		postEq:     postEq,
+		val:        val,
+		rawVal:     val.Text(),
+	}
+	setValueParent(val, kv)
+	adoptTrivia(kv, trivia)
+	return kv, nil
+}
+
+// parseKeyEq parses a key and the "=" after it, with the whitespace on
+// either side, leaving the lexer in value context.
+func (p *parser) parseKeyEq() (parts []KeyPart, rawKey, preEq, postEq string, err error) {
+	parts, rawKey, err = p.parseKey()
+	if err != nil {
+		return nil, "", "", "", err
+	}
+
 	if p.at(TokWhitespace) {
 		preEq = p.cur.Text
 		p.advance()
 	}
 
 	if !p.at(TokEquals) {
-		return nil, p.parseError("expected '='")
+		return nil, "", "", "", p.parseError("expected '='")
 	}
 	p.lex.valueMode = true // switch to value context so . is part of floats
 	p.advance()
 
-	postEq := ""
 	if p.at(TokWhitespace) {
 		postEq = p.cur.Text
 		p.advance()
 	}
-
-	val, err := p.parseValue()
-	if err != nil {
-		return nil, err
-	}
-	p.lex.valueMode = false // back to key context
-
-	kv := &KeyValue{
-		baseNode:      baseNode{nodeType: NodeKeyValue, line: kvLine, col: kvCol},
-		leadingTrivia: trivia,
-		keyParts:      parts,
-		rawKey:        rawKey,
-		preEq:         preEq,
-		postEq:        postEq,
-		val:           val,
-		rawVal:        val.Text(),
-	}
-	setValueParent(val, kv)
-	return kv, nil
+	return parts, rawKey, preEq, postEq, nil
 }
 
 // parseValue parses a TOML value.
@@ -461,13 +602,16 @@ func (p *parser) parseValue() (Node, error) {
 		return p.parseNumberValue()
 	case TokBoolean:
 		tok := p.advance()
-		return &BooleanNode{leafNode: newLeaf(NodeBoolean, tok.Text)}, nil
+		return &BooleanNode{leafNode: newLeaf(tok.Text)}, nil
 	case TokDateTime:
 		return p.parseDateTimeValue()
 	case TokLBracket:
 		return p.parseArray()
 	case TokLBrace:
 		return p.parseInlineTable()
+	case TokTemplate:
+		tok := p.advance()
+		return &TemplateNode{leafNode: newLeaf(tok.Text)}, nil
 	default:
 		return nil, p.parseError("expected value")
 	}
@@ -478,7 +622,7 @@ func (p *parser) parseStringValue() (Node, error) {
 	if msg := validateStringText(tok.Text); msg != "" {
 		return nil, p.tokError(msg, tok)
 	}
-	return &StringNode{leafNode: newLeaf(NodeString, tok.Text)}, nil
+	return &StringNode{leafNode: newLeaf(tok.Text)}, nil
 }
 
 func (p *parser) parseNumberValue() (Node, error) {
@@ -486,7 +630,7 @@ func (p *parser) parseNumberValue() (Node, error) {
 	if msg := validateNumberText(tok.Text); msg != "" {
 		return nil, p.tokError(msg, tok)
 	}
-	return &NumberNode{leafNode: newLeaf(NodeNumber, tok.Text)}, nil
+	return &NumberNode{leafNode: newLeaf(tok.Text)}, nil
 }
 
 func (p *parser) parseDateTimeValue() (Node, error) {
@@ -494,7 +638,7 @@ func (p *parser) parseDateTimeValue() (Node, error) {
 	if msg := validateDateTimeText(tok.Text); msg != "" {
 		return nil, p.tokError(msg, tok)
 	}
-	return &DateTimeNode{leafNode: newLeaf(NodeDateTime, tok.Text)}, nil
+	return &DateTimeNode{leafNode: newLeaf(tok.Text)}, nil
 }
 
 func (p *parser) parseArray() (Node, error) {
@@ -502,15 +646,20 @@ func (p *parser) parseArray() (Node, error) {
 	p.advance() // [
 
 	var elements []Node
+	var seps []string
+	prevEnd := startPos + 1
 	p.skipWsCommentNewline()
 
 	for !p.at(TokRBracket) && !p.at(TokEOF) {
 		p.lex.valueMode = true // array elements are values
+		elemStart := p.cur.Pos
 		val, err := p.parseValue()
 		if err != nil {
 			return nil, err
 		}
 		elements = append(elements, val)
+		seps = append(seps, p.source[prevEnd:elemStart])
+		prevEnd = p.cur.Pos
 		p.lex.valueMode = true // restore after parseValue (inline table may unset it)
 		p.skipWsCommentNewline()
 
@@ -528,11 +677,15 @@ func (p *parser) parseArray() (Node, error) {
 	closeTok := p.advance()
 	endPos := closeTok.Pos + len(closeTok.Text)
 
-	return &ArrayNode{
-		baseNode: baseNode{nodeType: NodeArray},
+	a := &ArrayNode{
 		elements: elements,
+		seps:     append(seps, p.source[prevEnd:closeTok.Pos]),
 		text:     p.source[startPos:endPos],
-	}, nil
+	}
+	for _, elem := range elements {
+		setValueParent(elem, a)
+	}
+	return a, nil
 }
 
 func (p *parser) parseInlineTable() (Node, error) {
@@ -541,14 +694,19 @@ func (p *parser) parseInlineTable() (Node, error) {
 	p.advance()             // {
 
 	var entries []*KeyValue
+	var seps []string
+	prevEnd := startPos + 1
 	p.skipWsCommentNewline()
 
 	for !p.at(TokRBrace) && !p.at(TokEOF) {
+		kvStart := p.cur.Pos
 		kv, err := p.parseKeyVal(nil)
 		if err != nil {
 			return nil, err
 		}
 		entries = append(entries, kv)
+		seps = append(seps, p.source[prevEnd:kvStart])
+		prevEnd = p.cur.Pos
 		p.skipWsCommentNewline()
 
 		if p.at(TokComma) {
@@ -566,9 +724,9 @@ func (p *parser) parseInlineTable() (Node, error) {
 	endPos := closeTok.Pos + len(closeTok.Text)
 
 	it := &InlineTableNode{
-		baseNode: baseNode{nodeType: NodeInlineTable},
-		entries:  entries,
-		text:     p.source[startPos:endPos],
+		entries: entries,
+		seps:    append(seps, p.source[prevEnd:closeTok.Pos]),
+		text:    p.source[startPos:endPos],
 	}
 	for _, kv := range entries {
 		kv.setParent(it)
@@ -0,0 +1,71 @@
+package toml
+
+import "strings"
+
+// Path is a key path given as its unquoted segments, so that segments
+// containing dots, quotes, or spaces need no escaping. The *Path methods
+// take a Path where their string counterparts take a dotted path:
+//
+//	doc.GetPath(toml.P("site", "google.com")) // same as doc.Get(`site."google.com"`)
+type Path []string
+
+// P returns the path made of segs.
+func P(segs ...string) Path {
+	return Path(segs)
+}
+
+// String returns the path as a dotted key, quoting segments where needed.
+// The result is a valid argument to Get and reads back as the same
+// segments.
+func (p Path) String() string {
+	return JoinPath(p...)
+}
+
+// JoinPath returns the dotted path of segs, as accepted by Get, Table,
+// Delete, and the Set methods, quoting each segment with QuoteKey where
+// needed. It is the inverse of SplitPath: SplitPath(JoinPath(segs...))
+// returns segs for any valid UTF-8 segments, including empty ones and
+// ones holding dots, quotes, or newlines. Paths in Change, LintFinding,
+// and the other results of this package are written the same way.
+func JoinPath(segs ...string) string {
+	quoted := make([]string, len(segs))
+	for i, s := range segs {
+		quoted[i] = QuoteKey(s)
+	}
+	return strings.Join(quoted, ".")
+}
+
+// SplitPath returns the unquoted segments of a dotted path, reading it as
+// Get, Table, Delete, and the Set methods do: bare and quoted segments
+// joined by dots, with optional whitespace around each dot, and escapes
+// resolved in basic strings. Array indexes such as [0] are not segments;
+// split them off first. It is the inverse of JoinPath.
+func SplitPath(path string) []string {
+	return parseDottedPath(path)
+}
+
+// Child returns a new path with segs appended.
+func (p Path) Child(segs ...string) Path {
+	return append(append(Path(nil), p...), segs...)
+}
+
+// GetPath is Get for a Path.
+func (d *Document) GetPath(p Path) *KeyValue {
+	return d.get(p)
+}
+
+// TablePath is Table for a Path.
+func (d *Document) TablePath(p Path) *TableNode {
+	return d.table(p)
+}
+
+// DeletePath is Delete for a Path.
+func (d *Document) DeletePath(p Path) (*KeyValue, bool) {
+	return detachKeyValue(d.deleteSegsTarget(p))
+}
+
+// SetPath is Set for a Path relative to the table.
+func (t *LogicalTable) SetPath(p Path, val Node) error {
+	_, _, err := t.setSegs(p, val)
+	return err
+}
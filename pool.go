@@ -0,0 +1,54 @@
+package toml
+
+import (
+	"context"
+	"sync"
+)
+
+// ParserPool reuses lexer, parser, and validator state across parses, so
+// services parsing many small documents avoid re-allocating it each time.
+// The zero value is ready to use, and a ParserPool is safe for concurrent
+// use. Documents returned by the pool are independent of it.
+type ParserPool struct {
+	pool sync.Pool
+}
+
+// parseScratch is the reusable per-parse state held by a ParserPool.
+type parseScratch struct {
+	lex   lexer
+	p     parser
+	state tableState
+}
+
+func (pp *ParserPool) get() *parseScratch {
+	if sc, ok := pp.pool.Get().(*parseScratch); ok {
+		return sc
+	}
+	sc := &parseScratch{state: *newTableState()}
+	sc.p.lex = &sc.lex
+	return sc
+}
+
+func (pp *ParserPool) put(sc *parseScratch) {
+	// Drop references to the source so it can be collected.
+	sc.p.reset("")
+	sc.p.ctx = nil
+	sc.state.reset()
+	pp.pool.Put(sc)
+}
+
+// Parse reads a TOML document from bytes, like the package-level Parse.
+func (pp *ParserPool) Parse(b []byte) (*Document, error) {
+	doc := &Document{}
+	if err := pp.ParseInto(doc, b); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// ParseInto parses b into dst, like the package-level ParseInto.
+func (pp *ParserPool) ParseInto(dst *Document, b []byte) error {
+	sc := pp.get()
+	defer pp.put(sc)
+	return parseInto(dst, b, parseRun{ctx: context.Background(), sc: sc})
+}
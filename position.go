@@ -0,0 +1,116 @@
+package toml
+
+import (
+	"sort"
+	"strings"
+)
+
+// Position is a line and column in source text. Columns are 1-indexed and
+// given in three units: bytes, runes (what most terminals and editors
+// display, counting a tab as one), and UTF-16 code units (what the
+// Language Server Protocol uses, after subtracting one).
+type Position struct {
+	Line   int
+	Column int // byte column
+	Rune   int // rune column
+	UTF16  int // UTF-16 code unit column
+}
+
+// PositionAt returns the position of the byte offset in src. Offsets are
+// clamped to the text; an offset inside a multi-byte rune counts that rune
+// as preceding it.
+func PositionAt(src string, offset int) Position {
+	offset = max(0, min(offset, len(src)))
+	lineStart := strings.LastIndexByte(src[:offset], '\n') + 1
+	p := Position{Line: strings.Count(src[:lineStart], "\n") + 1}
+	p.setColumns(src[lineStart:offset])
+	return p
+}
+
+// positionIn is PositionAt for an offset within src, given the offsets
+// where its lines start, as returned by lineStarts.
+func positionIn(src string, starts []int, offset int) Position {
+	line := sort.SearchInts(starts, offset+1) - 1
+	p := Position{Line: line + 1}
+	p.setColumns(src[starts[line]:offset])
+	return p
+}
+
+// setColumns sets the columns of the position just after prefix, the text
+// between the start of the line and the position.
+func (p *Position) setColumns(prefix string) {
+	p.Column, p.Rune, p.UTF16 = len(prefix)+1, 1, 1
+	for _, r := range prefix {
+		p.Rune++
+		p.UTF16++
+		if r >= 0x10000 {
+			p.UTF16++ // surrogate pair
+		}
+	}
+}
+
+// Position returns the position of the error with rune and UTF-16
+// columns computed from Source.
+func (e *ParseError) Position() Position {
+	p := Position{Line: e.Line, Column: e.Column, Rune: e.Column, UTF16: e.Column}
+	lines := strings.Split(e.Source, "\n")
+	if e.Line < 1 || e.Line > len(lines) {
+		return p
+	}
+	line := lines[e.Line-1]
+	p.setColumns(line[:max(0, min(e.Column-1, len(line)))])
+	return p
+}
+
+// Position returns the position where n starts in the text produced by
+// String, or false if n is not part of the document.
+func (d *Document) Position(n Node) (Position, bool) {
+	sp, ok := d.Spans()[n]
+	if !ok {
+		return Position{}, false
+	}
+	return PositionAt(d.String(), sp.Start), true
+}
+
+// nodePositions finds where nodes start in a document's text, building
+// the spans and line offsets on first use.
+type nodePositions struct {
+	doc    *Document
+	spans  map[Node]Span
+	src    string
+	starts []int
+}
+
+// of returns the position of n, or zero if n is not part of the document.
+func (p *nodePositions) of(n Node) Position {
+	pos, _, _ := p.find(n)
+	return pos
+}
+
+// find returns the position of n and its byte offset, or false if n is
+// not part of the document.
+func (p *nodePositions) find(n Node) (Position, int, bool) {
+	if p.spans == nil {
+		p.spans, p.src = p.doc.Spans(), p.doc.String()
+		p.starts = lineStarts(p.src)
+	}
+	sp, ok := p.spans[n]
+	if !ok {
+		return Position{}, 0, false
+	}
+	return positionIn(p.src, p.starts, sp.Start), sp.Start, true
+}
+
+// lineColOffset returns the byte offset of a 1-indexed line and byte column
+// in src, clamped to the text.
+func lineColOffset(src string, line, col int) int {
+	off := 0
+	for ; line > 1; line-- {
+		i := strings.IndexByte(src[off:], '\n')
+		if i < 0 {
+			return len(src)
+		}
+		off += i + 1
+	}
+	return min(off+max(col-1, 0), len(src))
+}
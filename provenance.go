@@ -0,0 +1,122 @@
+package toml
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GeneratedMarker is the first line of the banner written by
+// StampProvenance.
+const GeneratedMarker = "GENERATED FILE — DO NOT EDIT"
+
+// Provenance records how a generated file was made. StampProvenance writes
+// it as comments under a GeneratedMarker banner at the top of the file:
+//
+//	# GENERATED FILE — DO NOT EDIT
+//	# tool: confgen
+//	# version: v1.4.0
+//	# generated: 2024-05-01T12:00:00Z
+//	# source: sha256:9f86d0...
+type Provenance struct {
+	Tool       string
+	Version    string
+	Time       time.Time
+	SourceHash string // such as the result of HashSource
+}
+
+// HashSource returns "sha256:" followed by the hex SHA-256 digest of b,
+// for Provenance.SourceHash.
+func HashSource(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// lines returns the banner lines for p. Empty fields are left out.
+func (p Provenance) lines() []string {
+	lines := []string{GeneratedMarker}
+	add := func(key, value string) {
+		if value != "" {
+			lines = append(lines, key+": "+value)
+		}
+	}
+	add("tool", p.Tool)
+	add("version", p.Version)
+	if !p.Time.IsZero() {
+		add("generated", p.Time.UTC().Format(time.RFC3339))
+	}
+	add("source", p.SourceHash)
+	return lines
+}
+
+// StampProvenance writes p as a GeneratedMarker banner at the top of the
+// document, replacing the banner of an earlier stamp. See EnsureHeader.
+func StampProvenance(doc *Document, p Provenance) error {
+	return doc.EnsureHeader(p.lines())
+}
+
+// ReadProvenance returns the provenance stamped on the document by
+// StampProvenance, and false if it has no GeneratedMarker banner. Fields
+// missing from the banner are left empty.
+func ReadProvenance(doc *Document) (Provenance, bool) {
+	var p Provenance
+	for _, s := range doc.topTrivia() {
+		list := *s.list
+		for i, n := range list {
+			if !isBannerLine(GeneratedMarker)(n) {
+				continue
+			}
+			for j := commentEnd(list, i); j < len(list) && isComment(list[j]); j = commentEnd(list, j) {
+				p.setField(commentBody(list[j].Text()))
+			}
+			return p, true
+		}
+	}
+	return p, false
+}
+
+// setField sets the field named by a "key: value" banner line.
+func (p *Provenance) setField(line string) {
+	key, value, _ := strings.Cut(line, ":")
+	value = strings.TrimSpace(value)
+	switch strings.TrimSpace(key) {
+	case "tool":
+		p.Tool = value
+	case "version":
+		p.Version = value
+	case "generated":
+		p.Time, _ = time.Parse(time.RFC3339, value)
+	case "source":
+		p.SourceHash = value
+	}
+}
+
+// IsGenerated reports whether a comment at the top of the document says
+// DO NOT EDIT, as the GeneratedMarker banner and Go's "Code generated ...
+// DO NOT EDIT." convention do.
+func IsGenerated(doc *Document) bool {
+	for _, s := range doc.topTrivia() {
+		for _, n := range *s.list {
+			if c, ok := n.(*CommentNode); ok && strings.Contains(c.text, "DO NOT EDIT") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckEditable is a policy hook for tools that edit config files: it
+// returns an error wrapping ErrGeneratedFile if the document IsGenerated,
+// naming the tool from its provenance when there is one, unless force is
+// true. The generator that owns the file passes force.
+func CheckEditable(doc *Document, force bool) error {
+	if force || !IsGenerated(doc) {
+		return nil
+	}
+	if p, ok := ReadProvenance(doc); ok && p.Tool != "" {
+		return fmt.Errorf("%w: made by %s; edit its source and regenerate it", ErrGeneratedFile, p.Tool)
+	}
+	return fmt.Errorf("%w: marked DO NOT EDIT", ErrGeneratedFile)
+}
@@ -1,9 +1,14 @@
 package toml
 
 import (
+	"fmt"
+	"iter"
 	"math"
+	"math/big"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // --- Path helpers ---
@@ -83,9 +88,89 @@ func parsePathBareKey(path string, i int) (string, int) {
 	for i < len(path) && isBareKeyChar(rune(path[i])) {
 		i++
 	}
+	if i == start {
+		// Not a valid bare key: take everything up to the next separator
+		// so that parsing always makes progress.
+		for i < len(path) && !strings.ContainsRune(". \t[", rune(path[i])) {
+			i++
+		}
+		i = max(i, start+1)
+	}
 	return path[start:i], i
 }
 
+// pathStep is one segment of a path that may select an entry of an array
+// of tables, as in fruit[1].
+type pathStep struct {
+	name    string
+	index   int
+	indexed bool
+}
+
+// parsePathSteps parses a dotted path in which each segment may be
+// followed by an entry index in brackets. The index may be negative to
+// count from the end. It reports whether any segment is indexed.
+func parsePathSteps(path string) ([]pathStep, bool) {
+	var steps []pathStep
+	anyIndexed := false
+	for i := skipPathWs(path, 0); i < len(path); i = skipPathWs(path, i) {
+		var st pathStep
+		st.name, i = parsePathSegment(path, i)
+		i = skipPathWs(path, i)
+		if i < len(path) && path[i] == '[' {
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				end = len(path) - i
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(path[i+1 : i+end]))
+			if err != nil {
+				return nil, false
+			}
+			st.index, st.indexed, anyIndexed = n, true, true
+			i = skipPathWs(path, min(i+end+1, len(path)))
+		}
+		steps = append(steps, st)
+		if i < len(path) && path[i] == '.' {
+			i++
+		}
+	}
+	return steps, anyIndexed
+}
+
+// getIndexed resolves a path with entry indexes through the logical view.
+// Unindexed arrays of tables in the middle of the path resolve to their
+// last entry.
+func (d *Document) getIndexed(steps []pathStep) *KeyValue {
+	n := d.logicalRoot()
+	for i, st := range steps {
+		if i > 0 {
+			if n = n.descend(); n == nil {
+				return nil
+			}
+		}
+		if n = n.child(st.name); n == nil {
+			return nil
+		}
+		if st.indexed {
+			if n.kind != TypeArrayOfTables {
+				return nil
+			}
+			idx := st.index
+			if idx < 0 {
+				idx += len(n.entries)
+			}
+			if idx < 0 || idx >= len(n.entries) {
+				return nil
+			}
+			n = n.entries[idx]
+		}
+	}
+	if n.kind == TypeTable || n.kind == TypeArrayOfTables {
+		return nil
+	}
+	return n.kv
+}
+
 func matchKeyParts(parts []KeyPart, segs []string) bool {
 	if len(parts) != len(segs) {
 		return false
@@ -103,9 +188,31 @@ func matchKeyParts(parts []KeyPart, segs []string) bool {
 // Get finds a KeyValue by dotted path (e.g. "server.host").
 // It searches top-level key-values and entries within tables.
 // Returns nil if no matching key is found.
+//
+// Without indexes, a path under an array of tables matches the first entry
+// that has the key. A segment may select a specific entry instead, counted
+// from zero, or from the end if negative: "fruit[1].variety[0].name" finds
+// name in the first variety of the second fruit.
 func (d *Document) Get(path string) *KeyValue {
-	segs := parseDottedPath(path)
+	if strings.ContainsRune(path, '[') {
+		if steps, ok := parsePathSteps(path); ok {
+			return d.getIndexed(steps)
+		}
+	}
+	return d.get(parseDottedPath(path))
+}
+
+func (d *Document) get(segs []string) *KeyValue {
+	if kv := d.lookupKey(segs); kv != nil || d.aliases == nil {
+		return kv
+	}
+	return d.aliases.get(d, segs)
+}
 
+func (d *Document) lookupKey(segs []string) *KeyValue {
+	if kv, ok := d.Index().keyValue(segs); ok {
+		return kv
+	}
 	// Check top-level KVs for exact match and prefix match into inline tables.
 	if kv := findInEntries(d.nodes, segs); kv != nil {
 		return kv
@@ -145,7 +252,10 @@ func getFromTableNode(n Node, tableSegs, keySegs []string) *KeyValue {
 // Table finds the first TableNode whose header matches the given dotted path.
 // Returns nil if no matching table is found.
 func (d *Document) Table(path string) *TableNode {
-	segs := parseDottedPath(path)
+	return d.table(parseDottedPath(path))
+}
+
+func (d *Document) table(segs []string) *TableNode {
 	for _, n := range d.nodes {
 		if t, ok := n.(*TableNode); ok {
 			if matchKeyParts(t.headerParts, segs) {
@@ -200,6 +310,34 @@ func findInKVEntries(entries []*KeyValue, segs []string) *KeyValue {
 	return nil
 }
 
+// Len returns the number of top-level nodes in the document.
+func (d *Document) Len() int {
+	return len(d.nodes)
+}
+
+// Node returns the top-level node at index i without copying.
+// Returns nil if the index is out of bounds.
+func (d *Document) Node(i int) Node {
+	if i < 0 || i >= len(d.nodes) {
+		return nil
+	}
+	return d.nodes[i]
+}
+
+// NumKeyParts returns the number of dotted key segments.
+func (kv *KeyValue) NumKeyParts() int {
+	return len(kv.keyParts)
+}
+
+// KeyPart returns the key segment at index i without copying.
+// Returns the zero KeyPart if the index is out of bounds.
+func (kv *KeyValue) KeyPart(i int) KeyPart {
+	if i < 0 || i >= len(kv.keyParts) {
+		return KeyPart{}
+	}
+	return kv.keyParts[i]
+}
+
 // --- TableNode query methods ---
 
 // Get finds a KeyValue within the table's entries by dotted key path.
@@ -209,6 +347,40 @@ func (t *TableNode) Get(key string) *KeyValue {
 	return findInEntries(t.entries, segs)
 }
 
+// Len returns the number of entries in the table, including trivia nodes.
+func (t *TableNode) Len() int {
+	return len(t.entries)
+}
+
+// Entry returns the entry at index i without copying.
+// Returns nil if the index is out of bounds.
+func (t *TableNode) Entry(i int) Node {
+	if i < 0 || i >= len(t.entries) {
+		return nil
+	}
+	return t.entries[i]
+}
+
+// KeyValues returns the table's key-value entries, skipping comments and
+// blank lines.
+func (t *TableNode) KeyValues() []*KeyValue {
+	return slices.Collect(keyValuesSeq(t.entries))
+}
+
+// Comments returns the comments in the table's body in document order,
+// including comments attached to key-values and at the end of their lines.
+// The header line's own comment is in TrailingTrivia.
+func (t *TableNode) Comments() []*CommentNode {
+	return bodyComments(slices.Concat(t.entries, t.bodyTrivia))
+}
+
+// BlankLines returns the number of blank lines in the table's body.
+// Blank lines before the next header belong to that header's LeadingTrivia
+// and are not counted.
+func (t *TableNode) BlankLines() int {
+	return bodyBlankLines(slices.Concat(t.entries, t.bodyTrivia))
+}
+
 // --- ArrayOfTables query methods ---
 
 // Get finds a KeyValue within the array-of-tables' entries by dotted key path.
@@ -218,6 +390,155 @@ func (a *ArrayOfTables) Get(key string) *KeyValue {
 	return findInEntries(a.entries, segs)
 }
 
+// Len returns the number of entries in the array-of-tables entry, including
+// trivia nodes.
+func (a *ArrayOfTables) Len() int {
+	return len(a.entries)
+}
+
+// Entry returns the entry at index i without copying.
+// Returns nil if the index is out of bounds.
+func (a *ArrayOfTables) Entry(i int) Node {
+	if i < 0 || i >= len(a.entries) {
+		return nil
+	}
+	return a.entries[i]
+}
+
+// KeyValues returns the entry's key-value pairs, skipping comments and
+// blank lines.
+func (a *ArrayOfTables) KeyValues() []*KeyValue {
+	return slices.Collect(keyValuesSeq(a.entries))
+}
+
+// Comments returns the comments in the entry's body in document order,
+// including comments attached to key-values and at the end of their lines.
+func (a *ArrayOfTables) Comments() []*CommentNode {
+	return bodyComments(slices.Concat(a.entries, a.bodyTrivia))
+}
+
+// BlankLines returns the number of blank lines in the entry's body.
+func (a *ArrayOfTables) BlankLines() int {
+	return bodyBlankLines(slices.Concat(a.entries, a.bodyTrivia))
+}
+
+func bodyComments(entries []Node) []*CommentNode {
+	var out []*CommentNode
+	add := func(nodes ...Node) {
+		for _, n := range nodes {
+			if c, ok := n.(*CommentNode); ok {
+				out = append(out, c)
+			}
+		}
+	}
+	for _, e := range entries {
+		if kv, ok := e.(*KeyValue); ok {
+			add(kv.leading()...)
+			add(kv.trailing()...)
+			continue
+		}
+		add(e)
+	}
+	return out
+}
+
+// bodyBlankLines counts the lines of a section body that hold nothing but
+// whitespace. The body starts on a fresh line after the header.
+func bodyBlankLines(entries []Node) int {
+	count, empty := 0, true
+	trivia := func(nodes ...Node) {
+		for _, n := range nodes {
+			if _, ok := n.(*WhitespaceNode); !ok {
+				empty = false
+				continue
+			}
+			for _, r := range n.Text() {
+				if r != '\n' {
+					continue
+				}
+				if empty {
+					count++
+				}
+				empty = true
+			}
+		}
+	}
+	for _, e := range entries {
+		kv, ok := e.(*KeyValue)
+		if !ok {
+			trivia(e)
+			continue
+		}
+		trivia(kv.leading()...)
+		empty = kv.newline != ""
+	}
+	return count
+}
+
+// Leaves returns an iterator over every key-value in the document whose
+// value is not an inline table, paired with its full dotted path. Inline
+// tables are descended into. Path segments are quoted where needed, so each
+// path is a valid argument to Get; key-values in an array-of-tables entry
+// share the header path of every other entry.
+func (d *Document) Leaves() iter.Seq2[string, *KeyValue] {
+	return func(yield func(string, *KeyValue) bool) {
+		for _, n := range d.nodes {
+			var prefix []KeyPart
+			var entries []Node
+			switch v := n.(type) {
+			case *KeyValue:
+				entries = []Node{v}
+			case *TableNode:
+				prefix, entries = v.headerParts, v.entries
+			case *ArrayOfTables:
+				prefix, entries = v.headerParts, v.entries
+			}
+			for _, e := range entries {
+				kv, ok := e.(*KeyValue)
+				if ok && !yieldLeaves(prefix, kv, yield) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func yieldLeaves(prefix []KeyPart, kv *KeyValue, yield func(string, *KeyValue) bool) bool {
+	parts := append(append([]KeyPart(nil), prefix...), kv.keyParts...)
+	if it, ok := kv.val.(*InlineTableNode); ok {
+		for _, child := range it.entries {
+			if !yieldLeaves(parts, child, yield) {
+				return false
+			}
+		}
+		return true
+	}
+	return yield(formatKeyPath(parts), kv)
+}
+
+// formatKeyPath renders key parts as a dotted path accepted by Get,
+// quoting segments that are not valid bare keys.
+func formatKeyPath(parts []KeyPart) string {
+	return JoinPath(partsToSegs(parts)...)
+}
+
+// QuoteKey returns s as a single TOML key segment: unchanged if it is a
+// valid bare key, otherwise as a basic string with escapes. Join quoted
+// segments with "." to build a dotted key or table header.
+func QuoteKey(s string) string {
+	if !KeyNeedsQuoting(s) {
+		return s
+	}
+	return `"` + escapeBasicString(s) + `"`
+}
+
+// KeyNeedsQuoting reports whether s must be quoted to be used as a key
+// segment: it is empty or contains a character other than A-Z, a-z, 0-9,
+// "-", and "_".
+func KeyNeedsQuoting(s string) bool {
+	return s == "" || strings.IndexFunc(s, func(r rune) bool { return !isBareKeyChar(r) }) >= 0
+}
+
 // ArrayOfTables returns all ArrayOfTables nodes matching the given dotted path.
 func (d *Document) ArrayOfTables(path string) []*ArrayOfTables {
 	segs := parseDottedPath(path)
@@ -257,6 +578,20 @@ func (n *InlineTableNode) Get(key string) *KeyValue {
 	return findInKVEntries(n.entries, segs)
 }
 
+// Len returns the number of entries in the inline table.
+func (n *InlineTableNode) Len() int {
+	return len(n.entries)
+}
+
+// Entry returns the entry at index i without copying.
+// Returns nil if the index is out of bounds.
+func (n *InlineTableNode) Entry(i int) *KeyValue {
+	if i < 0 || i >= len(n.entries) {
+		return nil
+	}
+	return n.entries[i]
+}
+
 // --- Value extraction methods ---
 
 // Value returns the unquoted, unescaped string content.
@@ -464,6 +799,238 @@ func (n *NumberNode) Float() (float64, error) {
 	return strconv.ParseFloat(clean, 64)
 }
 
+// Decimal is the exact decimal decomposition of a number literal, so that
+// Value = (-1 if Negative) * Coefficient * 10^Exponent.
+//
+// The coefficient keeps every digit that was written, including trailing
+// zeros, so the scale of the literal is preserved (1.50 has Coefficient
+// "150" and Exponent -2).
+type Decimal struct {
+	Negative    bool
+	Coefficient string // decimal digits without leading zeros ("0" for zero)
+	Exponent    int
+}
+
+// Decimal returns the exact decimal decomposition of the number literal
+// without going through float64. Hex, octal and binary integers are
+// converted to their decimal digits. Returns ErrNotDecimal for inf and nan.
+func (n *NumberNode) Decimal() (Decimal, error) {
+	clean := strings.ReplaceAll(n.text, "_", "")
+	if isSpecialFloat(clean) {
+		return Decimal{}, fmt.Errorf("%w: %s", ErrNotDecimal, n.text)
+	}
+	d := Decimal{Negative: strings.HasPrefix(clean, "-")}
+	clean = stripSign(clean)
+	var ok bool
+	if hasUnsignedPrefix(clean) {
+		d.Coefficient, ok = prefixIntDigits(clean)
+	} else {
+		d.Coefficient, d.Exponent, ok = splitDecimalMantissa(clean)
+	}
+	if !ok {
+		return Decimal{}, fmt.Errorf("%w: %s", ErrNotDecimal, n.text)
+	}
+	return d, nil
+}
+
+// prefixIntDigits converts a 0x/0o/0b integer body to decimal digits.
+func prefixIntDigits(clean string) (string, bool) {
+	bases := map[byte]int{'x': 16, 'o': 8, 'b': 2}
+	v, ok := new(big.Int).SetString(clean[2:], bases[clean[1]])
+	if !ok {
+		return "", false
+	}
+	return v.String(), true
+}
+
+// splitDecimalMantissa splits an unsigned decimal literal into its digit
+// coefficient and base-10 exponent.
+func splitDecimalMantissa(clean string) (string, int, bool) {
+	mantissa, expText, hasExp := strings.Cut(strings.ToLower(clean), "e")
+	exp := 0
+	if hasExp {
+		var err error
+		if exp, err = strconv.Atoi(expText); err != nil {
+			return "", 0, false
+		}
+	}
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	digits := intPart + fracPart
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", 0, false
+	}
+	coef := strings.TrimLeft(digits, "0")
+	if coef == "" {
+		coef = "0"
+	}
+	return coef, exp - len(fracPart), true
+}
+
+// Rat returns the decimal as an exact rational number.
+func (d Decimal) Rat() *big.Rat {
+	num, _ := new(big.Int).SetString(d.Coefficient, 10)
+	if num == nil {
+		num = new(big.Int)
+	}
+	if d.Negative {
+		num.Neg(num)
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(d.Exponent))), nil)
+	if d.Exponent < 0 {
+		return new(big.Rat).SetFrac(num, scale)
+	}
+	return new(big.Rat).SetInt(num.Mul(num, scale))
+}
+
+// String renders the decimal in plain notation when the exponent is zero or
+// negative (keeping trailing zeros, e.g. "1.50"), and as "<coefficient>e<exponent>"
+// when the exponent is positive.
+func (d Decimal) String() string {
+	var b strings.Builder
+	if d.Negative {
+		b.WriteByte('-')
+	}
+	switch {
+	case d.Exponent == 0:
+		b.WriteString(d.Coefficient)
+	case d.Exponent > 0:
+		fmt.Fprintf(&b, "%se%d", d.Coefficient, d.Exponent)
+	default:
+		digits := d.Coefficient
+		scale := -d.Exponent
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		b.WriteString(digits[:len(digits)-scale])
+		b.WriteByte('.')
+		b.WriteString(digits[len(digits)-scale:])
+	}
+	return b.String()
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// DateTimeKind identifies which of the four TOML datetime forms a value uses.
+type DateTimeKind int
+
+const (
+	OffsetDateTime DateTimeKind = iota // 1979-05-27T07:32:00Z
+	LocalDateTime                      // 1979-05-27T07:32:00
+	LocalDate                          // 1979-05-27
+	LocalTime                          // 07:32:00
+)
+
+// Kind reports which TOML datetime form the node holds.
+func (n *DateTimeNode) Kind() DateTimeKind {
+	switch {
+	case dtReOffsetDT.MatchString(n.text):
+		return OffsetDateTime
+	case dtReLocalDT.MatchString(n.text):
+		return LocalDateTime
+	case dtReLocalDate.MatchString(n.text):
+		return LocalDate
+	default:
+		return LocalTime
+	}
+}
+
+// In returns the datetime as a time.Time in loc. Offset datetimes are
+// converted to loc. Local datetimes, dates and times carry no offset and are
+// interpreted as wall-clock values in loc; a local time gets the zero date
+// (0000-01-01).
+func (n *DateTimeNode) In(loc *time.Location) (time.Time, error) {
+	return dateTimeIn(n.text, loc)
+}
+
+func dateTimeIn(text string, loc *time.Location) (time.Time, error) {
+	f, err := parseDateTimeFields(text)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if f.offset == nil {
+		return time.Date(f.year, time.Month(f.month), f.day, f.hour, f.minute, f.second, f.nanos, loc), nil
+	}
+	zone := time.FixedZone("", *f.offset)
+	return time.Date(f.year, time.Month(f.month), f.day, f.hour, f.minute, f.second, f.nanos, zone).In(loc), nil
+}
+
+// dateTimeFields holds the components of a TOML datetime literal.
+type dateTimeFields struct {
+	year, month, day     int
+	hour, minute, second int
+	nanos                int
+	fracDigits           int    // digits written after the decimal point
+	hasSeconds           bool   // seconds were written explicitly
+	sep                  byte   // date/time separator ('T', 't' or ' '), 0 if absent
+	offset               *int   // offset east of UTC in seconds, nil for local forms
+	offsetText           string // offset as written (e.g. "Z", "+05:30")
+}
+
+// parseDateTimeFields splits a TOML datetime literal into its components.
+func parseDateTimeFields(text string) (dateTimeFields, error) {
+	if msg := validateDateTimeText(text); msg != "" {
+		return dateTimeFields{}, fmt.Errorf("%w: %s", ErrInvalidDateTime, msg)
+	}
+	f := dateTimeFields{month: 1, day: 1}
+	rest := text
+	if len(text) >= 10 && text[4] == '-' {
+		f.year, _ = strconv.Atoi(text[0:4])
+		f.month, _ = strconv.Atoi(text[5:7])
+		f.day, _ = strconv.Atoi(text[8:10])
+		if len(text) == 10 {
+			return f, nil
+		}
+		f.sep = text[10]
+		rest = text[11:]
+	}
+	if idx := strings.IndexAny(rest, "Zz+-"); idx >= 0 {
+		f.offsetText = rest[idx:]
+		offset := parseOffsetSeconds(f.offsetText)
+		f.offset = &offset
+		rest = rest[:idx]
+	}
+	parseTimeFields(&f, rest)
+	return f, nil
+}
+
+// parseTimeFields fills the time-of-day components from "HH:MM[:SS[.frac]]".
+func parseTimeFields(f *dateTimeFields, s string) {
+	main, frac, _ := strings.Cut(s, ".")
+	parts := strings.Split(main, ":")
+	f.hour, _ = strconv.Atoi(parts[0])
+	f.minute, _ = strconv.Atoi(parts[1])
+	if len(parts) == 3 {
+		f.hasSeconds = true
+		f.second, _ = strconv.Atoi(parts[2])
+	}
+	f.fracDigits = len(frac)
+	if len(frac) > 9 {
+		frac = frac[:9]
+	}
+	if frac != "" {
+		f.nanos, _ = strconv.Atoi(frac + strings.Repeat("0", 9-len(frac)))
+	}
+}
+
+// parseOffsetSeconds converts "Z" or "+HH:MM"/"-HH:MM" to seconds east of UTC.
+func parseOffsetSeconds(s string) int {
+	if s == "Z" || s == "z" {
+		return 0
+	}
+	h, _ := strconv.Atoi(s[1:3])
+	m, _ := strconv.Atoi(s[4:6])
+	secs := h*3600 + m*60
+	if s[0] == '-' {
+		return -secs
+	}
+	return secs
+}
+
 // Value returns the boolean value (true or false).
 func (n *BooleanNode) Value() bool {
 	return n.text == "true"
@@ -1,9 +1,17 @@
 package toml
 
 import (
+	"errors"
+	"fmt"
 	"math"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 // --- Document.Get tests ---
@@ -191,6 +199,44 @@ func TestArrayOfTables_Get(t *testing.T) {
 	}
 }
 
+// --- Section entry filter tests ---
+
+func TestSectionEntryFilters(t *testing.T) {
+	src := "[a] # header\n# c\nx = 1 # t\n\n  \n\t# d\ny = 2\n\n# e\n[[b]]\nz = 3\n\nw = 4\n"
+	d, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	a := d.Table("a")
+	if err := a.AppendComment("f"); err != nil {
+		t.Fatal(err)
+	}
+	a.AppendBlankLine()
+
+	var keys []string
+	for _, kv := range a.KeyValues() {
+		keys = append(keys, kv.RawKey())
+	}
+	if got := strings.Join(keys, ","); got != "x,y" {
+		t.Errorf("KeyValues = %s", got)
+	}
+	var comments []string
+	for _, c := range a.Comments() {
+		comments = append(comments, c.Text())
+	}
+	if got := strings.Join(comments, ","); got != "# c,# t,# d,# f" {
+		t.Errorf("Comments = %s", got)
+	}
+	if got := a.BlankLines(); got != 3 {
+		t.Errorf("BlankLines = %d, want 3", got)
+	}
+
+	b := d.ArraysOfTables()[0]
+	if len(b.KeyValues()) != 2 || len(b.Comments()) != 0 || b.BlankLines() != 1 {
+		t.Errorf("AOT: %d key-values, %d comments, %d blank lines", len(b.KeyValues()), len(b.Comments()), b.BlankLines())
+	}
+}
+
 // --- InlineTableNode.Get tests ---
 
 func TestInlineTableNode_Get(t *testing.T) {
@@ -537,6 +583,137 @@ func TestNumberNode_Float_Exponent(t *testing.T) {
 	}
 }
 
+// --- NumberNode.Decimal tests ---
+
+func TestNumberNode_Decimal(t *testing.T) {
+	tests := []struct {
+		text string
+		want Decimal
+		str  string
+	}{
+		{"42", Decimal{Coefficient: "42"}, "42"},
+		{"-17", Decimal{Negative: true, Coefficient: "17"}, "-17"},
+		{"+0", Decimal{Coefficient: "0"}, "0"},
+		{"1_000", Decimal{Coefficient: "1000"}, "1000"},
+		{"0.10", Decimal{Coefficient: "10", Exponent: -2}, "0.10"},
+		{"1.50", Decimal{Coefficient: "150", Exponent: -2}, "1.50"},
+		{"-0.001", Decimal{Negative: true, Coefficient: "1", Exponent: -3}, "-0.001"},
+		{"5e+22", Decimal{Coefficient: "5", Exponent: 22}, "5e22"},
+		{"6.626e-34", Decimal{Coefficient: "6626", Exponent: -37}, "0.0000000000000000000000000000000006626"},
+		{"1E2", Decimal{Coefficient: "1", Exponent: 2}, "1e2"},
+		{"0xDEAD", Decimal{Coefficient: "57005"}, "57005"},
+		{"0o755", Decimal{Coefficient: "493"}, "493"},
+		{"0b1101", Decimal{Coefficient: "13"}, "13"},
+	}
+	for _, tt := range tests {
+		n := &NumberNode{leafNode: newLeaf(tt.text)}
+		got, err := n.Decimal()
+		if err != nil {
+			t.Errorf("Decimal() for %q: %v", tt.text, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Decimal() for %q: got %+v, want %+v", tt.text, got, tt.want)
+		}
+		if got.String() != tt.str {
+			t.Errorf("Decimal().String() for %q: got %q, want %q", tt.text, got.String(), tt.str)
+		}
+	}
+}
+
+func TestNumberNode_Decimal_SpecialFloats(t *testing.T) {
+	for _, text := range []string{"inf", "+inf", "-inf", "nan", "-nan"} {
+		n := &NumberNode{leafNode: newLeaf(text)}
+		if _, err := n.Decimal(); !errors.Is(err, ErrNotDecimal) {
+			t.Errorf("Decimal() for %q: expected ErrNotDecimal, got %v", text, err)
+		}
+	}
+}
+
+func TestDecimal_Rat(t *testing.T) {
+	d, err := Parse([]byte("rate = 0.1\ntotal = -2.5e3\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	rate, err := d.Get("rate").val.(*NumberNode).Decimal()
+	if err != nil {
+		t.Fatalf("Decimal() error: %v", err)
+	}
+	if got := rate.Rat().String(); got != "1/10" {
+		t.Fatalf("expected 1/10, got %s", got)
+	}
+	total, err := d.Get("total").val.(*NumberNode).Decimal()
+	if err != nil {
+		t.Fatalf("Decimal() error: %v", err)
+	}
+	if got := total.Rat().String(); got != "-2500/1" {
+		t.Fatalf("expected -2500/1, got %s", got)
+	}
+}
+
+// --- DateTimeNode tests ---
+
+func TestDateTimeNode_Kind(t *testing.T) {
+	tests := []struct {
+		text string
+		want DateTimeKind
+	}{
+		{"1979-05-27T07:32:00Z", OffsetDateTime},
+		{"1979-05-27 07:32:00-07:00", OffsetDateTime},
+		{"1979-05-27T07:32:00.999", LocalDateTime},
+		{"1979-05-27", LocalDate},
+		{"07:32", LocalTime},
+	}
+	for _, tt := range tests {
+		n := &DateTimeNode{leafNode: newLeaf(tt.text)}
+		if got := n.Kind(); got != tt.want {
+			t.Errorf("Kind() for %q: got %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDateTimeNode_In_Offset(t *testing.T) {
+	n := &DateTimeNode{leafNode: newLeaf("1979-05-27T00:32:00.5-07:00")}
+	got, err := n.In(time.UTC)
+	if err != nil {
+		t.Fatalf("In() error: %v", err)
+	}
+	want := time.Date(1979, 5, 27, 7, 32, 0, 500000000, time.UTC)
+	if !got.Equal(want) || got.Location() != time.UTC {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestDateTimeNode_In_Local(t *testing.T) {
+	loc := time.FixedZone("test", 3*3600)
+	tests := []struct {
+		text string
+		want time.Time
+	}{
+		{"1979-05-27T07:32", time.Date(1979, 5, 27, 7, 32, 0, 0, loc)},
+		{"1979-05-27", time.Date(1979, 5, 27, 0, 0, 0, 0, loc)},
+		{"07:32:10", time.Date(0, 1, 1, 7, 32, 10, 0, loc)},
+	}
+	for _, tt := range tests {
+		n := &DateTimeNode{leafNode: newLeaf(tt.text)}
+		got, err := n.In(loc)
+		if err != nil {
+			t.Errorf("In() for %q: %v", tt.text, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("In() for %q: got %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDateTimeNode_In_Invalid(t *testing.T) {
+	n := &DateTimeNode{leafNode: newLeaf("1979-13-27")}
+	if _, err := n.In(time.UTC); !errors.Is(err, ErrInvalidDateTime) {
+		t.Fatalf("expected ErrInvalidDateTime, got %v", err)
+	}
+}
+
 // --- BooleanNode.Value tests ---
 
 func TestBooleanNode_Value_True(t *testing.T) {
@@ -712,7 +889,7 @@ func TestDocument_Delete_QuotedDottedKey(t *testing.T) {
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	if !d.Delete(`site."google.com"`) {
+	if _, ok := d.Delete(`site."google.com"`); !ok {
 		t.Fatal("expected Delete to return true")
 	}
 	got := d.String()
@@ -851,3 +1028,1551 @@ func TestArrayNode_Element_OutOfBounds(t *testing.T) {
 		t.Fatal("expected nil for negative index")
 	}
 }
+
+func TestDocument_Leaves(t *testing.T) {
+	input := "top = 1\nsrv = { host = \"h\", tls = { on = true } }\n[site.\"google.com\"]\nrank = 1\n[[arr]]\nk = 1\n[[arr]]\nk = 2\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var got []string
+	for path, kv := range d.Leaves() {
+		got = append(got, path+"="+kv.Val().Text())
+		if path != "arr.k" && d.Get(path) != kv {
+			t.Errorf("Get(%q) does not return the yielded key-value", path)
+		}
+	}
+	want := []string{"top=1", `srv.host="h"`, "srv.tls.on=true", `site."google.com".rank=1`, "arr.k=1", "arr.k=2"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected leaves:\n got %v\nwant %v", got, want)
+	}
+	n := 0
+	for range d.Leaves() {
+		n++
+		if n == 2 {
+			break
+		}
+	}
+	if n != 2 {
+		t.Fatalf("expected early break after 2 leaves, got %d", n)
+	}
+}
+
+// --- CompletionsAt tests ---
+
+var completionSchema = &Schema{
+	Type: TypeTable,
+	Fields: map[string]*Schema{
+		"title": {Type: TypeString, Description: "Display name."},
+		"server": {Type: TypeTable, Fields: map[string]*Schema{
+			"host":    {Type: TypeString, Default: `"localhost"`},
+			"port":    {Type: TypeInteger, Default: "8080"},
+			"tls":     {Type: TypeBoolean},
+			"backend": {Type: TypeString, Values: []string{`"s3"`, `"gcs"`}},
+			"limits":  {Type: TypeTable, Fields: map[string]*Schema{"cpu": {Type: TypeInteger}}},
+		}},
+		"peer": {Type: TypeArrayOfTables, Fields: map[string]*Schema{"name": {Type: TypeString}}},
+	},
+}
+
+func completionLabels(c []Candidate) string {
+	var labels []string
+	for _, x := range c {
+		labels = append(labels, x.Label)
+	}
+	return strings.Join(labels, " ")
+}
+
+func TestCompletionsAt(t *testing.T) {
+	input := "title = \"x\"\n[server]\nhost = \"h\"\nbackend = \"s3\"\nba = 1\ntls = true\n\n[se]\n[[pe]]\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	at := func(marker string, delta int) int {
+		i := strings.Index(input, marker)
+		if i < 0 {
+			t.Fatalf("marker %q not found", marker)
+		}
+		return i + delta
+	}
+	tests := []struct {
+		name   string
+		offset int
+		want   string
+	}{
+		{"partial key", at("ba =", 2), "backend"},
+		{"value enum", at(`"s3"`, 0), `"s3" "gcs"`},
+		{"boolean value", at("true", 2), "true false"},
+		{"default value", at(`"h"`, 1), `"localhost"`},
+		{"empty line skips present keys", at("\n\n[se]", 1), "limits port"},
+		{"table header", at("[se]", 3), "server server.limits"},
+		{"array of tables header", at("[[pe]]", 4), "peer"},
+		{"root key", at("title", 0), "server title"},
+	}
+	for _, tt := range tests {
+		got := completionLabels(CompletionsAt(d, completionSchema, tt.offset))
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	c := CompletionsAt(d, completionSchema, at("ba =", 2))
+	if c[0].Replace != (Span{at("ba =", 0), at("ba =", 2)}) || c[0].Detail != "string" {
+		t.Errorf("unexpected candidate %+v", c[0])
+	}
+}
+
+func TestCompletionsAt_DottedAndComment(t *testing.T) {
+	input := "# note\nserver.limits.c = 1\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if got := completionLabels(CompletionsAt(d, completionSchema, strings.Index(input, ".c =")+2)); got != "server.limits.cpu" {
+		t.Errorf("dotted key: got %q", got)
+	}
+	if got := CompletionsAt(d, completionSchema, 3); got != nil {
+		t.Errorf("expected no completions inside a comment, got %v", got)
+	}
+	if got := completionLabels(CompletionsAt(d, completionSchema, strings.Index(input, "limits")+3)); got != "server.limits" {
+		t.Errorf("key after a dot: got %q", got)
+	}
+
+	schema := &Schema{Type: TypeTable, Fields: map[string]*Schema{
+		"a.b": {Type: TypeTable, Fields: map[string]*Schema{"cpu": {Type: TypeInteger}, "mem": {Type: TypeInteger}}},
+	}}
+	input = "\"a.b\" . c = 1\n"
+	d = mustParse(t, input)
+	if got := completionLabels(CompletionsAt(d, schema, strings.Index(input, "c ")+1)); got != `"a.b".cpu` {
+		t.Errorf("quoted segment with a dot: got %q", got)
+	}
+	if got := completionLabels(CompletionsAt(d, schema, strings.Index(input, "b")+1)); got != `"a.b"` {
+		t.Errorf("inside a quoted segment: got %q", got)
+	}
+}
+
+// --- Outline tests ---
+
+func outlineString(secs []*Section, depth int) string {
+	var b strings.Builder
+	kinds := map[SectionKind]string{SectionTable: "T", SectionArrayOfTables: "A", SectionArrayEntry: "E", SectionValue: "V"}
+	for _, s := range secs {
+		fmt.Fprintf(&b, "%s%s %s\n", strings.Repeat("  ", depth), kinds[s.Kind], s.Path)
+		b.WriteString(outlineString(s.Children, depth+1))
+	}
+	return b.String()
+}
+
+func TestDocument_Outline(t *testing.T) {
+	input := `msg = """
+hi"""
+[a]
+x = 1
+[a.b]
+y = [
+  1,
+]
+[[srv]]
+n = 1
+[srv.tls]
+on = true
+[[srv]]
+n = 2 # last
+[c]
+`
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	secs := d.Outline()
+	want := `V msg
+T a
+  T a.b
+    V a.b.y
+A srv
+  E srv
+    T srv.tls
+  E srv
+T c
+`
+	if got := outlineString(secs, 0); got != want {
+		t.Fatalf("unexpected outline:\n%s", got)
+	}
+	a := secs[1]
+	if got := input[a.Span.Start:a.Span.End]; got != "[a]\nx = 1\n[a.b]\ny = [\n  1,\n]" {
+		t.Errorf("unexpected table span %q", got)
+	}
+	if got := input[a.Header.Start:a.Header.End]; got != "[a]" {
+		t.Errorf("unexpected header span %q", got)
+	}
+	group := secs[2]
+	if got := input[group.Span.Start:group.Span.End]; !strings.HasPrefix(got, "[[srv]]\nn = 1") || !strings.HasSuffix(got, "n = 2 # last") {
+		t.Errorf("unexpected group span %q", got)
+	}
+	if v := a.Children[0].Children[0]; input[v.Header.Start:v.Header.End] != "y" {
+		t.Errorf("unexpected value header %v", v.Header)
+	}
+}
+
+func TestSemanticTokens(t *testing.T) {
+	src := "# c\n[a.\"b\"]\nk = \"x\\ty\" # t\narr = [1, true, # n\n 1979-05-27]\nit = {p = 'q', r = 2}\n[[aot]]\n"
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	text := doc.String()
+	var got []string
+	for _, tok := range SemanticTokens(doc) {
+		got = append(got, fmt.Sprintf("%d:%s", tok.Class, text[tok.Span.Start:tok.Span.End]))
+	}
+	want := []string{
+		"7:# c", "8:[", "1:a", "8:.", `1:"b"`, "8:]",
+		"0:k", "8:=", `2:"x`, `3:\t`, `2:y"`, "7:# t",
+		"0:arr", "8:=", "8:[", "4:1", "8:,", "5:true", "8:,", "7:# n", "6:1979-05-27", "8:]",
+		"0:it", "8:=", "8:{", "0:p", "8:=", "2:'q'", "8:,", "0:r", "8:=", "4:2", "8:}",
+		"8:[[", "1:aot", "8:]]",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("tokens:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestSemanticTokens_ConstructedArray(t *testing.T) {
+	doc, err := Parse([]byte("a = 1\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	arr, err := NewArray(NewString("x,y"), NewInteger(2))
+	if err != nil {
+		t.Fatalf("NewArray: %v", err)
+	}
+	if err := doc.Get("a").SetValue(arr); err != nil {
+		t.Fatalf("SetValue: %v", err)
+	}
+	text := doc.String()
+	var punct []int
+	for _, tok := range SemanticTokens(doc) {
+		if tok.Class == TokenPunctuation {
+			punct = append(punct, tok.Span.Start)
+		}
+	}
+	if fmt.Sprint(punct) != "[2 4 10 13]" {
+		t.Errorf("punctuation at %v in %q", punct, text)
+	}
+}
+
+func TestDocComment(t *testing.T) {
+	src := "# unrelated\n\n# Listen port.\n#   Must be > 1024.\nport = 8080 # TCP\nhost = \"x\"\n\n# Server settings.\n[server] # main\n# Bind address.\naddr = \"::\"\n"
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	tests := []struct {
+		path, want string
+	}{
+		{"port", "Listen port.\n  Must be > 1024.\nTCP"},
+		{"host", ""},
+		{"server.addr", "Bind address."},
+	}
+	for _, tt := range tests {
+		if got := DocComment(doc.Get(tt.path)); got != tt.want {
+			t.Errorf("DocComment(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+	if got := SectionDocComment(doc.Table("server")); got != "Server settings.\nmain" {
+		t.Errorf("SectionDocComment(server) = %q", got)
+	}
+}
+
+func TestDocument_Index(t *testing.T) {
+	src := `title = "x"
+a.b.c = 1
+[srv]
+port = 8080
+tls = { cert = "c", opts.strict = true }
+[db.primary]
+hosts = ["h"]
+[[fruit]]
+name = "apple"
+[[fruit]]
+color = "red"
+[fruit.size]
+w = 1.5
+`
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	x := doc.Index()
+	kinds := []struct {
+		path string
+		want ValueType
+	}{
+		{"title", TypeString},
+		{"a", TypeTable},
+		{"a.b.c", TypeInteger},
+		{"srv.tls", TypeTable},
+		{"srv.tls.opts.strict", TypeBoolean},
+		{"db", TypeTable},
+		{"db.primary.hosts", TypeArray},
+		{"fruit", TypeArrayOfTables},
+		{"fruit.name", TypeString},
+		{"fruit.color", TypeString},
+		{"fruit.size.w", TypeFloat},
+	}
+	for _, tt := range kinds {
+		got, ok := x.KindOf(tt.path)
+		if !ok || got != tt.want {
+			t.Errorf("KindOf(%q) = %v, %v; want %v", tt.path, got, ok, tt.want)
+		}
+	}
+	if _, ok := x.KindOf("srv.missing"); ok {
+		t.Error("KindOf(srv.missing) found a value")
+	}
+	if !x.IsTable("db") || !x.IsTable("srv.tls.opts") || x.IsTable("fruit") || x.IsTable("title") {
+		t.Error("IsTable gave the wrong answer")
+	}
+	if got := fmt.Sprint(x.ChildrenOf("")); got != "[title a srv db fruit]" {
+		t.Errorf("ChildrenOf(root) = %s", got)
+	}
+	if got := fmt.Sprint(x.ChildrenOf("fruit")); got != "[name color size]" {
+		t.Errorf("ChildrenOf(fruit) = %s", got)
+	}
+	if got := fmt.Sprint(x.ChildrenOf("srv.tls")); got != "[cert opts]" {
+		t.Errorf("ChildrenOf(srv.tls) = %s", got)
+	}
+}
+
+func TestDocument_Index_Cached(t *testing.T) {
+	doc := mustParse(t, "a = 1\n[t]\nb = 2\nc = 3\n")
+	x := doc.Index()
+	if doc.Index() != x {
+		t.Fatal("Index was rebuilt without a change")
+	}
+	changes := []struct {
+		name string
+		fn   func() error
+	}{
+		{"SetValue", func() error { return doc.Get("a").SetValue(NewString("x")) }},
+		{"Append", func() error {
+			kv, err := NewKeyValue("d", NewInteger(4))
+			if err != nil {
+				return err
+			}
+			return doc.Table("t").Append(kv)
+		}},
+		{"SortKeys", func() error { doc.SortKeys(ByteOrder); return nil }},
+		{"Delete", func() error { doc.Delete("t.b"); return nil }},
+		{"CommentOut", func() error { return doc.CommentOut("t.c") }},
+		{"DeleteTable", func() error { doc.DeleteTable("t"); return nil }},
+	}
+	for _, c := range changes {
+		before := doc.Index()
+		if err := c.fn(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		after := doc.Index()
+		if after == before {
+			t.Errorf("%s: Index was not rebuilt", c.name)
+		}
+		fresh := mustParse(t, doc.String()).Index()
+		if !reflect.DeepEqual(after.children, fresh.children) {
+			t.Errorf("%s: Index children = %v, want %v", c.name, after.children, fresh.children)
+		}
+	}
+	if kv := doc.Get("a"); kv == nil || kv.RawVal() != `"x"` {
+		t.Errorf("Get(a) = %v after SetValue", kv)
+	}
+}
+
+// TestDocument_Get_Index checks that Get, which answers from the index
+// where it can, finds what a scan of the nodes finds.
+func TestDocument_Get_Index(t *testing.T) {
+	docs := map[string]string{"inline": `a = { b = { c = 1 }, d.e = 2 }
+x.y = 1
+x.z = { w = 2 }
+[t.u]
+v = 1
+"q.r" = 2
+[t]
+s.k = 3
+[[aot]]
+n = 1
+[aot.sub]
+m = 2
+[[aot]]
+n = 2
+`}
+	files, _ := filepath.Glob("testdata/corpus/*.toml")
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs[f] = string(b)
+	}
+	for name, src := range docs {
+		doc := mustParse(t, src)
+		scan := func(segs []string) *KeyValue {
+			if kv := findInEntries(doc.nodes, segs); kv != nil {
+				return kv
+			}
+			return doc.getFromTables(segs)
+		}
+		for key := range doc.Index().entries {
+			segs := pathKeySegs(key)
+			for _, segs := range [][]string{segs, append(slices.Clone(segs), "missing")} {
+				if got, want := doc.get(segs), scan(segs); got != want {
+					t.Errorf("%s: get(%q) = %v, want %v", name, segs, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestDocument_HasAndKindAt(t *testing.T) {
+	src := `a.b.c = 1
+[srv.http]
+port = 80
+inline = { x = { y = "z" } }
+[[fruit]]
+name = "apple"
+[[fruit]]
+color = "red"
+[[fruit.variety]]
+name = "gala"
+`
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	tests := []struct {
+		path string
+		want ValueType
+		ok   bool
+	}{
+		{"a", TypeTable, true},
+		{"a.b.c", TypeInteger, true},
+		{"srv", TypeTable, true},
+		{"srv.http.port", TypeInteger, true},
+		{"srv.http.inline.x.y", TypeString, true},
+		{"fruit", TypeArrayOfTables, true},
+		{"fruit.color", TypeString, true},
+		{"fruit.name", TypeAny, false}, // only in the first entry
+		{"fruit.variety.name", TypeString, true},
+		{"srv.http.port.x", TypeAny, false},
+		{"missing", TypeAny, false},
+		{"", TypeAny, false},
+	}
+	for _, tt := range tests {
+		got, ok := doc.KindAt(tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("KindAt(%q) = %v, %v; want %v, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+		if doc.Has(tt.path) != tt.ok {
+			t.Errorf("Has(%q) = %v", tt.path, !tt.ok)
+		}
+	}
+}
+
+func TestDocument_HasAfterChange(t *testing.T) {
+	doc := mustParse(t, "[srv]\nport = 80\n")
+	root := doc.logicalRoot()
+	if !doc.Has("srv.port") || doc.logicalRoot() != root {
+		t.Fatal("the logical view was rebuilt without a change")
+	}
+	if err := doc.Resolve("srv").Set("tls.on", NewBool(true)); err != nil {
+		t.Fatal(err)
+	}
+	if !doc.Has("srv.tls.on") {
+		t.Error("Has(srv.tls.on) = false after Set")
+	}
+	if doc.Delete("srv.port"); doc.Has("srv.port") {
+		t.Error("Has(srv.port) = true after Delete")
+	}
+	if err := doc.Get("srv.tls.on").SetValue(NewInteger(1)); err != nil {
+		t.Fatal(err)
+	}
+	if kind, _ := doc.KindAt("srv.tls.on"); kind != TypeInteger {
+		t.Errorf("KindAt(srv.tls.on) = %v after SetValue", kind)
+	}
+	if doc.DeleteTable("srv"); doc.Has("srv") {
+		t.Error("Has(srv) = true after DeleteTable")
+	}
+}
+
+func TestDocument_Resolve(t *testing.T) {
+	// srv is built from a header, dotted keys and an inline table.
+	src := `[srv.http]
+port = 80
+[srv]
+name = "x"
+tls = { on = true }
+timeout.read = 5
+timeout.write = 6
+[[srv.backend]]
+host = "a"
+[[srv.backend]]
+host = "b"
+`
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	srv := doc.Resolve("srv")
+	if srv == nil {
+		t.Fatal("Resolve(srv) = nil")
+	}
+	if got := fmt.Sprint(srv.Keys()); got != "[http name tls timeout backend]" {
+		t.Errorf("Keys() = %s", got)
+	}
+	var vals []string
+	for name, kv := range srv.Values() {
+		vals = append(vals, name+"="+kv.RawVal())
+	}
+	if got := strings.Join(vals, " "); got != `name="x"` {
+		t.Errorf("Values() = %s", got)
+	}
+	if kv := srv.Get("timeout.write"); kv == nil || kv.RawVal() != "6" {
+		t.Errorf("Get(timeout.write) = %v", kv)
+	}
+	if srv.Get("tls") != nil {
+		t.Error("Get returned an inline table")
+	}
+	if on := srv.Table("tls").Get("on"); on == nil || on.RawVal() != "true" {
+		t.Errorf("tls.on = %v", on)
+	}
+	timeout := doc.Resolve("srv.timeout")
+	defs := timeout.Definitions()
+	if len(defs) != 2 || defs[0] != doc.Get("srv.timeout.read") || defs[1] != doc.Get("srv.timeout.write") {
+		t.Errorf("Definitions() = %v", defs)
+	}
+	if got := srv.Definitions(); len(got) != 2 || got[0] != doc.Table("srv.http") || got[1] != doc.Table("srv") {
+		t.Errorf("srv Definitions() = %v", got)
+	}
+	if b := doc.Resolve("srv.backend"); b == nil || b.Get("host").RawVal() != `"b"` {
+		t.Error("Resolve(srv.backend) is not the last entry")
+	}
+	entries := srv.Entries("backend")
+	if len(entries) != 2 || entries[0].Get("host").RawVal() != `"a"` || entries[0].Path() != "srv.backend" {
+		t.Errorf("Entries(backend) = %v", entries)
+	}
+	if doc.Resolve("srv.name") != nil || doc.Resolve("nope") != nil {
+		t.Error("Resolve returned a non-table")
+	}
+	if root := doc.Resolve(""); root == nil || fmt.Sprint(root.Keys()) != "[srv]" {
+		t.Error("Resolve(\"\") is not the root table")
+	}
+}
+
+func TestDocument_Get_IndexedAOT(t *testing.T) {
+	src := `[[fruit]]
+name = "apple"
+[[fruit.variety]]
+name = "red delicious"
+[[fruit.variety]]
+name = "granny smith"
+[[fruit]]
+name = "banana"
+[fruit.physical]
+color = "yellow"
+[[fruit.variety]]
+name = "plantain"
+`
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	tests := []struct {
+		path, want string
+	}{
+		{"fruit.name", `"apple"`},
+		{"fruit.variety.name", `"red delicious"`},
+		{"fruit[0].variety[1].name", `"granny smith"`},
+		{"fruit[1].name", `"banana"`},
+		{"fruit[-1].variety[0].name", `"plantain"`},
+		{"fruit[1].physical.color", `"yellow"`},
+		{"fruit[1].variety.name", `"plantain"`},
+		{"fruit[2].name", ""},
+		{"fruit[0]", ""},
+		{"fruit[0].name[0]", ""},
+		{`"fruit[0]"`, ""},
+		{"t.ü", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if kv := doc.Get(tt.path); kv != nil {
+			got = kv.RawVal()
+		}
+		if got != tt.want {
+			t.Errorf("Get(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+	if _, ok := doc.Delete("fruit[0].variety[-1].name"); !ok {
+		t.Fatal("Delete returned false")
+	}
+	if doc.Get("fruit[0].variety[1].name") != nil {
+		t.Error("key still present after Delete")
+	}
+}
+
+// --- KeyValue As* tests ---
+
+func TestKeyValue_As(t *testing.T) {
+	src := "s = \"x\"\nn = \"42\"\ni = 0x10\nf = 2.0\nh = 2.5\nb = true\nbs = \"false\"\n" +
+		"d = 1979-05-27T07:32:00-07:00\nld = 1979-05-27\nds = \"1979-05-27T07:32:00Z\"\nl = [\"a\", 1, true]\nm = [[1]]\nt = { a = 1 }\n"
+	d, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	str := func(key string) string {
+		v, err := d.Get(key).AsString()
+		if err != nil {
+			return "error"
+		}
+		return v
+	}
+	if got := []string{str("s"), str("i"), str("b"), str("d"), str("t")}; fmt.Sprint(got) != "[x 0x10 true 1979-05-27T07:32:00-07:00 error]" {
+		t.Errorf("AsString: %q", got)
+	}
+	for key, want := range map[string]int64{"n": 42, "i": 16, "f": 2} {
+		if v, err := d.Get(key).AsInt(); err != nil || v != want {
+			t.Errorf("AsInt(%s) = %v, %v", key, v, err)
+		}
+	}
+	for _, key := range []string{"h", "b", "s"} {
+		if _, err := d.Get(key).AsInt(); !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("AsInt(%s) = %v", key, err)
+		}
+	}
+	if v, err := d.Get("i").AsFloat(); err != nil || v != 16 {
+		t.Errorf("AsFloat(i) = %v, %v", v, err)
+	}
+	if v, err := d.Get("bs").AsBool(); err != nil || v {
+		t.Errorf("AsBool(bs) = %v, %v", v, err)
+	}
+	for key, want := range map[string]string{"d": "1979-05-27T14:32:00Z", "ld": "1979-05-27T00:00:00Z", "ds": "1979-05-27T07:32:00Z"} {
+		if v, err := d.Get(key).AsTime(); err != nil || v.UTC().Format(time.RFC3339) != want {
+			t.Errorf("AsTime(%s) = %v, %v", key, v, err)
+		}
+	}
+	if v, err := d.Get("l").AsStringSlice(); err != nil || fmt.Sprint(v) != "[a 1 true]" {
+		t.Errorf("AsStringSlice(l) = %q, %v", v, err)
+	}
+	if _, err := d.Get("m").AsStringSlice(); err == nil || err.Error() != "type mismatch: m[0] is array, not string" {
+		t.Errorf("AsStringSlice(m) = %v", err)
+	}
+	if _, err := d.Get("b").AsFloat(); err == nil || err.Error() != "type mismatch: b is boolean true, not float" {
+		t.Errorf("AsFloat(b) = %v", err)
+	}
+	if _, err := d.Get("missing").AsString(); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("AsString(missing) = %v", err)
+	}
+}
+
+func TestInlineTableNode_ToMapAndGetters(t *testing.T) {
+	d, err := Parse([]byte(`pt = { x = 1, y = 2.5, "a.b" = "q", cred.user = "u", cred.tags = ["t"], at = 1979-05-27, tls = { on = true } }` + "\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	it := d.Get("pt").Val().(*InlineTableNode)
+	var keys []string
+	for k := range it.ToMap() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if got := strings.Join(keys, " "); got != `"a.b" at cred.tags cred.user tls x y` {
+		t.Errorf("ToMap keys = %s", got)
+	}
+	if v, err := it.GetInt("x"); err != nil || v != 1 {
+		t.Errorf("GetInt(x) = %v, %v", v, err)
+	}
+	if v, err := it.GetFloat("y"); err != nil || v != 2.5 {
+		t.Errorf("GetFloat(y) = %v, %v", v, err)
+	}
+	if v, err := it.GetString(`"a.b"`); err != nil || v != "q" {
+		t.Errorf(`GetString("a.b") = %v, %v`, v, err)
+	}
+	if v, err := it.GetString("cred.user"); err != nil || v != "u" {
+		t.Errorf("GetString(cred.user) = %v, %v", v, err)
+	}
+	if v, err := it.GetStringSlice("cred.tags"); err != nil || len(v) != 1 {
+		t.Errorf("GetStringSlice(cred.tags) = %v, %v", v, err)
+	}
+	if v, err := it.GetBool("tls.on"); err != nil || !v {
+		t.Errorf("GetBool(tls.on) = %v, %v", v, err)
+	}
+	if v, err := it.GetTime("at"); err != nil || v.Year() != 1979 {
+		t.Errorf("GetTime(at) = %v, %v", v, err)
+	}
+	if _, err := it.GetInt("y"); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("GetInt(y) = %v", err)
+	}
+	if _, err := it.GetString("z"); !errors.Is(err, ErrKeyNotFound) || !strings.Contains(err.Error(), "z") {
+		t.Errorf("GetString(z) = %v", err)
+	}
+}
+
+func TestQuoteKey(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"server", "server"},
+		{"a-b_9", "a-b_9"},
+		{"", `""`},
+		{"google.com", `"google.com"`},
+		{"has space", `"has space"`},
+		{`q"t`, `"q\"t"`},
+		{"tab\t", `"tab\t"`},
+		{"ключ", `"ключ"`},
+	}
+	for _, tt := range tests {
+		if got := QuoteKey(tt.in); got != tt.want {
+			t.Errorf("QuoteKey(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+		if got := KeyNeedsQuoting(tt.in); got != (tt.in != tt.want) {
+			t.Errorf("KeyNeedsQuoting(%q) = %v", tt.in, got)
+		}
+		parts, _, err := parseRawKey(tt.want)
+		if err != nil || len(parts) != 1 || parts[0].Unquoted != tt.in {
+			t.Errorf("QuoteKey(%q) does not round-trip: %v %v", tt.in, parts, err)
+		}
+	}
+}
+
+func TestPath(t *testing.T) {
+	d, err := Parse([]byte("[site]\n\"google.com\" = true\n[\"a.b\".c]\nkey = 1\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	p := P("site", "google.com")
+	if got := p.String(); got != `site."google.com"` {
+		t.Errorf("String() = %s", got)
+	}
+	if kv := d.GetPath(p); kv == nil || kv != d.Get(p.String()) {
+		t.Errorf("GetPath(%v) = %v", p, kv)
+	}
+	if d.GetPath(P("site", "google", "com")) != nil {
+		t.Error("segments were split on dots")
+	}
+	tbl := P("a.b", "c")
+	if d.TablePath(tbl) == nil || d.GetPath(tbl.Child("key")) == nil {
+		t.Errorf("TablePath(%v) not found", tbl)
+	}
+	if err := d.Resolve("").SetPath(P("site", `x"y`), NewInteger(2)); err != nil {
+		t.Fatalf("SetPath: %v", err)
+	}
+	if !strings.Contains(d.String(), `"x\"y" = 2`) {
+		t.Errorf("SetPath wrote:\n%s", d.String())
+	}
+	kv := d.GetPath(p)
+	if got, ok := d.DeletePath(p); !ok || got != kv || d.GetPath(p) != nil {
+		t.Error("DeletePath did not remove the key")
+	}
+	if got, ok := d.DeletePath(p); ok || got != nil {
+		t.Error("DeletePath removed the key twice")
+	}
+}
+
+func TestJoinPath_SplitPath(t *testing.T) {
+	segs := []string{"", "a.b", `q"x`, "tab\t", "\x00", "é", "😀", "a b", "[0]", "'", `back\slash`, "plain"}
+	for _, s := range segs {
+		for _, in := range [][]string{{s}, {"top", s}, {s, s}} {
+			if got := SplitPath(JoinPath(in...)); !slices.Equal(got, in) {
+				t.Errorf("SplitPath(JoinPath(%q)) = %q", in, got)
+			}
+		}
+	}
+	if got := SplitPath(` a . "b.c" . 'd' `); !slices.Equal(got, []string{"a", "b.c", "d"}) {
+		t.Errorf("SplitPath = %q", got)
+	}
+
+	d := mustParse(t, "[\"q\\\"x\".\"\"]\n\"\\u00e9.😀\" = 1\n")
+	path := JoinPath(`q"x`, "", "é.😀")
+	if n, err := d.Get(path).AsInt(); err != nil || n != 1 {
+		t.Fatalf("Get(%s) = %d, %v", path, n, err)
+	}
+	if d.Table(JoinPath(`q"x`, "")) == nil {
+		t.Errorf("Table(%s) not found", JoinPath(`q"x`, ""))
+	}
+	if err := d.Resolve("").Set(path, NewInteger(2)); err != nil || d.Get(path).Val().Text() != "2" {
+		t.Errorf("Set(%s): %v", path, err)
+	}
+}
+
+func TestWithAliases(t *testing.T) {
+	d, err := Parse([]byte("[database]\nhostname = \"old\"\nport = 5432\n\n[cache]\nhost = \"new\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.WithAliases(map[string]string{"db.host": "database.hostname", "db": "database", "cache.host": "cache.server"})
+	if kv := d.Get("db.host"); kv == nil || kv != d.Get("database.hostname") {
+		t.Errorf("Get(db.host) = %v", kv)
+	}
+	if kv := d.GetPath(P("db", "port")); kv == nil || kv != d.Get("database.port") {
+		t.Errorf("GetPath(db.port) = %v", kv)
+	}
+	if kv := d.Get("cache.host"); kv == nil || kv.Val().Text() != `"new"` {
+		t.Errorf("Get(cache.host) = %v, want the current key", kv)
+	}
+	if d.Get("db.user") != nil {
+		t.Error("Get(db.user) found a key")
+	}
+	want := map[string]string{"db.host": "database.hostname", "db.port": "database.port"}
+	if got := d.UsedAliases(); !reflect.DeepEqual(got, want) {
+		t.Errorf("UsedAliases() = %v, want %v", got, want)
+	}
+	if got := (&Document{}).UsedAliases(); got != nil {
+		t.Errorf("UsedAliases() without aliases = %v", got)
+	}
+}
+
+// --- Lint tests ---
+
+func TestKeyValue_Deprecation(t *testing.T) {
+	d, err := Parse([]byte("# Listen address.\n# Deprecated: use server.port.\naddr = 1\nold = 2 # deprecated\nnew = 3 # not deprecated\nx = 4 # deprecatedness\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key  string
+		want *DeprecationInfo
+	}{
+		{"addr", &DeprecationInfo{Message: "use server.port.", Replacement: "server.port"}},
+		{"old", &DeprecationInfo{}},
+		{"new", nil},
+		{"x", nil},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		if got := d.Get(tt.key).Deprecation(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Deprecation() = %+v, want %+v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestDeprecatedKeys(t *testing.T) {
+	ref, err := Parse([]byte("[server]\n# deprecated: use server.port\naddr = 0\nport = 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Parse([]byte("[server]\nport = 80\naddr = 80\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := d.Lint(DeprecatedKeys(ref))
+	if len(got) != 1 || got[0].Path != "server.addr" || got[0].Node != d.Get("server.addr") {
+		t.Fatalf("Lint() = %v", got)
+	}
+	if want := "3:1: deprecated: server.addr is deprecated: use server.port"; got[0].String() != want {
+		t.Errorf("String() = %q, want %q", got[0].String(), want)
+	}
+	if got := ref.Lint(DeprecatedKeys(nil)); len(got) != 1 || got[0].Line != 3 {
+		t.Errorf("Lint() of the reference = %v", got)
+	}
+}
+
+func TestNumberStyle(t *testing.T) {
+	src := "a = +80\nb = 0xDEad\nc = 1E6\nd = [1000000, -2500000, 99999]\ne = { f = +1.5e3 }\nok = [1_000_000, 0o17, +inf, 0xff]\n"
+	d, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := d.Lint(NumberStyle(NumberStyleOptions{}))
+	var msgs []string
+	for _, f := range got {
+		msgs = append(msgs, f.String())
+	}
+	want := []string{
+		`1:5: number-style: +80: leading "+"`,
+		`2:5: number-style: 0xDEad: uppercase hex digits`,
+		`3:5: number-style: 1E6: uppercase exponent`,
+		`4:6: number-style: 1000000: digits not grouped`,
+		`4:15: number-style: -2500000: digits not grouped`,
+		`5:11: number-style: +1.5e3: leading "+"`,
+		`6:24: number-style: +inf: leading "+"`,
+	}
+	if !slices.Equal(msgs, want) {
+		t.Fatalf("Lint() =\n%s\nwant\n%s", strings.Join(msgs, "\n"), strings.Join(want, "\n"))
+	}
+	if got[3].Node.Parent() != d.Get("d").Val() {
+		t.Errorf("finding is not about the array element")
+	}
+	if n, err := ApplyFixes(got); n != len(got) || err != nil {
+		t.Fatalf("ApplyFixes() = %d, %v", n, err)
+	}
+	fixed := "a = 80\nb = 0xdead\nc = 1e6\nd = [1_000_000, -2_500_000, 99999]\ne = { f = 1.5e3 }\nok = [1_000_000, 0o17, inf, 0xff]\n"
+	if d.String() != fixed {
+		t.Errorf("after ApplyFixes:\n%s\nwant\n%s", d.String(), fixed)
+	}
+	if v, _ := d.Get("d").Val().(*ArrayNode).Elements()[1].(*NumberNode).Int(); v != -2500000 {
+		t.Errorf("fixed value = %d", v)
+	}
+	if got := d.Lint(NumberStyle(NumberStyleOptions{})); len(got) != 0 {
+		t.Errorf("Lint() after fixing = %v", got)
+	}
+	upper := d.Lint(NumberStyle(NumberStyleOptions{GroupDigits: -1, UpperHex: true, UpperExponent: true}))
+	if len(upper) != 4 || upper[0].Message != "0xdead: lowercase hex digits" {
+		t.Errorf("Lint() with upper case = %v", upper)
+	}
+}
+
+// --- KeyStyle tests ---
+
+func TestKeyCase_Convert(t *testing.T) {
+	tests := []struct {
+		in                  string
+		snake, kebab, camel string
+	}{
+		{"max_conns", "max_conns", "max-conns", "maxConns"},
+		{"MaxConns", "max_conns", "max-conns", "maxConns"},
+		{"HTTPServer", "http_server", "http-server", "httpServer"},
+		{"api-key v2", "api_key_v2", "api-key-v2", "apiKeyV2"},
+		{"id", "id", "id", "id"},
+		{"_", "_", "_", "_"},
+		{"-", "-", "-", "-"},
+		{"__", "__", "__", "__"},
+	}
+	for _, tt := range tests {
+		if got := SnakeCase.Convert(tt.in); got != tt.snake {
+			t.Errorf("SnakeCase.Convert(%q) = %q, want %q", tt.in, got, tt.snake)
+		}
+		if got := KebabCase.Convert(tt.in); got != tt.kebab {
+			t.Errorf("KebabCase.Convert(%q) = %q, want %q", tt.in, got, tt.kebab)
+		}
+		if got := CamelCase.Convert(tt.in); got != tt.camel {
+			t.Errorf("CamelCase.Convert(%q) = %q, want %q", tt.in, got, tt.camel)
+		}
+	}
+}
+
+func TestKeyStyle(t *testing.T) {
+	d := mustParse(t, `appName = "x"
+items = [{ BadKey = 1 }]
+
+[Server]
+maxConns = 5
+`)
+	findings := d.Lint(KeyStyle(SnakeCase))
+	var paths []string
+	for _, f := range findings {
+		paths = append(paths, f.Path)
+	}
+	if want := []string{"appName", "Server", "Server.maxConns"}; !slices.Equal(paths, want) {
+		t.Fatalf("finding paths = %v, want %v", paths, want)
+	}
+	if findings[0].Message != "appName is not snake_case: use app_name" {
+		t.Errorf("message = %q", findings[0].Message)
+	}
+	if n, err := ApplyFixes(findings); err != nil || n != 3 {
+		t.Fatalf("ApplyFixes = %d, %v", n, err)
+	}
+	want := `app_name = "x"
+items = [{ BadKey = 1 }]
+
+[server]
+max_conns = 5
+`
+	if got := d.String(); got != want {
+		t.Errorf("after ApplyFixes:\n%s\nwant\n%s", got, want)
+	}
+
+	d = mustParse(t, "_ = 1\n- = 2\n__ = 3\n")
+	if findings := d.Lint(KeyStyle(CamelCase)); len(findings) != 0 {
+		t.Errorf("separator-only keys: findings = %v", findings)
+	}
+}
+
+func TestDocument_NormalizeKeyCase(t *testing.T) {
+	d := mustParse(t, `[HTTPServer]
+port = 80
+readTimeout = 5
+
+[[HTTPServer.Routes]]
+path = "/"
+`)
+	renames, err := d.NormalizeKeyCase(KebabCase)
+	if err != nil {
+		t.Fatalf("NormalizeKeyCase: %v", err)
+	}
+	want := map[string]string{
+		"HTTPServer":             "http-server",
+		"HTTPServer.port":        "http-server.port",
+		"HTTPServer.readTimeout": "http-server.read-timeout",
+		"HTTPServer.Routes":      "http-server.routes",
+		"HTTPServer.Routes.path": "http-server.routes.path",
+	}
+	if !reflect.DeepEqual(renames, want) {
+		t.Errorf("renames = %v, want %v", renames, want)
+	}
+	if kv := d.Get("http-server.read-timeout"); kv == nil {
+		t.Errorf("http-server.read-timeout not found:\n%s", d.String())
+	}
+
+	d = mustParse(t, "max_conns = 1\nMaxConns = 2\n")
+	if _, err := d.NormalizeKeyCase(SnakeCase); !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("collision error = %v, want ErrDuplicateKey", err)
+	}
+	if got := d.String(); got != "max_conns = 1\nMaxConns = 2\n" {
+		t.Errorf("failed NormalizeKeyCase changed the document:\n%s", got)
+	}
+}
+
+// --- UnusedKeys tests ---
+
+func TestUnusedKeys(t *testing.T) {
+	type TLS struct {
+		Cert string `toml:"cert"`
+	}
+	type Server struct {
+		Port  int
+		TLS   *TLS              `toml:"tls"`
+		Extra map[string]string `toml:"extra"`
+		Skip  string            `toml:"-"`
+	}
+	type Plugin struct {
+		ID int `toml:"id"`
+	}
+	type Config struct {
+		Name    string
+		Server  Server   `toml:"server"`
+		Plugins []Plugin `toml:"plugin"`
+	}
+	d := mustParse(t, `name = "app"
+nmae = "typo"
+
+[server]
+port = 80
+Skip = "x"
+tls.cert = "a.pem"
+tls.key = "a.key"
+extra.anything = "ok"
+
+[server.old]
+a = 1
+
+[[plugin]]
+id = 1
+[[plugin]]
+id = 2
+path = "/p"
+`)
+	var got []string
+	for _, ref := range UnusedKeys(d, Config{}) {
+		got = append(got, fmt.Sprintf("%s@%d:%d", ref.Path, ref.Position.Line, ref.Position.Column))
+	}
+	want := []string{"nmae@2:1", "server.Skip@6:1", "server.tls.key@8:1", "server.old@11:1", "plugin.path@18:1"}
+	if !slices.Equal(got, want) {
+		t.Errorf("UnusedKeys(struct) = %v, want %v", got, want)
+	}
+
+	schema := &Schema{Type: TypeTable, Fields: map[string]*Schema{
+		"name":   {Type: TypeString},
+		"server": {Type: TypeTable},
+		"plugin": {Type: TypeArrayOfTables, Fields: map[string]*Schema{"id": {Type: TypeInteger}, "path": {Type: TypeString}}},
+	}}
+	refs := UnusedKeys(d, schema)
+	if len(refs) != 1 || refs[0].Path != "nmae" || refs[0].Node != d.Get("nmae") {
+		t.Errorf("UnusedKeys(schema) = %v", refs)
+	}
+
+	type Node struct {
+		Name     string  `toml:"name"`
+		Children []*Node `toml:"child"`
+	}
+	d = mustParse(t, "[[child]]\nname = \"a\"\n[[child.child]]\nname = \"b\"\nage = 3\n")
+	if refs := UnusedKeys(d, reflect.TypeFor[Node]()); len(refs) != 1 || refs[0].Path != "child.child.age" {
+		t.Errorf("UnusedKeys(recursive) = %v", refs)
+	}
+}
+
+// --- Constraint tests ---
+
+func TestCheckConstraints(t *testing.T) {
+	d := mustParse(t, `name = "app"
+
+[server]
+port = 80
+
+[tls]
+cert = "a.pem"
+insecure = true
+`)
+	portBelow1024 := func(doc *Document) error {
+		if n, err := doc.Get("server.port").AsInt(); err == nil && n < 1024 {
+			return doc.Violation("server.port", "server.port %d is privileged", n)
+		}
+		return nil
+	}
+	err := d.CheckConstraints(
+		Require("name", "server.host"),
+		MutuallyExclusive("tls.cert", "tls.insecure"),
+		Implies("tls.cert", "tls.key"),
+		Implies("missing", "name"),
+		portBelow1024,
+	)
+	var msgs []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		msgs = append(msgs, e.Error())
+	}
+	got := strings.Join(msgs, "\n")
+	want := `3:1: missing required key server.host
+8:1: tls.insecure cannot be set with tls.cert
+7:1: tls.cert requires tls.key
+4:1: server.port 80 is privileged`
+	if got != want {
+		t.Errorf("CheckConstraints:\n%s\nwant\n%s", got, want)
+	}
+	if !errors.Is(err, ErrKeyNotFound) || !errors.Is(err, ErrKeyConflict) || !errors.Is(err, ErrConstraint) {
+		t.Errorf("CheckConstraints error does not wrap the sentinels: %v", err)
+	}
+	var ce *ConstraintError
+	if !errors.As(err, &ce) || ce.Path != "server.host" || ce.Node != Node(d.Table("server")) {
+		t.Errorf("first violation = %+v", ce)
+	}
+	if err := d.CheckConstraints(Require("tls.cert"), Implies("server.port", "name")); err != nil {
+		t.Errorf("CheckConstraints(satisfied) = %v", err)
+	}
+	if e := mustParse(t, "").Violation("a.b", "bad"); e.Error() != "bad" || e.Node != nil {
+		t.Errorf("Violation on empty document = %+v", e)
+	}
+}
+
+// --- Schema.Check tests ---
+
+func TestSchema_Check(t *testing.T) {
+	minPort, maxPort := 1.0, 65535.0
+	schema := &Schema{Type: TypeTable, Fields: map[string]*Schema{
+		"name":    {Type: TypeString, Pattern: `^[a-z][a-z0-9-]*$`, MaxLength: 8},
+		"mode":    {Type: TypeString, Values: []string{`"fast"`, `"safe"`}},
+		"ratio":   {Type: TypeFloat},
+		"expires": {Type: TypeDateTime, After: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		"server": {Type: TypeTable, Fields: map[string]*Schema{
+			"port":  {Type: TypeInteger, Min: &minPort, Max: &maxPort},
+			"hosts": {Type: TypeArray, MinItems: 1, Items: &Schema{Type: TypeString, MinLength: 1}},
+		}},
+		"plugin": {Type: TypeArrayOfTables, MaxItems: 1, Fields: map[string]*Schema{
+			"id": {Type: TypeInteger},
+		}},
+	}}
+	d := mustParse(t, `name = "My_App_Name"
+mode = 'safe'
+ratio = 1
+expires = 2019-06-01
+
+[server]
+port = 70000
+hosts = ["a", ""]
+
+[[plugin]]
+id = "x"
+[[plugin]]
+id = 2
+`)
+	err := schema.Check(d)
+	var msgs []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		msgs = append(msgs, e.Error())
+	}
+	got := strings.Join(msgs, "\n")
+	want := `1:8: name: 11 characters, more than the maximum 8
+1:8: name: "My_App_Name" does not match ^[a-z][a-z0-9-]*$
+4:11: expires: 2019-06-01 is not after 2020-01-01T00:00:00Z
+7:8: server.port: 70000 is greater than the maximum 65535
+8:15: server.hosts[1]: 0 characters, fewer than the minimum 1
+10:1: plugin: 2 items, more than the maximum 1
+11:6: plugin[0].id: expected integer, got string`
+	if got != want {
+		t.Errorf("Check:\n%s\nwant\n%s", got, want)
+	}
+	if !errors.Is(err, ErrTypeMismatch) || !errors.Is(err, ErrConstraint) {
+		t.Errorf("Check error does not wrap the sentinels: %v", err)
+	}
+
+	d = mustParse(t, "mode = \"slow\"\nserver = { port = 0, hosts = [] }\n")
+	err = d.CheckConstraints(schema.Check)
+	for _, want := range []string{
+		"1:8: mode: \"slow\" is not one of the allowed values",
+		"2:19: server.port: 0 is less than the minimum 1",
+		"2:30: server.hosts: 0 items, fewer than the minimum 1",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("CheckConstraints(schema.Check) = %v, want %q", err, want)
+		}
+	}
+	if err := schema.Check(mustParse(t, "name = \"ok\"\n[server]\nport = 80\nhosts = [\"h\"]\n")); err != nil {
+		t.Errorf("Check(valid) = %v", err)
+	}
+	bounded := &Schema{Type: TypeTable, Fields: map[string]*Schema{"ratio": {Type: TypeFloat, Max: &maxPort}}}
+	if err := bounded.Check(mustParse(t, "ratio = -nan\n")); err == nil || err.Error() != "1:9: ratio: -nan cannot be compared with the bounds" {
+		t.Errorf("Check(nan) = %v", err)
+	}
+}
+
+func TestSchema_Variants(t *testing.T) {
+	schema := &Schema{Type: TypeTable, Fields: map[string]*Schema{
+		"storage": {Type: TypeArrayOfTables, Discriminator: "type", Fields: map[string]*Schema{
+			"name": {Type: TypeString},
+		}, Variants: map[string]*Schema{
+			"s3":  {Fields: map[string]*Schema{"bucket": {Type: TypeString}, "region": {Type: TypeString}}},
+			"gcs": {Fields: map[string]*Schema{"bucket": {Type: TypeString}, "project": {Type: TypeString}}},
+		}},
+	}}
+	input := `[[storage]]
+type = "s3"
+name = "a"
+bucket = "b"
+project = "p"
+
+[[storage]]
+type = "azure"
+
+[[storage]]
+name = "c"
+bucket = 1
+
+[[storage]]
+type = "s3"
+r = ""
+`
+	d := mustParse(t, input)
+	err := schema.Check(d)
+	var msgs []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		msgs = append(msgs, e.Error())
+	}
+	got := strings.Join(msgs, "\n")
+	want := `8:8: storage[1].type: "azure" is not one of gcs, s3
+10:1: storage[2].type: missing discriminator`
+	if got != want {
+		t.Errorf("Check:\n%s\nwant\n%s", got, want)
+	}
+	var unused []string
+	for _, ref := range UnusedKeys(d, schema) {
+		unused = append(unused, ref.Path)
+	}
+	if want := []string{"storage.project", "storage.bucket", "storage.r"}; !slices.Equal(unused, want) {
+		t.Errorf("UnusedKeys = %v, want %v", unused, want)
+	}
+	if got := completionLabels(CompletionsAt(d, schema, strings.LastIndex(input, "r =")+1)); got != "region" {
+		t.Errorf("variant key completions = %q, want region", got)
+	}
+	if got := completionLabels(CompletionsAt(d, schema, strings.Index(input, `"azure"`))); got != `"gcs" "s3"` {
+		t.Errorf("discriminator value completions = %q", got)
+	}
+}
+
+// --- RenderValue tests ---
+
+func TestRenderValue(t *testing.T) {
+	d := mustParse(t, `s = "line one\nline two"
+long = "abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz"
+n = 1_000
+big = [1, 2, 3, 4, 5, 6, 7]
+nested = [[1, 2], { a = "x", b.c = true }]
+when = 2024-03-01T12:00:00Z
+day = 2024-03-01
+
+[server]
+host = "h"
+port = 80
+`)
+	tests := []struct{ path, want string }{
+		{"s", `"line one\nline two"`},
+		{"long", `"abcdefghijklmnopqrstuvwxyzabcdefghijklmn…"`},
+		{"n", "1_000"},
+		{"big", "[1, 2, 3, 4, 5, … (7 items)]"},
+		{"nested", `[[1, 2], {a = "x", b.c = true}]`},
+		{"when", "2024-03-01T12:00:00Z"},
+	}
+	for _, tt := range tests {
+		if got := RenderValue(d.Get(tt.path)); got != tt.want {
+			t.Errorf("RenderValue(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+	if got := RenderValue(d.Table("server")); got != "2 keys" {
+		t.Errorf("RenderValue(table) = %q", got)
+	}
+	opts := RenderOptions{MaxStringLength: 3, MaxItems: 2, Location: time.FixedZone("CET", 3600)}
+	for path, want := range map[string]string{
+		"long": `"abc…"`,
+		"big":  "[1, 2, … (7 items)]",
+		"when": "2024-03-01 13:00:00 CET",
+		"day":  "2024-03-01",
+	} {
+		if got := RenderValueWithOptions(d.Get(path), opts); got != want {
+			t.Errorf("RenderValueWithOptions(%s) = %s, want %s", path, got, want)
+		}
+	}
+	if got := RenderValueWithOptions(d.Get("big"), RenderOptions{MaxItems: -1}); got != "[1, 2, 3, 4, 5, 6, 7]" {
+		t.Errorf("RenderValueWithOptions(no limit) = %s", got)
+	}
+	if got := RenderValue(nil); got != "" {
+		t.Errorf("RenderValue(nil) = %q", got)
+	}
+}
+
+// --- NodeAt tests ---
+
+func TestDocument_NodeAt(t *testing.T) {
+	src := "# top\na = 1\n\n[server] # hdr\n# doc\nports = [80, { x = \"y\" }]\n"
+	doc := mustParse(t, src)
+	describe := func(n Node, ancestors []Node) string {
+		var b strings.Builder
+		b.WriteString(n.Text())
+		for _, a := range ancestors {
+			switch v := a.(type) {
+			case *KeyValue:
+				b.WriteString(" < " + v.RawKey())
+			case *TableNode:
+				b.WriteString(" < [" + v.RawHeader() + "]")
+			case *Document:
+				b.WriteString(" < doc")
+			default:
+				fmt.Fprintf(&b, " < %T", a)
+			}
+		}
+		return b.String()
+	}
+	tests := []struct {
+		at   string // the text at the offset
+		want string
+	}{
+		{"top", "# top < a < doc"},
+		{"1", "1 < a < doc"},
+		{"a =", "a = 1 < doc"},
+		{"server", "[server] < doc"},
+		{"hdr", "# hdr < [server] < doc"},
+		{"# doc", "# doc < ports < [server] < doc"},
+		{"80", "80 < *toml.ArrayNode < ports < [server] < doc"},
+		{`"y"`, `"y" < x < *toml.InlineTableNode < *toml.ArrayNode < ports < [server] < doc`},
+	}
+	for _, tt := range tests {
+		off := strings.Index(src, tt.at)
+		if got := describe(doc.NodeAt(off)); got != tt.want {
+			t.Errorf("NodeAt(%d) at %q = %q, want %q", off, tt.at, got, tt.want)
+		}
+	}
+
+	for _, off := range []int{strings.Index(src, "\n\n"), len(src)} {
+		if n, ancestors := doc.NodeAt(off); n != Node(doc) || ancestors != nil {
+			t.Errorf("NodeAt(%d) = %T %v, want the document", off, n, ancestors)
+		}
+	}
+	if n, ancestors := doc.NodeAt(strings.Index(src, "\n# doc")); n != doc.Tables()[0] || len(ancestors) != 1 {
+		t.Errorf("NodeAt(newline in table) = %q, want the table", describe(n, ancestors))
+	}
+	if got := describe(doc.NodeAtPosition(6, 10)); got != "80 < *toml.ArrayNode < ports < [server] < doc" {
+		t.Errorf("NodeAtPosition(6, 10) = %q", got)
+	}
+}
+
+func TestDocument_NodeAt_AfterTriviaChange(t *testing.T) {
+	comment := func() []Node { c, _ := NewComment("# added"); nl, _ := NewWhitespace("\n"); return []Node{c, nl} }
+	tests := []struct {
+		name   string
+		mutate func(*Document)
+	}{
+		{"prologue", func(d *Document) { _ = d.SetPrologue(comment()) }},
+		{"epilogue", func(d *Document) { _ = d.SetEpilogue(comment()) }},
+		{"checksum", func(d *Document) { SetChecksum(d) }},
+		{"header", func(d *Document) { _ = d.EnsureHeader([]string{"generated"}) }},
+		{"document trivia", func(d *Document) { _ = d.InsertAt(0, comment()[0]) }},
+		{"key-value trivia", func(d *Document) { _ = d.Nodes()[0].(*KeyValue).SetLeadingTrivia(comment()) }},
+		{"table trivia", func(d *Document) { _ = d.Tables()[0].SetLeadingTrivia(comment()) }},
+		{"table comment", func(d *Document) { _ = d.Tables()[0].AppendComment("added") }},
+		{"table delete", func(d *Document) { d.Tables()[0].Delete("b") }},
+	}
+	for _, tt := range tests {
+		doc := mustParse(t, "a = 1\n[t]\nb = 2\nc = 3\n")
+		doc.NodeAt(0)
+		tt.mutate(doc)
+		src := doc.String()
+		off := strings.Index(src, "c = 3")
+		if n, _ := doc.NodeAt(off); n.Text() != "c = 3" {
+			t.Errorf("%s: NodeAt(%d) = %q, want c = 3", tt.name, off, n.Text())
+		}
+		line := strings.Count(src[:off], "\n") + 1
+		if n, _ := doc.NodeAtPosition(line, 1); n.Text() != "c = 3" {
+			t.Errorf("%s: NodeAtPosition(%d, 1) = %q, want c = 3", tt.name, line, n.Text())
+		}
+	}
+}
+
+// --- SelectionRanges tests ---
+
+func TestSelectionRanges(t *testing.T) {
+	src := "title = \"x\"\n\n[server]\n# the port\nport = 8080\n\ntags = [\"a\", { b = \"c\" }]\n"
+	doc := mustParse(t, src)
+	texts := func(at string) []string {
+		var out []string
+		for _, sp := range SelectionRanges(doc, strings.Index(src, at)) {
+			out = append(out, src[sp.Start:sp.End])
+		}
+		return out
+	}
+	table := "[server]\n# the port\nport = 8080\n\ntags = [\"a\", { b = \"c\" }]"
+	body := "# the port\nport = 8080\n\ntags = [\"a\", { b = \"c\" }]"
+	all := strings.TrimSpace(src)
+	tests := []struct {
+		at   string
+		want []string
+	}{
+		{`"c"`, []string{`"c"`, `b = "c"`, `{ b = "c" }`, `["a", { b = "c" }]`, `tags = ["a", { b = "c" }]`, body, table, all}},
+		{"port =", []string{"port", "port = 8080", "# the port\nport = 8080", body, table, all}},
+		{"8080", []string{"8080", "port = 8080", "# the port\nport = 8080", body, table, all}},
+		{"server", []string{"[server]", table, all}},
+		{"\ntags", []string{body, table, all}},
+		{"title", []string{"title", `title = "x"`, all}},
+	}
+	for _, tt := range tests {
+		if got := texts(tt.at); !slices.Equal(got, tt.want) {
+			t.Errorf("SelectionRanges at %q =\n%q\nwant\n%q", tt.at, got, tt.want)
+		}
+	}
+}
+
+// --- SuggestFixes tests ---
+
+func TestSuggestFixes(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // the source after the fix, or "" for no fix
+	}{
+		{"my key = 1\n", "\"my key\" = 1\n"},
+		{"[s]\n  café  = 1\n", "[s]\n  \"café\"  = 1\n"},
+		{"a = \"tab\x01here\x7f\"\n", "a = \"tab\\u0001here\\u007F\"\n"},
+		{"a = 'x\x02\"'\n", "a = \"x\\u0002\\\"\"\n"},
+		{"a = \"c:\\\\dir\\q\"\n", "a = \"c:\\\\dir\\\\q\"\n"},
+		{"[server  \nport = 1\n", "[server]  \nport = 1\n"},
+		{"[[srv\nport = 1\n", "[[srv]]\nport = 1\n"},
+		{"[[a]\nk = 1\n", "[[a]]\nk = 1\n"},
+		{"[[a] \nk = 1\n", "[[a]] \nk = 1\n"},
+		{"a = [1, 2\nb = 1\n", "a = [1, 2]\nb = 1\n"},
+		{"a = [\n  1,\n  2\n\nb = 1\n", "a = [\n  1,\n  2]\n\nb = 1\n"},
+		{"a = { x = 1\nb = 1\n", "a = { x = 1}\nb = 1\n"},
+		{"[a]\nx = 1\n[b]\ny = 2\n\n[a]\nz = 3\n# end\n", "[a]\nx = 1\nz = 3\n# end\n[b]\ny = 2\n\n"},
+		{"[a]\nx = 1\n\n[a]\nz = 3\n", "[a]\nx = 1\n\nz = 3\n"},
+
+		// Unclear intent.
+		{"a.b c = 1\n", ""},
+		{"a = [\n  1\n  2\n]\n", ""},
+		{"a = [1, 2 # two\nb = 1\n", ""},
+		{"[a b]\n", ""},
+		{"[a]\nx = 1\n[a]\nx = 3\n", ""},
+		{"[a]\nx = 1\n[a]\nx.y = 3\n", ""},
+		{"[a]\nx.y = 1\n[a]\nx = 3\n", ""},
+		{"[a]\n[a.b]\nq=1\n[a]\nb = 3\n", ""},
+		{"a = '''x\x01'''\n", ""},
+		{"a = 1\na = 2\n", ""},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.src))
+		if err == nil {
+			t.Fatalf("Parse(%q) succeeded", tt.src)
+		}
+		edits := SuggestFixes(err)
+		if tt.want == "" {
+			if edits != nil {
+				t.Errorf("SuggestFixes(%q) = %v, want none", tt.src, edits)
+			}
+			continue
+		}
+		got := applyEdits(tt.src, edits)
+		if got != tt.want {
+			t.Errorf("SuggestFixes(%q) = %v, giving\n%q\nwant\n%q", tt.src, edits, got, tt.want)
+		}
+		if _, err := Parse([]byte(got)); err != nil {
+			t.Errorf("fixed %q does not parse: %v", got, err)
+		}
+	}
+	if edits := SuggestFixes(errors.New("other")); edits != nil {
+		t.Errorf("SuggestFixes(other error) = %v", edits)
+	}
+}
+
+// --- GenerateDocs tests ---
+
+func TestGenerateDocs(t *testing.T) {
+	src := `# Application name.
+name = "app"
+
+# HTTP server.
+[server]
+# Listen port.
+port = 8080 # TCP
+hosts = [
+  "a|b",
+]
+
+[[plugin]]
+id = 1
+[[plugin]]
+id = 2
+# Optional.
+path = "/x"
+`
+	d, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Config\n\n" +
+		"## Top-level keys\n\n" +
+		"| Key | Type | Default | Description |\n| --- | --- | --- | --- |\n" +
+		"| `name` | string | `\"app\"` | Application name. |\n\n" +
+		"## `[server]`\n\nHTTP server.\n\n" +
+		"| Key | Type | Default | Description |\n| --- | --- | --- | --- |\n" +
+		"| `port` | integer | `8080` | Listen port. TCP |\n" +
+		"| `hosts` | array | `[ …` |  |\n\n" +
+		"## `[[plugin]]`\n\n" +
+		"| Key | Type | Default | Description |\n| --- | --- | --- | --- |\n" +
+		"| `id` | integer | `1` |  |\n" +
+		"| `path` | string | `\"/x\"` | Optional. |\n"
+	if got := string(GenerateDocs(d, DocsOptions{Title: "Config"})); got != want {
+		t.Errorf("GenerateDocs() =\n%s\nwant\n%s", got, want)
+	}
+	if got := mdCode("a`b|c"); got != "``a`b\\|c``" {
+		t.Errorf("mdCode() = %q", got)
+	}
+}
+
+func TestGenerateExample(t *testing.T) {
+	schema := &Schema{Type: TypeTable, Fields: map[string]*Schema{
+		"name":  {Type: TypeString, Description: "Application name."},
+		"debug": {Type: TypeBoolean, Default: "true"},
+		"level": {Type: TypeString, Default: "nope", Values: []string{`"info"`, `"warn"`}},
+		"server": {Type: TypeTable, Description: "HTTP server.", Fields: map[string]*Schema{
+			"port": {Type: TypeInteger, Default: "8080"},
+			"tls":  {Type: TypeTable, Fields: map[string]*Schema{"cert": {Type: TypeString}}},
+		}},
+		"plugin":  {Type: TypeArrayOfTables, Fields: map[string]*Schema{"id": {Type: TypeInteger}}},
+		"my key":  {Type: TypeDateTime},
+		"options": {Type: TypeTable},
+	}}
+	want := `debug = true
+# One of: "info", "warn"
+level = ""
+"my key" = 1979-05-27T07:32:00Z
+# Application name.
+name = ""
+options = {}
+
+# HTTP server.
+[server]
+port = 8080
+
+[server.tls]
+cert = ""
+
+[[plugin]]
+id = 0
+`
+	d := GenerateExample(schema)
+	if got := d.String(); got != want {
+		t.Errorf("GenerateExample() =\n%s\nwant\n%s", got, want)
+	}
+	if got := GenerateExample(nil).String(); got != "" {
+		t.Errorf("GenerateExample(nil) = %q", got)
+	}
+}
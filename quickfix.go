@@ -0,0 +1,236 @@
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errorFixes maps message prefixes to a function that repairs the error,
+// or returns nil if it cannot tell how. The first matching prefix wins.
+var errorFixes = []struct {
+	prefix string
+	fix    func(pe *ParseError) []TextEdit
+}{
+	{"expected '=', found", quoteKeyFix},
+	{"invalid character", quoteKeyFix},
+	{"control character", escapeControlFix},
+	{"invalid escape sequence '", escapeBackslashFix},
+	{"expected ']' to close table header", closeHeaderFix("]")},
+	{"expected ']]' to close array of tables header", closeHeaderFix("]]")},
+	{"expected ',' or ']' in array", closeValueFix("]")},
+	{"expected ',' or '}' in inline table", closeValueFix("}")},
+	{"duplicate table", mergeTableFix},
+}
+
+// SuggestFixes returns the edits that repair err, a *ParseError from
+// Parse or Validate, for an editor's one-click quick fixes. The edits are
+// measured in the error's Source and are applied together. It returns nil
+// for other errors and for errors it cannot repair with confidence. It
+// repairs:
+//
+//   - a bare key containing spaces or other characters, by quoting it
+//   - a control character in a string, by escaping it
+//   - an invalid escape sequence, by escaping its backslash
+//   - a table or array-of-tables header without its closing brackets
+//   - an array or inline table left open before the next key-value
+//   - a duplicate [table], by moving its key-values into the first one
+func SuggestFixes(err error) []TextEdit {
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		return nil
+	}
+	for _, f := range errorFixes {
+		if strings.HasPrefix(pe.Message, f.prefix) {
+			return f.fix(pe)
+		}
+	}
+	return nil
+}
+
+// lineAround returns the offsets of the start and end of the line holding
+// offset in src, excluding the newline.
+func lineAround(src string, offset int) (start, end int) {
+	start = strings.LastIndexByte(src[:offset], '\n') + 1
+	end = len(src)
+	if i := strings.IndexByte(src[offset:], '\n'); i >= 0 {
+		end = offset + i
+	}
+	if end > start && src[end-1] == '\r' {
+		end--
+	}
+	return start, end
+}
+
+// quoteKeyFix quotes the key of a key-value line when the error is inside
+// it, as in my key = 1 or café = 1. Keys with dots or quotes are left
+// alone, as the intent is unclear.
+func quoteKeyFix(pe *ParseError) []TextEdit {
+	src := pe.Source
+	start, end := lineAround(src, pe.Span.Start)
+	line := src[start:end]
+	eq := strings.IndexByte(line, '=')
+	if eq < 0 {
+		return nil
+	}
+	keyStart := start + len(line) - len(strings.TrimLeft(line, " \t"))
+	keyEnd := start + len(strings.TrimRight(line[:eq], " \t"))
+	key := src[keyStart:max(keyStart, keyEnd)]
+	if key == "" || strings.ContainsAny(key, ".\"'#[]") || pe.Span.Start < keyStart || pe.Span.Start >= keyEnd {
+		return nil
+	}
+	return []TextEdit{{Span: Span{keyStart, keyEnd}, NewText: QuoteKey(key)}}
+}
+
+// escapeControlFix escapes the control characters of a basic string, and
+// rewrites a single-line literal string holding them as a basic string.
+func escapeControlFix(pe *ParseError) []TextEdit {
+	tok, base := pe.Token, pe.Span.Start
+	switch {
+	case strings.HasPrefix(tok, "'''") || len(tok) < 2:
+		return nil
+	case tok[0] == '\'':
+		return []TextEdit{{Span: pe.Span, NewText: NewString(tok[1 : len(tok)-1]).Text()}}
+	case tok[0] != '"':
+		return nil
+	}
+	multiline := strings.HasPrefix(tok, `"""`)
+	var edits []TextEdit
+	for i, r := range tok {
+		allowed := r == '\t' || multiline && (r == '\n' || r == '\r' && strings.HasPrefix(tok[i:], "\r\n"))
+		if (r < 0x20 || r == 0x7F) && !allowed {
+			edits = append(edits, TextEdit{Span: Span{base + i, base + i + 1}, NewText: fmt.Sprintf(`\u%04X`, r)})
+		}
+	}
+	return edits
+}
+
+// escapeBackslashFix turns the invalid escape sequence named in the
+// message, such as \q, into an escaped backslash followed by the
+// character.
+func escapeBackslashFix(pe *ParseError) []TextEdit {
+	seq := strings.TrimSuffix(strings.TrimPrefix(pe.Message, "invalid escape sequence '"), "'")
+	tok := pe.Token
+	for i := 1; i < len(tok)-1; i++ {
+		if tok[i] != '\\' {
+			continue
+		}
+		if strings.HasPrefix(tok[i:], seq) {
+			at := pe.Span.Start + i
+			return []TextEdit{{Span: Span{at, at}, NewText: `\`}}
+		}
+		i++ // skip the escaped character
+	}
+	return nil
+}
+
+// closeHeaderFix returns a fix that adds the missing closing brackets of a
+// header at the end of its line. Brackets already there, as in "[[a]", are
+// not added again.
+func closeHeaderFix(brackets string) func(pe *ParseError) []TextEdit {
+	return func(pe *ParseError) []TextEdit {
+		if strings.TrimSpace(pe.Token) != "" {
+			return nil
+		}
+		before := strings.TrimRight(pe.Source[:pe.Span.Start], " \t")
+		have := len(before) - len(strings.TrimRight(before, "]"))
+		if have >= len(brackets) {
+			return nil
+		}
+		at := len(before)
+		return []TextEdit{{Span: Span{at, at}, NewText: brackets[have:]}}
+	}
+}
+
+// closeValueFix returns a fix that closes an array or inline table left
+// open, when the error is at a key-value on a later line: the bracket goes
+// at the end of the last line of the value. If that line has a comment,
+// or the line of the key-value has the bracket, the fix is unclear.
+func closeValueFix(bracket string) func(pe *ParseError) []TextEdit {
+	return func(pe *ParseError) []TextEdit {
+		src := pe.Source
+		start, end := lineAround(src, pe.Span.Start)
+		line := src[start:end]
+		if strings.TrimLeft(src[start:pe.Span.Start], " \t") != "" || KeyNeedsQuoting(pe.Token) ||
+			!strings.Contains(line, "=") || strings.Contains(line, bracket) {
+			return nil
+		}
+		prev := strings.TrimRight(src[:start], " \t\r\n")
+		if strings.Contains(prev[strings.LastIndexByte(prev, '\n')+1:], "#") {
+			return nil
+		}
+		return []TextEdit{{Span: Span{len(prev), len(prev)}, NewText: bracket}}
+	}
+}
+
+// mergeTableFix moves the key-values of a duplicate [table] section to
+// the end of the first section with that header, and removes the
+// duplicate header, unless the merged source does not parse, as when the
+// sections set the same key or one defines a table the other sets.
+func mergeTableFix(pe *ParseError) []TextEdit {
+	edits := mergeTableEdits(pe)
+	if edits == nil {
+		return nil
+	}
+	if _, err := Parse([]byte(applyEdits(pe.Source, edits))); err != nil {
+		return nil
+	}
+	return edits
+}
+
+// mergeTableEdits returns the edits for mergeTableFix, or nil if there is
+// no first section to merge into.
+func mergeTableEdits(pe *ParseError) []TextEdit {
+	src := pe.Source
+	start, _ := lineAround(src, pe.Span.Start)
+	if strings.TrimLeft(src[start:pe.Span.Start], " \t") != "" {
+		return nil
+	}
+	before, err := Parse([]byte(src[:start]))
+	if err != nil {
+		return nil
+	}
+	rest, err := Parse([]byte(src[start:]))
+	if err != nil || len(rest.nodes) == 0 {
+		return nil
+	}
+	dup, ok := rest.nodes[0].(*TableNode)
+	if !ok {
+		return nil
+	}
+	first := before.table(partsToSegs(dup.headerParts))
+	if first == nil {
+		return nil
+	}
+	restSpans := rest.Spans()
+	headerEnd := start + lineEnd(src[start:], restSpans[dup].End)
+	sectionEnd := start + lineEnd(src[start:], extent(dup, restSpans).End)
+	at := lineEnd(src[:start], extent(first, before.Spans()).End)
+	if headerEnd == sectionEnd || strings.TrimSpace(src[at:start]) == "" {
+		return []TextEdit{{Span: Span{start, headerEnd}}}
+	}
+	return []TextEdit{
+		{Span: Span{at, at}, NewText: src[headerEnd:sectionEnd]},
+		{Span: Span{start, sectionEnd}},
+	}
+}
+
+// applyEdits returns src with edits, which are in order and do not
+// overlap, applied.
+func applyEdits(src string, edits []TextEdit) string {
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		src = src[:e.Span.Start] + e.NewText + src[e.Span.End:]
+	}
+	return src
+}
+
+// lineEnd returns the offset just past the newline that ends the line
+// holding offset in src, or len(src).
+func lineEnd(src string, offset int) int {
+	i := strings.IndexByte(src[offset:], '\n')
+	if i < 0 {
+		return len(src)
+	}
+	return offset + i + 1
+}
@@ -0,0 +1,276 @@
+package toml
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RenameKey renames the key at path, a dotted path as in Get, to newName,
+// a single key segment that is quoted if it needs to be. Every spelling of
+// the key changes: headers of the table or array of tables and of the
+// tables under it, dotted keys that pass through it, and keys inside
+// inline tables, keeping their spacing and comments. Keys inside arrays
+// are not renamed. It returns an error wrapping ErrKeyNotFound if no key
+// has the path, and if newName is already taken it returns the validation
+// error and leaves the document unchanged.
+func (d *Document) RenameKey(path, newName string) error {
+	segs := parseDottedPath(path)
+	if len(segs) == 0 {
+		return fmt.Errorf("%w: empty path", ErrKeyNotFound)
+	}
+	var r renamer
+	if !r.apply(d, segs, newName) {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, path)
+	}
+	if err := d.validateMutation(); err != nil {
+		r.revert()
+		return err
+	}
+	return nil
+}
+
+// RenameOptions configures Document.RenameAtWithOptions.
+type RenameOptions struct {
+	// References also renames the key in string values that hold its
+	// path, or a path under it, as in ref-style configurations such as
+	// backend = "servers.primary". Paths are matched as JoinPath writes
+	// them; multi-line strings are left alone.
+	References bool
+}
+
+// RenameAt renames the key at the byte offset in the text produced by
+// String, as RenameKey does for its path, for an editor's rename command.
+// The offset may be on or just after one segment of a key, a dotted key,
+// or a table or array-of-tables header; the key renamed is the path up to
+// that segment. It returns the edits that turn the text before the rename
+// into the text after it, in order, for the editor to apply. It returns an
+// error wrapping ErrKeyNotFound if there is no key at offset or the key is
+// inside an array, and the validation error if newName is already taken;
+// the document is then unchanged.
+func (d *Document) RenameAt(offset int, newName string) ([]TextEdit, error) {
+	return d.RenameAtWithOptions(offset, newName, RenameOptions{})
+}
+
+// RenameAtWithOptions is RenameAt with control over renaming references.
+func (d *Document) RenameAtWithOptions(offset int, newName string, opts RenameOptions) ([]TextEdit, error) {
+	spans := d.Spans()
+	segs, ok := d.keyPathAt(spans, offset)
+	if !ok {
+		return nil, fmt.Errorf("%w: no key at offset %d", ErrKeyNotFound, offset)
+	}
+	keys := keyLocations(d, spans)
+	oldPath := JoinPath(segs...)
+	var refs []*StringNode
+	if opts.References {
+		refs = references(d, oldPath)
+	}
+	if err := d.RenameKey(oldPath, newName); err != nil {
+		return nil, err
+	}
+	var edits []TextEdit
+	for _, k := range keys {
+		edits = k.edits(edits)
+	}
+	newPath := JoinPath(append(slices.Clone(segs[:len(segs)-1]), newName)...)
+	for _, s := range refs {
+		sp := spans[s]
+		s.text = requote(s.text, newPath+strings.TrimPrefix(s.Value(), oldPath))
+		regenerateAncestorText(s)
+		edits = append(edits, TextEdit{Span: sp, NewText: s.text})
+	}
+	slices.SortFunc(edits, func(a, b TextEdit) int { return a.Span.Start - b.Span.Start })
+	return edits, nil
+}
+
+// keyPathAt returns the path of the key segment at offset, or false if
+// offset is not on a key that RenameKey renames.
+func (d *Document) keyPathAt(spans map[Node]Span, offset int) ([]string, bool) {
+	n, ancestors := d.nodeAt(spans, offset)
+	if slices.ContainsFunc(ancestors, func(a Node) bool { _, ok := a.(*ArrayNode); return ok }) {
+		return nil, false
+	}
+	var k keyLocation
+	var prefix []string
+	switch v := n.(type) {
+	case *KeyValue:
+		k, prefix = newKeyLocation(&v.keyParts, v.rawKey, spans[v].Start), containerPath(v.parent)
+	case *TableNode:
+		k = newKeyLocation(&v.headerParts, v.rawHeader, spans[v].Start+1)
+	case *ArrayOfTables:
+		k = newKeyLocation(&v.headerParts, v.rawHeader, spans[v].Start+2)
+	default:
+		return nil, false
+	}
+	for i, p := range k.old {
+		if offset >= k.offs[i] && offset <= k.offs[i]+len(p.Text) {
+			return slices.Concat(prefix, partsToSegs(k.old[:i+1])), true
+		}
+	}
+	return nil, false
+}
+
+// keyLocation records where the parts of a key or header were in the
+// text, to find the parts that a rename changed.
+type keyLocation struct {
+	parts *[]KeyPart // the node's parts, read again after the rename
+	old   []KeyPart
+	offs  []int // offset of each old part
+}
+
+// newKeyLocation locates parts, spelled as raw starting at offset start.
+func newKeyLocation(parts *[]KeyPart, raw string, start int) keyLocation {
+	k := keyLocation{parts: parts, old: *parts, offs: make([]int, len(*parts))}
+	from := 0
+	for i, p := range k.old {
+		from += max(0, strings.Index(raw[from:], p.Text))
+		k.offs[i] = start + from
+		from += len(p.Text)
+	}
+	return k
+}
+
+// keyLocations locates the keys and headers of d.
+func keyLocations(d *Document, spans map[Node]Span) []keyLocation {
+	var out []keyLocation
+	d.Walk(func(n Node) bool {
+		switch v := n.(type) {
+		case *KeyValue:
+			out = append(out, newKeyLocation(&v.keyParts, v.rawKey, spans[v].Start))
+		case *TableNode:
+			out = append(out, newKeyLocation(&v.headerParts, v.rawHeader, spans[v].Start+1))
+		case *ArrayOfTables:
+			out = append(out, newKeyLocation(&v.headerParts, v.rawHeader, spans[v].Start+2))
+		}
+		return true
+	})
+	return out
+}
+
+// edits appends to out an edit for each part that has changed.
+func (k keyLocation) edits(out []TextEdit) []TextEdit {
+	for i, p := range *k.parts {
+		if i < len(k.old) && p.Text != k.old[i].Text {
+			sp := Span{k.offs[i], k.offs[i] + len(k.old[i].Text)}
+			out = append(out, TextEdit{Span: sp, NewText: p.Text})
+		}
+	}
+	return out
+}
+
+// references returns the single-line strings in d that hold path or a
+// path under it.
+func references(d *Document, path string) []*StringNode {
+	var out []*StringNode
+	d.Walk(func(n Node) bool {
+		s, ok := n.(*StringNode)
+		if !ok || strings.HasPrefix(s.text, `"""`) || strings.HasPrefix(s.text, "'''") {
+			return true
+		}
+		v := s.Value()
+		if rest, ok := strings.CutPrefix(v, path); ok && (rest == "" || rest[0] == '.' || rest[0] == '[') {
+			out = append(out, s)
+		}
+		return true
+	})
+	return out
+}
+
+// requote returns value quoted like text, a single-line string: as a
+// literal string if text is one and value can be, or else a basic string.
+func requote(text, value string) string {
+	if text[0] == '\'' && !strings.ContainsFunc(value, func(r rune) bool {
+		return r == '\'' || r < 0x20 && r != '\t' || r == 0x7F
+	}) {
+		return "'" + value + "'"
+	}
+	return NewString(value).Text()
+}
+
+// renamer renames keys, recording how to undo each change.
+type renamer struct {
+	segs []string // key being renamed
+	name string   // its new name
+	undo []func()
+}
+
+// apply renames the key at segs to name throughout d and reports whether
+// it was found.
+func (r *renamer) apply(d *Document, segs []string, name string) bool {
+	r.segs, r.name = segs, name
+	n := len(r.undo)
+	r.document(d)
+	return len(r.undo) > n
+}
+
+func (r *renamer) document(d *Document) {
+	for _, n := range d.nodes {
+		switch v := n.(type) {
+		case *KeyValue:
+			r.keyValue(nil, v)
+		case *TableNode:
+			if parts, ok := r.rename(nil, v.headerParts); ok {
+				oldParts, oldRaw := v.headerParts, v.rawHeader
+				r.undo = append(r.undo, func() { v.headerParts, v.rawHeader = oldParts, oldRaw })
+				v.setHeader(rebaseParts(parts, 0, nil))
+			}
+			r.entries(partsToSegs(v.headerParts), v.entries)
+		case *ArrayOfTables:
+			if parts, ok := r.rename(nil, v.headerParts); ok {
+				oldParts, oldRaw := v.headerParts, v.rawHeader
+				r.undo = append(r.undo, func() { v.headerParts, v.rawHeader = oldParts, oldRaw })
+				v.setHeader(rebaseParts(parts, 0, nil))
+			}
+			r.entries(partsToSegs(v.headerParts), v.entries)
+		}
+	}
+}
+
+func (r *renamer) entries(prefix []string, entries []Node) {
+	for _, n := range entries {
+		if kv, ok := n.(*KeyValue); ok {
+			r.keyValue(prefix, kv)
+		}
+	}
+}
+
+// keyValue renames the key of kv, in the table at prefix, and the keys of
+// its value if it is an inline table.
+func (r *renamer) keyValue(prefix []string, kv *KeyValue) {
+	if parts, ok := r.rename(prefix, kv.keyParts); ok {
+		oldParts, oldRaw := kv.keyParts, kv.rawKey
+		r.undo = append(r.undo, func() {
+			kv.keyParts, kv.rawKey = oldParts, oldRaw
+			regenerateAncestorText(kv)
+		})
+		kv.keyParts, kv.rawKey = rebaseParts(parts, 0, nil)
+		regenerateAncestorText(kv)
+	}
+	if it, ok := kv.val.(*InlineTableNode); ok {
+		inner := slices.Concat(prefix, partsToSegs(kv.keyParts))
+		for _, e := range it.entries {
+			r.keyValue(inner, e)
+		}
+	}
+}
+
+// rename returns a copy of parts, a key in the table at prefix, with the
+// part at the renamed path changed to the new name, and whether the key
+// passes through that path.
+func (r *renamer) rename(prefix []string, parts []KeyPart) ([]KeyPart, bool) {
+	i := len(r.segs) - 1 - len(prefix)
+	if i < 0 || i >= len(parts) || !slices.Equal(prefix, r.segs[:len(prefix)]) ||
+		!matchKeyParts(parts[:i+1], r.segs[len(prefix):]) {
+		return nil, false
+	}
+	out := slices.Clone(parts)
+	out[i].Text, out[i].Unquoted, out[i].IsQuoted = QuoteKey(r.name), r.name, KeyNeedsQuoting(r.name)
+	return out, true
+}
+
+// revert undoes the changes in reverse order.
+func (r *renamer) revert() {
+	for i := len(r.undo) - 1; i >= 0; i-- {
+		r.undo[i]()
+	}
+}
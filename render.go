@@ -0,0 +1,159 @@
+package toml
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RenderOptions controls how RenderValueWithOptions displays a value.
+type RenderOptions struct {
+	// MaxStringLength is the number of characters of a string shown before
+	// it is cut off with "…". Zero means 40; negative means no limit.
+	MaxStringLength int
+
+	// MaxItems is the number of elements of an array, or keys of an
+	// inline table, shown before the rest are left out and the total is
+	// given instead. Zero means 5; negative means no limit.
+	MaxItems int
+
+	// Location, if non-nil, shows offset datetimes converted to it and
+	// formatted with TimeLayout. Local datetimes, dates, and times are
+	// shown as written.
+	Location *time.Location
+
+	// TimeLayout is the time.Format layout of converted datetimes. Empty
+	// means "2006-01-02 15:04:05 MST".
+	TimeLayout string
+}
+
+func (o *RenderOptions) setDefaults() {
+	if o.MaxStringLength == 0 {
+		o.MaxStringLength = 40
+	}
+	if o.MaxItems == 0 {
+		o.MaxItems = 5
+	}
+	if o.TimeLayout == "" {
+		o.TimeLayout = "2006-01-02 15:04:05 MST"
+	}
+}
+
+// RenderValue returns a short, single-line display of a value for user
+// interfaces such as TUIs and admin panels showing a configuration tree:
+// long strings are cut off, big arrays and inline tables show their first
+// items and their size, as in [1, 2, 3, 4, 5, … (12 items)], and tables
+// show their number of keys. A key-value shows its value. It uses the
+// default RenderOptions.
+func RenderValue(n Node) string {
+	return RenderValueWithOptions(n, RenderOptions{})
+}
+
+// RenderValueWithOptions is RenderValue with control over truncation and
+// datetime display.
+func RenderValueWithOptions(n Node, opts RenderOptions) string {
+	opts.setDefaults()
+	var b strings.Builder
+	renderValue(&b, n, &opts)
+	return b.String()
+}
+
+func renderValue(b *strings.Builder, n Node, o *RenderOptions) {
+	switch v := n.(type) {
+	case nil:
+	case *KeyValue:
+		renderValue(b, v.val, o)
+	case *StringNode:
+		renderString(b, v.Value(), o.MaxStringLength)
+	case *DateTimeNode:
+		b.WriteString(renderDateTime(v, o))
+	case *ArrayNode:
+		b.WriteByte('[')
+		renderItems(b, len(v.elements), "items", o, func(i int) { renderValue(b, v.elements[i], o) })
+		b.WriteByte(']')
+	case *InlineTableNode:
+		b.WriteByte('{')
+		renderItems(b, len(v.entries), "keys", o, func(i int) {
+			b.WriteString(JoinPath(partsToSegs(v.entries[i].keyParts)...) + " = ")
+			renderValue(b, v.entries[i].val, o)
+		})
+		b.WriteByte('}')
+	case *TableNode, *ArrayOfTables:
+		keys := 0
+		for range keyValuesSeq(*entriesOf(v)) {
+			keys++
+		}
+		b.WriteString(renderCount(keys, "key", "keys"))
+	default:
+		text := strings.Join(strings.Fields(n.Text()), " ")
+		b.WriteString(truncateRunes(text, o.MaxStringLength))
+	}
+}
+
+// renderString writes s quoted, escaping newlines and other control
+// characters, cut off after limit characters.
+func renderString(b *strings.Builder, s string, limit int) {
+	cut := truncateRunes(s, limit)
+	if cut == s {
+		b.WriteString(strconv.Quote(s))
+		return
+	}
+	q := strconv.Quote(strings.TrimSuffix(cut, "…"))
+	b.WriteString(q[:len(q)-1] + `…"`)
+}
+
+// truncateRunes returns s cut off after limit runes with "…", or s if it is
+// no longer or limit is negative.
+func truncateRunes(s string, limit int) string {
+	if limit < 0 {
+		return s
+	}
+	n := 0
+	for i := range s {
+		if n == limit {
+			return s[:i] + "…"
+		}
+		n++
+	}
+	return s
+}
+
+// renderItems writes the first items of a list of count, separated by
+// commas, followed by the total if some were left out.
+func renderItems(b *strings.Builder, count int, noun string, o *RenderOptions, item func(int)) {
+	shown := count
+	if o.MaxItems >= 0 && count > o.MaxItems {
+		shown = o.MaxItems
+	}
+	for i := range shown {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		item(i)
+	}
+	if shown < count {
+		if shown > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("… (" + strconv.Itoa(count) + " " + noun + ")")
+	}
+}
+
+func renderDateTime(n *DateTimeNode, o *RenderOptions) string {
+	if o.Location == nil || n.Kind() != OffsetDateTime {
+		return n.text
+	}
+	t, err := n.In(o.Location)
+	if err != nil {
+		return n.text
+	}
+	return t.Format(o.TimeLayout)
+}
+
+// renderCount returns "1 key" or "3 keys".
+func renderCount(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return strconv.Itoa(n) + " " + many
+}
@@ -0,0 +1,207 @@
+package toml
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Reparse replaces the contents of d with src, an edited version of its
+// text, parsing only the sections around the edit. The sections before the
+// edit keep their nodes, and so do the sections from the first header
+// after it, so an editor can reparse on every keystroke at the cost of the
+// edited section rather than the whole file. The whole document is still
+// validated.
+//
+// The result is what Parse returns for src, provided d is what Parse
+// returned for its current text, possibly through earlier calls to
+// Reparse; after other mutations, parse afresh instead. If src does not
+// parse, Reparse returns the error and leaves d unchanged.
+func (d *Document) Reparse(src []byte) error {
+	if src == nil {
+		return ErrNilInput
+	}
+	if msg := validateUTF8(src); msg != "" {
+		return &ParseError{Message: msg, Line: 1, Column: 1, Source: string(src), Hint: hintFor(msg)}
+	}
+	text := string(src)
+	old, starts := d.layout()
+	if text == old {
+		return nil
+	}
+	pre := commonPrefixLen(old, text)
+	newEnd := len(text) - commonSuffixLen(old[pre:], text[pre:])
+	delta := len(text) - len(old)
+
+	var undo []func()
+	restore := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+
+	// Resume at the last section whose header is before the edit, with the
+	// trivia that closes the section before it, as the two are split
+	// together.
+	next := &Document{}
+	p := newParser(text)
+	var ct tableTarget
+	h := restartSection(d.nodes, starts, pre)
+	if h > 0 {
+		next.prologue = d.prologue
+		next.nodes = append(make([]Node, 0, len(d.nodes)), d.nodes[:h]...)
+		at := starts[h]
+		if body := bodyTriviaOf(d.nodes[h-1]); body != nil {
+			saved := *body
+			undo = append(undo, func() { *body = saved })
+			*body = nil
+			at -= triviaLen(saved)
+			ct = d.nodes[h-1].(tableTarget)
+		}
+		p.seek(at)
+	}
+
+	// Stop at the first header past the edit that is the header of an old
+	// section: the rest of the text is unchanged from there.
+	k, line, col := -1, 0, 0
+	var leading []Node
+	p.stop = func(pos int, trivia []Node) bool {
+		if pos < newEnd {
+			return false
+		}
+		i := sort.SearchInts(starts, pos-delta+1) - 1
+		if i < 0 || headerOffset(d.nodes[i], starts[i]) != pos-delta {
+			return false
+		}
+		k, leading, line, col = i, trivia, p.cur.Line, p.cur.Col
+		return true
+	}
+	if err := p.parseFrom(next, ct); err != nil {
+		restore()
+		return err
+	}
+	added := next.nodes[max(h, 0):]
+	if k >= 0 {
+		kept := d.nodes[k:]
+		lt, pos := leadingTriviaOf(kept[0]), srcPosOf(kept[0])
+		savedLeading, savedPos := *lt, *pos
+		by := int32(line) - pos.line
+		shiftLines(kept, by)
+		*lt, pos.col = leading, int32(col)
+		adoptTrivia(kept[0], leading)
+		undo = append(undo, func() {
+			shiftLines(kept, -by)
+			*lt, *pos = savedLeading, savedPos
+		})
+		next.nodes = append(next.nodes, kept...)
+		next.epilogue = d.epilogue
+	}
+
+	nodes, prologue, epilogue := d.nodes, d.prologue, d.epilogue
+	d.nodes, d.prologue, d.epilogue = next.nodes, next.prologue, next.epilogue
+	d.changed()
+	for _, n := range added {
+		setNodeParent(n, d)
+	}
+	adoptTrivia(d, d.prologue)
+	adoptTrivia(d, d.epilogue)
+	v := &docValidator{source: text, ctx: context.Background()}
+	defer v.release()
+	if err := v.validate(d); err != nil {
+		d.nodes, d.prologue, d.epilogue = nodes, prologue, epilogue
+		d.changed()
+		restore()
+		return err
+	}
+	return nil
+}
+
+// layout returns the text of d and the offset in it where each top-level
+// node starts, counting its leading trivia.
+func (d *Document) layout() (string, []int) {
+	var b strings.Builder
+	serializeTrivia(&b, d.prologue)
+	starts := make([]int, len(d.nodes))
+	for i, n := range d.nodes {
+		starts[i] = b.Len()
+		serializeNode(&b, n)
+	}
+	serializeTrivia(&b, d.epilogue)
+	return b.String(), starts
+}
+
+// restartSection returns the index of the last section in nodes whose
+// header starts before offset, or 0 if there is none or it is the first
+// node, in which case parsing starts over.
+func restartSection(nodes []Node, starts []int, offset int) int {
+	for h := sort.SearchInts(starts, offset) - 1; h > 0; h-- {
+		if at := headerOffset(nodes[h], starts[h]); at >= 0 && at < offset {
+			return h
+		}
+	}
+	return 0
+}
+
+// headerOffset returns the offset of the header of the section n, which
+// starts at start with its leading trivia, or -1 if n is not a section.
+func headerOffset(n Node, start int) int {
+	if bodyTriviaOf(n) == nil {
+		return -1
+	}
+	return start + triviaLen(lineTriviaOf(n).leading())
+}
+
+// srcPosOf returns the source position of a key-value or header, or nil
+// for other nodes.
+func srcPosOf(n Node) *srcPos {
+	switch v := n.(type) {
+	case *KeyValue:
+		return &v.srcPos
+	case *TableNode:
+		return &v.srcPos
+	case *ArrayOfTables:
+		return &v.srcPos
+	}
+	return nil
+}
+
+// shiftLines moves the source positions in nodes down by lines, leaving
+// the zero positions of nodes built in code alone.
+func shiftLines(nodes []Node, lines int32) {
+	var shift func(Node) bool
+	shift = func(n Node) bool {
+		if pos := srcPosOf(n); pos != nil && pos.line != 0 {
+			pos.line += lines
+		}
+		return eachChild(n, shift)
+	}
+	eachNode(shift, nodes)
+}
+
+func triviaLen(nodes []Node) int {
+	n := 0
+	for _, t := range nodes {
+		n += len(t.Text())
+	}
+	return n
+}
+
+func commonPrefixLen(a, b string) int {
+	n := min(len(a), len(b))
+	for i := range n {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+func commonSuffixLen(a, b string) int {
+	n := min(len(a), len(b))
+	for i := range n {
+		if a[len(a)-1-i] != b[len(b)-1-i] {
+			return i
+		}
+	}
+	return n
+}
@@ -0,0 +1,386 @@
+package toml
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+)
+
+// LogicalTable is the merged view of one table, independent of how the
+// document spells it: a [header] section, dotted keys in a parent, an
+// inline table, or any mix of these. It is a snapshot; mutations made
+// through the CST after Resolve are not reflected.
+type LogicalTable struct {
+	doc  *Document
+	segs []string
+	n    *lnode
+}
+
+// Resolve returns the logical table at path, or nil if path is not a
+// table. The empty path is the root table. An array of tables, and any
+// path through one, resolves to its last entry.
+func (d *Document) Resolve(path string) *LogicalTable {
+	segs := parseDottedPath(path)
+	n := d.logicalRoot()
+	if len(segs) > 0 {
+		n = n.lookup(segs)
+	}
+	if n == nil {
+		return nil
+	}
+	if n = n.descend(); n == nil {
+		return nil
+	}
+	return &LogicalTable{doc: d, segs: segs, n: n}
+}
+
+// Path returns the dotted path of the table, quoting segments as needed.
+// The root table's path is empty.
+func (t *LogicalTable) Path() string {
+	return JoinPath(t.segs...)
+}
+
+// Keys returns the names of the table's direct children, unquoted and in
+// the order they first appear in the document.
+func (t *LogicalTable) Keys() []string {
+	return append([]string(nil), t.n.names...)
+}
+
+// Get returns the key-value that defines the value named key, which may
+// be a relative dotted path. It returns nil for tables, arrays of tables,
+// and missing keys.
+func (t *LogicalTable) Get(key string) *KeyValue {
+	c := t.n.lookup(parseDottedPath(key))
+	if c == nil || c.kind == TypeTable || c.kind == TypeArrayOfTables {
+		return nil
+	}
+	return c.kv
+}
+
+// Table returns the logical table at the relative path key, or nil. An
+// array of tables resolves to its last entry.
+func (t *LogicalTable) Table(key string) *LogicalTable {
+	segs := parseDottedPath(key)
+	c := t.n.lookup(segs)
+	if c == nil || len(segs) == 0 {
+		return nil
+	}
+	if c = c.descend(); c == nil {
+		return nil
+	}
+	return &LogicalTable{doc: t.doc, segs: append(append([]string(nil), t.segs...), segs...), n: c}
+}
+
+// Entries returns every entry of the array of tables at the relative path
+// key, or nil if key is not an array of tables.
+func (t *LogicalTable) Entries(key string) []*LogicalTable {
+	segs := parseDottedPath(key)
+	c := t.n.lookup(segs)
+	if c == nil || c.kind != TypeArrayOfTables {
+		return nil
+	}
+	path := append(append([]string(nil), t.segs...), segs...)
+	out := make([]*LogicalTable, len(c.entries))
+	for i, e := range c.entries {
+		out[i] = &LogicalTable{doc: t.doc, segs: path, n: e}
+	}
+	return out
+}
+
+// Values iterates over the table's direct values in document order,
+// yielding each name with the key-value that defines it. Child tables and
+// arrays of tables are skipped.
+func (t *LogicalTable) Values() iter.Seq2[string, *KeyValue] {
+	return func(yield func(string, *KeyValue) bool) {
+		for _, name := range t.n.names {
+			c := t.n.fields[name]
+			if c.kind == TypeTable || c.kind == TypeArrayOfTables {
+				continue
+			}
+			if !yield(name, c.kv) {
+				return
+			}
+		}
+	}
+}
+
+// Definitions returns the CST nodes that define the table, in document
+// order: the *TableNode or *ArrayOfTables whose header names it (or, for
+// an implicit table, the first header or dotted key below it), each
+// *KeyValue whose dotted key or inline table adds to it, and the
+// *Document for the root.
+func (t *LogicalTable) Definitions() []Node {
+	return append([]Node(nil), t.n.defs...)
+}
+
+// Set sets the value at key, a path relative to the table, and edits the
+// CST to match. An existing value is replaced in place. A new key is
+// written where a reader would look for it:
+//
+//   - in the table's own [header] section, or at the top of the document
+//     for the root table;
+//   - inside the inline table that defines it;
+//   - as a dotted key next to the dotted keys that define it;
+//   - otherwise, for a table that only exists as the parent of other
+//     headers, in a new [header] section placed before its first child.
+//
+// Missing intermediate tables in key become dotted key segments. Set
+// returns an error wrapping ErrKeyConflict if key names a table or passes
+// through a value.
+func (t *LogicalTable) Set(key string, val Node) error {
+	_, _, err := t.set(key, val)
+	return err
+}
+
+// set is Set, returning the key-value that holds val and the value it
+// replaced, or nil if the key is new.
+func (t *LogicalTable) set(key string, val Node) (*KeyValue, Node, error) {
+	return t.setSegs(parseDottedPath(key), val)
+}
+
+func (t *LogicalTable) setSegs(segs []string, val Node) (*KeyValue, Node, error) {
+	if len(segs) == 0 {
+		return nil, nil, ErrEmptyKey
+	}
+	if err := validateValueType(val); err != nil {
+		return nil, nil, err
+	}
+	cur, path, rest, err := t.setTarget(segs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c := cur.child(rest[0]); c != nil && len(rest) == 1 {
+		old := c.kv.val
+		if err := c.kv.SetValue(val); err != nil {
+			return nil, nil, err
+		}
+		setLogicalValue(cur, rest[0], c.kv)
+		return c.kv, old, nil
+	}
+	kv, err := t.doc.placeKeyValue(cur, path, rest, val)
+	if err != nil {
+		return nil, nil, err
+	}
+	setLogicalValue(logicalTable(cur, segsToParts(rest[:len(rest)-1]), kv), rest[len(rest)-1], kv)
+	return kv, nil, nil
+}
+
+// setTarget finds where Set writes segs: the deepest existing table on the
+// way, its path, and the segments below it. If the last segment already
+// exists, rest holds just that segment and it is a value.
+func (t *LogicalTable) setTarget(segs []string) (cur *lnode, path, rest []string, err error) {
+	cur, path = t.n, append([]string(nil), t.segs...)
+	i := 0
+	for ; i < len(segs)-1; i++ {
+		c := cur.child(segs[i])
+		if c == nil {
+			break
+		}
+		path = append(path, segs[i])
+		if cur = c.descend(); cur == nil {
+			return nil, nil, nil, fmt.Errorf("%w: %s is a value", ErrKeyConflict, JoinPath(path...))
+		}
+	}
+	rest = segs[i:]
+	if c := cur.child(rest[0]); c != nil && len(rest) == 1 {
+		if c.kv == nil || c.kind == TypeTable || c.kind == TypeArrayOfTables {
+			return nil, nil, nil, fmt.Errorf("%w: %s is a table", ErrKeyConflict, JoinPath(append(path, rest[0])...))
+		}
+	}
+	return cur, path, rest, nil
+}
+
+// placeKeyValue writes key rest = val into the CST for the logical table
+// lt at path, choosing the location described on LogicalTable.Set.
+func (d *Document) placeKeyValue(lt *lnode, path, rest []string, val Node) (*KeyValue, error) {
+	for _, def := range lt.defs {
+		switch s := def.(type) {
+		case *Document:
+			kv, err := NewKeyValue(JoinPath(rest...), val)
+			if err != nil {
+				return nil, err
+			}
+			return kv, d.InsertAt(d.rootEnd(), kv)
+		case *TableNode:
+			if slices.Equal(partsToSegs(s.headerParts), path) {
+				return appendNewKeyValue(s.Append, JoinPath(rest...), val)
+			}
+		case *ArrayOfTables:
+			if slices.Equal(partsToSegs(s.headerParts), path) {
+				return appendNewKeyValue(s.Append, JoinPath(rest...), val)
+			}
+		}
+	}
+	if lt.kv != nil {
+		if it, ok := lt.kv.val.(*InlineTableNode); ok {
+			return appendNewKeyValue(it.Append, JoinPath(rest...), val)
+		}
+	}
+	if last, ok := lt.defs[len(lt.defs)-1].(*KeyValue); ok {
+		return d.placeDottedKey(last, path, rest, val)
+	}
+	tbl, err := NewTable(JoinPath(path...))
+	if err != nil {
+		return nil, err
+	}
+	kv, err := appendNewKeyValue(tbl.Append, JoinPath(rest...), val)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.InsertAt(slices.Index(d.nodes, lt.defs[0]), tbl); err != nil {
+		return nil, err
+	}
+	lt.addDef(tbl)
+	return kv, nil
+}
+
+// placeDottedKey inserts a dotted key after sibling, a dotted key that
+// defines the table at path, reusing its spelling of the shared prefix.
+func (d *Document) placeDottedKey(sibling *KeyValue, path, rest []string, val Node) (*KeyValue, error) {
+	container := sibling.Parent()
+	prefix := sibling.keyParts[:len(path)-len(containerPath(container))]
+	raw := make([]string, 0, len(prefix)+1)
+	for _, p := range prefix {
+		raw = append(raw, p.Text)
+	}
+	raw = append(raw, JoinPath(rest...))
+	kv, err := NewKeyValue(strings.Join(raw, "."), val)
+	if err != nil {
+		return nil, err
+	}
+	switch c := container.(type) {
+	case *Document:
+		return kv, c.InsertAt(slices.Index(c.nodes, Node(sibling))+1, kv)
+	case *TableNode:
+		return kv, c.InsertAt(slices.Index(c.entries, Node(sibling))+1, kv)
+	case *ArrayOfTables:
+		return kv, insertEntry(c, &c.entries, slices.Index(c.entries, Node(sibling))+1, kv)
+	case *InlineTableNode:
+		return kv, c.Append(kv)
+	}
+	return nil, fmt.Errorf("%w: %T", ErrInvalidNodeType, container)
+}
+
+func appendNewKeyValue(add func(*KeyValue) error, rawKey string, val Node) (*KeyValue, error) {
+	kv, err := NewKeyValue(rawKey, val)
+	if err != nil {
+		return nil, err
+	}
+	return kv, add(kv)
+}
+
+// rootEnd returns the index just past the root table's key-values.
+func (d *Document) rootEnd() int {
+	for i, n := range d.nodes {
+		switch n.(type) {
+		case *TableNode, *ArrayOfTables:
+			return i
+		}
+	}
+	return len(d.nodes)
+}
+
+// TableOrImplicit returns the logical table at path like Resolve, but only
+// for tables: it returns nil for arrays of tables. Unlike Document.Table,
+// it also finds tables that are never written as a [header], such as a in
+// [a.b] or in a.b = 1.
+func (d *Document) TableOrImplicit(path string) *LogicalTable {
+	if kind, ok := d.KindAt(path); path != "" && (!ok || kind != TypeTable) {
+		return nil
+	}
+	return d.Resolve(path)
+}
+
+// Implicit reports whether the table is only defined by the headers of its
+// sub-tables, with no header, dotted key, or inline table of its own.
+func (t *LogicalTable) Implicit() bool {
+	for _, def := range t.n.defs {
+		switch v := def.(type) {
+		case *Document, *KeyValue:
+			return false
+		case *TableNode:
+			if slices.Equal(partsToSegs(v.headerParts), t.segs) {
+				return false
+			}
+		case *ArrayOfTables:
+			if slices.Equal(partsToSegs(v.headerParts), t.segs) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// AddTable adds an empty [path.name] section for a new sub-table and
+// returns it. The header is placed after the last section that belongs to
+// the table, or at the end of the document if there is none. name may be a
+// relative dotted path.
+func (t *LogicalTable) AddTable(name string) (*TableNode, error) {
+	segs := parseDottedPath(name)
+	if len(segs) == 0 {
+		return nil, ErrEmptyKey
+	}
+	tbl, err := NewTable(JoinPath(append(append([]string(nil), t.segs...), segs...)...))
+	if err != nil {
+		return nil, err
+	}
+	if err := t.doc.InsertAt(t.sectionEnd(), tbl); err != nil {
+		return nil, err
+	}
+	sub := logicalTable(t.n, segsToParts(segs), tbl)
+	sub.addDef(tbl)
+	return tbl, nil
+}
+
+// sectionEnd returns the index of the first top-level node after the
+// sections that belong to the table.
+func (t *LogicalTable) sectionEnd() int {
+	nodes := t.doc.nodes
+	if len(t.segs) == 0 {
+		return len(nodes)
+	}
+	start := -1
+	for _, def := range t.n.defs {
+		switch def.(type) {
+		case *TableNode, *ArrayOfTables:
+			if i := slices.Index(nodes, def); i >= 0 && slices.Equal(headerSegs(def), t.segs) {
+				start = i
+			}
+		}
+	}
+	from, end := 0, -1
+	if start >= 0 {
+		from, end = start+1, start+1
+	}
+	for i := from; i < len(nodes); i++ {
+		segs := headerSegs(nodes[i])
+		if segs == nil {
+			continue
+		}
+		_, aot := nodes[i].(*ArrayOfTables)
+		inside := isPrefix(t.segs, segs) && !(aot && len(segs) == len(t.segs))
+		switch {
+		case inside:
+			end = i + 1
+		case start >= 0:
+			return end
+		}
+	}
+	if end < 0 {
+		return len(nodes)
+	}
+	return end
+}
+
+// headerSegs returns the unquoted header path of a table or array of
+// tables, or nil for other nodes.
+func headerSegs(n Node) []string {
+	switch v := n.(type) {
+	case *TableNode:
+		return partsToSegs(v.headerParts)
+	case *ArrayOfTables:
+		return partsToSegs(v.headerParts)
+	}
+	return nil
+}
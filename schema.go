@@ -0,0 +1,161 @@
+package toml
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"time"
+)
+
+// ValueType is the type of a TOML value, as found in a document or as
+// expected by a Schema.
+type ValueType int
+
+// Value types. TypeAny accepts any value.
+const (
+	TypeAny ValueType = iota
+	TypeString
+	TypeInteger
+	TypeFloat
+	TypeBoolean
+	TypeDateTime
+	TypeArray
+	TypeTable
+	TypeArrayOfTables
+)
+
+var valueTypeNames = [...]string{
+	TypeAny:           "any",
+	TypeString:        "string",
+	TypeInteger:       "integer",
+	TypeFloat:         "float",
+	TypeBoolean:       "boolean",
+	TypeDateTime:      "datetime",
+	TypeArray:         "array",
+	TypeTable:         "table",
+	TypeArrayOfTables: "array of tables",
+}
+
+func (t ValueType) String() string {
+	if t >= 0 && int(t) < len(valueTypeNames) {
+		return valueTypeNames[t]
+	}
+	return "unknown"
+}
+
+// Schema describes the expected shape of a document or of one value in it.
+// The root of a document schema has Type TypeTable.
+type Schema struct {
+	Type        ValueType
+	Description string
+
+	// Default is the TOML text of the default value, e.g. `8080` or
+	// `"localhost"`. Empty if there is none.
+	Default string
+
+	// Values lists the allowed values as TOML text, e.g. `"s3"`. Empty if
+	// any value of Type is allowed.
+	Values []string
+
+	// Fields describes the keys of a table, or of each entry of an array
+	// of tables.
+	Fields map[string]*Schema
+
+	// Items describes the elements of an array.
+	Items *Schema
+
+	// Min and Max, if non-nil, bound an integer or float value. A nan is
+	// outside any bound.
+	Min, Max *float64
+
+	// Pattern, if not empty, is a regular expression that a string value
+	// must match, as by regexp.MatchString; anchor it to match the whole.
+	Pattern string
+
+	// MinLength and MaxLength bound the number of characters of a string,
+	// and MinItems and MaxItems the number of elements of an array or
+	// entries of an array of tables. Zero means no bound.
+	MinLength, MaxLength int
+	MinItems, MaxItems   int
+
+	// After and Before, if not zero, bound a datetime value, exclusive.
+	// Local datetimes, dates, and times are read as in UTC.
+	After, Before time.Time
+
+	// Discriminator, if not empty, names a key of the table whose value
+	// selects which of Variants also describes it, as for storage blocks
+	// with type = "s3" or type = "gcs". Variants is keyed by the value as
+	// AsString returns it, and the selected variant's Fields are added to
+	// the table's own, replacing any of the same name.
+	Discriminator string
+	Variants      map[string]*Schema
+
+	// foldFields holds fields named after Go struct fields, whose keys
+	// are matched without regard to case.
+	foldFields map[string]*Schema
+}
+
+// Lookup returns the schema for the value at the dotted path below s, or
+// nil if the path is not described. Array-of-tables entries are looked up
+// through their parent path.
+func (s *Schema) Lookup(path string) *Schema {
+	return s.lookupSegs(parseDottedPath(path))
+}
+
+func (s *Schema) lookupSegs(segs []string) *Schema {
+	cur := s
+	for _, seg := range segs {
+		if cur == nil {
+			return nil
+		}
+		cur = cur.Fields[seg]
+	}
+	return cur
+}
+
+// fieldNames returns the names of s's fields in sorted order.
+func (s *Schema) fieldNames() []string {
+	names := make([]string, 0, len(s.Fields))
+	for name := range s.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// variant returns the schema of a table whose discriminator has the value
+// v: s with the fields of the selected variant, if any, and with the
+// discriminator itself, which accepts any value unless s describes it.
+func (s *Schema) variant(v string) *Schema {
+	merged := *s
+	merged.Discriminator, merged.Variants = "", nil
+	merged.Fields = maps.Clone(s.Fields)
+	if merged.Fields == nil {
+		merged.Fields = make(map[string]*Schema)
+	}
+	if vs := s.Variants[v]; vs != nil {
+		maps.Copy(merged.Fields, vs.Fields)
+	}
+	if merged.field(s.Discriminator) == nil {
+		merged.Fields[s.Discriminator] = &Schema{}
+	}
+	return &merged
+}
+
+// discriminator returns the value of s's discriminator in t and its
+// key-value, if any, or false if it is not set or not a single value.
+func (s *Schema) discriminator(t *lnode) (string, *KeyValue, bool) {
+	n := t.fields[s.Discriminator]
+	if n == nil || n.kv == nil {
+		return "", nil, false
+	}
+	v, ok := asString(n.kv.val)
+	return v, n.kv, ok
+}
+
+// variantNames returns the keys of s's variants in sorted order.
+func (s *Schema) variantNames() []string {
+	names := slices.Collect(maps.Keys(s.Variants))
+	sort.Strings(names)
+	return names
+}
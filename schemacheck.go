@@ -0,0 +1,223 @@
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Check validates doc against s, the schema of a whole document, and
+// returns every violation joined with errors.Join, or nil. Each is a
+// ConstraintError positioned at the offending value, or at the header of
+// a table, wrapping ErrTypeMismatch for a value of the wrong type and
+// ErrConstraint for a value outside Values, Min and Max, Pattern, the
+// length and item bounds, or After and Before, and for a table with a
+// Discriminator that is missing or selects no variant. An integer is
+// accepted where a float is expected. Keys that s does not describe are
+// not reported; see UnusedKeys. Check is a Constraint, so it can run
+// with others as doc.CheckConstraints(schema.Check, ...).
+func (s *Schema) Check(doc *Document) error {
+	c := schemaChecker{pos: nodePositions{doc: doc}, patterns: make(map[string]*regexp.Regexp)}
+	c.table(doc.logicalRoot(), s, "")
+	return errors.Join(c.errs...)
+}
+
+// schemaChecker collects the violations Schema.Check reports.
+type schemaChecker struct {
+	pos      nodePositions
+	patterns map[string]*regexp.Regexp
+	errs     []error
+}
+
+// fail records a violation at n.
+func (c *schemaChecker) fail(path string, n Node, err error, format string, args ...any) {
+	c.errs = append(c.errs, &ConstraintError{
+		Path:     path,
+		Node:     n,
+		Position: c.pos.of(n),
+		Message:  path + ": " + fmt.Sprintf(format, args...),
+		Err:      err,
+	})
+}
+
+// table checks the keys of t, at path, that s describes.
+func (c *schemaChecker) table(t *lnode, s *Schema, path string) {
+	if s != nil && s.Discriminator != "" {
+		s = c.variant(t, s, path)
+	}
+	if s == nil || s.Fields == nil && s.foldFields == nil {
+		return
+	}
+	for _, name := range t.names {
+		if fs := s.field(name); fs != nil {
+			c.child(t.fields[name], fs, joinPath(path, QuoteKey(name)))
+		}
+	}
+}
+
+// variant returns the schema of t, at path, for the variant its
+// discriminator selects, reporting a discriminator that is missing or has
+// no variant.
+func (c *schemaChecker) variant(t *lnode, s *Schema, path string) *Schema {
+	key := joinPath(path, QuoteKey(s.Discriminator))
+	v, kv, ok := s.discriminator(t)
+	switch {
+	case kv == nil:
+		c.fail(key, t.node(), ErrKeyNotFound, "missing discriminator")
+	case !ok:
+		c.fail(key, kv.val, ErrTypeMismatch, "expected a discriminator value, got %s", valueTypeOf(kv.val))
+	case s.Variants[v] == nil:
+		c.fail(key, kv.val, ErrConstraint, "%s is not one of %s", kv.val.Text(), strings.Join(s.variantNames(), ", "))
+	}
+	return s.variant(v)
+}
+
+// child checks one key of a table against its schema.
+func (c *schemaChecker) child(n *lnode, s *Schema, path string) {
+	switch {
+	case n.kind == TypeArrayOfTables && (s.Type == TypeArrayOfTables || s.Type == TypeAny):
+		c.count(path, n.node(), len(n.entries), s)
+		for i, e := range n.entries {
+			c.table(e, s, path+"["+strconv.Itoa(i)+"]")
+		}
+	case n.kv != nil:
+		c.value(n.kv.val, s, path)
+	case s.Type != TypeTable && s.Type != TypeAny:
+		c.fail(path, n.node(), ErrTypeMismatch, "expected %s, got %s", s.Type, n.kind)
+	default:
+		c.table(n, s, path)
+	}
+}
+
+// value checks a value against its schema.
+func (c *schemaChecker) value(val Node, s *Schema, path string) {
+	got := valueTypeOf(val)
+	if !schemaAccepts(s.Type, got) {
+		c.fail(path, val, ErrTypeMismatch, "expected %s, got %s", s.Type, got)
+		return
+	}
+	if len(s.Values) > 0 && !slices.ContainsFunc(s.Values, func(text string) bool {
+		want, err := parseValueText(text)
+		return err == nil && ValuesEqual(val, want)
+	}) {
+		c.fail(path, val, ErrConstraint, "%s is not one of the allowed values", val.Text())
+		return
+	}
+	switch v := val.(type) {
+	case *NumberNode:
+		c.number(v, s, path)
+	case *StringNode:
+		c.text(v, s, path)
+	case *DateTimeNode:
+		c.dateTime(v, s, path)
+	case *ArrayNode:
+		c.array(v, s, path)
+	case *InlineTableNode:
+		t := newLTable(v)
+		for _, kv := range v.entries {
+			addLogicalKeyValue(t, kv)
+		}
+		c.table(t, s, path)
+	}
+}
+
+// schemaAccepts reports whether a value of type got is allowed where the
+// schema expects want.
+func schemaAccepts(want, got ValueType) bool {
+	switch want { //nolint:exhaustive
+	case TypeAny:
+		return true
+	case TypeFloat:
+		return got == TypeFloat || got == TypeInteger
+	case TypeArrayOfTables:
+		return got == TypeArray
+	}
+	return got == want
+}
+
+func (c *schemaChecker) number(n *NumberNode, s *Schema, path string) {
+	f, err := n.Float()
+	if err != nil {
+		return
+	}
+	if (s.Min != nil || s.Max != nil) && math.IsNaN(f) {
+		c.fail(path, n, ErrConstraint, "%s cannot be compared with the bounds", n.Text())
+		return
+	}
+	if s.Min != nil && f < *s.Min {
+		c.fail(path, n, ErrConstraint, "%s is less than the minimum %v", n.Text(), *s.Min)
+	}
+	if s.Max != nil && f > *s.Max {
+		c.fail(path, n, ErrConstraint, "%s is greater than the maximum %v", n.Text(), *s.Max)
+	}
+}
+
+func (c *schemaChecker) text(n *StringNode, s *Schema, path string) {
+	v := n.Value()
+	if l := utf8.RuneCountInString(v); s.MinLength > 0 && l < s.MinLength {
+		c.fail(path, n, ErrConstraint, "%d characters, fewer than the minimum %d", l, s.MinLength)
+	} else if s.MaxLength > 0 && l > s.MaxLength {
+		c.fail(path, n, ErrConstraint, "%d characters, more than the maximum %d", l, s.MaxLength)
+	}
+	if s.Pattern == "" {
+		return
+	}
+	re, ok := c.patterns[s.Pattern]
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(s.Pattern); err != nil {
+			c.fail(path, n, ErrConstraint, "invalid schema pattern: %v", err)
+		}
+		c.patterns[s.Pattern] = re
+	}
+	if re != nil && !re.MatchString(v) {
+		c.fail(path, n, ErrConstraint, "%s does not match %s", n.Text(), s.Pattern)
+	}
+}
+
+func (c *schemaChecker) dateTime(n *DateTimeNode, s *Schema, path string) {
+	t, err := n.In(time.UTC)
+	if err != nil {
+		return
+	}
+	if !s.After.IsZero() && !t.After(s.After) {
+		c.fail(path, n, ErrConstraint, "%s is not after %s", n.Text(), s.After.Format(time.RFC3339))
+	}
+	if !s.Before.IsZero() && !t.Before(s.Before) {
+		c.fail(path, n, ErrConstraint, "%s is not before %s", n.Text(), s.Before.Format(time.RFC3339))
+	}
+}
+
+// array checks the number of elements of an array and each element
+// against Items, or, for an array of tables written inline, against the
+// schema's Fields.
+func (c *schemaChecker) array(n *ArrayNode, s *Schema, path string) {
+	c.count(path, n, len(n.elements), s)
+	items := s.Items
+	if s.Type == TypeArrayOfTables {
+		items = &Schema{Type: TypeTable, Fields: s.Fields, foldFields: s.foldFields}
+	}
+	if items == nil {
+		return
+	}
+	for i, e := range n.elements {
+		c.value(e, items, path+"["+strconv.Itoa(i)+"]")
+	}
+}
+
+// count checks the number of elements or entries at path against the
+// schema's item bounds.
+func (c *schemaChecker) count(path string, n Node, count int, s *Schema) {
+	if s.MinItems > 0 && count < s.MinItems {
+		c.fail(path, n, ErrConstraint, "%d items, fewer than the minimum %d", count, s.MinItems)
+	}
+	if s.MaxItems > 0 && count > s.MaxItems {
+		c.fail(path, n, ErrConstraint, "%d items, more than the maximum %d", count, s.MaxItems)
+	}
+}
@@ -0,0 +1,267 @@
+package toml
+
+import "context"
+
+// NodeRaw is the node type of RawNode.
+var NodeRaw = RegisterNodeType("Raw")
+
+// RawNode is source text that ParseSelect kept as text instead of building
+// nodes for it: a key-value outside the selected paths, or a whole table
+// or array-of-tables section that cannot hold one, in both cases with the
+// comments and blank lines above it. It stands among the document's nodes
+// or a section's entries where the text was, and String writes it
+// unchanged.
+type RawNode struct{ leafNode }
+
+// Type returns NodeRaw.
+func (n *RawNode) Type() NodeType { return NodeRaw }
+
+// Expand parses the node's text as a document of its own, for when its
+// contents are needed after all. The keys of a key-value are then
+// relative to the section that held it.
+func (n *RawNode) Expand() (*Document, error) {
+	return Parse([]byte(n.text))
+}
+
+// ParseSelect reads a TOML document like Parse, but builds nodes only for
+// the keys at, above, or below one of paths, dotted keys as in Get. Other
+// key-values, and sections whose header rules out every path, are kept as
+// a RawNode holding their text, which saves most of the parsing work and
+// memory when only a few values of large documents are read, such as
+// package.version from many lock files. The whole input is still checked
+// for syntax errors, and String returns it unchanged. Duplicate keys and
+// tables within the raw text are not detected.
+func ParseSelect(data []byte, paths []string) (*Document, error) {
+	sel := make([][]string, len(paths))
+	for i, path := range paths {
+		sel[i] = parseDottedPath(path)
+	}
+	doc := &Document{}
+	if err := parseInto(doc, data, parseRun{ctx: context.Background(), sel: sel}); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// selects reports whether the key parts, in the given section, lead to or
+// lie under one of the selected paths.
+func (p *parser) selects(section, parts []KeyPart) bool {
+	for _, path := range p.sel {
+		if keyPathsOverlap(path, section, parts) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyPathsOverlap reports whether path and the key made of section and
+// parts agree on every segment that both have.
+func keyPathsOverlap(path []string, section, parts []KeyPart) bool {
+	for i, seg := range path {
+		var part KeyPart
+		switch {
+		case i < len(section):
+			part = section[i]
+		case i-len(section) < len(parts):
+			part = parts[i-len(section)]
+		default:
+			return true
+		}
+		if part.Unquoted != seg {
+			return false
+		}
+	}
+	return true
+}
+
+// skipEntry checks the syntax of the key-value at the current token and,
+// if its key is not selected, returns it with its leading trivia as a
+// RawNode. If the key is selected it returns nil and leaves the parser
+// where it was.
+func (p *parser) skipEntry(trivia []Node) (Node, error) {
+	lex, cur := *p.lex, p.cur
+	start := cur.Pos - triviaLen(trivia)
+	parts, _, _, _, err := p.parseKeyEq()
+	if err != nil {
+		return nil, err
+	}
+	if p.selects(p.section, parts) {
+		*p.lex, p.cur = lex, cur
+		return nil, nil
+	}
+	end, err := p.skipKeyValueRest()
+	if err != nil {
+		return nil, err
+	}
+	return &RawNode{leafNode: newLeaf(p.source[start:end])}, nil
+}
+
+// skipSection checks the syntax of the section whose header is at the
+// current token and, if no selected path can lie in it, returns it as a
+// RawNode: its leading trivia, header, and everything up to the next
+// header or the end of the input. Otherwise it returns nil and leaves the
+// parser where it was.
+func (p *parser) skipSection(trivia []Node) (Node, error) {
+	lex, cur := *p.lex, p.cur
+	start := cur.Pos - triviaLen(trivia)
+	p.advance() // [
+	aot := p.at(TokLBracket)
+	if aot {
+		p.advance()
+	}
+	_, parts, err := p.parseKeyInHeader()
+	if err != nil {
+		return nil, err
+	}
+	if p.selects(nil, parts) {
+		*p.lex, p.cur = lex, cur
+		return nil, nil
+	}
+	msg, closers := "expected ']' to close table header", 1
+	if aot {
+		msg, closers = "expected ']]' to close array of tables header", 2
+	}
+	for range closers {
+		if !p.at(TokRBracket) {
+			return nil, p.parseError(msg)
+		}
+		p.advance()
+	}
+	end, err := p.skipLineEnd("table header")
+	if err != nil {
+		return nil, err
+	}
+	for {
+		for p.at(TokWhitespace) || p.at(TokNewline) || p.at(TokComment) || p.atTemplateLine() {
+			tok := p.advance()
+			if tok.Type == TokComment {
+				if msg := validateCommentText(tok.Text); msg != "" {
+					return nil, p.tokError(msg, tok)
+				}
+			}
+			end = tok.Pos + len(tok.Text)
+		}
+		if p.at(TokEOF) || p.at(TokLBracket) {
+			return &RawNode{leafNode: newLeaf(p.source[start:end])}, nil
+		}
+		if _, _, _, _, err := p.parseKeyEq(); err != nil {
+			return nil, err
+		}
+		if end, err = p.skipKeyValueRest(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// skipKeyValueRest checks the syntax of a key-value from its value to the
+// end of its line, and returns the offset of that end.
+func (p *parser) skipKeyValueRest() (int, error) {
+	if _, err := p.skipValue(); err != nil {
+		return 0, err
+	}
+	p.lex.valueMode = false
+	return p.skipLineEnd("value")
+}
+
+// skipLineEnd checks the optional whitespace and comment after a value or
+// header, which must be followed by a newline or the end of the input,
+// and returns the offset of the end of the line.
+func (p *parser) skipLineEnd(after string) (int, error) {
+	if p.at(TokWhitespace) {
+		p.advance()
+	}
+	if p.at(TokComment) {
+		tok := p.advance()
+		if msg := validateCommentText(tok.Text); msg != "" {
+			return 0, p.tokError(msg, tok)
+		}
+	}
+	switch p.cur.Type { //nolint:exhaustive
+	case TokNewline:
+		tok := p.advance()
+		return tok.Pos + len(tok.Text), nil
+	case TokEOF:
+		return p.cur.Pos, nil
+	}
+	return 0, p.parseError("expected newline or end of file after " + after)
+}
+
+// skipValue checks the syntax of a value like parseValue, without building
+// nodes, and returns the offset of its end.
+func (p *parser) skipValue() (int, error) {
+	switch p.cur.Type { //nolint:exhaustive
+	case TokLBracket:
+		return p.skipArray()
+	case TokLBrace:
+		return p.skipInlineTable()
+	case TokBasicString, TokMultiLineBasicStr, TokLiteralString, TokMultiLineLiteralStr,
+		TokInteger, TokFloat, TokBoolean, TokDateTime, TokTemplate:
+	default:
+		return 0, p.parseError("expected value")
+	}
+	tok := p.advance()
+	var msg string
+	switch tok.Type { //nolint:exhaustive
+	case TokInteger, TokFloat:
+		msg = validateNumberText(tok.Text)
+	case TokDateTime:
+		msg = validateDateTimeText(tok.Text)
+	case TokBasicString, TokMultiLineBasicStr, TokLiteralString, TokMultiLineLiteralStr:
+		msg = validateStringText(tok.Text)
+	}
+	if msg != "" {
+		return 0, p.tokError(msg, tok)
+	}
+	return tok.Pos + len(tok.Text), nil
+}
+
+// skipArray is parseArray without the nodes.
+func (p *parser) skipArray() (int, error) {
+	p.advance() // [
+	p.skipWsCommentNewline()
+	for !p.at(TokRBracket) && !p.at(TokEOF) {
+		p.lex.valueMode = true
+		if _, err := p.skipValue(); err != nil {
+			return 0, err
+		}
+		p.lex.valueMode = true
+		p.skipWsCommentNewline()
+		if p.at(TokComma) {
+			p.advance()
+			p.skipWsCommentNewline()
+		} else if !p.at(TokRBracket) {
+			return 0, p.parseError("expected ',' or ']' in array")
+		}
+	}
+	if !p.at(TokRBracket) {
+		return 0, p.parseError("expected ']' to close array")
+	}
+	return p.advance().Pos + 1, nil
+}
+
+// skipInlineTable is parseInlineTable without the nodes.
+func (p *parser) skipInlineTable() (int, error) {
+	p.lex.valueMode = false
+	p.advance() // {
+	p.skipWsCommentNewline()
+	for !p.at(TokRBrace) && !p.at(TokEOF) {
+		if _, _, _, _, err := p.parseKeyEq(); err != nil {
+			return 0, err
+		}
+		if _, err := p.skipValue(); err != nil {
+			return 0, err
+		}
+		p.lex.valueMode = false
+		p.skipWsCommentNewline()
+		if p.at(TokComma) {
+			p.advance()
+			p.skipWsCommentNewline()
+		} else if !p.at(TokRBrace) {
+			return 0, p.parseError("expected ',' or '}' in inline table")
+		}
+	}
+	if !p.at(TokRBrace) {
+		return 0, p.parseError("expected '}' to close inline table")
+	}
+	return p.advance().Pos + 1, nil
+}
@@ -0,0 +1,64 @@
+package toml
+
+// SelectionRanges returns the ranges that an editor's "expand selection"
+// command steps through from the byte offset in doc.String(), innermost
+// first, each containing the one before: a value, the elements of arrays
+// and inline tables around it, the key-value, the key-value with its
+// comments, the table body, the whole table with its header, and the
+// document. On a key the key comes first, and on a header the header.
+// Ranges do not start or end with whitespace, so blank lines above a
+// table are not part of it.
+func SelectionRanges(doc *Document, offset int) []Span {
+	spans, text := doc.Spans(), doc.String()
+	n, ancestors := doc.nodeAt(spans, offset)
+	var out []Span
+	add := func(sp Span) {
+		sp = trimSpace(text, sp)
+		if offset < sp.Start || offset > sp.End {
+			return
+		}
+		if len(out) > 0 {
+			last := out[len(out)-1]
+			if sp == last || sp.Start > last.Start || sp.End < last.End {
+				return
+			}
+		}
+		out = append(out, sp)
+	}
+	if kv, ok := n.(*KeyValue); ok {
+		start := spans[kv].Start
+		add(Span{start, start + len(kv.rawKey)})
+	}
+	for _, c := range append([]Node{n}, ancestors...) {
+		add(spans[c])
+		switch v := c.(type) {
+		case *TableNode:
+			add(bodySpan(v.entries, v.bodyTrivia, spans))
+		case *ArrayOfTables:
+			add(bodySpan(v.entries, v.bodyTrivia, spans))
+		}
+		add(extent(c, spans))
+	}
+	return out
+}
+
+// bodySpan returns the span from the first entry of a table to the end of
+// its last entry or trailing comment, or an empty span if it has none.
+func bodySpan(entries, trivia []Node, spans map[Node]Span) Span {
+	body := append(entries[:len(entries):len(entries)], trivia...)
+	if len(body) == 0 {
+		return Span{}
+	}
+	return Span{extent(body[0], spans).Start, extent(body[len(body)-1], spans).End}
+}
+
+// trimSpace returns sp without the whitespace at its ends in text.
+func trimSpace(text string, sp Span) Span {
+	for sp.Start < sp.End && isWhitespaceOrNewline(text[sp.Start]) {
+		sp.Start++
+	}
+	for sp.End > sp.Start && isWhitespaceOrNewline(text[sp.End-1]) {
+		sp.End--
+	}
+	return sp
+}
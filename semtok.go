@@ -0,0 +1,219 @@
+package toml
+
+import (
+	"sort"
+	"strings"
+)
+
+// TokenClass classifies a span of source text for syntax highlighting.
+type TokenClass int
+
+// Token classes.
+const (
+	TokenKey TokenClass = iota
+	TokenTableHeader
+	TokenString
+	TokenEscape
+	TokenNumber
+	TokenBoolean
+	TokenDateTime
+	TokenComment
+	TokenPunctuation
+)
+
+// SemTok is a classified span of source text.
+type SemTok struct {
+	Span  Span
+	Class TokenClass
+}
+
+// SemanticTokens classifies the text produced by doc.String() for semantic
+// highlighting. Unlike raw lexer tokens it distinguishes keys from table
+// headers and string values, and splits escape sequences out of basic
+// strings. Whitespace is not classified. Tokens are returned in source
+// order and do not overlap.
+func SemanticTokens(doc *Document) []SemTok {
+	text := doc.String()
+	t := &tokenizer{spans: doc.Spans(), text: text}
+	for n := range doc.Preorder() {
+		t.node(n)
+	}
+	sort.Slice(t.out, func(i, j int) bool { return t.out[i].Span.Start < t.out[j].Span.Start })
+	return t.out
+}
+
+type tokenizer struct {
+	spans map[Node]Span
+	text  string
+	out   []SemTok
+}
+
+func (t *tokenizer) emit(start, end int, class TokenClass) {
+	if end > start {
+		t.out = append(t.out, SemTok{Span{start, end}, class})
+	}
+}
+
+func (t *tokenizer) node(n Node) {
+	sp, ok := t.spans[n]
+	if !ok {
+		return
+	}
+	switch v := n.(type) {
+	case *KeyValue:
+		t.key(v.rawKey, sp.Start, TokenKey)
+		eq := sp.Start + len(v.rawKey) + len(v.preEq)
+		t.emit(eq, eq+1, TokenPunctuation)
+	case *TableNode:
+		t.header(sp, 1)
+	case *ArrayOfTables:
+		t.header(sp, 2)
+	case *CommentNode:
+		t.emit(sp.Start, sp.End, TokenComment)
+	case *StringNode:
+		t.str(v.text, sp.Start)
+	case *NumberNode:
+		t.emit(sp.Start, sp.End, TokenNumber)
+	case *BooleanNode:
+		t.emit(sp.Start, sp.End, TokenBoolean)
+	case *DateTimeNode:
+		t.emit(sp.Start, sp.End, TokenDateTime)
+	case *ArrayNode:
+		t.container(sp, itemSpans(t.spans, v.elements))
+	case *InlineTableNode:
+		t.container(sp, itemSpans(t.spans, v.entries))
+	}
+}
+
+func (t *tokenizer) header(sp Span, brackets int) {
+	t.emit(sp.Start, sp.Start+brackets, TokenPunctuation)
+	t.key(t.text[sp.Start+brackets:sp.End-brackets], sp.Start+brackets, TokenTableHeader)
+	t.emit(sp.End-brackets, sp.End, TokenPunctuation)
+}
+
+// key classifies the segments and dots of a raw key starting at base.
+func (t *tokenizer) key(raw string, base int, class TokenClass) {
+	for i := 0; i < len(raw); {
+		switch c := raw[i]; {
+		case c == '.':
+			t.emit(base+i, base+i+1, TokenPunctuation)
+			i++
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"' || c == '\'':
+			end := quotedEnd(raw, i)
+			t.emit(base+i, base+end, class)
+			i = end
+		default:
+			end := i
+			for end < len(raw) && isBareKeyChar(rune(raw[end])) {
+				end++
+			}
+			end = max(end, i+1)
+			t.emit(base+i, base+end, class)
+			i = end
+		}
+	}
+}
+
+// quotedEnd returns the index just past the single-line quoted key that
+// starts at raw[i].
+func quotedEnd(raw string, i int) int {
+	q := raw[i]
+	for j := i + 1; j < len(raw); j++ {
+		switch raw[j] {
+		case '\\':
+			if q == '"' {
+				j++
+			}
+		case q:
+			return j + 1
+		}
+	}
+	return len(raw)
+}
+
+// str classifies a string value, splitting escape sequences out of basic
+// strings.
+func (t *tokenizer) str(raw string, base int) {
+	if !strings.HasPrefix(raw, `"`) {
+		t.emit(base, base+len(raw), TokenString)
+		return
+	}
+	start := 0
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			continue
+		}
+		end := escapeEnd(raw, i)
+		t.emit(base+start, base+i, TokenString)
+		t.emit(base+i, base+end, TokenEscape)
+		start = end
+		i = end - 1
+	}
+	t.emit(base+start, base+len(raw), TokenString)
+}
+
+// escapeEnd returns the index just past the escape sequence at raw[i].
+func escapeEnd(raw string, i int) int {
+	if i+1 >= len(raw) {
+		return len(raw)
+	}
+	n := 2
+	switch raw[i+1] {
+	case 'u':
+		n = 6
+	case 'U':
+		n = 10
+	case 'x':
+		n = 4
+	case ' ', '\t', '\r', '\n':
+		// Line-ending backslash: the escape swallows following whitespace.
+		j := i + 1
+		for j < len(raw) && strings.IndexByte(" \t\r\n", raw[j]) >= 0 {
+			j++
+		}
+		return j
+	}
+	return min(i+n, len(raw))
+}
+
+// container classifies the brackets, commas, and comments of an array or
+// inline table from the gaps between its items. The items themselves are
+// classified as nodes of their own.
+func (t *tokenizer) container(sp Span, items []Span) {
+	t.emit(sp.Start, sp.Start+1, TokenPunctuation)
+	off := sp.Start + 1
+	for _, item := range items {
+		t.separator(off, item.Start)
+		off = item.End
+	}
+	t.separator(off, sp.End-1)
+	t.emit(sp.End-1, sp.End, TokenPunctuation)
+}
+
+// separator classifies commas and comments in text[start:end].
+func (t *tokenizer) separator(start, end int) {
+	for i := start; i < end; i++ {
+		switch t.text[i] {
+		case ',':
+			t.emit(i, i+1, TokenPunctuation)
+		case '#':
+			n := strings.IndexAny(t.text[i:end], "\r\n")
+			if n < 0 {
+				n = end - i
+			}
+			t.emit(i, i+n, TokenComment)
+			i += n - 1
+		}
+	}
+}
+
+// itemSpans returns the spans of a container's items.
+func itemSpans[N Node](spans map[Node]Span, items []N) []Span {
+	out := make([]Span, len(items))
+	for i, n := range items {
+		out[i] = spans[n]
+	}
+	return out
+}
@@ -0,0 +1,226 @@
+package toml
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SerializeOptions configures Document.StringWithOptions. The zero value
+// renders exactly like String.
+type SerializeOptions struct {
+	// StripComments leaves out every comment, including comments inside
+	// arrays and the spaces before trailing comments. Lines that held only
+	// a comment are left out entirely.
+	StripComments bool
+
+	// CollapseBlankLines replaces each run of blank lines with a single
+	// one, and leaves out blank lines at the start and end of the document.
+	CollapseBlankLines bool
+
+	// Minify renders the shortest equivalent document instead: no
+	// comments or blank lines, tables and arrays of tables written inline,
+	// tables with a single key written as dotted keys, keys quoted only
+	// where needed, and strings and integers in their shortest form. The
+	// other options are then ignored.
+	Minify bool
+}
+
+// StringWithOptions renders the document like String, adjusted by opts.
+// The document itself is not changed.
+func (d *Document) StringWithOptions(opts SerializeOptions) string {
+	if opts.Minify {
+		return d.minified()
+	}
+	src := d.String()
+	if !opts.StripComments && !opts.CollapseBlankLines {
+		return src
+	}
+	var b strings.Builder
+	b.Grow(len(src))
+	lex := newLexer(src)
+	wroteAny := false
+	var pending []Token // a blank line held back until a non-blank line follows
+	for {
+		line, done := nextLine(lex)
+		kept, blank := filterLine(line, opts.StripComments)
+		switch {
+		case kept == nil:
+		case blank && opts.CollapseBlankLines:
+			if wroteAny && pending == nil {
+				pending = kept
+			}
+		case blank:
+			writeTokens(&b, kept)
+		default:
+			writeTokens(&b, pending)
+			writeTokens(&b, kept)
+			pending, wroteAny = nil, true
+		}
+		if done {
+			break
+		}
+	}
+	return b.String()
+}
+
+// nextLine returns the tokens up to and including the next newline, and
+// whether the end of the source was reached. A multi-line string is one
+// token, so its line breaks do not end the line.
+func nextLine(lex *lexer) (line []Token, done bool) {
+	for {
+		tok := lex.Next()
+		switch tok.Type {
+		case TokEOF:
+			return line, true
+		case TokError:
+			// Unreachable for a valid document; keep the rest as is.
+			line = append(line, Token{Type: TokError, Text: lex.src[tok.Pos:]})
+			lex.pos = len(lex.src)
+			return line, true
+		}
+		line = append(line, tok)
+		if tok.Type == TokNewline {
+			return line, false
+		}
+	}
+}
+
+// filterLine removes the comment from a line if strip is set, with the
+// whitespace before it. It returns nil if the line held only a comment,
+// and reports whether what is left is a blank line.
+func filterLine(line []Token, strip bool) (kept []Token, blank bool) {
+	hadComment := false
+	blank = true
+	for i, tok := range line {
+		switch tok.Type {
+		case TokComment:
+			if strip {
+				hadComment = true
+				for len(kept) > 0 && kept[len(kept)-1].Type == TokWhitespace {
+					kept = kept[:len(kept)-1]
+				}
+				continue
+			}
+			blank = false
+		case TokWhitespace, TokNewline:
+		default:
+			blank = false
+		}
+		kept = append(kept, line[i])
+	}
+	if len(line) == 0 || (hadComment && blank) {
+		return nil, false
+	}
+	return kept, blank
+}
+
+func writeTokens(b *strings.Builder, toks []Token) {
+	for _, t := range toks {
+		b.WriteString(t.Text)
+	}
+}
+
+// minified renders the logical content of the document, one top-level key
+// per line.
+func (d *Document) minified() string {
+	var b strings.Builder
+	root := d.logicalRoot()
+	for _, name := range root.names {
+		writeMinField(&b, QuoteKey(name), root.fields[name])
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// writeMinField writes key=value for the logical value n, folding tables
+// with a single key into the dotted key.
+func writeMinField(b *strings.Builder, key string, n *lnode) {
+	for n.kind == TypeTable && len(n.names) == 1 {
+		key += "." + QuoteKey(n.names[0])
+		n = n.fields[n.names[0]]
+	}
+	b.WriteString(key + "=")
+	switch n.kind { //nolint:exhaustive
+	case TypeTable:
+		writeMinTable(b, n)
+	case TypeArrayOfTables:
+		b.WriteByte('[')
+		for i, e := range n.entries {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeMinTable(b, e)
+		}
+		b.WriteByte(']')
+	default:
+		writeMinValue(b, n.kv.val)
+	}
+}
+
+func writeMinTable(b *strings.Builder, t *lnode) {
+	b.WriteByte('{')
+	for i, name := range t.names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeMinField(b, QuoteKey(name), t.fields[name])
+	}
+	b.WriteByte('}')
+}
+
+func writeMinValue(b *strings.Builder, val Node) {
+	switch v := val.(type) {
+	case *StringNode:
+		b.WriteString(minString(v.Value()))
+	case *NumberNode:
+		b.WriteString(minNumber(v))
+	case *ArrayNode:
+		b.WriteByte('[')
+		for i, elem := range v.elements {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeMinValue(b, elem)
+		}
+		b.WriteByte(']')
+	case *InlineTableNode:
+		t := newLTable()
+		addLogicalEntries(t, inlineEntries(v))
+		writeMinTable(b, t)
+	default:
+		b.WriteString(val.Text())
+	}
+}
+
+func inlineEntries(it *InlineTableNode) []Node {
+	out := make([]Node, len(it.entries))
+	for i, kv := range it.entries {
+		out[i] = kv
+	}
+	return out
+}
+
+// minString returns the shorter of the literal and basic forms of s.
+func minString(s string) string {
+	basic := NewString(s).Text()
+	if len(basic) == len(s)+2 || strings.ContainsAny(s, "'\n\r") || strings.ContainsFunc(s, isControl) {
+		return basic
+	}
+	return "'" + s + "'"
+}
+
+func isControl(r rune) bool {
+	return (r < 0x20 && r != '\t') || r == 0x7f
+}
+
+// minNumber drops underscores and a leading plus sign, and writes integers
+// in decimal if that is shorter.
+func minNumber(n *NumberNode) string {
+	text := strings.TrimPrefix(strings.ReplaceAll(n.text, "_", ""), "+")
+	if i, err := n.Int(); err == nil {
+		if dec := strconv.FormatInt(i, 10); len(dec) < len(text) {
+			return dec
+		}
+	}
+	return text
+}
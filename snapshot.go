@@ -0,0 +1,234 @@
+package toml
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SnapshotValue is a value of a document as plain data, for services that
+// ship parsed configuration over RPC. Its fields mirror the messages in
+// snapshot.proto, so it converts field for field to the generated types,
+// and integers, floats, and datetimes keep their TOML types and precision
+// instead of going through JSON numbers.
+//
+// Type says which fields are set: String for strings, Integer, Float,
+// Boolean, String and DateTimeKind for datetimes, which are kept as
+// written, Elements for arrays and arrays of tables, and Fields for
+// tables, in document order. Extension values have Type TypeAny and
+// their text in String.
+type SnapshotValue struct {
+	Type         ValueType        `json:"type"`
+	String       string           `json:"string,omitempty"`
+	Integer      int64            `json:"integer,omitempty"`
+	Float        float64          `json:"float,omitempty"`
+	Boolean      bool             `json:"boolean,omitempty"`
+	DateTimeKind DateTimeKind     `json:"dateTimeKind,omitempty"`
+	Elements     []*SnapshotValue `json:"elements,omitempty"`
+	Fields       []*SnapshotField `json:"fields,omitempty"`
+
+	// Source is where the value is defined in the document's text: its
+	// key-value, or for array elements the element itself. A table's is
+	// the first header or key that defines or implies it. It is nil for
+	// the root table and for values built by hand.
+	Source *SnapshotSource `json:"source,omitempty"`
+}
+
+// SnapshotField is a key of a table in a snapshot.
+type SnapshotField struct {
+	Key   string         `json:"key"`
+	Value *SnapshotValue `json:"value"`
+}
+
+// SnapshotSource is a position in the text a snapshot was taken from, as
+// in Position.
+type SnapshotSource struct {
+	Line   int32 `json:"line"`
+	Column int32 `json:"column"`
+}
+
+// Snapshot returns the document's values as a tree of SnapshotValue, with
+// the root table at the top. Each value records the position where it is
+// defined in the text produced by String. The snapshot shares nothing with
+// the document.
+func (d *Document) Snapshot() *SnapshotValue {
+	s := &snapshotter{lines: lineStarts(d.String()), spans: d.Spans()}
+	return s.table(d.logicalRoot())
+}
+
+// snapshotter builds a snapshot, converting span offsets to positions.
+type snapshotter struct {
+	lines []int
+	spans map[Node]Span
+}
+
+func (s *snapshotter) pos(n Node) *SnapshotSource {
+	sp, ok := s.spans[n]
+	if !ok {
+		return nil
+	}
+	line := sort.SearchInts(s.lines, sp.Start+1) - 1
+	return &SnapshotSource{Line: int32(line + 1), Column: int32(sp.Start - s.lines[line] + 1)}
+}
+
+func (s *snapshotter) table(t *lnode) *SnapshotValue {
+	v := &SnapshotValue{Type: TypeTable}
+	if len(t.defs) > 0 {
+		if _, isDoc := t.defs[0].(*Document); !isDoc {
+			v.Source = s.pos(t.defs[0])
+		}
+	}
+	for _, name := range t.names {
+		v.Fields = append(v.Fields, &SnapshotField{Key: name, Value: s.node(t.fields[name])})
+	}
+	return v
+}
+
+func (s *snapshotter) node(n *lnode) *SnapshotValue {
+	switch n.kind { //nolint:exhaustive
+	case TypeTable:
+		return s.table(n)
+	case TypeArrayOfTables:
+		v := &SnapshotValue{Type: TypeArrayOfTables}
+		if len(n.defs) > 0 {
+			v.Source = s.pos(n.defs[0])
+		}
+		for _, e := range n.entries {
+			v.Elements = append(v.Elements, s.table(e))
+		}
+		return v
+	}
+	v := s.value(n.kv.val)
+	v.Source = s.pos(n.kv)
+	return v
+}
+
+// value returns the snapshot of a value node, positioned at the node.
+func (s *snapshotter) value(val Node) *SnapshotValue {
+	v := &SnapshotValue{Type: valueTypeOf(val), Source: s.pos(val)}
+	switch n := val.(type) {
+	case *StringNode:
+		v.String = n.Value()
+	case *NumberNode:
+		if i, err := n.Int(); err == nil {
+			v.Integer = i
+		} else {
+			v.Float, _ = n.Float()
+		}
+	case *BooleanNode:
+		v.Boolean = n.Value()
+	case *DateTimeNode:
+		v.String, v.DateTimeKind = n.text, n.Kind()
+	case *ArrayNode:
+		for _, e := range n.elements {
+			v.Elements = append(v.Elements, s.value(e))
+		}
+	case *InlineTableNode:
+		t := newLTable()
+		addLogicalEntries(t, inlineEntries(n))
+		v.Fields = s.table(t).Fields
+	default:
+		v.Type, v.String = TypeAny, val.Text()
+	}
+	return v
+}
+
+// Document builds a document from a snapshot of a table, the reverse of
+// Snapshot. The values are laid out as by Unflatten: tables get headers,
+// arrays of tables get one header per entry, and every other value is
+// written inline. Comments and formatting are not part of a snapshot, so
+// they are lost. It fails with ErrTypeMismatch if v is not a table, and
+// with a parse error if a value does not make valid TOML, such as a
+// malformed datetime.
+func (v *SnapshotValue) Document() (*Document, error) {
+	if v == nil || v.Type != TypeTable {
+		return nil, fmt.Errorf("%w: snapshot is not a table", ErrTypeMismatch)
+	}
+	var b strings.Builder
+	if err := writeSnapshotFlat(&b, nil, v); err != nil {
+		return nil, err
+	}
+	doc, err := ParseWithOptions([]byte(b.String()), ParseOptions{Templates: true})
+	if err != nil {
+		return nil, err
+	}
+	return doc.Unflatten(0), nil
+}
+
+// writeSnapshotFlat writes the fields of table t as top-level dotted keys,
+// for Unflatten to group under headers.
+func writeSnapshotFlat(b *strings.Builder, path []string, t *SnapshotValue) error {
+	for _, f := range t.Fields {
+		if f == nil || f.Value == nil {
+			return fmt.Errorf("%w: missing value in snapshot", ErrTypeMismatch)
+		}
+		p := append(append([]string(nil), path...), f.Key)
+		if f.Value.Type == TypeTable && len(f.Value.Fields) > 0 {
+			if err := writeSnapshotFlat(b, p, f.Value); err != nil {
+				return err
+			}
+			continue
+		}
+		b.WriteString(JoinPath(p...) + " = ")
+		if err := writeSnapshotValue(b, f.Value); err != nil {
+			return err
+		}
+		b.WriteString("\n")
+	}
+	return nil
+}
+
+// writeSnapshotValue writes v as an inline TOML value.
+func writeSnapshotValue(b *strings.Builder, v *SnapshotValue) error {
+	switch v.Type { //nolint:exhaustive
+	case TypeString:
+		b.WriteString(NewString(v.String).Text())
+	case TypeInteger:
+		b.WriteString(strconv.FormatInt(v.Integer, 10))
+	case TypeFloat:
+		b.WriteString(NewFloat(v.Float).Text())
+	case TypeBoolean:
+		b.WriteString(strconv.FormatBool(v.Boolean))
+	case TypeDateTime, TypeAny:
+		b.WriteString(v.String)
+	case TypeArray, TypeArrayOfTables:
+		return writeSnapshotList(b, "[", v.Elements, "]", func(e *SnapshotValue) error {
+			return writeSnapshotValue(b, e)
+		})
+	case TypeTable:
+		if len(v.Fields) == 0 {
+			b.WriteString("{}")
+			return nil
+		}
+		return writeSnapshotList(b, "{ ", v.Fields, " }", func(f *SnapshotField) error {
+			if f.Value == nil {
+				return fmt.Errorf("%w: missing value for %s in snapshot", ErrTypeMismatch, f.Key)
+			}
+			b.WriteString(QuoteKey(f.Key) + " = ")
+			return writeSnapshotValue(b, f.Value)
+		})
+	default:
+		return fmt.Errorf("%w: unknown snapshot type %d", ErrTypeMismatch, v.Type)
+	}
+	return nil
+}
+
+// writeSnapshotList writes items between open and closing, separated by
+// commas. Nil items are an error.
+func writeSnapshotList[T any](b *strings.Builder, open string, items []*T, closing string, write func(*T) error) error {
+	b.WriteString(open)
+	for i, item := range items {
+		if item == nil {
+			return fmt.Errorf("%w: missing value in snapshot", ErrTypeMismatch)
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if err := write(item); err != nil {
+			return err
+		}
+	}
+	b.WriteString(closing)
+	return nil
+}
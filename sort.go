@@ -0,0 +1,160 @@
+package toml
+
+import (
+	"slices"
+	"strings"
+)
+
+// KeyLess reports whether key segment a sorts before key segment b.
+// Dotted keys are compared one segment at a time using the unquoted names,
+// and a key sorts before any longer key it is a prefix of.
+type KeyLess func(a, b string) bool
+
+// ByteOrder compares keys byte-wise, which is also Unicode code point order.
+func ByteOrder(a, b string) bool { return a < b }
+
+// NaturalOrder compares runs of ASCII digits by numeric value, so "server2"
+// sorts before "server10". Other bytes are compared byte-wise. Equal numbers
+// written with fewer leading zeros sort first.
+func NaturalOrder(a, b string) bool {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, restA := splitDigitRun(a)
+			nb, restB := splitDigitRun(b)
+			if c := compareDigitRuns(na, nb); c != 0 {
+				return c < 0
+			}
+			a, b = restA, restB
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// FoldCase wraps less so that keys are compared case-insensitively.
+// Keys that differ only in case fall back to byte order so sorting stays
+// deterministic.
+func FoldCase(less KeyLess) KeyLess {
+	return func(a, b string) bool {
+		la, lb := strings.ToLower(a), strings.ToLower(b)
+		if la != lb {
+			return less(la, lb)
+		}
+		return a < b
+	}
+}
+
+func splitDigitRun(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func compareDigitRuns(a, b string) int {
+	ta, tb := strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(ta) != len(tb) {
+		return len(ta) - len(tb)
+	}
+	if c := strings.Compare(ta, tb); c != 0 {
+		return c
+	}
+	return len(a) - len(b)
+}
+
+// compareKeyParts orders two keys segment by segment using less.
+func compareKeyParts(a, b []KeyPart, less KeyLess) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		switch {
+		case less(a[i].Unquoted, b[i].Unquoted):
+			return -1
+		case less(b[i].Unquoted, a[i].Unquoted):
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+// sortKeyValueSlots stably reorders the KeyValue nodes in entries using less,
+// leaving any other nodes (comments, blank lines) in their positions. Each
+// KeyValue keeps its own leading and trailing trivia, and takes the newline
+// of the slot it moves to, so a last line without one and CRLF line
+// endings stay as they were.
+func sortKeyValueSlots(entries []Node, less KeyLess) {
+	var slots []int
+	var kvs []*KeyValue
+	var newlines []string
+	for i, e := range entries {
+		if kv, ok := e.(*KeyValue); ok {
+			slots = append(slots, i)
+			kvs = append(kvs, kv)
+			newlines = append(newlines, kv.newline)
+		}
+	}
+	slices.SortStableFunc(kvs, func(a, b *KeyValue) int {
+		return compareKeyParts(a.keyParts, b.keyParts, less)
+	})
+	for i, kv := range kvs {
+		entries[slots[i]] = kv
+		kv.newline = newlines[i]
+	}
+}
+
+// SortKeys reorders the table's key-values using less. Comments and blank
+// lines that are not attached to a key-value stay where they are.
+func (t *TableNode) SortKeys(less KeyLess) {
+	sortKeyValueSlots(t.entries, less)
+	touch(t)
+}
+
+// SortKeys reorders the array-of-tables entry's key-values using less.
+// Comments and blank lines that are not attached to a key-value stay where
+// they are.
+func (a *ArrayOfTables) SortKeys(less KeyLess) {
+	sortKeyValueSlots(a.entries, less)
+	touch(a)
+}
+
+// SortKeys reorders the inline table's entries using less. The separators
+// between entries keep their positions, so the layout is unchanged.
+func (n *InlineTableNode) SortKeys(less KeyLess) {
+	slices.SortStableFunc(n.entries, func(a, b *KeyValue) int {
+		return compareKeyParts(a.keyParts, b.keyParts, less)
+	})
+	n.regenerateText()
+	regenerateAncestorText(n)
+}
+
+// SortKeys reorders the key-values of the root table and of every table
+// and array-of-tables entry using less. Table headers keep their order.
+func (d *Document) SortKeys(less KeyLess) {
+	root := len(d.nodes)
+	for i, n := range d.nodes {
+		if _, ok := n.(*KeyValue); !ok && !isTriviaNode(n) {
+			root = i
+			break
+		}
+	}
+	sortKeyValueSlots(d.nodes[:root], less)
+	d.changed()
+	if root < len(d.nodes) {
+		for _, n := range d.nodes[:root] {
+			if kv, ok := n.(*KeyValue); ok && kv.newline == "" {
+				kv.newline = "\n"
+			}
+		}
+	}
+	for _, n := range d.nodes[root:] {
+		switch v := n.(type) {
+		case *TableNode:
+			v.SortKeys(less)
+		case *ArrayOfTables:
+			v.SortKeys(less)
+		}
+	}
+}
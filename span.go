@@ -0,0 +1,125 @@
+package toml
+
+// Span is a half-open byte range [Start, End) in a document's source text.
+type Span struct {
+	Start int
+	End   int
+}
+
+// Contains reports whether offset lies within the span. An empty span
+// contains its start offset.
+func (s Span) Contains(offset int) bool {
+	return offset >= s.Start && (offset < s.End || offset == s.Start)
+}
+
+// TextEdit replaces the text in Span, measured in the text before the edit,
+// with NewText.
+type TextEdit struct {
+	Span    Span
+	NewText string
+}
+
+// Spans returns the byte span of every node in the document, measured in
+// the text produced by String. For parsed, unmodified documents this is the
+// original source. A node's span covers its Text: a key-value spans its key
+// through its value, and a table header spans its brackets, excluding
+// trivia and entries.
+func (d *Document) Spans() map[Node]Span {
+	s := &spanBuilder{spans: make(map[Node]Span)}
+	s.trivia(d.prologue)
+	for _, n := range d.nodes {
+		s.node(n)
+	}
+	s.trivia(d.epilogue)
+	s.spans[d] = Span{0, s.off}
+	return s.spans
+}
+
+// spanBuilder assigns offsets by replaying the serialization order.
+type spanBuilder struct {
+	off   int
+	spans map[Node]Span
+}
+
+func (s *spanBuilder) node(n Node) {
+	switch v := n.(type) {
+	case *KeyValue:
+		s.keyValue(v)
+	case *TableNode:
+		s.header(v, v.leading(), len(v.rawHeader)+2, v.trailing(), v.newline, v.entries)
+		s.trivia(v.bodyTrivia)
+	case *ArrayOfTables:
+		s.header(v, v.leading(), len(v.rawHeader)+4, v.trailing(), v.newline, v.entries)
+		s.trivia(v.bodyTrivia)
+	default:
+		s.leaf(n)
+	}
+}
+
+func (s *spanBuilder) leaf(n Node) {
+	start := s.off
+	s.off += len(n.Text())
+	s.spans[n] = Span{start, s.off}
+}
+
+func (s *spanBuilder) trivia(nodes []Node) {
+	for _, n := range nodes {
+		s.leaf(n)
+	}
+}
+
+func (s *spanBuilder) header(n Node, leading []Node, width int, trailing []Node, newline string, entries []Node) {
+	s.trivia(leading)
+	s.spans[n] = Span{s.off, s.off + width}
+	s.off += width
+	s.trivia(trailing)
+	s.off += len(newline)
+	for _, e := range entries {
+		s.node(e)
+	}
+}
+
+func (s *spanBuilder) keyValue(kv *KeyValue) {
+	s.trivia(kv.leading())
+	start := s.off
+	s.off += len(kv.rawKey) + len(kv.preEq) + 1 + len(kv.postEq)
+	if kv.val != nil {
+		s.value(kv.val)
+	}
+	s.spans[kv] = Span{start, s.off}
+	s.trivia(kv.trailing())
+	s.off += len(kv.newline)
+}
+
+func (s *spanBuilder) value(v Node) {
+	start := s.off
+	switch c := v.(type) {
+	case *ArrayNode:
+		s.off++
+		for i, e := range c.elements {
+			s.separator(c.seps, len(c.elements), i)
+			s.value(e)
+		}
+	case *InlineTableNode:
+		s.off++
+		for i, kv := range c.entries {
+			s.separator(c.seps, len(c.entries), i)
+			s.keyValue(kv)
+		}
+	}
+	// Resynchronize on the node's own text so that a container whose
+	// layout cannot be replayed still gets a correct outer span.
+	s.off = start + len(v.Text())
+	s.spans[v] = Span{start, s.off}
+}
+
+// separator advances past the text that renderContainer writes before
+// item i of n.
+func (s *spanBuilder) separator(seps []string, n, i int) {
+	switch {
+	case len(seps) == n+1:
+		s.off += len(seps[i])
+	case i > 0:
+		s.off += len(", ")
+	}
+}
@@ -0,0 +1,315 @@
+package toml
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Extract returns a new document holding only the table at path, with
+// its keys and subtables rebased to the root: extracting "server" from
+//
+//	[server]
+//	host = "localhost"
+//	[server.tls]
+//	cert = "a.pem"
+//
+// gives `host = "localhost"` and a [tls] table. The table may be defined by
+// a header, by dotted keys, or inline; its comments, blank lines, and the
+// formatting of its entries are kept, as are the comments above its own
+// header. Keys defined in the document root come before any table in the
+// result. It fails with ErrKeyNotFound if there is no such table, and with
+// ErrTypeMismatch if path names a value, an array of tables, or a table
+// inside one.
+func (d *Document) Extract(path string) (*Document, error) {
+	segs := parseDottedPath(path)
+	if err := d.checkTablePath(path, segs); err != nil {
+		return nil, err
+	}
+	x := &extractor{segs: segs}
+	for _, n := range d.nodes {
+		switch v := n.(type) {
+		case *KeyValue:
+			x.keyValue(nil, v, false)
+		case *TableNode:
+			x.section(v, v.leading(), v.headerParts, v.entries)
+		case *ArrayOfTables:
+			x.section(v, v.leading(), v.headerParts, v.entries)
+		}
+	}
+	endLine(&x.root)
+	return Parse([]byte(strings.TrimLeft(x.root.String()+x.tables.String(), "\r\n")))
+}
+
+// checkTablePath reports whether segs names a table that is not inside an
+// array of tables.
+func (d *Document) checkTablePath(path string, segs []string) error {
+	if len(segs) == 0 {
+		return fmt.Errorf("%w: empty path", ErrKeyNotFound)
+	}
+	n := d.logicalRoot()
+	for i, s := range segs {
+		n = n.child(s)
+		if n == nil {
+			return fmt.Errorf("%w: %s", ErrKeyNotFound, path)
+		}
+		if n.kind != TypeTable {
+			return fmt.Errorf("%w: %s is %s, not table", ErrTypeMismatch, JoinPath(segs[:i+1]...), n.kind)
+		}
+	}
+	return nil
+}
+
+// extractor collects the text of an extracted table: the key-values of its
+// root, and the sections below it.
+type extractor struct {
+	segs         []string
+	root, tables strings.Builder
+}
+
+// section adds the part of a table or array-of-tables section under the
+// extracted path.
+func (x *extractor) section(n Node, leading []Node, parts []KeyPart, entries []Node) {
+	header := partsToSegs(parts)
+	switch {
+	case len(header) > len(x.segs) && isPrefix(x.segs, header):
+		endLine(&x.tables)
+		serializeNode(&x.tables, withHeader(n, len(x.segs), nil))
+	case slices.Equal(header, x.segs):
+		endLine(&x.root)
+		serializeTrivia(&x.root, leading)
+		for _, e := range entries {
+			serializeNode(&x.root, e)
+		}
+		serializeTrivia(&x.root, *bodyTriviaOf(n))
+	case isPrefix(header, x.segs):
+		for kv := range keyValuesSeq(entries) {
+			x.keyValue(header, kv, false)
+		}
+	}
+}
+
+// keyValue adds kv, in the section or inline table at prefix, if it lies
+// under the extracted path. An inline table holding the path is descended
+// into.
+func (x *extractor) keyValue(prefix []string, kv *KeyValue, inInline bool) {
+	full := append(slices.Clone(prefix), partsToSegs(kv.keyParts)...)
+	it, inline := kv.val.(*InlineTableNode)
+	switch {
+	case len(full) > len(x.segs) && isPrefix(x.segs, full):
+		c := *kv
+		c.keyParts, c.rawKey = rebaseParts(kv.keyParts, len(x.segs)-len(prefix), nil)
+		if inInline {
+			c.lineTrivia, c.newline = lineTrivia{}, "\n"
+		}
+		endLine(&x.root)
+		serializeKeyValue(&x.root, &c)
+	case inline && isPrefix(full, x.segs):
+		for _, e := range it.entries {
+			x.keyValue(full, e, true)
+		}
+	}
+}
+
+// endLine ends the text in b with a newline if it does not already.
+func endLine(b *strings.Builder) {
+	endLineWith(b, "\n")
+}
+
+// endLineWith is endLine with the line break nl.
+func endLineWith(b *strings.Builder, nl string) {
+	if s := b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		b.WriteString(nl)
+	}
+}
+
+// rebaseParts replaces the first drop parts of a key with prefix, and
+// returns the new parts and their raw text. The spacing around the
+// remaining dots is kept.
+func rebaseParts(parts []KeyPart, drop int, prefix []KeyPart) ([]KeyPart, string) {
+	out := append(slices.Clone(prefix), parts[drop:]...)
+	if len(out) > len(prefix) {
+		out[len(prefix)].DotBefore, out[len(prefix)].DotAfter = "", ""
+	}
+	var raw strings.Builder
+	for i, p := range out {
+		if i > 0 {
+			raw.WriteString(p.DotBefore + "." + p.DotAfter)
+		}
+		raw.WriteString(p.Text)
+	}
+	return out, raw.String()
+}
+
+// withHeader returns a copy of a table or array-of-tables section with
+// its header rebased as by rebaseParts. The copy shares the section's
+// trivia and entries.
+func withHeader(n Node, drop int, prefix []KeyPart) Node {
+	switch v := n.(type) {
+	case *TableNode:
+		c := *v
+		c.setHeader(rebaseParts(v.headerParts, drop, prefix))
+		return &c
+	case *ArrayOfTables:
+		c := *v
+		c.setHeader(rebaseParts(v.headerParts, drop, prefix))
+		return &c
+	}
+	return n
+}
+
+// setHeader replaces the header's key, keeping the spacing inside the
+// brackets.
+func (t *TableNode) setHeader(parts []KeyPart, raw string) {
+	t.headerParts, t.rawHeader = parts, respaceHeader(t.rawHeader, raw)
+}
+
+// setHeader replaces the header's key, keeping the spacing inside the
+// brackets.
+func (a *ArrayOfTables) setHeader(parts []KeyPart, raw string) {
+	a.headerParts, a.rawHeader = parts, respaceHeader(a.rawHeader, raw)
+}
+
+// respaceHeader returns raw with the whitespace that surrounds the key in
+// the header text old.
+func respaceHeader(old, raw string) string {
+	key := strings.TrimSpace(old)
+	i := strings.Index(old, key)
+	return old[:i] + raw + old[i+len(key):]
+}
+
+// Graft copies sub into the document as the table at path, the inverse of
+// Extract: sub's root key-values go in the table at path, and its headers
+// are rebased under path, so that grafting a document with a [tls] table
+// at "server" adds [server.tls]. The root key-values are appended to the
+// table's section if it has one, and otherwise under a new [path] header
+// at the end of the document, followed by sub's tables. Comments and
+// formatting are kept, and sub is not changed. If the result would be
+// invalid, for example because a grafted key is already set, the document
+// is left unchanged and the validation error is returned.
+func (d *Document) Graft(path string, sub *Document) error {
+	prefix, raw, err := parseRawKey(path)
+	if err != nil {
+		return err
+	}
+	var root, tables strings.Builder
+	hasKeys := false
+	for _, n := range sub.nodes {
+		switch n.(type) {
+		case *TableNode, *ArrayOfTables:
+			endLine(&tables)
+			serializeNode(&tables, withHeader(n, 0, prefix))
+			continue
+		case *KeyValue:
+			hasKeys = true
+		}
+		serializeNode(&root, n)
+	}
+	endLine(&root)
+	body := root.String()
+	t := d.table(partsToSegs(prefix))
+	if t == nil && hasKeys {
+		body = "[" + raw + "]\n" + body
+	}
+	snap := d.snapshotStructure()
+	if err := d.graft(t, body, tables.String()); err != nil {
+		snap.restore()
+		return err
+	}
+	return nil
+}
+
+// graft appends the key-values in body to t, or the nodes of body to the
+// document if t is nil, then the nodes of tables, and validates the
+// result.
+func (d *Document) graft(t *TableNode, body, tables string) error {
+	text := tables
+	if t == nil {
+		text = body + tables
+	}
+	doc, err := Parse([]byte(text))
+	if err != nil {
+		return err
+	}
+	if d.endsMidLine() {
+		d.endWithNewline()
+	}
+	if t != nil {
+		kvs, err := Parse([]byte(body))
+		if err != nil {
+			return err
+		}
+		for _, n := range slices.Concat(kvs.prologue, kvs.nodes, kvs.epilogue) {
+			t.entries = append(t.entries, n)
+			setNodeParent(n, t)
+		}
+	}
+	for _, n := range slices.Concat(doc.prologue, doc.nodes, doc.epilogue) {
+		d.nodes = append(d.nodes, n)
+		setNodeParent(n, d)
+	}
+	return d.validateMutation()
+}
+
+// endsMidLine reports whether the document's text before its epilogue is
+// not empty and does not end with a newline.
+func (d *Document) endsMidLine() bool {
+	var b strings.Builder
+	serializeTrivia(&b, d.prologue)
+	for _, n := range d.nodes {
+		serializeNode(&b, n)
+	}
+	s := b.String()
+	return s != "" && !strings.HasSuffix(s, "\n")
+}
+
+// endWithNewline adds a newline to the end of the last section.
+func (d *Document) endWithNewline() {
+	var parent Node = d
+	if len(d.nodes) > 0 && entriesOf(d.nodes[len(d.nodes)-1]) != nil {
+		parent = d.nodes[len(d.nodes)-1]
+	}
+	nl := &WhitespaceNode{leafNode: newLeaf("\n")}
+	list := entriesOf(parent)
+	if body := bodyTriviaOf(parent); body != nil && len(*body) > 0 {
+		list = body
+	}
+	*list = append(*list, nl)
+	nl.setParent(parent)
+	d.changed()
+}
+
+// Rebase moves everything in the document under prefix, a dotted key:
+// headers gain the prefix, so that [server] becomes [app.server], and
+// key-values before the first header become dotted keys, so that
+// name = "x" becomes app.name = "x". Formatting and comments are kept.
+// It is meant for consolidating several files into one, together with
+// AppendRaw or Graft. If the result would be invalid the document is left
+// unchanged and the validation error is returned.
+func (d *Document) Rebase(prefix string) error {
+	parts, _, err := parseRawKey(prefix)
+	if err != nil {
+		return err
+	}
+	d.rebase(0, parts)
+	if err := d.validateMutation(); err != nil {
+		d.rebase(len(parts), nil)
+		return err
+	}
+	return nil
+}
+
+// rebase replaces the first drop parts of every top-level key and header
+// with prefix.
+func (d *Document) rebase(drop int, prefix []KeyPart) {
+	for _, n := range d.nodes {
+		switch v := n.(type) {
+		case *KeyValue:
+			v.keyParts, v.rawKey = rebaseParts(v.keyParts, drop, prefix)
+		case *TableNode:
+			v.setHeader(rebaseParts(v.headerParts, drop, prefix))
+		case *ArrayOfTables:
+			v.setHeader(rebaseParts(v.headerParts, drop, prefix))
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package toml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NodeTemplate is the node type of TemplateNode.
+var NodeTemplate = RegisterNodeType("Template")
+
+// TemplateNode is a template action such as {{ .Values.port }}, kept as
+// opaque text. It is produced when parsing with ParseOptions.Templates, as
+// a value or as trivia for an action on a line of its own, and can be
+// built with NewTemplate. As a value it is an Extension of type TypeAny.
+type TemplateNode struct{ leafNode }
+
+// NewTemplate creates a TemplateNode. text must start with "{{", end with
+// "}}", and contain no other "}}".
+func NewTemplate(text string) (*TemplateNode, error) {
+	if !strings.HasPrefix(text, "{{") || strings.Index(text, "}}") != len(text)-2 {
+		return nil, fmt.Errorf("%w: template action %q", ErrInvalidValueType, text)
+	}
+	return &TemplateNode{leafNode: newLeaf(text)}, nil
+}
+
+// Type returns NodeTemplate.
+func (n *TemplateNode) Type() NodeType { return NodeTemplate }
+
+// SetParent records the node's parent.
+func (n *TemplateNode) SetParent(p Node) { n.setParent(p) }
+
+// ValueType returns TypeAny: the value is not known until the template is
+// rendered.
+func (n *TemplateNode) ValueType() ValueType { return TypeAny }
+
+// Validate returns nil.
+func (n *TemplateNode) Validate() error { return nil }
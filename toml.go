@@ -1,32 +1,46 @@
 package toml
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"iter"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // Sentinel errors.
 var (
-	ErrNilInput          = errors.New("nil input")
-	ErrEmptyKey          = errors.New("empty key")
-	ErrUnexpectedContent = errors.New("unexpected content after key")
-	ErrNilValue          = errors.New("nil value")
-	ErrInvalidValueType  = errors.New("invalid value type")
-	ErrNilNode           = errors.New("nil node")
-	ErrInvalidNodeType   = errors.New("invalid document node type")
-	ErrInvalidDateTime   = errors.New("invalid datetime")
-	ErrNilEntry          = errors.New("nil key-value")
-	ErrDuplicateKey      = errors.New("duplicate key")
-	ErrKeyConflict       = errors.New("key conflicts with dotted key")
-	ErrIndexOutOfRange   = errors.New("index out of range")
-	ErrInvalidWhitespace = errors.New("invalid whitespace: must contain only spaces and tabs")
-	ErrInvalidNewline    = errors.New("invalid newline: must be empty, \\n, or \\r\\n")
-	ErrInvalidTrivia     = errors.New("invalid trivia node: must be *CommentNode or *WhitespaceNode")
-	ErrCommentNewline    = errors.New("comment text must not contain newlines")
-	ErrCommentControl    = errors.New("comment text contains invalid control character")
-	ErrInvalidWsChar     = errors.New("whitespace text contains non-whitespace character")
+	ErrNilInput             = errors.New("nil input")
+	ErrEmptyKey             = errors.New("empty key")
+	ErrUnexpectedContent    = errors.New("unexpected content after key")
+	ErrNilValue             = errors.New("nil value")
+	ErrInvalidValueType     = errors.New("invalid value type")
+	ErrNilNode              = errors.New("nil node")
+	ErrInvalidNodeType      = errors.New("invalid document node type")
+	ErrInvalidDateTime      = errors.New("invalid datetime")
+	ErrNilEntry             = errors.New("nil key-value")
+	ErrDuplicateKey         = errors.New("duplicate key")
+	ErrKeyConflict          = errors.New("key conflicts with dotted key")
+	ErrIndexOutOfRange      = errors.New("index out of range")
+	ErrInvalidWhitespace    = errors.New("invalid whitespace: must contain only spaces and tabs")
+	ErrInvalidNewline       = errors.New("invalid newline: must be empty, \\n, or \\r\\n")
+	ErrInvalidTrivia        = errors.New("invalid trivia node: must be *CommentNode or *WhitespaceNode")
+	ErrCommentNewline       = errors.New("comment text must not contain newlines")
+	ErrCommentControl       = errors.New("comment text contains invalid control character")
+	ErrInvalidWsChar        = errors.New("whitespace text contains non-whitespace character")
+	ErrNotDecimal           = errors.New("number has no exact decimal representation")
+	ErrNodeAlreadyAttached  = errors.New("node is already attached; detach it first")
+	ErrKeyNotFound          = errors.New("key not found")
+	ErrTypeMismatch         = errors.New("type mismatch")
+	ErrNoChecksum           = errors.New("no checksum line")
+	ErrChecksumMismatch     = errors.New("checksum mismatch")
+	ErrInvalidConfigMapKey  = errors.New("invalid ConfigMap key")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrGeneratedFile        = errors.New("generated file")
+	ErrConstraint           = errors.New("constraint violated")
 )
 
 // ParseError represents a parsing error with location information.
@@ -35,27 +49,40 @@ type ParseError struct {
 	Line    int
 	Column  int
 	Source  string
+	// Hint briefly explains the rule that was broken, if known.
+	Hint string
+	// Suggestions lists existing keys or tables close to the one in error,
+	// nearest first, for key-related errors.
+	Suggestions []string
+	// Token is the offending source text: the unexpected token for syntax
+	// errors, or the key or table header for semantic errors. It is empty
+	// at end of input.
+	Token string
+	// Span is the byte range of Token in Source.
+	Span Span
+	// Err is the error returned by a ValueValidator, if one rejected the
+	// value.
+	Err error
 }
 
 func (e *ParseError) Error() string {
-	lines := strings.Split(e.Source, "\n")
-	if e.Line < 1 || e.Line > len(lines) {
-		return fmt.Sprintf("parse error at line %d: %s", e.Line, e.Message)
-	}
-	lineContent := lines[e.Line-1]
-	var buf strings.Builder
-	fmt.Fprintf(&buf, "parse error at line %d, column %d: %s\n", e.Line, e.Column, e.Message)
-	fmt.Fprintf(&buf, "  %d | %s\n", e.Line, lineContent)
-	buf.WriteString("    | ")
-	for i := 1; i < e.Column; i++ {
-		if i-1 < len(lineContent) && lineContent[i-1] == '\t' {
-			buf.WriteByte('\t')
-		} else {
-			buf.WriteByte(' ')
-		}
+	return e.Render(ErrorRenderOptions{})
+}
+
+// Unwrap returns Err.
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// Summary returns the message followed by any suggestions, without
+// location or source excerpt.
+func (e *ParseError) Summary() string {
+	if len(e.Suggestions) == 0 {
+		return e.Message
+	}
+	quoted := make([]string, len(e.Suggestions))
+	for i, s := range e.Suggestions {
+		quoted[i] = strconv.Quote(s)
 	}
-	buf.WriteString("^\n")
-	return buf.String()
+	return e.Message + "; did you mean " + strings.Join(quoted, " or ") + "?"
 }
 
 // NodeType identifies node kinds in the CST.
@@ -86,15 +113,86 @@ type Node interface {
 	Text() string
 }
 
-// baseNode provides shared parent tracking for all nodes.
+// baseNode provides shared parent tracking for all nodes. It is embedded
+// in every leaf, so it holds only what every node needs: each type reports
+// its own NodeType, source positions live in srcPos, annotations in a side
+// table, and the trivia around a line in lineTrivia.
 type baseNode struct {
-	parent   Node
-	nodeType NodeType
-	line     int
-	col      int
+	parent Node
+}
+
+// srcPos is where a parsed key-value or header starts in the source, for
+// error messages. It is zero for nodes built in code.
+type srcPos struct {
+	line, col int32
+}
+
+func (p *srcPos) lineCol() (int, int) { return int(p.line), int(p.col) }
+
+// lineTrivia holds the trivia around the line of a key-value or header:
+// the comments and blank lines before it and the whitespace and comment
+// after it on the same line. Most lines of a bulk document have none, so
+// the lists live in a side record that only lines with trivia allocate.
+type lineTrivia struct {
+	lists *triviaLists
+}
+
+type triviaLists struct {
+	leading, trailing []Node
+}
+
+func newLineTrivia(leading, trailing []Node) lineTrivia {
+	if len(leading) == 0 && len(trailing) == 0 {
+		return lineTrivia{}
+	}
+	return lineTrivia{&triviaLists{leading, trailing}}
+}
+
+// leading returns the leading trivia. l may be nil, as lineTriviaOf
+// returns for nodes that have no line trivia.
+func (l *lineTrivia) leading() []Node {
+	if l == nil || l.lists == nil {
+		return nil
+	}
+	return l.lists.leading
+}
+
+func (l *lineTrivia) trailing() []Node {
+	if l == nil || l.lists == nil {
+		return nil
+	}
+	return l.lists.trailing
+}
+
+func (l *lineTrivia) setLeading(nodes []Node) {
+	if l.lists != nil || len(nodes) > 0 {
+		*l.leadingList() = nodes
+	}
+}
+
+func (l *lineTrivia) setTrailing(nodes []Node) {
+	if l.lists != nil || len(nodes) > 0 {
+		*l.trailingList() = nodes
+	}
+}
+
+// leadingList returns the leading trivia for editing in place, allocating
+// the side record if there is none.
+func (l *lineTrivia) leadingList() *[]Node {
+	if l.lists == nil {
+		l.lists = &triviaLists{}
+	}
+	return &l.lists.leading
+}
+
+// trailingList is leadingList for the trailing trivia.
+func (l *lineTrivia) trailingList() *[]Node {
+	if l.lists == nil {
+		l.lists = &triviaLists{}
+	}
+	return &l.lists.trailing
 }
 
-func (b *baseNode) Type() NodeType   { return b.nodeType }
 func (b *baseNode) Parent() Node     { return b.parent }
 func (b *baseNode) setParent(p Node) { b.parent = p }
 
@@ -118,8 +216,17 @@ type PunctNode struct{ leafNode }
 type CommentNode struct{ leafNode }
 type WhitespaceNode struct{ leafNode }
 
-func newLeaf(nodeType NodeType, text string) leafNode {
-	return leafNode{baseNode: baseNode{nodeType: nodeType}, text: text}
+func (n *IdentifierNode) Type() NodeType { return NodeIdentifier }
+func (n *StringNode) Type() NodeType     { return NodeString }
+func (n *NumberNode) Type() NodeType     { return NodeNumber }
+func (n *BooleanNode) Type() NodeType    { return NodeBoolean }
+func (n *DateTimeNode) Type() NodeType   { return NodeDateTime }
+func (n *PunctNode) Type() NodeType      { return NodePunctuation }
+func (n *CommentNode) Type() NodeType    { return NodeComment }
+func (n *WhitespaceNode) Type() NodeType { return NodeWhitespace }
+
+func newLeaf(text string) leafNode {
+	return leafNode{text: text}
 }
 
 // KeyPart represents one segment of a potentially dotted key.
@@ -134,15 +241,15 @@ type KeyPart struct {
 // KeyValue is a CST node for key = value pairs.
 type KeyValue struct {
 	baseNode
-	leadingTrivia  []Node    // whitespace/comments before the key
-	keyParts       []KeyPart // parsed segments of (possibly dotted) key
-	rawKey         string    // full raw key text as written (e.g. "a . b")
-	preEq          string    // whitespace between key and =
-	postEq         string    // whitespace between = and value
-	val            Node      // typed value node
-	rawVal         string    // raw value text as written
-	trailingTrivia []Node    // trailing comment/whitespace on same line
-	newline        string    // the line-ending newline if present
+	srcPos
+	lineTrivia
+	keyParts []KeyPart // parsed segments of (possibly dotted) key
+	rawKey   string    // full raw key text as written (e.g. "a . b")
+	preEq    string    // whitespace between key and =
+	postEq   string    // whitespace between = and value
+	val      Node      // typed value node
+	rawVal   string    // raw value text as written
+	newline  string    // the line-ending newline if present
 }
 
 // KeyParts returns a copy of the parsed key segments.
@@ -167,12 +274,12 @@ func (kv *KeyValue) RawVal() string {
 
 // LeadingTrivia returns a copy of the leading trivia nodes.
 func (kv *KeyValue) LeadingTrivia() []Node {
-	return append([]Node(nil), kv.leadingTrivia...)
+	return append([]Node(nil), kv.leading()...)
 }
 
 // TrailingTrivia returns a copy of the trailing trivia nodes.
 func (kv *KeyValue) TrailingTrivia() []Node {
-	return append([]Node(nil), kv.trailingTrivia...)
+	return append([]Node(nil), kv.trailing()...)
 }
 
 // PreEq returns the whitespace between key and =.
@@ -190,7 +297,9 @@ func (kv *KeyValue) SetLeadingTrivia(nodes []Node) error {
 	if err := validateTriviaNodes(nodes); err != nil {
 		return err
 	}
-	kv.leadingTrivia = append([]Node(nil), nodes...)
+	kv.setLeading(append([]Node(nil), nodes...))
+	adoptTrivia(kv, nodes)
+	touch(kv)
 	return nil
 }
 
@@ -200,7 +309,9 @@ func (kv *KeyValue) SetTrailingTrivia(nodes []Node) error {
 	if err := validateTriviaNodes(nodes); err != nil {
 		return err
 	}
-	kv.trailingTrivia = append([]Node(nil), nodes...)
+	kv.setTrailing(append([]Node(nil), nodes...))
+	adoptTrivia(kv, nodes)
+	touch(kv)
 	return nil
 }
 
@@ -233,16 +344,19 @@ func (kv *KeyValue) SetNewline(s string) error {
 		return ErrInvalidNewline
 	}
 	kv.newline = s
+	touch(kv)
 	return nil
 }
 
+func (kv *KeyValue) Type() NodeType { return NodeKeyValue }
+
 func (kv *KeyValue) Children() []Node {
 	var out []Node
-	out = append(out, kv.leadingTrivia...)
+	out = append(out, kv.leading()...)
 	if kv.val != nil {
 		out = append(out, kv.val)
 	}
-	out = append(out, kv.trailingTrivia...)
+	out = append(out, kv.trailing()...)
 	return out
 }
 
@@ -261,12 +375,13 @@ func (kv *KeyValue) Text() string {
 // TableNode represents [table.header] and holds child entries.
 type TableNode struct {
 	baseNode
-	leadingTrivia  []Node
-	rawHeader      string // full raw header text between brackets
-	headerParts    []KeyPart
-	trailingTrivia []Node // trivia after ] on the header line
-	newline        string
-	entries        []Node // child KeyValue nodes
+	srcPos
+	lineTrivia
+	rawHeader   string // full raw header text between brackets
+	headerParts []KeyPart
+	newline     string
+	entries     []Node // child KeyValue nodes
+	bodyTrivia  []Node // comments and blank lines after the last entry
 }
 
 // RawHeader returns the full raw header text between brackets.
@@ -284,14 +399,20 @@ func (t *TableNode) Entries() []Node {
 	return append([]Node(nil), t.entries...)
 }
 
+// KeyValuesSeq returns an iterator over the table's key-value entries,
+// skipping comments and blank lines. It does not copy the entries.
+func (t *TableNode) KeyValuesSeq() iter.Seq[*KeyValue] {
+	return keyValuesSeq(t.entries)
+}
+
 // LeadingTrivia returns a copy of the leading trivia nodes.
 func (t *TableNode) LeadingTrivia() []Node {
-	return append([]Node(nil), t.leadingTrivia...)
+	return append([]Node(nil), t.leading()...)
 }
 
 // TrailingTrivia returns a copy of the trailing trivia nodes.
 func (t *TableNode) TrailingTrivia() []Node {
-	return append([]Node(nil), t.trailingTrivia...)
+	return append([]Node(nil), t.trailing()...)
 }
 
 // Newline returns the line-ending newline.
@@ -302,7 +423,9 @@ func (t *TableNode) SetLeadingTrivia(nodes []Node) error {
 	if err := validateTriviaNodes(nodes); err != nil {
 		return err
 	}
-	t.leadingTrivia = append([]Node(nil), nodes...)
+	t.setLeading(append([]Node(nil), nodes...))
+	adoptTrivia(t, nodes)
+	touch(t)
 	return nil
 }
 
@@ -311,7 +434,27 @@ func (t *TableNode) SetTrailingTrivia(nodes []Node) error {
 	if err := validateTriviaNodes(nodes); err != nil {
 		return err
 	}
-	t.trailingTrivia = append([]Node(nil), nodes...)
+	t.setTrailing(append([]Node(nil), nodes...))
+	adoptTrivia(t, nodes)
+	touch(t)
+	return nil
+}
+
+// TrailingBodyTrivia returns a copy of the comments and blank lines
+// after the table's last entry, such as a comment closing the section.
+// Entries added with Append go before them.
+func (t *TableNode) TrailingBodyTrivia() []Node {
+	return append([]Node(nil), t.bodyTrivia...)
+}
+
+// SetTrailingBodyTrivia sets the trivia after the last entry.
+func (t *TableNode) SetTrailingBodyTrivia(nodes []Node) error {
+	if err := validateTriviaNodes(nodes); err != nil {
+		return err
+	}
+	t.bodyTrivia = append([]Node(nil), nodes...)
+	adoptTrivia(t, nodes)
+	touch(t)
 	return nil
 }
 
@@ -321,14 +464,18 @@ func (t *TableNode) SetNewline(s string) error {
 		return ErrInvalidNewline
 	}
 	t.newline = s
+	touch(t)
 	return nil
 }
 
+func (t *TableNode) Type() NodeType { return NodeTable }
+
 func (t *TableNode) Children() []Node {
 	var out []Node
-	out = append(out, t.leadingTrivia...)
+	out = append(out, t.leading()...)
 	out = append(out, t.entries...)
-	out = append(out, t.trailingTrivia...)
+	out = append(out, t.bodyTrivia...)
+	out = append(out, t.trailing()...)
 	return out
 }
 
@@ -339,12 +486,13 @@ func (t *TableNode) Text() string {
 // ArrayOfTables represents [[array.of.tables]] and holds child entries.
 type ArrayOfTables struct {
 	baseNode
-	leadingTrivia  []Node
-	rawHeader      string
-	headerParts    []KeyPart
-	trailingTrivia []Node
-	newline        string
-	entries        []Node
+	srcPos
+	lineTrivia
+	rawHeader   string
+	headerParts []KeyPart
+	newline     string
+	entries     []Node
+	bodyTrivia  []Node
 }
 
 // RawHeader returns the full raw header text between brackets.
@@ -362,14 +510,20 @@ func (a *ArrayOfTables) Entries() []Node {
 	return append([]Node(nil), a.entries...)
 }
 
+// KeyValuesSeq returns an iterator over the entry's key-value pairs,
+// skipping comments and blank lines. It does not copy the entries.
+func (a *ArrayOfTables) KeyValuesSeq() iter.Seq[*KeyValue] {
+	return keyValuesSeq(a.entries)
+}
+
 // LeadingTrivia returns a copy of the leading trivia nodes.
 func (a *ArrayOfTables) LeadingTrivia() []Node {
-	return append([]Node(nil), a.leadingTrivia...)
+	return append([]Node(nil), a.leading()...)
 }
 
 // TrailingTrivia returns a copy of the trailing trivia nodes.
 func (a *ArrayOfTables) TrailingTrivia() []Node {
-	return append([]Node(nil), a.trailingTrivia...)
+	return append([]Node(nil), a.trailing()...)
 }
 
 // Newline returns the line-ending newline.
@@ -380,7 +534,9 @@ func (a *ArrayOfTables) SetLeadingTrivia(nodes []Node) error {
 	if err := validateTriviaNodes(nodes); err != nil {
 		return err
 	}
-	a.leadingTrivia = append([]Node(nil), nodes...)
+	a.setLeading(append([]Node(nil), nodes...))
+	adoptTrivia(a, nodes)
+	touch(a)
 	return nil
 }
 
@@ -389,7 +545,27 @@ func (a *ArrayOfTables) SetTrailingTrivia(nodes []Node) error {
 	if err := validateTriviaNodes(nodes); err != nil {
 		return err
 	}
-	a.trailingTrivia = append([]Node(nil), nodes...)
+	a.setTrailing(append([]Node(nil), nodes...))
+	adoptTrivia(a, nodes)
+	touch(a)
+	return nil
+}
+
+// TrailingBodyTrivia returns a copy of the comments and blank lines
+// after the array-of-tables entry's last entry, such as a comment closing the section.
+// Entries added with Append go before them.
+func (a *ArrayOfTables) TrailingBodyTrivia() []Node {
+	return append([]Node(nil), a.bodyTrivia...)
+}
+
+// SetTrailingBodyTrivia sets the trivia after the last entry.
+func (a *ArrayOfTables) SetTrailingBodyTrivia(nodes []Node) error {
+	if err := validateTriviaNodes(nodes); err != nil {
+		return err
+	}
+	a.bodyTrivia = append([]Node(nil), nodes...)
+	adoptTrivia(a, nodes)
+	touch(a)
 	return nil
 }
 
@@ -399,14 +575,18 @@ func (a *ArrayOfTables) SetNewline(s string) error {
 		return ErrInvalidNewline
 	}
 	a.newline = s
+	touch(a)
 	return nil
 }
 
+func (a *ArrayOfTables) Type() NodeType { return NodeArrayOfTables }
+
 func (a *ArrayOfTables) Children() []Node {
 	var out []Node
-	out = append(out, a.leadingTrivia...)
+	out = append(out, a.leading()...)
 	out = append(out, a.entries...)
-	out = append(out, a.trailingTrivia...)
+	out = append(out, a.bodyTrivia...)
+	out = append(out, a.trailing()...)
 	return out
 }
 
@@ -418,7 +598,8 @@ func (a *ArrayOfTables) Text() string {
 type ArrayNode struct {
 	baseNode
 	elements []Node
-	text     string // raw source text
+	seps     []string // source text around elements (len(elements)+1), nil if constructed
+	text     string   // raw source text
 }
 
 // Elements returns a copy of the array element nodes.
@@ -426,6 +607,19 @@ func (a *ArrayNode) Elements() []Node {
 	return append([]Node(nil), a.elements...)
 }
 
+// ElementsSeq returns an iterator over the index and node of each array
+// element without copying.
+func (a *ArrayNode) ElementsSeq() iter.Seq2[int, Node] {
+	return func(yield func(int, Node) bool) {
+		for i, e := range a.elements {
+			if !yield(i, e) {
+				return
+			}
+		}
+	}
+}
+
+func (a *ArrayNode) Type() NodeType   { return NodeArray }
 func (a *ArrayNode) Children() []Node { return append([]Node(nil), a.elements...) }
 func (a *ArrayNode) Text() string     { return a.text }
 
@@ -433,6 +627,7 @@ func (a *ArrayNode) Text() string     { return a.text }
 type InlineTableNode struct {
 	baseNode
 	entries []*KeyValue
+	seps    []string // source text around entries (len(entries)+1), nil if constructed
 	text    string
 }
 
@@ -441,6 +636,20 @@ func (n *InlineTableNode) Entries() []*KeyValue {
 	return append([]*KeyValue(nil), n.entries...)
 }
 
+// EntriesSeq returns an iterator over the inline table entries without
+// copying.
+func (n *InlineTableNode) EntriesSeq() iter.Seq[*KeyValue] {
+	return func(yield func(*KeyValue) bool) {
+		for _, kv := range n.entries {
+			if !yield(kv) {
+				return
+			}
+		}
+	}
+}
+
+func (n *InlineTableNode) Type() NodeType { return NodeInlineTable }
+
 func (n *InlineTableNode) Children() []Node {
 	out := make([]Node, 0, len(n.entries))
 	for _, e := range n.entries {
@@ -453,34 +662,178 @@ func (n *InlineTableNode) Text() string { return n.text }
 
 // Document represents a parsed TOML document.
 type Document struct {
-	nodes []Node // top-level nodes: KeyValue, TableNode, ArrayOfTables
+	nodes       []Node         // top-level nodes: KeyValue, TableNode, ArrayOfTables
+	annotations map[string]any // user annotations, nil until set
+	batching    bool           // inside WithBatch: mutations skip validation
+	aliases     *aliasTable    // legacy key fallbacks for Get, nil if none
+	prologue    []Node         // trivia before the first node, such as a file banner
+	epilogue    []Node         // trivia after the last section
+	derived     derived        // built from the contents on first use
+}
+
+// derived holds what a Document builds from its contents on first use,
+// such as its Index, logical view, and layout, until the contents change.
+// The fields are atomic because reading methods such as Get fill them, and
+// reads may run concurrently, as in WalkParallel.
+type derived struct {
+	index  atomic.Pointer[Index]
+	root   atomic.Pointer[lnode]
+	layout atomic.Pointer[docLayout]
+}
+
+// changed drops what d has built from its contents. Every mutation calls
+// it, directly or through validateMutation or regenerateAncestorText.
+func (d *Document) changed() {
+	d.derived.index.Store(nil)
+	d.derived.root.Store(nil)
+	d.derived.layout.Store(nil)
+}
+
+// touch calls changed on the document holding n, if any.
+func touch(n Node) {
+	if d := findDocument(n); d != nil {
+		d.changed()
+	}
 }
 
-// Nodes returns a copy of the top-level nodes.
+// Nodes returns a copy of the top-level nodes, not counting the prologue
+// and epilogue.
 func (d *Document) Nodes() []Node {
 	return append([]Node(nil), d.nodes...)
 }
 
-func (d *Document) Type() NodeType   { return NodeDocument }
-func (d *Document) Parent() Node     { return nil }
-func (d *Document) Children() []Node { return append([]Node(nil), d.nodes...) }
-func (d *Document) Text() string     { return d.String() }
+// Prologue returns a copy of the comments and blank lines at the top of
+// the document that are separated from its first key or header by a blank
+// line, such as a license header or file banner. A document holding only
+// comments is all prologue. Comments directly above the first key or
+// header are that node's leading trivia instead.
+func (d *Document) Prologue() []Node {
+	return append([]Node(nil), d.prologue...)
+}
+
+// SetPrologue sets the trivia at the top of the document. The nodes are
+// written as given, so end the last comment with a newline node.
+func (d *Document) SetPrologue(nodes []Node) error {
+	if err := validateTriviaNodes(nodes); err != nil {
+		return err
+	}
+	d.prologue = append([]Node(nil), nodes...)
+	adoptTrivia(d, nodes)
+	d.changed()
+	return nil
+}
+
+// Epilogue returns a copy of the comments and blank lines at the end of
+// the document, from the first blank line after its last entry. Comments
+// directly below the last entry of a table close that table and are in
+// its TrailingBodyTrivia instead. Nodes added to the document go before
+// the epilogue.
+func (d *Document) Epilogue() []Node {
+	return append([]Node(nil), d.epilogue...)
+}
+
+// SetEpilogue sets the trivia at the end of the document.
+func (d *Document) SetEpilogue(nodes []Node) error {
+	if err := validateTriviaNodes(nodes); err != nil {
+		return err
+	}
+	d.epilogue = append([]Node(nil), nodes...)
+	adoptTrivia(d, nodes)
+	d.changed()
+	return nil
+}
+
+func (d *Document) Type() NodeType { return NodeDocument }
+func (d *Document) Parent() Node   { return nil }
+func (d *Document) Text() string   { return d.String() }
+
+func (d *Document) Children() []Node {
+	return slices.Concat(d.prologue, d.nodes, d.epilogue)
+}
 
 // Walk traverses the CST in pre-order. Visitor returns false to stop.
+// Built-in nodes are traversed without copying their child slices.
 func (d *Document) Walk(visitor func(Node) bool) {
 	var walk func(Node) bool
 	walk = func(n Node) bool {
 		if !visitor(n) {
 			return false
 		}
-		for _, c := range n.Children() {
-			if !walk(c) {
+		return eachChild(n, walk)
+	}
+	walk(d)
+}
+
+// WalkAction tells WalkWithSkip how to go on after visiting a node.
+type WalkAction int
+
+const (
+	WalkContinue     WalkAction = iota // visit the node's children, then its siblings
+	WalkSkipChildren                   // skip the node's children
+	WalkStop                           // end the walk
+)
+
+// WalkWithSkip traverses the CST in pre-order like Walk, but the visitor
+// can also prune a subtree by returning WalkSkipChildren, for example to
+// pass over the entries of a large array of tables without visiting every
+// leaf in them.
+func (d *Document) WalkWithSkip(visitor func(Node) WalkAction) {
+	var walk func(Node) bool
+	walk = func(n Node) bool {
+		switch visitor(n) {
+		case WalkStop:
+			return false
+		case WalkSkipChildren:
+			return true
+		default:
+			return eachChild(n, walk)
+		}
+	}
+	walk(d)
+}
+
+// eachChild calls fn for each child of n in Children order, stopping early
+// if fn returns false. Unlike Children it does not allocate for the
+// built-in node types.
+func eachChild(n Node, fn func(Node) bool) bool {
+	switch v := n.(type) {
+	case *Document:
+		return eachNode(fn, v.prologue, v.nodes, v.epilogue)
+	case *KeyValue:
+		if !eachNode(fn, v.leading()) {
+			return false
+		}
+		if v.val != nil && !fn(v.val) {
+			return false
+		}
+		return eachNode(fn, v.trailing())
+	case *TableNode:
+		return eachNode(fn, v.leading(), v.entries, v.bodyTrivia, v.trailing())
+	case *ArrayOfTables:
+		return eachNode(fn, v.leading(), v.entries, v.bodyTrivia, v.trailing())
+	case *ArrayNode:
+		return eachNode(fn, v.elements)
+	case *InlineTableNode:
+		for _, kv := range v.entries {
+			if !fn(kv) {
 				return false
 			}
 		}
 		return true
+	default:
+		return eachNode(fn, n.Children())
 	}
-	walk(d)
+}
+
+func eachNode(fn func(Node) bool, lists ...[]Node) bool {
+	for _, nodes := range lists {
+		for _, n := range nodes {
+			if !fn(n) {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 // Preorder returns an iterator that yields every node in the CST in pre-order.
@@ -512,12 +865,47 @@ func (d *Document) ArraysOfTables() []*ArrayOfTables {
 	return out
 }
 
+// TablesSeq returns an iterator over the TableNode nodes in document order.
+func (d *Document) TablesSeq() iter.Seq[*TableNode] {
+	return func(yield func(*TableNode) bool) {
+		for _, n := range d.nodes {
+			if t, ok := n.(*TableNode); ok && !yield(t) {
+				return
+			}
+		}
+	}
+}
+
+// ArraysOfTablesSeq returns an iterator over the ArrayOfTables nodes in
+// document order.
+func (d *Document) ArraysOfTablesSeq() iter.Seq[*ArrayOfTables] {
+	return func(yield func(*ArrayOfTables) bool) {
+		for _, n := range d.nodes {
+			if a, ok := n.(*ArrayOfTables); ok && !yield(a) {
+				return
+			}
+		}
+	}
+}
+
+func keyValuesSeq(entries []Node) iter.Seq[*KeyValue] {
+	return func(yield func(*KeyValue) bool) {
+		for _, n := range entries {
+			if kv, ok := n.(*KeyValue); ok && !yield(kv) {
+				return
+			}
+		}
+	}
+}
+
 // String renders the document back to source, preserving formatting.
 func (d *Document) String() string {
 	var b strings.Builder
+	serializeTrivia(&b, d.prologue)
 	for _, n := range d.nodes {
 		serializeNode(&b, n)
 	}
+	serializeTrivia(&b, d.epilogue)
 	return b.String()
 }
 
@@ -541,7 +929,7 @@ func serializeTrivia(b *strings.Builder, nodes []Node) {
 }
 
 func serializeKeyValue(b *strings.Builder, kv *KeyValue) {
-	serializeTrivia(b, kv.leadingTrivia)
+	serializeTrivia(b, kv.leading())
 	b.WriteString(kv.rawKey)
 	b.WriteString(kv.preEq)
 	b.WriteString("=")
@@ -549,55 +937,130 @@ func serializeKeyValue(b *strings.Builder, kv *KeyValue) {
 	if kv.val != nil {
 		b.WriteString(kv.val.Text())
 	}
-	serializeTrivia(b, kv.trailingTrivia)
+	serializeTrivia(b, kv.trailing())
 	b.WriteString(kv.newline)
 }
 
 func serializeTableNode(b *strings.Builder, t *TableNode) {
-	serializeTrivia(b, t.leadingTrivia)
+	serializeTrivia(b, t.leading())
 	b.WriteString("[")
 	b.WriteString(t.rawHeader)
 	b.WriteString("]")
-	serializeTrivia(b, t.trailingTrivia)
+	serializeTrivia(b, t.trailing())
 	b.WriteString(t.newline)
 	for _, entry := range t.entries {
 		serializeNode(b, entry)
 	}
+	serializeTrivia(b, t.bodyTrivia)
 }
 
 func serializeArrayOfTables(b *strings.Builder, a *ArrayOfTables) {
-	serializeTrivia(b, a.leadingTrivia)
+	serializeTrivia(b, a.leading())
 	b.WriteString("[[")
 	b.WriteString(a.rawHeader)
 	b.WriteString("]]")
-	serializeTrivia(b, a.trailingTrivia)
+	serializeTrivia(b, a.trailing())
 	b.WriteString(a.newline)
 	for _, entry := range a.entries {
 		serializeNode(b, entry)
 	}
+	serializeTrivia(b, a.bodyTrivia)
 }
 
 // Parse reads a TOML document from bytes.
 func Parse(b []byte) (*Document, error) {
+	doc := &Document{}
+	if err := parseInto(doc, b, parseRun{ctx: context.Background()}); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// ParseInto parses b into dst, replacing its contents and reusing the
+// storage of its top-level node slice. Everything else about dst, such as
+// annotations and aliases, is reset as if it were new. Nodes obtained from
+// dst before the call must not be used afterwards. On error dst is left
+// empty.
+func ParseInto(dst *Document, b []byte) error {
+	return parseInto(dst, b, parseRun{ctx: context.Background()})
+}
+
+// parseRun holds the per-call configuration of parseInto.
+type parseRun struct {
+	ctx  context.Context // parsing aborts with ctx.Err() once done
+	sc   *parseScratch   // reusable parser and validator state, or nil
+	opts *ParseOptions   // hooks, or nil
+	sel  [][]string      // paths to build values for, as in ParseSelect, or nil
+}
+
+// parseInto parses b into dst as configured by run, reporting stats to
+// any hooks in run.opts.
+func parseInto(dst *Document, b []byte, run parseRun) error {
+	dst.reset()
+	stats := ParseStats{Bytes: len(b)}
+	err := parseAndValidate(dst, b, run, &stats)
+	if err != nil {
+		dst.reset()
+	}
+	run.opts.parseComplete(dst, stats, err)
+	return err
+}
+
+// reset empties d, keeping only the storage of its top-level node slice.
+func (d *Document) reset() {
+	clear(d.nodes)
+	*d = Document{nodes: d.nodes[:0]}
+}
+
+func parseAndValidate(dst *Document, b []byte, run parseRun, stats *ParseStats) error {
 	if b == nil {
-		return nil, ErrNilInput
+		return ErrNilInput
 	}
 	if msg := validateUTF8(b); msg != "" {
-		return nil, &ParseError{Message: msg, Line: 1, Column: 1, Source: string(b)}
+		return &ParseError{Message: msg, Line: 1, Column: 1, Source: string(b), Hint: hintFor(msg)}
 	}
-	s := string(b)
+	s := run.opts.source(b)
 	if s == "" {
-		return &Document{}, nil
+		return nil
 	}
-	p := newParser(s)
-	doc, err := p.parse()
-	if err != nil {
-		return nil, err
+	var v *docValidator
+	var p *parser
+	if run.sc != nil {
+		run.sc.p.reset(s)
+		run.sc.state.reset()
+		p = &run.sc.p
+		v = &docValidator{source: s, state: &run.sc.state, ctx: run.ctx}
+	} else {
+		p = newParser(s)
+		v = &docValidator{source: s, ctx: run.ctx}
 	}
-	if err := validateDocument(doc, s); err != nil {
-		return nil, err
+	if run.opts != nil {
+		v.smallLimit = run.opts.SmallDocumentLimit
 	}
-	return doc, nil
+	p.ctx = run.ctx
+	p.sel = run.sel
+	p.lex.templates = run.opts != nil && run.opts.Templates
+	if run.opts != nil && run.opts.InternKeys {
+		p.intern = make(map[string]string)
+	}
+	start := time.Now()
+	if err := p.parse(dst); err != nil {
+		stats.ParseTime = time.Since(start)
+		return err
+	}
+	stats.ParseTime = time.Since(start)
+	start = time.Now()
+	defer v.release()
+	err := v.validate(dst)
+	stats.ValidateTime = time.Since(start)
+	run.opts.validated(dst, stats.ValidateTime, err)
+	if err == nil {
+		err = run.opts.checkValues(dst, s)
+	}
+	if err == nil {
+		run.opts.warn(run.ctx, dst, s)
+	}
+	return err
 }
 
 // --- Validation helpers for setters ---
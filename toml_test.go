@@ -1,10 +1,27 @@
 package toml
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 func TestParse_EmptyDocument(t *testing.T) {
@@ -86,12 +103,10 @@ func TestParse_LeadingTrivia(t *testing.T) {
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	kv := d.nodes[0].(*KeyValue)
-	if len(kv.LeadingTrivia()) == 0 {
-		t.Fatalf("expected leading trivia")
-	}
+	// A comment set off from the first key by a blank line is the file's
+	// prologue, not the key's leading trivia.
 	hasComment := false
-	for _, n := range kv.LeadingTrivia() {
+	for _, n := range d.Prologue() {
 		if n.Type() == NodeComment {
 			hasComment = true
 			if !strings.Contains(n.Text(), "comment before") {
@@ -100,7 +115,11 @@ func TestParse_LeadingTrivia(t *testing.T) {
 		}
 	}
 	if !hasComment {
-		t.Fatalf("expected a comment in leading trivia")
+		t.Fatalf("expected a comment in the prologue")
+	}
+	kv := d.nodes[0].(*KeyValue)
+	if got := triviaText(kv.LeadingTrivia()); got != "\n" {
+		t.Fatalf("leading trivia = %q, want the blank line", got)
 	}
 }
 
@@ -391,265 +410,715 @@ func TestPreorder_EarlyBreak(t *testing.T) {
 	}
 }
 
-func TestParse_MultilineBasicString(t *testing.T) {
-	input := "s = \"\"\"\nhello\nworld\"\"\"\n"
+func TestIteratorSeqs(t *testing.T) {
+	input := "[a]\nx = 1\n# note\ny = [1, 2, 3]\nz = { p = 1, q = 2 }\n[[arr]]\nk = 1\n[b]\n"
 	d, err := Parse([]byte(input))
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	kv := d.nodes[0].(*KeyValue)
-	if kv.val.Type() != NodeString {
-		t.Fatalf("expected string, got %v", kv.val.Type())
+	var headers []string
+	for tbl := range d.TablesSeq() {
+		headers = append(headers, tbl.RawHeader())
 	}
-	got := d.String()
-	if got != input {
-		t.Fatalf("round-trip failed\nwant: %q\ngot:  %q", input, got)
+	if strings.Join(headers, ",") != "a,b" {
+		t.Fatalf("unexpected tables: %v", headers)
+	}
+	aots := 0
+	for range d.ArraysOfTablesSeq() {
+		aots++
+	}
+	if aots != 1 {
+		t.Fatalf("expected 1 array of tables, got %d", aots)
+	}
+	var keys []string
+	for kv := range d.Table("a").KeyValuesSeq() {
+		keys = append(keys, kv.RawKey())
+	}
+	if strings.Join(keys, ",") != "x,y,z" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	sum := 0
+	for i, e := range d.Get("a.y").Val().(*ArrayNode).ElementsSeq() {
+		if e.Text() != strconv.Itoa(i+1) {
+			t.Fatalf("element %d: got %q", i, e.Text())
+		}
+		sum += i
+	}
+	if sum != 3 {
+		t.Fatalf("expected indices 0..2, sum %d", sum)
+	}
+	n := 0
+	for range d.Get("a.z").Val().(*InlineTableNode).EntriesSeq() {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Fatalf("expected early break after 1 entry, got %d", n)
 	}
 }
 
-func TestParse_InlineTableEntries(t *testing.T) {
-	input := "point = {x = 1, y = 2}\n"
+func TestIndexAccessors(t *testing.T) {
+	input := "a.b = 1\n[t]\n# c\nx = { p = 1, q = 2 }\n[[arr]]\nk = 1\n"
 	d, err := Parse([]byte(input))
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	kv := d.nodes[0].(*KeyValue)
-	it, ok := kv.val.(*InlineTableNode)
-	if !ok {
-		t.Fatalf("expected InlineTableNode, got %T", kv.val)
+	if d.Len() != 3 || d.Node(3) != nil || d.Node(-1) != nil {
+		t.Fatalf("unexpected document length %d", d.Len())
 	}
-	if len(it.entries) != 2 {
-		t.Fatalf("expected 2 entries, got %d", len(it.entries))
+	kv := d.Node(0).(*KeyValue)
+	if kv.NumKeyParts() != 2 || kv.KeyPart(1).Unquoted != "b" || kv.KeyPart(2) != (KeyPart{}) {
+		t.Fatalf("unexpected key parts %v", kv.KeyParts())
+	}
+	tbl := d.Node(1).(*TableNode)
+	if tbl.Len() != 1 || tbl.Entry(1) != nil {
+		t.Fatalf("unexpected table length %d", tbl.Len())
+	}
+	it := tbl.Entry(0).(*KeyValue).Val().(*InlineTableNode)
+	if it.Len() != 2 || it.Entry(1).RawKey() != "q" || it.Entry(2) != nil {
+		t.Fatalf("unexpected inline table entries")
+	}
+	aot := d.Node(2).(*ArrayOfTables)
+	if aot.Len() != 1 || aot.Entry(0).(*KeyValue).RawKey() != "k" || aot.Entry(1) != nil {
+		t.Fatalf("unexpected array-of-tables entries")
 	}
 }
 
-func TestParse_SpecialFloats(t *testing.T) {
-	for _, v := range []string{"inf", "+inf", "-inf", "nan", "+nan", "-nan"} {
-		input := "f = " + v + "\n"
-		d, err := Parse([]byte(input))
-		if err != nil {
-			t.Fatalf("parse error for %s: %v", v, err)
-		}
-		kv := d.nodes[0].(*KeyValue)
-		if kv.val.Type() != NodeNumber {
-			t.Fatalf("for %s: expected number, got %v", v, kv.val.Type())
-		}
+func TestWalk_DoesNotCopyChildren(t *testing.T) {
+	var b strings.Builder
+	for i := range 200 {
+		fmt.Fprintf(&b, "[t%d]\n# c\nk = [1, 2, { a = 3 }]\n", i)
+	}
+	d, err := Parse([]byte(b.String()))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		d.Walk(func(Node) bool { return true })
+	})
+	if allocs > 10 {
+		t.Fatalf("expected Walk to allocate a constant amount, got %v allocs", allocs)
 	}
 }
 
-func TestParse_HexOctBin(t *testing.T) {
-	tests := []struct {
-		input string
-		val   string
-	}{
-		{"n = 0xDEADBEEF\n", "0xDEADBEEF"},
-		{"n = 0o755\n", "0o755"},
-		{"n = 0b11010110\n", "0b11010110"},
+func TestParseInto_ReusesDocument(t *testing.T) {
+	var d Document
+	if err := ParseInto(&d, []byte("# banner\n\na = 1\nb = 2\n\n# footer\n")); err != nil {
+		t.Fatalf("parse error: %v", err)
 	}
-	for _, tt := range tests {
-		d, err := Parse([]byte(tt.input))
+	if err := ParseInto(&d, []byte("[t]\nc = 3\n")); err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if got := d.String(); got != "[t]\nc = 3\n" {
+		t.Fatalf("unexpected document: %q", got)
+	}
+	if d.Get("a") != nil || d.Get("t.c") == nil {
+		t.Fatalf("document still holds previous contents")
+	}
+	if d.Table("t").Parent() != &d {
+		t.Fatalf("expected table parent to be the reused document")
+	}
+
+	d.WithAliases(map[string]string{"c": "t.c"})
+	if d.Get("c") == nil {
+		t.Fatalf("alias not applied")
+	}
+	if err := ParseInto(&d, []byte("[t]\nc = 3\n")); err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if d.Get("c") != nil || d.UsedAliases() != nil {
+		t.Fatalf("aliases survived ParseInto")
+	}
+	if err := ParseInto(&d, []byte("a = 1\na = 2\n")); err == nil {
+		t.Fatalf("expected duplicate key error")
+	}
+	if d.Len() != 0 {
+		t.Fatalf("expected document to be empty after error, has %d nodes", d.Len())
+	}
+}
+
+func TestReparse(t *testing.T) {
+	base := "# banner\n\ntitle = \"x\"\n\n[a]\nx = 1 # one\n# closes a\n\n# leads b\n[b]\ny = [1,\n  2]\n\n" +
+		"[[c]]\nz = { p = 1 }\n\n[[c]]\nz = 2\n[d.e]\nf = \"\"\"\nmulti\n\"\"\"\n\n# footer\n"
+	edits := []string{"", "\n", "[", "]", "# c\n", "\n[n]\n", "q = 1\n", "\"\"\"", "x = 2\n", "[[c]]\n", "[a]\n", "k=", "#"}
+	check := func(t *testing.T, d *Document, text string) {
+		t.Helper()
+		want, wantErr := Parse([]byte(text))
+		err := d.Reparse([]byte(text))
+		if (err == nil) != (wantErr == nil) || err != nil && err.Error() != wantErr.Error() {
+			t.Fatalf("Reparse(%q) = %v, want %v", text, err, wantErr)
+		}
 		if err != nil {
-			t.Fatalf("parse error for %q: %v", tt.input, err)
+			return
 		}
-		kv := d.nodes[0].(*KeyValue)
-		if kv.val.Type() != NodeNumber {
-			t.Fatalf("for %q: expected number, got %v", tt.input, kv.val.Type())
+		if got, want := dumpTree(d), dumpTree(want); got != want {
+			t.Fatalf("Reparse(%q) tree:\n%s\nwant:\n%s", text, got, want)
 		}
-		if kv.val.Text() != tt.val {
-			t.Fatalf("for %q: expected %q, got %q", tt.input, tt.val, kv.val.Text())
+	}
+	for at := range len(base) + 1 {
+		for _, ins := range edits {
+			for _, cut := range []int{0, 1, 4} {
+				end := min(at+cut, len(base))
+				text := base[:at] + ins + base[end:]
+				check(t, mustParse(t, base), text)
+			}
 		}
 	}
-}
-
-// --- Validation tests: numbers ---
 
-func TestParse_RejectsLeadingZeros(t *testing.T) {
-	_, err := Parse([]byte("n = 012\n"))
-	if err == nil {
-		t.Fatal("expected error for leading zeros")
+	// A document updated only by Reparse keeps matching Parse.
+	d := mustParse(t, base)
+	text := base
+	for i, ins := range edits {
+		at := i * 7 % len(text)
+		text = text[:at] + ins + text[at:]
+		check(t, d, text)
+		if _, err := Parse([]byte(text)); err != nil {
+			d = mustParse(t, d.String())
+			text = d.String()
+		}
 	}
-}
 
-func TestParse_RejectsDoubleUnderscore(t *testing.T) {
-	_, err := Parse([]byte("n = 1__0\n"))
-	if err == nil {
-		t.Fatal("expected error for double underscore")
+	d = mustParse(t, "[a]\nx = 1\n[b]\ny = 2\n")
+	b := d.Table("b")
+	if err := d.Reparse([]byte("[a]\nx = 2\n[b]\ny = 2\n")); err != nil {
+		t.Fatal(err)
 	}
-}
-
-func TestParse_RejectsTrailingUnderscore(t *testing.T) {
-	_, err := Parse([]byte("n = 100_\n"))
-	if err == nil {
-		t.Fatal("expected error for trailing underscore")
+	if d.Table("b") != b || b.Parent() != d {
+		t.Fatalf("expected the section after the edit to be kept")
 	}
-}
-
-func TestParse_RejectsMultipleDots(t *testing.T) {
-	_, err := Parse([]byte("f = 1.2.3\n"))
-	if err == nil {
-		t.Fatal("expected error for multiple dots in float")
+	if err := d.Reparse([]byte("[a]\ny = 2\n[a]\n")); err == nil {
+		t.Fatalf("expected duplicate table error")
+	}
+	if d.String() != "[a]\nx = 2\n[b]\ny = 2\n" || d.Table("b") != b {
+		t.Fatalf("failed Reparse changed the document: %q", d.String())
 	}
 }
 
-func TestParse_RejectsUnderscoreByDot(t *testing.T) {
-	_, err := Parse([]byte("f = 1_.0\n"))
-	if err == nil {
-		t.Fatal("expected error for underscore adjacent to dot")
+// dumpTree describes every node of d with its source position, checking
+// parent links on the way.
+func dumpTree(d *Document) string {
+	var b strings.Builder
+	var walk func(n Node, depth int)
+	walk = func(n Node, depth int) {
+		fmt.Fprintf(&b, "%s%T %q", strings.Repeat("  ", depth), n, n.Text())
+		if pos := srcPosOf(n); pos != nil {
+			fmt.Fprintf(&b, " %d:%d", pos.line, pos.col)
+		}
+		b.WriteByte('\n')
+		eachChild(n, func(c Node) bool {
+			if c.Parent() != n {
+				fmt.Fprintf(&b, "BAD PARENT %T\n", c)
+			}
+			walk(c, depth+1)
+			return true
+		})
 	}
+	walk(d, 0)
+	return b.String()
 }
 
-func TestParse_RejectsUnderscoreByExponent(t *testing.T) {
-	_, err := Parse([]byte("f = 1_e2\n"))
-	if err == nil {
-		t.Fatal("expected error for underscore adjacent to exponent")
+func TestParseSelect(t *testing.T) {
+	src := "[package]\nname = \"app\"\nversion = \"1.2.0\"\n# who\nauthors = [\"a\", \"b\"]\n\n" +
+		"[[dependency]]\nname = \"lib\"\nfeatures = [\"x\", { y = [1, 2] }] # comment\nsource = { git = \"url\", rev = \"abc\" }\n"
+	d, err := ParseSelect([]byte(src), []string{"package.version", "package.authors"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.String(); got != src {
+		t.Fatalf("round trip:\n%q\nwant\n%q", got, src)
+	}
+	if err := d.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	if got := d.Get("package.version").Val().Text(); got != `"1.2.0"` {
+		t.Errorf("package.version = %s", got)
+	}
+	if _, ok := d.Get("package.authors").Val().(*ArrayNode); !ok {
+		t.Errorf("selected array is %T", d.Get("package.authors").Val())
+	}
+	if d.Get("package.name") != nil {
+		t.Error("unselected key-value was built")
+	}
+	entries := d.Table("package").Entries()
+	if raw, ok := entries[0].(*RawNode); !ok || raw.Text() != "name = \"app\"\n" || raw.Parent() != d.Table("package") {
+		t.Errorf("unselected key-value = %#v", entries[0])
+	}
+	if len(d.ArrayOfTables("dependency")) != 0 {
+		t.Error("unselected section was built")
+	}
+	raw, ok := d.Nodes()[1].(*RawNode)
+	if !ok || !strings.HasPrefix(raw.Text(), "\n[[dependency]]\n") || !strings.HasSuffix(raw.Text(), "rev = \"abc\" }\n") {
+		t.Fatalf("unselected section = %#v", d.Nodes()[1])
+	}
+	sub, err := raw.Expand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sub.ArrayOfTables("dependency")[0].Get("source").Val().(*InlineTableNode); !ok {
+		t.Errorf("Expand() = %q", sub.String())
 	}
-}
 
-// --- Validation tests: datetimes ---
+	all, err := ParseSelect([]byte(src), []string{"dependency"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := all.ArrayOfTables("dependency")[0].Get("source").Val().(*InlineTableNode); !ok {
+		t.Error("value under a selected table was not built")
+	}
+	if _, ok := all.Nodes()[0].(*RawNode); !ok || all.String() != src {
+		t.Errorf("unselected [package] = %T", all.Nodes()[0])
+	}
 
-func TestParse_RejectsInvalidMonth(t *testing.T) {
-	_, err := Parse([]byte("d = 2024-13-01\n"))
-	if err == nil {
-		t.Fatal("expected error for invalid month")
+	for _, bad := range []string{
+		"a = [1,, 2]\n", "a = [1 2]\n", "a = [\"\\q\"]\n", "a = { b = 1 c = 2 }\n", "a = [{ b = 01 }]\n", "a = [1\n",
+		"a = 1 b\n", "a = \"x\" # \x01\n", "[x\n", "[[x]\n", "[x] y\n", "[x]\nb = 1 2\n", "[x]\nb\n", "[x]\n# \x01\n",
+	} {
+		_, want := Parse([]byte(bad))
+		_, err := ParseSelect([]byte(bad), []string{"y"})
+		if want == nil || err == nil || err.Error() != want.Error() {
+			t.Errorf("%q: ParseSelect error %v, Parse error %v", bad, err, want)
+		}
 	}
 }
 
-func TestParse_RejectsInvalidDay(t *testing.T) {
-	_, err := Parse([]byte("d = 2024-02-30\n"))
-	if err == nil {
-		t.Fatal("expected error for Feb 30")
+func TestParserPool(t *testing.T) {
+	var pool ParserPool
+	inputs := []string{
+		"a = 1\n[t]\nx = 1\n",
+		"[t]\nx = 1\n[t.u]\ny = 2\n",
+		"[[a]]\nk = 1\n[[a]]\nk = 2\n",
+	}
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				for _, in := range inputs {
+					d, err := pool.Parse([]byte(in))
+					if err != nil {
+						t.Errorf("parse error: %v", err)
+						return
+					}
+					if d.String() != in {
+						t.Errorf("round-trip mismatch: %q", d.String())
+						return
+					}
+				}
+			}
+		}()
 	}
-}
+	wg.Wait()
 
-func TestParse_RejectsInvalidHour(t *testing.T) {
-	_, err := Parse([]byte("t = 25:00:00\n"))
-	if err == nil {
-		t.Fatal("expected error for hour > 23")
+	// State from a previous parse must not leak into the next one.
+	if _, err := pool.Parse([]byte("[t]\n")); err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if _, err := pool.Parse([]byte("[t]\n")); err != nil {
+		t.Fatalf("expected fresh validator state, got %v", err)
+	}
+	if _, err := pool.Parse([]byte("[t]\n[t]\n")); err == nil {
+		t.Fatalf("expected duplicate table error")
+	}
+	if _, err := pool.Parse(nil); !errors.Is(err, ErrNilInput) {
+		t.Fatalf("expected ErrNilInput, got %v", err)
 	}
 }
 
-// --- Validation tests: strings ---
+func TestParseContext(t *testing.T) {
+	input := []byte("a = 1\n[t]\nb = 2\n")
+	d, err := ParseContext(context.Background(), input)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if d.String() != string(input) {
+		t.Fatalf("round-trip mismatch: %q", d.String())
+	}
 
-func TestParse_RejectsInvalidEscape(t *testing.T) {
-	_, err := Parse([]byte("s = \"hello\\q\"\n"))
-	if err == nil {
-		t.Fatal("expected error for invalid escape \\q")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseContext(ctx, input); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if err := d.ValidateContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled from ValidateContext, got %v", err)
 	}
 }
 
-func TestParse_RejectsControlCharInString(t *testing.T) {
-	_, err := Parse([]byte("s = \"hello\x01world\"\n"))
-	if err == nil {
-		t.Fatal("expected error for control char in string")
+func TestWalkContext_CancelMidWalk(t *testing.T) {
+	d, err := Parse([]byte("a = 1\nb = 2\nc = 3\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	visited := 0
+	err = d.WalkContext(ctx, func(Node) bool {
+		visited++
+		if visited == 2 {
+			cancel()
+		}
+		return true
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if visited != 2 {
+		t.Fatalf("expected walk to stop after 2 nodes, visited %d", visited)
+	}
+	if err := d.WalkContext(context.Background(), func(Node) bool { return false }); err != nil {
+		t.Fatalf("expected nil error when visitor stops, got %v", err)
 	}
 }
 
-// --- Validation tests: semantic ---
-
-func TestParse_RejectsDuplicateTable(t *testing.T) {
-	input := "[a]\nk = 1\n[a]\nk = 2\n"
-	_, err := Parse([]byte(input))
-	if err == nil {
-		t.Fatal("expected error for duplicate table")
+func TestWalkWithSkip(t *testing.T) {
+	d := mustParse(t, "a = [1, 2]\n[[rows]]\nx = 1\n[[rows]]\nx = 2\n[t]\nb = 3\n")
+	var keys []string
+	d.WalkWithSkip(func(n Node) WalkAction {
+		switch v := n.(type) {
+		case *ArrayOfTables:
+			return WalkSkipChildren
+		case *KeyValue:
+			keys = append(keys, v.RawKey())
+			return WalkSkipChildren
+		}
+		return WalkContinue
+	})
+	if want := []string{"a", "b"}; !slices.Equal(keys, want) {
+		t.Errorf("visited keys %v, want %v", keys, want)
 	}
-}
 
-func TestParse_RejectsDuplicateKey(t *testing.T) {
-	input := "name = \"Tom\"\nname = \"Pradyun\"\n"
-	_, err := Parse([]byte(input))
-	if err == nil {
-		t.Fatal("expected error for duplicate key")
+	visited := 0
+	d.WalkWithSkip(func(n Node) WalkAction {
+		visited++
+		if _, ok := n.(*ArrayOfTables); ok {
+			return WalkStop
+		}
+		return WalkContinue
+	})
+	if visited != 6 { // document, a, its array and two integers, [[rows]]
+		t.Errorf("visited %d nodes before stopping, want 6", visited)
 	}
 }
 
-func TestParse_RejectsDuplicateQuotedKey(t *testing.T) {
-	input := "spelling = \"favorite\"\n\"spelling\" = \"favourite\"\n"
-	_, err := Parse([]byte(input))
-	if err == nil {
-		t.Fatal("expected error for duplicate key (bare vs quoted)")
+func TestWalkParallel(t *testing.T) {
+	var src strings.Builder
+	src.WriteString("# header\n\ntitle = 1\n")
+	for i := range 200 {
+		fmt.Fprintf(&src, "[[rows]]\nid = %d # row\ntags = [\"a\", \"b\"]\n", i)
+	}
+	d := mustParse(t, src.String())
+	want := 0
+	d.Walk(func(Node) bool {
+		want++
+		return true
+	})
+	for _, workers := range []int{0, 1, 4, 1000} {
+		var got atomic.Int64
+		d.WalkParallel(workers, func(Node) bool {
+			got.Add(1)
+			return true
+		})
+		if int(got.Load()) != want {
+			t.Errorf("workers=%d: visited %d nodes, want %d", workers, got.Load(), want)
+		}
 	}
-}
 
-func TestParse_RejectsDottedKeyReopen(t *testing.T) {
-	input := "[product]\ntype.name = \"Nail\"\ntype = { edible = false }\n"
-	_, err := Parse([]byte(input))
-	if err == nil {
-		t.Fatal("expected error for overwriting dotted-key table with inline table")
+	var visited atomic.Int64
+	d.WalkParallel(4, func(n Node) bool {
+		visited.Add(1)
+		_, isAOT := n.(*ArrayOfTables)
+		return !isAOT
+	})
+	if n := int(visited.Load()); n >= want {
+		t.Errorf("visited all %d nodes after the visitor stopped", n)
 	}
 }
 
-func TestParse_RejectsInlineTableExtend(t *testing.T) {
-	input := "a = {b = 1}\n[a]\nc = 2\n"
-	_, err := Parse([]byte(input))
-	if err == nil {
-		t.Fatal("expected error for extending inline table")
+func TestParseWithOptions_Hooks(t *testing.T) {
+	input := []byte("a = 1 # c\n[t]\nb = [1, 2]\n")
+	var got ParseStats
+	var vs ValidateStats
+	calls := 0
+	opts := ParseOptions{
+		OnParseComplete: func(s ParseStats) { got = s; calls++ },
+		OnValidate:      func(s ValidateStats) { vs = s },
+	}
+	if _, err := ParseWithOptions(input, opts); err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	// KeyValue, number, whitespace, comment, table, KeyValue, array, two numbers.
+	if calls != 1 || got.Bytes != len(input) || got.TopLevel != 2 || got.Nodes != 9 || got.Err != nil {
+		t.Fatalf("unexpected stats: %+v", got)
+	}
+	if vs.TopLevel != 2 || vs.Err != nil {
+		t.Fatalf("unexpected validate stats: %+v", vs)
 	}
-}
 
-func TestParse_RejectsScalarOverwrite(t *testing.T) {
-	input := "a.b.c = 1\na.b = 2\n"
-	_, err := Parse([]byte(input))
-	if err == nil {
-		t.Fatal("expected error for overwriting dotted-key table with scalar")
+	vs = ValidateStats{}
+	_, err := ParseWithOptions([]byte("a = 1\na = 2\n"), opts)
+	if err == nil || got.Err != err || got.Nodes != 0 {
+		t.Fatalf("expected stats to carry the validation error, got %+v", got)
+	}
+	if vs.Err != err {
+		t.Fatalf("expected OnValidate to receive the error, got %v", vs.Err)
 	}
-}
 
-func TestParse_RejectsAOTOverwrite(t *testing.T) {
-	input := "[[parent.arr]]\n[parent]\narr = 2\n"
-	_, err := Parse([]byte(input))
-	if err == nil {
-		t.Fatal("expected error for overwriting array of tables with scalar")
+	vs = ValidateStats{Err: ErrNilInput}
+	_, err = ParseWithOptions([]byte("a = \n"), opts)
+	if err == nil || got.Err != err {
+		t.Fatalf("expected stats to carry the syntax error, got %+v", got)
+	}
+	if vs.Err != ErrNilInput {
+		t.Fatalf("expected OnValidate not to run after a syntax error")
 	}
 }
 
-// --- TOML 1.1 feature tests ---
-
-func TestParse_EscapeE(t *testing.T) {
-	input := "s = \"hello\\eworld\"\n"
-	d, err := Parse([]byte(input))
-	if err != nil {
+func TestParseWithOptions_LoggerWarnings(t *testing.T) {
+	input := "a = \"\\e[0m\"\nb = 'lit\\x'\nt = 07:32\nd = 2024-01-02\np = {\n  x = 1,\n}\nq = { y = \"\\\\x\" }\r\n"
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	if _, err := ParseWithOptions([]byte(input), ParseOptions{Logger: logger}); err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	kv := d.nodes[0].(*KeyValue)
-	if kv.val.Type() != NodeString {
-		t.Fatalf("expected string, got %v", kv.val.Type())
+	want := []string{
+		`level=WARN msg="mixed line endings" crlf=1 lf=7`,
+		`level=WARN msg="TOML 1.1 escape sequence" escape=\e line=1 column=1 key=a`,
+		`level=WARN msg="TOML 1.1 time without seconds" value=07:32 line=3 column=1 key=t`,
+		`level=WARN msg="TOML 1.1 multi-line inline table" line=5 column=1 key=p`,
+		`level=WARN msg="TOML 1.1 trailing comma in inline table" line=5 column=1 key=p`,
 	}
-	got := d.String()
-	if got != input {
-		t.Fatalf("round-trip failed\nwant: %q\ngot:  %q", input, got)
+	got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected warnings:\n%s", buf.String())
 	}
-}
 
-func TestParse_HexEscape(t *testing.T) {
-	input := "s = \"caf\\xE9\"\n"
+	buf.Reset()
+	if _, err := ParseWithOptions([]byte("a = \"x\"\nt = 07:32:00\n"), ParseOptions{Logger: logger}); err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected no warnings, got:\n%s", buf.String())
+	}
+}
+
+func TestParseWithOptions_ValueValidators(t *testing.T) {
+	input := "a = 1\n[s]\nurl = \"https://x\"\nm = { p = \"/etc\" }\n[[f]]\nv = [\"x\"]\n[[f]]\nv = [\"y\", \"z\"]\n[f.g]\nh = true\n"
+	var paths []string
+	record := func(path string, val Node, pos Position) error {
+		paths = append(paths, fmt.Sprintf("%s@%d:%d", path, pos.Line, pos.Column))
+		return nil
+	}
+	if _, err := ParseWithOptions([]byte(input), ParseOptions{ValueValidators: []ValueValidator{record}}); err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	want := "a@1:5 s.url@3:7 s.m@4:5 s.m.p@4:11 f[0].v@6:5 f[0].v[0]@6:6 f[1].v@8:5 f[1].v[0]@8:6 f[1].v[1]@8:11 f[1].g.h@10:5"
+	if got := strings.Join(paths, " "); got != want {
+		t.Errorf("paths:\n got %s\nwant %s", got, want)
+	}
+
+	errHTTP := errors.New("plain http is not allowed")
+	noHTTP := func(path string, val Node, pos Position) error {
+		if s, ok := val.(*StringNode); ok && strings.HasPrefix(s.Value(), "http://") {
+			return errHTTP
+		}
+		return nil
+	}
+	_, err := ParseWithOptions([]byte("[s]\nurls = [\"https://a\", \"http://b\"]\n"), ParseOptions{ValueValidators: []ValueValidator{noHTTP}})
+	var pe *ParseError
+	if !errors.As(err, &pe) || !errors.Is(err, errHTTP) {
+		t.Fatalf("expected a ParseError wrapping the validator error, got %v", err)
+	}
+	if pe.Line != 2 || pe.Column != 22 || pe.Token != `"http://b"` || !strings.Contains(pe.Message, `"s.urls[1]"`) {
+		t.Errorf("unexpected error: %+v", pe)
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	d, err := Parse([]byte("[t]\nold = 1\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	kv := d.Get("t.old")
+	kv.SetAnnotation("deprecated", true)
+	d.SetAnnotation("source", "base.toml")
+
+	for n := range d.Preorder() {
+		a, ok := n.(Annotated)
+		if !ok {
+			t.Fatalf("%T does not implement Annotated", n)
+		}
+		v, ok := a.Annotation("deprecated")
+		if want := n == Node(kv); ok != want || (ok && v != true) {
+			t.Fatalf("unexpected annotation on %T: %v, %v", n, v, ok)
+		}
+	}
+	if v, ok := d.Annotation("source"); !ok || v != "base.toml" {
+		t.Fatalf("unexpected document annotation: %v, %v", v, ok)
+	}
+	if d.String() != "[t]\nold = 1\n" {
+		t.Fatalf("annotations must not affect serialization: %q", d.String())
+	}
+
+	kv.SetAnnotation("deprecated", nil)
+	if _, ok := kv.Annotation("deprecated"); ok {
+		t.Fatalf("expected nil value to remove the annotation")
+	}
+
+	if err := ParseInto(d, []byte("a = 1\n")); err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if _, ok := d.Annotation("source"); ok {
+		t.Fatalf("expected ParseInto to clear document annotations")
+	}
+
+	// Node annotations live in a side table, which must not keep nodes
+	// alive once they are dropped.
+	count := func() int {
+		nodeAnnotations.Lock()
+		defer nodeAnnotations.Unlock()
+		return len(nodeAnnotations.m)
+	}
+	base := count()
+	func() {
+		d := mustParse(t, "a = 1\nb = 2\n")
+		d.Get("a").SetAnnotation("k", 1)
+		d.Get("b").Val().(Annotated).SetAnnotation("k", 2)
+	}()
+	for range 100 {
+		if count() <= base {
+			return
+		}
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("annotations of dropped nodes were kept: %d entries, want %d", count(), base)
+}
+
+func TestNodeID_StableAcrossReparse(t *testing.T) {
+	before := "# header\n[server]\nhost = \"a\"\nports = [1, 2]\n[[peer]]\nname = \"x\"\n[[peer]]\nname = \"y\"\n"
+	after := "# header\n[server]\nnew = true\nhost = \"b\"\nports = [1, 2]\n[[peer]]\nname = \"x\"\n[[peer]]\nname = \"y\"\n"
+	d1, err := Parse([]byte(before))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	d2, err := Parse([]byte(after))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	id := func(n interface{ ID() string }) string { return n.ID() }
+
+	if id(d1.Get("server.host")) != id(d2.Get("server.host")) {
+		t.Errorf("edited key-value changed ID")
+	}
+	if id(d1.Table("server")) != id(d2.Table("server")) {
+		t.Errorf("table changed ID")
+	}
+	e1 := d1.Get("server.ports").Val().(*ArrayNode).Element(1).(*NumberNode)
+	e2 := d2.Get("server.ports").Val().(*ArrayNode).Element(1).(*NumberNode)
+	if id(e1) != id(e2) {
+		t.Errorf("array element changed ID")
+	}
+	c1 := d1.Table("server").LeadingTrivia()[0].(*CommentNode)
+	c2 := d2.Table("server").LeadingTrivia()[0].(*CommentNode)
+	if id(c1) == "" || id(c1) != id(c2) {
+		t.Errorf("comment changed ID")
+	}
+	p1, p2 := d1.ArrayOfTables("peer"), d2.ArrayOfTables("peer")
+	if id(p1[1]) != id(p2[1]) || id(p1[0]) == id(p1[1]) {
+		t.Errorf("array-of-tables entries must be identified by occurrence")
+	}
+
+	seen := map[string]Node{}
+	for n := range d1.Preorder() {
+		if _, ok := n.(*Document); ok {
+			continue
+		}
+		nid := n.(interface{ ID() string }).ID()
+		if prev, dup := seen[nid]; dup {
+			t.Errorf("duplicate ID %s for %T %q and %T %q", nid, prev, prev.Text(), n, n.Text())
+		}
+		seen[nid] = n
+	}
+
+	if NewInteger(1).ID() != "" {
+		t.Errorf("expected detached node to have an empty ID")
+	}
+}
+
+func TestParse_ParentLinks(t *testing.T) {
+	input := "# top\na = 1 # c\n\n[t] # h\n# lead\nb = { x = [1, {y = 2}] }\n[[arr]]\nk = 1\n# end\n"
 	d, err := Parse([]byte(input))
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	kv := d.nodes[0].(*KeyValue)
-	if kv.val.Type() != NodeString {
-		t.Fatalf("expected string, got %v", kv.val.Type())
+	_ = d.AppendComment("# more")
+	_ = d.Table("t").AppendComment("# more")
+	d.Table("t").AppendBlankLine()
+	for n := range d.Preorder() {
+		for _, c := range n.Children() {
+			if c.Parent() != n {
+				t.Errorf("%T %q: parent is %T, want %T", c, c.Text(), c.Parent(), n)
+			}
+		}
 	}
 }
 
-func TestParse_MultiLineInlineTable(t *testing.T) {
-	input := "point = {\n  x = 1,\n  y = 2,\n}\n"
+func TestDocument_Spans(t *testing.T) {
+	input := "# top\na = 1 # c\n[t]  # h\nb = [ 1,\n  { x = \"y\" } ]\n[[arr]]\nk.l = true\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	spans := d.Spans()
+	for n := range d.Preorder() {
+		sp, ok := spans[n]
+		if !ok {
+			t.Fatalf("no span for %T %q", n, n.Text())
+		}
+		if got := input[sp.Start:sp.End]; got != n.Text() {
+			t.Errorf("%T: span %v covers %q, want %q", n, sp, got, n.Text())
+		}
+	}
+	if sp := spans[d.Get("t.b").Val().(*ArrayNode).Element(1).(*InlineTableNode).Get("x")]; input[sp.Start:sp.End] != `x = "y"` {
+		t.Errorf("unexpected inline key-value span %v", sp)
+	}
+
+	kv, _ := NewKeyValue("z", NewInteger(1))
+	if err := d.Table("t").Append(kv); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	out := d.String()
+	if sp := d.Spans()[kv]; out[sp.Start:sp.End] != "z = 1" {
+		t.Errorf("span after mutation covers %q", out[sp.Start:sp.End])
+	}
+}
+
+func TestParse_MultilineBasicString(t *testing.T) {
+	input := "s = \"\"\"\nhello\nworld\"\"\"\n"
 	d, err := Parse([]byte(input))
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
 	kv := d.nodes[0].(*KeyValue)
-	it, ok := kv.val.(*InlineTableNode)
-	if !ok {
-		t.Fatalf("expected InlineTableNode, got %T", kv.val)
+	if kv.val.Type() != NodeString {
+		t.Fatalf("expected string, got %v", kv.val.Type())
 	}
-	if len(it.entries) != 2 {
-		t.Fatalf("expected 2 entries, got %d", len(it.entries))
+	got := d.String()
+	if got != input {
+		t.Fatalf("round-trip failed\nwant: %q\ngot:  %q", input, got)
 	}
 }
 
-func TestParse_TrailingCommaInlineTable(t *testing.T) {
-	input := "point = {x = 1, y = 2,}\n"
+func TestParse_InlineTableEntries(t *testing.T) {
+	input := "point = {x = 1, y = 2}\n"
 	d, err := Parse([]byte(input))
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
@@ -664,14 +1133,28 @@ func TestParse_TrailingCommaInlineTable(t *testing.T) {
 	}
 }
 
-func TestParse_DateTimeNoSeconds(t *testing.T) {
+func TestParse_SpecialFloats(t *testing.T) {
+	for _, v := range []string{"inf", "+inf", "-inf", "nan", "+nan", "-nan"} {
+		input := "f = " + v + "\n"
+		d, err := Parse([]byte(input))
+		if err != nil {
+			t.Fatalf("parse error for %s: %v", v, err)
+		}
+		kv := d.nodes[0].(*KeyValue)
+		if kv.val.Type() != NodeNumber {
+			t.Fatalf("for %s: expected number, got %v", v, kv.val.Type())
+		}
+	}
+}
+
+func TestParse_HexOctBin(t *testing.T) {
 	tests := []struct {
 		input string
+		val   string
 	}{
-		{"t = 07:32\n"},
-		{"dt = 1979-05-27T07:32Z\n"},
-		{"dt = 1979-05-27T07:32+00:00\n"},
-		{"dt = 1979-05-27T07:32\n"},
+		{"n = 0xDEADBEEF\n", "0xDEADBEEF"},
+		{"n = 0o755\n", "0o755"},
+		{"n = 0b11010110\n", "0b11010110"},
 	}
 	for _, tt := range tests {
 		d, err := Parse([]byte(tt.input))
@@ -679,104 +1162,330 @@ func TestParse_DateTimeNoSeconds(t *testing.T) {
 			t.Fatalf("parse error for %q: %v", tt.input, err)
 		}
 		kv := d.nodes[0].(*KeyValue)
-		if kv.val.Type() != NodeDateTime {
-			t.Fatalf("for %q: expected datetime, got %v", tt.input, kv.val.Type())
+		if kv.val.Type() != NodeNumber {
+			t.Fatalf("for %q: expected number, got %v", tt.input, kv.val.Type())
+		}
+		if kv.val.Text() != tt.val {
+			t.Fatalf("for %q: expected %q, got %q", tt.input, tt.val, kv.val.Text())
 		}
 	}
 }
 
-func TestParse_RejectsBareCarriageReturn(t *testing.T) {
-	// Bare \r (not followed by \n) in multi-line basic string
-	input := "s = \"\"\"\nhello\rworld\"\"\"\n"
-	_, err := Parse([]byte(input))
+// --- Validation tests: numbers ---
+
+func TestParse_RejectsLeadingZeros(t *testing.T) {
+	_, err := Parse([]byte("n = 012\n"))
 	if err == nil {
-		t.Fatal("expected error for bare carriage return in multi-line basic string")
+		t.Fatal("expected error for leading zeros")
 	}
 }
 
-func TestParse_RejectsBareCarriageReturnLiteral(t *testing.T) {
-	// Bare \r (not followed by \n) in multi-line literal string
-	input := "s = '''\nhello\rworld'''\n"
-	_, err := Parse([]byte(input))
+func TestParse_RejectsDoubleUnderscore(t *testing.T) {
+	_, err := Parse([]byte("n = 1__0\n"))
 	if err == nil {
-		t.Fatal("expected error for bare carriage return in multi-line literal string")
+		t.Fatal("expected error for double underscore")
 	}
 }
 
-func TestParse_AllowsCRLFInMultiLineString(t *testing.T) {
-	// \r\n is valid in multi-line strings
-	input := "s = \"\"\"\r\nhello\r\nworld\"\"\"\n"
-	_, err := Parse([]byte(input))
-	if err != nil {
-		t.Fatalf("unexpected error for CRLF in multi-line string: %v", err)
+func TestParse_RejectsTrailingUnderscore(t *testing.T) {
+	_, err := Parse([]byte("n = 100_\n"))
+	if err == nil {
+		t.Fatal("expected error for trailing underscore")
 	}
 }
 
-// --- Coverage: accessor methods on KeyValue ---
-
-func TestKeyValue_KeyParts(t *testing.T) {
-	d, err := Parse([]byte("a.b = 1\n"))
-	if err != nil {
-		t.Fatal(err)
-	}
-	kv := d.nodes[0].(*KeyValue)
-	parts := kv.KeyParts()
-	if len(parts) != 2 {
-		t.Fatalf("expected 2 key parts, got %d", len(parts))
+func TestParse_RejectsMultipleDots(t *testing.T) {
+	_, err := Parse([]byte("f = 1.2.3\n"))
+	if err == nil {
+		t.Fatal("expected error for multiple dots in float")
 	}
-	if parts[0].Unquoted != "a" || parts[1].Unquoted != "b" {
-		t.Fatalf("unexpected parts: %v", parts)
+}
+
+func TestParse_RejectsUnderscoreByDot(t *testing.T) {
+	_, err := Parse([]byte("f = 1_.0\n"))
+	if err == nil {
+		t.Fatal("expected error for underscore adjacent to dot")
 	}
-	// Ensure it returns a copy (mutating the returned slice should not affect original).
-	parts[0].Unquoted = "z"
-	if kv.KeyParts()[0].Unquoted != "a" {
-		t.Fatal("KeyParts should return a defensive copy")
+}
+
+func TestParse_RejectsUnderscoreByExponent(t *testing.T) {
+	_, err := Parse([]byte("f = 1_e2\n"))
+	if err == nil {
+		t.Fatal("expected error for underscore adjacent to exponent")
 	}
 }
 
-func TestKeyValue_RawVal(t *testing.T) {
-	d, err := Parse([]byte(`key = "hello"` + "\n"))
-	if err != nil {
-		t.Fatal(err)
+// --- Validation tests: datetimes ---
+
+func TestParse_RejectsInvalidMonth(t *testing.T) {
+	_, err := Parse([]byte("d = 2024-13-01\n"))
+	if err == nil {
+		t.Fatal("expected error for invalid month")
 	}
-	kv := d.nodes[0].(*KeyValue)
-	if kv.RawVal() != `"hello"` {
-		t.Fatalf("expected raw val %q, got %q", `"hello"`, kv.RawVal())
+}
+
+func TestParse_RejectsInvalidDay(t *testing.T) {
+	_, err := Parse([]byte("d = 2024-02-30\n"))
+	if err == nil {
+		t.Fatal("expected error for Feb 30")
 	}
 }
 
-func TestKeyValue_Text(t *testing.T) {
-	d, err := Parse([]byte("key = 42\n"))
-	if err != nil {
-		t.Fatal(err)
+func TestParse_RejectsInvalidHour(t *testing.T) {
+	_, err := Parse([]byte("t = 25:00:00\n"))
+	if err == nil {
+		t.Fatal("expected error for hour > 23")
 	}
-	kv := d.nodes[0].(*KeyValue)
-	text := kv.Text()
-	if text != "key = 42" {
-		t.Fatalf("expected %q, got %q", "key = 42", text)
+}
+
+// --- Validation tests: strings ---
+
+func TestParse_RejectsInvalidEscape(t *testing.T) {
+	_, err := Parse([]byte("s = \"hello\\q\"\n"))
+	if err == nil {
+		t.Fatal("expected error for invalid escape \\q")
 	}
 }
 
-func TestKeyValue_TextNilVal(t *testing.T) {
-	// This tests the nil-val branch in Text().
-	kv := &KeyValue{
-		baseNode: baseNode{nodeType: NodeKeyValue},
-		rawKey:   "k",
-		preEq:    " ",
-		postEq:   " ",
+func TestParse_RejectsControlCharInString(t *testing.T) {
+	_, err := Parse([]byte("s = \"hello\x01world\"\n"))
+	if err == nil {
+		t.Fatal("expected error for control char in string")
 	}
-	text := kv.Text()
-	if text != "k = " {
-		t.Fatalf("expected %q, got %q", "k = ", text)
+}
+
+// --- Validation tests: semantic ---
+
+func TestParse_RejectsDuplicateTable(t *testing.T) {
+	input := "[a]\nk = 1\n[a]\nk = 2\n"
+	_, err := Parse([]byte(input))
+	if err == nil {
+		t.Fatal("expected error for duplicate table")
 	}
 }
 
-func TestKeyValue_Children(t *testing.T) {
-	d, err := Parse([]byte("key = 42  # comment\n"))
-	if err != nil {
-		t.Fatal(err)
+func TestParse_RejectsDuplicateKey(t *testing.T) {
+	input := "name = \"Tom\"\nname = \"Pradyun\"\n"
+	_, err := Parse([]byte(input))
+	if err == nil {
+		t.Fatal("expected error for duplicate key")
 	}
-	kv := d.nodes[0].(*KeyValue)
+}
+
+func TestParse_RejectsDuplicateQuotedKey(t *testing.T) {
+	input := "spelling = \"favorite\"\n\"spelling\" = \"favourite\"\n"
+	_, err := Parse([]byte(input))
+	if err == nil {
+		t.Fatal("expected error for duplicate key (bare vs quoted)")
+	}
+}
+
+func TestParse_RejectsDottedKeyReopen(t *testing.T) {
+	input := "[product]\ntype.name = \"Nail\"\ntype = { edible = false }\n"
+	_, err := Parse([]byte(input))
+	if err == nil {
+		t.Fatal("expected error for overwriting dotted-key table with inline table")
+	}
+}
+
+func TestParse_RejectsInlineTableExtend(t *testing.T) {
+	input := "a = {b = 1}\n[a]\nc = 2\n"
+	_, err := Parse([]byte(input))
+	if err == nil {
+		t.Fatal("expected error for extending inline table")
+	}
+}
+
+func TestParse_RejectsScalarOverwrite(t *testing.T) {
+	input := "a.b.c = 1\na.b = 2\n"
+	_, err := Parse([]byte(input))
+	if err == nil {
+		t.Fatal("expected error for overwriting dotted-key table with scalar")
+	}
+}
+
+func TestParse_RejectsAOTOverwrite(t *testing.T) {
+	input := "[[parent.arr]]\n[parent]\narr = 2\n"
+	_, err := Parse([]byte(input))
+	if err == nil {
+		t.Fatal("expected error for overwriting array of tables with scalar")
+	}
+}
+
+// --- TOML 1.1 feature tests ---
+
+func TestParse_EscapeE(t *testing.T) {
+	input := "s = \"hello\\eworld\"\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	kv := d.nodes[0].(*KeyValue)
+	if kv.val.Type() != NodeString {
+		t.Fatalf("expected string, got %v", kv.val.Type())
+	}
+	got := d.String()
+	if got != input {
+		t.Fatalf("round-trip failed\nwant: %q\ngot:  %q", input, got)
+	}
+}
+
+func TestParse_HexEscape(t *testing.T) {
+	input := "s = \"caf\\xE9\"\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	kv := d.nodes[0].(*KeyValue)
+	if kv.val.Type() != NodeString {
+		t.Fatalf("expected string, got %v", kv.val.Type())
+	}
+}
+
+func TestParse_MultiLineInlineTable(t *testing.T) {
+	input := "point = {\n  x = 1,\n  y = 2,\n}\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	kv := d.nodes[0].(*KeyValue)
+	it, ok := kv.val.(*InlineTableNode)
+	if !ok {
+		t.Fatalf("expected InlineTableNode, got %T", kv.val)
+	}
+	if len(it.entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(it.entries))
+	}
+}
+
+func TestParse_TrailingCommaInlineTable(t *testing.T) {
+	input := "point = {x = 1, y = 2,}\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	kv := d.nodes[0].(*KeyValue)
+	it, ok := kv.val.(*InlineTableNode)
+	if !ok {
+		t.Fatalf("expected InlineTableNode, got %T", kv.val)
+	}
+	if len(it.entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(it.entries))
+	}
+}
+
+func TestParse_DateTimeNoSeconds(t *testing.T) {
+	tests := []struct {
+		input string
+	}{
+		{"t = 07:32\n"},
+		{"dt = 1979-05-27T07:32Z\n"},
+		{"dt = 1979-05-27T07:32+00:00\n"},
+		{"dt = 1979-05-27T07:32\n"},
+	}
+	for _, tt := range tests {
+		d, err := Parse([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("parse error for %q: %v", tt.input, err)
+		}
+		kv := d.nodes[0].(*KeyValue)
+		if kv.val.Type() != NodeDateTime {
+			t.Fatalf("for %q: expected datetime, got %v", tt.input, kv.val.Type())
+		}
+	}
+}
+
+func TestParse_RejectsBareCarriageReturn(t *testing.T) {
+	// Bare \r (not followed by \n) in multi-line basic string
+	input := "s = \"\"\"\nhello\rworld\"\"\"\n"
+	_, err := Parse([]byte(input))
+	if err == nil {
+		t.Fatal("expected error for bare carriage return in multi-line basic string")
+	}
+}
+
+func TestParse_RejectsBareCarriageReturnLiteral(t *testing.T) {
+	// Bare \r (not followed by \n) in multi-line literal string
+	input := "s = '''\nhello\rworld'''\n"
+	_, err := Parse([]byte(input))
+	if err == nil {
+		t.Fatal("expected error for bare carriage return in multi-line literal string")
+	}
+}
+
+func TestParse_AllowsCRLFInMultiLineString(t *testing.T) {
+	// \r\n is valid in multi-line strings
+	input := "s = \"\"\"\r\nhello\r\nworld\"\"\"\n"
+	_, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error for CRLF in multi-line string: %v", err)
+	}
+}
+
+// --- Coverage: accessor methods on KeyValue ---
+
+func TestKeyValue_KeyParts(t *testing.T) {
+	d, err := Parse([]byte("a.b = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := d.nodes[0].(*KeyValue)
+	parts := kv.KeyParts()
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 key parts, got %d", len(parts))
+	}
+	if parts[0].Unquoted != "a" || parts[1].Unquoted != "b" {
+		t.Fatalf("unexpected parts: %v", parts)
+	}
+	// Ensure it returns a copy (mutating the returned slice should not affect original).
+	parts[0].Unquoted = "z"
+	if kv.KeyParts()[0].Unquoted != "a" {
+		t.Fatal("KeyParts should return a defensive copy")
+	}
+}
+
+func TestKeyValue_RawVal(t *testing.T) {
+	d, err := Parse([]byte(`key = "hello"` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := d.nodes[0].(*KeyValue)
+	if kv.RawVal() != `"hello"` {
+		t.Fatalf("expected raw val %q, got %q", `"hello"`, kv.RawVal())
+	}
+}
+
+func TestKeyValue_Text(t *testing.T) {
+	d, err := Parse([]byte("key = 42\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := d.nodes[0].(*KeyValue)
+	text := kv.Text()
+	if text != "key = 42" {
+		t.Fatalf("expected %q, got %q", "key = 42", text)
+	}
+}
+
+func TestKeyValue_TextNilVal(t *testing.T) {
+	// This tests the nil-val branch in Text().
+	kv := &KeyValue{
+		rawKey: "k",
+		preEq:  " ",
+		postEq: " ",
+	}
+	text := kv.Text()
+	if text != "k = " {
+		t.Fatalf("expected %q, got %q", "k = ", text)
+	}
+}
+
+func TestKeyValue_Children(t *testing.T) {
+	d, err := Parse([]byte("key = 42  # comment\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := d.nodes[0].(*KeyValue)
 	children := kv.Children()
 	// Should contain: val + trailing trivia (whitespace, comment).
 	if len(children) < 2 {
@@ -801,8 +1510,8 @@ func TestKeyValue_SetTrailingTrivia(t *testing.T) {
 	}
 	kv := d.nodes[0].(*KeyValue)
 
-	ws := &WhitespaceNode{leafNode: newLeaf(NodeWhitespace, "  ")}
-	cn := &CommentNode{leafNode: newLeaf(NodeComment, "# yo")}
+	ws := &WhitespaceNode{leafNode: newLeaf("  ")}
+	cn := &CommentNode{leafNode: newLeaf("# yo")}
 	if err := kv.SetTrailingTrivia([]Node{ws, cn}); err != nil {
 		t.Fatal(err)
 	}
@@ -899,7 +1608,7 @@ type triviaSetterNode interface {
 
 func testSetTrivia(t *testing.T, node triviaSetterNode) {
 	t.Helper()
-	ws := &WhitespaceNode{leafNode: newLeaf(NodeWhitespace, " ")}
+	ws := &WhitespaceNode{leafNode: newLeaf(" ")}
 
 	if err := node.SetLeadingTrivia([]Node{ws}); err != nil {
 		t.Fatal(err)
@@ -1101,72 +1810,170 @@ func TestParse_OrphanTriviaAfterTable(t *testing.T) {
 		t.Fatal(err)
 	}
 	tbl := d.nodes[0].(*TableNode)
-	lastEntry := tbl.entries[len(tbl.entries)-1]
-	kv := lastEntry.(*KeyValue)
-	hasComment := false
-	for _, n := range kv.trailingTrivia {
-		if n.Type() == NodeComment {
-			hasComment = true
-		}
+	kv := tbl.entries[len(tbl.entries)-1].(*KeyValue)
+	if len(kv.trailing()) != 0 {
+		t.Fatalf("orphan trivia attached to last KV: %v", kv.trailing())
 	}
-	if !hasComment {
-		t.Fatal("expected orphan comment attached to last KV of table")
+	if body := tbl.TrailingBodyTrivia(); len(body) != 1 || body[0].Type() != NodeComment || body[0].Parent() != tbl {
+		t.Fatalf("expected orphan comment in the table's body trivia, got %v", body)
 	}
 }
 
-func TestParse_OrphanTriviaAfterAOT(t *testing.T) {
-	input := "[[a]]\nk = 1\n# orphan"
-	d, err := Parse([]byte(input))
-	if err != nil {
-		t.Fatal(err)
+func TestParse_TrailingBodyTrivia(t *testing.T) {
+	src := "[a]\nx = 1\n\n# end of a\n\n# about b\n[b]\ny = 2 # c\n\n# end\n\n"
+	d := mustParse(t, src)
+	if got := d.String(); got != src {
+		t.Fatalf("round trip:\n%q\nwant\n%q", got, src)
 	}
-	aot := d.nodes[0].(*ArrayOfTables)
-	lastEntry := aot.entries[len(aot.entries)-1]
-	kv := lastEntry.(*KeyValue)
-	hasComment := false
-	for _, n := range kv.trailingTrivia {
-		if n.Type() == NodeComment {
-			hasComment = true
-		}
+	a, b := d.Table("a"), d.Table("b")
+	if got := triviaText(a.TrailingBodyTrivia()); got != "\n# end of a\n" {
+		t.Errorf("a body trivia = %q", got)
 	}
-	if !hasComment {
-		t.Fatal("expected orphan comment attached to last KV of AOT")
+	if got := triviaText(b.LeadingTrivia()); got != "\n# about b\n" {
+		t.Errorf("b leading trivia = %q", got)
+	}
+	if got := triviaText(b.TrailingBodyTrivia()); got != "" {
+		t.Errorf("b body trivia = %q", got)
+	}
+	if got := triviaText(d.Epilogue()); got != "\n# end\n\n" {
+		t.Errorf("epilogue = %q", got)
 	}
-}
 
-func TestParse_OrphanTriviaNoNodes(t *testing.T) {
-	// Document with only whitespace and comments.
-	input := "# just a comment\n"
-	d, err := Parse([]byte(input))
-	if err != nil {
-		t.Fatal(err)
+	for _, tbl := range []*TableNode{a, b} {
+		kv, _ := NewKeyValue("z", NewInteger(3))
+		if err := tbl.Append(kv); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
 	}
-	if len(d.nodes) == 0 {
-		t.Fatal("expected the comment/whitespace to be in nodes")
+	want := "[a]\nx = 1\nz = 3\n\n# end of a\n\n# about b\n[b]\ny = 2 # c\nz = 3\n\n# end\n\n"
+	if got := d.String(); got != want {
+		t.Errorf("after Append:\n%q\nwant\n%q", got, want)
+	}
+	spans := d.Spans()
+	for _, n := range a.TrailingBodyTrivia() {
+		if sp := spans[n]; want[sp.Start:sp.End] != n.Text() {
+			t.Errorf("span of %q covers %q", n.Text(), want[sp.Start:sp.End])
+		}
 	}
-}
 
-func TestParse_OrphanTriviaAfterTableNoKV(t *testing.T) {
-	// Table with no KV entries, followed by trailing trivia.
-	input := "[t]\n# trailing"
-	d, err := Parse([]byte(input))
-	if err != nil {
-		t.Fatal(err)
+	c, _ := NewComment("# closing")
+	nl, _ := NewWhitespace("\n")
+	if err := a.SetTrailingBodyTrivia([]Node{c, nl}); err != nil || c.Parent() != a {
+		t.Fatalf("SetTrailingBodyTrivia: %v", err)
 	}
-	// The orphan trivia should be attached as entries to the table.
-	tbl := d.nodes[0].(*TableNode)
-	if len(tbl.entries) == 0 {
-		t.Fatal("expected trivia to be in table entries")
+	if !strings.Contains(d.String(), "z = 3\n# closing\n\n# about b") {
+		t.Errorf("after SetTrailingBodyTrivia:\n%s", d.String())
 	}
 }
 
-// --- Coverage: literal string keys (unquoteLiteralStr) ---
-
-func TestParse_LiteralStringKey(t *testing.T) {
-	input := "'literal-key' = 1\n"
-	d, err := Parse([]byte(input))
-	if err != nil {
-		t.Fatal(err)
+func TestDocument_PrologueEpilogue(t *testing.T) {
+	src := "# License\n\n# about title\ntitle = 1\n[t]\nk = 1\n\n# footer\n"
+	d := mustParse(t, src)
+	if got := d.String(); got != src {
+		t.Fatalf("round trip:\n%q\nwant\n%q", got, src)
+	}
+	if got := triviaText(d.Prologue()); got != "# License\n" {
+		t.Errorf("prologue = %q", got)
+	}
+	if got := triviaText(d.Get("title").LeadingTrivia()); got != "\n# about title\n" {
+		t.Errorf("title leading trivia = %q", got)
+	}
+	if got := triviaText(d.Epilogue()); got != "\n# footer\n" {
+		t.Errorf("epilogue = %q", got)
+	}
+	var walked []Node
+	d.Walk(func(n Node) bool {
+		walked = append(walked, n)
+		return true
+	})
+	if walked[1] != d.Prologue()[0] || walked[len(walked)-1] != d.Epilogue()[2] {
+		t.Errorf("Walk does not visit the prologue and epilogue first and last")
+	}
+
+	if err := d.AppendRaw("[u]\nv = 2\n"); err != nil {
+		t.Fatalf("AppendRaw: %v", err)
+	}
+	if got, want := d.String(), "# License\n\n# about title\ntitle = 1\n[t]\nk = 1\n[u]\nv = 2\n\n# footer\n"; got != want {
+		t.Errorf("after AppendRaw:\n%q\nwant\n%q", got, want)
+	}
+
+	c, _ := NewComment("# Copyright")
+	nl, _ := NewWhitespace("\n")
+	if err := d.SetPrologue([]Node{c, nl}); err != nil || c.Parent() != d {
+		t.Fatalf("SetPrologue: %v", err)
+	}
+	if err := d.SetEpilogue(nil); err != nil {
+		t.Fatalf("SetEpilogue: %v", err)
+	}
+	if got, want := d.String(), "# Copyright\n\n# about title\ntitle = 1\n[t]\nk = 1\n[u]\nv = 2\n"; got != want {
+		t.Errorf("after setters:\n%q\nwant\n%q", got, want)
+	}
+	if err := d.SetPrologue([]Node{NewInteger(1)}); err == nil {
+		t.Error("SetPrologue accepted a value node")
+	}
+}
+
+func TestDocument_UncommentPrologue(t *testing.T) {
+	d := mustParse(t, "# port = 8080\n\n[server]\nhost = \"a\"\n")
+	if err := d.Uncomment("port"); err != nil {
+		t.Fatalf("Uncomment: %v", err)
+	}
+	if got, want := d.String(), "port = 8080\n\n[server]\nhost = \"a\"\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func triviaText(nodes []Node) string {
+	var b strings.Builder
+	serializeTrivia(&b, nodes)
+	return b.String()
+}
+
+func TestParse_OrphanTriviaAfterAOT(t *testing.T) {
+	input := "[[a]]\nk = 1\n# orphan"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aot := d.nodes[0].(*ArrayOfTables)
+	if body := aot.TrailingBodyTrivia(); len(body) != 1 || body[0].Type() != NodeComment {
+		t.Fatalf("expected orphan comment in the AOT's body trivia, got %v", body)
+	}
+}
+
+func TestParse_OrphanTriviaNoNodes(t *testing.T) {
+	// Document with only whitespace and comments.
+	input := "# just a comment\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.nodes) != 0 || len(d.Prologue()) != 2 || d.Prologue()[0].Parent() != d {
+		t.Fatal("expected the comment/whitespace to be the prologue")
+	}
+}
+
+func TestParse_OrphanTriviaAfterTableNoKV(t *testing.T) {
+	// Table with no KV entries, followed by trailing trivia.
+	input := "[t]\n# trailing"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The orphan trivia should be the table's body trivia.
+	tbl := d.nodes[0].(*TableNode)
+	if len(tbl.entries) != 0 || len(tbl.bodyTrivia) == 0 {
+		t.Fatal("expected trivia to be in table body trivia")
+	}
+}
+
+// --- Coverage: literal string keys (unquoteLiteralStr) ---
+
+func TestParse_LiteralStringKey(t *testing.T) {
+	input := "'literal-key' = 1\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatal(err)
 	}
 	kv := d.nodes[0].(*KeyValue)
 	if kv.keyParts[0].Unquoted != "literal-key" {
@@ -1198,7 +2005,7 @@ func TestStringNode_Value_BasicEscapes(t *testing.T) {
 		{`"cr\r"`, "cr\r"},
 	}
 	for _, tt := range tests {
-		n := &StringNode{leafNode: newLeaf(NodeString, tt.raw)}
+		n := &StringNode{leafNode: newLeaf(tt.raw)}
 		got := n.Value()
 		if got != tt.want {
 			t.Errorf("Value() for %q: got %q, want %q", tt.raw, got, tt.want)
@@ -1207,14 +2014,14 @@ func TestStringNode_Value_BasicEscapes(t *testing.T) {
 }
 
 func TestStringNode_Value_SingleQuote(t *testing.T) {
-	n := &StringNode{leafNode: newLeaf(NodeString, "'hello'")}
+	n := &StringNode{leafNode: newLeaf("'hello'")}
 	if n.Value() != "hello" {
 		t.Fatalf("expected 'hello', got %q", n.Value())
 	}
 }
 
 func TestStringNode_Value_TooShort(t *testing.T) {
-	n := &StringNode{leafNode: newLeaf(NodeString, "x")}
+	n := &StringNode{leafNode: newLeaf("x")}
 	if n.Value() != "x" {
 		t.Fatalf("expected 'x', got %q", n.Value())
 	}
@@ -1236,7 +2043,7 @@ func TestNumberNode_Int(t *testing.T) {
 		{"1_000", 1000},
 	}
 	for _, tt := range tests {
-		n := &NumberNode{leafNode: newLeaf(NodeNumber, tt.text)}
+		n := &NumberNode{leafNode: newLeaf(tt.text)}
 		got, err := n.Int()
 		if err != nil {
 			t.Errorf("Int() for %q: %v", tt.text, err)
@@ -1251,7 +2058,7 @@ func TestNumberNode_Int(t *testing.T) {
 func TestNumberNode_Int_Errors(t *testing.T) {
 	errCases := []string{"3.14", "1e2", "inf", "+inf", "nan"}
 	for _, text := range errCases {
-		n := &NumberNode{leafNode: newLeaf(NodeNumber, text)}
+		n := &NumberNode{leafNode: newLeaf(text)}
 		_, err := n.Int()
 		if err == nil {
 			t.Errorf("Int() for %q: expected error", text)
@@ -1274,7 +2081,7 @@ func TestNumberNode_Float(t *testing.T) {
 		{"0b10", 2.0},
 	}
 	for _, tt := range tests {
-		n := &NumberNode{leafNode: newLeaf(NodeNumber, tt.text)}
+		n := &NumberNode{leafNode: newLeaf(tt.text)}
 		got, err := n.Float()
 		if err != nil {
 			t.Errorf("Float() for %q: %v", tt.text, err)
@@ -1300,7 +2107,7 @@ func TestNumberNode_Float_SpecialValues(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.text, func(t *testing.T) {
-			n := &NumberNode{leafNode: newLeaf(NodeNumber, tt.text)}
+			n := &NumberNode{leafNode: newLeaf(tt.text)}
 			v, err := n.Float()
 			if err != nil {
 				t.Fatalf("Float() error: %v", err)
@@ -1319,11 +2126,11 @@ func TestNumberNode_Float_SpecialValues(t *testing.T) {
 }
 
 func TestBooleanNode_Value(t *testing.T) {
-	bt := &BooleanNode{leafNode: newLeaf(NodeBoolean, "true")}
+	bt := &BooleanNode{leafNode: newLeaf("true")}
 	if !bt.Value() {
 		t.Fatal("expected true")
 	}
-	bf := &BooleanNode{leafNode: newLeaf(NodeBoolean, "false")}
+	bf := &BooleanNode{leafNode: newLeaf("false")}
 	if bf.Value() {
 		t.Fatal("expected false")
 	}
@@ -1562,6 +2369,148 @@ func TestParseError_OutOfRangeLine(t *testing.T) {
 	}
 }
 
+func TestParseError_HintsAndSuggestions(t *testing.T) {
+	tests := []struct {
+		name, src, summary, hint string
+	}{
+		{
+			"duplicate key near sibling",
+			"[server]\nhost = 1\n[servr]\nhost = 1\nhost = 2\n",
+			`duplicate key "servr.host"; did you mean "server.host"?`,
+			"a key can be defined only once per table",
+		},
+		{
+			"duplicate table",
+			"[alpha]\n[alphas]\n[alphas]\n",
+			`duplicate table: [alphas]; did you mean "alpha"?`,
+			"a [table] header can appear only once; use [[name]] for an array of tables",
+		},
+		{
+			"quoted suggestion",
+			"[\"web server\"]\nport = 1\n[\"web servr\"]\nport = 1\nport = 2\n",
+			`duplicate key "\"web servr\".port"; did you mean "\"web server\".port" or "\"web servr\""?`,
+			"a key can be defined only once per table",
+		},
+		{
+			"no close match",
+			"a = 1\na = 2\n",
+			`duplicate key "a"`,
+			"a key can be defined only once per table",
+		},
+		{
+			"syntax hint",
+			"key value\n",
+			`expected '=', found "value"`,
+			"a key must be followed by '=' and a value",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.src))
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("expected *ParseError, got %v", err)
+			}
+			if pe.Summary() != tt.summary {
+				t.Errorf("Summary() = %q, want %q", pe.Summary(), tt.summary)
+			}
+			if pe.Hint != tt.hint {
+				t.Errorf("Hint = %q, want %q", pe.Hint, tt.hint)
+			}
+			if !strings.Contains(pe.Error(), "= hint: "+tt.hint) {
+				t.Errorf("Error() missing hint:\n%s", pe.Error())
+			}
+		})
+	}
+}
+
+func TestParseError_Render(t *testing.T) {
+	e := &ParseError{
+		Message: "bad",
+		Line:    10,
+		Column:  10,
+		Source:  "1\n2\n3\n4\n5\n6\n7\n8\n9\nk = \"é\" x\n11\n",
+		Hint:    "why",
+	}
+	tests := []struct {
+		name string
+		opts ErrorRenderOptions
+		want string
+	}{
+		{"default", ErrorRenderOptions{},
+			"parse error at line 10, column 10: bad\n  10 | k = \"é\" x\n     |         ^\n    = hint: why\n"},
+		{"context", ErrorRenderOptions{ContextLines: 1},
+			"parse error at line 10, column 10: bad\n   9 | 9\n  10 | k = \"é\" x\n     |         ^\n  11 | 11\n    = hint: why\n"},
+		{"compact", ErrorRenderOptions{Compact: true},
+			"parse error at line 10, column 10: bad (hint: why)"},
+		{"no source", ErrorRenderOptions{NoSource: true},
+			"parse error at line 10, column 10: bad\n    = hint: why\n"},
+		{"color", ErrorRenderOptions{Compact: true, Color: true},
+			"\x1b[1;31mparse error\x1b[0m at line 10, column 10: \x1b[1mbad\x1b[0m (hint: why)"},
+	}
+	for _, tt := range tests {
+		if got := e.Render(tt.opts); got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPositionAt(t *testing.T) {
+	src := "a = 1\nk = \"é😀\" x\n"
+	x := strings.Index(src, "x")
+	got := PositionAt(src, x)
+	want := Position{Line: 2, Column: 14, Rune: 10, UTF16: 11}
+	if got != want {
+		t.Errorf("PositionAt = %+v, want %+v", got, want)
+	}
+	if got := PositionAt(src, 0); got != (Position{1, 1, 1, 1}) {
+		t.Errorf("PositionAt(0) = %+v", got)
+	}
+}
+
+func TestParseError_Position(t *testing.T) {
+	_, err := Parse([]byte("k = \"é\" x\n"))
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected *ParseError, got %v", err)
+	}
+	if got := pe.Position(); got != (Position{Line: 1, Column: 10, Rune: 9, UTF16: 9}) {
+		t.Errorf("Position = %+v", got)
+	}
+}
+
+func TestDocument_Position(t *testing.T) {
+	doc, err := Parse([]byte("[t]\n\"ü\" = 1\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	kv := doc.Get(`t."ü"`)
+	p, ok := doc.Position(kv.Val())
+	if !ok || p != (Position{Line: 2, Column: 8, Rune: 7, UTF16: 7}) {
+		t.Errorf("Position = %+v, %v", p, ok)
+	}
+	if _, ok := doc.Position(NewInteger(1)); ok {
+		t.Error("detached node has a position")
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"servr", "server", 1},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
 // --- Coverage: mutate.go constructors and escaping ---
 
 func TestNewFloat_SpecialValues(t *testing.T) {
@@ -1620,7 +2569,7 @@ func TestNewKeyValue_InvalidInputs(t *testing.T) {
 	}
 
 	// Invalid value type.
-	_, err = NewKeyValue("k", &WhitespaceNode{leafNode: newLeaf(NodeWhitespace, " ")})
+	_, err = NewKeyValue("k", &WhitespaceNode{leafNode: newLeaf(" ")})
 	if err == nil {
 		t.Fatal("expected error for invalid value type")
 	}
@@ -1754,7 +2703,7 @@ func TestDocument_InsertAt(t *testing.T) {
 	}
 
 	// Reject invalid node type.
-	badNode := &IdentifierNode{leafNode: newLeaf(NodeIdentifier, "id")}
+	badNode := &IdentifierNode{leafNode: newLeaf("id")}
 	if err := d.InsertAt(0, badNode); err == nil {
 		t.Fatal("expected error for invalid node type")
 	}
@@ -2246,10 +3195,10 @@ func TestDocument_Delete_FromTable(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if !d.Delete("server.host") {
+	if _, ok := d.Delete("server.host"); !ok {
 		t.Fatal("expected to delete server.host")
 	}
-	if d.Delete("server.nonexistent") {
+	if _, ok := d.Delete("server.nonexistent"); ok {
 		t.Fatal("did not expect to delete nonexistent key")
 	}
 }
@@ -2259,7 +3208,7 @@ func TestDocument_Delete_FromAOT(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if !d.Delete("p.name") {
+	if _, ok := d.Delete("p.name"); !ok {
 		t.Fatal("expected to delete p.name")
 	}
 }
@@ -2394,16 +3343,30 @@ func TestParse_DottedKeyWithWhitespaceAroundDots(t *testing.T) {
 	}
 }
 
-// --- Coverage: keyPartsToPath with dotted unquoted ---
-
-func TestKeyPartsToPath_QuotedDotInKey(t *testing.T) {
-	kp := []KeyPart{
-		{Unquoted: "a.b", IsQuoted: true},
-		{Unquoted: "c"},
+func TestValidate_ExoticQuotedKeys(t *testing.T) {
+	// Each pair has the same unquoted segments joined by dots, but names
+	// different keys.
+	valid := []string{
+		"'a.b' = 1\n'\"a'.'b\"' = 2\n",
+		"[x]\n\"y\\nz\" = 1\n[\"x\\ny\"]\nz = 2\n",
+		"\"2:ab\" = 1\n\"2\".ab = 2\n",
+		"[[a]]\nb = 1\n[a2]\nb = 2\n[[a]]\nb = 3\n",
+	}
+	for _, src := range valid {
+		if _, err := Parse([]byte(src)); err != nil {
+			t.Errorf("Parse(%q) = %v", src, err)
+		}
 	}
-	path := keyPartsToPath(kp)
-	if path != `"a.b".c` {
-		t.Fatalf("expected %q, got %q", `"a.b".c`, path)
+	invalid := map[string]string{
+		"'a\"b' = 1\n\"a\\\"b\" = 2\n":   `duplicate key "\"a\\\"b\""`,
+		"t = { 'x.y' = 1, 'x.y' = 2 }\n": `duplicate key "\"x.y\"" in inline table`,
+		"[[a]]\n[a.'b.c']\n[a.'b.c']\n":  `duplicate table: [a."b.c"]`,
+	}
+	for src, msg := range invalid {
+		var pe *ParseError
+		if _, err := Parse([]byte(src)); !errors.As(err, &pe) || pe.Message != msg {
+			t.Errorf("Parse(%q) = %v, want %s", src, err, msg)
+		}
 	}
 }
 
@@ -2415,7 +3378,7 @@ func TestKeyValue_SetLeadingTrivia(t *testing.T) {
 		t.Fatal(err)
 	}
 	kv := d.nodes[0].(*KeyValue)
-	ws := &WhitespaceNode{leafNode: newLeaf(NodeWhitespace, "  ")}
+	ws := &WhitespaceNode{leafNode: newLeaf("  ")}
 	if err := kv.SetLeadingTrivia([]Node{ws}); err != nil {
 		t.Fatal(err)
 	}
@@ -2482,7 +3445,7 @@ func TestParse_ArrayOfInlineTables(t *testing.T) {
 
 func TestMultiLineBasic_IncompleteHexEscape(t *testing.T) {
 	// Test incomplete \x escape fallback in multiline context.
-	n := &StringNode{leafNode: newLeaf(NodeString, "\"\"\"\n\\xZ\"\"\"")}
+	n := &StringNode{leafNode: newLeaf("\"\"\"\n\\xZ\"\"\"")}
 	v := n.Value()
 	if !strings.Contains(v, `\x`) {
 		t.Fatalf("expected fallback \\x, got %q", v)
@@ -2490,7 +3453,7 @@ func TestMultiLineBasic_IncompleteHexEscape(t *testing.T) {
 }
 
 func TestMultiLineBasic_IncompleteUnicodeEscape(t *testing.T) {
-	n := &StringNode{leafNode: newLeaf(NodeString, "\"\"\"\n\\u00\"\"\"")}
+	n := &StringNode{leafNode: newLeaf("\"\"\"\n\\u00\"\"\"")}
 	v := n.Value()
 	if !strings.Contains(v, `\u`) {
 		t.Fatalf("expected fallback \\u, got %q", v)
@@ -2498,7 +3461,7 @@ func TestMultiLineBasic_IncompleteUnicodeEscape(t *testing.T) {
 }
 
 func TestMultiLineBasic_IncompleteUnicodeEscape8(t *testing.T) {
-	n := &StringNode{leafNode: newLeaf(NodeString, "\"\"\"\n\\U0001\"\"\"")}
+	n := &StringNode{leafNode: newLeaf("\"\"\"\n\\U0001\"\"\"")}
 	v := n.Value()
 	if !strings.Contains(v, `\U`) {
 		t.Fatalf("expected fallback \\U, got %q", v)
@@ -2506,7 +3469,7 @@ func TestMultiLineBasic_IncompleteUnicodeEscape8(t *testing.T) {
 }
 
 func TestMultiLineBasic_TrailingBackslash(t *testing.T) {
-	n := &StringNode{leafNode: newLeaf(NodeString, "\"\"\"\nhello\\\"\"\"")}
+	n := &StringNode{leafNode: newLeaf("\"\"\"\nhello\\\"\"\"")}
 	v := n.Value()
 	if !strings.HasSuffix(v, `\`) {
 		t.Fatalf("expected trailing backslash, got %q", v)
@@ -2515,7 +3478,7 @@ func TestMultiLineBasic_TrailingBackslash(t *testing.T) {
 
 func TestMultiLineBasic_BackslashSpaceNoNewline(t *testing.T) {
 	// backslash + space/tab but no following newline — should keep both
-	n := &StringNode{leafNode: newLeaf(NodeString, "\"\"\"\nhello\\ world\"\"\"")}
+	n := &StringNode{leafNode: newLeaf("\"\"\"\nhello\\ world\"\"\"")}
 	v := n.Value()
 	if !strings.Contains(v, `\ `) {
 		t.Fatalf("expected '\\' followed by space, got %q", v)
@@ -2525,7 +3488,7 @@ func TestMultiLineBasic_BackslashSpaceNoNewline(t *testing.T) {
 // --- Coverage: unknown default escape in parserProcessSingleEscape ---
 
 func TestProcessSingleEscape_DefaultCase(t *testing.T) {
-	n := &StringNode{leafNode: newLeaf(NodeString, "\"\"\"\n\\q\"\"\"")}
+	n := &StringNode{leafNode: newLeaf("\"\"\"\n\\q\"\"\"")}
 	v := n.Value()
 	if !strings.Contains(v, `\q`) {
 		t.Fatalf("expected fallback \\q, got %q", v)
@@ -2903,7 +3866,7 @@ func TestSetValue_DateTimeParent(t *testing.T) {
 
 func TestStringNode_Value_MultiLineBasicCRLFStart(t *testing.T) {
 	// Construct a StringNode whose text starts with """\r\n
-	n := &StringNode{leafNode: newLeaf(NodeString, "\"\"\"\r\nhello\"\"\"")}
+	n := &StringNode{leafNode: newLeaf("\"\"\"\r\nhello\"\"\"")}
 	v := n.Value()
 	if v != "hello" {
 		t.Fatalf("expected 'hello', got %q", v)
@@ -2911,7 +3874,7 @@ func TestStringNode_Value_MultiLineBasicCRLFStart(t *testing.T) {
 }
 
 func TestStringNode_Value_MultiLineLiteralCRLFStart(t *testing.T) {
-	n := &StringNode{leafNode: newLeaf(NodeString, "'''\r\nhello'''")}
+	n := &StringNode{leafNode: newLeaf("'''\r\nhello'''")}
 	v := n.Value()
 	if v != "hello" {
 		t.Fatalf("expected 'hello', got %q", v)
@@ -2922,7 +3885,7 @@ func TestStringNode_Value_MultiLineLiteralCRLFStart(t *testing.T) {
 
 func TestStringNode_Value_MultiLineBackslashCRLF(t *testing.T) {
 	// Backslash followed by \r\n should skip the line ending and following whitespace.
-	n := &StringNode{leafNode: newLeaf(NodeString, "\"\"\"\nhello \\\r\n  world\"\"\"")}
+	n := &StringNode{leafNode: newLeaf("\"\"\"\nhello \\\r\n  world\"\"\"")}
 	v := n.Value()
 	if v != "hello world" {
 		t.Fatalf("expected 'hello world', got %q", v)
@@ -2947,7 +3910,7 @@ func TestStringNode_Value_MultiLineEscapeSequences(t *testing.T) {
 		{"\"\"\"\n\\n\"\"\"", "\n"},
 	}
 	for _, tt := range tests {
-		n := &StringNode{leafNode: newLeaf(NodeString, tt.raw)}
+		n := &StringNode{leafNode: newLeaf(tt.raw)}
 		got := n.Value()
 		if got != tt.want {
 			t.Errorf("Value() for %q: got %q, want %q", tt.raw, got, tt.want)
@@ -2966,7 +3929,7 @@ func TestStringNode_Value_MultiLineHexEscapes(t *testing.T) {
 		{"\"\"\"\n\\U0001F600\"\"\"", "\U0001F600"},
 	}
 	for _, tt := range tests {
-		n := &StringNode{leafNode: newLeaf(NodeString, tt.raw)}
+		n := &StringNode{leafNode: newLeaf(tt.raw)}
 		got := n.Value()
 		if got != tt.want {
 			t.Errorf("Value() for %q: got %q, want %q", tt.raw, got, tt.want)
@@ -3245,269 +4208,1514 @@ func TestParse_RejectsAOTIntermediateInlinePath(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error for AOT intermediate through inline table")
 	}
-}
+}
+
+func TestParse_RejectsAOTIntermediateStaticArrayPath(t *testing.T) {
+	input := "x = [1]\n[[x.y]]\nk = 1\n"
+	_, err := Parse([]byte(input))
+	if err == nil {
+		t.Fatal("expected error for AOT intermediate through static array")
+	}
+}
+
+// --- Coverage: mutate.go TableNode InsertAt with document context error ---
+
+func TestTableNode_InsertAt_WithDocument_Error(t *testing.T) {
+	d, err := Parse([]byte("[t]\na = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl := d.Table("t")
+	kv, _ := NewKeyValue("a", NewInteger(2)) // duplicate
+	if err := tbl.InsertAt(0, kv); err == nil {
+		t.Fatal("expected error for duplicate key in table InsertAt")
+	}
+	if len(tbl.entries) != 1 {
+		t.Fatalf("expected 1 entry after rollback, got %d", len(tbl.entries))
+	}
+}
+
+func TestTableNode_InsertAt_Nil(t *testing.T) {
+	tbl, _ := NewTable("t")
+	if err := tbl.InsertAt(0, nil); err == nil {
+		t.Fatal("expected error for nil entry")
+	}
+}
+
+func TestTableNode_InsertAt_OutOfRange(t *testing.T) {
+	tbl, _ := NewTable("t")
+	kv, _ := NewKeyValue("a", NewInteger(1))
+	if err := tbl.InsertAt(999, kv); err != nil {
+		t.Fatal(err)
+	}
+	if len(tbl.entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(tbl.entries))
+	}
+}
+
+// --- Coverage: mutate.go findInSection - AOT path ---
+
+func TestDocument_Delete_FromAOTDeep(t *testing.T) {
+	d, err := Parse([]byte("[[items]]\nname = \"A\"\nprice = 10\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.Delete("items.name"); !ok {
+		t.Fatal("expected to delete items.name")
+	}
+	if _, ok := d.Delete("items.nonexistent"); ok {
+		t.Fatal("did not expect to delete nonexistent entry")
+	}
+}
+
+// --- Coverage: lexer.go advance at end ---
+
+func TestParse_OnlyNewline(t *testing.T) {
+	d, err := Parse([]byte("\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.String() != "\n" {
+		t.Fatalf("expected \\n, got %q", d.String())
+	}
+}
+
+func TestParse_OnlyCRLF(t *testing.T) {
+	d, err := Parse([]byte("\r\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.String() != "\r\n" {
+		t.Fatalf("expected \\r\\n, got %q", d.String())
+	}
+}
+
+// --- Coverage: parser.go parseValue default branch ---
+
+func TestParse_UnexpectedTokenAsValue(t *testing.T) {
+	_, err := Parse([]byte("k = ]\n"))
+	if err == nil {
+		t.Fatal("expected error for ] as value")
+	}
+}
+
+// --- Coverage: lexer.go scanBareOrValue empty text ---
+
+func TestParse_BareValueErrorToken(t *testing.T) {
+	// Characters that lexer can't classify
+	_, err := Parse([]byte("k = \x80\n"))
+	if err == nil {
+		t.Fatal("expected error for invalid byte in value")
+	}
+}
+
+// --- Coverage: validate.go validateDecimalDigits invalid character ---
+
+func TestParse_InvalidCharInInteger(t *testing.T) {
+	_, err := Parse([]byte("n = 12abc\n"))
+	if err == nil {
+		t.Fatal("expected error for non-digit in integer")
+	}
+}
+
+// --- Coverage: parser.go parseSimpleKey - invalid bare key char ---
+
+func TestParse_InvalidBareKeyChar(t *testing.T) {
+	_, err := Parse([]byte("key! = 1\n"))
+	if err == nil {
+		t.Fatal("expected error for ! in bare key")
+	}
+}
+
+// --- Coverage: parser.go multi-line basic string with 4-5 quotes ---
+
+func TestParse_MultiLineBasicWith5Quotes(t *testing.T) {
+	// Multi-line basic string can contain up to 2 extra quotes at closing:
+	// """""" = """ + content ending in "" + """
+	input := "s = \"\"\"\nhello\"\"\"\"\"\n"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := d.String()
+	if got != input {
+		t.Fatalf("round-trip failed\nwant: %q\ngot:  %q", input, got)
+	}
+}
+
+// --- Coverage: query.go processHexEscape error paths (via multiline) ---
+
+func TestStringNode_Value_MultiLineInvalidHexEscape(t *testing.T) {
+	n := &StringNode{leafNode: newLeaf("\"\"\"\n\\xZZ\"\"\"")}
+	v := n.Value()
+	if !strings.Contains(v, `\x`) {
+		t.Fatalf("expected fallback \\x, got %q", v)
+	}
+}
+
+func TestStringNode_Value_MultiLineInvalidUnicodeEscape4(t *testing.T) {
+	n := &StringNode{leafNode: newLeaf("\"\"\"\n\\uGGGG\"\"\"")}
+	v := n.Value()
+	if !strings.Contains(v, `\u`) {
+		t.Fatalf("expected fallback \\u, got %q", v)
+	}
+}
+
+func TestStringNode_Value_MultiLineInvalidUnicodeEscape8(t *testing.T) {
+	n := &StringNode{leafNode: newLeaf("\"\"\"\n\\UGGGGGGGG\"\"\"")}
+	v := n.Value()
+	if !strings.Contains(v, `\U`) {
+		t.Fatalf("expected fallback \\U, got %q", v)
+	}
+}
+
+// --- Coverage: validate.go checkIntermediatePaths - inline table intermediate ---
+
+func TestParse_RejectsTableThroughInlineTableIntermediate(t *testing.T) {
+	input := "a.b = {x = 1}\n[a.b.x]\nk = 1\n"
+	_, err := Parse([]byte(input))
+	if err == nil {
+		t.Fatal("expected error for table through inline table intermediate")
+	}
+}
+
+// --- Coverage: validate.go checkTablePathConflicts - scalar path ---
+
+func TestParse_RejectsTableOverScalar(t *testing.T) {
+	input := "a = 1\n[a]\nk = 1\n"
+	_, err := Parse([]byte(input))
+	if err == nil {
+		t.Fatal("expected error for table over scalar")
+	}
+}
+
+// --- Coverage: mutate.go parseRawKey whitespace handling ---
+
+func TestNewKeyValue_LeadingWhitespace(t *testing.T) {
+	kv, err := NewKeyValue("  key  ", NewString("val"))
+	if err != nil {
+		t.Fatalf("NewKeyValue: %v", err)
+	}
+	if kv.keyParts[0].Unquoted != "key" {
+		t.Fatalf("expected 'key', got %q", kv.keyParts[0].Unquoted)
+	}
+}
+
+// --- Coverage: validate.go checkPrefixNumber signed prefix ---
+
+func TestParse_RejectsSignedOctal(t *testing.T) {
+	_, err := Parse([]byte("n = -0o7\n"))
+	if err == nil {
+		t.Fatal("expected error for signed octal")
+	}
+}
+
+func TestParse_RejectsSignedBinary(t *testing.T) {
+	_, err := Parse([]byte("n = +0b1\n"))
+	if err == nil {
+		t.Fatal("expected error for signed binary")
+	}
+}
+
+// --- Coverage: validate.go validateFloatExponent dotIdx == eIdx-1 ---
+
+func TestParse_RejectsFloatDotImmediatelyBeforeExponent(t *testing.T) {
+	_, err := Parse([]byte("f = 1.e2\n"))
+	if err == nil {
+		t.Fatal("expected error for dot immediately before exponent")
+	}
+}
+
+// --- Coverage: validate.go checkDecimalLeadingZeros ---
+
+func TestParse_AcceptsZeroBeforeDot(t *testing.T) {
+	d, err := Parse([]byte("f = 0.5\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kv := d.nodes[0].(*KeyValue)
+	if kv.val.Type() != NodeNumber {
+		t.Fatalf("expected number, got %v", kv.val.Type())
+	}
+}
+
+func TestParse_AcceptsZeroBeforeExponent(t *testing.T) {
+	d, err := Parse([]byte("f = 0e1\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kv := d.nodes[0].(*KeyValue)
+	if kv.val.Type() != NodeNumber {
+		t.Fatalf("expected number, got %v", kv.val.Type())
+	}
+}
+
+// --- Coverage: parser.go parserProcessBasicEscapes default branch ---
+
+func TestParserProcessBasicEscapes_UnknownEscape(t *testing.T) {
+	// Call through StringNode.Value
+	n := &StringNode{leafNode: newLeaf(`"\q"`)}
+	v := n.Value()
+	if v != `\q` {
+		t.Fatalf("expected '\\q', got %q", v)
+	}
+}
+
+// --- Coverage: orphan trivia with current table set ---
+
+func TestParse_OrphanTriviaOnTableNoKVGoesToBody(t *testing.T) {
+	input := "[server]\n# comment at end"
+	d, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl := d.nodes[0].(*TableNode)
+	if len(tbl.bodyTrivia) == 0 {
+		t.Fatal("expected trivia to be added to table body trivia")
+	}
+}
+
+// --- Corpus tests ---
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/corpus")
+
+// TestCorpus parses the real-world files in testdata/corpus and checks that
+// they are written back unchanged, and that their values, their formatting
+// with the number-style fixes, and their minified form match the golden
+// files next to them. Run with -update to rewrite the golden files after
+// an intended change.
+func TestCorpus(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "corpus", "*.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		if strings.Count(filepath.Base(path), ".") > 1 {
+			continue // a golden file
+		}
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc, err := Parse(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := doc.String(); got != string(src) {
+				t.Fatalf("round trip changed the file:\n%s", got)
+			}
+			var values strings.Builder
+			enc := json.NewEncoder(&values)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(corpusValue(doc.logicalRoot())); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, path, ".map.json", values.String())
+
+			minified := doc.StringWithOptions(SerializeOptions{Minify: true})
+			checkGolden(t, path, ".min.toml", minified)
+			if _, err := ApplyFixes(doc.Lint(NumberStyle(NumberStyleOptions{}))); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, path, ".format.toml", doc.String())
+
+			orig := mustParse(t, string(src))
+			for name, out := range map[string]string{"minified": minified, "formatted": doc.String()} {
+				if changes := Diff(orig, mustParse(t, out)); len(changes) > 0 {
+					t.Errorf("%s document has different values: %v", name, changes)
+				}
+			}
+		})
+	}
+}
+
+// checkGolden compares got with the golden file for path with the given
+// suffix, or writes it with -update.
+func checkGolden(t *testing.T, path, suffix, got string) {
+	t.Helper()
+	golden := strings.TrimSuffix(path, ".toml") + suffix
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from %s:\n%s", suffix[1:], golden, got)
+	}
+}
+
+// corpusValue converts a logical value to the Go values a decoder would
+// produce, with datetimes as written and non-finite floats as strings so
+// that the result can be encoded as JSON.
+func corpusValue(n *lnode) any {
+	switch n.kind { //nolint:exhaustive
+	case TypeTable:
+		m := make(map[string]any, len(n.fields))
+		for name, c := range n.fields {
+			m[name] = corpusValue(c)
+		}
+		return m
+	case TypeArrayOfTables:
+		list := make([]any, len(n.entries))
+		for i, e := range n.entries {
+			list[i] = corpusValue(e)
+		}
+		return list
+	}
+	return corpusNodeValue(n.kv.val)
+}
+
+func corpusNodeValue(val Node) any {
+	switch v := val.(type) {
+	case *StringNode:
+		return v.Value()
+	case *BooleanNode:
+		return v.Value()
+	case *NumberNode:
+		if i, err := v.Int(); err == nil {
+			return i
+		}
+		f, _ := v.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return f
+	case *ArrayNode:
+		list := make([]any, len(v.elements))
+		for i, elem := range v.elements {
+			list[i] = corpusNodeValue(elem)
+		}
+		return list
+	case *InlineTableNode:
+		t := newLTable(v)
+		for _, e := range v.entries {
+			addLogicalKeyValue(t, e)
+		}
+		return corpusValue(t)
+	}
+	return val.Text()
+}
+
+// --- Benchmarks ---
+
+var benchInput = []byte(`# service config
+title = "bench"
+[server]
+host = "localhost"
+port = 8080
+tags = ["a", "b", "c"]
+limits = { cpu = 2, mem = "1GiB" }
+[[routes]]
+path = "/"
+[[routes]]
+path = "/api"
+`)
+
+func BenchmarkParse(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := Parse(benchInput); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParserPool_ParseInto(b *testing.B) {
+	var pool ParserPool
+	var d Document
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := pool.ParseInto(&d, benchInput); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+var smallInput = []byte(`# cli settings
+name = "tool"
+verbose = false
+color = "auto"
+timeout = 30
+retries = 3
+editor = "vim"
+pager = "less -R"
+theme = "dark"
+paths = ["~/bin", "/usr/local/bin"]
+updated = 2024-01-02T03:04:05Z
+`)
+
+// largeInput is a bulk document of many small records, most of whose
+// nodes are leaves.
+func largeInput() []byte {
+	var b strings.Builder
+	for i := range 2000 {
+		fmt.Fprintf(&b, "# record %d\n[[record]]\nid = %d\nname = \"item-%d\" # label\n", i, i, i)
+		fmt.Fprintf(&b, "values = [%d, %d, %d, %d]\nflags = { on = true, level = %d }\n\n", i, i+1, i+2, i+3, i%5)
+	}
+	return []byte(b.String())
+}
+
+// BenchmarkParse_Large reports the heap a parsed document keeps, in bytes
+// per byte of input, along with the allocations made to parse it.
+func BenchmarkParse_Large(b *testing.B) {
+	in := largeInput()
+	b.SetBytes(int64(len(in)))
+	b.ReportAllocs()
+	var kept uint64
+	for b.Loop() {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		doc, err := Parse(in)
+		if err != nil {
+			b.Fatal(err)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		kept = after.HeapAlloc - before.HeapAlloc
+		runtime.KeepAlive(doc)
+	}
+	b.ReportMetric(float64(kept)/float64(len(in)), "heap/B")
+}
+
+// BenchmarkParseSelect compares reading one value with ParseSelect
+// against Parse, on a large document where nearly everything is skipped.
+func BenchmarkParseSelect(b *testing.B) {
+	in := append([]byte("[package]\nname = \"app\"\nversion = \"1.2.0\"\n\n"), largeInput()...)
+	parse := map[string]func() (*Document, error){
+		"Parse":       func() (*Document, error) { return Parse(in) },
+		"ParseSelect": func() (*Document, error) { return ParseSelect(in, []string{"package.version"}) },
+	}
+	for _, name := range []string{"Parse", "ParseSelect"} {
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(in)))
+			b.ReportAllocs()
+			for b.Loop() {
+				doc, err := parse[name]()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if doc.Get("package.version") == nil {
+					b.Fatal("package.version not found")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParse_Small(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := Parse(smallInput); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseWithOptions_SmallDocumentLimit(t *testing.T) {
+	allocs := func(limit int) float64 {
+		return testing.AllocsPerRun(20, func() {
+			if _, err := ParseWithOptions(smallInput, ParseOptions{SmallDocumentLimit: limit}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	if fast, slow := allocs(0), allocs(-1); fast >= slow {
+		t.Errorf("small document took %v allocations, %v without the fast path", fast, slow)
+	}
+	if _, err := ParseWithOptions(smallInput, ParseOptions{SmallDocumentLimit: 5}); err != nil {
+		t.Errorf("document over the limit: %v", err)
+	}
+
+	src := []byte("name = 1\nnmae = 2\nname = 3\n")
+	var fast, slow *ParseError
+	_, err := Parse(src)
+	_, err2 := ParseWithOptions(src, ParseOptions{SmallDocumentLimit: -1})
+	if !errors.As(err, &fast) || !errors.As(err2, &slow) {
+		t.Fatalf("duplicate key not reported: %v, %v", err, err2)
+	}
+	if fast.Error() != slow.Error() || !slices.Equal(fast.Suggestions, slow.Suggestions) {
+		t.Errorf("fast path error %v %v, want %v %v", fast, fast.Suggestions, slow, slow.Suggestions)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseContext(ctx, smallInput); !errors.Is(err, context.Canceled) {
+		t.Errorf("ParseContext with a canceled context = %v", err)
+	}
+}
+
+func TestParseError_TokenSpan(t *testing.T) {
+	tests := []struct {
+		name, src, token, msg string
+	}{
+		{"unexpected token", "a = 1\nb = = 2\n", "=", `expected value, found "="`},
+		{"end of file", "a =", "", "expected value, found end of file"},
+		{"bad number", "a = 1\nb = 0123\n", "0123", "leading zeros not allowed: 0123"},
+		{"duplicate key", "a = 1\n a = 2\n", "a", `duplicate key "a"`},
+		{"duplicate table", "[t]\n[t]\n", "[t]", "duplicate table: [t]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.src))
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("expected *ParseError, got %v", err)
+			}
+			if pe.Message != tt.msg {
+				t.Errorf("Message = %q, want %q", pe.Message, tt.msg)
+			}
+			if pe.Token != tt.token {
+				t.Errorf("Token = %q, want %q", pe.Token, tt.token)
+			}
+			if got := tt.src[pe.Span.Start:pe.Span.End]; got != tt.token {
+				t.Errorf("source at Span = %q, want %q", got, tt.token)
+			}
+		})
+	}
+}
+
+func TestDocument_StringWithOptions(t *testing.T) {
+	src := "# Header.\n\n\ntitle = \"a # b\" # name\n\n\n\n[server] # main\n  # Port.\n  port = 80\n  hosts = [\n    \"a\", # first\n    # none\n  ]\n\n\n"
+	d, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts SerializeOptions
+		want string
+	}{
+		{"zero", SerializeOptions{}, src},
+		{"strip", SerializeOptions{StripComments: true},
+			"\n\ntitle = \"a # b\"\n\n\n\n[server]\n  port = 80\n  hosts = [\n    \"a\",\n  ]\n\n\n"},
+		{"collapse", SerializeOptions{CollapseBlankLines: true},
+			"# Header.\n\ntitle = \"a # b\" # name\n\n[server] # main\n  # Port.\n  port = 80\n  hosts = [\n    \"a\", # first\n    # none\n  ]\n"},
+		{"both", SerializeOptions{StripComments: true, CollapseBlankLines: true},
+			"title = \"a # b\"\n\n[server]\n  port = 80\n  hosts = [\n    \"a\",\n  ]\n"},
+	}
+	for _, tt := range tests {
+		if got := d.StringWithOptions(tt.opts); got != tt.want {
+			t.Errorf("%s: StringWithOptions() =\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+	}
+	if d.String() != src {
+		t.Error("StringWithOptions changed the document")
+	}
+}
+
+func TestDocument_StringWithOptions_Minify(t *testing.T) {
+	src := `# Settings.
+title = "It's"   # name
+path = 'C:\dir'
+big = 1_000_000
+mask = 0xff
+neg = +5
+"quoted key" = """
+line"""
+
+[server]
+host = "h"
+
+  [server.tls]
+  cert = "c"
+
+[owner.name]
+first = "a"
+
+[[plugin]]
+id = 1
+opts = { a.b = 1, c = [ 1, 2 ] }
+
+[[plugin]]
+id = 2
+`
+	d, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `title="It's"
+path='C:\dir'
+big=1000000
+mask=255
+neg=5
+"quoted key"="line"
+server={host="h",tls.cert="c"}
+owner.name.first="a"
+plugin=[{id=1,opts={a.b=1,c=[1,2]}},{id=2}]
+`
+	got := d.StringWithOptions(SerializeOptions{Minify: true, StripComments: true})
+	if got != want {
+		t.Errorf("Minify =\n%s\nwant\n%s", got, want)
+	}
+	m, err := Parse([]byte(got))
+	if err != nil {
+		t.Fatalf("minified document does not parse: %v", err)
+	}
+	for _, path := range []string{"title", "big", `"quoted key"`, "server.tls.cert", "owner.name.first"} {
+		if !ValuesEqual(m.Get(path).Val(), d.Get(path).Val()) {
+			t.Errorf("%s = %s, want %s", path, m.Get(path).Val().Text(), d.Get(path).Val().Text())
+		}
+	}
+}
+
+func TestParseWithOptions_Templates(t *testing.T) {
+	src := `name = "{{ .name }}"
+port = {{ .Values.port }}
+hosts = [ {{ .a }}, "b" ]
+opts = { x = {{ .x }} }
+{{ .key }} = 1
+app.{{ .env }}.debug = true
+{{- if .tls }}
+[tls] # secured
+cert = {{ .cert | quote }}
+{{- end }}
+mode = 1
+`
+	if _, err := Parse([]byte(src)); err == nil {
+		t.Fatal("Parse accepted template actions without the option")
+	}
+	d, err := ParseWithOptions([]byte(src), ParseOptions{Templates: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.String(); got != src {
+		t.Errorf("String() =\n%s\nwant\n%s", got, src)
+	}
+	kv := d.Get("port")
+	if tn, ok := kv.Val().(*TemplateNode); !ok || tn.Text() != "{{ .Values.port }}" || tn.Type() != NodeTemplate {
+		t.Errorf("port = %#v", kv.Val())
+	}
+	if d.Get(`"{{ .key }}"`) == nil || d.Get("tls.cert") == nil || d.Get(`app."{{ .env }}".debug`) == nil {
+		t.Error("templated keys not found")
+	}
+	if k, _ := d.KindAt("port"); k != TypeAny {
+		t.Errorf("KindAt(port) = %v, want any", k)
+	}
+	tn, err := NewTemplate("{{ .Values.port | default 80 }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.SetValue(tn); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	for _, bad := range []string{"{{ x", "x }}", "{{ a }} {{ b }}"} {
+		if _, err := NewTemplate(bad); err == nil {
+			t.Errorf("NewTemplate(%q) succeeded", bad)
+		}
+	}
+	if _, err := ParseWithOptions([]byte("a = {{ x\n"), ParseOptions{Templates: true}); err == nil {
+		t.Error("unterminated template action parsed")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	for _, src := range []string{"# Config.\na = 1\n", "[t]\nb = 2\n", "# only a comment\n", ""} {
+		d, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyChecksum(d); !errors.Is(err, ErrNoChecksum) {
+			t.Errorf("%q: VerifyChecksum() before SetChecksum = %v", src, err)
+		}
+		want := Checksum(d)
+		SetChecksum(d)
+		if got := d.String(); got != "# "+want+"\n"+src {
+			t.Errorf("%q: SetChecksum() = %q", src, got)
+		}
+		if err := VerifyChecksum(d); err != nil {
+			t.Errorf("%q: VerifyChecksum() = %v", src, err)
+		}
+		reparsed, err := Parse([]byte(d.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyChecksum(reparsed); err != nil {
+			t.Errorf("%q: VerifyChecksum() after reparse = %v", src, err)
+		}
+	}
+
+	d, _ := Parse([]byte("# sha256:00\na = 1\n"))
+	if err := VerifyChecksum(d); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("VerifyChecksum() of a stale checksum = %v", err)
+	}
+	if err := d.Get("a").SetValue(NewInteger(2)); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	n, err := d.WriteTo(&b)
+	if err != nil || n != int64(b.Len()) || b.String() != d.String() {
+		t.Errorf("WriteTo() = %d, %v, wrote %q", n, err, b.String())
+	}
+	if err := VerifyChecksum(d); err != nil {
+		t.Errorf("VerifyChecksum() after WriteTo = %v", err)
+	}
+	crlf, _ := Parse([]byte("a = 1\r\nb = 2\n"))
+	SetChecksum(crlf)
+	if got := crlf.String(); got != "# "+Checksum(crlf)+"\r\na = 1\r\nb = 2\n" {
+		t.Errorf("SetChecksum() of a CRLF document = %q", got)
+	}
+	plain, _ := Parse([]byte("a = 1\n"))
+	b.Reset()
+	if _, err := plain.WriteTo(&b); err != nil || b.String() != "a = 1\n" {
+		t.Errorf("WriteTo() without a checksum wrote %q", b.String())
+	}
+}
+
+func TestEnsureHeader(t *testing.T) {
+	banner := []string{"GENERATED FILE — DO NOT EDIT", "", "Source: gen.go"}
+	tests := []struct{ src, want string }{
+		{"", "# GENERATED FILE — DO NOT EDIT\n#\n# Source: gen.go\n"},
+		{"a = 1\n", "# GENERATED FILE — DO NOT EDIT\n#\n# Source: gen.go\n\na = 1\n"},
+		{"# License\n\n[t]\n", "# GENERATED FILE — DO NOT EDIT\n#\n# Source: gen.go\n\n# License\n\n[t]\n"},
+		{"# GENERATED FILE — DO NOT EDIT\n# Source: old.go\na = 1\n", "# GENERATED FILE — DO NOT EDIT\n#\n# Source: gen.go\na = 1\n"},
+		{"# sha256:00\na = 1\n", "# sha256:00\n# GENERATED FILE — DO NOT EDIT\n#\n# Source: gen.go\n\na = 1\n"},
+	}
+	for _, tt := range tests {
+		d := mustParse(t, tt.src)
+		for range 2 {
+			if err := d.EnsureHeader(banner); err != nil {
+				t.Fatalf("%q: EnsureHeader: %v", tt.src, err)
+			}
+			if got := d.String(); got != tt.want {
+				t.Errorf("%q: got %q, want %q", tt.src, got, tt.want)
+			}
+		}
+	}
+
+	d := mustParse(t, "a = 1\n")
+	if err := d.EnsureHeader([]string{"two\nlines"}); !errors.Is(err, ErrCommentNewline) {
+		t.Errorf("EnsureHeader with a newline = %v", err)
+	}
+	if d.String() != "a = 1\n" {
+		t.Errorf("failed EnsureHeader changed the document: %q", d.String())
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	d := mustParse(t, "# Settings.\nport = 80\n")
+	if IsGenerated(d) || CheckEditable(d, false) != nil {
+		t.Fatal("hand-written document reported as generated")
+	}
+	p := Provenance{Tool: "confgen", Version: "v1.4.0", Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), SourceHash: HashSource([]byte("src"))}
+	if err := StampProvenance(d, p); err != nil {
+		t.Fatal(err)
+	}
+	want := "# GENERATED FILE — DO NOT EDIT\n# tool: confgen\n# version: v1.4.0\n# generated: 2024-05-01T12:00:00Z\n# source: " +
+		p.SourceHash + "\n\n# Settings.\nport = 80\n"
+	if got := d.String(); got != want {
+		t.Errorf("StampProvenance:\n%q\nwant\n%q", got, want)
+	}
+	p.Version, p.SourceHash = "v1.5.0", ""
+	if err := StampProvenance(d, p); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := ReadProvenance(mustParse(t, d.String()))
+	if !ok || got.Tool != "confgen" || got.Version != "v1.5.0" || !got.Time.Equal(p.Time) || got.SourceHash != "" {
+		t.Errorf("ReadProvenance() = %+v, %v", got, ok)
+	}
+	if err := CheckEditable(d, false); !errors.Is(err, ErrGeneratedFile) || !strings.Contains(err.Error(), "confgen") {
+		t.Errorf("CheckEditable() = %v", err)
+	}
+	if err := CheckEditable(d, true); err != nil {
+		t.Errorf("CheckEditable(force) = %v", err)
+	}
+
+	goGen := mustParse(t, "# Code generated by stringer. DO NOT EDIT.\na = 1\n")
+	if _, ok := ReadProvenance(goGen); ok {
+		t.Error("ReadProvenance found a stamp in a Go-style banner")
+	}
+	if err := CheckEditable(goGen, false); !errors.Is(err, ErrGeneratedFile) {
+		t.Errorf("CheckEditable() of a Go-style banner = %v", err)
+	}
+}
+
+// manualWatcher is a FileWatcher whose changes are reported by the test.
+type manualWatcher struct{ changed func() }
+
+func (m *manualWatcher) Watch(_ string, changed func()) (func(), error) {
+	m.changed = changed
+	return func() {}, nil
+}
+
+type watchResult struct {
+	doc *Document
+	err error
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	write := func(s string) {
+		if err := os.WriteFile(path, []byte(s), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	next := func(ch <-chan watchResult) watchResult {
+		select {
+		case r := <-ch:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("no change delivered")
+			return watchResult{}
+		}
+	}
+	write("a = 1\n")
+	m := &manualWatcher{}
+	results := make(chan watchResult, 10)
+	opts := WatchOptions{Watcher: m, Debounce: time.Millisecond, Retries: 20, RetryDelay: 20 * time.Millisecond}
+	stop, err := WatchWithOptions(path, opts, func(d *Document, err error) { results <- watchResult{d, err} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	m.changed() // content unchanged: nothing delivered
+	write("a = 2\n")
+	m.changed()
+	m.changed()
+	if r := next(results); r.err != nil || r.doc.Get("a").Val().Text() != "2" {
+		t.Fatalf("first change = %v, %v", r.doc, r.err)
+	}
+
+	// A half-written file is retried until the writer finishes.
+	write("a = ")
+	m.changed()
+	time.Sleep(30 * time.Millisecond)
+	write("a = 3\n")
+	if r := next(results); r.err != nil || r.doc.Get("a").Val().Text() != "3" {
+		t.Fatalf("change after partial write = %v, %v", r.doc, r.err)
+	}
+
+	// A file that stays invalid is reported once retries run out.
+	write("a = \n")
+	m.changed()
+	if r := next(results); r.err == nil || r.doc != nil {
+		t.Fatalf("invalid file = %v, %v", r.doc, r.err)
+	}
+	select {
+	case r := <-results:
+		t.Errorf("unexpected extra delivery %v, %v", r.doc, r.err)
+	default:
+	}
+	stop()
+	stop()
+
+	if _, err := Watch(filepath.Join(t.TempDir(), "missing.toml"), func(*Document, error) {}); err == nil {
+		t.Error("Watch of a missing file succeeded")
+	}
+}
+
+func TestPollWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("a = 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	changed := make(chan struct{}, 10)
+	stop, err := PollWatcher{Interval: 5 * time.Millisecond}.Watch(path, func() { changed <- struct{}{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if err := os.WriteFile(path, []byte("a = 12\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not reported")
+	}
+}
+
+func mustParse(t *testing.T, src string) *Document {
+	t.Helper()
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestDiff(t *testing.T) {
+	from := mustParse(t, `# old
+name = "app"
+port = 0x1F90
+tags = ["a", "b"]
+
+[db]
+host = "localhost"
+pool = { size = 4, idle = 2 }
+
+[[servers]]
+ip = "10.0.0.1"
+
+[[servers]]
+ip = "10.0.0.2"
+`)
+	to := mustParse(t, `name = 'app'
+port = 8081
+tags = ["a", "b"]
+db.host = "localhost"
+db.pool.size = 8
+db.timeout = 30
+
+[[servers]]
+ip = "10.0.0.1"
+`)
+	var got []string
+	for _, c := range Diff(from, to) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"port: modified",
+		"db.pool.size: modified",
+		"db.pool.idle: removed",
+		"db.timeout: added",
+		"servers[1].ip: removed",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Diff = %q, want %q", got, want)
+	}
+
+	changes := Diff(from, to)
+	if c := changes[0]; c.Old.Val().Text() != "0x1F90" || c.New.Val().Text() != "8081" {
+		t.Errorf("port change = %v -> %v", c.Old.Val(), c.New.Val())
+	}
+	if c := changes[2]; c.New != nil || c.Old.Val().Text() != "2" {
+		t.Errorf("removed change = %+v", c)
+	}
+	if c := changes[3]; c.Old != nil || c.New.Val().Text() != "30" {
+		t.Errorf("added change = %+v", c)
+	}
+	if changes := Diff(from, mustParse(t, from.String()+"# trailing edit\nx = 1\n")); len(changes) != 1 || changes[0].Path != "servers[1].x" {
+		t.Errorf("Diff with a key added to the last entry = %v", changes)
+	}
+	if changes := Diff(mustParse(t, "a = { b = 1 }\n"), mustParse(t, "a = 1\n")); len(changes) != 2 ||
+		changes[0].String() != "a.b: removed" || changes[1].String() != "a: added" {
+		t.Errorf("Diff of a table replaced by a value = %v", changes)
+	}
+	aot, inline := mustParse(t, "[[s]]\na = 1\n[[s]]\na = 2\n"), mustParse(t, "s = [{ a = 1 }, { a = 3 }]\n")
+	if changes := Diff(aot, inline); len(changes) != 1 || changes[0].String() != "s[1].a: modified" {
+		t.Errorf("Diff of an array of tables and inline tables = %v", changes)
+	}
+	if changes := Diff(from, from); len(changes) != 0 {
+		t.Errorf("Diff of a document with itself = %v", changes)
+	}
+}
+
+func TestWatchDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	write := func(s string) {
+		if err := os.WriteFile(path, []byte(s), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	type delivery struct {
+		old, updated *Document
+		changes      []Change
+		err          error
+	}
+	write("[log]\nlevel = \"info\"\n\n[http]\nport = 80\n")
+	m := &manualWatcher{}
+	results := make(chan delivery, 10)
+	opts := WatchOptions{Watcher: m, Debounce: time.Millisecond, Retries: -1}
+	doc, stop, err := WatchDiff(path, opts,
+		func(old, updated *Document, changes []Change) { results <- delivery{old, updated, changes, nil} },
+		func(err error) { results <- delivery{err: err} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if doc.Get("http.port") == nil {
+		t.Fatalf("initial document = %q", doc)
+	}
+	next := func() delivery {
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("no change delivered")
+			return delivery{}
+		}
+	}
+
+	write("[log] # logging\nlevel = \"info\"\n\n[http]\nport = 80\n")
+	m.changed() // a comment-only edit is not delivered
+	write("[log]\nlevel = \"info\"\n\n[http]\nport = 8080\n")
+	m.changed()
+	r := next()
+	if r.err != nil || r.old != doc || len(r.changes) != 1 || r.changes[0].String() != "http.port: modified" {
+		t.Fatalf("first delivery = %+v", r)
+	}
+	first := r.updated
 
-func TestParse_RejectsAOTIntermediateStaticArrayPath(t *testing.T) {
-	input := "x = [1]\n[[x.y]]\nk = 1\n"
-	_, err := Parse([]byte(input))
-	if err == nil {
-		t.Fatal("expected error for AOT intermediate through static array")
+	write("[log\n")
+	m.changed()
+	if r := next(); r.err == nil {
+		t.Fatalf("invalid file delivered %+v", r)
+	}
+	write("[log]\nlevel = \"debug\"\n\n[http]\nport = 8080\n")
+	m.changed()
+	r = next()
+	if r.err != nil || r.old != first || len(r.changes) != 1 || r.changes[0].Path != "log.level" {
+		t.Fatalf("delivery after an error = %+v", r)
 	}
-}
 
-// --- Coverage: mutate.go TableNode InsertAt with document context error ---
+	write("[log\n")
+	if _, _, err := WatchDiff(path, opts, func(*Document, *Document, []Change) {}, nil); err == nil {
+		t.Error("WatchDiff of an invalid file succeeded")
+	}
+}
 
-func TestTableNode_InsertAt_WithDocument_Error(t *testing.T) {
-	d, err := Parse([]byte("[t]\na = 1\n"))
+func TestToEnv(t *testing.T) {
+	d := mustParse(t, `name = "app"
+[server]
+port = 0x1F90
+hosts = ["a", "b"]
+tls = { cert = "a.pem" }
+"max-conns" = 1_000
+[[servers]]
+ip = "10.0.0.1"
+when = 2024-01-02T03:04:05Z
+`)
+	env, err := d.ToEnv("APP", EnvOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	tbl := d.Table("t")
-	kv, _ := NewKeyValue("a", NewInteger(2)) // duplicate
-	if err := tbl.InsertAt(0, kv); err == nil {
-		t.Fatal("expected error for duplicate key in table InsertAt")
+	want := []string{
+		"APP_NAME=app",
+		"APP_SERVER_PORT=8080",
+		"APP_SERVER_HOSTS=a,b",
+		"APP_SERVER_TLS_CERT=a.pem",
+		"APP_SERVER_MAX_CONNS=1000",
+		"APP_SERVERS_0_IP=10.0.0.1",
+		"APP_SERVERS_0_WHEN=2024-01-02T03:04:05Z",
 	}
-	if len(tbl.entries) != 1 {
-		t.Fatalf("expected 1 entry after rollback, got %d", len(tbl.entries))
+	if !slices.Equal(env, want) {
+		t.Errorf("ToEnv = %q, want %q", env, want)
 	}
-}
-
-func TestTableNode_InsertAt_Nil(t *testing.T) {
-	tbl, _ := NewTable("t")
-	if err := tbl.InsertAt(0, nil); err == nil {
-		t.Fatal("expected error for nil entry")
+	env, err = d.ToEnv("", EnvOptions{Separator: "__", IndexArrays: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env[2] != "SERVER__HOSTS__0=a" || env[3] != "SERVER__HOSTS__1=b" {
+		t.Errorf("ToEnv with IndexArrays = %q", env)
+	}
+	if _, err := mustParse(t, "a-b = 1\na_b = 2\n").ToEnv("", EnvOptions{}); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("ToEnv with colliding names = %v", err)
 	}
 }
 
-func TestTableNode_InsertAt_OutOfRange(t *testing.T) {
-	tbl, _ := NewTable("t")
-	kv, _ := NewKeyValue("a", NewInteger(1))
-	if err := tbl.InsertAt(999, kv); err != nil {
-		t.Fatal(err)
+func TestFromEnv(t *testing.T) {
+	env := []string{
+		"HOME=/root",
+		"APP__NAME=my app",
+		"APP__SERVER__PORT=8080",
+		"APP__SERVER__MAX_CONNS=1.5",
+		"APP__SERVER__HOSTS__0=a",
+		"APP__SERVER__HOSTS__1=b",
+		"APP__SERVERS__0__IP=10.0.0.1",
+		"APP__SERVERS__1__IP=10.0.0.2",
+		"APP__DEBUG=true",
+		"APP__NOTE=1 # not a comment",
+		"APP_SINGLE=ignored",
 	}
-	if len(tbl.entries) != 1 {
-		t.Fatalf("expected 1 entry, got %d", len(tbl.entries))
+	d, err := FromEnv(env, "APP", EnvOptions{Separator: "__"})
+	if err != nil {
+		t.Fatal(err)
 	}
-}
+	want := `name = "my app"
+debug = true
+note = "1 # not a comment"
 
-// --- Coverage: mutate.go deleteFromTableNode - AOT path ---
+[server]
+port = 8080
+max_conns = 1.5
+hosts = ["a", "b"]
 
-func TestDocument_Delete_FromAOTDeep(t *testing.T) {
-	d, err := Parse([]byte("[[items]]\nname = \"A\"\nprice = 10\n"))
+[[servers]]
+ip = "10.0.0.1"
+
+[[servers]]
+ip = "10.0.0.2"
+`
+	if d.String() != want {
+		t.Errorf("FromEnv = %q, want %q", d.String(), want)
+	}
+	src := mustParse(t, want)
+	out, err := src.ToEnv("APP", EnvOptions{Separator: "__", IndexArrays: true})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if !d.Delete("items.name") {
-		t.Fatal("expected to delete items.name")
+	back, err := FromEnv(out, "APP", EnvOptions{Separator: "__"})
+	if err != nil {
+		t.Fatal(err)
 	}
-	if d.Delete("items.nonexistent") {
-		t.Fatal("did not expect to delete nonexistent entry")
+	if changes := Diff(src, back); len(changes) != 0 {
+		t.Errorf("FromEnv(ToEnv) changed values: %v", changes)
+	}
+	if _, err := FromEnv([]string{"A_B=1", "A_B_C=2"}, "A", EnvOptions{}); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("FromEnv of a value and a table with the same name = %v", err)
 	}
 }
 
-// --- Coverage: lexer.go advance at end ---
-
-func TestParse_OnlyNewline(t *testing.T) {
-	d, err := Parse([]byte("\n"))
+func TestConfigMap(t *testing.T) {
+	d := mustParse(t, "name = \"app\"\n[server]\nport = 0x50\nhosts = [\"a\", \"b\"]\n[[servers]]\nip = \"x\"\n[db]\nurl = \"pg\"\n")
+	got, err := ConfigMap(d, ConfigMapOptions{Name: "app", Namespace: "prod"})
 	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+		t.Fatal(err)
 	}
-	if d.String() != "\n" {
-		t.Fatalf("expected \\n, got %q", d.String())
+	want := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: "app"
+  namespace: "prod"
+data:
+  name: "app"
+  server.port: "80"
+  server.hosts: "[\"a\", \"b\"]"
+  servers.0.ip: "x"
+  db.url: "pg"
+`
+	if string(got) != want {
+		t.Errorf("ConfigMap = %s, want %s", got, want)
 	}
-}
 
-func TestParse_OnlyCRLF(t *testing.T) {
-	d, err := Parse([]byte("\r\n"))
+	got, err = ConfigMap(d, ConfigMapOptions{Name: "app", Files: true, Paths: []string{"server", "db"}})
 	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+		t.Fatal(err)
 	}
-	if d.String() != "\r\n" {
-		t.Fatalf("expected \\r\\n, got %q", d.String())
+	want = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: "app"
+data:
+  server.toml: |
+    port = 0x50
+    hosts = ["a", "b"]
+  db.toml: "url = \"pg\"\n"
+`
+	if string(got) != want {
+		t.Errorf("ConfigMap with files = %s, want %s", got, want)
 	}
-}
-
-// --- Coverage: parser.go parseValue default branch ---
 
-func TestParse_UnexpectedTokenAsValue(t *testing.T) {
-	_, err := Parse([]byte("k = ]\n"))
-	if err == nil {
-		t.Fatal("expected error for ] as value")
+	got, err = ConfigMap(d, ConfigMapOptions{Name: "s", Secret: true, JSON: true, Paths: []string{"db"}})
+	if err != nil {
+		t.Fatal(err)
 	}
+	want = `{
+  "apiVersion": "v1",
+  "kind": "Secret",
+  "type": "Opaque",
+  "metadata": {
+    "name": "s"
+  },
+  "data": {
+    "db.url": "cGc="
+  }
 }
-
-// --- Coverage: lexer.go scanBareOrValue empty text ---
-
-func TestParse_BareValueErrorToken(t *testing.T) {
-	// Characters that lexer can't classify
-	_, err := Parse([]byte("k = \x80\n"))
-	if err == nil {
-		t.Fatal("expected error for invalid byte in value")
+`
+	if string(got) != want {
+		t.Errorf("Secret as JSON = %s, want %s", got, want)
 	}
-}
-
-// --- Coverage: validate.go validateDecimalDigits invalid character ---
 
-func TestParse_InvalidCharInInteger(t *testing.T) {
-	_, err := Parse([]byte("n = 12abc\n"))
-	if err == nil {
-		t.Fatal("expected error for non-digit in integer")
+	if _, err := ConfigMapData(mustParse(t, "\"a b\" = 1\n"), ConfigMapOptions{}); !errors.Is(err, ErrInvalidConfigMapKey) {
+		t.Errorf("ConfigMapData with a space in a key = %v", err)
 	}
-}
-
-// --- Coverage: parser.go parseSimpleKey - invalid bare key char ---
-
-func TestParse_InvalidBareKeyChar(t *testing.T) {
-	_, err := Parse([]byte("key! = 1\n"))
-	if err == nil {
-		t.Fatal("expected error for ! in bare key")
+	if _, err := ConfigMapData(d, ConfigMapOptions{Paths: []string{"missing"}}); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("ConfigMapData of a missing table = %v", err)
 	}
 }
 
-// --- Coverage: parser.go multi-line basic string with 4-5 quotes ---
-
-func TestParse_MultiLineBasicWith5Quotes(t *testing.T) {
-	// Multi-line basic string can contain up to 2 extra quotes at closing:
-	// """""" = """ + content ending in "" + """
-	input := "s = \"\"\"\nhello\"\"\"\"\"\n"
-	d, err := Parse([]byte(input))
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+func TestHandler(t *testing.T) {
+	doc := mustParse(t, "port = 80\n")
+	h := Handler(doc)
+	serve := func(method string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/config", nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
 	}
-	got := d.String()
-	if got != input {
-		t.Fatalf("round-trip failed\nwant: %q\ngot:  %q", input, got)
+	rec := serve(http.MethodGet, "Accept", "text/html, application/toml;q=0.9")
+	if rec.Code != http.StatusOK || rec.Body.String() != "port = 80\n" ||
+		rec.Header().Get("Content-Type") != "application/toml; charset=utf-8" {
+		t.Fatalf("GET = %d %q %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
 	}
-}
-
-// --- Coverage: query.go processHexEscape error paths (via multiline) ---
-
-func TestStringNode_Value_MultiLineInvalidHexEscape(t *testing.T) {
-	n := &StringNode{leafNode: newLeaf(NodeString, "\"\"\"\n\\xZZ\"\"\"")}
-	v := n.Value()
-	if !strings.Contains(v, `\x`) {
-		t.Fatalf("expected fallback \\x, got %q", v)
+	etag := rec.Header().Get("Etag")
+	if rec := serve(http.MethodGet, "If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("conditional GET = %d, want 304", rec.Code)
+	}
+	if rec := serve(http.MethodHead); rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("HEAD = %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodGet, "Accept", "application/json, application/toml;q=0"); rec.Code != http.StatusNotAcceptable {
+		t.Errorf("GET accepting only JSON = %d, want 406", rec.Code)
+	}
+	if rec := serve(http.MethodPost); rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("POST = %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+	if err := doc.Get("port").SetValue(NewInteger(81)); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(http.MethodGet, "If-None-Match", etag); rec.Code != http.StatusOK || rec.Body.String() != "port = 81\n" {
+		t.Errorf("GET after a change = %d %q", rec.Code, rec.Body.String())
 	}
-}
 
-func TestStringNode_Value_MultiLineInvalidUnicodeEscape4(t *testing.T) {
-	n := &StringNode{leafNode: newLeaf(NodeString, "\"\"\"\n\\uGGGG\"\"\"")}
-	v := n.Value()
-	if !strings.Contains(v, `\u`) {
-		t.Fatalf("expected fallback \\u, got %q", v)
+	rec = httptest.NewRecorder()
+	LiveHandler(func() *Document { return nil }).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("LiveHandler with no document = %d, want 404", rec.Code)
 	}
 }
 
-func TestStringNode_Value_MultiLineInvalidUnicodeEscape8(t *testing.T) {
-	n := &StringNode{leafNode: newLeaf(NodeString, "\"\"\"\n\\UGGGGGGGG\"\"\"")}
-	v := n.Value()
-	if !strings.Contains(v, `\U`) {
-		t.Fatalf("expected fallback \\U, got %q", v)
+func TestParseRequest(t *testing.T) {
+	req := func(ct, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(body))
+		if ct != "" {
+			r.Header.Set("Content-Type", ct)
+		}
+		return r
+	}
+	doc, err := ParseRequest(req("application/toml; charset=UTF-8", "a = 1\n"), ParseOptions{})
+	if err != nil || doc.Get("a") == nil {
+		t.Fatalf("ParseRequest = %v, %v", doc, err)
+	}
+	for _, ct := range []string{"", "application/json", "application/toml; charset=latin1"} {
+		if _, err := ParseRequest(req(ct, "a = 1\n"), ParseOptions{}); !errors.Is(err, ErrUnsupportedMediaType) {
+			t.Errorf("ParseRequest with Content-Type %q = %v", ct, err)
+		}
+	}
+	var pe *ParseError
+	if _, err := ParseRequest(req(MediaType, "a = \n"), ParseOptions{}); !errors.As(err, &pe) {
+		t.Errorf("ParseRequest of invalid TOML = %v", err)
 	}
 }
 
-// --- Coverage: validate.go checkIntermediatePaths - inline table intermediate ---
+func TestSnapshot(t *testing.T) {
+	doc := mustParse(t, `port = 8080
+ratio = 0.1
+when = 1979-05-27T07:32:00-08:00
+tags = ["a", 2]
+db = { host = "h" }
 
-func TestParse_RejectsTableThroughInlineTableIntermediate(t *testing.T) {
-	input := "a.b = {x = 1}\n[a.b.x]\nk = 1\n"
-	_, err := Parse([]byte(input))
-	if err == nil {
-		t.Fatal("expected error for table through inline table intermediate")
-	}
-}
+[server.tls]
+cert = "a.pem"
 
-// --- Coverage: validate.go checkTablePathConflicts - scalar path ---
+[[plugin]]
+id = 9007199254740993
+`)
+	snap := doc.Snapshot()
+	if snap.Type != TypeTable || snap.Source != nil || len(snap.Fields) != 7 {
+		t.Fatalf("root = %+v", snap)
+	}
+	field := func(v *SnapshotValue, key string) *SnapshotValue {
+		t.Helper()
+		for _, f := range v.Fields {
+			if f.Key == key {
+				return f.Value
+			}
+		}
+		t.Fatalf("no field %q", key)
+		return nil
+	}
+	if v := field(snap, "port"); v.Type != TypeInteger || v.Integer != 8080 || *v.Source != (SnapshotSource{1, 1}) {
+		t.Errorf("port = %+v", v)
+	}
+	if v := field(snap, "ratio"); v.Type != TypeFloat || v.Float != 0.1 {
+		t.Errorf("ratio = %+v", v)
+	}
+	if v := field(snap, "when"); v.Type != TypeDateTime || v.String != "1979-05-27T07:32:00-08:00" || v.DateTimeKind != OffsetDateTime {
+		t.Errorf("when = %+v", v)
+	}
+	if v := field(snap, "tags"); len(v.Elements) != 2 || v.Elements[1].Integer != 2 || *v.Elements[1].Source != (SnapshotSource{4, 14}) {
+		t.Errorf("tags = %+v", v)
+	}
+	if v := field(field(snap, "db"), "host"); v.String != "h" {
+		t.Errorf("db.host = %+v", v)
+	}
+	if v := field(snap, "server"); *v.Source != (SnapshotSource{7, 1}) || field(field(v, "tls"), "cert").String != "a.pem" {
+		t.Errorf("server = %+v", v)
+	}
+	if v := field(snap, "plugin"); v.Type != TypeArrayOfTables || field(v.Elements[0], "id").Integer != 9007199254740993 {
+		t.Errorf("plugin = %+v", v)
+	}
 
-func TestParse_RejectsTableOverScalar(t *testing.T) {
-	input := "a = 1\n[a]\nk = 1\n"
-	_, err := Parse([]byte(input))
-	if err == nil {
-		t.Fatal("expected error for table over scalar")
+	rebuilt, err := snap.Document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := Diff(doc, rebuilt); len(changes) > 0 {
+		t.Errorf("rebuilt document differs: %v\n%s", changes, rebuilt)
+	}
+	if _, err := (&SnapshotValue{Type: TypeString}).Document(); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Document of a string = %v", err)
+	}
+	bad := &SnapshotValue{Type: TypeTable, Fields: []*SnapshotField{{Key: "d", Value: &SnapshotValue{Type: TypeDateTime, String: "soon"}}}}
+	if _, err := bad.Document(); err == nil {
+		t.Error("Document with a malformed datetime succeeded")
 	}
 }
 
-// --- Coverage: mutate.go parseRawKey whitespace handling ---
-
-func TestNewKeyValue_LeadingWhitespace(t *testing.T) {
-	kv, err := NewKeyValue("  key  ", NewString("val"))
+func TestParseWithOptions_NoCopy(t *testing.T) {
+	b := []byte("name = \"abc\"\n[server]\nport = 80\n")
+	d, err := ParseWithOptions(b, ParseOptions{NoCopy: true})
 	if err != nil {
-		t.Fatalf("NewKeyValue: %v", err)
+		t.Fatal(err)
 	}
-	if kv.keyParts[0].Unquoted != "key" {
-		t.Fatalf("expected 'key', got %q", kv.keyParts[0].Unquoted)
+	if got := d.Get("server.port").Val().Text(); got != "80" {
+		t.Fatalf("server.port = %q", got)
+	}
+	// The document refers to b, which is why it must not change.
+	b[8] = 'x'
+	if got := d.Get("name").Val().Text(); got != `"xbc"` {
+		t.Errorf("name = %q after changing the input, want it to share b", got)
+	}
+	if _, err := ParseWithOptions([]byte{}, ParseOptions{NoCopy: true}); err != nil {
+		t.Errorf("empty input: %v", err)
+	}
+	var pe *ParseError
+	if _, err := ParseWithOptions([]byte("a = \n"), ParseOptions{NoCopy: true}); !errors.As(err, &pe) {
+		t.Errorf("invalid input: %v", err)
 	}
 }
 
-// --- Coverage: validate.go checkPrefixNumber signed prefix ---
-
-func TestParse_RejectsSignedOctal(t *testing.T) {
-	_, err := Parse([]byte("n = -0o7\n"))
-	if err == nil {
-		t.Fatal("expected error for signed octal")
+func TestParseWithOptions_InternKeys(t *testing.T) {
+	var src strings.Builder
+	for i := range 3 {
+		fmt.Fprintf(&src, "[[records]]\n\"user id\" = %d\nname = \"n%d\"\n", i, i)
+	}
+	d, err := ParseWithOptions([]byte(src.String()), ParseOptions{InternKeys: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.String() != src.String() {
+		t.Fatalf("String() =\n%s", d.String())
+	}
+	aots := d.ArraysOfTables()
+	if len(aots) != 3 {
+		t.Fatalf("got %d entries", len(aots))
+	}
+	first, last := aots[0].Entries()[0].(*KeyValue), aots[2].Entries()[0].(*KeyValue)
+	if first.KeyPart(0).Unquoted != "user id" {
+		t.Fatalf("key = %q", first.KeyPart(0).Unquoted)
+	}
+	if unsafe.StringData(first.KeyPart(0).Unquoted) != unsafe.StringData(last.KeyPart(0).Unquoted) ||
+		unsafe.StringData(first.RawKey()) != unsafe.StringData(last.RawKey()) {
+		t.Error("repeated keys do not share storage")
 	}
 }
 
-func TestParse_RejectsSignedBinary(t *testing.T) {
-	_, err := Parse([]byte("n = +0b1\n"))
-	if err == nil {
-		t.Fatal("expected error for signed binary")
+func TestNodeSizes(t *testing.T) {
+	// Leaves and key-values dominate the heap of bulk documents, so they
+	// carry no position, node type, annotations or trivia lists; guard
+	// against fields creeping back.
+	word := unsafe.Sizeof(uintptr(0))
+	if got := unsafe.Sizeof(StringNode{}); got > 4*word {
+		t.Errorf("StringNode is %d bytes, want at most %d", got, 4*word)
+	}
+	if got := unsafe.Sizeof(srcPos{}); got > word {
+		t.Errorf("srcPos is %d bytes, want at most %d", got, word)
+	}
+	if got := unsafe.Sizeof(lineTrivia{}); got > word {
+		t.Errorf("lineTrivia is %d bytes, want at most %d", got, word)
+	}
+	if got := unsafe.Sizeof(KeyValue{}); got > 19*word {
+		t.Errorf("KeyValue is %d bytes, want at most %d", got, 19*word)
 	}
 }
 
-// --- Coverage: validate.go validateFloatExponent dotIdx == eIdx-1 ---
-
-func TestParse_RejectsFloatDotImmediatelyBeforeExponent(t *testing.T) {
-	_, err := Parse([]byte("f = 1.e2\n"))
-	if err == nil {
-		t.Fatal("expected error for dot immediately before exponent")
+func TestValidate_ReusesState(t *testing.T) {
+	d := mustParse(t, string(benchInput))
+	// Pooled state must be cleared between documents: a second document
+	// with the same tables is not a duplicate of the first.
+	for range 3 {
+		if err := mustParse(t, string(benchInput)).Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src := d.String()
+	fresh := testing.AllocsPerRun(20, func() {
+		v := &docValidator{source: src, state: newTableState(), ctx: context.Background()}
+		if err := v.validate(d); err != nil {
+			t.Fatal(err)
+		}
+	})
+	pooled := testing.AllocsPerRun(20, func() {
+		if err := validateDocument(context.Background(), d, src); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if pooled >= fresh {
+		t.Errorf("validation took %v allocations with pooled state, %v without", pooled, fresh)
+	}
+	if err := d.Get("server.port").SetValue(NewInteger(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AppendRaw("[[routes]]\npath = \"/b\"\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AppendRaw("path = \"/c\"\n"); err == nil {
+		t.Error("duplicate key accepted after pooled validations")
 	}
 }
 
-// --- Coverage: validate.go checkDecimalLeadingZeros ---
+func TestValidate_PositionsInCurrentText(t *testing.T) {
+	d := mustParse(t, "a = 1\nb = 2\n")
+	// The appended snippet is parsed alone, so the parser places "a" on
+	// its line 2; the error must point at line 4 of the document.
+	err := d.AppendRaw("c = 3\na = 4\n")
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("AppendRaw = %v", err)
+	}
+	if pe.Line != 4 || pe.Column != 1 || pe.Source != "a = 1\nb = 2\nc = 3\na = 4\n" || pe.Source[pe.Span.Start:pe.Span.End] != "a" {
+		t.Errorf("error at %d:%d span %v in %q", pe.Line, pe.Column, pe.Span, pe.Source)
+	}
 
-func TestParse_AcceptsZeroBeforeDot(t *testing.T) {
-	d, err := Parse([]byte("f = 0.5\n"))
+	tbl, err := NewTable("t")
 	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+		t.Fatal(err)
 	}
-	kv := d.nodes[0].(*KeyValue)
-	if kv.val.Type() != NodeNumber {
-		t.Fatalf("expected number, got %v", kv.val.Type())
+	d = mustParse(t, "# header\n\n[t]\nx = 1\n")
+	d.nodes = append([]Node{tbl}, d.nodes...)
+	tbl.setParent(d)
+	if !errors.As(d.Validate(), &pe) || pe.Line != 4 || pe.Column != 1 {
+		t.Errorf("Validate of a built table = %v", pe)
 	}
 }
 
-func TestParse_AcceptsZeroBeforeExponent(t *testing.T) {
-	d, err := Parse([]byte("f = 0e1\n"))
+func TestBuiltNodePositions(t *testing.T) {
+	ref := mustParse(t, "# Deprecated: use host.\nserver = \"\"\n")
+	d := mustParse(t, "a = 1\n")
+	kv, err := NewKeyValue("server", NewString("x"))
 	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+		t.Fatal(err)
 	}
-	kv := d.nodes[0].(*KeyValue)
-	if kv.val.Type() != NodeNumber {
-		t.Fatalf("expected number, got %v", kv.val.Type())
+	if err := d.Append(kv); err != nil {
+		t.Fatal(err)
 	}
-}
-
-// --- Coverage: parser.go parserProcessBasicEscapes default branch ---
-
-func TestParserProcessBasicEscapes_UnknownEscape(t *testing.T) {
-	// Call through StringNode.Value
-	n := &StringNode{leafNode: newLeaf(NodeString, `"\q"`)}
-	v := n.Value()
-	if v != `\q` {
-		t.Fatalf("expected '\\q', got %q", v)
+	findings := d.Lint(DeprecatedKeys(ref))
+	if len(findings) != 1 || findings[0].Line != 2 || findings[0].Column != 1 {
+		t.Errorf("findings = %+v", findings)
 	}
-}
-
-// --- Coverage: orphan trivia with current table set ---
 
-func TestParse_OrphanTriviaOnTableNoKVGoesToTable(t *testing.T) {
-	input := "[server]\n# comment at end"
-	d, err := Parse([]byte(input))
-	if err != nil {
-		t.Fatal(err)
+	e := &ParseError{Message: `duplicate key "b"`, Token: "b"}
+	if got := e.Error(); got != `parse error at b: duplicate key "b"` {
+		t.Errorf("Error() = %q", got)
 	}
-	tbl := d.nodes[0].(*TableNode)
-	if len(tbl.entries) == 0 {
-		t.Fatal("expected trivia to be added to table entries")
+	e.Token = ""
+	if got := e.Error(); got != `parse error: duplicate key "b"` {
+		t.Errorf("Error() without a token = %q", got)
 	}
 }
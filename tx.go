@@ -0,0 +1,135 @@
+package toml
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Tx makes changes to a document inside Document.Edit. Every change made
+// through it is undone if the edit fails.
+type Tx struct {
+	doc  *Document
+	b    *Batch
+	root *LogicalTable // kept up to date by Set, reset by other changes
+	undo []func()
+}
+
+// Edit calls fn to make several changes to the document as one unit. The
+// changes are validated once, when fn returns. If fn returns an error, a
+// change fails, or the resulting document is invalid, every change made
+// through tx is undone and the error is returned; otherwise they are all
+// kept.
+//
+// Unlike WithBatch, Edit also undoes values replaced in place and entries
+// added to or removed from inline tables, as long as they were changed
+// through tx.
+func (d *Document) Edit(fn func(tx *Tx) error) error {
+	tx := &Tx{doc: d}
+	err := d.WithBatch(func(b *Batch) {
+		tx.b = b
+		b.record(fn(tx))
+	})
+	if err != nil {
+		for _, undo := range slices.Backward(tx.undo) {
+			undo()
+		}
+	}
+	return err
+}
+
+// Set sets the value at path, as Resolve("").Set does.
+func (tx *Tx) Set(path string, val Node) error {
+	if tx.root == nil {
+		tx.root = tx.doc.Resolve("")
+	}
+	kv, old, err := tx.root.set(path, val)
+	if err != nil {
+		tx.b.record(err)
+		return err
+	}
+	switch {
+	case old != nil:
+		tx.undo = append(tx.undo, func() { _ = kv.SetValue(old) })
+	default:
+		if _, ok := kv.Parent().(*InlineTableNode); ok {
+			tx.undo = append(tx.undo, func() { kv.Detach() })
+		}
+	}
+	return nil
+}
+
+// SetValue replaces the value of kv, which must belong to the document, as
+// KeyValue.SetValue does.
+func (tx *Tx) SetValue(kv *KeyValue, val Node) error {
+	tx.root = nil
+	old := kv.val
+	if err := kv.SetValue(val); err != nil {
+		tx.b.record(err)
+		return err
+	}
+	if old != val {
+		tx.undo = append(tx.undo, func() { _ = kv.SetValue(old) })
+	}
+	return nil
+}
+
+// Delete removes the key-value at path, as Document.Delete does.
+func (tx *Tx) Delete(path string) (*KeyValue, bool) {
+	tx.root = nil
+	kv := tx.doc.deleteTarget(path)
+	if kv == nil {
+		return nil, false
+	}
+	if it, ok := kv.Parent().(*InlineTableNode); ok {
+		entries, seps := slices.Clone(it.entries), slices.Clone(it.seps)
+		tx.undo = append(tx.undo, func() {
+			it.entries, it.seps = entries, seps
+			kv.setParent(it)
+			it.regenerateText()
+			regenerateAncestorText(it)
+		})
+	}
+	return detachKeyValue(kv)
+}
+
+// DeleteTable removes the table at path, as Document.DeleteTable does.
+func (tx *Tx) DeleteTable(path string) (*TableNode, bool) {
+	tx.root = nil
+	return tx.doc.DeleteTable(path)
+}
+
+// DeleteTree removes the table at path and everything under it, as
+// Document.DeleteTree does.
+func (tx *Tx) DeleteTree(path string) int {
+	tx.root = nil
+	return tx.doc.DeleteTree(path)
+}
+
+// Append adds a node to the end of the document, as Document.Append does.
+func (tx *Tx) Append(node Node) error {
+	return tx.record(tx.doc.Append(node))
+}
+
+// InsertAt inserts a node at position i in the document, as
+// Document.InsertAt does.
+func (tx *Tx) InsertAt(i int, node Node) error {
+	return tx.record(tx.doc.InsertAt(i, node))
+}
+
+// AppendTo adds a key-value pair to the end of a table or array-of-tables
+// entry of the document, as Batch.AppendTo does.
+func (tx *Tx) AppendTo(section Node, kv *KeyValue) error {
+	switch s := section.(type) {
+	case *TableNode:
+		return tx.record(s.Append(kv))
+	case *ArrayOfTables:
+		return tx.record(s.Append(kv))
+	}
+	return tx.record(fmt.Errorf("%w: %T is not a table", ErrInvalidNodeType, section))
+}
+
+func (tx *Tx) record(err error) error {
+	tx.root = nil
+	tx.b.record(err)
+	return err
+}
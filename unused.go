@@ -0,0 +1,169 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// KeyRef is a key found in a document.
+type KeyRef struct {
+	Path     string   // dotted path, quoted as by JoinPath
+	Node     Node     // key-value or header that defines it
+	Position Position // where Node starts in the document's text
+}
+
+// UnusedKeys returns the keys of doc that shape does not describe, in
+// document order, for configuration hygiene checks such as rejecting
+// misspelled or obsolete keys in CI. shape is a *Schema, or a struct, a
+// pointer to one, or its reflect.Type, read as a decoder would: fields are
+// named by their `toml:"name"` tag, or else by their Go name matched
+// without regard to case; fields tagged "-" and unexported fields are
+// skipped, and embedded structs contribute their fields. Maps, interfaces,
+// and schema tables without Fields accept any key. A table with a
+// Discriminator may also set the fields of the variant it selects. Once a
+// key is reported, the keys below it are not. Keys inside arrays are not
+// checked.
+func UnusedKeys(doc *Document, shape any) []KeyRef {
+	s, ok := shape.(*Schema)
+	if !ok {
+		t, isType := shape.(reflect.Type)
+		if !isType {
+			t = reflect.TypeOf(shape)
+		}
+		s = schemaOfType(t, make(map[reflect.Type]*Schema))
+	}
+	u := unusedWalk{pos: nodePositions{doc: doc}}
+	u.table(doc.logicalRoot(), s, nil)
+	return u.out
+}
+
+// unusedWalk collects the keys UnusedKeys reports.
+type unusedWalk struct {
+	pos nodePositions
+	out []KeyRef
+}
+
+// table checks the keys of t, at path, against s.
+func (u *unusedWalk) table(t *lnode, s *Schema, path []string) {
+	if s != nil && s.Discriminator != "" {
+		v, _, _ := s.discriminator(t)
+		s = s.variant(v)
+	}
+	if s == nil || s.Type == TypeAny || s.Fields == nil {
+		return
+	}
+	for _, name := range t.names {
+		child := t.fields[name]
+		childPath := append(path[:len(path):len(path)], name)
+		fs := s.field(name)
+		switch {
+		case fs == nil:
+			u.report(childPath, child)
+		case child.kind == TypeTable:
+			u.table(child, fs, childPath)
+		case child.kind == TypeArrayOfTables:
+			for _, e := range child.entries {
+				u.table(e, fs, childPath)
+			}
+		}
+	}
+}
+
+// report records the key at path, defined by n.
+func (u *unusedWalk) report(path []string, n *lnode) {
+	ref := KeyRef{Path: JoinPath(path...), Node: n.node()}
+	ref.Position = u.pos.of(ref.Node)
+	u.out = append(u.out, ref)
+}
+
+// field returns the schema of the field name, matching the Go names of
+// a struct's fields without regard to case.
+func (s *Schema) field(name string) *Schema {
+	if f, ok := s.Fields[name]; ok {
+		return f
+	}
+	for fold, f := range s.foldFields {
+		if strings.EqualFold(fold, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// schemaOfType returns the schema of values decoded into t. seen holds
+// the schemas of the struct types being built, so that recursive types
+// refer back to them.
+func schemaOfType(t reflect.Type, seen map[reflect.Type]*Schema) *Schema {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return &Schema{}
+	}
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.String:
+		return &Schema{Type: TypeString}
+	case reflect.Bool:
+		return &Schema{Type: TypeBoolean}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: TypeInteger}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: TypeFloat}
+	case reflect.Map:
+		return &Schema{Type: TypeTable}
+	case reflect.Slice, reflect.Array:
+		return sliceSchema(t, seen)
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: TypeDateTime}
+		}
+		if s, ok := seen[t]; ok {
+			return s
+		}
+		s := &Schema{Type: TypeTable, Fields: make(map[string]*Schema), foldFields: make(map[string]*Schema)}
+		seen[t] = s
+		addStructFields(s, t, seen)
+		return s
+	}
+	return &Schema{}
+}
+
+// sliceSchema returns the schema of a slice or array type: an array of
+// tables for structs, and otherwise an array.
+func sliceSchema(t reflect.Type, seen map[reflect.Type]*Schema) *Schema {
+	item := schemaOfType(t.Elem(), seen)
+	if item.Type == TypeTable && item.Fields != nil {
+		return &Schema{Type: TypeArrayOfTables, Fields: item.Fields, foldFields: item.foldFields}
+	}
+	return &Schema{Type: TypeArray, Items: item}
+}
+
+// addStructFields adds the fields of the struct type t to s.
+func addStructFields(s *Schema, t reflect.Type, seen map[reflect.Type]*Schema) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+		switch {
+		case tag == "-":
+		case f.Anonymous && tag == "" && indirect(f.Type).Kind() == reflect.Struct:
+			addStructFields(s, indirect(f.Type), seen)
+		case !f.IsExported():
+		case tag != "":
+			s.Fields[tag] = schemaOfType(f.Type, seen)
+		default:
+			s.foldFields[f.Name] = schemaOfType(f.Type, seen)
+		}
+	}
+}
+
+// indirect returns the type t points to, or t.
+func indirect(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
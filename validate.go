@@ -1,10 +1,13 @@
 package toml
 
 import (
+	"context"
 	"fmt"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"unicode/utf8"
 )
 
@@ -696,30 +699,107 @@ func newTableState() *tableState {
 }
 
 type docValidator struct {
-	source string
-	state  *tableState
+	source     string
+	state      *tableState     // allocated on first use if nil
+	ctx        context.Context // checked before each top-level node
+	index      *Index          // records valid nodes when non-nil
+	smallLimit int             // as ParseOptions.SmallDocumentLimit
+	pooled     bool            // state came from tableStates
+
+	// pos, when set, finds nodes in the document being validated after it
+	// was built or changed through the API: error positions are found in
+	// its current text instead of where the parser saw each node.
+	pos *nodePositions
 }
 
+// defaultSmallDocumentLimit is the SmallDocumentLimit used when the
+// option is zero.
+const defaultSmallDocumentLimit = 64
+
 // Validate runs full structural validation on the document.
 // It checks for duplicate tables, duplicate keys, table/AOT conflicts,
 // dotted key conflicts, inline table extension, and static array extension.
 func (d *Document) Validate() error {
-	return validateDocument(d, d.String())
+	return validateDocument(context.Background(), d, d.String())
 }
 
-func validateDocument(doc *Document, source string) error {
+func validateDocument(ctx context.Context, doc *Document, source string) error {
 	v := &docValidator{
 		source: source,
-		state:  newTableState(),
+		ctx:    ctx,
+		pos:    &nodePositions{doc: doc},
 	}
+	defer v.release()
 	return v.validate(doc)
 }
 
+// tableStates holds validation state for reuse, so that mutations, which
+// validate the whole document each time, do not allocate its maps anew.
+var tableStates = sync.Pool{New: func() any { return newTableState() }}
+
+// maxPooledPaths is the number of recorded paths above which a state is
+// dropped rather than pooled, so that one huge document does not pin its
+// maps' memory.
+const maxPooledPaths = 4096
+
+// release returns a state taken from tableStates by validate.
+func (v *docValidator) release() {
+	if v.state == nil || !v.pooled {
+		return
+	}
+	if v.state.size() <= maxPooledPaths {
+		v.state.reset()
+		tableStates.Put(v.state)
+	}
+	v.state = nil
+}
+
+// reset clears the state so it can validate another document.
+func (s *tableState) reset() {
+	clear(s.explicitTables)
+	clear(s.dottedKeyTables)
+	clear(s.implicitTables)
+	clear(s.inlinePaths)
+	clear(s.staticArrays)
+	clear(s.aotPaths)
+	clear(s.scalarPaths)
+}
+
+// size returns the number of paths recorded.
+func (s *tableState) size() int {
+	return len(s.explicitTables) + len(s.dottedKeyTables) + len(s.implicitTables) + len(s.inlinePaths) +
+		len(s.staticArrays) + len(s.aotPaths) + len(s.scalarPaths)
+}
+
+// knownPaths returns every key and table path recorded so far, as
+// JoinPath writes them.
+func (s *tableState) knownPaths() map[string]bool {
+	out := make(map[string]bool)
+	for _, m := range []map[string]bool{
+		s.explicitTables, s.dottedKeyTables, s.implicitTables, s.inlinePaths,
+		s.staticArrays, s.aotPaths, s.scalarPaths,
+	} {
+		for k := range m {
+			out[JoinPath(pathKeySegs(k)...)] = true
+		}
+	}
+	return out
+}
+
 func (v *docValidator) validate(doc *Document) error {
+	if v.index == nil && isSmallFlat(doc.nodes, v.smallLimit) && flatValid(doc.nodes) {
+		return ctxErr(v.ctx)
+	}
+	if v.state == nil {
+		v.state, v.pooled = tableStates.Get().(*tableState), true
+	}
 	for _, n := range doc.nodes {
+		if err := ctxErr(v.ctx); err != nil {
+			return err
+		}
 		switch node := n.(type) {
 		case *KeyValue:
-			if err := v.checkKeyValue(nil, node); err != nil {
+			if err := v.checkKeyValue("", node); err != nil {
 				return err
 			}
 		case *TableNode:
@@ -731,61 +811,158 @@ func (v *docValidator) validate(doc *Document) error {
 				return err
 			}
 		}
+		if v.index != nil {
+			v.index.addTopLevel(n)
+		}
 	}
 	return nil
 }
 
-func (v *docValidator) errorAt(msg string, line, col int) error {
+// isSmallFlat reports whether nodes hold at most limit key-values, all
+// with simple keys and none holding an inline table, and no tables. Such
+// documents, the common short config file, can only fail validation with
+// a duplicate key. A limit of zero means defaultSmallDocumentLimit, and a
+// negative one rules every document out.
+func isSmallFlat(nodes []Node, limit int) bool {
+	if limit == 0 {
+		limit = defaultSmallDocumentLimit
+	}
+	keys := 0
+	for _, n := range nodes {
+		switch v := n.(type) {
+		case *KeyValue:
+			keys++
+			if keys > limit || len(v.keyParts) != 1 || hasInlineTable(v.val) {
+				return false
+			}
+		case *TableNode, *ArrayOfTables:
+			return false
+		}
+	}
+	return true
+}
+
+func hasInlineTable(val Node) bool {
+	switch v := val.(type) {
+	case *InlineTableNode:
+		return true
+	case *ArrayNode:
+		return slices.ContainsFunc(v.elements, hasInlineTable)
+	}
+	return false
+}
+
+// flatValid reports whether a document accepted by isSmallFlat is valid,
+// comparing its keys pairwise, which for a few dozen keys is cheaper than
+// building the maps of tableState. Invalid documents are validated again
+// with the maps, for the error.
+func flatValid(nodes []Node) bool {
+	for i, n := range nodes {
+		kv, ok := n.(*KeyValue)
+		if !ok {
+			continue
+		}
+		for _, prev := range nodes[:i] {
+			if p, ok := prev.(*KeyValue); ok && p.keyParts[0].Unquoted == kv.keyParts[0].Unquoted {
+				return false
+			}
+		}
+		if checkExtensions(kv.val) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// errorAt reports an error at n, the key-value or table header where
+// token starts.
+func (v *docValidator) errorAt(msg string, n Node, token string) error {
+	line, col, start := v.position(n)
 	return &ParseError{
 		Message: msg,
 		Line:    line,
 		Column:  col,
 		Source:  v.source,
+		Hint:    hintFor(msg),
+		Token:   token,
+		Span:    Span{start, start + len(token)},
 	}
 }
 
-func keyPartsToPath(parts []KeyPart) string {
-	var sb strings.Builder
-	for i, p := range parts {
-		if i > 0 {
-			sb.WriteByte('.')
-		}
-		// If the unquoted key contains a dot, wrap it in quotes to
-		// distinguish "a"."b.c" (2 parts) from "a"."b"."c" (3 parts).
-		if strings.ContainsRune(p.Unquoted, '.') {
-			sb.WriteByte('"')
-			sb.WriteString(p.Unquoted)
-			sb.WriteByte('"')
-		} else {
-			sb.WriteString(p.Unquoted)
+// position returns the line, column, and offset in v.source where n, a
+// key-value or header, starts.
+func (v *docValidator) position(n Node) (line, col, offset int) {
+	if v.pos != nil {
+		if p, off, ok := v.pos.find(n); ok {
+			return p.Line, p.Column, off
 		}
 	}
-	return sb.String()
+	if p, ok := n.(interface{ lineCol() (int, int) }); ok {
+		line, col = p.lineCol()
+	}
+	return line, col, lineColOffset(v.source, line, col)
+}
+
+// keyErrorAt is errorAt for an error about path, suggesting known keys and
+// tables with similar names.
+func (v *docValidator) keyErrorAt(msg, path string, n Node, token string) error {
+	err := v.errorAt(msg, n, token).(*ParseError)
+	err.Suggestions = suggestKeys(path, v.state.knownPaths())
+	return err
+}
+
+// pathKey returns the key under which the validator records the path of
+// parts. Each unquoted segment is prefixed with its length, so distinct
+// paths never share a key, whatever quotes, dots, or newlines their
+// segments hold, and the key of a path is a prefix of the keys of every
+// path below it. JoinPath gives the path for messages.
+func pathKey(parts []KeyPart) string {
+	var b strings.Builder
+	for _, p := range parts {
+		writePathKey(&b, p.Unquoted)
+	}
+	return b.String()
 }
 
-func buildFullPath(baseParts, keyParts []KeyPart) string {
-	all := make([]KeyPart, 0, len(baseParts)+len(keyParts))
-	all = append(all, baseParts...)
-	all = append(all, keyParts...)
-	return keyPartsToPath(all)
+func writePathKey(b *strings.Builder, seg string) {
+	b.WriteString(strconv.Itoa(len(seg)))
+	b.WriteByte(':')
+	b.WriteString(seg)
+}
+
+// pathKeySegs returns the unquoted segments of a path key.
+func pathKeySegs(key string) []string {
+	var segs []string
+	for key != "" {
+		n, rest, _ := strings.Cut(key, ":")
+		size, _ := strconv.Atoi(n)
+		segs = append(segs, rest[:size])
+		key = rest[size:]
+	}
+	return segs
+}
+
+// extendKey returns the key of the path key followed by parts.
+func extendKey(key string, parts []KeyPart) string {
+	return key + pathKey(parts)
 }
 
 func (v *docValidator) checkTable(node *TableNode) error {
-	path := keyPartsToPath(node.headerParts)
+	key := pathKey(node.headerParts)
 
-	if msg := v.checkTablePathConflicts(path); msg != "" {
-		return v.errorAt(msg, node.line, node.col)
+	if msg := v.checkTablePathConflicts(key, node.headerParts); msg != "" {
+		return v.keyErrorAt(msg, JoinPath(partsToSegs(node.headerParts)...), node, node.Text())
 	}
-	if msg := v.checkIntermediatePaths(node.headerParts, path); msg != "" {
-		return v.errorAt(msg, node.line, node.col)
+	if msg := v.checkIntermediatePaths(node.headerParts, "table [%s]"); msg != "" {
+		return v.errorAt(msg, node, node.Text())
 	}
 
-	v.state.explicitTables[path] = true
+	v.state.explicitTables[key] = true
 	v.markParentImplicit(node.headerParts)
 
 	for _, entry := range node.entries {
 		if kv, ok := entry.(*KeyValue); ok {
-			if err := v.checkKeyValue(node.headerParts, kv); err != nil {
+			if err := v.checkKeyValue(key, kv); err != nil {
 				return err
 			}
 		}
@@ -793,41 +970,43 @@ func (v *docValidator) checkTable(node *TableNode) error {
 	return nil
 }
 
-func (v *docValidator) checkTablePathConflicts(path string) string {
+func (v *docValidator) checkTablePathConflicts(key string, parts []KeyPart) string {
 	ts := v.state
-	if ts.explicitTables[path] {
-		return fmt.Sprintf("duplicate table: [%s]", path)
-	}
-	if ts.aotPaths[path] {
-		return fmt.Sprintf("cannot define table [%s] already defined as array of tables", path)
-	}
-	if ts.dottedKeyTables[path] {
-		return fmt.Sprintf("cannot reopen table [%s] defined via dotted keys", path)
-	}
-	if ts.scalarPaths[path] {
-		return fmt.Sprintf("cannot define table [%s], key already defined as a value", path)
-	}
-	if ts.inlinePaths[path] {
-		return fmt.Sprintf("cannot extend inline table/array [%s]", path)
-	}
-	if ts.staticArrays[path] {
-		return fmt.Sprintf("cannot extend static array [%s]", path)
+	var format string
+	switch {
+	case ts.explicitTables[key]:
+		format = "duplicate table: [%s]"
+	case ts.aotPaths[key]:
+		format = "cannot define table [%s] already defined as array of tables"
+	case ts.dottedKeyTables[key]:
+		format = "cannot reopen table [%s] defined via dotted keys"
+	case ts.scalarPaths[key]:
+		format = "cannot define table [%s], key already defined as a value"
+	case ts.inlinePaths[key]:
+		format = "cannot extend inline table/array [%s]"
+	case ts.staticArrays[key]:
+		format = "cannot extend static array [%s]"
+	default:
+		return ""
 	}
-	return ""
+	return fmt.Sprintf(format, JoinPath(partsToSegs(parts)...))
 }
 
-func (v *docValidator) checkIntermediatePaths(parts []KeyPart, path string) string {
+// checkIntermediatePaths checks the tables a header passes through. what
+// formats the header for messages, as "table [%s]" or "array [[%s]]".
+func (v *docValidator) checkIntermediatePaths(parts []KeyPart, what string) string {
 	ts := v.state
+	var key strings.Builder
 	for i := 1; i < len(parts); i++ {
-		parentPath := keyPartsToPath(parts[:i])
-		if ts.scalarPaths[parentPath] {
-			return fmt.Sprintf("cannot define table [%s], key %q already a value", path, parentPath)
-		}
-		if ts.inlinePaths[parentPath] {
-			return fmt.Sprintf("cannot extend inline table/array at %q", parentPath)
-		}
-		if ts.staticArrays[parentPath] {
-			return fmt.Sprintf("cannot extend static array at %q", parentPath)
+		writePathKey(&key, parts[i-1].Unquoted)
+		parentKey := key.String()
+		switch {
+		case ts.scalarPaths[parentKey]:
+			return fmt.Sprintf("cannot define "+what+", key %q already a value", JoinPath(partsToSegs(parts)...), JoinPath(partsToSegs(parts[:i])...))
+		case ts.inlinePaths[parentKey]:
+			return fmt.Sprintf("cannot extend inline table/array at %q", JoinPath(partsToSegs(parts[:i])...))
+		case ts.staticArrays[parentKey]:
+			return fmt.Sprintf("cannot extend static array at %q", JoinPath(partsToSegs(parts[:i])...))
 		}
 	}
 	return ""
@@ -835,31 +1014,33 @@ func (v *docValidator) checkIntermediatePaths(parts []KeyPart, path string) stri
 
 func (v *docValidator) markParentImplicit(parts []KeyPart) {
 	ts := v.state
+	var key strings.Builder
 	for i := 1; i < len(parts); i++ {
-		parentPath := keyPartsToPath(parts[:i])
-		if !ts.explicitTables[parentPath] && !ts.aotPaths[parentPath] {
-			ts.implicitTables[parentPath] = true
+		writePathKey(&key, parts[i-1].Unquoted)
+		parentKey := key.String()
+		if !ts.explicitTables[parentKey] && !ts.aotPaths[parentKey] {
+			ts.implicitTables[parentKey] = true
 		}
 	}
 }
 
 func (v *docValidator) checkAOT(node *ArrayOfTables) error {
-	path := keyPartsToPath(node.headerParts)
+	key := pathKey(node.headerParts)
 
-	if msg := v.checkAOTPathConflicts(path); msg != "" {
-		return v.errorAt(msg, node.line, node.col)
+	if msg := v.checkAOTPathConflicts(key, node.headerParts); msg != "" {
+		return v.errorAt(msg, node, node.Text())
 	}
-	if msg := v.checkIntermediatePathsAOT(node.headerParts, path); msg != "" {
-		return v.errorAt(msg, node.line, node.col)
+	if msg := v.checkIntermediatePaths(node.headerParts, "array [[%s]]"); msg != "" {
+		return v.errorAt(msg, node, node.Text())
 	}
 
-	v.state.aotPaths[path] = true
+	v.state.aotPaths[key] = true
 	v.markParentImplicit(node.headerParts)
-	v.clearSubScope(path)
+	v.clearSubScope(key)
 
 	for _, entry := range node.entries {
 		if kv, ok := entry.(*KeyValue); ok {
-			if err := v.checkKeyValue(node.headerParts, kv); err != nil {
+			if err := v.checkKeyValue(key, kv); err != nil {
 				return err
 			}
 		}
@@ -867,86 +1048,76 @@ func (v *docValidator) checkAOT(node *ArrayOfTables) error {
 	return nil
 }
 
-func (v *docValidator) checkAOTPathConflicts(path string) string {
+func (v *docValidator) checkAOTPathConflicts(key string, parts []KeyPart) string {
 	ts := v.state
-	if ts.explicitTables[path] {
-		return fmt.Sprintf("cannot define array of tables [[%s]] already defined as table", path)
-	}
-	if ts.scalarPaths[path] {
-		return fmt.Sprintf("cannot define array [[%s]], key already a value", path)
-	}
-	if ts.inlinePaths[path] {
-		return fmt.Sprintf("cannot extend inline table/array [[%s]]", path)
-	}
-	if ts.staticArrays[path] {
-		return fmt.Sprintf("cannot extend static array [[%s]]", path)
-	}
-	if ts.dottedKeyTables[path] {
-		return fmt.Sprintf("cannot define array [[%s]], key defined via dotted keys", path)
-	}
-	if ts.implicitTables[path] && !ts.aotPaths[path] {
-		return fmt.Sprintf("cannot define array [[%s]], key already implicitly a table", path)
-	}
-	return ""
-}
-
-func (v *docValidator) checkIntermediatePathsAOT(parts []KeyPart, path string) string {
-	ts := v.state
-	for i := 1; i < len(parts); i++ {
-		parentPath := keyPartsToPath(parts[:i])
-		if ts.scalarPaths[parentPath] {
-			return fmt.Sprintf("cannot define array [[%s]], key %q already a value", path, parentPath)
-		}
-		if ts.inlinePaths[parentPath] {
-			return fmt.Sprintf("cannot extend inline table/array at %q", parentPath)
-		}
-		if ts.staticArrays[parentPath] {
-			return fmt.Sprintf("cannot extend static array at %q", parentPath)
-		}
+	var format string
+	switch {
+	case ts.explicitTables[key]:
+		format = "cannot define array of tables [[%s]] already defined as table"
+	case ts.scalarPaths[key]:
+		format = "cannot define array [[%s]], key already a value"
+	case ts.inlinePaths[key]:
+		format = "cannot extend inline table/array [[%s]]"
+	case ts.staticArrays[key]:
+		format = "cannot extend static array [[%s]]"
+	case ts.dottedKeyTables[key]:
+		format = "cannot define array [[%s]], key defined via dotted keys"
+	case ts.implicitTables[key] && !ts.aotPaths[key]:
+		format = "cannot define array [[%s]], key already implicitly a table"
+	default:
+		return ""
 	}
-	return ""
+	return fmt.Sprintf(format, JoinPath(partsToSegs(parts)...))
 }
 
-func (v *docValidator) clearSubScope(path string) {
-	prefix := path + "."
-	clearPrefix(v.state.explicitTables, prefix)
-	clearPrefix(v.state.dottedKeyTables, prefix)
-	clearPrefix(v.state.scalarPaths, prefix)
-	clearPrefix(v.state.inlinePaths, prefix)
-	clearPrefix(v.state.staticArrays, prefix)
+// clearSubScope forgets the paths below key, where a new array-of-tables
+// entry starts afresh.
+func (v *docValidator) clearSubScope(key string) {
+	clearBelow(v.state.explicitTables, key)
+	clearBelow(v.state.dottedKeyTables, key)
+	clearBelow(v.state.scalarPaths, key)
+	clearBelow(v.state.inlinePaths, key)
+	clearBelow(v.state.staticArrays, key)
 }
 
-func clearPrefix(m map[string]bool, prefix string) {
+func clearBelow(m map[string]bool, key string) {
 	for k := range m {
-		if strings.HasPrefix(k, prefix) {
+		if len(k) > len(key) && strings.HasPrefix(k, key) {
 			delete(m, k)
 		}
 	}
 }
 
-func (v *docValidator) checkKeyValue(baseParts []KeyPart, kv *KeyValue) error {
+// checkKeyValue checks kv in the table whose path key is base.
+func (v *docValidator) checkKeyValue(base string, kv *KeyValue) error {
 	ts := v.state
 
+	var key strings.Builder
+	key.WriteString(base)
 	for i := 0; i < len(kv.keyParts)-1; i++ {
-		intermediatePath := buildFullPath(baseParts, kv.keyParts[:i+1])
-		if msg := v.checkDottedIntermediate(intermediatePath); msg != "" {
-			return v.errorAt(msg, kv.line, kv.col)
+		writePathKey(&key, kv.keyParts[i].Unquoted)
+		if msg := v.checkDottedIntermediate(key.String(), base, kv.keyParts[:i+1]); msg != "" {
+			return v.errorAt(msg, kv, kv.rawKey)
 		}
-		ts.dottedKeyTables[intermediatePath] = true
+		ts.dottedKeyTables[key.String()] = true
 	}
 
-	leafPath := buildFullPath(baseParts, kv.keyParts)
+	writePathKey(&key, kv.keyParts[len(kv.keyParts)-1].Unquoted)
+	leafKey := key.String()
 
 	// Check for duplicate/conflicting key BEFORE marking the path.
-	if msg := v.checkLeafConflict(leafPath); msg != "" {
-		return v.errorAt(msg, kv.line, kv.col)
+	if msg := v.checkLeafConflict(leafKey, base, kv.keyParts); msg != "" {
+		return v.keyErrorAt(msg, fullPath(base, kv.keyParts), kv, kv.rawKey)
 	}
 
-	v.markLeafPath(leafPath, kv.val)
+	v.markLeafPath(leafKey, kv.val)
+	if err := checkExtensions(kv.val); err != nil {
+		return v.errorAt(fmt.Sprintf("invalid value for %q: %v", fullPath(base, kv.keyParts), err), kv, kv.rawKey)
+	}
 
 	// Check inline table entries for duplicate keys.
 	if it, ok := kv.val.(*InlineTableNode); ok {
-		if err := v.checkInlineTableKeys(leafPath, it, kv.line, kv.col); err != nil {
+		if err := v.checkInlineTableKeys(it, kv); err != nil {
 			return err
 		}
 	}
@@ -954,85 +1125,88 @@ func (v *docValidator) checkKeyValue(baseParts []KeyPart, kv *KeyValue) error {
 	return nil
 }
 
-func (v *docValidator) checkDottedIntermediate(path string) string {
+// fullPath returns the message path of parts in the table whose path key
+// is base.
+func fullPath(base string, parts []KeyPart) string {
+	return JoinPath(append(pathKeySegs(base), partsToSegs(parts)...)...)
+}
+
+func (v *docValidator) checkDottedIntermediate(key, base string, parts []KeyPart) string {
 	ts := v.state
-	if ts.inlinePaths[path] {
-		return fmt.Sprintf("cannot extend inline table at %q", path)
-	}
-	if ts.scalarPaths[path] {
-		return fmt.Sprintf("key %q already defined as a value", path)
-	}
-	if ts.explicitTables[path] {
-		return fmt.Sprintf("cannot add to explicitly defined table %q via dotted keys", path)
-	}
-	if ts.aotPaths[path] {
-		return fmt.Sprintf("cannot extend array of tables %q via dotted keys", path)
+	var format string
+	switch {
+	case ts.inlinePaths[key]:
+		format = "cannot extend inline table at %q"
+	case ts.scalarPaths[key]:
+		format = "key %q already defined as a value"
+	case ts.explicitTables[key]:
+		format = "cannot add to explicitly defined table %q via dotted keys"
+	case ts.aotPaths[key]:
+		format = "cannot extend array of tables %q via dotted keys"
+	default:
+		return ""
 	}
-	return ""
+	return fmt.Sprintf(format, fullPath(base, parts))
 }
 
-func (v *docValidator) markLeafPath(path string, val Node) {
+func (v *docValidator) markLeafPath(key string, val Node) {
 	ts := v.state
 	switch val.(type) {
 	case *InlineTableNode:
-		v.markInlinePaths(path, val)
+		v.markInlinePaths(key, val)
 	case *ArrayNode:
-		v.markInlinePaths(path, val)
-		ts.staticArrays[path] = true
+		v.markInlinePaths(key, val)
+		ts.staticArrays[key] = true
 	default:
-		ts.scalarPaths[path] = true
+		ts.scalarPaths[key] = true
 	}
 }
 
-func (v *docValidator) markInlinePaths(path string, val Node) {
-	v.state.inlinePaths[path] = true
+func (v *docValidator) markInlinePaths(key string, val Node) {
+	v.state.inlinePaths[key] = true
 	switch n := val.(type) {
 	case *InlineTableNode:
 		for _, kv := range n.entries {
-			subPath := path + "." + keyPartsToPath(kv.keyParts)
-			v.markInlinePaths(subPath, kv.val)
+			v.markInlinePaths(extendKey(key, kv.keyParts), kv.val)
 		}
 	case *ArrayNode:
 		for _, elem := range n.elements {
 			if it, ok := elem.(*InlineTableNode); ok {
 				for _, kv := range it.entries {
-					subPath := path + "." + keyPartsToPath(kv.keyParts)
-					v.markInlinePaths(subPath, kv.val)
+					v.markInlinePaths(extendKey(key, kv.keyParts), kv.val)
 				}
 			}
 		}
 	}
 }
 
-func (v *docValidator) checkLeafConflict(path string) string {
+func (v *docValidator) checkLeafConflict(key, base string, parts []KeyPart) string {
 	ts := v.state
-	if ts.scalarPaths[path] {
-		return fmt.Sprintf("duplicate key %q", path)
-	}
-	if ts.inlinePaths[path] {
-		return fmt.Sprintf("duplicate key %q", path)
-	}
-	if ts.dottedKeyTables[path] {
-		return fmt.Sprintf("key %q already used as a table via dotted keys", path)
-	}
-	if ts.aotPaths[path] {
-		return fmt.Sprintf("key %q already defined as array of tables", path)
+	var format string
+	switch {
+	case ts.scalarPaths[key], ts.inlinePaths[key]:
+		format = "duplicate key %q"
+	case ts.dottedKeyTables[key]:
+		format = "key %q already used as a table via dotted keys"
+	case ts.aotPaths[key]:
+		format = "key %q already defined as array of tables"
+	default:
+		return ""
 	}
-	return ""
+	return fmt.Sprintf(format, fullPath(base, parts))
 }
 
-func (v *docValidator) checkInlineTableKeys(_ string, it *InlineTableNode, line, col int) error {
+func (v *docValidator) checkInlineTableKeys(it *InlineTableNode, owner *KeyValue) error {
 	seen := make(map[string]bool)
 	for _, kv := range it.entries {
-		fullKey := keyPartsToPath(kv.keyParts)
+		fullKey := pathKey(kv.keyParts)
 		if seen[fullKey] {
-			return v.errorAt(fmt.Sprintf("duplicate key %q in inline table", fullKey), line, col)
+			return v.errorAt(fmt.Sprintf("duplicate key %q in inline table", JoinPath(partsToSegs(kv.keyParts)...)), owner, owner.rawKey)
 		}
 		seen[fullKey] = true
 		for i := 1; i < len(kv.keyParts); i++ {
-			prefix := keyPartsToPath(kv.keyParts[:i])
-			if seen[prefix] {
-				return v.errorAt(fmt.Sprintf("key %q conflicts with dotted key in inline table", prefix), line, col)
+			if seen[pathKey(kv.keyParts[:i])] {
+				return v.errorAt(fmt.Sprintf("key %q conflicts with dotted key in inline table", JoinPath(partsToSegs(kv.keyParts[:i])...)), owner, owner.rawKey)
 			}
 		}
 	}
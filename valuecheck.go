@@ -0,0 +1,139 @@
+package toml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValueValidator inspects one value of a parsed document. path is the
+// value's location in the form accepted by Get, with [i] selecting array
+// elements and array-of-tables entries, as in "servers[1].ports[0]". pos is
+// where the value starts in the source. A non-nil error fails the parse
+// with a ParseError at the value that wraps it.
+type ValueValidator func(path string, val Node, pos Position) error
+
+// valueChecker runs ValueValidators over every value of a document.
+type valueChecker struct {
+	validators []ValueValidator
+	source     string
+	spans      map[Node]Span
+	lines      []int          // offset of each line start in source
+	aots       map[string]int // entries seen per indexed array-of-tables path
+}
+
+func (o *ParseOptions) checkValues(doc *Document, source string) error {
+	if o == nil || len(o.ValueValidators) == 0 {
+		return nil
+	}
+	c := &valueChecker{
+		validators: o.ValueValidators,
+		source:     source,
+		spans:      doc.Spans(),
+		lines:      lineStarts(source),
+		aots:       make(map[string]int),
+	}
+	prefix := ""
+	for _, n := range doc.nodes {
+		var entries []Node
+		switch v := n.(type) {
+		case *KeyValue:
+			entries = []Node{v}
+		case *TableNode:
+			prefix, entries = c.headerPath(v.headerParts, false), v.entries
+		case *ArrayOfTables:
+			prefix, entries = c.headerPath(v.headerParts, true), v.entries
+		}
+		for kv := range keyValuesSeq(entries) {
+			if err := c.keyValue(prefix, kv); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// headerPath returns the indexed path of a header, counting a new entry if
+// the header opens an array-of-tables entry. Each segment that names an
+// array of tables selects its current entry.
+func (c *valueChecker) headerPath(parts []KeyPart, aot bool) string {
+	path := ""
+	for i, p := range parts {
+		path = joinPath(path, QuoteKey(p.Unquoted))
+		if aot && i == len(parts)-1 {
+			c.aots[path]++
+		}
+		if n, ok := c.aots[path]; ok {
+			path += "[" + strconv.Itoa(n-1) + "]"
+		}
+	}
+	return path
+}
+
+func (c *valueChecker) keyValue(prefix string, kv *KeyValue) error {
+	return c.value(joinPath(prefix, formatKeyPath(kv.keyParts)), kv.val)
+}
+
+func (c *valueChecker) value(path string, val Node) error {
+	sp := c.spans[val]
+	pos := c.position(sp.Start)
+	for _, fn := range c.validators {
+		if err := fn(path, val, pos); err != nil {
+			return c.errorAt(path, val, sp.Start, pos, err)
+		}
+	}
+	switch v := val.(type) {
+	case *ArrayNode:
+		for i, elem := range v.elements {
+			if err := c.value(path+"["+strconv.Itoa(i)+"]", elem); err != nil {
+				return err
+			}
+		}
+	case *InlineTableNode:
+		for _, kv := range v.entries {
+			if err := c.keyValue(path, kv); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// position is PositionAt without rescanning the source for each value.
+func (c *valueChecker) position(off int) Position {
+	return positionIn(c.source, c.lines, off)
+}
+
+func (c *valueChecker) errorAt(path string, val Node, start int, pos Position, err error) error {
+	token := val.Text()
+	if i := strings.IndexByte(token, '\n'); i >= 0 {
+		token = token[:i]
+	}
+	msg := fmt.Sprintf("invalid value for %q: %v", path, err)
+	return &ParseError{
+		Message: msg,
+		Line:    pos.Line,
+		Column:  pos.Column,
+		Source:  c.source,
+		Token:   token,
+		Span:    Span{start, start + len(token)},
+		Err:     err,
+	}
+}
+
+func lineStarts(src string) []int {
+	starts := []int{0}
+	for i := range len(src) {
+		if src[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+func joinPath(prefix, path string) string {
+	if prefix == "" {
+		return path
+	}
+	return prefix + "." + path
+}
@@ -0,0 +1,110 @@
+package toml
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// Warning messages logged by ParseWithOptions when a Logger is set.
+const (
+	warnEscape          = "TOML 1.1 escape sequence"
+	warnMultiLineInline = "TOML 1.1 multi-line inline table"
+	warnTrailingComma   = "TOML 1.1 trailing comma in inline table"
+	warnNoSeconds       = "TOML 1.1 time without seconds"
+	warnMixedNewlines   = "mixed line endings"
+)
+
+// warner reports non-fatal findings about a parsed document to a logger.
+// Findings are portability notices: syntax this package accepts but that
+// TOML 1.0 parsers reject, and inconsistent line endings.
+type warner struct {
+	ctx    context.Context
+	logger *slog.Logger
+}
+
+func (w *warner) warnDocument(doc *Document, source string) {
+	w.warnNewlines(source)
+	var visit func(n Node, kv *KeyValue) bool
+	visit = func(n Node, kv *KeyValue) bool {
+		if k, ok := n.(*KeyValue); ok {
+			kv = k
+		}
+		w.warnNode(n, kv)
+		return eachChild(n, func(c Node) bool { return visit(c, kv) })
+	}
+	visit(doc, nil)
+}
+
+func (w *warner) warnNode(n Node, kv *KeyValue) {
+	switch v := n.(type) {
+	case *StringNode:
+		if seq := toml11Escape(v.text); seq != "" {
+			w.warn(warnEscape, kv, slog.String("escape", seq))
+		}
+	case *DateTimeNode:
+		if v.Kind() == LocalDate {
+			return
+		}
+		if f, err := parseDateTimeFields(v.text); err == nil && !f.hasSeconds {
+			w.warn(warnNoSeconds, kv, slog.String("value", v.text))
+		}
+	case *InlineTableNode:
+		w.warnInlineTable(v, kv)
+	}
+}
+
+func (w *warner) warnInlineTable(it *InlineTableNode, kv *KeyValue) {
+	if len(it.seps) != len(it.entries)+1 || len(it.entries) == 0 {
+		return
+	}
+	for _, sep := range it.seps {
+		if strings.ContainsAny(sep, "\r\n") {
+			w.warn(warnMultiLineInline, kv)
+			break
+		}
+	}
+	if strings.Contains(it.seps[len(it.seps)-1], ",") {
+		w.warn(warnTrailingComma, kv)
+	}
+}
+
+func (w *warner) warnNewlines(source string) {
+	crlf := strings.Count(source, "\r\n")
+	lf := strings.Count(source, "\n") - crlf
+	if crlf > 0 && lf > 0 {
+		w.logger.LogAttrs(w.ctx, slog.LevelWarn, warnMixedNewlines, slog.Int("crlf", crlf), slog.Int("lf", lf))
+	}
+}
+
+// warn logs msg at the position of kv, the nearest enclosing key-value.
+func (w *warner) warn(msg string, kv *KeyValue, attrs ...slog.Attr) {
+	if kv != nil {
+		attrs = append(attrs,
+			slog.Int("line", int(kv.line)),
+			slog.Int("column", int(kv.col)),
+			slog.String("key", kv.rawKey))
+	}
+	w.logger.LogAttrs(w.ctx, slog.LevelWarn, msg, attrs...)
+}
+
+// toml11Escape returns the first \e or \x escape in the raw text of a basic
+// string, or "" if there is none.
+func toml11Escape(raw string) string {
+	if !strings.HasPrefix(raw, `"`) {
+		return ""
+	}
+	for i := 0; i < len(raw)-1; i++ {
+		if raw[i] != '\\' {
+			continue
+		}
+		switch raw[i+1] {
+		case 'e':
+			return raw[i : i+2]
+		case 'x':
+			return raw[i:min(i+4, len(raw))]
+		}
+		i++ // skip the escaped character
+	}
+	return ""
+}
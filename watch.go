@@ -0,0 +1,267 @@
+package toml
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileWatcher reports possible changes to a file. Implementations may
+// report spuriously; Watch rereads the file and ignores reports where its
+// content did not change.
+type FileWatcher interface {
+	// Watch calls changed, from any goroutine, whenever the file at path
+	// may have changed, until stop is called.
+	Watch(path string, changed func()) (stop func(), err error)
+}
+
+// PollWatcher is a FileWatcher that checks a file's size and
+// modification time at a fixed interval. The zero value polls every half
+// second.
+type PollWatcher struct {
+	Interval time.Duration
+}
+
+// Watch implements FileWatcher.
+func (p PollWatcher) Watch(path string, changed func()) (func(), error) {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+	last, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if fi, _ := os.Stat(path); !sameFileState(last, fi) {
+				last = fi
+				changed()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}, nil
+}
+
+func sameFileState(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// WatchOptions configures WatchWithOptions. The zero value gives the
+// defaults described on each field.
+type WatchOptions struct {
+	// Watcher reports changes to the file. Nil means a PollWatcher with
+	// its default interval.
+	Watcher FileWatcher
+
+	// Debounce is how long the file must go without a reported change
+	// before it is read, so that a burst of writes is read once. Zero
+	// means 100ms.
+	Debounce time.Duration
+
+	// Retries is how many more times the file is read when it fails to
+	// parse, in case a writer was still writing it, and RetryDelay is the
+	// wait before each retry. Zero means 3 retries 100ms apart; a
+	// negative Retries disables retrying.
+	Retries    int
+	RetryDelay time.Duration
+
+	// ParseOptions is used to parse the file.
+	ParseOptions ParseOptions
+}
+
+func (o *WatchOptions) setDefaults() {
+	if o.Watcher == nil {
+		o.Watcher = PollWatcher{}
+	}
+	if o.Debounce <= 0 {
+		o.Debounce = 100 * time.Millisecond
+	}
+	switch {
+	case o.Retries == 0:
+		o.Retries = 3
+	case o.Retries < 0:
+		o.Retries = 0
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = 100 * time.Millisecond
+	}
+}
+
+// Watch calls onChange with the newly parsed document each time the file
+// at path changes, as WatchWithOptions does with default options.
+func Watch(path string, onChange func(*Document, error)) (stop func(), err error) {
+	return WatchWithOptions(path, WatchOptions{}, onChange)
+}
+
+// WatchWithOptions calls onChange with the newly parsed document each time
+// the content of the file at path changes. Changes are debounced, and a
+// file that fails to parse is read again a few times before the error is
+// delivered, so that a file caught halfway through being written is not
+// reported as invalid. Read errors, such as for a deleted file, are
+// delivered as they are. onChange is called from a single goroutine, one
+// call at a time, and not for the content present when watching starts.
+//
+// stop ends watching and waits for a running onChange to return; it must
+// not be called from onChange. The error is that of the first read of the
+// file or of starting the watcher.
+func WatchWithOptions(path string, opts WatchOptions, onChange func(*Document, error)) (stop func(), err error) {
+	last, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return startWatch(path, opts, last, onChange)
+}
+
+// WatchDiff is WatchWithOptions for applications that apply settings
+// piecemeal: it parses the file, returns the document, and from then on
+// calls onChange with the previous and new documents and the Diff between
+// them each time the file's values change, so that only the affected
+// settings need to be reapplied. Edits that change no value, such as to
+// comments or formatting, are not delivered. Errors reading or parsing the
+// file are passed to onError, which may be nil, and old remains the last
+// document successfully parsed. The error is that of the first read or
+// parse of the file or of starting the watcher.
+func WatchDiff(path string, opts WatchOptions, onChange func(old, updated *Document, changes []Change),
+	onError func(error),
+) (doc *Document, stop func(), err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err = ParseWithOptions(b, opts.ParseOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	last := doc
+	stop, err = startWatch(path, opts, b, func(next *Document, err error) {
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+			return
+		}
+		changes := Diff(last, next)
+		if len(changes) == 0 {
+			return
+		}
+		old := last
+		last = next
+		onChange(old, next, changes)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, stop, nil
+}
+
+// startWatch watches path, whose content is last, for WatchWithOptions.
+func startWatch(path string, opts WatchOptions, last []byte, onChange func(*Document, error)) (func(), error) {
+	opts.setDefaults()
+	w := &fileWatch{
+		path:     path,
+		opts:     opts,
+		onChange: onChange,
+		last:     last,
+		events:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	stopWatcher, err := opts.Watcher.Watch(path, w.notify)
+	if err != nil {
+		return nil, err
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.run()
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			stopWatcher()
+			close(w.done)
+			wg.Wait()
+		})
+	}, nil
+}
+
+// fileWatch is the state of one WatchWithOptions call.
+type fileWatch struct {
+	path     string
+	opts     WatchOptions
+	onChange func(*Document, error)
+	last     []byte // content last read, nil after a read error
+	events   chan struct{}
+	done     chan struct{}
+}
+
+func (w *fileWatch) notify() {
+	select {
+	case w.events <- struct{}{}:
+	default: // a change is already pending
+	}
+}
+
+func (w *fileWatch) run() {
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.events:
+			settle = time.After(w.opts.Debounce)
+		case <-settle:
+			settle = nil
+			w.reload()
+		}
+	}
+}
+
+// reload reads and parses the file, retrying parse errors, and delivers
+// the result if the content changed.
+func (w *fileWatch) reload() {
+	for attempt := 0; ; attempt++ {
+		b, err := os.ReadFile(w.path)
+		if err != nil {
+			w.last = nil
+			w.onChange(nil, err)
+			return
+		}
+		if bytes.Equal(b, w.last) {
+			return
+		}
+		doc, err := ParseWithOptions(b, w.opts.ParseOptions)
+		if err == nil || attempt >= w.opts.Retries {
+			w.last = b
+			w.onChange(doc, err)
+			return
+		}
+		select {
+		case <-w.done:
+			return
+		case <-time.After(w.opts.RetryDelay):
+		}
+	}
+}